@@ -31,7 +31,7 @@ use self::openssl::nid::Nid;
 use self::openssl::pkcs12::Pkcs12;
 use self::openssl::pkey::{PKey, Private};
 use self::openssl::ssl::{
-    self, MidHandshakeSslStream, SslAcceptor, SslConnector, SslContextBuilder, SslMethod,
+    self, AlpnError, MidHandshakeSslStream, SslAcceptor, SslConnector, SslContextBuilder, SslMethod,
     SslVerifyMode,
 };
 use self::openssl::x509::{store::X509StoreBuilder, X509VerifyResult, X509};
@@ -59,6 +59,12 @@ fn supported_protocols(
             Protocol::Tlsv10 => SslVersion::TLS1,
             Protocol::Tlsv11 => SslVersion::TLS1_1,
             Protocol::Tlsv12 => SslVersion::TLS1_2,
+            #[cfg(have_tls13)]
+            Protocol::Tlsv13 => SslVersion::TLS1_3,
+            // Rejected by `check_tls13_support` as a minimum; as a maximum
+            // it is the newest version this OpenSSL has.
+            #[cfg(not(have_tls13))]
+            Protocol::Tlsv13 => SslVersion::TLS1_2,
         }
     }
 
@@ -91,7 +97,7 @@ fn supported_protocols(
         Some(Protocol::Tlsv11) => {
             SslOptions::NO_SSLV2 | SslOptions::NO_SSLV3 | SslOptions::NO_TLSV1
         }
-        Some(Protocol::Tlsv12) => {
+        Some(Protocol::Tlsv12) | Some(Protocol::Tlsv13) => {
             SslOptions::NO_SSLV2
                 | SslOptions::NO_SSLV3
                 | SslOptions::NO_TLSV1
@@ -99,7 +105,7 @@ fn supported_protocols(
         }
     };
     options |= match max {
-        None | Some(Protocol::Tlsv12) => SslOptions::empty(),
+        None | Some(Protocol::Tlsv12) | Some(Protocol::Tlsv13) => SslOptions::empty(),
         Some(Protocol::Tlsv11) => SslOptions::NO_TLSV1_2,
         Some(Protocol::Tlsv10) => SslOptions::NO_TLSV1_1 | SslOptions::NO_TLSV1_2,
         Some(Protocol::Sslv3) => {
@@ -112,6 +118,25 @@ fn supported_protocols(
     Ok(())
 }
 
+#[cfg(have_tls13)]
+fn check_tls13_support(_builder: &TlsAcceptorBuilder) -> Result<(), Error> {
+    Ok(())
+}
+
+#[cfg(not(have_tls13))]
+fn check_tls13_support(builder: &TlsAcceptorBuilder) -> Result<(), Error> {
+    if matches!(builder.min_protocol, Some(Protocol::Tlsv13)) {
+        return Err(Error::Unsupported("TLS 1.3"));
+    }
+    if builder.ciphersuites.is_some() {
+        return Err(Error::Unsupported("TLS 1.3 cipher suites"));
+    }
+    if builder.groups_list.is_some() {
+        return Err(Error::Unsupported("a groups list"));
+    }
+    Ok(())
+}
+
 #[cfg(target_os = "android")]
 fn load_android_root_certs(connector: &mut SslContextBuilder) -> Result<(), Error> {
     use std::fs;
@@ -137,6 +162,7 @@ pub enum Error {
     Ssl(ssl::Error, X509VerifyResult),
     EmptyChain,
     NotPkcs8,
+    Unsupported(&'static str),
 }
 
 impl error::Error for Error {
@@ -146,6 +172,7 @@ impl error::Error for Error {
             Error::Ssl(ref e, _) => error::Error::source(e),
             Error::EmptyChain => None,
             Error::NotPkcs8 => None,
+            Error::Unsupported(_) => None,
         }
     }
 }
@@ -161,6 +188,7 @@ impl fmt::Display for Error {
                 "at least one certificate must be provided to create an identity"
             ),
             Error::NotPkcs8 => write!(fmt, "expected PKCS#8 PEM"),
+            Error::Unsupported(what) => write!(fmt, "{} requires OpenSSL 1.1.1 or newer", what),
         }
     }
 }
@@ -414,7 +442,30 @@ impl TlsAcceptor {
             // sent in order following the end entity certificate."
             acceptor.add_extra_chain_cert(cert.to_owned())?;
         }
+        check_tls13_support(builder)?;
         supported_protocols(builder.min_protocol, builder.max_protocol, &mut acceptor)?;
+        if let Some(cipher_list) = &builder.cipher_list {
+            acceptor.set_cipher_list(cipher_list)?;
+        }
+        #[cfg(have_tls13)]
+        {
+            if let Some(ciphersuites) = &builder.ciphersuites {
+                acceptor.set_ciphersuites(ciphersuites)?;
+            }
+            if let Some(groups_list) = &builder.groups_list {
+                acceptor.set_groups_list(groups_list)?;
+            }
+        }
+        if !builder.alpn_protocols.is_empty() {
+            let mut alpn_wire_format = Vec::new();
+            for alpn in builder.alpn_protocols.iter().map(|s| s.as_bytes()) {
+                alpn_wire_format.push(alpn.len() as u8);
+                alpn_wire_format.extend(alpn);
+            }
+            acceptor.set_alpn_select_callback(move |_, client| {
+                ssl::select_next_proto(&alpn_wire_format, client).ok_or(AlpnError::ALERT_FATAL)
+            });
+        }
 
         Ok(TlsAcceptor(acceptor.build()))
     }
@@ -515,6 +566,10 @@ impl<S: io::Read + io::Write> TlsStream<S> {
             .map(|alpn| alpn.to_vec()))
     }
 
+    pub fn protocol_version(&self) -> Option<&'static str> {
+        Some(self.0.ssl().version_str())
+    }
+
     pub fn tls_server_end_point(&self) -> Result<Option<Vec<u8>>, Error> {
         let cert = if self.0.ssl().is_server() {
             self.0.ssl().certificate().map(|x| x.to_owned())
@@ -392,6 +392,10 @@ impl<S: io::Read + io::Write> TlsStream<S> {
         Ok(self.0.negotiated_application_protocol()?)
     }
 
+    pub fn protocol_version(&self) -> Option<&'static str> {
+        None
+    }
+
     pub fn tls_server_end_point(&self) -> Result<Option<Vec<u8>>, Error> {
         let cert = if self.0.is_server() {
             self.0.certificate()
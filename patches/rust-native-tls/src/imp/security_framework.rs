@@ -74,6 +74,7 @@ fn convert_protocol(protocol: Protocol) -> SslProtocol {
         Protocol::Tlsv10 => SslProtocol::TLS1,
         Protocol::Tlsv11 => SslProtocol::TLS11,
         Protocol::Tlsv12 => SslProtocol::TLS12,
+        Protocol::Tlsv13 => SslProtocol::TLS13,
     }
 }
 
@@ -535,6 +536,10 @@ impl<S: io::Read + io::Write> TlsStream<S> {
         }
     }
 
+    pub fn protocol_version(&self) -> Option<&'static str> {
+        None
+    }
+
     #[cfg(any(
         target_os = "ios",
         target_os = "watchos",
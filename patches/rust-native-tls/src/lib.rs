@@ -321,6 +321,8 @@ pub enum Protocol {
     Tlsv11,
     /// The TLS 1.2 protocol.
     Tlsv12,
+    /// The TLS 1.3 protocol.
+    Tlsv13,
 }
 
 /// A builder for `TlsConnector`s.
@@ -523,7 +525,15 @@ pub struct TlsAcceptorBuilder {
     #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
     client_cert_verification: TlsClientCertificateVerification,
     #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
-    client_cert_verification_ca_cert: Option<Certificate>
+    client_cert_verification_ca_cert: Option<Certificate>,
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    cipher_list: Option<String>,
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    ciphersuites: Option<String>,
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    groups_list: Option<String>,
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    alpn_protocols: Vec<String>,
 }
 
 impl TlsAcceptorBuilder {
@@ -567,6 +577,45 @@ impl TlsAcceptorBuilder {
         self
     }
 
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    /// Sets the cipher list for TLS 1.2 and older, in OpenSSL cipher string format.
+    ///
+    /// Defaults to the Mozilla "intermediate" list.
+    pub fn cipher_list(&mut self, cipher_list: Option<String>) -> &mut TlsAcceptorBuilder {
+        self.cipher_list = cipher_list;
+        self
+    }
+
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    /// Sets the TLS 1.3 cipher suites, a colon-separated list.
+    ///
+    /// Defaults to the OpenSSL built-in list.
+    pub fn ciphersuites(&mut self, ciphersuites: Option<String>) -> &mut TlsAcceptorBuilder {
+        self.ciphersuites = ciphersuites;
+        self
+    }
+
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    /// Sets the supported key exchange groups (curves) in preference order,
+    /// a colon-separated list.
+    ///
+    /// Defaults to the OpenSSL built-in list.
+    pub fn groups_list(&mut self, groups_list: Option<String>) -> &mut TlsAcceptorBuilder {
+        self.groups_list = groups_list;
+        self
+    }
+
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    /// Sets the ALPN protocols the acceptor selects from, in preference
+    /// order. A client offering protocols but none of these gets a fatal
+    /// `no_application_protocol` alert; a client offering none is accepted.
+    ///
+    /// Defaults to no ALPN.
+    pub fn alpn_protocols(&mut self, protocols: &[&str]) -> &mut TlsAcceptorBuilder {
+        self.alpn_protocols = protocols.iter().map(|s| (*s).to_owned()).collect();
+        self
+    }
+
     /// Creates a new `TlsAcceptor`.
     pub fn build(&self) -> Result<TlsAcceptor> {
         let acceptor = imp::TlsAcceptor::new(self)?;
@@ -635,6 +684,14 @@ impl TlsAcceptor {
             client_cert_verification: TlsClientCertificateVerification::DoNotRequestCertificate,
             #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
             client_cert_verification_ca_cert: None,
+            #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+            cipher_list: None,
+            #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+            ciphersuites: None,
+            #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+            groups_list: None,
+            #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+            alpn_protocols: vec![],
         }
     }
 
@@ -720,6 +777,13 @@ impl<S: io::Read + io::Write> TlsStream<S> {
         Ok(self.0.negotiated_alpn()?)
     }
 
+    /// Returns the negotiated protocol version, such as `"TLSv1.3"`.
+    ///
+    /// Only the OpenSSL backend reports it; the others return `None`.
+    pub fn protocol_version(&self) -> Option<&'static str> {
+        self.0.protocol_version()
+    }
+
     /// Shuts down the TLS session.
     pub fn shutdown(&mut self) -> io::Result<()> {
         self.0.shutdown()?;
@@ -0,0 +1,343 @@
+//! Minimal RFC 8555 client: account, order, HTTP-01 challenge, finalize.
+
+use base64::{engine::general_purpose::URL_SAFE_NO_PAD, Engine as _};
+use openssl::bn::BigNumContext;
+use openssl::ec::{EcGroup, EcKey};
+use openssl::ecdsa::EcdsaSig;
+use openssl::nid::Nid;
+use openssl::pkey::Private;
+use parking_lot::Mutex;
+use serde_derive::Deserialize;
+use serde_json::{json, Value};
+use sha2::{Digest, Sha256};
+
+use crate::config::Acme;
+use crate::utils::strings::truncate_bytes;
+
+const JOSE_CONTENT_TYPE: &str = "application/jose+json";
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct Directory {
+    new_nonce: String,
+    new_account: String,
+    new_order: String,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Order {
+    pub status: String,
+    #[serde(default)]
+    pub authorizations: Vec<String>,
+    pub finalize: String,
+    #[serde(default)]
+    pub certificate: Option<String>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Authorization {
+    pub status: String,
+    pub identifier: Identifier,
+    #[serde(default)]
+    pub challenges: Vec<Challenge>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Identifier {
+    pub value: String,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Challenge {
+    #[serde(rename = "type")]
+    pub kind: String,
+    pub url: String,
+    #[serde(default)]
+    pub token: String,
+}
+
+/// ES256 account key and its JWK thumbprint (RFC 7638).
+pub struct AccountKey {
+    key: EcKey<Private>,
+    jwk: Value,
+    thumbprint: String,
+}
+
+impl AccountKey {
+    /// Load the key from `path`, creating it (mode 0600) when missing.
+    pub fn load_or_create(path: &str) -> Result<Self, String> {
+        let key = match std::fs::read(path) {
+            Ok(pem) => EcKey::private_key_from_pem(&pem)
+                .map_err(|e| format!("parsing account key {path}: {e}"))?,
+            Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+                let key = new_p256_key()?;
+                let pem = key
+                    .private_key_to_pem()
+                    .map_err(|e| format!("encoding account key: {e}"))?;
+                super::write_private(path, &pem)
+                    .map_err(|e| format!("writing account key {path}: {e}"))?;
+                key
+            }
+            Err(err) => return Err(format!("reading account key {path}: {err}")),
+        };
+        Self::from_key(key)
+    }
+
+    fn from_key(key: EcKey<Private>) -> Result<Self, String> {
+        if key.group().curve_name() != Some(Nid::X9_62_PRIME256V1) {
+            return Err("account key must be an EC P-256 key".into());
+        }
+        let mut ctx = BigNumContext::new().map_err(|e| format!("{e}"))?;
+        let mut x = openssl::bn::BigNum::new().map_err(|e| format!("{e}"))?;
+        let mut y = openssl::bn::BigNum::new().map_err(|e| format!("{e}"))?;
+        key.public_key()
+            .affine_coordinates(key.group(), &mut x, &mut y, &mut ctx)
+            .map_err(|e| format!("{e}"))?;
+        let x = URL_SAFE_NO_PAD.encode(x.to_vec_padded(32).map_err(|e| format!("{e}"))?);
+        let y = URL_SAFE_NO_PAD.encode(y.to_vec_padded(32).map_err(|e| format!("{e}"))?);
+        // Members in lexicographic order, no whitespace, as RFC 7638 requires.
+        let canonical = format!(r#"{{"crv":"P-256","kty":"EC","x":"{x}","y":"{y}"}}"#);
+        let thumbprint = URL_SAFE_NO_PAD.encode(Sha256::digest(canonical.as_bytes()));
+        Ok(Self {
+            key,
+            jwk: json!({"crv": "P-256", "kty": "EC", "x": x, "y": y}),
+            thumbprint,
+        })
+    }
+
+    /// Body the CA expects at `/.well-known/acme-challenge/<token>`.
+    pub fn key_authorization(&self, token: &str) -> String {
+        format!("{token}.{}", self.thumbprint)
+    }
+
+    /// JWS in flattened JSON serialization.
+    fn sign(&self, protected: &Value, payload: &str) -> Result<Value, String> {
+        let protected = URL_SAFE_NO_PAD.encode(protected.to_string());
+        let digest = Sha256::digest(format!("{protected}.{payload}").as_bytes());
+        let sig = EcdsaSig::sign(&digest, &self.key).map_err(|e| format!("signing: {e}"))?;
+        let mut raw = sig.r().to_vec_padded(32).map_err(|e| format!("{e}"))?;
+        raw.extend(sig.s().to_vec_padded(32).map_err(|e| format!("{e}"))?);
+        Ok(json!({
+            "protected": protected,
+            "payload": payload,
+            "signature": URL_SAFE_NO_PAD.encode(raw),
+        }))
+    }
+}
+
+pub fn new_p256_key() -> Result<EcKey<Private>, String> {
+    let group = EcGroup::from_curve_name(Nid::X9_62_PRIME256V1).map_err(|e| format!("{e}"))?;
+    EcKey::generate(&group).map_err(|e| format!("generating key: {e}"))
+}
+
+struct Response {
+    location: Option<String>,
+    body: String,
+}
+
+pub struct AcmeClient {
+    http: reqwest::Client,
+    directory: Directory,
+    key: AccountKey,
+    kid: Option<String>,
+    nonce: Mutex<Option<String>>,
+}
+
+impl AcmeClient {
+    pub async fn new(config: &Acme, key: AccountKey) -> Result<Self, String> {
+        let mut builder = reqwest::Client::builder().timeout(std::time::Duration::from_secs(30));
+        if let Some(ca_file) = &config.ca_file {
+            let pem = std::fs::read(ca_file).map_err(|e| format!("reading {ca_file}: {e}"))?;
+            for cert in reqwest::Certificate::from_pem_bundle(&pem)
+                .map_err(|e| format!("parsing {ca_file}: {e}"))?
+            {
+                builder = builder.add_root_certificate(cert);
+            }
+        }
+        let http = builder.build().map_err(|e| format!("{e}"))?;
+        let resp = http
+            .get(&config.directory_url)
+            .send()
+            .await
+            .map_err(|e| format!("directory: {e}"))?;
+        let status = resp.status();
+        let body = resp.text().await.map_err(|e| format!("directory: {e}"))?;
+        if !status.is_success() {
+            return Err(format!(
+                "directory: HTTP {status}: {}",
+                truncate_bytes(&body, 512)
+            ));
+        }
+        let directory = serde_json::from_str(&body)
+            .map_err(|e| format!("directory: unexpected response: {e}"))?;
+        Ok(Self {
+            http,
+            directory,
+            key,
+            kid: None,
+            nonce: Mutex::new(None),
+        })
+    }
+
+    pub fn key_authorization(&self, token: &str) -> String {
+        self.key.key_authorization(token)
+    }
+
+    /// Find or create the account for the key; later requests use its URL.
+    pub async fn register(&mut self, contact: &[String]) -> Result<(), String> {
+        let url = self.directory.new_account.clone();
+        let payload = json!({"termsOfServiceAgreed": true, "contact": contact});
+        let resp = self.post(&url, Some(&payload)).await?;
+        let kid = resp
+            .location
+            .ok_or("newAccount: response has no Location header")?;
+        self.kid = Some(kid);
+        Ok(())
+    }
+
+    /// Returns the order URL and the order.
+    pub async fn new_order(&self, domains: &[String]) -> Result<(String, Order), String> {
+        let url = self.directory.new_order.clone();
+        let identifiers: Vec<Value> = domains
+            .iter()
+            .map(|d| json!({"type": "dns", "value": d}))
+            .collect();
+        let resp = self
+            .post(&url, Some(&json!({"identifiers": identifiers})))
+            .await?;
+        let order_url = resp
+            .location
+            .ok_or("newOrder: response has no Location header")?;
+        Ok((order_url, parse("order", &resp.body)?))
+    }
+
+    pub async fn order(&self, url: &str) -> Result<Order, String> {
+        let resp = self.post(url, None).await?;
+        parse("order", &resp.body)
+    }
+
+    pub async fn authorization(&self, url: &str) -> Result<Authorization, String> {
+        let resp = self.post(url, None).await?;
+        parse("authorization", &resp.body)
+    }
+
+    /// Tell the CA the challenge response is in place.
+    pub async fn respond(&self, challenge_url: &str) -> Result<(), String> {
+        self.post(challenge_url, Some(&json!({}))).await.map(|_| ())
+    }
+
+    pub async fn finalize(&self, url: &str, csr_der: &[u8]) -> Result<Order, String> {
+        let payload = json!({"csr": URL_SAFE_NO_PAD.encode(csr_der)});
+        let resp = self.post(url, Some(&payload)).await?;
+        parse("order", &resp.body)
+    }
+
+    /// PEM chain, leaf first.
+    pub async fn certificate(&self, url: &str) -> Result<String, String> {
+        Ok(self.post(url, None).await?.body)
+    }
+
+    async fn fresh_nonce(&self) -> Result<String, String> {
+        if let Some(nonce) = self.nonce.lock().take() {
+            return Ok(nonce);
+        }
+        let resp = self
+            .http
+            .head(&self.directory.new_nonce)
+            .send()
+            .await
+            .map_err(|e| format!("newNonce: {e}"))?;
+        replay_nonce(&resp).ok_or_else(|| "newNonce: no Replay-Nonce header".to_string())
+    }
+
+    /// Signed POST; `payload` of `None` is a POST-as-GET. A `badNonce`
+    /// rejection is retried once with the nonce it carries.
+    async fn post(&self, url: &str, payload: Option<&Value>) -> Result<Response, String> {
+        let payload = payload
+            .map(|p| URL_SAFE_NO_PAD.encode(p.to_string()))
+            .unwrap_or_default();
+        let mut retried = false;
+        loop {
+            let nonce = self.fresh_nonce().await?;
+            let mut protected = json!({"alg": "ES256", "nonce": nonce, "url": url});
+            match &self.kid {
+                Some(kid) => protected["kid"] = json!(kid),
+                None => protected["jwk"] = self.key.jwk.clone(),
+            }
+            let body = self.key.sign(&protected, &payload)?;
+            let resp = self
+                .http
+                .post(url)
+                .header(reqwest::header::CONTENT_TYPE, JOSE_CONTENT_TYPE)
+                .body(body.to_string())
+                .send()
+                .await
+                .map_err(|e| format!("{url}: {e}"))?;
+            *self.nonce.lock() = replay_nonce(&resp);
+            let status = resp.status();
+            let location = resp
+                .headers()
+                .get(reqwest::header::LOCATION)
+                .and_then(|v| v.to_str().ok())
+                .map(str::to_string);
+            let body = resp.text().await.map_err(|e| format!("{url}: {e}"))?;
+            if status.is_success() {
+                return Ok(Response { location, body });
+            }
+            if !retried && body.contains("urn:ietf:params:acme:error:badNonce") {
+                retried = true;
+                continue;
+            }
+            return Err(format!(
+                "{url}: HTTP {status}: {}",
+                truncate_bytes(&body, 512)
+            ));
+        }
+    }
+}
+
+fn replay_nonce(resp: &reqwest::Response) -> Option<String> {
+    resp.headers()
+        .get("Replay-Nonce")
+        .and_then(|v| v.to_str().ok())
+        .map(str::to_string)
+}
+
+fn parse<T: serde::de::DeserializeOwned>(what: &str, body: &str) -> Result<T, String> {
+    serde_json::from_str(body).map_err(|e| format!("{what}: unexpected response: {e}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn jws_signature_verifies() {
+        let key = AccountKey::from_key(new_p256_key().unwrap()).unwrap();
+        let protected = json!({"alg": "ES256", "nonce": "n", "url": "https://ca/acme"});
+        let jws = key.sign(&protected, "e30").unwrap();
+
+        let signing_input = format!("{}.e30", jws["protected"].as_str().unwrap());
+        let raw = URL_SAFE_NO_PAD
+            .decode(jws["signature"].as_str().unwrap())
+            .unwrap();
+        assert_eq!(raw.len(), 64);
+        let sig = EcdsaSig::from_private_components(
+            openssl::bn::BigNum::from_slice(&raw[..32]).unwrap(),
+            openssl::bn::BigNum::from_slice(&raw[32..]).unwrap(),
+        )
+        .unwrap();
+        let digest = Sha256::digest(signing_input.as_bytes());
+        assert!(sig.verify(&digest, &key.key).unwrap());
+    }
+
+    #[test]
+    fn key_authorization_uses_thumbprint() {
+        let key = AccountKey::from_key(new_p256_key().unwrap()).unwrap();
+        let auth = key.key_authorization("tok");
+        let (token, thumbprint) = auth.split_once('.').unwrap();
+        assert_eq!(token, "tok");
+        // base64url of a SHA-256 digest
+        assert_eq!(thumbprint.len(), 43);
+    }
+}
@@ -0,0 +1,123 @@
+//! HTTP-01 challenge responder, listening only while an order is pending.
+
+use std::collections::HashMap;
+use std::sync::Arc;
+
+use log::{debug, warn};
+use parking_lot::Mutex;
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::net::{TcpListener, TcpStream};
+use tokio::task::JoinHandle;
+
+const CHALLENGE_PREFIX: &str = "/.well-known/acme-challenge/";
+/// Longest request head read; challenge requests are a few hundred bytes.
+const MAX_REQUEST_HEAD: usize = 8192;
+
+/// Serves key authorizations by token. Stops listening when dropped.
+pub struct Responder {
+    tokens: Arc<Mutex<HashMap<String, String>>>,
+    task: JoinHandle<()>,
+}
+
+impl Responder {
+    pub async fn bind(addr: &str) -> Result<Self, String> {
+        let listener = TcpListener::bind(addr)
+            .await
+            .map_err(|e| format!("binding HTTP-01 responder to {addr}: {e}"))?;
+        let tokens: Arc<Mutex<HashMap<String, String>>> = Arc::default();
+        let served = tokens.clone();
+        let task = tokio::spawn(async move {
+            loop {
+                let (stream, peer) = match listener.accept().await {
+                    Ok(accepted) => accepted,
+                    Err(err) => {
+                        warn!("ACME HTTP-01 responder: accept failed: {err}");
+                        continue;
+                    }
+                };
+                let tokens = served.clone();
+                tokio::spawn(async move {
+                    if let Err(err) = serve(stream, &tokens).await {
+                        debug!("ACME HTTP-01 responder: {peer}: {err}");
+                    }
+                });
+            }
+        });
+        Ok(Self { tokens, task })
+    }
+
+    pub fn publish(&self, token: &str, key_authorization: String) {
+        self.tokens
+            .lock()
+            .insert(token.to_string(), key_authorization);
+    }
+}
+
+impl Drop for Responder {
+    fn drop(&mut self) {
+        self.task.abort();
+    }
+}
+
+async fn serve(
+    mut stream: TcpStream,
+    tokens: &Mutex<HashMap<String, String>>,
+) -> std::io::Result<()> {
+    let mut head = Vec::with_capacity(1024);
+    let mut buf = [0u8; 1024];
+    while !head.windows(4).any(|w| w == b"\r\n\r\n") {
+        if head.len() > MAX_REQUEST_HEAD {
+            return Ok(());
+        }
+        let n = tokio::time::timeout(std::time::Duration::from_secs(10), stream.read(&mut buf))
+            .await
+            .map_err(|_| std::io::Error::from(std::io::ErrorKind::TimedOut))??;
+        if n == 0 {
+            return Ok(());
+        }
+        head.extend_from_slice(&buf[..n]);
+    }
+    let body = response_body(&head, tokens);
+    let reply = match &body {
+        Some(body) => format!(
+            "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{body}",
+            body.len()
+        ),
+        None => "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n".into(),
+    };
+    stream.write_all(reply.as_bytes()).await?;
+    stream.shutdown().await
+}
+
+fn response_body(head: &[u8], tokens: &Mutex<HashMap<String, String>>) -> Option<String> {
+    let line = head.split(|&b| b == b'\r').next()?;
+    let line = std::str::from_utf8(line).ok()?;
+    let mut parts = line.split(' ');
+    if parts.next()? != "GET" {
+        return None;
+    }
+    let token = parts.next()?.strip_prefix(CHALLENGE_PREFIX)?;
+    tokens.lock().get(token).cloned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn serves_only_published_tokens() {
+        let tokens = Mutex::new(HashMap::from([(
+            "abc".to_string(),
+            "abc.thumb".to_string(),
+        )]));
+        let get =
+            |line: &str| response_body(format!("{line}\r\nHost: x\r\n\r\n").as_bytes(), &tokens);
+        assert_eq!(
+            get("GET /.well-known/acme-challenge/abc HTTP/1.1").as_deref(),
+            Some("abc.thumb")
+        );
+        assert_eq!(get("GET /.well-known/acme-challenge/other HTTP/1.1"), None);
+        assert_eq!(get("POST /.well-known/acme-challenge/abc HTTP/1.1"), None);
+        assert_eq!(get("GET /abc HTTP/1.1"), None);
+    }
+}
@@ -0,0 +1,390 @@
+//! Client-facing TLS certificate from an ACME CA (`[acme]`).
+//!
+//! A background task orders a certificate for `acme.domains` over HTTP-01
+//! whenever `general.tls_certificate` is missing, expires within
+//! `acme.renew_before` or does not cover every domain. The new key and
+//! certificate are written to `general.tls_private_key` /
+//! `general.tls_certificate` and picked up by the same path as a config
+//! reload, so new client connections use them immediately and existing
+//! ones keep the certificate they started with.
+
+pub mod client;
+pub mod http01;
+
+use std::io::Write;
+use std::path::Path;
+use std::time::Duration;
+
+use log::{error, info};
+use openssl::asn1::Asn1Time;
+use openssl::hash::MessageDigest;
+use openssl::pkey::PKey;
+use openssl::x509::extension::SubjectAlternativeName;
+use openssl::x509::{X509NameBuilder, X509ReqBuilder, X509};
+
+use crate::config::{get_config, Acme, Config};
+
+use self::client::{new_p256_key, AccountKey, AcmeClient};
+use self::http01::Responder;
+
+/// How often the certificate is checked for renewal.
+const CHECK_INTERVAL: Duration = Duration::from_secs(12 * 3600);
+/// Delay before retrying a failed order.
+const RETRY_INTERVAL: Duration = Duration::from_secs(3600);
+/// Polling interval while the CA validates or issues.
+const POLL_INTERVAL: Duration = Duration::from_secs(2);
+/// Give up on an order the CA has not completed in this many polls.
+const MAX_POLLS: usize = 90;
+
+/// Spawn the renewal task when `[acme]` is configured.
+pub async fn start() {
+    if get_config().acme.is_empty() {
+        return;
+    }
+    tokio::spawn(async {
+        loop {
+            let config = get_config();
+            if config.acme.is_empty() {
+                // Removed by a reload; check again later in case it returns.
+                tokio::time::sleep(CHECK_INTERVAL).await;
+                continue;
+            }
+            let next = match renew_if_needed(&config).await {
+                Ok(()) => CHECK_INTERVAL,
+                Err(err) => {
+                    error!("ACME: certificate order failed: {err}");
+                    crate::admin::events::push_event(
+                        "ACME",
+                        format!("certificate order failed: {err}"),
+                    );
+                    RETRY_INTERVAL
+                }
+            };
+            tokio::time::sleep(next).await;
+        }
+    });
+}
+
+async fn renew_if_needed(config: &Config) -> Result<(), String> {
+    let (Some(cert_path), Some(key_path)) = (
+        config.general.tls_certificate.as_deref(),
+        config.general.tls_private_key.as_deref(),
+    ) else {
+        return Err("tls_certificate and tls_private_key must be set".into());
+    };
+    let Some(reason) = renewal_reason(cert_path, &config.acme)? else {
+        return Ok(());
+    };
+    info!(
+        "ACME: ordering a certificate for {} ({reason})",
+        config.acme.domains.join(", ")
+    );
+    let (key_pem, chain_pem) = order(&config.acme).await?;
+    install(cert_path, chain_pem.as_bytes(), key_path, &key_pem)?;
+    crate::app::tls::reload_client_acceptor(&get_config())
+        .map_err(|e| format!("loading the issued certificate: {e}"))?;
+    info!("ACME: installed a new certificate in {cert_path}");
+    crate::admin::events::push_event(
+        "ACME",
+        format!(
+            "certificate for {} installed ({reason})",
+            config.acme.domains.join(", ")
+        ),
+    );
+    Ok(())
+}
+
+/// Why the certificate at `path` has to be (re)issued, if it has to.
+fn renewal_reason(path: &str, acme: &Acme) -> Result<Option<String>, String> {
+    let pem = match std::fs::read(path) {
+        Ok(pem) => pem,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            return Ok(Some("no certificate yet".into()))
+        }
+        Err(err) => return Err(format!("reading {path}: {err}")),
+    };
+    let cert = X509::from_pem(&pem).map_err(|e| format!("parsing {path}: {e}"))?;
+    let names: Vec<String> = cert
+        .subject_alt_names()
+        .map(|sans| {
+            sans.iter()
+                .filter_map(|name| name.dnsname().map(str::to_ascii_lowercase))
+                .collect()
+        })
+        .unwrap_or_default();
+    if let Some(missing) = acme
+        .domains
+        .iter()
+        .find(|d| !names.contains(&d.to_ascii_lowercase()))
+    {
+        return Ok(Some(format!("{missing} is not covered")));
+    }
+    let now = Asn1Time::days_from_now(0).map_err(|e| format!("{e}"))?;
+    let left = now
+        .diff(cert.not_after())
+        .map_err(|e| format!("{path}: {e}"))?;
+    let left_secs = i64::from(left.days) * 86400 + i64::from(left.secs);
+    if left_secs < (acme.renew_before.as_millis() / 1000) as i64 {
+        return Ok(Some(format!("expires in {} days", left_secs / 86400)));
+    }
+    Ok(None)
+}
+
+/// Run one order to completion. Returns the PKCS#8 key and the PEM chain.
+async fn order(acme: &Acme) -> Result<(Vec<u8>, String), String> {
+    let account_key = AccountKey::load_or_create(&acme.account_key)?;
+    let mut client = AcmeClient::new(acme, account_key).await?;
+    client.register(&acme.contact).await?;
+    let (order_url, mut order) = client.new_order(&acme.domains).await?;
+
+    if order.status == "pending" {
+        let responder = Responder::bind(&acme.http_listen).await?;
+        for authz_url in &order.authorizations {
+            let authz = client.authorization(authz_url).await?;
+            if authz.status == "valid" {
+                continue;
+            }
+            let challenge = authz
+                .challenges
+                .iter()
+                .find(|c| c.kind == "http-01")
+                .ok_or_else(|| {
+                    format!(
+                        "{}: the CA offers no http-01 challenge",
+                        authz.identifier.value
+                    )
+                })?;
+            responder.publish(&challenge.token, client.key_authorization(&challenge.token));
+            client.respond(&challenge.url).await?;
+            poll(|| client.authorization(authz_url), |a| &a.status).await?;
+        }
+        drop(responder);
+        order = client.order(&order_url).await?;
+    }
+
+    let cert_key = PKey::from_ec_key(new_p256_key()?).map_err(|e| format!("{e}"))?;
+    if order.status == "ready" {
+        let csr = csr(&acme.domains, &cert_key)?;
+        client.finalize(&order.finalize, &csr).await?;
+    } else if order.status != "processing" && order.status != "valid" {
+        return Err(format!("order is {}", order.status));
+    }
+    let order = poll(|| client.order(&order_url), |o| &o.status).await?;
+    let certificate_url = order
+        .certificate
+        .ok_or("valid order has no certificate url")?;
+    let chain = client.certificate(&certificate_url).await?;
+    X509::stack_from_pem(chain.as_bytes())
+        .map_err(|e| format!("CA returned an unreadable certificate: {e}"))?;
+    let key_pem = cert_key
+        .private_key_to_pem_pkcs8()
+        .map_err(|e| format!("{e}"))?;
+    Ok((key_pem, chain))
+}
+
+/// Re-fetch an authorization or order until it is `valid`.
+async fn poll<T, F, Fut>(fetch: F, status: impl Fn(&T) -> &String) -> Result<T, String>
+where
+    F: Fn() -> Fut,
+    Fut: std::future::Future<Output = Result<T, String>>,
+{
+    for _ in 0..MAX_POLLS {
+        let item = fetch().await?;
+        match status(&item).as_str() {
+            "valid" => return Ok(item),
+            "pending" | "processing" | "ready" => tokio::time::sleep(POLL_INTERVAL).await,
+            other => return Err(format!("status is {other}")),
+        }
+    }
+    Err("timed out waiting for the CA".into())
+}
+
+fn csr(domains: &[String], key: &PKey<openssl::pkey::Private>) -> Result<Vec<u8>, String> {
+    let err = |e: openssl::error::ErrorStack| format!("building CSR: {e}");
+    let mut name = X509NameBuilder::new().map_err(err)?;
+    name.append_entry_by_text("CN", &domains[0]).map_err(err)?;
+    let mut req = X509ReqBuilder::new().map_err(err)?;
+    req.set_subject_name(&name.build()).map_err(err)?;
+    req.set_pubkey(key).map_err(err)?;
+    let mut san = SubjectAlternativeName::new();
+    for domain in domains {
+        san.dns(domain);
+    }
+    let san = san.build(&req.x509v3_context(None)).map_err(err)?;
+    let mut extensions = openssl::stack::Stack::new().map_err(err)?;
+    extensions.push(san).map_err(err)?;
+    req.add_extensions(&extensions).map_err(err)?;
+    req.sign(key, MessageDigest::sha256()).map_err(err)?;
+    req.build().to_der().map_err(err)
+}
+
+/// Replace the certificate and the key. Both are written next to their
+/// targets and checked to be a pair before either is renamed into place,
+/// so a failed write or a mismatched pair leaves the installed ones alone.
+fn install(
+    cert_path: &str,
+    chain_pem: &[u8],
+    key_path: &str,
+    key_pem: &[u8],
+) -> Result<(), String> {
+    let (cert_tmp, key_tmp) = match stage_pair(cert_path, chain_pem, key_path, key_pem) {
+        Ok(staged) => staged,
+        Err(err) => {
+            let _ = std::fs::remove_file(format!("{key_path}.tmp"));
+            let _ = std::fs::remove_file(format!("{cert_path}.tmp"));
+            return Err(err);
+        }
+    };
+    std::fs::rename(&key_tmp, key_path).map_err(|e| format!("installing {key_path}: {e}"))?;
+    std::fs::rename(&cert_tmp, cert_path).map_err(|e| format!("installing {cert_path}: {e}"))
+}
+
+/// Stage the certificate and the key and check they are a pair. Returns
+/// the staged paths.
+fn stage_pair(
+    cert_path: &str,
+    chain_pem: &[u8],
+    key_path: &str,
+    key_pem: &[u8],
+) -> Result<(String, String), String> {
+    let key_tmp =
+        stage(key_path, key_pem, 0o600).map_err(|e| format!("writing {key_path}: {e}"))?;
+    let cert_tmp =
+        stage(cert_path, chain_pem, 0o644).map_err(|e| format!("writing {cert_path}: {e}"))?;
+    check_pair(&cert_tmp, &key_tmp)?;
+    Ok((cert_tmp, key_tmp))
+}
+
+/// Whether the first certificate in `cert_path` is for the key in
+/// `key_path`.
+fn check_pair(cert_path: &str, key_path: &str) -> Result<(), String> {
+    let cert = std::fs::read(cert_path).map_err(|e| format!("reading {cert_path}: {e}"))?;
+    let cert = X509::from_pem(&cert).map_err(|e| format!("parsing {cert_path}: {e}"))?;
+    let key = std::fs::read(key_path).map_err(|e| format!("reading {key_path}: {e}"))?;
+    let key = PKey::private_key_from_pem(&key).map_err(|e| format!("parsing {key_path}: {e}"))?;
+    let public = cert.public_key().map_err(|e| format!("{cert_path}: {e}"))?;
+    if !public.public_eq(&key) {
+        return Err("the issued certificate does not match its key".into());
+    }
+    Ok(())
+}
+
+/// Write a key file readable by the owner only.
+pub(crate) fn write_private(path: &str, data: &[u8]) -> std::io::Result<()> {
+    let tmp = stage(path, data, 0o600)?;
+    std::fs::rename(&tmp, Path::new(path))
+}
+
+/// Write `data` to `<path>.tmp` and flush it, ready to be renamed over
+/// `path` so readers never see a partial file.
+fn stage(path: &str, data: &[u8], mode: u32) -> std::io::Result<String> {
+    let tmp = format!("{path}.tmp");
+    let mut options = std::fs::OpenOptions::new();
+    options.write(true).create(true).truncate(true);
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::OpenOptionsExt;
+        options.mode(mode);
+    }
+    #[cfg(not(unix))]
+    let _ = mode;
+    let mut file = options.open(&tmp)?;
+    file.write_all(data)?;
+    file.sync_all()?;
+    Ok(tmp)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use openssl::x509::X509Builder;
+
+    fn self_signed(domains: &[&str], days: u32) -> Vec<u8> {
+        let key = PKey::from_ec_key(new_p256_key().unwrap()).unwrap();
+        self_signed_with(&key, domains, days)
+    }
+
+    fn self_signed_with(
+        key: &PKey<openssl::pkey::Private>,
+        domains: &[&str],
+        days: u32,
+    ) -> Vec<u8> {
+        let mut builder = X509Builder::new().unwrap();
+        builder.set_version(2).unwrap();
+        builder.set_pubkey(key).unwrap();
+        builder
+            .set_not_before(&Asn1Time::days_from_now(0).unwrap())
+            .unwrap();
+        builder
+            .set_not_after(&Asn1Time::days_from_now(days).unwrap())
+            .unwrap();
+        let mut san = SubjectAlternativeName::new();
+        for domain in domains {
+            san.dns(domain);
+        }
+        let san = san.build(&builder.x509v3_context(None, None)).unwrap();
+        builder.append_extension(san).unwrap();
+        builder.sign(key, MessageDigest::sha256()).unwrap();
+        builder.build().to_pem().unwrap()
+    }
+
+    #[test]
+    fn renewal_reasons() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("cert.pem");
+        let path = path.to_str().unwrap();
+        let acme = Acme {
+            domains: vec!["db.example.com".into(), "pg.example.com".into()],
+            ..Acme::empty()
+        };
+
+        assert_eq!(
+            renewal_reason(path, &acme).unwrap().as_deref(),
+            Some("no certificate yet")
+        );
+
+        std::fs::write(path, self_signed(&["db.example.com", "pg.example.com"], 80)).unwrap();
+        assert_eq!(renewal_reason(path, &acme).unwrap(), None);
+
+        std::fs::write(path, self_signed(&["db.example.com", "pg.example.com"], 10)).unwrap();
+        assert!(renewal_reason(path, &acme)
+            .unwrap()
+            .unwrap()
+            .starts_with("expires in"));
+
+        std::fs::write(path, self_signed(&["db.example.com"], 80)).unwrap();
+        assert_eq!(
+            renewal_reason(path, &acme).unwrap().as_deref(),
+            Some("pg.example.com is not covered")
+        );
+    }
+
+    #[test]
+    fn install_refuses_a_mismatched_pair() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        let cert_path = cert_path.to_str().unwrap();
+        let key_path = dir.path().join("key.pem");
+        let key_path = key_path.to_str().unwrap();
+        let key = PKey::from_ec_key(new_p256_key().unwrap()).unwrap();
+        let key_pem = key.private_key_to_pem_pkcs8().unwrap();
+        let cert = self_signed_with(&key, &["db.example.com"], 80);
+        install(cert_path, &cert, key_path, &key_pem).unwrap();
+
+        let other = self_signed(&["db.example.com"], 80);
+        let err = install(cert_path, &other, key_path, &key_pem).unwrap_err();
+        assert!(err.contains("does not match"), "{err}");
+        // The installed pair is untouched and nothing is left behind.
+        assert_eq!(std::fs::read(cert_path).unwrap(), cert);
+        assert!(!Path::new(&format!("{cert_path}.tmp")).exists());
+        assert!(!Path::new(&format!("{key_path}.tmp")).exists());
+    }
+
+    #[test]
+    fn csr_carries_all_domains() {
+        let key = PKey::from_ec_key(new_p256_key().unwrap()).unwrap();
+        let der = csr(&["a.example.com".into(), "b.example.com".into()], &key).unwrap();
+        let req = openssl::x509::X509Req::from_der(&der).unwrap();
+        assert!(req.verify(&key).unwrap());
+    }
+}
@@ -1,17 +1,26 @@
-//! Admin commands implementation (reload, shutdown, pause, resume, reconnect).
+//! Admin commands implementation (reload, shutdown, pause, resume, hold, reconnect,
+//! CREATE/ALTER/DROP POOL, WEIGHT, DISABLE/ENABLE HOST, DUMP STATE, TRACE CLIENT,
+//! UNBAN, DENY/ALLOW/REMOVE ADDRESS).
 
 use bytes::{BufMut, BytesMut};
 use log::{error, info};
 use nix::sys::signal::{self, Signal};
 use nix::unistd::Pid;
 
-use crate::admin::operations::{pause_now, reconnect_now, resume_now, AdminEffect, AdminScope};
-use crate::config::{get_config, reload_config};
+use crate::admin::operations::{
+    hold_now, pause_now, reconnect_now, resume_now, wait_drained, AdminEffect, AdminScope,
+};
+use crate::app::server::{request_shutdown, ShutdownMode};
+use crate::auth::access_list::{self, List};
+use crate::auth::ban;
+use crate::config::{get_config, host_spec_matches, managed_pools, reload_config, reload_hba};
 use crate::errors::Error;
-use crate::messages::protocol::{command_complete, data_row, row_description};
+use crate::messages::protocol::{command_complete, data_row, error_response, row_description};
 use crate::messages::socket::write_all_half;
 use crate::messages::types::DataType;
-use crate::pool::ClientServerMap;
+use crate::pool::{get_all_pools, multi_host, ClientServerMap};
+use crate::stats::client::{CLIENT_TRACE_OFF, CLIENT_TRACE_ON, CLIENT_TRACE_PAYLOAD};
+use crate::stats::get_client_stats;
 
 /// Reload the configuration file without restarting the process.
 pub async fn reload<T>(stream: &mut T, client_server_map: ClientServerMap) -> Result<(), Error>
@@ -53,6 +62,41 @@ where
     write_all_half(stream, &res).await
 }
 
+/// Reload only the pg_hba file. A file that does not load is reported
+/// and the rules in use are kept.
+pub async fn reload_hba_rules<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    info!("Reloading HBA rules");
+
+    match reload_hba().await {
+        Ok(rules) => {
+            info!("HBA rules reloaded: {rules} rules");
+            crate::admin::events::push_event("RELOAD", format!("pg_hba reloaded: {rules} rules"));
+        }
+        Err(err) => {
+            crate::admin::events::push_event_rate_limited(
+                "CONFIG_VALIDATION_ERROR",
+                format!("admin RELOAD HBA rejected: {err}"),
+            );
+            error!("RELOAD HBA rejected: {err}");
+            return error_response(stream, &err.to_string(), "58000").await;
+        }
+    }
+
+    let mut res = BytesMut::new();
+
+    res.put(command_complete("RELOAD"));
+
+    // ReadyForQuery
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+
+    write_all_half(stream, &res).await
+}
+
 /// Send response packets for shutdown.
 pub async fn shutdown<T>(stream: &mut T) -> Result<(), Error>
 where
@@ -81,6 +125,33 @@ where
     write_all_half(stream, &res).await
 }
 
+/// `SHUTDOWN SMART|FAST|IMMEDIATE`: hand the shutdown to the accept loop.
+/// After `IMMEDIATE` the reply may not reach the client before exit.
+pub async fn shutdown_with_mode<T>(stream: &mut T, mode: ShutdownMode) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let mut res = BytesMut::new();
+    res.put(row_description(&vec![("success", DataType::Text)]));
+
+    let mode_name = format!("{mode:?}").to_ascii_uppercase();
+    let shutdown_success = if request_shutdown(mode) {
+        crate::admin::events::push_event("SHUTDOWN", mode_name);
+        "t"
+    } else {
+        error!("Unable to request SHUTDOWN {mode_name}: accept loop is not running");
+        "f"
+    };
+    res.put(data_row(&[shutdown_success.to_string()]));
+    res.put(command_complete("SHUTDOWN"));
+
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+
+    write_all_half(stream, &res).await
+}
+
 /// Trigger binary upgrade via SIGUSR2 (graceful shutdown + spawn new process).
 #[cfg(not(windows))]
 pub async fn upgrade<T>(stream: &mut T) -> Result<(), Error>
@@ -111,6 +182,189 @@ where
     write_all_half(stream, &res).await
 }
 
+/// Write a full internal state dump to `general.state_dump_dir` and return
+/// the file path.
+pub async fn dump_state<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    info!("DUMP STATE command: writing state dump");
+    let result = tokio::task::spawn_blocking(crate::admin::dump::write_state_dump)
+        .await
+        .unwrap_or_else(|err| Err(format!("state dump task failed: {err}")));
+    let path = match result {
+        Ok(path) => path,
+        Err(err) => {
+            error!("{err}");
+            return admin_error_response(stream, &err, "58000").await;
+        }
+    };
+
+    let mut res = BytesMut::new();
+    res.put(row_description(&vec![("path", DataType::Text)]));
+    res.put(data_row(&[path.display().to_string()]));
+    res.put(command_complete("DUMP STATE"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+
+    write_all_half(stream, &res).await
+}
+
+/// Client id as shown by SHOW CLIENTS (`#c12`); the bare number works too.
+fn parse_client_id(id: &str) -> Option<u64> {
+    let id = id.strip_prefix('#').unwrap_or(id);
+    let id = id
+        .strip_prefix('c')
+        .or_else(|| id.strip_prefix('C'))
+        .unwrap_or(id);
+    id.parse().ok()
+}
+
+/// `ON`, `ON PAYLOAD` or `OFF` as a `CLIENT_TRACE_*` level.
+fn parse_trace_level(args: &[&str]) -> Option<u8> {
+    match args {
+        [state] if state.eq_ignore_ascii_case("ON") => Some(CLIENT_TRACE_ON),
+        [state, payload]
+            if state.eq_ignore_ascii_case("ON") && payload.eq_ignore_ascii_case("PAYLOAD") =>
+        {
+            Some(CLIENT_TRACE_PAYLOAD)
+        }
+        [state] if state.eq_ignore_ascii_case("OFF") => Some(CLIENT_TRACE_OFF),
+        _ => None,
+    }
+}
+
+/// `TRACE CLIENT <id> ON [PAYLOAD] | OFF`: log every protocol message of
+/// one client connection at info level. The trace ends with the
+/// connection.
+pub async fn trace_client<T>(stream: &mut T, id: &str, args: &[&str]) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let Some(level) = parse_trace_level(args) else {
+        return admin_error_response(
+            stream,
+            "TRACE requires: TRACE CLIENT <id> ON [PAYLOAD] | OFF",
+            "42601",
+        )
+        .await;
+    };
+    let Some(connection_id) = parse_client_id(id) else {
+        return admin_error_response(
+            stream,
+            &format!("invalid client id '{id}': expected #c<N> as in SHOW CLIENTS"),
+            "22023",
+        )
+        .await;
+    };
+    let Some(client) = get_client_stats().remove(&connection_id) else {
+        return admin_error_response(
+            stream,
+            &format!("client #c{connection_id} not found"),
+            "42704",
+        )
+        .await;
+    };
+
+    client.set_trace(level);
+    let shown = match level {
+        CLIENT_TRACE_OFF => "off",
+        CLIENT_TRACE_ON => "on",
+        _ => "on (payload)",
+    };
+    info!(
+        "[{}@{} #c{connection_id}] protocol trace {shown}",
+        client.username(),
+        client.pool_name()
+    );
+
+    let mut res = BytesMut::new();
+    res.put(row_description(&vec![
+        ("client_id", DataType::Text),
+        ("trace", DataType::Text),
+    ]));
+    res.put(data_row(&[format!("#c{connection_id}"), shown.to_string()]));
+    res.put(command_complete("TRACE"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// `UNBAN <ip>`: lift the ban of a client address and forget its
+/// authentication failures.
+pub async fn unban<T>(stream: &mut T, addr: &str) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let Ok(ip) = addr.parse::<std::net::IpAddr>() else {
+        return admin_error_response(
+            stream,
+            &format!("invalid address '{addr}': expected an IPv4 or IPv6 address"),
+            "22023",
+        )
+        .await;
+    };
+    if !ban::unban(ip) {
+        return admin_error_response(stream, &format!("address {ip} is not banned"), "42704").await;
+    }
+    info!("client address {ip} unbanned by admin");
+    crate::admin::events::push_event("UNBAN", format!("UNBAN {ip}"));
+
+    let mut res = BytesMut::new();
+    res.put(command_complete("UNBAN"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// `DENY ADDRESS` / `ALLOW ADDRESS <cidr>`: add an entry to the runtime
+/// address deny or allow list (`list`), or with `None` remove the entry
+/// from both (`REMOVE ADDRESS`). Takes effect for the next connection.
+pub async fn edit_access_list<T>(
+    stream: &mut T,
+    list: Option<List>,
+    cidr: &str,
+) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let Some(net) = access_list::parse_net(cidr) else {
+        return admin_error_response(
+            stream,
+            &format!("invalid address '{cidr}': expected a CIDR or an IP address"),
+            "22023",
+        )
+        .await;
+    };
+    let (command, changed) = match list {
+        Some(List::Deny) => ("DENY ADDRESS", access_list::add(List::Deny, net)),
+        Some(List::Allow) => ("ALLOW ADDRESS", access_list::add(List::Allow, net)),
+        None => ("REMOVE ADDRESS", access_list::remove(net)),
+    };
+    if !changed {
+        let (message, code) = match list {
+            Some(list) => (
+                format!("{net} is already in the {} list", list.name()),
+                "42710",
+            ),
+            None => (format!("{net} is in neither address list"), "42704"),
+        };
+        return admin_error_response(stream, &message, code).await;
+    }
+    info!("{command} {net}");
+    crate::admin::events::push_event("ACCESS", format!("{command} {net}"));
+
+    let mut res = BytesMut::new();
+    res.put(command_complete(command));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
 /// Send an ERROR-severity response (non-fatal — keeps the admin session open).
 async fn admin_error_response<T>(stream: &mut T, message: &str, code: &str) -> Result<(), Error>
 where
@@ -199,6 +453,29 @@ where
     render_effect(stream, "RESUME", resume_now(db_scope(db))).await
 }
 
+/// Hold connection pools for a backend switchover — new transactions
+/// queue (up to `hold_timeout`) while in-flight ones finish. Replies once
+/// the held pools have no server checked out, so the switchover can start.
+/// If `db` is Some, only pools for that database are held.
+pub async fn hold<T>(stream: &mut T, db: Option<String>) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let timeout = get_config().general.hold_timeout.as_std();
+    let effect = hold_now(db_scope(db), timeout);
+    if let AdminEffect::Applied { affected } = &effect {
+        if !wait_drained(affected, timeout).await {
+            return admin_error_response(
+                stream,
+                "in-flight transactions did not finish while the pools were held",
+                "55000",
+            )
+            .await;
+        }
+    }
+    render_effect(stream, "HOLD", effect).await
+}
+
 /// Reconnect connection pools — bumps epoch and drains idle connections.
 /// Active connections are rejected when returned to the pool.
 /// If `db` is Some, only pools for that database are reconnected.
@@ -208,3 +485,193 @@ where
 {
     render_effect(stream, "RECONNECT", reconnect_now(db_scope(db))).await
 }
+
+/// Create, alter or drop a pool managed from the admin console. Errors
+/// (bad JSON, unknown pool, failed validation) go back to the client as
+/// an ErrorResponse; the session stays open.
+pub async fn manage_pool<T>(
+    stream: &mut T,
+    command: &'static str,
+    name: &str,
+    definition: Option<&str>,
+) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let result = match (command, definition) {
+        ("CREATE POOL", Some(definition)) => managed_pools::create_pool(name, definition).await,
+        ("ALTER POOL", Some(changes)) => managed_pools::alter_pool(name, changes).await,
+        ("DROP POOL", None) => managed_pools::drop_pool(name).await,
+        _ => {
+            let usage = match command {
+                "DROP POOL" => "DROP POOL <name>",
+                _ => "<CREATE|ALTER> POOL <name> '<json>'",
+            };
+            return error_response(stream, &format!("usage: {usage}"), "42601").await;
+        }
+    };
+
+    if let Err(err) = result {
+        error!("{command} {name} failed: {err}");
+        return error_response(stream, &err.to_string(), "58000").await;
+    }
+    crate::admin::events::push_event("POOL", format!("{command} {name}"));
+
+    let mut res = BytesMut::new();
+    res.put(command_complete(command));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Hosts of the `server_host` lists of pool `db` that `spec` names.
+fn matching_hosts(db: &str, spec: &str) -> Vec<(String, u16)> {
+    let mut hosts: Vec<(String, u16)> = Vec::new();
+    for (identifier, pool) in get_all_pools().iter() {
+        if identifier.db != db {
+            continue;
+        }
+        let Some(host_list) = pool.database.host_list() else {
+            continue;
+        };
+        for (host, port) in host_list.static_hosts() {
+            if host_spec_matches(spec, host, *port) && !hosts.contains(&(host.clone(), *port)) {
+                hosts.push((host.clone(), *port));
+            }
+        }
+    }
+    hosts
+}
+
+/// Set the weight of a backend host of `db` for new connects, or go back
+/// to its configured weight with `DEFAULT`. The host must be in the
+/// pool's `server_host` list; a spec without a port matches every port.
+pub async fn set_host_weight<T>(
+    stream: &mut T,
+    db: &str,
+    spec: &str,
+    weight: &str,
+) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let weight = if weight.eq_ignore_ascii_case("DEFAULT") {
+        None
+    } else {
+        match weight.parse::<u16>() {
+            Ok(weight) => Some(weight),
+            Err(_) => {
+                return error_response(
+                    stream,
+                    &format!("invalid weight '{weight}': expected 0-65535 or DEFAULT"),
+                    "22023",
+                )
+                .await
+            }
+        }
+    };
+
+    let hosts = matching_hosts(db, spec);
+    if hosts.is_empty() {
+        return error_response(
+            stream,
+            &format!("pool {db} has no server_host list containing {spec}"),
+            "42704",
+        )
+        .await;
+    }
+
+    let shown = weight.map_or("DEFAULT".to_string(), |weight| weight.to_string());
+    for (host, port) in &hosts {
+        multi_host::set_weight_override(db, host, *port, weight);
+        info!("[pool: {db}] server_host {host}:{port} weight set to {shown}");
+    }
+    crate::admin::events::push_event("WEIGHT", format!("{db} {spec} {shown}"));
+
+    let mut res = BytesMut::new();
+    res.put(command_complete("WEIGHT"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// `DISABLE HOST` / `ENABLE HOST`: take a backend host of the pool out of
+/// rotation or put it back. A disabled host gets no new connections; its
+/// idle ones are closed now and busy ones once their work is done.
+pub async fn set_host_disabled<T>(
+    stream: &mut T,
+    db: &str,
+    spec: &str,
+    disabled: bool,
+) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let hosts = matching_hosts(db, spec);
+    if hosts.is_empty() {
+        return error_response(
+            stream,
+            &format!("pool {db} has no server_host list containing {spec}"),
+            "42704",
+        )
+        .await;
+    }
+
+    let command = if disabled {
+        "DISABLE HOST"
+    } else {
+        "ENABLE HOST"
+    };
+    for (host, port) in &hosts {
+        if !multi_host::set_host_disabled(db, host, *port, disabled) {
+            continue;
+        }
+        if disabled {
+            info!("[pool: {db}] server_host {host}:{port} disabled, draining its connections");
+        } else {
+            info!("[pool: {db}] server_host {host}:{port} enabled");
+        }
+    }
+    if disabled {
+        for (identifier, pool) in get_all_pools().iter() {
+            if identifier.db == db {
+                pool.drain_hosts_out_of_rotation();
+            }
+        }
+    }
+    crate::admin::events::push_event("HOST", format!("{command} {db} {spec}"));
+
+    let mut res = BytesMut::new();
+    res.put(command_complete(command));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn client_id_accepts_show_clients_form() {
+        assert_eq!(parse_client_id("#c12"), Some(12));
+        assert_eq!(parse_client_id("c7"), Some(7));
+        assert_eq!(parse_client_id("42"), Some(42));
+        assert_eq!(parse_client_id("#s3"), None);
+    }
+
+    #[test]
+    fn trace_level_parses_modes() {
+        assert_eq!(parse_trace_level(&["on"]), Some(CLIENT_TRACE_ON));
+        assert_eq!(
+            parse_trace_level(&["ON", "payload"]),
+            Some(CLIENT_TRACE_PAYLOAD)
+        );
+        assert_eq!(parse_trace_level(&["OFF"]), Some(CLIENT_TRACE_OFF));
+        assert_eq!(parse_trace_level(&["OFF", "PAYLOAD"]), None);
+        assert_eq!(parse_trace_level(&[]), None);
+    }
+}
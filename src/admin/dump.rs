@@ -0,0 +1,207 @@
+//! Full internal state dump for post-incident debugging. Written as one
+//! JSON file on `SIGUSR1` or the `DUMP STATE` admin command.
+//!
+//! The sections reuse the Web API collectors, so a dump reads the same
+//! way as `/api/pools`, `/api/clients` and friends, with every row
+//! instead of one page, plus the tokio runtime queues. Client rows carry
+//! query previews and config carries user names, so the file is created
+//! readable by the owner only.
+
+use std::io::Write;
+use std::path::{Path, PathBuf};
+
+use log::{error, info};
+use serde_json::{json, Value};
+
+use crate::config::config_arc;
+use crate::web::routes::collect::{
+    collect_auth_query, collect_clients, collect_config, collect_connections, collect_events,
+    collect_interner, collect_pool_coordinator, collect_pool_scaling, collect_pools,
+    collect_prepared, collect_process, collect_servers, collect_stats, collect_version,
+    now_unix_ms,
+};
+use crate::web::routes::dto::{ClientFilters, ServerFilters};
+
+/// Page size of the client and server collectors (their `MAX_LIMIT`).
+const PAGE: u64 = 1000;
+
+/// Lifecycle events included in the dump, newest last.
+const EVENTS: u64 = 1000;
+
+/// Every client row, one collector page at a time.
+fn all_clients() -> Vec<Value> {
+    let mut rows = Vec::new();
+    loop {
+        let page = collect_clients(&ClientFilters {
+            limit: PAGE,
+            offset: rows.len() as u64,
+            ..Default::default()
+        });
+        let fetched = page.clients.len();
+        rows.extend(page.clients.iter().map(|c| json!(c)));
+        if fetched == 0 || rows.len() as u64 >= page.total {
+            return rows;
+        }
+    }
+}
+
+/// Every server row, one collector page at a time.
+fn all_servers() -> Vec<Value> {
+    let mut rows = Vec::new();
+    loop {
+        let page = collect_servers(&ServerFilters {
+            limit: PAGE,
+            offset: rows.len() as u64,
+            ..Default::default()
+        });
+        let fetched = page.servers.len();
+        rows.extend(page.servers.iter().map(|s| json!(s)));
+        if fetched == 0 || rows.len() as u64 >= page.total {
+            return rows;
+        }
+    }
+}
+
+/// Worker and queue numbers of the tokio runtime the caller runs on.
+fn runtime_state() -> Value {
+    let Ok(handle) = tokio::runtime::Handle::try_current() else {
+        return Value::Null;
+    };
+    let metrics = handle.metrics();
+    let workers: Vec<Value> = (0..metrics.num_workers())
+        .map(|index| {
+            json!({
+                "index": index,
+                "parked": metrics.worker_park_unpark_count(index) % 2 == 1,
+                "park_count": metrics.worker_park_count(index),
+                "busy_total_ms": metrics.worker_total_busy_duration(index).as_millis() as u64,
+            })
+        })
+        .collect();
+    json!({
+        "workers": workers,
+        "alive_tasks": metrics.num_alive_tasks(),
+        "global_queue_depth": metrics.global_queue_depth(),
+    })
+}
+
+/// The whole dump as one JSON document.
+pub fn state_dump() -> Value {
+    #[cfg(target_os = "linux")]
+    let sockets = crate::web::routes::collect::collect_sockets()
+        .map(|s| json!(s))
+        .unwrap_or(Value::Null);
+    #[cfg(not(target_os = "linux"))]
+    let sockets = Value::Null;
+
+    json!({
+        "ts": now_unix_ms(),
+        "version": collect_version(),
+        "process": collect_process(),
+        "runtime": runtime_state(),
+        "config": collect_config(false),
+        "pools": collect_pools(false),
+        "pool_coordinator": collect_pool_coordinator(),
+        "pool_scaling": collect_pool_scaling(),
+        "auth_query": collect_auth_query(),
+        "clients": all_clients(),
+        "servers": all_servers(),
+        "connections": collect_connections(),
+        "stats": collect_stats(),
+        "prepared": collect_prepared(),
+        "interner": collect_interner(),
+        "sockets": sockets,
+        "events": collect_events(0, EVENTS),
+    })
+}
+
+fn dump_path(dir: &Path) -> PathBuf {
+    dir.join(format!(
+        "pg_doorman-state-{}-{}.json",
+        std::process::id(),
+        chrono::Local::now().format("%Y%m%dT%H%M%S%.3f")
+    ))
+}
+
+/// Writes `state_dump()` into `general.state_dump_dir` and returns the
+/// file path.
+pub fn write_state_dump() -> Result<PathBuf, String> {
+    let dir = PathBuf::from(&config_arc().general.state_dump_dir);
+    let path = dump_path(&dir);
+    let body = serde_json::to_vec_pretty(&state_dump())
+        .map_err(|err| format!("failed to serialize state dump: {err}"))?;
+
+    let mut options = std::fs::OpenOptions::new();
+    options.write(true).create_new(true);
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::OpenOptionsExt;
+        options.mode(0o600);
+    }
+    options
+        .open(&path)
+        .and_then(|mut file| file.write_all(&body))
+        .map_err(|err| format!("failed to write state dump {}: {err}", path.display()))?;
+
+    info!(
+        "State dump written to {} ({} bytes)",
+        path.display(),
+        body.len()
+    );
+    crate::admin::events::push_event(
+        "STATE_DUMP",
+        format!("state dump written to {}", path.display()),
+    );
+    Ok(path)
+}
+
+/// Writes a state dump on every `SIGUSR1`.
+#[cfg(unix)]
+pub fn spawn_dump_signal_handler() {
+    use tokio::signal::unix::{signal, SignalKind};
+
+    let mut usr1 = match signal(SignalKind::user_defined1()) {
+        Ok(usr1) => usr1,
+        Err(err) => {
+            error!("Failed to install the SIGUSR1 state dump handler: {err}");
+            return;
+        }
+    };
+    tokio::task::spawn(async move {
+        while usr1.recv().await.is_some() {
+            info!("Got SIGUSR1, writing state dump");
+            // Collecting walks every client and server; keep it off the
+            // runtime workers.
+            match tokio::task::spawn_blocking(write_state_dump).await {
+                Ok(Ok(_)) => {}
+                Ok(Err(err)) => error!("{err}"),
+                Err(err) => error!("State dump task failed: {err}"),
+            }
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn dump_has_every_section() {
+        let dump = state_dump();
+        for section in [
+            "version", "process", "runtime", "config", "pools", "clients", "servers", "prepared",
+            "events",
+        ] {
+            assert!(dump.get(section).is_some(), "missing section {section}");
+        }
+    }
+
+    #[test]
+    fn dump_file_name_carries_pid() {
+        let path = dump_path(Path::new("/var/tmp"));
+        let name = path.file_name().unwrap().to_string_lossy().into_owned();
+        assert!(name.starts_with(&format!("pg_doorman-state-{}-", std::process::id())));
+        assert!(name.ends_with(".json"));
+        assert_eq!(path.parent(), Some(Path::new("/var/tmp")));
+    }
+}
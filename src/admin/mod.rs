@@ -6,6 +6,7 @@
 mod commands;
 mod show;
 
+pub mod dump;
 pub mod events;
 pub mod operations;
 
@@ -13,6 +14,8 @@ use bytes::{Buf, BufMut, BytesMut};
 use log::{debug, warn};
 
 use crate::app::log_level;
+use crate::app::server::ShutdownMode;
+use crate::auth::access_list::List;
 use crate::errors::Error;
 use crate::messages::protocol::{command_complete, data_row, error_response, row_description};
 use crate::messages::types::DataType;
@@ -33,8 +36,11 @@ pub(crate) const SHOW_SUBCOMMANDS: &[&str] = &[
     "pool_coordinator",
     "pool_scaling",
     "prepared_statements",
+    "prepared_transactions",
     "interner",
+    "buffer_pool",
     "clients",
+    "active_queries",
     "servers",
     "connections",
     "stats",
@@ -43,22 +49,30 @@ pub(crate) const SHOW_SUBCOMMANDS: &[&str] = &[
     "auth_query",
     "startup_parameters",
     "log_level",
+    "features",
     "lists",
+    "host_weights",
+    "bans",
+    "access_list",
     #[cfg(target_os = "linux")]
     "sockets",
 ];
 
 #[cfg(not(windows))]
 use commands::upgrade;
-use commands::{pause, reconnect, reload, resume, shutdown};
+use commands::{
+    dump_state, edit_access_list, hold, manage_pool, pause, reconnect, reload, reload_hba_rules,
+    resume, set_host_disabled, set_host_weight, shutdown, shutdown_with_mode, trace_client, unban,
+};
 #[cfg(target_os = "linux")]
 use show::show_sockets;
 use show::{
-    reset_interner, show_auth_query, show_clients, show_config, show_connections, show_databases,
-    show_help, show_interner, show_interner_top, show_lists, show_log_level, show_pool_coordinator,
-    show_pool_scaling, show_pools, show_pools_extended, show_pools_memory,
-    show_prepared_statements, show_servers, show_startup_parameters, show_stats, show_users,
-    show_version,
+    reset_interner, show_access_list, show_active_queries, show_auth_query, show_bans,
+    show_buffer_pool, show_clients, show_config, show_connections, show_databases, show_features,
+    show_help, show_host_weights, show_interner, show_interner_top, show_lists, show_log_level,
+    show_pool_coordinator, show_pool_scaling, show_pools, show_pools_extended, show_pools_memory,
+    show_prepared_statements, show_prepared_transactions, show_servers, show_startup_parameters,
+    show_stats, show_users, show_version,
 };
 
 /// Handle admin client.
@@ -66,6 +80,7 @@ pub async fn handle_admin<T>(
     stream: &mut T,
     mut query: BytesMut,
     client_server_map: ClientServerMap,
+    read_only: bool,
 ) -> Result<(), Error>
 where
     T: tokio::io::AsyncWrite + std::marker::Unpin,
@@ -90,10 +105,49 @@ where
 
     let query_parts: Vec<&str> = query.trim_end_matches(';').split_whitespace().collect();
 
+    // `stats_users` may look but not touch.
+    if read_only && !query_parts[0].eq_ignore_ascii_case("SHOW") {
+        warn!(
+            "stats user tried admin command: {}",
+            query_parts[0].to_ascii_uppercase()
+        );
+        return error_response(
+            stream,
+            "permission denied: stats users may only run SHOW commands",
+            "42501",
+        )
+        .await;
+    }
+
     match query_parts[0].to_ascii_uppercase().as_str() {
         "SET" => set_command(stream, &query_parts).await,
-        "RELOAD" => reload(stream, client_server_map).await,
-        "SHUTDOWN" => shutdown(stream).await,
+        "RELOAD" => match query_parts
+            .get(1)
+            .map(|s| s.to_ascii_uppercase())
+            .as_deref()
+        {
+            None => reload(stream, client_server_map).await,
+            Some("HBA") => reload_hba_rules(stream).await,
+            Some(_) => error_response(stream, "RELOAD requires: RELOAD [HBA]", "42601").await,
+        },
+        "SHUTDOWN" => match query_parts
+            .get(1)
+            .map(|s| s.to_ascii_uppercase())
+            .as_deref()
+        {
+            None => shutdown(stream).await,
+            Some("SMART") => shutdown_with_mode(stream, ShutdownMode::Smart).await,
+            Some("FAST") => shutdown_with_mode(stream, ShutdownMode::Fast).await,
+            Some("IMMEDIATE") => shutdown_with_mode(stream, ShutdownMode::Immediate).await,
+            Some(_) => {
+                error_response(
+                    stream,
+                    "SHUTDOWN requires: SHUTDOWN [SMART|FAST|IMMEDIATE]",
+                    "42601",
+                )
+                .await
+            }
+        },
         #[cfg(not(windows))]
         "UPGRADE" => upgrade(stream).await,
         "PAUSE" => {
@@ -104,10 +158,105 @@ where
             let db = query_parts.get(1).map(|s| s.to_string());
             resume(stream, db).await
         }
+        "HOLD" => {
+            let db = query_parts.get(1).map(|s| s.to_string());
+            hold(stream, db).await
+        }
         "RECONNECT" => {
             let db = query_parts.get(1).map(|s| s.to_string());
             reconnect(stream, db).await
         }
+        "DENY" | "ALLOW" | "REMOVE"
+            if query_parts
+                .get(1)
+                .is_some_and(|s| s.eq_ignore_ascii_case("ADDRESS")) =>
+        {
+            let list = match query_parts[0].to_ascii_uppercase().as_str() {
+                "DENY" => Some(List::Deny),
+                "ALLOW" => Some(List::Allow),
+                _ => None,
+            };
+            match query_parts[2..] {
+                [cidr] => edit_access_list(stream, list, cidr).await,
+                _ => {
+                    let verb = query_parts[0].to_ascii_uppercase();
+                    let message = format!("{verb} ADDRESS requires: {verb} ADDRESS <cidr>");
+                    error_response(stream, &message, "42601").await
+                }
+            }
+        }
+        "UNBAN" => match query_parts[1..] {
+            [addr] => unban(stream, addr).await,
+            _ => error_response(stream, "UNBAN requires: UNBAN <ip>", "42601").await,
+        },
+        "DUMP" => match query_parts
+            .get(1)
+            .map(|s| s.to_ascii_uppercase())
+            .as_deref()
+        {
+            Some("STATE") => dump_state(stream).await,
+            _ => error_response(stream, "DUMP requires: DUMP STATE", "42601").await,
+        },
+        "TRACE" => match query_parts[1..] {
+            [target, id, ref args @ ..] if target.eq_ignore_ascii_case("CLIENT") => {
+                trace_client(stream, id, args).await
+            }
+            _ => {
+                error_response(
+                    stream,
+                    "TRACE requires: TRACE CLIENT <id> ON [PAYLOAD] | OFF",
+                    "42601",
+                )
+                .await
+            }
+        },
+        "WEIGHT" => match query_parts[1..] {
+            [db, host, weight] => set_host_weight(stream, db, host, weight).await,
+            _ => {
+                error_response(
+                    stream,
+                    "WEIGHT requires: WEIGHT <db> <host>[:<port>] <weight|DEFAULT>",
+                    "42601",
+                )
+                .await
+            }
+        },
+        "DISABLE" | "ENABLE"
+            if query_parts
+                .get(1)
+                .is_some_and(|s| s.eq_ignore_ascii_case("HOST")) =>
+        {
+            let disabled = query_parts[0].eq_ignore_ascii_case("DISABLE");
+            match query_parts[2..] {
+                [db, host] => set_host_disabled(stream, db, host, disabled).await,
+                _ => {
+                    let verb = if disabled { "DISABLE" } else { "ENABLE" };
+                    let message = format!("{verb} HOST requires: {verb} HOST <db> <host>[:<port>]");
+                    error_response(stream, &message, "42601").await
+                }
+            }
+        }
+        "CREATE" | "ALTER" | "DROP"
+            if query_parts
+                .get(1)
+                .is_some_and(|s| s.eq_ignore_ascii_case("POOL")) =>
+        {
+            let command = match query_parts[0].to_ascii_uppercase().as_str() {
+                "CREATE" => "CREATE POOL",
+                "ALTER" => "ALTER POOL",
+                _ => "DROP POOL",
+            };
+            match pool_command_args(&query) {
+                Some((name, definition)) => {
+                    manage_pool(stream, command, &name, definition.as_deref()).await
+                }
+                None => {
+                    let message =
+                        format!("{command}: expected a pool name and a quoted JSON literal");
+                    error_response(stream, &message, "42601").await
+                }
+            }
+        }
         "SHOW" => {
             if query_parts.len() < 2 {
                 warn!("unsupported admin subcommand for SHOW: {query_parts:?}");
@@ -127,11 +276,21 @@ where
                     "POOLS_EXTENDED" => show_pools_extended(stream).await,
                     "POOLS_MEMORY" | "POOL_MEMORY" => show_pools_memory(stream).await,
                     "PREPARED_STATEMENTS" => show_prepared_statements(stream).await,
+                    "PREPARED_TRANSACTIONS" => show_prepared_transactions(stream).await,
                     "INTERNER" => match query_parts.get(2).and_then(|s| s.parse::<usize>().ok()) {
                         Some(n) => show_interner_top(stream, n).await,
                         None => show_interner(stream).await,
                     },
+                    "BUFFER_POOL" => show_buffer_pool(stream).await,
                     "CLIENTS" => show_clients(stream).await,
+                    "ACTIVE_QUERIES" => show_active_queries(stream).await,
+                    "ACTIVE"
+                        if query_parts
+                            .get(2)
+                            .is_some_and(|s| s.eq_ignore_ascii_case("QUERIES")) =>
+                    {
+                        show_active_queries(stream).await
+                    }
                     "SERVERS" => show_servers(stream).await,
                     "CONNECTIONS" => show_connections(stream).await,
                     "STATS" => show_stats(stream).await,
@@ -142,6 +301,10 @@ where
                     "POOL_COORDINATOR" => show_pool_coordinator(stream).await,
                     "POOL_SCALING" => show_pool_scaling(stream).await,
                     "LOG_LEVEL" => show_log_level(stream).await,
+                    "FEATURES" => show_features(stream).await,
+                    "HOST_WEIGHTS" => show_host_weights(stream).await,
+                    "BANS" => show_bans(stream).await,
+                    "ACCESS_LIST" => show_access_list(stream).await,
                     #[cfg(target_os = "linux")]
                     "SOCKETS" => show_sockets(stream).await,
                     _ => {
@@ -160,13 +323,20 @@ where
             }
         }
         "RESET" => {
-            if query_parts.len() == 2 && query_parts[1].eq_ignore_ascii_case("INTERNER") {
-                reset_interner(stream).await
+            let interner =
+                query_parts.len() >= 2 && query_parts[1].eq_ignore_ascii_case("INTERNER");
+            if interner && query_parts.len() == 2 {
+                reset_interner(stream, false).await
+            } else if interner
+                && query_parts.len() == 3
+                && query_parts[2].eq_ignore_ascii_case("ANONYMOUS")
+            {
+                reset_interner(stream, true).await
             } else {
                 warn!("unsupported admin RESET target: {query_parts:?}");
                 error_response(
                     stream,
-                    "Unsupported RESET target — only RESET INTERNER is supported",
+                    "Unsupported RESET target — only RESET INTERNER [ANONYMOUS] is supported",
                     "58000",
                 )
                 .await
@@ -210,6 +380,9 @@ where
         // SET <TAB> — return settable parameters (filtered by context)
         res.put(row_description(&vec![("name", DataType::Text)]));
         res.put(data_row(&["log_level".to_string()]));
+        for name in crate::config::runtime::SETTABLE {
+            res.put(data_row(&[name.to_string()]));
+        }
     } else {
         // SHOW <TAB> — return all SHOW subcommands from the canonical list
         res.put(row_description(&vec![("name", DataType::Text)]));
@@ -225,7 +398,37 @@ where
     write_all_half(stream, &res).await
 }
 
-/// Handle SET command. Currently supports: SET log_level = '<filter>'
+/// Split `<CREATE|ALTER|DROP> POOL <name> ['<json>']` into the pool name
+/// and the unquoted literal (`''` stands for a quote inside it). The name
+/// may be double-quoted. `None` when the query doesn't have this shape.
+fn pool_command_args(query: &str) -> Option<(String, Option<String>)> {
+    fn skip_word(s: &str) -> Option<&str> {
+        let s = s.trim_start();
+        Some(s[s.find(char::is_whitespace)?..].trim_start())
+    }
+    let rest = skip_word(skip_word(query.trim().trim_end_matches(';'))?)?;
+
+    let (name, rest) = if let Some(quoted) = rest.strip_prefix('"') {
+        let end = quoted.find('"')?;
+        (&quoted[..end], &quoted[end + 1..])
+    } else {
+        let end = rest.find(char::is_whitespace).unwrap_or(rest.len());
+        (&rest[..end], &rest[end..])
+    };
+    if name.is_empty() {
+        return None;
+    }
+
+    let rest = rest.trim();
+    if rest.is_empty() {
+        return Some((name.to_string(), None));
+    }
+    let literal = rest.strip_prefix('\'')?.strip_suffix('\'')?;
+    Some((name.to_string(), Some(literal.replace("''", "'"))))
+}
+
+/// Handle SET command: `SET log_level = '<filter>'` or one of the
+/// `[general]` settings listed in `config::runtime::SETTABLE`.
 async fn set_command<T>(stream: &mut T, query_parts: &[&str]) -> Result<(), Error>
 where
     T: tokio::io::AsyncWrite + std::marker::Unpin,
@@ -236,6 +439,9 @@ where
     }
 
     let param = query_parts[1].to_ascii_uppercase();
+    if param == "FEATURE" {
+        return set_feature(stream, &query_parts[2..]).await;
+    }
     // Collect value: skip "=" if present, join remaining parts
     let value_parts: Vec<&str> = query_parts[2..]
         .iter()
@@ -254,30 +460,105 @@ where
                 // can confirm a mid-incident `SET log_level = debug`
                 // landed without grepping logs.
                 crate::web::metrics::refresh_static_info_metrics();
-                let mut res = BytesMut::new();
-                res.put(command_complete("SET"));
-                res.put_u8(b'Z');
-                res.put_i32(5);
-                res.put_u8(b'I');
-                write_all_half(stream, &res).await
+                set_complete(stream).await
             }
             Err(err) => error_response(stream, &err, "42601").await,
         },
-        _ => {
-            error_response(
-                stream,
-                &format!("Unknown SET parameter: {param}. Supported: log_level"),
-                "42601",
-            )
-            .await
+        _ => match crate::config::runtime::set_general(&param, value).await {
+            Ok(shown) => {
+                let param = param.to_ascii_lowercase();
+                log::info!("SET {param} = '{shown}' (until the next RELOAD)");
+                set_complete(stream).await
+            }
+            Err(err) => error_response(stream, &err, "42601").await,
+        },
+    }
+}
+
+/// Handle `SET FEATURE <name> = on | off | default`.
+async fn set_feature<T>(stream: &mut T, args: &[&str]) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let args: Vec<&str> = args.iter().filter(|s| **s != "=").copied().collect();
+    let [name, value] = args[..] else {
+        return error_response(
+            stream,
+            "SET FEATURE requires: SET FEATURE <name> = on|off|default",
+            "42601",
+        )
+        .await;
+    };
+    let value = value.trim_matches('\'').trim_matches('"');
+    match crate::config::features::set(name, value) {
+        Ok(name) => {
+            let state = if crate::config::features::enabled(name) {
+                "on"
+            } else {
+                "off"
+            };
+            log::info!("SET FEATURE {name} = {value} ({name} is now {state})");
+            crate::admin::events::push_event("FEATURE", format!("{name} {state}"));
+            set_complete(stream).await
         }
+        Err(err) => error_response(stream, &err, "42601").await,
     }
 }
 
+async fn set_complete<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let mut res = BytesMut::new();
+    res.put(command_complete("SET"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
 
+    #[test]
+    fn pool_command_args_unquotes_name_and_literal() {
+        assert_eq!(
+            pool_command_args(r#"CREATE POOL tenant_1 '{"server_host": "it''s"}';"#),
+            Some((
+                "tenant_1".to_string(),
+                Some(r#"{"server_host": "it's"}"#.to_string())
+            ))
+        );
+        assert_eq!(
+            pool_command_args(r#"drop pool "Tenant 2""#),
+            Some(("Tenant 2".to_string(), None))
+        );
+        assert_eq!(pool_command_args("DROP POOL"), None);
+        assert_eq!(pool_command_args("ALTER POOL t {}"), None);
+    }
+
+    #[tokio::test]
+    async fn stats_user_may_only_show() {
+        let run = |query: &'static str| async move {
+            let mut out = Vec::new();
+            let map = ClientServerMap::default();
+            handle_admin(&mut out, crate::messages::simple_query(query), map, true)
+                .await
+                .unwrap();
+            out
+        };
+        for query in ["PAUSE", "RELOAD", "SET log_level = 'debug'"] {
+            let out = run(query).await;
+            assert_eq!(out[0], b'E', "{query}");
+            let text = String::from_utf8_lossy(&out);
+            assert!(text.contains("42501"), "{query}: {text}");
+        }
+        let out = run("SHOW VERSION").await;
+        assert_eq!(out[0], b'T');
+        assert!(String::from_utf8_lossy(&out).contains("PgDoorman"));
+    }
+
     #[test]
     fn show_subcommands_contains_startup_parameters() {
         // Tab completion on `SHOW <TAB>` returns SHOW_SUBCOMMANDS, and the
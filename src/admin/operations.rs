@@ -1,6 +1,6 @@
 //! Single source of truth for the database-scoped admin actions. Both the
 //! postgres-protocol admin socket (`crate::admin::commands::{pause,resume,
-//! reconnect}`) and the REST surface (`POST /api/admin/{pause,resume,
+//! hold,reconnect}`) and the REST surface (`POST /api/admin/{pause,resume,
 //! reconnect}`) call into the helpers here and translate the typed
 //! [`AdminEffect`] into their own response envelopes. That way the two
 //! transports cannot diverge: a `db` filter that matches no pool is
@@ -11,11 +11,13 @@
 //! overlay paints a marker on every successful action regardless of
 //! origin.
 
-use log::info;
+use std::time::Duration;
+
+use log::{info, warn};
 
 use crate::config::reload_config;
 use crate::errors::Error;
-use crate::pool::{get_all_pools, get_client_server_map, ConnectionPool, PoolIdentifier};
+use crate::pool::{get_all_pools, get_client_server_map, get_pool, ConnectionPool, PoolIdentifier};
 
 /// Scope filter for `pause` / `resume` / `reconnect`. The REST surface
 /// accepts both `?db=<name>` (every user@db pool of one database) and
@@ -99,6 +101,56 @@ pub fn resume_now(scope: AdminScope) -> AdminEffect {
     })
 }
 
+/// Hold every pool the scope selects: new transactions queue (without
+/// `query_wait_timeout`) while in-flight ones finish, until `RESUME` or
+/// until `timeout` passes.
+pub fn hold_now(scope: AdminScope, timeout: Duration) -> AdminEffect {
+    apply_per_pool(scope, |identifier, pool| {
+        let generation = pool.database.hold();
+        let (identifier, pool) = (identifier.clone(), pool.clone());
+        crate::admin::events::push_event("HOLD", format!("pool {identifier} held"));
+        info!("HOLD: held pool {identifier} for up to {timeout:?}");
+        tokio::spawn(async move {
+            tokio::time::sleep(timeout).await;
+            if pool.database.release_hold(generation) {
+                crate::admin::events::push_event(
+                    "RESUME",
+                    format!("hold of pool {identifier} expired"),
+                );
+                warn!("HOLD: hold of pool {identifier} expired after {timeout:?}, resumed");
+            }
+        });
+    })
+}
+
+/// Wait until no server connection of `pools` is checked out, polling.
+/// Returns `false` if some still are after `timeout`, or once a pool is no
+/// longer held (`RESUME`, hold expiry).
+pub async fn wait_drained(pools: &[PoolIdentifier], timeout: Duration) -> bool {
+    let deadline = tokio::time::Instant::now() + timeout;
+    loop {
+        let mut drained = true;
+        for identifier in pools {
+            let Some(pool) = get_pool(&identifier.db, &identifier.user) else {
+                continue;
+            };
+            if !pool.database.is_held() {
+                return false;
+            }
+            if pool.database.in_use() > 0 {
+                drained = false;
+            }
+        }
+        if drained {
+            return true;
+        }
+        if tokio::time::Instant::now() >= deadline {
+            return false;
+        }
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+}
+
 /// Reconnect — bumps the pool epoch and drains idle connections. Active
 /// connections are refused on return.
 pub fn reconnect_now(scope: AdminScope) -> AdminEffect {
@@ -7,7 +7,7 @@ use std::sync::Arc;
 use bytes::{BufMut, BytesMut};
 
 use crate::app::log_level;
-use crate::config::{get_config, VERSION};
+use crate::config::{get_config, runtime, Config, VERSION};
 use crate::errors::Error;
 use crate::messages::protocol::{command_complete, data_row, row_description};
 use crate::messages::socket::write_all_half;
@@ -116,6 +116,143 @@ where
     write_all_half(stream, &res).await
 }
 
+/// Show the feature flags (`general.features`, `SET FEATURE`).
+pub async fn show_features<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("name", DataType::Text),
+        ("enabled", DataType::Text),
+        ("origin", DataType::Text),
+        ("description", DataType::Text),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+    for feature in crate::config::features::list() {
+        res.put(data_row(&[
+            feature.name,
+            if feature.enabled { "on" } else { "off" },
+            feature.origin,
+            feature.description,
+        ]));
+    }
+    res.put(command_complete("SHOW"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Show the runtime client address deny and allow lists (`DENY ADDRESS`,
+/// `ALLOW ADDRESS`).
+pub async fn show_access_list<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("list", DataType::Text),
+        ("address", DataType::Text),
+        ("age_sec", DataType::Numeric),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+    for entry in crate::auth::access_list::entries() {
+        res.put(data_row(&[
+            entry.list.name().to_string(),
+            entry.net.to_string(),
+            entry.age.as_secs().to_string(),
+        ]));
+    }
+    res.put(command_complete("SHOW"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Show client addresses banned after repeated authentication failures
+/// (`auth_ban_threshold`), longest remaining ban first.
+pub async fn show_bans<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("address", DataType::Text),
+        ("banned_for_sec", DataType::Numeric),
+        ("remaining_sec", DataType::Numeric),
+        ("bans", DataType::Numeric),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+    for ban in crate::auth::ban::list() {
+        res.put(data_row(&[
+            ban.addr.to_string(),
+            ban.age.as_secs().to_string(),
+            ban.remaining.as_secs().to_string(),
+            ban.bans.to_string(),
+        ]));
+    }
+    res.put(command_complete("SHOW"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Show the balanced backend hosts of every pool (`server_host_weights`,
+/// `load_balance_hosts` or the `WEIGHT` command): weight, policy and the
+/// load the policies look at.
+pub async fn show_host_weights<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("database", DataType::Text),
+        ("user", DataType::Text),
+        ("host", DataType::Text),
+        ("port", DataType::Int4),
+        ("weight", DataType::Int4),
+        ("source", DataType::Text),
+        ("policy", DataType::Text),
+        ("connections", DataType::Numeric),
+        ("latency_us", DataType::Numeric),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+    let pools = get_all_pools();
+    let mut identifiers: Vec<_> = pools.keys().collect();
+    identifiers.sort_by(|a, b| (&a.db, &a.user).cmp(&(&b.db, &b.user)));
+    for identifier in identifiers {
+        let Some(hosts) = pools[identifier].database.host_list() else {
+            continue;
+        };
+        let Some(weights) = hosts.host_weights() else {
+            continue;
+        };
+        let policy = hosts.policy().to_string();
+        for weight in weights {
+            let load = hosts.load(&weight.host, weight.port);
+            res.put(data_row(&[
+                identifier.db.clone(),
+                identifier.user.clone(),
+                weight.host,
+                weight.port.to_string(),
+                weight.weight.to_string(),
+                weight.source.to_string(),
+                policy.clone(),
+                load.connections().to_string(),
+                load.latency_us().to_string(),
+            ]));
+        }
+    }
+    res.put(command_complete("SHOW"));
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
 /// Show utilization of connection pools for each pool.
 pub async fn show_pools<T>(stream: &mut T) -> Result<(), Error>
 where
@@ -196,6 +333,78 @@ where
     write_all_half(stream, &res).await
 }
 
+/// Transactions prepared through pg_doorman (`two_phase_commit = pin`) and
+/// not yet committed or rolled back through it.
+pub async fn show_prepared_transactions<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("database", DataType::Text),
+        ("gid", DataType::Text),
+        ("user", DataType::Text),
+        ("client_addr", DataType::Text),
+        ("backend_pid", DataType::Numeric),
+        ("age_seconds", DataType::Numeric),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+
+    for prepared in crate::client::prepared_transactions() {
+        res.put(data_row(&[
+            prepared.database,
+            prepared.gid,
+            prepared.user,
+            prepared.client_addr,
+            prepared.backend_pid.to_string(),
+            prepared.prepared_at.elapsed().as_secs().to_string(),
+        ]));
+    }
+
+    res.put(command_complete("SHOW"));
+    // ReadyForQuery
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Protocol buffer pool counters per size class, plus a row (class_size 0)
+/// for buffers too large to pool.
+pub async fn show_buffer_pool<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("class_size", DataType::Numeric),
+        ("pooled", DataType::Numeric),
+        ("allocated", DataType::Numeric),
+        ("reused", DataType::Numeric),
+        ("returned", DataType::Numeric),
+        ("dropped", DataType::Numeric),
+    ];
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+
+    for class in crate::client::buffer_pool::buffer_pool_stats() {
+        res.put(data_row(&[
+            class.class_size.to_string(),
+            class.pooled.to_string(),
+            class.allocated.to_string(),
+            class.reused.to_string(),
+            class.returned.to_string(),
+            class.dropped.to_string(),
+        ]));
+    }
+
+    res.put(command_complete("SHOW"));
+    // ReadyForQuery
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
 /// Aggregate of the global query interner, grouped by kind. Two rows
 /// (named, anonymous) with entry counts and uncompressed byte totals.
 pub async fn show_interner<T>(stream: &mut T) -> Result<(), Error>
@@ -302,13 +511,18 @@ where
     write_all_half(stream, &res).await
 }
 
-/// Force-clear both interners. Diagnostics-only — in-flight clients re-Parse
+/// Force-clear both interners, or only the anonymous one when
+/// `anonymous_only` is set. Diagnostics-only — in-flight clients re-Parse
 /// on next reuse. Returns CommandComplete RESET.
-pub async fn reset_interner<T>(stream: &mut T) -> Result<(), Error>
+pub async fn reset_interner<T>(stream: &mut T, anonymous_only: bool) -> Result<(), Error>
 where
     T: tokio::io::AsyncWrite + std::marker::Unpin,
 {
-    crate::server::reset_interners_force();
+    if anonymous_only {
+        crate::server::reset_anon_interner_force();
+    } else {
+        crate::server::reset_interners_force();
+    }
 
     let mut res = BytesMut::new();
     res.put(command_complete("RESET"));
@@ -356,13 +570,28 @@ where
         "SHOW CONNECTIONS".to_string(),
         "SHOW STATS".to_string(),
         "SET log_level = '<filter>'".to_string(),
-        "RELOAD".to_string(),
-        "SHUTDOWN".to_string(),
+        "SET <setting> = '<value>'".to_string(),
+        "SET FEATURE <name> = on|off|default".to_string(),
+        "RELOAD [HBA]".to_string(),
+        "SHUTDOWN [SMART|FAST|IMMEDIATE]".to_string(),
         "UPGRADE".to_string(),
         "PAUSE [db]".to_string(),
         "RESUME [db]".to_string(),
+        "HOLD [db]".to_string(),
         "RECONNECT [db]".to_string(),
-        "RESET INTERNER".to_string(),
+        "WEIGHT <db> <host>[:<port>] <weight|DEFAULT>".to_string(),
+        "DISABLE HOST <db> <host>[:<port>]".to_string(),
+        "ENABLE HOST <db> <host>[:<port>]".to_string(),
+        "UNBAN <ip>".to_string(),
+        "DENY ADDRESS <cidr>".to_string(),
+        "ALLOW ADDRESS <cidr>".to_string(),
+        "REMOVE ADDRESS <cidr>".to_string(),
+        "CREATE POOL <name> '<json>'".to_string(),
+        "ALTER POOL <name> '<json>'".to_string(),
+        "DROP POOL <name>".to_string(),
+        "RESET INTERNER [ANONYMOUS]".to_string(),
+        "DUMP STATE".to_string(),
+        "TRACE CLIENT <id> ON [PAYLOAD] | OFF".to_string(),
     ];
     let mut res = BytesMut::new();
     res.put(row_description(&columns));
@@ -377,7 +606,8 @@ where
     write_all_half(stream, &res).await
 }
 
-/// Show databases.
+/// Show databases: pgbouncer's SHOW DATABASES columns, one row per pool.
+/// `force_user` is the pool's user, as every pool serves one user.
 pub async fn show_databases<T>(stream: &mut T) -> Result<(), Error>
 where
     T: tokio::io::AsyncWrite + std::marker::Unpin,
@@ -386,35 +616,62 @@ where
     let columns = vec![
         ("name", DataType::Text),
         ("host", DataType::Text),
-        ("port", DataType::Text),
+        ("port", DataType::Int4),
         ("database", DataType::Text),
         ("force_user", DataType::Text),
         ("pool_size", DataType::Int4),
         ("min_pool_size", DataType::Int4),
-        ("reserve_pool", DataType::Int4),
+        ("reserve_pool_size", DataType::Int4),
+        ("server_lifetime", DataType::Int4),
         ("pool_mode", DataType::Text),
+        ("load_balance_hosts", DataType::Text),
         ("max_connections", DataType::Int4),
         ("current_connections", DataType::Int4),
+        ("max_client_connections", DataType::Int4),
+        ("current_client_connections", DataType::Int4),
+        ("paused", DataType::Int4),
+        ("disabled", DataType::Int4),
     ];
+    let config = get_config();
+    let pool_lookup = PoolStats::construct_pool_lookup();
     let mut res = BytesMut::new();
     res.put(row_description(&columns));
-    for (_, pool) in get_all_pools().iter() {
-        let pool_config = pool.settings.clone();
-        let database_name = &pool.address().database;
+    for (identifier, pool) in get_all_pools().iter() {
+        let settings = &pool.settings;
         let address = pool.address();
-        let pool_state = pool.pool_state();
+        let pool_config = config.pools.get(&identifier.db);
+        let host = pool_config.map_or(address.host.clone(), |p| p.server_host.clone());
+        let server_database = pool_config
+            .and_then(|p| p.server_database.clone())
+            .unwrap_or_else(|| address.database.clone());
+        let reserve_pool_size = pool_config.and_then(|p| p.reserve_pool_size).unwrap_or(0);
+        let max_connections = pool_config.and_then(|p| p.max_db_connections).unwrap_or(0);
+        let (clients, load_balance_hosts) = match pool_lookup.get(identifier) {
+            Some(stats) => (
+                stats.cl_idle + stats.cl_active + stats.cl_waiting,
+                stats.load_balance_hosts.to_string(),
+            ),
+            None => (0, "disable".to_string()),
+        };
         res.put(data_row(&[
-            address.name(),                                          // name
-            address.host.to_string(),                                // host
-            address.port.to_string(),                                // port
-            database_name.to_string(),                               // database
-            pool_config.user.username.to_string(),                   // force_user
-            pool_config.user.pool_size.to_string(),                  // pool_size
-            pool_config.user.min_pool_size.unwrap_or(0).to_string(), // min_pool_size
-            "0".to_string(),                                         // reserve_pool
-            pool_config.pool_mode.to_string(),                       // pool_mode
-            pool_config.user.pool_size.to_string(),                  // max_connections
-            pool_state.size.to_string(),                             // current_connections
+            address.name(),
+            host,
+            address.port.to_string(),
+            server_database,
+            settings.user.username.clone(),
+            settings.user.pool_size.to_string(),
+            settings.user.min_pool_size.unwrap_or(0).to_string(),
+            reserve_pool_size.to_string(),
+            (settings.server_lifetime_ms() / 1000).to_string(),
+            settings.pool_mode.to_string(),
+            load_balance_hosts,
+            max_connections.to_string(),
+            pool.pool_state().size.to_string(),
+            // No per-database client limit.
+            "0".to_string(),
+            clients.to_string(),
+            (pool.database.is_paused() as u8).to_string(),
+            "0".to_string(),
         ]));
     }
     res.put(command_complete("SHOW"));
@@ -432,6 +689,7 @@ where
 {
     let config = &get_config();
     let config: HashMap<String, String> = config.into();
+    let defaults: HashMap<String, String> = (&Config::default()).into();
     // Configs that cannot be changed without restarting. The keys here
     // are the bare names that `From<&Config> for HashMap` emits — the
     // Web `/api/config` view uses flattened paths (`general.host`,
@@ -444,6 +702,7 @@ where
         ("value", DataType::Text),
         ("default", DataType::Text),
         ("changeable", DataType::Text),
+        ("origin", DataType::Text),
     ];
     // Response data
     let mut res = BytesMut::new();
@@ -455,7 +714,10 @@ where
         } else {
             "yes".to_string()
         };
-        let row = vec![key, value, "-".to_string(), changeable];
+        let default = defaults.get(&key);
+        let origin = runtime::origin(&key, &value, default.map(String::as_str)).to_string();
+        let default = default.cloned().unwrap_or_else(|| "-".to_string());
+        let row = vec![key, value, default, changeable, origin];
         res.put(data_row(&row));
     }
     res.put(command_complete("SHOW"));
@@ -503,6 +765,7 @@ where
         ("query_count", DataType::Numeric),
         ("error_count", DataType::Numeric),
         ("age_seconds", DataType::Numeric),
+        ("tag", DataType::Text),
     ];
     let new_map = get_client_stats();
     let mut res = BytesMut::new();
@@ -521,6 +784,52 @@ where
             client.query_count.load(Ordering::Relaxed).to_string(),
             client.error_count.load(Ordering::Relaxed).to_string(),
             client.connect_time().elapsed().as_secs().to_string(),
+            client.tag().to_string(),
+        ];
+        res.put(data_row(&row));
+    }
+    res.put(command_complete("SHOW"));
+    // ReadyForQuery
+    res.put_u8(b'Z');
+    res.put_i32(5);
+    res.put_u8(b'I');
+    write_all_half(stream, &res).await
+}
+
+/// Show statements currently running on a backend, longest-running first.
+/// Query text is normalized: literals are masked and comments dropped.
+pub async fn show_active_queries<T>(stream: &mut T) -> Result<(), Error>
+where
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let columns = vec![
+        ("client_id", DataType::Text),
+        ("database", DataType::Text),
+        ("user", DataType::Text),
+        ("application_name", DataType::Text),
+        ("addr", DataType::Text),
+        ("server_process_id", DataType::Text),
+        ("elapsed_ms", DataType::Numeric),
+        ("query", DataType::Text),
+    ];
+    let new_map = get_client_stats();
+    let mut active: Vec<_> = new_map
+        .values()
+        .filter_map(|client| client.active_query().map(|query| (client, query)))
+        .collect();
+    active.sort_by(|(_, a), (_, b)| b.elapsed_ms.cmp(&a.elapsed_ms));
+    let mut res = BytesMut::new();
+    res.put(row_description(&columns));
+    for (client, query) in active {
+        let row = vec![
+            format!("#c{}", client.connection_id()),
+            client.pool_name().to_string(),
+            client.username().to_string(),
+            client.application_name().to_string(),
+            client.ipaddr().to_string(),
+            query.server_process_id.to_string(),
+            query.elapsed_ms.to_string(),
+            crate::utils::strings::normalize_query(&query.text),
         ];
         res.put(data_row(&row));
     }
@@ -632,21 +941,49 @@ where
     write_all_half(stream, &res).await
 }
 
-/// Show Users.
+/// Show users: pgbouncer's SHOW USERS columns, one row per pool, with
+/// the pool's database as an extra column since pool settings are per
+/// database and user.
 pub async fn show_users<T>(stream: &mut T) -> Result<(), Error>
 where
     T: tokio::io::AsyncWrite + std::marker::Unpin,
 {
+    let config = get_config();
+    let pool_lookup = PoolStats::construct_pool_lookup();
     let mut res = BytesMut::new();
     res.put(row_description(&vec![
         ("name", DataType::Text),
+        ("pool_size", DataType::Int4),
+        ("reserve_pool_size", DataType::Int4),
         ("pool_mode", DataType::Text),
+        ("max_user_connections", DataType::Int4),
+        ("current_connections", DataType::Int4),
+        ("max_user_client_connections", DataType::Int4),
+        ("current_client_connections", DataType::Int4),
+        // pg_doorman extension.
+        ("database", DataType::Text),
     ]));
     for (user_pool, pool) in get_all_pools().iter() {
         let pool_config = &pool.settings;
+        let reserve_pool_size = config
+            .pools
+            .get(&user_pool.db)
+            .and_then(|p| p.reserve_pool_size)
+            .unwrap_or(0);
+        let clients = pool_lookup.get(user_pool).map_or(0, |stats| {
+            stats.cl_idle + stats.cl_active + stats.cl_waiting
+        });
         res.put(data_row(&[
             user_pool.user.clone(),
+            pool_config.user.pool_size.to_string(),
+            reserve_pool_size.to_string(),
             pool_config.pool_mode.to_string(),
+            pool_config.user.pool_size.to_string(),
+            pool.pool_state().size.to_string(),
+            // No per-user client limit.
+            "0".to_string(),
+            clients.to_string(),
+            user_pool.db.clone(),
         ]));
     }
     res.put(command_complete("SHOW"));
@@ -64,6 +64,31 @@ pub enum Commands {
         #[arg(short, long)]
         output_dir: Option<String>,
     },
+    /// Prompt for a password and print its SCRAM-SHA-256 verifier for `users.password`.
+    /// Reads the password from stdin when it is not a terminal.
+    GenPassword {
+        /// Also print the md5 hash, which is salted with this user name.
+        #[arg(long, value_name = "USER")]
+        md5: Option<String>,
+        /// PBKDF2 iteration count of the SCRAM verifier.
+        #[arg(long, default_value_t = crate::auth::scram::DEFAULT_ITERATIONS,
+              value_parser = clap::value_parser!(u32).range(1..=i32::MAX as i64))]
+        iterations: u32,
+        /// Reuse the salt and iterations of this SCRAM verifier, as `next_password`
+        /// requires during password rotation.
+        #[arg(long, value_name = "VERIFIER", conflicts_with = "iterations")]
+        salt_from: Option<String>,
+    },
+    /// Print a ready-to-import dashboard for the Prometheus exporter's metrics
+    Dashboard {
+        /// Dashboard format.
+        #[arg(short, long, value_enum, default_value_t = DashboardFormat::Grafana)]
+        format: DashboardFormat,
+        /// Output file for the dashboard.
+        /// If not specified, prints to stdout.
+        #[arg(short, long)]
+        output: Option<String>,
+    },
 }
 
 #[derive(Debug, Clone, Parser)]
@@ -178,6 +203,11 @@ pub enum OutputFormat {
     Toml,
 }
 
+#[derive(ValueEnum, Clone, Debug)]
+pub enum DashboardFormat {
+    Grafana,
+}
+
 impl fmt::Display for OutputFormat {
     fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
         match self {
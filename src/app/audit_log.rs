@@ -0,0 +1,144 @@
+//! Audit log stream (`general.audit_log`).
+//!
+//! DDL, GRANT/REVOKE, role changes and every statement run on a superuser
+//! backend are written one JSON object per line, apart from the main log:
+//! to a file of their own, or to syslog with facility `authpriv`. The file
+//! is opened in append mode and reopened on every config reload, so
+//! logrotate can move it away and send SIGHUP.
+
+use log::error;
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use std::fs::{File, OpenOptions};
+use std::io::Write;
+use std::sync::atomic::{AtomicBool, Ordering};
+use syslog::{Facility, Formatter3164, Logger, LoggerBackend};
+
+use crate::config::General;
+use crate::errors::Error;
+
+/// `audit_log` value that sends records to syslog instead of a file.
+pub const SYSLOG: &str = "syslog";
+
+enum Sink {
+    File(File),
+    Syslog(Logger<LoggerBackend, Formatter3164>),
+}
+
+/// False while `audit_log` is unset, so statements skip classification.
+static ENABLED: AtomicBool = AtomicBool::new(false);
+static SINK: Lazy<Mutex<Option<Sink>>> = Lazy::new(|| Mutex::new(None));
+
+/// Open the destination named by `general.audit_log`, replacing the
+/// previous one. On error the previous destination is kept.
+pub fn configure(general: &General) -> Result<(), Error> {
+    let sink = match general.audit_log.as_deref() {
+        None => None,
+        Some(SYSLOG) => {
+            let formatter = Formatter3164 {
+                facility: Facility::LOG_AUTHPRIV,
+                hostname: None,
+                process: format!(
+                    "{}-audit",
+                    general.syslog_prog_name.as_deref().unwrap_or("pg_doorman")
+                ),
+                pid: std::process::id(),
+            };
+            let logger = syslog::unix(formatter).map_err(|err| {
+                Error::BadConfig(format!("audit_log: failed to open syslog socket: {err}"))
+            })?;
+            Some(Sink::Syslog(logger))
+        }
+        Some(path) => {
+            let file = OpenOptions::new()
+                .create(true)
+                .append(true)
+                .open(path)
+                .map_err(|err| {
+                    Error::BadConfig(format!("audit_log: failed to open {path}: {err}"))
+                })?;
+            Some(Sink::File(file))
+        }
+    };
+    let mut current = SINK.lock();
+    ENABLED.store(sink.is_some(), Ordering::Relaxed);
+    *current = sink;
+    Ok(())
+}
+
+#[inline]
+pub fn enabled() -> bool {
+    ENABLED.load(Ordering::Relaxed)
+}
+
+/// One audited statement.
+pub struct AuditRecord<'a> {
+    /// `ddl`, `privilege`, `role` or `superuser`.
+    pub class: &'static str,
+    pub pool: &'a str,
+    pub user: &'a str,
+    pub client_addr: &'a str,
+    pub application_name: &'a str,
+    pub connection_id: u64,
+    pub backend_pid: i32,
+    pub statement: &'a str,
+}
+
+impl AuditRecord<'_> {
+    fn to_json(&self) -> String {
+        serde_json::json!({
+            "timestamp": chrono::Utc::now().format("%Y-%m-%dT%H:%M:%S%.3fZ").to_string(),
+            "class": self.class,
+            "pool": self.pool,
+            "user": self.user,
+            "client_addr": self.client_addr,
+            "application_name": self.application_name,
+            "connection_id": self.connection_id,
+            "backend_pid": self.backend_pid,
+            "statement": self.statement,
+        })
+        .to_string()
+    }
+}
+
+pub fn write(record: &AuditRecord) {
+    let mut line = record.to_json();
+    let mut sink = SINK.lock();
+    let result = match sink.as_mut() {
+        None => return,
+        Some(Sink::File(file)) => {
+            line.push('\n');
+            file.write_all(line.as_bytes())
+                .map_err(|err| err.to_string())
+        }
+        Some(Sink::Syslog(logger)) => logger.notice(line).map_err(|err| err.to_string()),
+    };
+    if let Err(err) = result {
+        error!("audit log write failed: {err}");
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn record_is_one_json_line() {
+        let record = AuditRecord {
+            class: "ddl",
+            pool: "shop",
+            user: "app",
+            client_addr: "10.0.0.7:51234",
+            application_name: "migrate",
+            connection_id: 42,
+            backend_pid: 4711,
+            statement: "DROP TABLE \"t\"\n",
+        };
+        let line = record.to_json();
+        assert!(!line.contains('\n'));
+        let parsed: serde_json::Value = serde_json::from_str(&line).unwrap();
+        assert_eq!(parsed["class"], "ddl");
+        assert_eq!(parsed["statement"], "DROP TABLE \"t\"\n");
+        assert_eq!(parsed["backend_pid"], 4711);
+    }
+}
@@ -11,7 +11,26 @@ pub enum Error {
     ConnectError(String),
     /// Local fd exhaustion while opening a backend connection.
     ConnectResourceExhausted(String),
+    /// The pool's backend circuit breaker is open after repeated connect
+    /// failures; the checkout fails without trying the backend.
+    CircuitBreakerOpen(String),
     ClientBadStartup,
+    /// Missing or malformed PROXY protocol header on a `proxy_protocol`
+    /// listener.
+    ProxyProtocolError(String),
+    /// Client broke the wire protocol. `kind` is the
+    /// `pg_doorman_client_protocol_violations_total` label; `head` keeps
+    /// the first bytes the client sent for the log line.
+    ClientProtocolViolation {
+        kind: &'static str,
+        detail: String,
+        head: Vec<u8>,
+    },
+    /// Client did not finish startup and authentication within
+    /// `client_login_timeout`.
+    ClientLoginTimeout,
+    /// Client took no bytes of a server response for `client_write_timeout`.
+    ClientWriteTimeout,
     ProtocolSyncError(String),
     BadQuery(String),
     ServerError,
@@ -77,6 +96,9 @@ pub struct ClientIdentifier {
     pub is_talos: bool,
     pub hba_scram: CheckResult,
     pub hba_md5: CheckResult,
+    /// TLS or a Unix socket: a cleartext secret doesn't cross the network
+    /// in the clear (`general.plain_auth_require_tls`).
+    pub secure_transport: bool,
 }
 
 impl ClientIdentifier {
@@ -94,6 +116,7 @@ impl ClientIdentifier {
             is_talos: false,
             hba_scram: CheckResult::NotMatched,
             hba_md5: CheckResult::NotMatched,
+            secure_transport: false,
         }
     }
 }
@@ -143,7 +166,18 @@ impl std::fmt::Display for Error {
             Error::ConnectResourceExhausted(msg) => {
                 write!(f, "Backend connect local resource exhausted: {msg}")
             }
+            Error::CircuitBreakerOpen(msg) => write!(f, "Circuit breaker open: {msg}"),
             Error::ClientBadStartup => write!(f, "Client sent an invalid startup message"),
+            Error::ProxyProtocolError(msg) => write!(f, "PROXY protocol error: {msg}"),
+            Error::ClientProtocolViolation { kind, detail, .. } => {
+                write!(f, "Client protocol violation ({kind}): {detail}")
+            }
+            Error::ClientLoginTimeout => {
+                write!(f, "Client did not finish login within client_login_timeout")
+            }
+            Error::ClientWriteTimeout => {
+                write!(f, "Client stopped reading the response for client_write_timeout")
+            }
             Error::ProtocolSyncError(msg) => write!(f, "Protocol synchronization error: {msg}"),
             Error::BadQuery(msg) => write!(f, "Invalid query: {msg}"),
             Error::ServerError => write!(f, "Server encountered an error"),
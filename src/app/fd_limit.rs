@@ -0,0 +1,204 @@
+//! File descriptor budget: the `RLIMIT_NOFILE` check at startup and the
+//! background warning when open descriptors approach the limit.
+
+use std::time::Duration;
+
+use log::{info, warn};
+
+use crate::config::{config_arc, Config};
+use crate::web::metrics::system::{get_fd_limit, get_open_fds};
+
+/// Descriptors pg_doorman needs besides client and server sockets:
+/// stdio, log files, epoll and eventfds, the HTTP listener and its
+/// connections, admin sessions, TLS and config reloads.
+const RESERVED_FDS: u64 = 64;
+
+/// How often open descriptors are compared with `fd_usage_warn_percent`.
+const CHECK_INTERVAL: Duration = Duration::from_secs(10);
+
+/// Descriptors the configuration may need at peak: every client slot,
+/// every server connection the configured pools may open (up to
+/// `max_pool_size` for users that grow), the listeners and
+/// `RESERVED_FDS`. Pools created at runtime by auth_query in
+/// passthrough mode or autodb are not known in advance and not counted.
+pub fn required_fds(config: &Config) -> u64 {
+    let servers: u64 = config
+        .pools
+        .values()
+        .map(|pool| {
+            let users = pool
+                .users
+                .iter()
+                .map(|u| u.max_pool_size.unwrap_or(u.pool_size) as u64)
+                .sum::<u64>();
+            let reserve = pool.reserve_pool_size.unwrap_or(0) as u64;
+            let mut servers = match pool.max_db_connections {
+                Some(max) if max > 0 => max as u64 + reserve,
+                _ => users + reserve * pool.users.len() as u64,
+            };
+            if let Some(auth_query) = &pool.auth_query {
+                servers += auth_query.workers as u64;
+                if auth_query.server_user.is_some() {
+                    servers += auth_query.pool_size as u64;
+                }
+            }
+            servers
+        })
+        .sum();
+    let listeners =
+        1 + config.listeners.len() as u64 + config.general.unix_socket_dir.is_some() as u64;
+    config.general.max_connections + servers + listeners + RESERVED_FDS
+}
+
+/// Makes sure `RLIMIT_NOFILE` fits `required_fds`, raising the soft limit
+/// up to the hard limit when needed. Fails when even the hard limit is
+/// too low, so the shortfall is reported at startup, or on the RELOAD
+/// that grew the pools, instead of as `Too many open files` under load.
+pub fn ensure_fd_limit(config: &Config) -> Result<(), String> {
+    let Some(limit) = get_fd_limit() else {
+        return Ok(());
+    };
+    let required = required_fds(config);
+    if required <= limit.soft {
+        return Ok(());
+    }
+    if required > limit.hard {
+        return Err(format!(
+            "configuration may need {required} file descriptors \
+             (max_connections={} plus server connections, listeners and {RESERVED_FDS} reserved), \
+             but RLIMIT_NOFILE is {} (hard {}). Raise the limit (ulimit -n, LimitNOFILE= in the \
+             systemd unit) or lower max_connections or pool sizes",
+            config.general.max_connections, limit.soft, limit.hard,
+        ));
+    }
+    #[cfg(unix)]
+    {
+        crate::web::metrics::system::set_fd_soft_limit(required, limit.hard).map_err(|err| {
+            format!(
+                "configuration may need {required} file descriptors, RLIMIT_NOFILE is {}; \
+                 raising it to {required} failed: {err}",
+                limit.soft
+            )
+        })?;
+        info!(
+            "Raised RLIMIT_NOFILE from {} to {required} (hard limit {})",
+            limit.soft, limit.hard
+        );
+    }
+    Ok(())
+}
+
+/// Percentage of `limit` used by `open` descriptors.
+fn usage_percent(open: u64, limit: u64) -> u64 {
+    if limit == 0 {
+        return 100;
+    }
+    open.saturating_mul(100) / limit
+}
+
+/// Logs a warning when open descriptors cross `fd_usage_warn_percent` of
+/// the soft limit, and a note when usage drops back below it.
+pub fn spawn_fd_usage_monitor() {
+    tokio::task::spawn(async move {
+        let mut ticker = tokio::time::interval(CHECK_INTERVAL);
+        ticker.set_missed_tick_behavior(tokio::time::MissedTickBehavior::Skip);
+        let mut above = false;
+        loop {
+            ticker.tick().await;
+            let threshold = config_arc().general.fd_usage_warn_percent as u64;
+            let (Some(open), Some(limit)) = (get_open_fds(), get_fd_limit()) else {
+                return;
+            };
+            let percent = usage_percent(open, limit.soft);
+            if threshold > 0 && percent >= threshold {
+                if !above {
+                    warn!(
+                        "{open} of {} file descriptors in use ({percent}%, fd_usage_warn_percent={threshold}); \
+                         new connections fail once the limit is reached",
+                        limit.soft
+                    );
+                    above = true;
+                }
+            } else if above {
+                info!(
+                    "File descriptor usage back to {open} of {} ({percent}%)",
+                    limit.soft
+                );
+                above = false;
+            }
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::{Listener, Pool, User};
+
+    fn pool(users: &[u32]) -> Pool {
+        Pool {
+            users: users
+                .iter()
+                .enumerate()
+                .map(|(i, size)| User {
+                    username: format!("user{i}"),
+                    pool_size: *size,
+                    ..Default::default()
+                })
+                .collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn required_fds_counts_clients_servers_and_listeners() {
+        let mut config = Config::default();
+        config.general.max_connections = 1000;
+        config.pools.insert("a".into(), pool(&[10, 20]));
+        let mut capped = pool(&[50, 50]);
+        capped.max_db_connections = Some(30);
+        capped.reserve_pool_size = Some(5);
+        config.pools.insert("b".into(), capped);
+        config.listeners.push(Listener {
+            name: None,
+            host: "127.0.0.1".into(),
+            port: 6433,
+            tls_mode: None,
+            databases: Vec::new(),
+            proxy_protocol: false,
+        });
+
+        assert_eq!(
+            required_fds(&config),
+            1000 + (10 + 20) + (30 + 5) + 2 + RESERVED_FDS
+        );
+    }
+
+    #[test]
+    fn reserve_applies_per_user_without_max_db_connections() {
+        let mut config = Config::default();
+        config.general.max_connections = 0;
+        let mut p = pool(&[10, 10]);
+        p.reserve_pool_size = Some(3);
+        config.pools.insert("a".into(), p);
+
+        assert_eq!(required_fds(&config), 20 + 6 + 1 + RESERVED_FDS);
+    }
+
+    #[test]
+    fn growing_users_count_at_max_pool_size() {
+        let mut config = Config::default();
+        config.general.max_connections = 0;
+        let mut p = pool(&[10, 10]);
+        p.users[0].max_pool_size = Some(40);
+        config.pools.insert("a".into(), p);
+
+        assert_eq!(required_fds(&config), 40 + 10 + 1 + RESERVED_FDS);
+    }
+
+    #[test]
+    fn usage_percent_handles_zero_limit() {
+        assert_eq!(usage_percent(800, 1000), 80);
+        assert_eq!(usage_percent(1, 0), 100);
+    }
+}
@@ -0,0 +1,110 @@
+//! `pg_doorman gen-password`: print the values that go into
+//! `users.password` for a plaintext password, so operators do not need
+//! PostgreSQL or ad-hoc scripts to produce them.
+
+use std::io::{BufRead, IsTerminal, Write};
+
+use md5::{Digest, Md5};
+
+use base64::engine::general_purpose;
+use base64::Engine;
+
+use crate::auth::scram::{build_server_secret, generate_server_secret, parse_server_secret};
+
+/// Stored md5 hash as PostgreSQL writes it: `md5` + hex(md5(password + user)).
+pub fn md5_secret(password: &str, user: &str) -> String {
+    let mut md5 = Md5::new();
+    md5.update(password.as_bytes());
+    md5.update(user.as_bytes());
+    format!("md5{:x}", md5.finalize())
+}
+
+/// Read a password and print its SCRAM-SHA-256 verifier, followed by the
+/// md5 hash when `md5_user` is set. With `salt_from`, the verifier reuses
+/// that verifier's salt and iterations instead of a random salt.
+pub fn run(
+    md5_user: Option<&str>,
+    iterations: u32,
+    salt_from: Option<&str>,
+) -> Result<(), Box<dyn std::error::Error>> {
+    let salt_from = match salt_from {
+        Some(verifier) => {
+            let secret = parse_server_secret(verifier).map_err(|err| err.to_string())?;
+            let salt = general_purpose::STANDARD.decode(&secret.salt_base64)?;
+            Some((salt, secret.iteration as u32))
+        }
+        None => None,
+    };
+
+    let password = if std::io::stdin().is_terminal() {
+        let password = prompt("Password: ")?;
+        if prompt("Repeat password: ")? != password {
+            return Err("passwords do not match".into());
+        }
+        password
+    } else {
+        read_line()?
+    };
+    if password.is_empty() {
+        return Err("empty password".into());
+    }
+
+    match salt_from {
+        Some((salt, iterations)) => {
+            println!("{}", build_server_secret(&password, &salt, iterations))
+        }
+        None => println!("{}", generate_server_secret(&password, iterations)),
+    }
+    if let Some(user) = md5_user {
+        println!("{}", md5_secret(&password, user));
+    }
+    Ok(())
+}
+
+/// One line from stdin without the trailing newline.
+fn read_line() -> std::io::Result<String> {
+    let mut line = String::new();
+    std::io::stdin().lock().read_line(&mut line)?;
+    let len = line.trim_end_matches(['\r', '\n']).len();
+    line.truncate(len);
+    Ok(line)
+}
+
+/// Ask for a password on the terminal with echo turned off.
+fn prompt(message: &str) -> std::io::Result<String> {
+    eprint!("{message}");
+    std::io::stderr().flush()?;
+
+    let fd = libc::STDIN_FILENO;
+    // SAFETY: termios is plain data; tcgetattr/tcsetattr only touch the
+    // struct passed in and the settings of stdin.
+    let mut saved: libc::termios = unsafe { std::mem::zeroed() };
+    if unsafe { libc::tcgetattr(fd, &mut saved) } != 0 {
+        return Err(std::io::Error::last_os_error());
+    }
+    let mut silent = saved;
+    silent.c_lflag &= !libc::ECHO;
+    silent.c_lflag |= libc::ECHONL;
+    if unsafe { libc::tcsetattr(fd, libc::TCSANOW, &silent) } != 0 {
+        return Err(std::io::Error::last_os_error());
+    }
+    let _restore = scopeguard::guard(saved, |saved| unsafe {
+        libc::tcsetattr(fd, libc::TCSANOW, &saved);
+    });
+
+    read_line()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn md5_secret_matches_postgres() {
+        // SELECT 'md5' || md5('pencil' || 'user');
+        assert_eq!(
+            md5_secret("pencil", "user"),
+            "md520c46e3762c864548e296b33c3406aa9"
+        );
+    }
+}
@@ -10,7 +10,7 @@ use std::sync::LazyLock;
 
 use serde::Deserialize;
 
-use crate::config::{Config, ConfigFormat, Pool, PoolMode, User, Web};
+use crate::config::{Config, ConfigFormat, Pool, PoolMode, TargetSessionAttrs, User, Web};
 
 // ---------------------------------------------------------------------------
 // YAML field descriptions — single source of truth
@@ -149,6 +149,7 @@ pub fn generate_reference_config(format: ConfigFormat, russian: bool) -> String
         pool_mode: PoolMode::Transaction,
         server_host: "127.0.0.1".to_string(),
         server_port: 5432,
+        target_session_attrs: TargetSessionAttrs::Any,
         server_database: None,
         connect_timeout: None,
         idle_timeout: None,
@@ -156,6 +157,17 @@ pub fn generate_reference_config(format: ConfigFormat, russian: bool) -> String
         cleanup_server_connections: true,
         log_client_parameter_status_changes: false,
         application_name: None,
+        application_name_template: None,
+        connect_notice: None,
+        client_addr_guc: None,
+        client_tag_limits: std::collections::BTreeMap::new(),
+        application_name_checkout_limits: std::collections::BTreeMap::new(),
+        tag_checkout_limits: std::collections::BTreeMap::new(),
+        statement_deny: Vec::new(),
+        statement_allow: Vec::new(),
+        shards: Vec::new(),
+        driver_compat: None,
+        server_version: None,
         prepared_statements_cache_size: None,
         server_prepared_statements_cache_size: None,
         scaling_warm_pool_ratio: None,
@@ -170,22 +182,47 @@ pub fn generate_reference_config(format: ConfigFormat, russian: bool) -> String
         patroni_api_timeout: None,
         fallback_connect_timeout: None,
         fallback_lifetime: None,
+        patroni_discovery_interval: None,
+        server_host_weights: std::collections::BTreeMap::new(),
+        load_balance_hosts: None,
+        server_connect_attempts: None,
+        server_connect_backoff: None,
+        server_login_retry: None,
+        server_round_robin: None,
+        server_max_memory: None,
+        max_query_time: None,
+        max_query_time_grace: None,
+        statement_timeout: None,
+        lock_timeout: None,
+        idle_in_transaction_session_timeout: None,
+        data_row_flush_threshold: None,
+        copy_data_flush_threshold: None,
         server_tls_mode: None,
+        server_tls_negotiation: None,
         server_tls_ca_cert: None,
         server_tls_certificate: None,
         server_tls_private_key: None,
         auth_query: None,
+        fault_injection: None,
+        rewrite_rules: Vec::new(),
         startup_parameters: std::collections::BTreeMap::new(),
         users: vec![User {
             username: "app_user".to_string(),
             password: "md5dd9a0f26a4302744db881776a09bbfad".to_string(),
             pool_size: 40,
             min_pool_size: None,
+            max_pool_size: None,
             pool_mode: None,
             server_lifetime: None,
             server_username: None,
             server_password: None,
             auth_pam_service: None,
+            read_only: false,
+            max_query_time: None,
+            next_password: None,
+            server_vault_path: None,
+            server_rds_iam: false,
+            priority: None,
         }],
     };
 
@@ -205,6 +242,9 @@ pub fn generate_annotated_config(config: &Config, format: ConfigFormat, russian:
     write_general_section(&mut w, config);
     write_web_section(&mut w, &config.web);
     write_talos_section(&mut w);
+    write_vault_section(&mut w);
+    write_acme_section(&mut w);
+    write_listeners_section(&mut w);
     write_pools_section(&mut w, config);
 
     w.output
@@ -508,6 +548,36 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         "5000 ms",
     );
 
+    write_field_desc(w, fi, "general", "client_login_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "client_login_timeout",
+        g.client_login_timeout.as_millis(),
+        "60s",
+        "60000 ms",
+    );
+
+    write_field_desc(w, fi, "general", "client_idle_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "client_idle_timeout",
+        g.client_idle_timeout.as_millis(),
+        "0ms",
+        "disabled",
+    );
+
+    write_field_desc(w, fi, "general", "client_write_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "client_write_timeout",
+        g.client_write_timeout.as_millis(),
+        "0ms",
+        "disabled",
+    );
+
     write_field_desc(w, fi, "general", "idle_timeout");
     write_duration_value(
         w,
@@ -546,6 +616,32 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_desc(w, fi, "general", "autodb_idle_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "autodb_idle_timeout",
+        g.autodb_idle_timeout.as_millis(),
+        "1h",
+        "",
+    );
+
+    write_field_desc(w, fi, "general", "autodb_max_pools");
+    w.kv(fi, "autodb_max_pools", &w.num_val(g.autodb_max_pools));
+    w.blank();
+
+    write_field_desc(w, fi, "general", "autodb_create_rate");
+    w.kv(fi, "autodb_create_rate", &w.num_val(g.autodb_create_rate));
+    w.blank();
+
+    write_field_desc(w, fi, "general", "managed_pools_file");
+    w.commented_kv(
+        fi,
+        "managed_pools_file",
+        &w.str_val("/etc/pg_doorman/managed_pools.toml"),
+    );
+    w.blank();
+
     write_field_desc(w, fi, "general", "server_idle_check_timeout");
     write_duration_value(
         w,
@@ -556,6 +652,100 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         "",
     );
 
+    write_field_desc(w, fi, "general", "dns_refresh_interval");
+    write_duration_value(
+        w,
+        fi,
+        "dns_refresh_interval",
+        g.dns_refresh_interval.as_millis(),
+        "0ms",
+        "disabled",
+    );
+
+    write_field_desc(w, fi, "general", "server_role_check_interval");
+    write_duration_value(
+        w,
+        fi,
+        "server_role_check_interval",
+        g.server_role_check_interval.as_millis(),
+        "0ms",
+        "disabled",
+    );
+
+    write_field_desc(w, fi, "general", "server_memory_check_interval");
+    write_duration_value(
+        w,
+        fi,
+        "server_memory_check_interval",
+        g.server_memory_check_interval.as_millis(),
+        "5m",
+        "",
+    );
+
+    write_field_comment(w, fi, "general", "server_recycle_windows");
+    if g.server_recycle_windows.is_empty() {
+        w.commented_kv(fi, "server_recycle_windows", "[\"Sun 03:00-05:00\"]");
+    } else {
+        let rendered = g
+            .server_recycle_windows
+            .iter()
+            .map(|s| format!("\"{}\"", s))
+            .collect::<Vec<_>>()
+            .join(", ");
+        w.kv(fi, "server_recycle_windows", &format!("[{rendered}]"));
+    }
+    w.blank();
+
+    write_field_comment(w, fi, "general", "server_recycle_rate");
+    w.kv(fi, "server_recycle_rate", &w.num_val(g.server_recycle_rate));
+    w.blank();
+
+    write_field_comment(w, fi, "general", "circuit_breaker_threshold");
+    w.kv(
+        fi,
+        "circuit_breaker_threshold",
+        &w.num_val(g.circuit_breaker_threshold),
+    );
+    w.blank();
+
+    write_field_desc(w, fi, "general", "circuit_breaker_cooldown");
+    write_duration_value(
+        w,
+        fi,
+        "circuit_breaker_cooldown",
+        g.circuit_breaker_cooldown.as_millis(),
+        "10s",
+        "10000 ms",
+    );
+
+    write_field_comment(w, fi, "general", "server_checkout_retries");
+    w.kv(
+        fi,
+        "server_checkout_retries",
+        &w.num_val(g.server_checkout_retries),
+    );
+    w.blank();
+
+    write_field_desc(w, fi, "general", "client_pool_parameter");
+    w.commented_kv(fi, "client_pool_parameter", &w.str_val("doorman.pool"));
+    w.blank();
+
+    write_field_desc(w, fi, "general", "connect_notice");
+    if let Some(ref notice) = g.connect_notice {
+        w.kv(fi, "connect_notice", &w.str_val(notice));
+    } else {
+        w.commented_kv(
+            fi,
+            "connect_notice",
+            &w.str_val("connected via pg_doorman {version}, pool {database}, {pool_mode} mode"),
+        );
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "general", "client_tag_parameter");
+    w.commented_kv(fi, "client_tag_parameter", &w.str_val("doorman.tag"));
+    w.blank();
+
     write_field_desc(w, fi, "general", "shutdown_timeout");
     write_duration_value(
         w,
@@ -566,6 +756,16 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         "10000 ms",
     );
 
+    write_field_desc(w, fi, "general", "hold_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "hold_timeout",
+        g.hold_timeout.as_millis(),
+        "30s",
+        "30000 ms",
+    );
+
     write_field_desc(w, fi, "general", "proxy_copy_data_timeout");
     write_duration_value(
         w,
@@ -609,6 +809,39 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "tcp_user_timeout", &w.num_val(g.tcp_user_timeout));
     w.blank();
 
+    write_field_desc(w, fi, "general", "server_tcp_keepalives_idle");
+    w.comment(
+        fi,
+        w.t(
+            "Default: not set (client-side values)",
+            "По умолчанию: не заданы (значения для клиентов)",
+        ),
+    );
+    for (key, val, example) in [
+        (
+            "server_tcp_keepalives_idle",
+            g.server_tcp_keepalives_idle,
+            60,
+        ),
+        (
+            "server_tcp_keepalives_interval",
+            g.server_tcp_keepalives_interval,
+            10,
+        ),
+        (
+            "server_tcp_keepalives_count",
+            g.server_tcp_keepalives_count.map(u64::from),
+            6,
+        ),
+        ("server_tcp_user_timeout", g.server_tcp_user_timeout, 120),
+    ] {
+        match val {
+            Some(val) => w.kv(fi, key, &w.num_val(val)),
+            None => w.commented_kv(fi, key, &example.to_string()),
+        }
+    }
+    w.blank();
+
     write_field_desc(w, fi, "general", "tcp_socket_buffer_size");
     write_byte_size_value(
         w,
@@ -649,6 +882,98 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "max_connections", &w.num_val(g.max_connections));
     w.blank();
 
+    write_field_comment(w, fi, "general", "max_connections_soft");
+    w.kv(
+        fi,
+        "max_connections_soft",
+        &w.num_val(g.max_connections_soft),
+    );
+    w.blank();
+
+    write_field_comment(w, fi, "general", "max_client_handshakes");
+    w.kv(
+        fi,
+        "max_client_handshakes",
+        &w.num_val(g.max_client_handshakes),
+    );
+    w.blank();
+
+    write_field_comment(w, fi, "general", "max_concurrent_logins");
+    w.kv(
+        fi,
+        "max_concurrent_logins",
+        &w.num_val(g.max_concurrent_logins),
+    );
+    w.blank();
+
+    write_field_comment(w, fi, "general", "max_login_queue");
+    w.kv(fi, "max_login_queue", &w.num_val(g.max_login_queue));
+    w.blank();
+
+    write_field_comment(w, fi, "general", "auth_ban_threshold");
+    w.kv(fi, "auth_ban_threshold", &w.num_val(g.auth_ban_threshold));
+    w.blank();
+
+    write_field_desc(w, fi, "general", "auth_ban_window");
+    write_duration_value(
+        w,
+        fi,
+        "auth_ban_window",
+        g.auth_ban_window.as_millis(),
+        "60s",
+        "60000 ms",
+    );
+
+    write_field_desc(w, fi, "general", "auth_ban_time");
+    write_duration_value(
+        w,
+        fi,
+        "auth_ban_time",
+        g.auth_ban_time.as_millis(),
+        "60s",
+        "60000 ms",
+    );
+
+    write_field_desc(w, fi, "general", "auth_ban_max_time");
+    write_duration_value(
+        w,
+        fi,
+        "auth_ban_max_time",
+        g.auth_ban_max_time.as_millis(),
+        "1h",
+        "",
+    );
+
+    write_field_comment(w, fi, "general", "trusted_upstream_poolers");
+    if g.trusted_upstream_poolers.is_empty() {
+        w.commented_kv(fi, "trusted_upstream_poolers", "[\"10.0.0.0/24\"]");
+    } else {
+        let rendered = g
+            .trusted_upstream_poolers
+            .iter()
+            .map(|s| format!("\"{}\"", s))
+            .collect::<Vec<_>>()
+            .join(", ");
+        w.kv(fi, "trusted_upstream_poolers", &format!("[{rendered}]"));
+    }
+    w.blank();
+
+    write_field_comment(w, fi, "general", "client_identity_parameter");
+    w.kv(
+        fi,
+        "client_identity_parameter",
+        &w.str_val(&g.client_identity_parameter),
+    );
+    w.blank();
+
+    write_field_comment(w, fi, "general", "fd_usage_warn_percent");
+    w.kv(
+        fi,
+        "fd_usage_warn_percent",
+        &w.num_val(g.fd_usage_warn_percent),
+    );
+    w.blank();
+
     write_field_comment(w, fi, "general", "max_concurrent_creates");
     w.kv(
         fi,
@@ -667,6 +992,20 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         "268435456 bytes",
     );
 
+    write_field_desc(w, fi, "general", "max_client_message_size");
+    write_byte_size_value(
+        w,
+        fi,
+        "max_client_message_size",
+        g.max_client_message_size.as_bytes(),
+        "256MB",
+        "268435456 bytes",
+    );
+
+    write_field_comment(w, fi, "general", "max_pipeline_depth");
+    w.kv(fi, "max_pipeline_depth", &w.num_val(g.max_pipeline_depth));
+    w.blank();
+
     // --- Connection Scaling ---
     w.separator(fi, f.section_title("scaling").get(w.russian));
     w.blank();
@@ -693,6 +1032,27 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         "scaling_max_parallel_creates",
         &w.num_val(g.scaling_max_parallel_creates),
     );
+    w.blank();
+
+    write_field_desc(w, fi, "general", "adaptive_pool_wait_target");
+    write_duration_value(
+        w,
+        fi,
+        "adaptive_pool_wait_target",
+        g.adaptive_pool_wait_target.as_millis(),
+        "50ms",
+        "50 ms",
+    );
+
+    write_field_desc(w, fi, "general", "adaptive_pool_interval");
+    write_duration_value(
+        w,
+        fi,
+        "adaptive_pool_interval",
+        g.adaptive_pool_interval.as_millis(),
+        "10s",
+        "10000 ms",
+    );
 
     // --- Logging ---
     w.separator(fi, f.section_title("logging").get(w.russian));
@@ -714,6 +1074,14 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_comment(w, fi, "general", "log_connection_events");
+    w.kv(
+        fi,
+        "log_connection_events",
+        &w.bool_val(g.log_connection_events),
+    );
+    w.blank();
+
     write_field_comment(w, fi, "general", "syslog_prog_name");
     if let Some(ref name) = g.syslog_prog_name {
         w.kv(fi, "syslog_prog_name", &w.str_val(name));
@@ -722,6 +1090,14 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     }
     w.blank();
 
+    write_field_comment(w, fi, "general", "audit_log");
+    if let Some(ref path) = g.audit_log {
+        w.kv(fi, "audit_log", &w.str_val(path));
+    } else {
+        w.commented_kv(fi, "audit_log", &w.str_val("/var/log/pg_doorman/audit.log"));
+    }
+    w.blank();
+
     // --- Worker Settings ---
     w.separator(fi, f.section_title("workers").get(w.russian));
     w.blank();
@@ -738,6 +1114,28 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_desc(w, fi, "general", "stall_watchdog_timeout");
+    write_duration_value(
+        w,
+        fi,
+        "stall_watchdog_timeout",
+        g.stall_watchdog_timeout.as_millis(),
+        "0ms",
+        "disabled",
+    );
+
+    write_field_comment(w, fi, "general", "state_dump_dir");
+    w.kv(fi, "state_dump_dir", &w.str_val(&g.state_dump_dir));
+    w.blank();
+
+    write_field_comment(w, fi, "general", "enable_fault_injection");
+    w.kv(
+        fi,
+        "enable_fault_injection",
+        &w.bool_val(g.enable_fault_injection),
+    );
+    w.blank();
+
     // Tokio runtime settings note
     write_field_desc(w, fi, "general", "tokio_settings_note");
     w.blank();
@@ -841,6 +1239,14 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "server_round_robin", &w.bool_val(g.server_round_robin));
     w.blank();
 
+    write_field_comment(w, fi, "general", "server_max_protocol_version");
+    w.kv(
+        fi,
+        "server_max_protocol_version",
+        &w.str_val(&g.server_max_protocol_version),
+    );
+    w.blank();
+
     write_field_comment(w, fi, "general", "sync_server_parameters");
     w.kv(
         fi,
@@ -849,6 +1255,22 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_comment(w, fi, "general", "auto_session_pinning");
+    w.kv(
+        fi,
+        "auto_session_pinning",
+        &w.bool_val(g.auto_session_pinning),
+    );
+    w.blank();
+
+    write_field_comment(w, fi, "general", "two_phase_commit");
+    w.kv(
+        fi,
+        "two_phase_commit",
+        &w.str_val(&g.two_phase_commit.to_string()),
+    );
+    w.blank();
+
     write_field_desc(w, fi, "general", "message_size_to_be_stream");
     write_byte_size_value(
         w,
@@ -863,6 +1285,16 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "pooler_check_query", &w.str_val(&g.pooler_check_query));
     w.blank();
 
+    write_field_comment(w, fi, "general", "show_local_parameters");
+    let rendered = g
+        .show_local_parameters
+        .iter()
+        .map(|s| format!("\"{}\"", s))
+        .collect::<Vec<_>>()
+        .join(", ");
+    w.kv(fi, "show_local_parameters", &format!("[{rendered}]"));
+    w.blank();
+
     // --- Prepared Statements ---
     w.separator(fi, f.section_title("prepared").get(w.russian));
     w.blank();
@@ -915,6 +1347,14 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_comment(w, fi, "general", "query_interner_anon_max_entries");
+    w.kv(
+        fi,
+        "query_interner_anon_max_entries",
+        &w.num_val(g.query_interner_anon_max_entries),
+    );
+    w.blank();
+
     // --- Admin Console ---
     w.separator(fi, f.section_title("admin").get(w.russian));
     w.blank();
@@ -927,6 +1367,20 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "admin_password", &w.str_val(&g.admin_password));
     w.blank();
 
+    write_field_comment(w, fi, "general", "stats_users");
+    if g.stats_users.is_empty() {
+        w.commented_kv(fi, "stats_users", "[\"monitoring\"]");
+    } else {
+        let rendered = g
+            .stats_users
+            .iter()
+            .map(|s| format!("\"{}\"", s))
+            .collect::<Vec<_>>()
+            .join(", ");
+        w.kv(fi, "stats_users", &format!("[{rendered}]"));
+    }
+    w.blank();
+
     // --- TLS Settings (Client-facing) ---
     w.separator(fi, f.section_title("tls_client").get(w.russian));
     w.blank();
@@ -971,6 +1425,58 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     );
     w.blank();
 
+    write_field_desc(w, fi, "general", "tls_min_version");
+    if let Some(ref value) = g.tls_min_version {
+        w.kv(fi, "tls_min_version", &w.str_val(value));
+    } else {
+        w.commented_kv(fi, "tls_min_version", "\"1.3\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "general", "tls_max_version");
+    if let Some(ref value) = g.tls_max_version {
+        w.kv(fi, "tls_max_version", &w.str_val(value));
+    } else {
+        w.commented_kv(fi, "tls_max_version", "\"1.3\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "general", "tls_ciphers");
+    if let Some(ref value) = g.tls_ciphers {
+        w.kv(fi, "tls_ciphers", &w.str_val(value));
+    } else {
+        w.commented_kv(fi, "tls_ciphers", "\"ECDHE+AESGCM:ECDHE+CHACHA20\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "general", "tls_ciphersuites");
+    if let Some(ref value) = g.tls_ciphersuites {
+        w.kv(fi, "tls_ciphersuites", &w.str_val(value));
+    } else {
+        w.commented_kv(
+            fi,
+            "tls_ciphersuites",
+            "\"TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256\"",
+        );
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "general", "tls_groups");
+    if let Some(ref value) = g.tls_groups {
+        w.kv(fi, "tls_groups", &w.str_val(value));
+    } else {
+        w.commented_kv(fi, "tls_groups", "\"X25519:P-256\"");
+    }
+    w.blank();
+
+    write_field_comment(w, fi, "general", "plain_auth_require_tls");
+    w.kv(
+        fi,
+        "plain_auth_require_tls",
+        &w.bool_val(g.plain_auth_require_tls),
+    );
+    w.blank();
+
     // --- TLS Settings (Server-facing) ---
     w.separator(fi, f.section_title("tls_server").get(w.russian));
     w.blank();
@@ -979,6 +1485,14 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
     w.kv(fi, "server_tls_mode", &w.str_val(&g.server_tls_mode));
     w.blank();
 
+    write_field_comment(w, fi, "general", "server_tls_negotiation");
+    w.kv(
+        fi,
+        "server_tls_negotiation",
+        &w.str_val(&g.server_tls_negotiation),
+    );
+    w.blank();
+
     write_field_comment(w, fi, "general", "server_tls_ca_cert");
     if let Some(v) = &g.server_tls_ca_cert {
         w.kv(fi, "server_tls_ca_cert", &w.str_val(v));
@@ -1058,6 +1572,16 @@ fn write_general_section(w: &mut ConfigWriter, config: &Config) {
         }
     }
     w.blank();
+
+    write_field_comment(w, fi, "general", "features");
+    match w.format {
+        ConfigFormat::Toml => w.comment(fi, "features = { direct_tls = false }"),
+        ConfigFormat::Yaml => {
+            w.comment(fi, "features:");
+            w.comment(fi, "  direct_tls: false");
+        }
+    }
+    w.blank();
 }
 
 fn write_pg_hba_examples(w: &mut ConfigWriter, fi: usize) {
@@ -1291,6 +1815,84 @@ fn write_talos_section(w: &mut ConfigWriter) {
     w.blank();
 }
 
+fn write_vault_section(w: &mut ConfigWriter) {
+    let f = &*FIELDS;
+    w.major_separator(f.text("vault_title").get(w.russian));
+    w.comment(0, f.text("vault_desc").get(w.russian));
+    let (section, prefix, sep) = match w.format {
+        ConfigFormat::Toml => ("[vault]", "", " = "),
+        ConfigFormat::Yaml => ("vault:", "  ", ": "),
+    };
+    w.comment(0, section);
+    for (key, value) in [
+        ("addr", "\"https://vault.example.com:8200\""),
+        ("token_file", "\"/etc/pg_doorman/vault-token\""),
+        ("ca_file", "\"/etc/pg_doorman/vault-ca.pem\""),
+        ("request_timeout", "\"5s\""),
+    ] {
+        let text = f.text(&format!("vault_{key}")).get(w.russian);
+        w.comment(0, &format!("{prefix}# {text}"));
+        w.comment(0, &format!("{prefix}{key}{sep}{value}"));
+    }
+    w.blank();
+}
+
+fn write_acme_section(w: &mut ConfigWriter) {
+    let f = &*FIELDS;
+    w.major_separator(f.text("acme_title").get(w.russian));
+    w.comment(0, f.text("acme_desc").get(w.russian));
+    let (section, prefix, sep) = match w.format {
+        ConfigFormat::Toml => ("[acme]", "", " = "),
+        ConfigFormat::Yaml => ("acme:", "  ", ": "),
+    };
+    w.comment(0, section);
+    for (key, value) in [
+        ("domains", "[\"db.example.com\"]"),
+        (
+            "directory_url",
+            "\"https://acme-v02.api.letsencrypt.org/directory\"",
+        ),
+        ("contact", "[\"mailto:dba@example.com\"]"),
+        ("account_key", "\"/etc/pg_doorman/acme-account.pem\""),
+        ("http_listen", "\"0.0.0.0:80\""),
+        ("renew_before", "\"30d\""),
+        ("ca_file", "\"/etc/pg_doorman/acme-ca.pem\""),
+    ] {
+        let text = f.text(&format!("acme_{key}")).get(w.russian);
+        w.comment(0, &format!("{prefix}# {text}"));
+        w.comment(0, &format!("{prefix}{key}{sep}{value}"));
+    }
+    w.blank();
+}
+
+fn write_listeners_section(w: &mut ConfigWriter) {
+    let f = &*FIELDS;
+    w.major_separator(f.text("listeners_title").get(w.russian));
+    w.comment(0, f.text("listeners_desc").get(w.russian));
+    let (section, first, prefix, sep) = match w.format {
+        ConfigFormat::Toml => ("[[listeners]]", "", "", " = "),
+        ConfigFormat::Yaml => ("listeners:", "  - ", "    ", ": "),
+    };
+    w.comment(0, section);
+    for (i, (key, value)) in [
+        ("name", "\"lb\""),
+        ("host", "\"10.0.0.5\""),
+        ("port", "6433"),
+        ("tls_mode", "\"disable\""),
+        ("databases", "[\"app\"]"),
+        ("proxy_protocol", "true"),
+    ]
+    .into_iter()
+    .enumerate()
+    {
+        let text = f.text(&format!("listeners_{key}")).get(w.russian);
+        w.comment(0, &format!("{prefix}# {text}"));
+        let lead = if i == 0 { first } else { prefix };
+        w.comment(0, &format!("{lead}{key}{sep}{value}"));
+    }
+    w.blank();
+}
+
 fn write_pools_section(w: &mut ConfigWriter, config: &Config) {
     let f = &*FIELDS;
     w.major_separator(f.text("pools_title").get(w.russian));
@@ -1337,6 +1939,39 @@ fn write_single_pool(w: &mut ConfigWriter, pool_name: &str, pool: &Pool) {
     w.kv(fi, "server_port", &w.num_val(pool.server_port));
     w.blank();
 
+    write_field_comment(w, fi, "pool", "target_session_attrs");
+    if pool.target_session_attrs != TargetSessionAttrs::Any {
+        w.kv(
+            fi,
+            "target_session_attrs",
+            &w.str_val(&pool.target_session_attrs.to_string()),
+        );
+    } else {
+        w.commented_kv(fi, "target_session_attrs", "\"primary\"");
+    }
+    w.blank();
+
+    write_field_comment(w, fi, "pool", "server_host_weights");
+    match w.format {
+        ConfigFormat::Toml => {
+            w.comment(fi, "server_host_weights = { \"pg1\" = 3, \"pg2\" = 1 }");
+        }
+        ConfigFormat::Yaml => {
+            w.comment(fi, "server_host_weights:");
+            w.comment(fi, "  pg1: 3");
+            w.comment(fi, "  pg2: 1");
+        }
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "load_balance_hosts");
+    if let Some(policy) = pool.load_balance_hosts {
+        w.kv(fi, "load_balance_hosts", &w.str_val(&policy.to_string()));
+    } else {
+        w.commented_kv(fi, "load_balance_hosts", "\"least_connections\"");
+    }
+    w.blank();
+
     write_field_desc(w, fi, "pool", "server_database");
     if let Some(ref db) = pool.server_database {
         w.kv(fi, "server_database", &w.str_val(db));
@@ -1377,6 +2012,102 @@ fn write_single_pool(w: &mut ConfigWriter, pool_name: &str, pool: &Pool) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "pool", "server_max_memory");
+    if let Some(val) = pool.server_max_memory {
+        w.kv(fi, "server_max_memory", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "server_max_memory", "\"256MB\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "max_query_time");
+    if let Some(val) = pool.max_query_time {
+        w.kv(fi, "max_query_time", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "max_query_time", "\"1h\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "max_query_time_grace");
+    if let Some(val) = pool.max_query_time_grace {
+        w.kv(fi, "max_query_time_grace", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "max_query_time_grace", "\"10s\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "statement_timeout");
+    if let Some(val) = pool.statement_timeout {
+        w.kv(fi, "statement_timeout", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "statement_timeout", "\"30s\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "lock_timeout");
+    if let Some(val) = pool.lock_timeout {
+        w.kv(fi, "lock_timeout", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "lock_timeout", "\"5s\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "idle_in_transaction_session_timeout");
+    if let Some(val) = pool.idle_in_transaction_session_timeout {
+        w.kv(fi, "idle_in_transaction_session_timeout", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "idle_in_transaction_session_timeout", "\"60s\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "server_connect_attempts");
+    if let Some(val) = pool.server_connect_attempts {
+        w.kv(fi, "server_connect_attempts", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "server_connect_attempts", "3");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "server_connect_backoff");
+    if let Some(val) = pool.server_connect_backoff {
+        w.kv(fi, "server_connect_backoff", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "server_connect_backoff", "\"100ms\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "server_login_retry");
+    if let Some(val) = pool.server_login_retry {
+        w.kv(fi, "server_login_retry", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "server_login_retry", "\"15s\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "server_round_robin");
+    if let Some(val) = pool.server_round_robin {
+        w.kv(fi, "server_round_robin", &w.bool_val(val));
+    } else {
+        w.commented_kv(fi, "server_round_robin", "true");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "data_row_flush_threshold");
+    if let Some(val) = pool.data_row_flush_threshold {
+        w.kv(fi, "data_row_flush_threshold", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "data_row_flush_threshold", "0");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "copy_data_flush_threshold");
+    if let Some(val) = pool.copy_data_flush_threshold {
+        w.kv(fi, "copy_data_flush_threshold", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "copy_data_flush_threshold", "\"256KB\"");
+    }
+    w.blank();
+
     write_field_comment(w, fi, "pool", "cleanup_server_connections");
     w.kv(
         fi,
@@ -1502,6 +2233,14 @@ fn write_single_pool(w: &mut ConfigWriter, pool_name: &str, pool: &Pool) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "pool", "patroni_discovery_interval");
+    if let Some(val) = pool.patroni_discovery_interval {
+        w.kv(fi, "patroni_discovery_interval", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "patroni_discovery_interval", "\"5s\"");
+    }
+    w.blank();
+
     // --- Application Settings ---
     w.separator(fi, f.section_title("pool_app").get(w.russian));
     w.blank();
@@ -1514,6 +2253,123 @@ fn write_single_pool(w: &mut ConfigWriter, pool_name: &str, pool: &Pool) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "pool", "application_name_template");
+    if let Some(ref template) = pool.application_name_template {
+        w.kv(fi, "application_name_template", &w.str_val(template));
+    } else {
+        w.commented_kv(
+            fi,
+            "application_name_template",
+            "\"{client_app}@{client_ip}:{client_port}\"",
+        );
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "connect_notice");
+    if let Some(ref notice) = pool.connect_notice {
+        w.kv(fi, "connect_notice", &w.str_val(notice));
+    } else {
+        w.commented_kv(
+            fi,
+            "connect_notice",
+            "\"pool {database} (read-only replica)\"",
+        );
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "client_addr_guc");
+    if let Some(ref guc) = pool.client_addr_guc {
+        w.kv(fi, "client_addr_guc", &w.str_val(guc));
+    } else {
+        w.commented_kv(fi, "client_addr_guc", "\"doorman.client_addr\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "client_tag_limits");
+    match w.format {
+        ConfigFormat::Toml => {
+            w.comment(fi, "client_tag_limits = { \"batch\" = 10, \"web\" = 0 }");
+        }
+        ConfigFormat::Yaml => {
+            w.comment(fi, "client_tag_limits:");
+            w.comment(fi, "  batch: 10");
+            w.comment(fi, "  web: 0");
+        }
+    }
+    w.blank();
+
+    for (key, name, limit) in [
+        ("application_name_checkout_limits", "reporting", 3),
+        ("tag_checkout_limits", "batch", 2),
+    ] {
+        write_field_desc(w, fi, "pool", key);
+        match w.format {
+            ConfigFormat::Toml => {
+                w.comment(fi, &format!("{key} = {{ \"{name}\" = {limit} }}"));
+            }
+            ConfigFormat::Yaml => {
+                w.comment(fi, &format!("{key}:"));
+                w.comment(fi, &format!("  {name}: {limit}"));
+            }
+        }
+        w.blank();
+    }
+
+    for (key, rules, example) in [
+        (
+            "statement_deny",
+            &pool.statement_deny,
+            "[\"DROP DATABASE\", \"TRUNCATE\", \"COPY ... TO PROGRAM\"]",
+        ),
+        (
+            "statement_allow",
+            &pool.statement_allow,
+            "[\"DROP TABLE ... tmp_report\"]",
+        ),
+    ] {
+        write_field_desc(w, fi, "pool", key);
+        if rules.is_empty() {
+            w.commented_kv(fi, key, example);
+        } else {
+            let rendered = rules
+                .iter()
+                .map(|s| format!("\"{}\"", s))
+                .collect::<Vec<_>>()
+                .join(", ");
+            w.kv(fi, key, &format!("[{rendered}]"));
+        }
+        w.blank();
+    }
+
+    write_field_desc(w, fi, "pool", "shards");
+    if pool.shards.is_empty() {
+        w.commented_kv(fi, "shards", "[\"app_s0\", \"app_s1\"]");
+    } else {
+        let rendered = pool
+            .shards
+            .iter()
+            .map(|s| format!("\"{}\"", s))
+            .collect::<Vec<_>>()
+            .join(", ");
+        w.kv(fi, "shards", &format!("[{rendered}]"));
+    }
+    w.blank();
+
+    if let Some(profile) = pool.driver_compat {
+        w.kv(fi, "driver_compat", &w.str_val(&profile.to_string()));
+    } else {
+        w.commented_kv(fi, "driver_compat", "\"jdbc\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "pool", "server_version");
+    if let Some(version) = &pool.server_version {
+        w.kv(fi, "server_version", &w.str_val(version));
+    } else {
+        w.commented_kv(fi, "server_version", "\"16.4\"");
+    }
+    w.blank();
+
     write_field_comment(w, fi, "pool", "log_client_parameter_status_changes");
     w.kv(
         fi,
@@ -1538,6 +2394,41 @@ fn write_single_pool(w: &mut ConfigWriter, pool_name: &str, pool: &Pool) {
     }
     w.blank();
 
+    write_field_comment(w, fi, "pool", "fault_injection");
+    match w.format {
+        ConfigFormat::Toml => {
+            w.comment(
+                fi,
+                "fault_injection = { latency = \"50ms\", disconnect_probability = 0.01 }",
+            );
+        }
+        ConfigFormat::Yaml => {
+            w.comment(fi, "fault_injection:");
+            w.comment(fi, "  latency: \"50ms\"");
+            w.comment(fi, "  disconnect_probability: 0.01");
+        }
+    }
+    w.blank();
+
+    write_field_comment(w, fi, "pool", "rewrite_rules");
+    match w.format {
+        ConfigFormat::Toml => {
+            w.comment(
+                fi,
+                "rewrite_rules = [{ match = \"SELECT\", unless = \"LIMIT\", users = [\"report\"], \
+                 append = \"LIMIT 1000\" }]",
+            );
+        }
+        ConfigFormat::Yaml => {
+            w.comment(fi, "rewrite_rules:");
+            w.comment(fi, "  - match: \"SELECT\"");
+            w.comment(fi, "    unless: \"LIMIT\"");
+            w.comment(fi, "    users: [\"report\"]");
+            w.comment(fi, "    append: \"LIMIT 1000\"");
+        }
+    }
+    w.blank();
+
     write_pool_users(w, pool_name, &pool.users);
     write_auth_query_commented_example(w);
 }
@@ -1589,6 +2480,14 @@ fn write_user_fields_toml(w: &mut ConfigWriter, user: &User, fi: usize) {
     w.kv(fi, "password", &w.str_val(&user.password));
     w.blank();
 
+    write_field_desc(w, fi, "user", "next_password");
+    if let Some(ref next) = user.next_password {
+        w.kv(fi, "next_password", &w.str_val(next));
+    } else {
+        w.commented_kv(fi, "next_password", "\"md5...\"");
+    }
+    w.blank();
+
     write_field_comment(w, fi, "user", "pool_size");
     w.kv(fi, "pool_size", &w.num_val(user.pool_size));
     w.blank();
@@ -1601,6 +2500,14 @@ fn write_user_fields_toml(w: &mut ConfigWriter, user: &User, fi: usize) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "user", "max_pool_size");
+    if let Some(val) = user.max_pool_size {
+        w.kv(fi, "max_pool_size", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "max_pool_size", "80");
+    }
+    w.blank();
+
     write_field_desc(w, fi, "user", "pool_mode");
     if let Some(ref mode) = user.pool_mode {
         w.kv(fi, "pool_mode", &w.str_val(&mode.to_string()));
@@ -1617,6 +2524,14 @@ fn write_user_fields_toml(w: &mut ConfigWriter, user: &User, fi: usize) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "user", "priority");
+    if let Some(val) = user.priority {
+        w.kv(fi, "priority", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "priority", "10");
+    }
+    w.blank();
+
     // IMPORTANT: server_username/server_password with prominent docs
     write_server_credentials_comment(w, fi);
     if let Some(ref su) = user.server_username {
@@ -1631,12 +2546,44 @@ fn write_user_fields_toml(w: &mut ConfigWriter, user: &User, fi: usize) {
     }
     w.blank();
 
+    write_field_desc(w, fi, "user", "server_vault_path");
+    if let Some(ref path) = user.server_vault_path {
+        w.kv(fi, "server_vault_path", &w.str_val(path));
+    } else {
+        w.commented_kv(fi, "server_vault_path", "\"database/creds/app\"");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "user", "server_rds_iam");
+    if user.server_rds_iam {
+        w.kv(fi, "server_rds_iam", "true");
+    } else {
+        w.commented_kv(fi, "server_rds_iam", "true");
+    }
+    w.blank();
+
     write_field_desc(w, fi, "user", "auth_pam_service");
     if let Some(ref pam) = user.auth_pam_service {
         w.kv(fi, "auth_pam_service", &w.str_val(pam));
     } else {
         w.commented_kv(fi, "auth_pam_service", "\"pg_doorman\"");
     }
+    w.blank();
+
+    write_field_desc(w, fi, "user", "read_only");
+    if user.read_only {
+        w.kv(fi, "read_only", "true");
+    } else {
+        w.commented_kv(fi, "read_only", "true");
+    }
+    w.blank();
+
+    write_field_desc(w, fi, "user", "max_query_time");
+    if let Some(val) = user.max_query_time {
+        w.kv(fi, "max_query_time", &w.num_val(val));
+    } else {
+        w.commented_kv(fi, "max_query_time", "\"15m\"");
+    }
 }
 
 fn write_user_fields_yaml(w: &mut ConfigWriter, user: &User) {
@@ -1659,6 +2606,14 @@ fn write_user_fields_yaml(w: &mut ConfigWriter, user: &User) {
     let _ = writeln!(w.output, "{indent}  password: \"{}\"", user.password);
     w.blank();
 
+    write_field_desc(w, 3, "user", "next_password");
+    if let Some(ref next) = user.next_password {
+        let _ = writeln!(w.output, "{indent}  next_password: \"{next}\"");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # next_password: \"md5...\"");
+    }
+    w.blank();
+
     write_field_comment(w, 3, "user", "pool_size");
     let _ = writeln!(w.output, "{indent}  pool_size: {}", user.pool_size);
     w.blank();
@@ -1671,6 +2626,14 @@ fn write_user_fields_yaml(w: &mut ConfigWriter, user: &User) {
     }
     w.blank();
 
+    write_field_desc(w, 3, "user", "max_pool_size");
+    if let Some(val) = user.max_pool_size {
+        let _ = writeln!(w.output, "{indent}  max_pool_size: {val}");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # max_pool_size: 80");
+    }
+    w.blank();
+
     write_field_desc(w, 3, "user", "pool_mode");
     if let Some(ref mode) = user.pool_mode {
         let _ = writeln!(w.output, "{indent}  pool_mode: \"{mode}\"");
@@ -1687,6 +2650,14 @@ fn write_user_fields_yaml(w: &mut ConfigWriter, user: &User) {
     }
     w.blank();
 
+    write_field_desc(w, 3, "user", "priority");
+    if let Some(val) = user.priority {
+        let _ = writeln!(w.output, "{indent}  priority: {val}");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # priority: 10");
+    }
+    w.blank();
+
     // IMPORTANT: server_username/server_password
     write_server_credentials_comment(w, 3);
     if let Some(ref su) = user.server_username {
@@ -1704,12 +2675,47 @@ fn write_user_fields_yaml(w: &mut ConfigWriter, user: &User) {
     }
     w.blank();
 
+    write_field_desc(w, 3, "user", "server_vault_path");
+    if let Some(ref path) = user.server_vault_path {
+        let _ = writeln!(w.output, "{indent}  server_vault_path: \"{path}\"");
+    } else {
+        let _ = writeln!(
+            w.output,
+            "{indent}  # server_vault_path: \"database/creds/app\""
+        );
+    }
+    w.blank();
+
+    write_field_desc(w, 3, "user", "server_rds_iam");
+    if user.server_rds_iam {
+        let _ = writeln!(w.output, "{indent}  server_rds_iam: true");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # server_rds_iam: true");
+    }
+    w.blank();
+
     write_field_desc(w, 3, "user", "auth_pam_service");
     if let Some(ref pam) = user.auth_pam_service {
         let _ = writeln!(w.output, "{indent}  auth_pam_service: \"{pam}\"");
     } else {
         let _ = writeln!(w.output, "{indent}  # auth_pam_service: \"pg_doorman\"");
     }
+    w.blank();
+
+    write_field_desc(w, 3, "user", "read_only");
+    if user.read_only {
+        let _ = writeln!(w.output, "{indent}  read_only: true");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # read_only: true");
+    }
+    w.blank();
+
+    write_field_desc(w, 3, "user", "max_query_time");
+    if let Some(val) = user.max_query_time {
+        let _ = writeln!(w.output, "{indent}  max_query_time: {val}");
+    } else {
+        let _ = writeln!(w.output, "{indent}  # max_query_time: \"15m\"");
+    }
 }
 
 /// Write documentation about server_username/server_password passthrough.
@@ -205,64 +205,123 @@ fn write_general_fields(out: &mut String, f: &FieldsData) {
         "port",
         "backlog",
         "max_connections",
+        "max_connections_soft",
+        "max_client_handshakes",
+        "max_concurrent_logins",
+        "max_login_queue",
+        "auth_ban_threshold",
+        "auth_ban_window",
+        "auth_ban_time",
+        "auth_ban_max_time",
+        "trusted_upstream_poolers",
+        "client_identity_parameter",
+        "fd_usage_warn_percent",
         "max_concurrent_creates",
         "tls_mode",
         "tls_ca_cert",
         "tls_private_key",
         "tls_certificate",
         "tls_rate_limit_per_second",
+        "tls_min_version",
+        "tls_max_version",
+        "tls_ciphers",
+        "tls_ciphersuites",
+        "tls_groups",
+        "plain_auth_require_tls",
         "daemon_pid_file",
         "syslog_prog_name",
+        "audit_log",
         "log_client_connections",
         "log_client_disconnections",
+        "log_connection_events",
         "worker_threads",
         "worker_cpu_affinity_pinning",
+        "stall_watchdog_timeout",
+        "state_dump_dir",
+        "enable_fault_injection",
         "tokio_global_queue_interval",
         "tokio_event_interval",
         "worker_stack_size",
         "max_blocking_threads",
         "connect_timeout",
         "query_wait_timeout",
+        "client_login_timeout",
+        "client_idle_timeout",
+        "client_write_timeout",
         "idle_timeout",
         "server_lifetime",
         "retain_connections_time",
         "retain_connections_max",
+        "autodb_idle_timeout",
+        "autodb_max_pools",
+        "autodb_create_rate",
+        "managed_pools_file",
         "server_idle_check_timeout",
+        "dns_refresh_interval",
+        "server_role_check_interval",
+        "server_memory_check_interval",
+        "server_recycle_windows",
+        "server_recycle_rate",
+        "circuit_breaker_threshold",
+        "circuit_breaker_cooldown",
+        "server_checkout_retries",
+        "client_pool_parameter",
+        "connect_notice",
+        "client_tag_parameter",
         "server_round_robin",
+        "server_max_protocol_version",
+        "data_row_flush_threshold",
+        "copy_data_flush_threshold",
         "sync_server_parameters",
+        "auto_session_pinning",
+        "two_phase_commit",
         "tcp_so_linger",
         "tcp_no_delay",
         "tcp_keepalives_count",
         "tcp_keepalives_idle",
         "tcp_keepalives_interval",
         "tcp_user_timeout",
+        "server_tcp_keepalives_idle",
+        "server_tcp_keepalives_interval",
+        "server_tcp_keepalives_count",
+        "server_tcp_user_timeout",
         "tcp_socket_buffer_size",
         "unix_socket_buffer_size",
         "unix_socket_dir",
         "unix_socket_mode",
         "admin_username",
         "admin_password",
+        "stats_users",
         "prepared_statements",
         "prepared_statements_cache_size",
         "server_prepared_statements_cache_size",
         "client_anonymous_prepared_cache_size",
         "query_interner_gc_interval_seconds",
         "query_interner_anon_idle_ttl_seconds",
+        "query_interner_anon_max_entries",
         "message_size_to_be_stream",
         "scaling_warm_pool_ratio",
         "scaling_fast_retries",
         "scaling_max_parallel_creates",
+        "adaptive_pool_wait_target",
+        "adaptive_pool_interval",
         "max_memory_usage",
+        "max_client_message_size",
+        "max_pipeline_depth",
         "shutdown_timeout",
+        "hold_timeout",
         "proxy_copy_data_timeout",
         "server_tls_mode",
+        "server_tls_negotiation",
         "server_tls_ca_cert",
         "server_tls_certificate",
         "server_tls_private_key",
         "hba",
         "pg_hba",
         "pooler_check_query",
+        "show_local_parameters",
         "startup_parameters",
+        "features",
     ];
 
     for name in &fields {
@@ -278,11 +337,35 @@ fn write_pool_fields(out: &mut String, f: &FieldsData) {
     let fields = [
         "server_host",
         "server_port",
+        "target_session_attrs",
+        "server_host_weights",
+        "load_balance_hosts",
         "server_database",
         "application_name",
+        "application_name_template",
+        "connect_notice",
+        "client_addr_guc",
+        "client_tag_limits",
+        "application_name_checkout_limits",
+        "tag_checkout_limits",
+        "statement_deny",
+        "statement_allow",
+        "shards",
+        "driver_compat",
+        "server_version",
         "connect_timeout",
         "idle_timeout",
         "server_lifetime",
+        "server_max_memory",
+        "max_query_time",
+        "max_query_time_grace",
+        "statement_timeout",
+        "lock_timeout",
+        "idle_in_transaction_session_timeout",
+        "server_connect_attempts",
+        "server_connect_backoff",
+        "server_login_retry",
+        "server_round_robin",
         "pool_mode",
         "log_client_parameter_status_changes",
         "cleanup_server_connections",
@@ -294,6 +377,8 @@ fn write_pool_fields(out: &mut String, f: &FieldsData) {
         "reserve_pool_timeout",
         "min_guaranteed_pool_size",
         "startup_parameters",
+        "fault_injection",
+        "rewrite_rules",
     ];
 
     for name in &fields {
@@ -346,12 +431,19 @@ fn write_user_fields(out: &mut String, f: &FieldsData) {
     let fields = [
         "username",
         "password",
+        "next_password",
         "auth_pam_service",
         "server_username",
         "server_password",
+        "server_vault_path",
+        "server_rds_iam",
         "pool_size",
         "min_pool_size",
+        "max_pool_size",
         "server_lifetime",
+        "priority",
+        "read_only",
+        "max_query_time",
     ];
 
     for name in &fields {
@@ -412,13 +504,20 @@ fn write_prometheus_metrics_section(out: &mut String) {
     let _ = writeln!(out, "### System Metrics\n");
     let _ = writeln!(out, "| Metric | Description |");
     let _ = writeln!(out, "|--------|-------------|");
-    let _ = writeln!(out, "| `pg_doorman_total_memory` | Total memory allocated to the pg_doorman process in bytes. Monitors the memory footprint of the application. |\n");
+    let _ = writeln!(out, "| `pg_doorman_total_memory` | Total memory allocated to the pg_doorman process in bytes. Monitors the memory footprint of the application. |");
+    let _ = writeln!(out, "| `pg_doorman_process_open_fds` | Number of file descriptors the pg_doorman process has open (Linux only). |");
+    let _ = writeln!(out, "| `pg_doorman_process_max_fds` | Soft `RLIMIT_NOFILE` of the process. Alert on `pg_doorman_process_open_fds / pg_doorman_process_max_fds` before new connections start failing with `Too many open files`; see [`fd_usage_warn_percent`](general.md#fd_usage_warn_percent). |\n");
 
     // Connection Metrics
     let _ = writeln!(out, "### Connection Metrics\n");
     let _ = writeln!(out, "| Metric | Description |");
     let _ = writeln!(out, "|--------|-------------|");
     let _ = writeln!(out, "| `pg_doorman_connections_total` | Cumulative count of accepted client connections by type. Types include: 'plain' (unencrypted), 'tls' (encrypted), 'cancel' (cancel-query startup), and 'total' (sum of all). Counter form; use `rate(pg_doorman_connections_total[5m])` for connection rate. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tls_handshakes_total` | Counter by negotiated protocol `version` (`TLSv1`, `TLSv1.1`, `TLSv1.2`, `TLSv1.3`; `unknown` where the TLS library does not report it). Counts successful client TLS handshakes. Shows which clients still use TLS 1.0/1.1 before raising `tls_min_version`. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tls_handshake_errors_total` | Counter by `reason`: 'bad_certificate', 'protocol_version' (no common TLS version, or not TLS at all), 'no_shared_cipher', 'eof' (client closed the connection mid-handshake) or 'other'. Counts failed client TLS handshakes; each is also counted as 'tls_handshake_fail' in `pg_doorman_listener_rejections_total`. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tls_handshake_duration_seconds` | Histogram of successful client TLS handshake durations. |");
+    let _ = writeln!(out, "| `pg_doorman_auth_failures_total` | Counter by `reason`: 'bad_password' (wrong password, SCRAM proof, JWT or Talos token, or PAM refusal), 'unknown_user', 'hba_reject' (HBA rules or [`plain_auth_require_tls`](general.md#plain_auth_require_tls)), 'timeout' (`client_login_timeout` elapsed) or 'other' (malformed authentication messages, unusable stored secret). Alert on a rising 'bad_password' or 'unknown_user' rate to catch password scans. |");
+    let _ = writeln!(out, "| `pg_doorman_auth_user_failures_total` | Counter by `(user, reason)`. The same failures for users pg_doorman knows: pool users, users found by `auth_query`, `stats_users` and the admin user. Unknown usernames are only counted in `pg_doorman_auth_failures_total`. |");
     let _ = writeln!(out, "| `pg_doorman_connection_count` | DEPRECATED, removed in 3.10. Gauge mirror of `pg_doorman_connections_total` kept for one minor release. New rules and dashboards must consume the counter form. |\n");
 
     // Socket Metrics
@@ -432,8 +531,9 @@ fn write_prometheus_metrics_section(out: &mut String) {
     let _ = writeln!(out, "| Metric | Description |");
     let _ = writeln!(out, "|--------|-------------|");
     let _ = writeln!(out, "| `pg_doorman_pools_clients` | Number of clients in connection pools by status, user, and database. Status values include: 'idle' (connected but not executing queries), 'waiting' (waiting for a server connection), and 'active' (currently executing queries). Helps monitor connection pool utilization and client distribution. |");
-    let _ = writeln!(out, "| `pg_doorman_pools_servers` | Number of servers in connection pools by status, user, and database. Status values include: 'active' (actively serving clients) and 'idle' (available for new connections). Helps monitor server availability and load distribution. |");
+    let _ = writeln!(out, "| `pg_doorman_pools_servers` | Number of servers in connection pools by status, user, and database. Status values include: 'active' (actively serving clients), 'idle' (available for new connections) and 'login' (still connecting or authenticating), matching sv_active, sv_idle and sv_login in SHOW POOLS. Helps monitor server availability and load distribution. |");
     let _ = writeln!(out, "| `pg_doorman_pools_bytes_total` | Cumulative bytes transferred per pool and direction. Direction values include: 'received' (data from client) and 'sent' (data to client). Counter form; use `rate(pg_doorman_pools_bytes_total[5m])` for throughput. |");
+    let _ = writeln!(out, "| `pg_doorman_users_bytes_total` | Cumulative bytes transferred per user and direction, summed over all pools of the user. Stays monotonic when a pool is dropped on reload. Use `rate(pg_doorman_users_bytes_total[5m])` for per-user throughput. |");
     let _ = writeln!(out, "| `pg_doorman_pools_bytes` | DEPRECATED, removed in 3.10. Gauge mirror of `pg_doorman_pools_bytes_total`. |\n");
     let _ = writeln!(out, "| `pg_doorman_pool_size` | Configured maximum pool size per user and database. Useful for calculating remaining pool capacity together with pg_doorman_pools_servers. |\n");
 
@@ -490,6 +590,32 @@ fn write_prometheus_metrics_section(out: &mut String) {
     let _ = writeln!(out, "| `pg_doorman_servers_prepared_misses` | Live aggregate of prepared-statement cache misses across currently active backends of each pool, by user and database. This gauge can decrease when backends rotate; use `pg_doorman_servers_prepared_misses_total` for rates. |");
     let _ = writeln!(out, "| `pg_doorman_servers_prepared_hits_total` | Counter form of prepared-statement cache hits across all backends of each pool, by user and database. Use `rate()` over this metric for hit throughput. |");
     let _ = writeln!(out, "| `pg_doorman_servers_prepared_misses_total` | Counter form of prepared-statement cache misses across all backends of each pool, by user and database. A sustained non-zero rate signals queries that could benefit from being prepared, or from a larger `server_prepared_statements_cache_size`. |\n");
+    let _ = writeln!(out, "| `pg_doorman_server_in_recovery` | Last observed role of a backend host in pools with `target_session_attrs`, by pool, host and port: `1` = in recovery (standby), `0` = primary. Updated when a connection is opened and on every `server_role_check_interval` re-check. |");
+    let _ = writeln!(out, "| `pg_doorman_server_role_changes_total` | Counter by `(pool, host, port)`. Increments when a host reports a different `pg_is_in_recovery()` result than the previous check, e.g. a primary demoted by a switchover. Each change is also logged at WARN. |");
+    let _ = writeln!(out, "| `pg_doorman_server_memory_recycles_total` | Counter by `(user, database)`. Server connections closed because the backend memory reported by `pg_backend_memory_contexts` exceeded `server_max_memory`. Each one is also logged with the measured size. |");
+    let _ = writeln!(out, "| `pg_doorman_server_scheduled_recycles_total` | Counter by `(user, database)`. Idle server connections closed inside a `server_recycle_windows` maintenance window because they were opened before the window started. |");
+    let _ = writeln!(out, "| `pg_doorman_circuit_breaker_trips_total` | Counter by `(user, database)`. Times the backend circuit breaker opened after `circuit_breaker_threshold` connect failures in a row. While it is open, checkouts that need a new server connection fail with SQLSTATE 08004. |");
+    let _ = writeln!(out, "| `pg_doorman_server_checkout_retries_total` | Counter by `(user, database)`. Failed server checkouts repeated transparently under `server_checkout_retries` because the backend could not be reached. |");
+    let _ = writeln!(out, "| `pg_doorman_connection_events_total` | Counter by `(event, reason)`. Client connects and disconnects and server connects and closes; see [`log_connection_events`](general.md#log_connection_events) for the reasons. |");
+    let _ = writeln!(out, "| `pg_doorman_client_limit_total` | Counter by `limit`. Client connections accepted above [`max_connections_soft`](general.md#max_connections_soft) (`soft`) or rejected at `max_connections` (`hard`). |");
+    let _ = writeln!(out, "| `pg_doorman_client_evictions_total` | Counter by `user`. Idle clients evicted above `max_connections_soft`. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tag_connections` | Gauge by `(database, tag)`. Current clients per [`client_tag_parameter`](general.md#client_tag_parameter) tag; tags the pool does not list in [`client_tag_limits`](pool.md#client_tag_limits) count as `other`. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tag_transactions_total` | Counter by `(database, tag)`. Transactions completed by the clients of each tag. |");
+    let _ = writeln!(out, "| `pg_doorman_checkout_quota_total` | Counter by `(database, by, key, result)`. Checkouts that found their [`application_name_checkout_limits`](pool.md#application_name_checkout_limits) or `tag_checkout_limits` entry full: `waited` when a slot came free within `query_wait_timeout`, `timeout` when the client got `53300`. |");
+    let _ = writeln!(out, "| `pg_doorman_client_tag_rejected_total` | Counter by `(database, tag)`. Clients refused at login with `53300` because their tag reached its `client_tag_limits` entry. |");
+    let _ = writeln!(out, "| `pg_doorman_max_query_time_total` | Counter by `(user, database, action)`. Queries stopped by `max_query_time`: `cancel` when the cancel request is sent, `terminate` when the backend is terminated after `max_query_time_grace`. |");
+    let _ = writeln!(out, "| `pg_doorman_pipeline_aborts_total` | Counter by `(user, database, reason)`. Extended protocol pipelines failed by pg_doorman: `max_pipeline_depth` when a client queues too many messages before Sync, `rejected` when a Parse is refused by `statement_deny`, `read_only` or `two_phase_commit`, `unknown_statement` when a Bind or Describe names a statement pg_doorman does not know under `driver_compat = \"jdbc\"`. |");
+    let _ = writeln!(out, "| `pg_doorman_show_local_total` | Counter by `source`. `SHOW` queries for `show_local_parameters`: `parameter_status` and `cache` were answered without a backend, from the client's ParameterStatus snapshot or from the pool's cache of values PostgreSQL does not report; `backend` went to PostgreSQL to fill that cache. |");
+    let _ = writeln!(out, "| `pg_doorman_query_rewrites_total` | Counter by `(user, database)`. Simple queries and Parse messages changed by the pool's `rewrite_rules`. |");
+    let _ = writeln!(out, "| `pg_doorman_statements_denied_total` | Counter by `(user, database)`. Statements refused by the pool's `statement_deny` rules. Each one is also logged at WARN under the `pg_doorman::audit` target. |");
+
+    // COPY Metrics
+    let _ = writeln!(out, "### COPY Metrics\n");
+    let _ = writeln!(out, "| Metric | Description |");
+    let _ = writeln!(out, "|--------|-------------|");
+    let _ = writeln!(out, "| `pg_doorman_copy_bytes_total` | Counter by `(user, database, direction)`. Bytes of CopyData forwarded in COPY operations; `direction` is 'in' (COPY FROM STDIN) or 'out' (COPY TO STDOUT). Bytes are added in 1 MiB steps while a COPY runs and in full when it ends, so `rate()` follows a long bulk load as it progresses. |");
+    let _ = writeln!(out, "| `pg_doorman_copy_rows_total` | Counter by `(user, database, direction)`. Rows reported by the `COPY n` tag of completed COPY operations. Failed operations add no rows. |");
+    let _ = writeln!(out, "| `pg_doorman_copy_active` | Gauge by `(user, database, direction)`. Backend connections currently in COPY mode. |\n");
 
     // Per-Client Prepared Statement Cache Metrics
     let _ = writeln!(out, "### Per-Client Prepared Statement Cache Metrics\n");
@@ -507,7 +633,8 @@ fn write_prometheus_metrics_section(out: &mut String) {
     let _ = writeln!(out, "|--------|-------------|");
     let _ = writeln!(out, "| `pg_doorman_query_interner_entries` | Gauge by `kind` (`named` or `anonymous`). Number of interned query texts. Refreshed once per GC sweep. |");
     let _ = writeln!(out, "| `pg_doorman_query_interner_bytes` | Gauge by `kind` (`named` or `anonymous`). Total bytes of interned query text. Refreshed once per GC sweep. |");
-    let _ = writeln!(out, "| `pg_doorman_query_interner_evictions_total` | Counter by `kind` and `reason` (`gc_passive` or `ttl_expired`). Named entries are removed when no cache outside the interner still holds them; anonymous entries are removed after the idle TTL. |");
+    let _ = writeln!(out, "| `pg_doorman_query_interner_evictions_total` | Counter by `kind` and `reason` (`gc_passive`, `ttl_expired` or `size_limit`). Named entries are removed when no cache outside the interner still holds them; anonymous entries are removed after the idle TTL or when they exceed `query_interner_anon_max_entries`. |");
+    let _ = writeln!(out, "| `pg_doorman_query_interner_lookups_total` | Counter by `kind` and `result` (`hit`, `miss` or `collision`). Parse lookups that reused interned text, interned new text, or (anonymous only) found a different text under the same hash. Collisions are served uncached and should stay at zero. Advanced once per GC sweep. |");
     let _ = writeln!(out, "| `pg_doorman_query_interner_synthetic_misses_total` | Counter of synthetic SQLSTATE `26000` responses for anonymous prepared statements whose state was no longer available when a later `Bind` or `Describe` referenced it. Check client Anonymous LRU evictions, WARN logs, `RESET INTERNER`, and TTL evictions before increasing `query_interner_anon_idle_ttl_seconds`. |");
     let _ = writeln!(out, "| `pg_doorman_query_interner_gc_duration_seconds` | Histogram of one interner GC sweep (named and anonymous combined), in seconds. Use this to detect large interners that make sweep time visible. |");
     let _ = writeln!(out, "| `pg_doorman_pooler_check_query_backend_total` | Counter of `pooler_check_query` probes forwarded to PostgreSQL (cache miss or RELOAD-induced re-probe). Steady-state value should be flat after warmup; a continuously rising rate means the per-pool cache is not retaining its entry. |");
@@ -515,8 +642,9 @@ fn write_prometheus_metrics_section(out: &mut String) {
 
     // Grafana Dashboard
     let _ = writeln!(out, "## Grafana Dashboard\n");
-    let _ = writeln!(out, "You can create a Grafana dashboard to visualize these metrics. Here's a simple example of panels you might want to include:\n");
-    let _ = writeln!(out, "1. Connection counts by type\n2. Memory usage over time\n3. Client and server counts by pool\n4. Query and transaction performance percentiles\n5. Network traffic by pool\n");
+    let _ = writeln!(out, "`pg_doorman dashboard --format grafana` prints a dashboard JSON for Grafana's **Dashboards → New → Import**. Write it to a file with `--output dashboard.json`.\n");
+    let _ = writeln!(out, "The panels cover client connections, clients and servers by status, waiting clients, queries and transactions per second, p99 query, transaction and wait latency, network and COPY throughput, errors by SQLSTATE, authentication failures, listener rejections, TLS versions and memory. A `database` variable filters the per-pool panels.\n");
+    let _ = writeln!(out, "Metric and label names come from the exporter itself, so a dashboard generated by a given pg_doorman version always matches the metrics it exports. Regenerate the dashboard after upgrading.\n");
 
     // Example Queries
     let _ = writeln!(out, "## Example Queries\n");
@@ -4,7 +4,7 @@ pub mod docs;
 use std::error::Error;
 
 use crate::app::args::GenerateConfig;
-use crate::config::{Config, PoolMode};
+use crate::config::{Config, PoolMode, TargetSessionAttrs};
 
 #[cfg(not(test))]
 use crate::auth::hba::PgHba;
@@ -107,11 +107,18 @@ pub fn generate_config_with_client(
                 password: passwd,
                 pool_size: config.pool_size,
                 min_pool_size: None,
+                max_pool_size: None,
                 pool_mode: None,
                 server_lifetime: None,
                 server_username: None,
                 server_password: None,
                 auth_pam_service: None,
+                read_only: false,
+                max_query_time: None,
+                next_password: None,
+                server_vault_path: None,
+                server_rds_iam: false,
+                priority: None,
             };
             users.push(user);
         }
@@ -142,12 +149,24 @@ pub fn generate_config_with_client(
                     cleanup_server_connections: false,
                     log_client_parameter_status_changes: false,
                     application_name: None,
+                    application_name_template: None,
+                    connect_notice: None,
+                    client_addr_guc: None,
+                    client_tag_limits: std::collections::BTreeMap::new(),
+                    application_name_checkout_limits: std::collections::BTreeMap::new(),
+                    tag_checkout_limits: std::collections::BTreeMap::new(),
+                    statement_deny: Vec::new(),
+                    statement_allow: Vec::new(),
+                    shards: Vec::new(),
+                    driver_compat: None,
+                    server_version: None,
                     server_host: config
                         .server_host
                         .as_deref()
                         .unwrap_or(config.host.as_deref().unwrap_or("localhost"))
                         .to_string(),
                     server_port: config.port,
+                    target_session_attrs: TargetSessionAttrs::Any,
                     server_database: Some(datname.to_string()),
                     prepared_statements_cache_size: None,
                     server_prepared_statements_cache_size: None,
@@ -163,11 +182,29 @@ pub fn generate_config_with_client(
                     patroni_api_timeout: None,
                     fallback_connect_timeout: None,
                     fallback_lifetime: None,
+                    patroni_discovery_interval: None,
+                    server_host_weights: std::collections::BTreeMap::new(),
+                    load_balance_hosts: None,
+                    server_connect_attempts: None,
+                    server_connect_backoff: None,
+                    server_login_retry: None,
+                    server_round_robin: None,
+                    server_max_memory: None,
+                    max_query_time: None,
+                    max_query_time_grace: None,
+                    statement_timeout: None,
+                    lock_timeout: None,
+                    idle_in_transaction_session_timeout: None,
+                    data_row_flush_threshold: None,
+                    copy_data_flush_threshold: None,
                     server_tls_mode: None,
+                    server_tls_negotiation: None,
                     server_tls_ca_cert: None,
                     server_tls_certificate: None,
                     server_tls_private_key: None,
                     auth_query: None,
+                    fault_injection: None,
+                    rewrite_rules: Vec::new(),
                     startup_parameters: std::collections::BTreeMap::new(),
                     users: users.clone(),
                 },
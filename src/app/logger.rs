@@ -12,6 +12,7 @@ use crate::config::{Config, VERSION};
 pub fn init_logging(args: &Args, config: &Config) -> Result<(), Box<dyn std::error::Error>> {
     init(args, config.general.syslog_prog_name.clone());
     info!("Welcome to PgDoorman! (Version {VERSION})");
+    super::audit_log::configure(&config.general).map_err(|err| err.to_string())?;
     Ok(())
 }
 
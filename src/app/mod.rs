@@ -1,12 +1,16 @@
 pub mod args;
+pub mod audit_log;
 pub mod config;
 pub mod errors;
+pub mod fd_limit;
+pub mod gen_password;
 pub mod generate;
 pub mod log_level;
 pub mod logger;
 pub mod panic;
 pub mod server;
 pub mod tls;
+pub mod watchdog;
 
 pub use config::init_config;
 pub use logger::init_logging;
@@ -14,7 +18,7 @@ pub use panic::install_panic_hook;
 pub use server::cleanup_inherited_upgrade_fds;
 pub use server::run_server;
 
-pub use args::{parse, Args, Commands, GenerateConfig, LogFormat, OutputFormat};
+pub use args::{parse, Args, Commands, DashboardFormat, GenerateConfig, LogFormat, OutputFormat};
 
 pub fn parse_args() -> Result<Args, Box<dyn std::error::Error>> {
     use crate::config::ConfigFormat;
@@ -91,6 +95,28 @@ pub fn parse_args() -> Result<Args, Box<dyn std::error::Error>> {
             }
             std::process::exit(0);
         }
+        Some(Commands::GenPassword {
+            md5,
+            iterations,
+            salt_from,
+        }) => {
+            gen_password::run(md5.as_deref(), *iterations, salt_from.as_deref())?;
+            std::process::exit(0);
+        }
+        Some(Commands::Dashboard { format, output }) => {
+            let dashboard = match format {
+                DashboardFormat::Grafana => crate::web::metrics::dashboard::grafana_dashboard()?,
+            };
+            let data = serde_json::to_string_pretty(&dashboard)?;
+
+            if let Some(output_path) = output {
+                std::fs::write(output_path, &data)?;
+                info!("Dashboard written to file: {output_path}");
+            } else {
+                println!("{data}");
+            }
+            std::process::exit(0);
+        }
         None => (),
     }
 
@@ -15,11 +15,13 @@ use tokio::signal::windows as win_signal;
 use tokio::{runtime::Builder, sync::mpsc};
 
 use crate::app::args::Args;
-use crate::config::{get_config, reload_config, Config};
+use crate::app::{fd_limit, watchdog};
+use crate::config::{get_config, reload_config, Config, Listener};
 use crate::daemon;
 use crate::messages::{configure_tcp_socket, configure_unix_socket};
 use crate::pool::{retain, ClientServerMap, ConnectionPool};
 use crate::server::{gc_sweep_anon, gc_sweep_named};
+use crate::stats::events::{self, CLIENT_DISCONNECT};
 use crate::stats::{Collector, Reporter, REPORTER, TOTAL_CONNECTION_COUNTER};
 use crate::utils::core_affinity;
 use crate::utils::format_duration;
@@ -67,6 +69,30 @@ pub static STARTED_AT_MS: std::sync::LazyLock<u64> = std::sync::LazyLock::new(||
 pub static MIGRATION_TX: std::sync::OnceLock<mpsc::Sender<MigrationPayload>> =
     std::sync::OnceLock::new();
 
+/// Modes of the admin `SHUTDOWN` command, named after PostgreSQL's
+/// `pg_ctl stop -m`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ShutdownMode {
+    /// Stop accepting clients; exit once the connected ones disconnect.
+    Smart,
+    /// Stop accepting clients and drop each one when its transaction ends;
+    /// exit when they are gone or after `shutdown_timeout`.
+    Fast,
+    /// Exit now, closing every connection.
+    Immediate,
+}
+
+/// Shutdown requests from the admin console to the accept loop.
+static SHUTDOWN_REQUESTS: std::sync::OnceLock<mpsc::UnboundedSender<ShutdownMode>> =
+    std::sync::OnceLock::new();
+
+/// Ask the accept loop to shut down. False when it is not running.
+pub fn request_shutdown(mode: ShutdownMode) -> bool {
+    SHUTDOWN_REQUESTS
+        .get()
+        .is_some_and(|requests| requests.send(mode).is_ok())
+}
+
 /// Hard cap for queued migration fd duplicates.
 const MIGRATION_CHANNEL_CAPACITY_MAX: usize = 4096;
 
@@ -262,6 +288,10 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
              Remove --daemon from ExecStart or switch to Type=forking."
         );
     }
+    if let Err(err) = fd_limit::ensure_fd_limit(&config) {
+        error!("{err}");
+        process::exit(exitcode::CONFIG);
+    }
     if args.daemon {
         let pid_file = config.general.daemon_pid_file.clone();
         let daemonize = daemon::lib::Daemonize::new()
@@ -324,6 +354,8 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                 }
             }
         })
+        .on_thread_park(watchdog::worker_parked)
+        .on_thread_unpark(watchdog::worker_unparked)
         .build()?;
 
     // Store inherit_fd before moving args into runtime
@@ -428,6 +460,30 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
 
         info!("Running on {addr}");
 
+        // Extra listeners feed the main loop through this channel.
+        let (extra_tx, mut extra_rx) = mpsc::channel::<ExtraAccept>(1024);
+        #[cfg_attr(windows, allow(unused_mut))]
+        let mut extra_listeners = Vec::with_capacity(config.listeners.len());
+        for settings in &config.listeners {
+            let settings = Arc::new(settings.clone());
+            let bind = settings.socket_addr().expect("listener host is validated");
+            let backlog = if config.general.backlog > 0 {
+                config.general.backlog
+            } else {
+                config.general.max_connections as u32
+            };
+            match bind_extra_listener(bind, backlog) {
+                Ok(listener) => {
+                    info!("Running on {bind} (listener {})", settings.display_name());
+                    extra_listeners.push(spawn_extra_listener(listener, settings, extra_tx.clone()));
+                }
+                Err(err) => {
+                    error!("Listener {} on {bind}: {err}", settings.display_name());
+                    std::process::exit(exitcode::CONFIG);
+                }
+            }
+        }
+
         // Unix socket listener (when unix_socket_dir is set).
         //
         // Delegated to `create_unix_listener` so tests can exercise the
@@ -471,6 +527,14 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
         // Statistics reporting.
         REPORTER.store(Arc::new(Reporter::default()));
 
+        // Backend credentials of server_vault_path users; read before the
+        // pools so min_pool_size prewarm can already log in.
+        crate::vault::start().await;
+
+        // Client TLS certificate from [acme]; issued in the background,
+        // TLS is not offered to clients until the first one is installed.
+        crate::acme::start().await;
+
         // Connection pool that allows to query all databases.
         match ConnectionPool::from_config(client_server_map.clone()).await {
             Ok(_) => (),
@@ -502,10 +566,24 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
             retain::retain_connections().await;
         });
 
+        // Adaptive pool sizing; idles while no user has max_pool_size.
+        crate::pool::adaptive::spawn_adaptive_pool_sizing();
+
+        // Scheduled recycling; idles while server_recycle_windows is empty.
+        crate::pool::scheduled_recycle::spawn_scheduled_recycle();
+
+        // DNS re-resolution of backend hostnames; idles while
+        // dns_refresh_interval is 0.
+        crate::pool::dns::spawn_dns_refresh();
+
+        // Patroni discovery; only touches pools with patroni_discovery_interval.
+        crate::pool::multi_host::spawn_patroni_discovery();
+
         // Dynamic pool GC — cheap no-op when DYNAMIC_POOLS is empty
         {
             let gc_interval = config.general.retain_connections_time.as_std();
             crate::pool::gc::spawn_dynamic_pool_gc(gc_interval);
+            crate::pool::autodb::spawn_autodb_gc(gc_interval);
         }
 
         // One-shot lifecycle marker so /api/events has at least one entry
@@ -524,6 +602,11 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
             ),
         );
 
+        fd_limit::spawn_fd_usage_monitor();
+        watchdog::spawn_stall_watchdog(tokio::runtime::Handle::current());
+        #[cfg(unix)]
+        crate::admin::dump::spawn_dump_signal_handler();
+
         // Query interner GC: bounds NAMED via passive Arc::strong_count and
         // ANON via per-entry TTL. Sweep ticks at gc_interval / 4 so an entry
         // marked on cycle N has roughly a quarter-interval to be touched and
@@ -577,7 +660,9 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
 
                     let started = std::time::Instant::now();
                     let named_stats = gc_sweep_named();
-                    let anon_stats = gc_sweep_anon(anon_ttl_ms);
+                    let anon_max_entries =
+                        crate::config::config_arc().general.query_interner_anon_max_entries;
+                    let anon_stats = gc_sweep_anon(anon_ttl_ms, anon_max_entries);
                     let elapsed = started.elapsed().as_secs_f64();
 
                     record_interner_gc(named_stats, anon_stats, elapsed);
@@ -588,14 +673,18 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                     // the per-entry TRACE lines in `gc_sweep_named` /
                     // `gc_sweep_anon` this is enough to reconstruct what the
                     // interner dropped without scraping Prometheus.
-                    if named_stats.evicted > 0 || anon_stats.evicted > 0 {
+                    if named_stats.evicted > 0
+                        || anon_stats.evicted > 0
+                        || anon_stats.limited > 0
+                    {
                         debug!(
-                            "query_interner GC: named marked={}, evicted={}, bytes={}; anon marked={}, evicted={}, bytes={}, ttl_ms={}; elapsed={:.3}ms",
+                            "query_interner GC: named marked={}, evicted={}, bytes={}; anon marked={}, evicted={}, limited={}, bytes={}, ttl_ms={}; elapsed={:.3}ms",
                             named_stats.marked,
                             named_stats.evicted,
                             named_stats.bytes,
                             anon_stats.marked,
                             anon_stats.evicted,
+                            anon_stats.limited,
                             anon_stats.bytes,
                             anon_ttl_ms,
                             elapsed * 1000.0,
@@ -677,6 +766,8 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
         let mut upgrade_signal = unix_signal(SignalKind::user_defined2()).unwrap();
 
         let (exit_tx, mut exit_rx) = mpsc::channel::<()>(1);
+        let (shutdown_tx, mut shutdown_rx) = mpsc::unbounded_channel::<ShutdownMode>();
+        let _ = SHUTDOWN_REQUESTS.set(shutdown_tx);
         let mut admin_only = false;
         #[cfg(unix)]
         let mut _migration_handles: Option<MigrationHandles> = None;
@@ -801,7 +892,8 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                     {
                         info!("Got SIGINT, starting binary upgrade and graceful shutdown");
                         match binary_upgrade_and_shutdown(
-                            &args, admin_only, &mut listener, shutdown_timeout, &exit_tx,
+                            &args, admin_only, &mut listener, &mut extra_listeners,
+                            shutdown_timeout, &exit_tx,
                         ).await {
                             None => continue,
                             handles => { _migration_handles = handles; }
@@ -817,7 +909,8 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                     {
                         info!("Got SIGUSR2, starting binary upgrade and graceful shutdown");
                         match binary_upgrade_and_shutdown(
-                            &args, admin_only, &mut listener, shutdown_timeout, &exit_tx,
+                            &args, admin_only, &mut listener, &mut extra_listeners,
+                            shutdown_timeout, &exit_tx,
                         ).await {
                             None => continue,
                             handles => { _migration_handles = handles; }
@@ -826,6 +919,36 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                     }
                 },
 
+                // Admin SHUTDOWN SMART|FAST|IMMEDIATE. A stricter mode
+                // may follow a gentler one to speed the shutdown up.
+                Some(mode) = shutdown_rx.recv() => {
+                    match mode {
+                        ShutdownMode::Immediate => {
+                            let clients_in_tx = CLIENTS_IN_TRANSACTIONS.load(Ordering::Relaxed);
+                            info!("SHUTDOWN IMMEDIATE, closing with {} clients in transactions", clients_in_tx);
+                            break;
+                        }
+                        ShutdownMode::Fast => {
+                            if SHUTDOWN_IN_PROGRESS.load(Ordering::SeqCst) {
+                                continue;
+                            }
+                            info!("SHUTDOWN FAST, dropping clients as their transactions end");
+                            SHUTDOWN_IN_PROGRESS.store(true, Ordering::SeqCst);
+                            retain::drain_all_pools();
+                            admin_only = true;
+                            spawn_shutdown_timer(exit_tx.clone(), shutdown_timeout);
+                        }
+                        ShutdownMode::Smart => {
+                            if admin_only {
+                                continue;
+                            }
+                            info!("SHUTDOWN SMART, waiting for clients to disconnect");
+                            admin_only = true;
+                            spawn_smart_shutdown_waiter(exit_tx.clone());
+                        }
+                    }
+                },
+
                 _ = term_signal.recv() => {
                     let clients_in_tx = CLIENTS_IN_TRANSACTIONS.load(Ordering::Relaxed);
                     info!("Got SIGTERM, closing with {} clients in transactions", clients_in_tx);
@@ -834,7 +957,7 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
 
                 // new client.
                 new_client = accept_future => {
-                    let (mut socket, addr) = match new_client {
+                    let (socket, addr) = match new_client {
                         Ok((socket, addr)) => (socket, addr),
                         Err(err) => {
                             // EMFILE/ENFILE on accept means the process fd
@@ -862,51 +985,28 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                             continue;
                         }
                     };
-                    if admin_only {
-                        warn!("Rejecting connection from {addr}: pooler shutting down");
-                        let _ = socket.shutdown().await;
-                        continue;
-                    }
-                    let tls_rate_limiter = tls_rate_limiter.clone();
-                    let tls_acceptor = tls_acceptor.clone();
-                    let client_server_map = client_server_map.clone();
-                    let config = get_config();
-
-                    let log_client_disconnections = config.general.log_client_connections;
-                    let max_connections = config.general.max_connections;
+                    accept_tcp_client(
+                        socket,
+                        addr,
+                        None,
+                        admin_only,
+                        &client_server_map,
+                        &tls_rate_limiter,
+                    )
+                    .await;
+                }
 
-                    configure_tcp_socket(&socket);
-                    tokio::task::spawn(async move {
-                        let connection_id = TOTAL_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed) as u64 + 1;
-                        let current_clients = CURRENT_CLIENT_COUNT.fetch_add(1, Ordering::SeqCst);
-                        if current_clients as u64 > max_connections {
-                            warn!("[#c{connection_id}] client {addr} rejected: too many clients (current={current_clients}, max={max_connections})");
-                            if let Err(err) = crate::client::client_entrypoint_too_many_clients_already(
-                                socket, client_server_map).await {
-                                error!("[#c{connection_id}] client {addr} disconnected with error: {err}");
-                            }
-                            CURRENT_CLIENT_COUNT.fetch_add(-1, Ordering::SeqCst);
-                            return;
-                        }
-                        let start = Utc::now().naive_utc();
-                        let result = crate::client::client_entrypoint(
-                            socket,
-                            client_server_map,
-                            admin_only,
-                            tls_acceptor,
-                            tls_rate_limiter,
-                            connection_id,
-                        )
-                        .await;
-                        log_session_end(
-                            result,
-                            connection_id,
-                            &addr.to_string(),
-                            start,
-                            log_client_disconnections,
-                        );
-                        CURRENT_CLIENT_COUNT.fetch_add(-1, Ordering::SeqCst);
-                    });
+                // Client of an extra listener.
+                Some((socket, addr, settings)) = extra_rx.recv() => {
+                    accept_tcp_client(
+                        socket,
+                        addr,
+                        Some(current_listener_settings(settings)),
+                        admin_only,
+                        &client_server_map,
+                        &tls_rate_limiter,
+                    )
+                    .await;
                 }
 
                 // Unix socket client
@@ -946,12 +1046,19 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                     let config = get_config();
                     let log_client_disconnections = config.general.log_client_disconnections;
                     let max_connections = config.general.max_connections;
+                    let max_connections_soft = config.general.max_connections_soft;
 
                     tokio::task::spawn(async move {
                         let connection_id = TOTAL_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed) as u64 + 1;
                         let current_clients = CURRENT_CLIENT_COUNT.fetch_add(1, Ordering::SeqCst);
                         if current_clients as u64 > max_connections {
                             warn!("[#c{connection_id}] unix client rejected: too many clients (current={current_clients}, max={max_connections})");
+                            crate::web::metrics::record_client_limit("hard");
+                            events::emit(
+                                CLIENT_DISCONNECT,
+                                "too_many_clients",
+                                format_args!("conn=#c{connection_id} addr=unix"),
+                            );
                             if let Err(err) = crate::client::client_entrypoint_too_many_clients_already_unix(
                                 socket,
                                 connection_id,
@@ -963,6 +1070,10 @@ pub fn run_server(args: Args, config: Config) -> Result<(), Box<dyn std::error::
                             CURRENT_CLIENT_COUNT.fetch_add(-1, Ordering::SeqCst);
                             return;
                         }
+                        if max_connections_soft > 0 && current_clients as u64 >= max_connections_soft {
+                            crate::web::metrics::record_client_limit("soft");
+                            crate::client::evict_idle_client(max_connections_soft);
+                        }
                         let start = Utc::now().naive_utc();
                         let result = crate::client::client_entrypoint_unix(
                             socket,
@@ -1047,6 +1158,7 @@ async fn binary_upgrade_and_shutdown(
     args: &Args,
     admin_only: bool,
     listener: &mut Option<tokio::net::TcpListener>,
+    extra_listeners: &mut Vec<tokio::task::JoinHandle<()>>,
     shutdown_timeout: Duration,
     exit_tx: &mpsc::Sender<()>,
 ) -> Option<MigrationHandles> {
@@ -1222,6 +1334,7 @@ async fn binary_upgrade_and_shutdown(
             unsafe {
                 libc::close(listener_fd);
             }
+            stop_extra_listeners(extra_listeners);
         } else {
             // Foreground mode: start new process with inherited listener fd
             info!(
@@ -1349,6 +1462,7 @@ async fn binary_upgrade_and_shutdown(
                             libc::close(pipe_read_fd);
                         }
                         *listener = None;
+                        stop_extra_listeners(extra_listeners);
 
                         // Queue migration only while live fd headroom can
                         // absorb the dup'd client sockets.
@@ -1488,6 +1602,28 @@ fn spawn_shutdown_timer(exit_tx: mpsc::Sender<()>, shutdown_timeout: Duration) {
     });
 }
 
+/// `SHUTDOWN SMART`: exit once every client has disconnected, however
+/// long that takes. `SHUTDOWN FAST` or `IMMEDIATE` cut the wait short.
+fn spawn_smart_shutdown_waiter(exit_tx: mpsc::Sender<()>) {
+    tokio::task::spawn(async move {
+        let clients_total = CURRENT_CLIENT_COUNT.load(Ordering::Relaxed);
+        info!(
+            "waiting for {} client{} to disconnect",
+            clients_total,
+            if clients_total == 1 { "" } else { "s" }
+        );
+        let mut interval = tokio::time::interval(Duration::from_millis(250));
+        loop {
+            interval.tick().await;
+            if CURRENT_CLIENT_COUNT.load(Ordering::Relaxed) == 0 {
+                info!("All clients disconnected, shutting down");
+                let _ = exit_tx.send(()).await;
+                return;
+            }
+        }
+    });
+}
+
 /// Identity of a Unix socket file this process bound to, captured as
 /// `(dev, ino)` plus the original path. Used to decide at shutdown whether
 /// the inode on disk is still ours or has been replaced by a successor
@@ -1576,6 +1712,164 @@ enum CleanupDecision {
     Skip(String),
 }
 
+/// Connection accepted on an extra listener, with the listener's settings.
+type ExtraAccept = (tokio::net::TcpStream, std::net::SocketAddr, Arc<Listener>);
+
+/// Hand an accepted TCP connection to its own task. Shared by the primary
+/// listener and the `[[listeners]]` entries (`listener` is `Some` for the
+/// latter).
+async fn accept_tcp_client(
+    mut socket: tokio::net::TcpStream,
+    addr: std::net::SocketAddr,
+    listener: Option<Arc<Listener>>,
+    admin_only: bool,
+    client_server_map: &ClientServerMap,
+    tls_rate_limiter: &Option<crate::utils::rate_limit::RateLimiter>,
+) {
+    if admin_only {
+        warn!("Rejecting connection from {addr}: pooler shutting down");
+        let _ = socket.shutdown().await;
+        return;
+    }
+    let tls_rate_limiter = tls_rate_limiter.clone();
+    let tls_acceptor = crate::app::tls::client_acceptor();
+    let client_server_map = client_server_map.clone();
+    let config = get_config();
+
+    let log_client_disconnections = config.general.log_client_connections;
+    let max_connections = config.general.max_connections;
+    let max_connections_soft = config.general.max_connections_soft;
+
+    configure_tcp_socket(&socket);
+    tokio::task::spawn(async move {
+        let connection_id = TOTAL_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed) as u64 + 1;
+        let current_clients = CURRENT_CLIENT_COUNT.fetch_add(1, Ordering::SeqCst);
+        if current_clients as u64 > max_connections {
+            warn!("[#c{connection_id}] client {addr} rejected: too many clients (current={current_clients}, max={max_connections})");
+            crate::web::metrics::record_client_limit("hard");
+            events::emit(
+                CLIENT_DISCONNECT,
+                "too_many_clients",
+                format_args!("conn=#c{connection_id} addr={addr}"),
+            );
+            if let Err(err) = crate::client::client_entrypoint_too_many_clients_already(
+                socket,
+                listener,
+                client_server_map,
+            )
+            .await
+            {
+                error!("[#c{connection_id}] client {addr} disconnected with error: {err}");
+            }
+            CURRENT_CLIENT_COUNT.fetch_add(-1, Ordering::SeqCst);
+            return;
+        }
+        if max_connections_soft > 0 && current_clients as u64 >= max_connections_soft {
+            crate::web::metrics::record_client_limit("soft");
+            crate::client::evict_idle_client(max_connections_soft);
+        }
+        let start = Utc::now().naive_utc();
+        let result = crate::client::client_entrypoint(
+            socket,
+            listener,
+            client_server_map,
+            admin_only,
+            tls_acceptor,
+            tls_rate_limiter,
+            connection_id,
+        )
+        .await;
+        log_session_end(
+            result,
+            connection_id,
+            &addr.to_string(),
+            start,
+            log_client_disconnections,
+        );
+        CURRENT_CLIENT_COUNT.fetch_add(-1, Ordering::SeqCst);
+    });
+}
+
+/// Settings of an extra listener as of the current config. The socket
+/// stays bound across reloads; its `tls_mode`, `databases` and
+/// `proxy_protocol` follow the config. A listener removed by a reload
+/// keeps the settings it was started with.
+fn current_listener_settings(bound: Arc<Listener>) -> Arc<Listener> {
+    get_config()
+        .listeners
+        .iter()
+        .find(|l| l.socket_addr() == bound.socket_addr())
+        .map(|l| Arc::new(l.clone()))
+        .unwrap_or(bound)
+}
+
+/// Bind one `[[listeners]]` address with the primary listener's socket
+/// options.
+fn bind_extra_listener(
+    addr: std::net::SocketAddr,
+    backlog: u32,
+) -> std::io::Result<tokio::net::TcpListener> {
+    let socket = if addr.is_ipv4() {
+        TcpSocket::new_v4()?
+    } else {
+        TcpSocket::new_v6()?
+    };
+    socket.set_reuseaddr(true)?;
+    // Lets the successor bind the same address during a binary upgrade.
+    #[cfg(unix)]
+    socket.set_reuseport(true)?;
+    socket.set_nodelay(true)?;
+    SockRef::from(&socket).set_linger(Some(Duration::from_secs(0)))?;
+    socket.bind(addr)?;
+    socket.listen(backlog)
+}
+
+/// Accept loop of one extra listener. Connections go to the main loop so
+/// shutdown and `max_connections` apply to them as to the primary
+/// listener.
+fn spawn_extra_listener(
+    listener: tokio::net::TcpListener,
+    settings: Arc<Listener>,
+    tx: mpsc::Sender<ExtraAccept>,
+) -> tokio::task::JoinHandle<()> {
+    tokio::spawn(async move {
+        loop {
+            match listener.accept().await {
+                Ok((socket, addr)) => {
+                    if tx.send((socket, addr, settings.clone())).await.is_err() {
+                        return;
+                    }
+                }
+                // Same EMFILE/ENFILE backoff as the primary accept loop.
+                Err(err) if is_fd_exhaustion_io(&err) => {
+                    if should_log_accept_resource_now() {
+                        error!(
+                            "Failed to accept new connection on {}: {err} \
+                             (process fd table exhausted; backing off)",
+                            settings.display_name()
+                        );
+                    }
+                    tokio::time::sleep(Duration::from_millis(10)).await;
+                }
+                Err(err) => {
+                    error!(
+                        "Failed to accept new connection on {}: {err}",
+                        settings.display_name()
+                    );
+                }
+            }
+        }
+    })
+}
+
+/// Close the extra listeners once the successor process has taken over.
+#[cfg(not(windows))]
+fn stop_extra_listeners(extra_listeners: &mut Vec<tokio::task::JoinHandle<()>>) {
+    for handle in extra_listeners.drain(..) {
+        handle.abort();
+    }
+}
+
 /// Log the end of a client session using a shared format string. Both the
 /// TCP and Unix accept branches used to inline the same match on
 /// `Result<Option<ClientSessionInfo>, Error>` — same identity string,
@@ -1588,7 +1882,8 @@ fn log_session_end(
     session_start: chrono::NaiveDateTime,
     log_disconnections: bool,
 ) {
-    let session = format_duration(&(Utc::now().naive_utc() - session_start));
+    let duration = Utc::now().naive_utc() - session_start;
+    let session = format_duration(&duration);
     match result {
         Ok(session_info) => {
             if log_disconnections || log::log_enabled!(log::Level::Debug) {
@@ -1602,6 +1897,17 @@ fn log_session_end(
             }
         }
         Err(err) => {
+            // Authenticated sessions report their own disconnect event.
+            if let Some(reason) = events::login_failure_reason(&err) {
+                events::emit(
+                    CLIENT_DISCONNECT,
+                    reason,
+                    format_args!(
+                        "conn=#c{connection_id} addr={peer_label} session_ms={}",
+                        duration.num_milliseconds()
+                    ),
+                );
+            }
             // Pre-auth failures: identity unknown, only connection_id available.
             // Post-auth failures already logged with [user@pool #cN] inside entrypoint.
             warn!("[#c{connection_id}] client {peer_label} disconnected with error: {err}, session={session}");
@@ -1,8 +1,14 @@
+use arc_swap::ArcSwapOption;
 use log::{error, info};
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use std::hash::{Hash, Hasher};
 use std::path::Path;
+use std::sync::Arc;
 
 use crate::config::Config;
-use crate::tls::build_acceptor;
+use crate::errors::Error;
+use crate::tls::{build_acceptor, TlsPolicy};
 use crate::utils::rate_limit::RateLimiter;
 
 #[derive(Clone)]
@@ -11,6 +17,70 @@ pub struct TlsState {
     pub acceptor: Option<tokio_native_tls::TlsAcceptor>,
 }
 
+/// Client-facing acceptor used by new connections. Swapped by
+/// [`reload_client_acceptor`] when the certificate, key, CA, mode or policy
+/// change.
+static CLIENT_ACCEPTOR: Lazy<ArcSwapOption<tokio_native_tls::TlsAcceptor>> =
+    Lazy::new(ArcSwapOption::empty);
+
+/// Fingerprint of the inputs the current acceptor was built from.
+static CLIENT_ACCEPTOR_INPUTS: Mutex<Option<u64>> = Mutex::new(None);
+
+/// Acceptor for a newly accepted client connection.
+pub fn client_acceptor() -> Option<tokio_native_tls::TlsAcceptor> {
+    CLIENT_ACCEPTOR
+        .load_full()
+        .map(|acceptor| (*acceptor).clone())
+}
+
+fn acceptor_inputs(config: &Config) -> std::io::Result<Option<u64>> {
+    let general = &config.general;
+    let (Some(cert), Some(key)) = (&general.tls_certificate, &general.tls_private_key) else {
+        return Ok(None);
+    };
+    let mut hasher = std::collections::hash_map::DefaultHasher::new();
+    std::fs::read(cert)?.hash(&mut hasher);
+    std::fs::read(key)?.hash(&mut hasher);
+    if let Some(ca) = &general.tls_ca_cert {
+        std::fs::read(ca)?.hash(&mut hasher);
+    }
+    general.tls_mode.hash(&mut hasher);
+    general.tls_min_version.hash(&mut hasher);
+    general.tls_max_version.hash(&mut hasher);
+    general.tls_ciphers.hash(&mut hasher);
+    general.tls_ciphersuites.hash(&mut hasher);
+    general.tls_groups.hash(&mut hasher);
+    Ok(Some(hasher.finish()))
+}
+
+/// Rebuild the client acceptor if its certificate, key, CA, mode or policy changed
+/// since the last build. Called on every config reload and after an ACME
+/// renewal; existing TLS sessions keep the certificate they started with.
+/// Returns whether the acceptor was replaced.
+pub fn reload_client_acceptor(config: &Config) -> Result<bool, Error> {
+    let mut current = CLIENT_ACCEPTOR_INPUTS.lock();
+    let inputs = acceptor_inputs(config)
+        .map_err(|err| Error::BadConfig(format!("Failed to read TLS files: {err}")))?;
+    if inputs == *current {
+        return Ok(false);
+    }
+    let general = &config.general;
+    let policy = TlsPolicy::from_general(general)?;
+    let acceptor = match (&general.tls_certificate, &general.tls_private_key) {
+        (Some(cert), Some(key)) => Some(Arc::new(build_acceptor(
+            Path::new(cert),
+            Path::new(key),
+            general.tls_ca_cert.clone(),
+            general.tls_mode.clone(),
+            &policy,
+        )?)),
+        _ => None,
+    };
+    CLIENT_ACCEPTOR.store(acceptor);
+    *current = inputs;
+    Ok(true)
+}
+
 pub fn init_tls(config: &Config) -> TlsState {
     // Не обновляется по HUP (как и в исходном `main`).
     let rate_limiter: Option<RateLimiter> = if config.general.tls_rate_limit_per_second > 0 {
@@ -24,27 +94,18 @@ pub fn init_tls(config: &Config) -> TlsState {
         None
     };
 
-    // Не обновляется по HUP (как и в исходном `main`).
-    let acceptor: Option<tokio_native_tls::TlsAcceptor> =
-        if config.general.tls_certificate.is_some() {
-            match build_acceptor(
-                Path::new(&config.general.tls_certificate.clone().unwrap()),
-                Path::new(&config.general.tls_private_key.clone().unwrap()),
-                config.general.tls_ca_cert.clone(),
-                config.general.tls_mode.clone(),
-            ) {
-                Ok(acceptor) => Some(acceptor),
-                Err(err) => {
-                    error!("Failed to build TLS acceptor: {err}");
-                    std::process::exit(exitcode::CONFIG);
-                }
-            }
-        } else {
-            None
-        };
+    // Обновляется по HUP и после продления сертификата ACME, см.
+    // `reload_client_acceptor`. Пока ACME не выпустил первый сертификат,
+    // акцептора нет.
+    if config.acme.awaits_certificate(&config.general) {
+        info!("TLS certificate not issued yet, waiting for ACME");
+    } else if let Err(err) = reload_client_acceptor(config) {
+        error!("Failed to build TLS acceptor: {err}");
+        std::process::exit(exitcode::CONFIG);
+    }
 
     TlsState {
         rate_limiter,
-        acceptor,
+        acceptor: client_acceptor(),
     }
 }
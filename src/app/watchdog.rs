@@ -0,0 +1,452 @@
+//! Stall watchdog: notices a tokio worker whose event loop stopped making
+//! progress and logs its stack and the runtime and pool queues, so a hang
+//! leaves evidence behind before it is restarted away.
+//!
+//! Progress comes from tokio's per-worker metrics: a running worker
+//! publishes its park/unpark count and busy time at every park and every
+//! `event_interval` ticks. A worker that is not parked and whose numbers
+//! have not moved for `stall_watchdog_timeout` is stuck inside a single
+//! poll — a blocking call, a lock, a loop without an `.await`.
+//!
+//! The watchdog runs on its own OS thread: when the runtime hangs, a task
+//! on that runtime would hang with it.
+
+use std::cell::OnceCell;
+use std::fmt::Write as _;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use log::{error, info, warn};
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use tokio::runtime::Handle;
+
+use crate::config::config_arc;
+use crate::pool::get_all_pools;
+
+/// Sampling granularity: a stall is noticed within a quarter of the
+/// timeout, but never sampled more often than this.
+const MIN_CHECK_INTERVAL: Duration = Duration::from_millis(50);
+
+/// How often a disabled watchdog looks at the config again.
+const DISABLED_CHECK_INTERVAL: Duration = Duration::from_secs(1);
+
+/// A runtime worker thread, registered on its first unpark.
+struct WorkerThread {
+    name: String,
+    /// Milliseconds since `START` when the thread last left park; 0 while
+    /// it is parked.
+    running_since_ms: AtomicU64,
+    #[cfg(target_os = "linux")]
+    tid: libc::pid_t,
+    #[cfg(target_os = "linux")]
+    pthread: libc::pthread_t,
+}
+
+static START: Lazy<Instant> = Lazy::new(Instant::now);
+
+static WORKER_THREADS: Lazy<Mutex<Vec<Arc<WorkerThread>>>> = Lazy::new(|| Mutex::new(Vec::new()));
+
+thread_local! {
+    static CURRENT_WORKER: OnceCell<Arc<WorkerThread>> = const { OnceCell::new() };
+}
+
+fn now_ms() -> u64 {
+    // +1 keeps a thread that unparks in the first millisecond from
+    // reading as parked.
+    START.elapsed().as_millis() as u64 + 1
+}
+
+fn current_worker<R>(f: impl FnOnce(&WorkerThread) -> R) -> R {
+    CURRENT_WORKER.with(|cell| {
+        let worker = cell.get_or_init(|| {
+            let worker = Arc::new(WorkerThread {
+                name: std::thread::current()
+                    .name()
+                    .unwrap_or("unnamed")
+                    .to_string(),
+                running_since_ms: AtomicU64::new(0),
+                #[cfg(target_os = "linux")]
+                tid: unsafe { libc::gettid() },
+                #[cfg(target_os = "linux")]
+                pthread: unsafe { libc::pthread_self() },
+            });
+            WORKER_THREADS.lock().push(worker.clone());
+            worker
+        });
+        f(worker)
+    })
+}
+
+/// `on_thread_unpark` hook of the runtime.
+pub fn worker_unparked() {
+    current_worker(|w| w.running_since_ms.store(now_ms(), Ordering::Relaxed));
+}
+
+/// `on_thread_park` hook of the runtime.
+pub fn worker_parked() {
+    current_worker(|w| w.running_since_ms.store(0, Ordering::Relaxed));
+}
+
+#[derive(Debug, PartialEq, Eq)]
+enum Verdict {
+    Ok,
+    Stalled(Duration),
+    Recovered(Duration),
+}
+
+/// Last published numbers of one worker and when they last moved.
+struct WorkerProgress {
+    sample: Option<(u64, Duration)>,
+    since: Instant,
+    reported: bool,
+}
+
+impl WorkerProgress {
+    fn new(now: Instant) -> Self {
+        WorkerProgress {
+            sample: None,
+            since: now,
+            reported: false,
+        }
+    }
+
+    /// Feeds one sample of the worker's park/unpark count and busy time.
+    /// Reports a stall once per episode, and its end.
+    fn observe(
+        &mut self,
+        park_unpark_count: u64,
+        busy: Duration,
+        now: Instant,
+        timeout: Duration,
+    ) -> Verdict {
+        let sample = (park_unpark_count, busy);
+        // An odd count means the worker is parked: idle, not stuck.
+        let parked = park_unpark_count % 2 == 1;
+        if parked || self.sample != Some(sample) {
+            let stalled_for = now.duration_since(self.since);
+            self.sample = Some(sample);
+            self.since = now;
+            if std::mem::take(&mut self.reported) {
+                return Verdict::Recovered(stalled_for);
+            }
+            return Verdict::Ok;
+        }
+        let stalled_for = now.duration_since(self.since);
+        if !self.reported && stalled_for >= timeout {
+            self.reported = true;
+            return Verdict::Stalled(stalled_for);
+        }
+        Verdict::Ok
+    }
+}
+
+/// Starts the watchdog thread for the runtime behind `handle`. It reads
+/// `stall_watchdog_timeout` from the live config, so RELOAD turns it on
+/// and off.
+pub fn spawn_stall_watchdog(handle: Handle) {
+    #[cfg(all(target_os = "linux", target_env = "gnu"))]
+    stack::install();
+
+    let spawned = std::thread::Builder::new()
+        .name("pg-doorman-watchdog".into())
+        .spawn(move || run(handle));
+    if let Err(err) = spawned {
+        warn!("Failed to start the stall watchdog thread: {err}");
+    }
+}
+
+fn run(handle: Handle) {
+    let mut workers: Vec<WorkerProgress> = Vec::new();
+    loop {
+        let timeout = config_arc().general.stall_watchdog_timeout.as_std();
+        if timeout.is_zero() {
+            workers.clear();
+            std::thread::sleep(DISABLED_CHECK_INTERVAL);
+            continue;
+        }
+        std::thread::sleep((timeout / 4).max(MIN_CHECK_INTERVAL));
+
+        let metrics = handle.metrics();
+        let now = Instant::now();
+        workers.resize_with(metrics.num_workers(), || WorkerProgress::new(now));
+        for (index, progress) in workers.iter_mut().enumerate() {
+            let verdict = progress.observe(
+                metrics.worker_park_unpark_count(index),
+                metrics.worker_total_busy_duration(index),
+                now,
+                timeout,
+            );
+            match verdict {
+                Verdict::Ok => {}
+                Verdict::Stalled(stalled_for) => {
+                    error!(
+                        "Stall watchdog: tokio worker {index} made no progress for {} ms \
+                         (stall_watchdog_timeout={} ms)\n{}",
+                        stalled_for.as_millis(),
+                        timeout.as_millis(),
+                        dump_state(&handle, timeout)
+                    );
+                }
+                Verdict::Recovered(stalled_for) => {
+                    info!(
+                        "Stall watchdog: tokio worker {index} is making progress again after {} ms",
+                        stalled_for.as_millis()
+                    );
+                }
+            }
+        }
+    }
+}
+
+/// Runtime queues, per-worker numbers, pool queues and the stacks of the
+/// worker threads that have been running for at least `timeout`.
+fn dump_state(handle: &Handle, timeout: Duration) -> String {
+    let mut out = String::new();
+    let metrics = handle.metrics();
+    let _ = writeln!(
+        out,
+        "runtime: workers={} alive_tasks={} global_queue_depth={}",
+        metrics.num_workers(),
+        metrics.num_alive_tasks(),
+        metrics.global_queue_depth()
+    );
+    for index in 0..metrics.num_workers() {
+        let park_unpark = metrics.worker_park_unpark_count(index);
+        let _ = writeln!(
+            out,
+            "worker {index}: {} parks={} busy_total_ms={}",
+            if park_unpark % 2 == 1 {
+                "parked"
+            } else {
+                "running"
+            },
+            metrics.worker_park_count(index),
+            metrics.worker_total_busy_duration(index).as_millis()
+        );
+    }
+
+    for (id, pool) in get_all_pools().iter() {
+        let state = pool.pool_state();
+        if state.size == 0 && state.waiting == 0 {
+            continue;
+        }
+        let _ = writeln!(
+            out,
+            "pool {id}: servers={}/{} idle={} waiting_clients={}",
+            state.size, state.max_size, state.available, state.waiting
+        );
+    }
+
+    let now = now_ms();
+    let threads = WORKER_THREADS.lock().clone();
+    for thread in threads {
+        let since = thread.running_since_ms.load(Ordering::Relaxed);
+        if since == 0 || now.saturating_sub(since) < timeout.as_millis() as u64 {
+            continue;
+        }
+        let _ = write!(
+            out,
+            "thread {} running for {} ms",
+            thread.name,
+            now.saturating_sub(since)
+        );
+        #[cfg(target_os = "linux")]
+        {
+            let _ = write!(out, " tid={} {}", thread.tid, kernel_state(thread.tid));
+        }
+        let _ = writeln!(out);
+        #[cfg(all(target_os = "linux", target_env = "gnu"))]
+        stack::write_backtrace(&mut out, thread.pthread);
+    }
+    out
+}
+
+/// Scheduler state of a thread (`R` running, `S` sleeping, `D`
+/// uninterruptible) and the kernel function a sleeping thread waits in.
+#[cfg(target_os = "linux")]
+fn kernel_state(tid: libc::pid_t) -> String {
+    let state = std::fs::read_to_string(format!("/proc/self/task/{tid}/stat"))
+        .ok()
+        .and_then(|stat| {
+            // The command name in parentheses may contain spaces.
+            let after = stat.rsplit_once(')')?.1;
+            after.split_whitespace().next().map(str::to_string)
+        })
+        .unwrap_or_else(|| "?".to_string());
+    let wchan = std::fs::read_to_string(format!("/proc/self/task/{tid}/wchan")).unwrap_or_default();
+    if wchan.is_empty() || wchan == "0" {
+        format!("state={state}")
+    } else {
+        format!("state={state} wchan={wchan}")
+    }
+}
+
+/// User-space stacks of other threads. A real-time signal makes the
+/// target thread record its own return addresses with glibc's
+/// `backtrace()` into a static buffer; the watchdog reads them back and
+/// resolves each to `module+offset`, which `addr2line -Cfe <binary>`
+/// turns into function and line.
+#[cfg(all(target_os = "linux", target_env = "gnu"))]
+mod stack {
+    use std::ffi::CStr;
+    use std::fmt::Write as _;
+    use std::sync::atomic::{AtomicIsize, AtomicUsize, Ordering};
+    use std::time::{Duration, Instant};
+
+    const MAX_FRAMES: usize = 64;
+
+    /// How long to wait for the signalled thread to record its stack.
+    const CAPTURE_TIMEOUT: Duration = Duration::from_millis(200);
+
+    static FRAMES: [AtomicUsize; MAX_FRAMES] = [const { AtomicUsize::new(0) }; MAX_FRAMES];
+
+    /// Frames recorded by the last capture, -1 while it is pending.
+    static FRAME_COUNT: AtomicIsize = AtomicIsize::new(-1);
+
+    fn signal() -> libc::c_int {
+        libc::SIGRTMIN()
+    }
+
+    extern "C" fn record_stack(_: libc::c_int) {
+        let mut buf = [std::ptr::null_mut::<libc::c_void>(); MAX_FRAMES];
+        // SAFETY: `buf` holds MAX_FRAMES pointers. glibc's backtrace only
+        // allocates on its first call, which `install` makes up front.
+        let n = unsafe { libc::backtrace(buf.as_mut_ptr(), MAX_FRAMES as libc::c_int) };
+        let n = n.clamp(0, MAX_FRAMES as libc::c_int) as usize;
+        for (slot, frame) in FRAMES.iter().zip(&buf[..n]) {
+            slot.store(*frame as usize, Ordering::Relaxed);
+        }
+        FRAME_COUNT.store(n as isize, Ordering::Release);
+    }
+
+    pub(super) fn install() {
+        let mut warm_up = [std::ptr::null_mut::<libc::c_void>(); 1];
+        // SAFETY: plain libc calls with valid pointers; the handler only
+        // touches atomics and the preloaded backtrace().
+        unsafe {
+            libc::backtrace(warm_up.as_mut_ptr(), 1);
+            let mut action: libc::sigaction = std::mem::zeroed();
+            action.sa_sigaction = record_stack as usize;
+            action.sa_flags = libc::SA_RESTART;
+            libc::sigemptyset(&mut action.sa_mask);
+            if libc::sigaction(signal(), &action, std::ptr::null_mut()) != 0 {
+                log::warn!(
+                    "Stall watchdog: cannot install the stack capture handler: {}",
+                    std::io::Error::last_os_error()
+                );
+            }
+        }
+    }
+
+    pub(super) fn write_backtrace(out: &mut String, thread: libc::pthread_t) {
+        FRAME_COUNT.store(-1, Ordering::Release);
+        // SAFETY: `thread` is a live runtime worker; workers exit only
+        // when the runtime shuts down, after the watchdog stops mattering.
+        if unsafe { libc::pthread_kill(thread, signal()) } != 0 {
+            let _ = writeln!(out, "  <stack unavailable: pthread_kill failed>");
+            return;
+        }
+        let deadline = Instant::now() + CAPTURE_TIMEOUT;
+        let count = loop {
+            let count = FRAME_COUNT.load(Ordering::Acquire);
+            if count >= 0 {
+                break count as usize;
+            }
+            if Instant::now() >= deadline {
+                let _ = writeln!(
+                    out,
+                    "  <stack unavailable: thread did not answer the signal>"
+                );
+                return;
+            }
+            std::thread::sleep(Duration::from_millis(1));
+        };
+        // Frame 0 is the signal handler itself, frame 1 the kernel's
+        // signal trampoline.
+        for (i, slot) in FRAMES.iter().take(count).enumerate().skip(2) {
+            let _ = writeln!(
+                out,
+                "  #{:<2} {}",
+                i - 2,
+                describe(slot.load(Ordering::Relaxed))
+            );
+        }
+    }
+
+    fn describe(addr: usize) -> String {
+        // SAFETY: dladdr only reads loader tables; the returned strings
+        // live as long as the module stays loaded.
+        unsafe {
+            let mut info: libc::Dl_info = std::mem::zeroed();
+            if libc::dladdr(addr as *const libc::c_void, &mut info) == 0 || info.dli_fname.is_null()
+            {
+                return format!("{addr:#x}");
+            }
+            let module = CStr::from_ptr(info.dli_fname).to_string_lossy();
+            let offset = addr - info.dli_fbase as usize;
+            if info.dli_sname.is_null() {
+                format!("{addr:#x} {module}+{offset:#x}")
+            } else {
+                let symbol = CStr::from_ptr(info.dli_sname).to_string_lossy();
+                format!("{addr:#x} {module}+{offset:#x} ({symbol})")
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const TIMEOUT: Duration = Duration::from_millis(1000);
+
+    #[test]
+    fn stall_is_reported_once_and_then_recovery() {
+        let start = Instant::now();
+        let mut progress = WorkerProgress::new(start);
+        let busy = Duration::from_millis(10);
+
+        assert_eq!(progress.observe(2, busy, start, TIMEOUT), Verdict::Ok);
+        let later = start + Duration::from_millis(500);
+        assert_eq!(progress.observe(2, busy, later, TIMEOUT), Verdict::Ok);
+        let stuck = start + Duration::from_millis(1200);
+        assert_eq!(
+            progress.observe(2, busy, stuck, TIMEOUT),
+            Verdict::Stalled(Duration::from_millis(1200))
+        );
+        let still = start + Duration::from_millis(3000);
+        assert_eq!(progress.observe(2, busy, still, TIMEOUT), Verdict::Ok);
+
+        let moved = start + Duration::from_millis(3100);
+        assert_eq!(
+            progress.observe(2, busy + Duration::from_millis(1), moved, TIMEOUT),
+            Verdict::Recovered(Duration::from_millis(3100))
+        );
+    }
+
+    #[test]
+    fn parked_worker_is_never_stalled() {
+        let start = Instant::now();
+        let mut progress = WorkerProgress::new(start);
+        let busy = Duration::from_millis(10);
+
+        for secs in 0..10 {
+            let now = start + Duration::from_secs(secs);
+            assert_eq!(progress.observe(3, busy, now, TIMEOUT), Verdict::Ok);
+        }
+    }
+
+    #[test]
+    fn busy_worker_that_publishes_progress_is_not_stalled() {
+        let start = Instant::now();
+        let mut progress = WorkerProgress::new(start);
+
+        for ms in 1..20 {
+            let now = start + Duration::from_millis(ms * 500);
+            let busy = Duration::from_millis(ms * 490);
+            assert_eq!(progress.observe(4, busy, now, TIMEOUT), Verdict::Ok);
+        }
+    }
+}
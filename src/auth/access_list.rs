@@ -0,0 +1,147 @@
+//! Client address deny and allow lists edited at runtime with the admin
+//! `DENY ADDRESS`, `ALLOW ADDRESS` and `REMOVE ADDRESS` commands.
+//!
+//! A TCP client whose address is in a deny entry is closed right after
+//! accept, before TLS and HBA, unless an allow entry holds it too. Allow
+//! entries also keep an address from being banned by
+//! `auth_ban_threshold`. Both lists are checked on top of the HBA rules
+//! of the config file. They live in memory only: RELOAD keeps them, a
+//! restart clears them.
+
+use ipnet::IpNet;
+use once_cell::sync::Lazy;
+use parking_lot::RwLock;
+use std::net::IpAddr;
+use std::time::{Duration, Instant};
+
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum List {
+    Deny,
+    Allow,
+}
+
+impl List {
+    pub fn name(self) -> &'static str {
+        match self {
+            List::Deny => "deny",
+            List::Allow => "allow",
+        }
+    }
+}
+
+/// An entry of one of the lists, as shown by `SHOW ACCESS_LIST`.
+pub struct Entry {
+    pub list: List,
+    pub net: IpNet,
+    pub age: Duration,
+}
+
+#[derive(Default)]
+struct Lists {
+    deny: Vec<(IpNet, Instant)>,
+    allow: Vec<(IpNet, Instant)>,
+}
+
+impl Lists {
+    fn list_mut(&mut self, list: List) -> &mut Vec<(IpNet, Instant)> {
+        match list {
+            List::Deny => &mut self.deny,
+            List::Allow => &mut self.allow,
+        }
+    }
+
+    fn denied(&self, addr: IpAddr) -> Option<IpNet> {
+        let (net, _) = self.deny.iter().find(|(net, _)| net.contains(&addr))?;
+        (!self.allowed(addr)).then_some(*net)
+    }
+
+    fn allowed(&self, addr: IpAddr) -> bool {
+        self.allow.iter().any(|(net, _)| net.contains(&addr))
+    }
+}
+
+static LISTS: Lazy<RwLock<Lists>> = Lazy::new(|| RwLock::new(Lists::default()));
+
+/// Parse a CIDR such as `10.0.0.0/8`, or a single address, which stands
+/// for itself alone. Host bits of a CIDR are cleared.
+pub fn parse_net(text: &str) -> Option<IpNet> {
+    if let Ok(net) = text.parse::<IpNet>() {
+        return Some(net.trunc());
+    }
+    text.parse::<IpAddr>().ok().map(IpNet::from)
+}
+
+/// Add `net` to `list`; false when it is already there.
+pub fn add(list: List, net: IpNet) -> bool {
+    let mut lists = LISTS.write();
+    let entries = lists.list_mut(list);
+    if entries.iter().any(|(n, _)| *n == net) {
+        return false;
+    }
+    entries.push((net, Instant::now()));
+    true
+}
+
+/// Remove `net` from both lists; false when neither held it.
+pub fn remove(net: IpNet) -> bool {
+    let mut lists = LISTS.write();
+    let before = lists.deny.len() + lists.allow.len();
+    lists.deny.retain(|(n, _)| *n != net);
+    lists.allow.retain(|(n, _)| *n != net);
+    lists.deny.len() + lists.allow.len() < before
+}
+
+/// The deny entry that refuses `addr`, or None when it may connect.
+pub fn denied(addr: IpAddr) -> Option<IpNet> {
+    LISTS.read().denied(addr)
+}
+
+/// Whether `addr` is in the allow list.
+pub fn allowed(addr: IpAddr) -> bool {
+    LISTS.read().allowed(addr)
+}
+
+/// Every entry, deny list first, each in the order it was added.
+pub fn entries() -> Vec<Entry> {
+    let lists = LISTS.read();
+    let now = Instant::now();
+    let entries = |list: List, nets: &[(IpNet, Instant)]| {
+        nets.iter()
+            .map(|(net, added)| Entry {
+                list,
+                net: *net,
+                age: now.duration_since(*added),
+            })
+            .collect::<Vec<_>>()
+    };
+    let mut all = entries(List::Deny, &lists.deny);
+    all.extend(entries(List::Allow, &lists.allow));
+    all
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn allow_entries_override_deny_entries() {
+        let now = Instant::now();
+        let lists = Lists {
+            deny: vec![(parse_net("10.0.0.0/8").unwrap(), now)],
+            allow: vec![(parse_net("10.1.2.3").unwrap(), now)],
+        };
+        let addr = |text: &str| text.parse::<IpAddr>().unwrap();
+        assert_eq!(lists.denied(addr("10.9.9.9")), parse_net("10.0.0.0/8"));
+        assert_eq!(lists.denied(addr("10.1.2.3")), None);
+        assert_eq!(lists.denied(addr("192.168.0.1")), None);
+        assert_eq!(lists.denied(addr("::1")), None);
+    }
+
+    #[test]
+    fn parses_cidrs_and_addresses() {
+        assert_eq!(parse_net("10.1.2.3/8"), "10.0.0.0/8".parse().ok());
+        assert_eq!(parse_net("2001:db8::1"), "2001:db8::1/128".parse().ok());
+        assert_eq!(parse_net("10.0.0.0/33"), None);
+        assert_eq!(parse_net("example.com"), None);
+    }
+}
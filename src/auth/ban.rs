@@ -0,0 +1,265 @@
+//! Temporary bans of client addresses after repeated authentication
+//! failures (`general.auth_ban_threshold`).
+//!
+//! Failures are counted per IP address over the last `auth_ban_window`.
+//! Reaching the threshold bans the address for `auth_ban_time`, and every
+//! further ban of the same address lasts twice as long as the previous
+//! one, up to `auth_ban_max_time`. An address that stays clean for
+//! `auth_ban_max_time` is forgotten, so its next ban starts short again.
+//! Addresses in the runtime allow list (`ALLOW ADDRESS`) are never
+//! banned. Bans live in memory only: a restart lifts them all.
+
+use log::warn;
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use std::collections::{HashMap, VecDeque};
+use std::net::IpAddr;
+use std::time::{Duration, Instant};
+
+use crate::config::{get_config, General};
+
+use super::access_list;
+
+/// What the bans are counted with, read from `[general]`.
+#[derive(Clone, Copy)]
+struct Policy {
+    threshold: usize,
+    window: Duration,
+    time: Duration,
+    max_time: Duration,
+}
+
+impl Policy {
+    fn new(general: &General) -> Option<Policy> {
+        if general.auth_ban_threshold == 0 {
+            return None;
+        }
+        Some(Policy {
+            threshold: general.auth_ban_threshold as usize,
+            window: general.auth_ban_window.as_std(),
+            time: general.auth_ban_time.as_std(),
+            max_time: general.auth_ban_max_time.as_std(),
+        })
+    }
+
+    /// Length of the ban that follows `bans` earlier ones.
+    fn ban_time(&self, bans: u32) -> Duration {
+        self.time
+            .saturating_mul(1 << bans.min(31))
+            .min(self.max_time.max(self.time))
+    }
+}
+
+struct Entry {
+    /// Failures within the window, oldest first.
+    failures: VecDeque<Instant>,
+    /// Number of bans so far; each one doubles the next.
+    bans: u32,
+    banned_at: Instant,
+    banned_until: Option<Instant>,
+    last_seen: Instant,
+}
+
+/// A banned address, as shown by `SHOW BANS`.
+pub struct Ban {
+    pub addr: IpAddr,
+    pub age: Duration,
+    pub remaining: Duration,
+    pub bans: u32,
+}
+
+#[derive(Default)]
+struct Bans {
+    entries: HashMap<IpAddr, Entry>,
+    last_prune: Option<Instant>,
+}
+
+impl Bans {
+    fn banned(&self, addr: IpAddr, now: Instant) -> Option<Duration> {
+        let until = self.entries.get(&addr)?.banned_until?;
+        (until > now).then(|| until - now)
+    }
+
+    /// Count a failure of `addr`; returns the length of the ban it
+    /// started, if any.
+    fn record_failure(&mut self, policy: Policy, addr: IpAddr, now: Instant) -> Option<Duration> {
+        self.prune(policy, now);
+        let entry = self.entries.entry(addr).or_insert_with(|| Entry {
+            failures: VecDeque::new(),
+            bans: 0,
+            banned_at: now,
+            banned_until: None,
+            last_seen: now,
+        });
+        entry.last_seen = now;
+        if entry.banned_until.is_some_and(|until| until > now) {
+            return None;
+        }
+        while entry
+            .failures
+            .front()
+            .is_some_and(|&at| now.duration_since(at) >= policy.window)
+        {
+            entry.failures.pop_front();
+        }
+        entry.failures.push_back(now);
+        if entry.failures.len() < policy.threshold {
+            return None;
+        }
+        let time = policy.ban_time(entry.bans);
+        entry.failures.clear();
+        entry.bans += 1;
+        entry.banned_at = now;
+        entry.banned_until = Some(now + time);
+        Some(time)
+    }
+
+    /// Forget addresses that are not banned and have not failed for
+    /// `auth_ban_max_time`; at most once per window.
+    fn prune(&mut self, policy: Policy, now: Instant) {
+        if self
+            .last_prune
+            .is_some_and(|at| now.duration_since(at) < policy.window)
+        {
+            return;
+        }
+        self.last_prune = Some(now);
+        let keep = policy.window.max(policy.max_time);
+        self.entries.retain(|_, entry| {
+            let active = entry
+                .banned_until
+                .map_or(entry.last_seen, |u| u.max(entry.last_seen));
+            active > now || now.duration_since(active) < keep
+        });
+    }
+
+    fn list(&self, now: Instant) -> Vec<Ban> {
+        let mut bans: Vec<Ban> = self
+            .entries
+            .iter()
+            .filter_map(|(addr, entry)| {
+                let until = entry.banned_until.filter(|&until| until > now)?;
+                Some(Ban {
+                    addr: *addr,
+                    age: now.duration_since(entry.banned_at),
+                    remaining: until - now,
+                    bans: entry.bans,
+                })
+            })
+            .collect();
+        bans.sort_by_key(|ban| std::cmp::Reverse(ban.remaining));
+        bans
+    }
+}
+
+static BANS: Lazy<Mutex<Bans>> = Lazy::new(|| Mutex::new(Bans::default()));
+
+/// Time left on the ban of `addr`, or None when it may connect.
+pub fn banned(addr: IpAddr) -> Option<Duration> {
+    Policy::new(&get_config().general)?;
+    if access_list::allowed(addr) {
+        return None;
+    }
+    BANS.lock().banned(addr, Instant::now())
+}
+
+/// Count a failed authentication from `addr`, banning it once it reaches
+/// `auth_ban_threshold` failures within `auth_ban_window`.
+pub fn record_failure(addr: IpAddr) {
+    let Some(policy) = Policy::new(&get_config().general) else {
+        return;
+    };
+    if access_list::allowed(addr) {
+        return;
+    }
+    let ban = BANS.lock().record_failure(policy, addr, Instant::now());
+    if let Some(time) = ban {
+        warn!(
+            "client address {addr} banned for {}s after {} authentication failures within {}s",
+            time.as_secs(),
+            policy.threshold,
+            policy.window.as_secs()
+        );
+    }
+}
+
+/// Addresses banned right now, longest remaining ban first.
+pub fn list() -> Vec<Ban> {
+    BANS.lock().list(Instant::now())
+}
+
+/// Lift the ban of `addr` and forget its failures; false when it was not
+/// banned.
+pub fn unban(addr: IpAddr) -> bool {
+    let now = Instant::now();
+    let mut bans = BANS.lock();
+    let was_banned = bans.banned(addr, now).is_some();
+    bans.entries.remove(&addr);
+    was_banned
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const POLICY: Policy = Policy {
+        threshold: 3,
+        window: Duration::from_secs(60),
+        time: Duration::from_secs(10),
+        max_time: Duration::from_secs(35),
+    };
+
+    #[test]
+    fn bans_after_threshold_within_window() {
+        let addr: IpAddr = "10.0.0.7".parse().unwrap();
+        let start = Instant::now();
+        let mut bans = Bans::default();
+        assert_eq!(bans.record_failure(POLICY, addr, start), None);
+        // The first failure has left the window by the third one.
+        let later = start + Duration::from_secs(61);
+        assert_eq!(
+            bans.record_failure(POLICY, addr, later - Duration::from_secs(1)),
+            None
+        );
+        assert_eq!(bans.record_failure(POLICY, addr, later), None);
+        assert_eq!(bans.banned(addr, later), None);
+        assert_eq!(
+            bans.record_failure(POLICY, addr, later),
+            Some(Duration::from_secs(10))
+        );
+        assert_eq!(bans.banned(addr, later), Some(Duration::from_secs(10)));
+        assert_eq!(bans.banned(addr, later + Duration::from_secs(10)), None);
+        assert_eq!(bans.list(later).len(), 1);
+    }
+
+    #[test]
+    fn repeated_bans_grow_up_to_max_time() {
+        let addr: IpAddr = "2001:db8::1".parse().unwrap();
+        let mut now = Instant::now();
+        let mut bans = Bans::default();
+        let mut times = Vec::new();
+        for _ in 0..4 {
+            for _ in 0..POLICY.threshold {
+                if let Some(time) = bans.record_failure(POLICY, addr, now) {
+                    times.push(time.as_secs());
+                    now += time;
+                }
+            }
+        }
+        assert_eq!(times, [10, 20, 35, 35]);
+    }
+
+    #[test]
+    fn clean_addresses_are_forgotten() {
+        let addr: IpAddr = "10.0.0.8".parse().unwrap();
+        let other: IpAddr = "10.0.0.9".parse().unwrap();
+        let start = Instant::now();
+        let mut bans = Bans::default();
+        for _ in 0..POLICY.threshold {
+            bans.record_failure(POLICY, addr, start);
+        }
+        assert_eq!(bans.entries[&addr].bans, 1);
+        bans.record_failure(POLICY, other, start + Duration::from_secs(200));
+        assert!(!bans.entries.contains_key(&addr));
+    }
+}
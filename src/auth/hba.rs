@@ -1,7 +1,9 @@
-use std::path::Path;
+use std::net::IpAddr;
+use std::path::{Path, PathBuf};
 use std::{fs, str::FromStr};
 
 use ipnet::IpNet;
+use log::warn;
 
 use crate::transport::ClientTransport;
 
@@ -66,6 +68,9 @@ pub enum HostType {
     Host,
     HostSSL,
     HostNoSSL,
+    /// Without GSSAPI encryption, which pg_doorman never negotiates: any
+    /// TCP connection.
+    HostNoGssEnc,
 }
 
 impl HostType {
@@ -75,6 +80,7 @@ impl HostType {
             "host" => Some(HostType::Host),
             "hostssl" => Some(HostType::HostSSL),
             "hostnossl" => Some(HostType::HostNoSSL),
+            "hostnogssenc" => Some(HostType::HostNoGssEnc),
             _ => None,
         }
     }
@@ -82,7 +88,7 @@ impl HostType {
     fn matches_ssl(&self, ssl: bool) -> bool {
         match self {
             HostType::Local => true,
-            HostType::Host => true,
+            HostType::Host | HostType::HostNoGssEnc => true,
             HostType::HostSSL => ssl,
             HostType::HostNoSSL => !ssl,
         }
@@ -106,8 +112,14 @@ pub enum CheckResult {
 #[derive(Debug, Default, Clone, PartialEq, Eq)]
 pub struct PgHba {
     pub rules: Vec<HbaRule>,
+    /// File the rules were loaded from (`{ path = "..." }`), which
+    /// `RELOAD HBA` reads again. None for inline content.
+    pub path: Option<String>,
 }
 
+/// How deep `include` directives may nest, as in PostgreSQL.
+const MAX_INCLUDE_DEPTH: usize = 10;
+
 // Human-readable formatting for pg_hba components
 impl std::fmt::Display for NameMatcher {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
@@ -125,6 +137,7 @@ impl std::fmt::Display for HostType {
             HostType::Host => "host",
             HostType::HostSSL => "hostssl",
             HostType::HostNoSSL => "hostnossl",
+            HostType::HostNoGssEnc => "hostnogssenc",
         };
         f.write_str(s)
     }
@@ -256,10 +269,7 @@ impl<'de> serde::Deserialize<'de> for PgHba {
                     return Ok(PgHba::from_content(&c));
                 }
                 if let Some(p) = path {
-                    let data = fs::read_to_string(&p).map_err(|e| {
-                        DeError::custom(format!("failed to read hba file {p}: {e}"))
-                    })?;
-                    return Ok(PgHba::from_content(&data));
+                    return PgHba::load(&p).map_err(DeError::custom);
                 }
                 Err(DeError::custom(
                     "expected either 'path' or 'content' field for PgHba",
@@ -278,71 +288,38 @@ impl PgHba {
         Ok(Self::from_content(&content))
     }
 
-    /// Parse from string content of a pg_hba.conf
+    /// Parse from string content of a pg_hba.conf. Lines that are not
+    /// rules pg_doorman can apply are skipped with a warning.
     pub fn from_content(content: &str) -> Self {
         let mut rules = Vec::new();
-        for raw_line in content.lines() {
-            let line = strip_comments(raw_line).trim();
-            if line.is_empty() {
-                continue;
-            }
-
-            let tokens = shell_like_split(line);
+        for (i, raw_line) in content.lines().enumerate() {
+            let tokens = shell_like_split(strip_comments(raw_line).trim());
             if tokens.is_empty() {
                 continue;
             }
-
-            // connection type
-            let Some(ht) = HostType::from_token(&tokens[0]) else {
-                continue;
-            };
-
-            // Minimal pg_hba format:
-            // type  database  user  address  method  [options]
-            // For local, address is omitted.
-            // We ignore database/user/options in this component.
-
-            // Ensure we have enough tokens to read method and optional address.
-            // We'll map positions based on host type.
-            // Parse database and user (common positions)
-            if tokens.len() < 3 {
-                continue;
-            }
-            let database = NameMatcher::from_token(&tokens[1]);
-            let user = NameMatcher::from_token(&tokens[2]);
-
-            let (method_idx, address_opt) = match ht {
-                HostType::Local => {
-                    // type database user method [options]
-                    if tokens.len() < 4 {
-                        continue;
-                    }
-                    let method_idx = 3;
-                    (method_idx, None)
-                }
-                _ => {
-                    // type database user address method [options]
-                    if tokens.len() < 5 {
-                        continue;
-                    }
-                    let addr_token = &tokens[3];
-                    let address = parse_address(addr_token);
-                    let method_idx = 4;
-                    (method_idx, address)
+            match parse_rule(&tokens) {
+                Ok(ParsedRule::Rule(rule)) => rules.push(rule),
+                Ok(ParsedRule::Unsupported(reason)) => {
+                    warn!("pg_hba line {}: skipping rule: {reason}", i + 1)
                 }
-            };
-
-            let method = AuthMethod::from_token(tokens[method_idx].as_str());
-
-            rules.push(HbaRule {
-                host_type: ht,
-                database,
-                user,
-                address: address_opt,
-                method,
-            });
+                Err(err) => warn!("pg_hba line {}: skipping line: {err}", i + 1),
+            }
         }
-        PgHba { rules }
+        PgHba { rules, path: None }
+    }
+
+    /// Load a pg_hba file, following its `include`, `include_if_exists`
+    /// and `include_dir` directives; relative names are resolved against
+    /// the directory of the file that names them. Unlike `from_content`,
+    /// a line that is not a valid rule is an error naming its file and
+    /// line, so a typo can't silently drop a rule.
+    pub fn load(path: &str) -> Result<Self, String> {
+        let mut rules = Vec::new();
+        load_file(Path::new(path), 0, &mut rules)?;
+        Ok(PgHba {
+            rules,
+            path: Some(path.to_string()),
+        })
     }
 
     /// Evaluate given connection parameters against parsed HBA rules.
@@ -410,6 +387,144 @@ impl PgHba {
     }
 }
 
+/// Append the rules of `path` and of the files it includes to `rules`.
+fn load_file(path: &Path, depth: usize, rules: &mut Vec<HbaRule>) -> Result<(), String> {
+    if depth > MAX_INCLUDE_DEPTH {
+        return Err(format!(
+            "{}: includes nested deeper than {MAX_INCLUDE_DEPTH} levels",
+            path.display()
+        ));
+    }
+    let content = fs::read_to_string(path)
+        .map_err(|e| format!("failed to read hba file {}: {e}", path.display()))?;
+    let dir = path.parent().unwrap_or(Path::new("."));
+    for (i, raw_line) in content.lines().enumerate() {
+        let at = || format!("{}:{}", path.display(), i + 1);
+        let tokens = shell_like_split(strip_comments(raw_line).trim());
+        let Some(keyword) = tokens.first() else {
+            continue;
+        };
+        match keyword.as_str() {
+            "include" | "include_if_exists" | "include_dir" => {
+                let [_, target] = tokens.as_slice() else {
+                    return Err(format!("{}: {keyword} takes one file name", at()));
+                };
+                let target = dir.join(target);
+                match keyword.as_str() {
+                    "include_if_exists" if !target.exists() => {}
+                    "include_dir" => {
+                        for file in conf_files(&target).map_err(|e| format!("{}: {e}", at()))? {
+                            load_file(&file, depth + 1, rules)?;
+                        }
+                    }
+                    _ => load_file(&target, depth + 1, rules)?,
+                }
+            }
+            _ => match parse_rule(&tokens).map_err(|e| format!("{}: {e}", at()))? {
+                ParsedRule::Rule(rule) => rules.push(rule),
+                ParsedRule::Unsupported(reason) => warn!("{}: skipping rule: {reason}", at()),
+            },
+        }
+    }
+    Ok(())
+}
+
+/// The `*.conf` files of an `include_dir` directory in name order,
+/// skipping hidden ones, as PostgreSQL does.
+fn conf_files(dir: &Path) -> Result<Vec<PathBuf>, String> {
+    let entries = fs::read_dir(dir)
+        .map_err(|e| format!("failed to read directory {}: {e}", dir.display()))?;
+    let mut files: Vec<PathBuf> = entries
+        .filter_map(|entry| entry.ok().map(|entry| entry.path()))
+        .filter(|path| {
+            let name = path
+                .file_name()
+                .and_then(|name| name.to_str())
+                .unwrap_or("");
+            !name.starts_with('.') && name.ends_with(".conf") && path.is_file()
+        })
+        .collect();
+    files.sort();
+    Ok(files)
+}
+
+/// A rule line as parsed.
+enum ParsedRule {
+    Rule(HbaRule),
+    /// Valid in PostgreSQL but not something pg_doorman can match, with
+    /// the reason.
+    Unsupported(String),
+}
+
+/// One rule line, checked: the connection type must be known and a host
+/// rule's address must be `all`, a CIDR or an address and a netmask.
+/// Rules that can't be matched here (`hostgssenc`, `samehost`,
+/// `samenet`, host names) are returned as unsupported.
+fn parse_rule(tokens: &[String]) -> Result<ParsedRule, String> {
+    if tokens[0].eq_ignore_ascii_case("hostgssenc") {
+        return Ok(ParsedRule::Unsupported(
+            "hostgssenc never matches: pg_doorman does not support GSSAPI encryption".into(),
+        ));
+    }
+    let host_type = HostType::from_token(&tokens[0])
+        .ok_or_else(|| format!("unknown connection type \"{}\"", tokens[0]))?;
+    let mut fields = if host_type == HostType::Local { 4 } else { 5 };
+    if tokens.len() < fields {
+        return Err(format!(
+            "a {host_type} rule needs at least {fields} fields, got {}",
+            tokens.len()
+        ));
+    }
+    let address = match host_type {
+        HostType::Local => None,
+        _ => {
+            let token = tokens[3].as_str();
+            if token.eq_ignore_ascii_case("all") {
+                None
+            } else if token.eq_ignore_ascii_case("samehost")
+                || token.eq_ignore_ascii_case("samenet")
+            {
+                return Ok(ParsedRule::Unsupported(format!(
+                    "address {token} is not supported, list the networks as CIDRs"
+                )));
+            } else if let Some(net) = parse_address(token) {
+                Some(net)
+            } else if let Ok(ip) = IpAddr::from_str(token) {
+                // An address and a netmask, in two fields.
+                let mask = IpAddr::from_str(&tokens[4])
+                    .map_err(|_| format!("address \"{token}\" needs a CIDR mask or a netmask"))?;
+                fields += 1;
+                if tokens.len() < fields {
+                    return Err(format!(
+                        "a {host_type} rule with a netmask needs at least {fields} fields, got {}",
+                        tokens.len()
+                    ));
+                }
+                Some(
+                    IpNet::with_netmask(ip, mask)
+                        .map_err(|_| format!("invalid netmask \"{mask}\" for \"{token}\""))?,
+                )
+            } else if token.contains('/') {
+                return Err(format!(
+                    "invalid address \"{token}\": expected all, a CIDR such as 10.0.0.0/8 \
+                     or an address and a netmask"
+                ));
+            } else {
+                return Ok(ParsedRule::Unsupported(format!(
+                    "host name \"{token}\" is not supported, list its addresses as CIDRs"
+                )));
+            }
+        }
+    };
+    Ok(ParsedRule::Rule(HbaRule {
+        host_type,
+        database: NameMatcher::from_token(&tokens[1]),
+        user: NameMatcher::from_token(&tokens[2]),
+        address,
+        method: AuthMethod::from_token(&tokens[fields - 1]),
+    }))
+}
+
 fn strip_comments(s: &str) -> &str {
     match s.find('#') {
         Some(idx) => &s[..idx],
@@ -444,10 +559,9 @@ fn shell_like_split(line: &str) -> Vec<String> {
 }
 
 fn parse_address(token: &str) -> Option<IpNet> {
-    // token may be:
-    // - a CIDR: 192.168.0.0/24 or 2001:db8::/32
-    // - an IP + mask: 192.168.0.0 255.255.255.0 (but this would be two tokens; we don't support here)
-    // - a single IP meaning /32 or /128 (not standard for pg_hba, so keep to CIDR)
+    // token may be a CIDR: 192.168.0.0/24 or 2001:db8::/32. An IP + mask
+    // (192.168.0.0 255.255.255.0) spans two tokens and is handled by
+    // `parse_rule`.
     IpNet::from_str(token).ok()
 }
 
@@ -467,6 +581,7 @@ hostnossl all all 127.0.0.1/32 trust
         ClientTransport::Tcp {
             peer: SocketAddr::new(peer, 54321),
             ssl,
+            listener: None,
         }
     }
 
@@ -585,6 +700,133 @@ hostnossl all all 127.0.0.1/32 trust
         let _ = fs::remove_file(&path);
     }
 
+    /// A fresh directory under the system temp dir with the given files.
+    fn hba_dir(files: &[(&str, &str)]) -> PathBuf {
+        use std::time::{SystemTime, UNIX_EPOCH};
+        let uniq = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .unwrap()
+            .as_nanos();
+        let dir = std::env::temp_dir().join(format!("pg_doorman_test_hba_dir_{uniq}"));
+        for (name, content) in files {
+            let path = dir.join(name);
+            fs::create_dir_all(path.parent().unwrap()).expect("create hba dir");
+            fs::write(&path, content).expect("write hba file");
+        }
+        dir
+    }
+
+    #[test]
+    fn load_follows_includes_in_order() {
+        let dir = hba_dir(&[
+            (
+                "pg_hba.conf",
+                "include rules/base.conf\n\
+                 include_if_exists missing.conf\n\
+                 include_dir conf.d\n\
+                 host all all all reject\n",
+            ),
+            ("rules/base.conf", "local all all trust\n"),
+            ("conf.d/20-bob.conf", "host all bob 10.0.0.0/8 md5\n"),
+            ("conf.d/10-alice.conf", "host all alice 10.0.0.0/8 md5\n"),
+            ("conf.d/.00-hidden.conf", "host all all all trust\n"),
+            ("conf.d/notes.txt", "host all all all trust\n"),
+        ]);
+        let path = dir.join("pg_hba.conf").display().to_string();
+        let hba = PgHba::load(&path).expect("load hba with includes");
+        assert_eq!(
+            hba.to_string(),
+            "local all all trust\n\
+             host all alice 10.0.0.0/8 md5\n\
+             host all bob 10.0.0.0/8 md5\n\
+             host all all reject"
+        );
+        assert_eq!(hba.path.as_deref(), Some(path.as_str()));
+        let _ = fs::remove_dir_all(&dir);
+    }
+
+    #[test]
+    fn load_reports_file_and_line_of_bad_rules() {
+        let dir = hba_dir(&[
+            (
+                "typo.conf",
+                "host all all 10.0.0.0/8 md5\nhots all all 10.0.0.0/8 md5\n",
+            ),
+            ("cidr.conf", "# db hosts\nhost all all 10.0.0.0/33 md5\n"),
+            ("short.conf", "host all all md5\n"),
+            ("missing.conf", "include nowhere.conf\n"),
+            ("loop.conf", "include loop.conf\n"),
+        ]);
+        let load = |name: &str| PgHba::load(&dir.join(name).display().to_string()).unwrap_err();
+        let err = load("typo.conf");
+        assert!(
+            err.contains("typo.conf:2: unknown connection type \"hots\""),
+            "{err}"
+        );
+        let err = load("cidr.conf");
+        assert!(
+            err.contains("cidr.conf:2: invalid address \"10.0.0.0/33\""),
+            "{err}"
+        );
+        assert!(load("short.conf").contains("needs at least 5 fields"));
+        assert!(load("missing.conf").contains("failed to read hba file"));
+        assert!(load("loop.conf").contains("nested deeper than 10 levels"));
+        let _ = fs::remove_dir_all(&dir);
+    }
+
+    #[test]
+    fn address_and_netmask_form() {
+        let hba = PgHba::from_content(
+            "host all all 10.1.0.0 255.255.0.0 md5\n\
+             host all all 10.0.0.0 255.0.255.0 trust\n\
+             host all all 10.2.0.0 md5\n\
+             host all all 2001:db8:: ffff:ffff:: scram-sha-256",
+        );
+        assert_eq!(
+            hba.to_string(),
+            "host all all 10.1.0.0/16 md5\nhost all all 2001:db8::/32 scram-sha-256"
+        );
+        let ip = IpAddr::V4(Ipv4Addr::new(10, 1, 2, 3));
+        assert_eq!(
+            hba.check_hba(&tcp(ip, false), "md5", "alice", "app"),
+            CheckResult::Allow
+        );
+        let ip = IpAddr::V4(Ipv4Addr::new(10, 2, 2, 3));
+        assert_eq!(
+            hba.check_hba(&tcp(ip, false), "md5", "alice", "app"),
+            CheckResult::NotMatched
+        );
+    }
+
+    #[test]
+    fn unsupported_rules_are_skipped() {
+        // A skipped rule must not turn into one matching every address.
+        let content = "host all all samehost trust\n\
+                       host all all samenet trust\n\
+                       host all all db.example.com trust\n\
+                       host all all .example.com trust\n\
+                       hostgssenc all all all trust\n\
+                       hostnogssenc all all 10.0.0.0/8 md5\n";
+        let hba = PgHba::from_content(content);
+        assert_eq!(hba.to_string(), "hostnogssenc all all 10.0.0.0/8 md5");
+        let ip = IpAddr::V4(Ipv4Addr::new(10, 1, 2, 3));
+        assert_eq!(
+            hba.check_hba(&tcp(ip, true), "md5", "alice", "app"),
+            CheckResult::Allow
+        );
+        let ip = IpAddr::V4(Ipv4Addr::new(192, 168, 1, 1));
+        assert_eq!(
+            hba.check_hba(&tcp(ip, false), "md5", "alice", "app"),
+            CheckResult::NotMatched
+        );
+
+        // A file with them loads, keeping only the rules it can apply.
+        let dir = hba_dir(&[("pg_hba.conf", content)]);
+        let hba = PgHba::load(&dir.join("pg_hba.conf").display().to_string()).unwrap();
+        assert_eq!(hba.to_string(), "hostnogssenc all all 10.0.0.0/8 md5");
+        let _ = fs::remove_dir_all(&dir);
+    }
+
     #[test]
     fn serde_map_missing_fields_error() {
         // Missing both path and content should error
@@ -1,5 +1,6 @@
 use super::{
-    eval_hba_for_pool_password, JWT_PUB_KEY_PASSWORD_PREFIX, MD5_PASSWORD_PREFIX, SCRAM_SHA_256,
+    eval_hba_for_pool_password, JWT_PUB_KEY_PASSWORD_PREFIX, MD5_PASSWORD_PREFIX,
+    SCRAM_PASSTHROUGH_PASSWORD, SCRAM_SHA_256,
 };
 use crate::auth::hba::{CheckResult, PgHba};
 use crate::errors::ClientIdentifier;
@@ -13,6 +14,7 @@ fn base_ci() -> ClientIdentifier {
         is_talos: false,
         hba_scram: CheckResult::NotMatched,
         hba_md5: CheckResult::NotMatched,
+        secure_transport: false,
     }
 }
 
@@ -21,7 +23,11 @@ fn ci_from_hba(hba_text: &str, ssl: bool) -> ClientIdentifier {
     use crate::transport::ClientTransport;
     let hba = PgHba::from_content(hba_text);
     let peer = std::net::SocketAddr::new("127.0.0.1".parse().unwrap(), 12345);
-    let transport = ClientTransport::Tcp { peer, ssl };
+    let transport = ClientTransport::Tcp {
+        peer,
+        ssl,
+        listener: None,
+    };
     let username = "user";
     let database = "db";
     let hba_scram = hba.check_hba(&transport, "scram-sha-256", username, database);
@@ -51,6 +57,22 @@ fn empty_password_trust_when_any_trust() {
     assert_eq!(eval_hba_for_pool_password("", &ci2), CheckResult::Trust);
 }
 
+#[test]
+fn scram_passthrough_is_never_trusted() {
+    let mut ci = base_ci();
+    ci.hba_scram = CheckResult::Trust;
+    assert_eq!(
+        eval_hba_for_pool_password(SCRAM_PASSTHROUGH_PASSWORD, &ci),
+        CheckResult::Allow
+    );
+
+    ci.hba_scram = CheckResult::Deny;
+    assert_eq!(
+        eval_hba_for_pool_password(SCRAM_PASSTHROUGH_PASSWORD, &ci),
+        CheckResult::Deny
+    );
+}
+
 #[test]
 fn scram_password_trust_cases() {
     let mut ci = base_ci();
@@ -1,4 +1,6 @@
+pub mod access_list;
 pub mod auth_query;
+pub mod ban;
 pub mod hba;
 #[cfg(test)]
 mod hba_eval_tests;
@@ -26,17 +28,19 @@ use crate::config::BackendAuthMethod;
 use crate::config::{get_config, PoolMode};
 use crate::errors::{ClientIdentifier, Error};
 use crate::messages::constants::{
-    JWT_PUB_KEY_PASSWORD_PREFIX, MD5_PASSWORD_PREFIX, SASL_CONTINUE, SASL_FINAL, SCRAM_SHA_256,
+    JWT_PUB_KEY_PASSWORD_PREFIX, MD5_PASSWORD_PREFIX, SASL_CONTINUE, SASL_FINAL,
+    SCRAM_PASSTHROUGH_PASSWORD, SCRAM_SHA_256,
 };
 use crate::messages::{
     error_response, error_response_terminal, md5_challenge, md5_hash_password,
     md5_hash_second_pass, plain_password_challenge, read_password, scram_server_response,
-    scram_start_challenge, vec_to_string, wrong_password,
+    scram_start_challenge, vec_to_string, write_all_flush, wrong_password,
 };
 use crate::pool::{
-    create_dynamic_pool, get_auth_query_state, get_pool, get_pool_config, is_dynamic_pool,
-    ConnectionPool, PoolIdentifier,
+    create_dynamic_pool, create_wildcard_user_pool, get_auth_query_state, get_pool,
+    get_pool_config, is_dynamic_pool, ConnectionPool, PoolIdentifier, PoolInitGuard,
 };
+use crate::server::scram_relay::{self, Reply};
 use crate::server::ServerParameters;
 
 /// Canonicalised set of GUC names the operator put under
@@ -99,10 +103,21 @@ where
                 "HBA failed for admin user: {username_from_parameters}"
             ));
             warn!("{error}");
+            crate::web::metrics::record_auth_failure("hba_reject", None);
             wrong_password(write, username_from_parameters).await?;
             return Err(error);
         }
-        let (tx, sp) = authenticate_admin(read, write, username_from_parameters).await?;
+        let (tx, sp) = if get_config().general.is_stats_user(username_from_parameters) {
+            authenticate_stats_user(
+                read,
+                write,
+                username_from_parameters,
+                &client_identifier.addr,
+            )
+            .await?
+        } else {
+            authenticate_admin(read, write, username_from_parameters).await?
+        };
         (tx, sp, None)
     }
     // Authenticate normal user.
@@ -154,6 +169,11 @@ where
         ));
 
         warn!("{error}");
+        let known = username_from_parameters == config.general.admin_username;
+        crate::web::metrics::record_auth_failure(
+            "bad_password",
+            known.then_some(username_from_parameters),
+        );
         wrong_password(write, username_from_parameters).await?;
 
         return Err(error);
@@ -162,6 +182,66 @@ where
     Ok((false, ServerParameters::admin()))
 }
 
+/// Authenticate a `stats_users` member for the admin database. There is
+/// no separate secret: the password is the one configured for the same
+/// user under `pools.*.users`.
+async fn authenticate_stats_user<S, T>(
+    read: &mut S,
+    write: &mut T,
+    username_from_parameters: &str,
+    client_addr: &str,
+) -> Result<(bool, ServerParameters), Error>
+where
+    S: AsyncReadExt + Unpin,
+    T: AsyncWriteExt + Unpin,
+{
+    let password = crate::config::config_arc()
+        .pools
+        .values()
+        .flat_map(|pool| pool.users.iter())
+        .find(|user| user.username == username_from_parameters && !user.password.is_empty())
+        .map(|user| user.password.clone())
+        .unwrap_or_default();
+
+    if password.starts_with(SCRAM_SHA_256) {
+        authenticate_with_scram(
+            read,
+            write,
+            &password,
+            None,
+            username_from_parameters,
+            "pgdoorman",
+            client_addr,
+        )
+        .await?;
+    } else if let Some(hash) = password.strip_prefix(MD5_PASSWORD_PREFIX) {
+        let salt = md5_challenge(write).await?;
+        let password_response = read_password(read).await?;
+        if md5_hash_second_pass(hash, &salt) != password_response {
+            let error = Error::AuthError(format!(
+                "Invalid password for stats user: {username_from_parameters}"
+            ));
+            warn!("{error}");
+            crate::web::metrics::record_auth_failure(
+                "bad_password",
+                Some(username_from_parameters),
+            );
+            wrong_password(write, username_from_parameters).await?;
+            return Err(error);
+        }
+    } else {
+        let error = Error::AuthError(format!(
+            "stats user {username_from_parameters} has no MD5 or SCRAM password under pools.*.users"
+        ));
+        warn!("{error}");
+        crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
+        wrong_password(write, username_from_parameters).await?;
+        return Err(error);
+    }
+
+    Ok((false, ServerParameters::admin()))
+}
+
 /// Authenticate a normal user with various methods
 fn eval_hba_for_pool_password(pool_password: &str, ci: &ClientIdentifier) -> CheckResult {
     // Determine HBA outcome based on stored pool password type and HBA checks attached to client identifier
@@ -177,6 +257,18 @@ fn eval_hba_for_pool_password(pool_password: &str, ci: &ClientIdentifier) -> Che
         return CheckResult::Trust;
     }
 
+    // PostgreSQL checks the proof of a relayed login, so a trust rule
+    // can't skip it.
+    if pool_password == SCRAM_PASSTHROUGH_PASSWORD {
+        if ci.hba_scram == CheckResult::Deny
+            || (ci.hba_scram == CheckResult::NotMatched
+                && (ci.hba_md5 == CheckResult::Deny || ci.hba_md5 == CheckResult::NotMatched))
+        {
+            return CheckResult::Deny;
+        }
+        return CheckResult::Allow;
+    }
+
     if pool_password.starts_with(SCRAM_SHA_256) {
         // If SCRAM is trusted or MD5 trust is allowed while SCRAM is not matched, treat as trust
         if ci.hba_scram == CheckResult::Trust
@@ -223,12 +315,33 @@ where
     S: AsyncReadExt + Unpin,
     T: AsyncWriteExt + Unpin,
 {
-    let mut pool = match get_pool(pool_name, client_identifier.username.as_str()) {
+    // A database without a pool of its own gets one from its
+    // `pools."*"` template once the client has authenticated against the
+    // template's users.
+    let (autodb_template, wildcard_user) = {
+        let config = crate::config::config_arc();
+        match config.pools.get(pool_name) {
+            Some(pool_config) => (None, pool_config.wildcard_user().cloned()),
+            None => match config.autodb_template(pool_name) {
+                Some((_, template)) => (Some(template.clone()), template.wildcard_user().cloned()),
+                None => (None, None),
+            },
+        }
+    };
+    let autodb = autodb_template.is_some();
+    // Set when this login creates the pool of a "*" user; committed once
+    // the first backend connection is up.
+    let mut init_guard = None;
+    // A "*" user's pool, or an autodb pool, is built only once the client
+    // has proven who it is with the template's credentials; `pool` stays
+    // `None` until then.
+    let (mut pool, user) = match get_pool(pool_name, client_identifier.username.as_str()) {
         Some(pool) => {
             // Dynamic pools (created by auth_query passthrough) have empty passwords.
             // Re-authenticate via auth_query to verify credentials on every connection.
+            // Pools of "*" users carry the template's credentials instead.
             let pool_id = PoolIdentifier::new(pool_name, client_identifier.username.as_str());
-            if is_dynamic_pool(&pool_id) {
+            if is_dynamic_pool(&pool_id) && wildcard_user.is_none() {
                 return try_auth_query(
                     read,
                     write,
@@ -239,27 +352,46 @@ where
                 )
                 .await;
             }
-            pool
+            let user = pool.settings.user.clone();
+            (Some(pool), user)
         }
         None => {
-            // Static user not found — try auth_query
-            return try_auth_query(
-                read,
-                write,
-                client_identifier,
-                pool_name,
-                username_from_parameters,
-                prepared_statements_enabled,
-            )
-            .await;
+            let template_user = autodb_template.as_ref().and_then(|template| {
+                template
+                    .users
+                    .iter()
+                    .find(|user| user.username == client_identifier.username)
+                    .cloned()
+            });
+            match template_user.or(wildcard_user) {
+                Some(user) => (None, user),
+                None => {
+                    // auth_query looks users up through the pool, so an
+                    // auth_query template needs its pool first.
+                    if autodb_template.is_some_and(|template| template.auth_query.is_some()) {
+                        ensure_autodb_pool(write, pool_name, &client_identifier.username).await?;
+                    }
+                    // Static user not found — try auth_query
+                    return try_auth_query(
+                        read,
+                        write,
+                        client_identifier,
+                        pool_name,
+                        username_from_parameters,
+                        prepared_statements_enabled,
+                    )
+                    .await;
+                }
+            }
         }
     };
 
-    let pool_password = pool.settings.user.password.clone();
+    let pool_password = user.password.clone();
 
     // Evaluate HBA once for this connection
     let hba_decision = eval_hba_for_pool_password(&pool_password, client_identifier);
     if hba_decision == CheckResult::Deny {
+        crate::web::metrics::record_auth_failure("hba_reject", Some(username_from_parameters));
         error_response_terminal(
         write,
         format!(
@@ -276,52 +408,64 @@ where
     )));
     }
 
+    let mut client_key = None;
     if client_identifier.is_talos || hba_decision == CheckResult::Trust {
         // Pass, client already authenticated (talos) or HBA Trust
-    } else if pool.settings.user.auth_pam_service.is_some() {
+    } else if let Some(service) = &user.auth_pam_service {
+        require_tls_for_plain_auth(write, client_identifier, "PAM").await?;
         authenticate_with_pam(
             read,
             write,
-            &pool,
+            service,
+            username_from_parameters,
+            pool_name,
+            &client_identifier.addr,
+        )
+        .await?;
+    } else if pool_password == SCRAM_PASSTHROUGH_PASSWORD {
+        // PostgreSQL checks the proof, so the relay needs the pool's
+        // backend before the client is authenticated. A "*" user's pool
+        // built here is dropped with `init_guard` if the login fails.
+        if pool.is_none() {
+            let (new_pool, guard) =
+                create_pool_after_auth(write, pool_name, &client_identifier.username, autodb)
+                    .await?;
+            pool = Some(new_pool);
+            init_guard = Some(guard);
+        }
+        authenticate_with_scram_relay(
+            read,
+            write,
+            pool.as_ref().unwrap(),
             username_from_parameters,
             pool_name,
             &client_identifier.addr,
         )
         .await?;
     } else if pool_password.starts_with(SCRAM_SHA_256) {
-        let client_key = authenticate_with_scram(
+        client_key = authenticate_with_scram(
             read,
             write,
             pool_password.as_str(),
+            user.next_password.as_deref(),
             username_from_parameters,
             pool_name,
             &client_identifier.addr,
         )
         .await?;
-
-        // For static passthrough: promote ScramPending → ScramPassthrough
-        if let Some(ref client_key) = client_key {
-            if let Some(ref ba_lock) = pool.address.backend_auth {
-                let needs_update = matches!(*ba_lock.read(), BackendAuthMethod::ScramPending);
-                if needs_update {
-                    *ba_lock.write() = BackendAuthMethod::ScramPassthrough(client_key.clone());
-                    info!(
-                        "[{username_from_parameters}@{pool_name}] static passthrough: ClientKey stored after SCRAM auth"
-                    );
-                }
-            }
-        }
     } else if pool_password.starts_with(MD5_PASSWORD_PREFIX) {
         authenticate_with_md5(
             read,
             write,
             pool_password.as_str(),
+            user.next_password.as_deref(),
             username_from_parameters,
-            &pool,
+            pool_name,
             &client_identifier.addr,
         )
         .await?;
     } else if pool_password.starts_with(JWT_PUB_KEY_PASSWORD_PREFIX) {
+        require_tls_for_plain_auth(write, client_identifier, "JWT").await?;
         authenticate_with_jwt(
             read,
             write,
@@ -336,6 +480,7 @@ where
         .await?;
     } else {
         warn!("[{username_from_parameters}@{pool_name}] unsupported password type");
+        crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
         error_response_terminal(
             write,
             "Authentication method not supported. Please contact your database administrator.",
@@ -347,6 +492,30 @@ where
         )));
     }
 
+    let mut pool = match pool {
+        Some(pool) => pool,
+        None => {
+            let (pool, guard) =
+                create_pool_after_auth(write, pool_name, &client_identifier.username, autodb)
+                    .await?;
+            init_guard = Some(guard);
+            pool
+        }
+    };
+
+    // For static passthrough: promote ScramPending → ScramPassthrough
+    if let Some(ref client_key) = client_key {
+        if let Some(ref ba_lock) = pool.address.backend_auth {
+            let needs_update = matches!(*ba_lock.read(), BackendAuthMethod::ScramPending);
+            if needs_update {
+                *ba_lock.write() = BackendAuthMethod::ScramPassthrough(client_key.clone());
+                info!(
+                    "[{username_from_parameters}@{pool_name}] static passthrough: ClientKey stored after SCRAM auth"
+                );
+            }
+        }
+    }
+
     let transaction_mode = pool.settings.pool_mode == PoolMode::Transaction;
     *prepared_statements_enabled = transaction_mode && pool.prepared_statement_cache.is_some();
 
@@ -382,6 +551,10 @@ where
         }
     };
 
+    if let Some(init_guard) = init_guard {
+        init_guard.commit();
+    }
+
     // Capture operator-managed startup-parameter keys from the same
     // pool snapshot that produced `server_parameters`. The client
     // startup path used to read this set with a second `POOLS` global
@@ -395,11 +568,105 @@ where
     Ok((transaction_mode, server_parameters, operator_managed_keys))
 }
 
+/// Build the pool for a client that has authenticated with a template's
+/// credentials: the database's pool first when it comes from a
+/// `pools."*"` template (`autodb`), then the user's when it is a "*" user.
+async fn create_pool_after_auth<T>(
+    write: &mut T,
+    pool_name: &str,
+    username: &str,
+    autodb: bool,
+) -> Result<(ConnectionPool, PoolInitGuard), Error>
+where
+    T: AsyncWriteExt + Unpin,
+{
+    if autodb {
+        ensure_autodb_pool(write, pool_name, username).await?;
+        if let Some(pool) = get_pool(pool_name, username) {
+            return Ok((pool, PoolInitGuard::already_committed()));
+        }
+    }
+    match create_wildcard_user_pool(pool_name, username) {
+        Ok(created) => Ok(created),
+        Err(err) => {
+            error!("[{username}@{pool_name}] failed to create pool for \"*\" user: {err}");
+            error_response(
+                write,
+                &format!(
+                    "No connection pool configured for database: {pool_name}, \
+                     user: {username}. Please check your connection parameters."
+                ),
+                "3D000",
+            )
+            .await?;
+            Err(err)
+        }
+    }
+}
+
+/// Create the pool of a database served by a `pools."*"` template,
+/// answering the client when that is refused or fails.
+async fn ensure_autodb_pool<T>(write: &mut T, pool_name: &str, username: &str) -> Result<(), Error>
+where
+    T: AsyncWriteExt + Unpin,
+{
+    let Err(err) = crate::pool::autodb::ensure(pool_name).await else {
+        return Ok(());
+    };
+    warn!("[{username}@{pool_name}] no pool from the template: {err}");
+    match &err {
+        Error::ClientError(reason) => error_response_terminal(write, reason, "53300").await?,
+        _ => {
+            error_response(
+                write,
+                &format!(
+                    "No connection pool configured for database: {pool_name}, \
+                     user: {username}. Please check your connection parameters."
+                ),
+                "3D000",
+            )
+            .await?
+        }
+    }
+    Err(err)
+}
+
+/// Refuse a login that would send `method`'s secret in clear text over
+/// plain TCP when `general.plain_auth_require_tls` is on, before the
+/// client is asked for it.
+pub(crate) async fn require_tls_for_plain_auth<T>(
+    write: &mut T,
+    client_identifier: &ClientIdentifier,
+    method: &str,
+) -> Result<(), Error>
+where
+    T: AsyncWriteExt + Unpin,
+{
+    if client_identifier.secure_transport
+        || !crate::config::config_arc().general.plain_auth_require_tls
+    {
+        return Ok(());
+    }
+    warn!("{method} login of {client_identifier} refused: plain_auth_require_tls is on and the connection is not encrypted");
+    crate::web::metrics::record_auth_failure("hba_reject", Some(&client_identifier.username));
+    error_response_terminal(
+        write,
+        &format!(
+            "{method} authentication sends the password in clear text and is allowed only over TLS. Connect with sslmode=require."
+        ),
+        "28000",
+    )
+    .await?;
+    Err(Error::HbaForbiddenError(format!(
+        "{method} authentication without TLS refused for client: {client_identifier}"
+    )))
+}
+
 /// Authenticate a user with PAM
 async fn authenticate_with_pam<S, T>(
     read: &mut S,
     write: &mut T,
-    pool: &ConnectionPool,
+    service: &str,
     username_from_parameters: &str,
     pool_name: &str,
     client_addr: &str,
@@ -415,6 +682,7 @@ where
         Ok(p) => p,
         Err(err) => {
             error!("[{username_from_parameters}@{pool_name}] PAM: failed to read password from {client_addr}: {err}");
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
             error_response_terminal(
                 write,
                 "Invalid password format. Password must be valid UTF-8 text.",
@@ -424,9 +692,8 @@ where
             return Err(err);
         }
     };
-    let service = pool.settings.user.auth_pam_service.clone().unwrap();
     match pam_auth(
-        service.as_str(),
+        service,
         username_from_parameters,
         password_response.as_str(),
     ) {
@@ -435,6 +702,10 @@ where
             error!(
                 "[{username_from_parameters}@{pool_name}] PAM authentication failed from {client_addr} (service={service}): {err}"
             );
+            crate::web::metrics::record_auth_failure(
+                "bad_password",
+                Some(username_from_parameters),
+            );
             error_response_terminal(
                 write,
                 "Authentication failed. Please check your username and password.",
@@ -450,12 +721,105 @@ where
     Ok(())
 }
 
+/// Authenticate a scram-passthrough user: relay the client's SCRAM
+/// exchange to a new backend connection and park that connection for the
+/// pool once PostgreSQL accepts the proof.
+async fn authenticate_with_scram_relay<S, T>(
+    read: &mut S,
+    write: &mut T,
+    pool: &ConnectionPool,
+    username_from_parameters: &str,
+    pool_name: &str,
+    client_addr: &str,
+) -> Result<(), Error>
+where
+    S: AsyncReadExt + Unpin,
+    T: AsyncWriteExt + Unpin,
+{
+    let mut server = match pool.database.server_pool().scram_relay_connect().await {
+        Ok(server) => server,
+        Err(err) => {
+            warn!("[{username_from_parameters}@{pool_name}] scram-passthrough: no backend connection to relay {client_addr} on: {err}");
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
+            error_response_terminal(
+                write,
+                "Authentication is unavailable: the database server could not be reached to check the password.",
+                "08006",
+            )
+            .await?;
+            return Err(err);
+        }
+    };
+    scram_start_challenge(write).await?;
+    loop {
+        let message = read_password(read).await?;
+        scram_relay::send(&mut server, &message).await?;
+        // AuthenticationSASLFinal is followed by the server's verdict
+        // without another client message.
+        let reply = match scram_relay::reply(&mut server).await? {
+            Reply::Final(message) => {
+                write_all_flush(write, &message).await?;
+                scram_relay::reply(&mut server).await?
+            }
+            reply => reply,
+        };
+        match reply {
+            Reply::Continue(message) => write_all_flush(write, &message).await?,
+            Reply::Ok => break,
+            Reply::Final(_) => {
+                return Err(Error::ProtocolSyncError(
+                    "server sent a second SASL final message".to_string(),
+                ));
+            }
+            Reply::Refused(err) => {
+                warn!(
+                    "[{username_from_parameters}@{pool_name}] scram-passthrough: server refused {client_addr}: {}",
+                    err.message
+                );
+                crate::web::metrics::record_auth_failure(
+                    "bad_password",
+                    Some(username_from_parameters),
+                );
+                let code = if err.code.is_empty() {
+                    "28P01"
+                } else {
+                    err.code.as_str()
+                };
+                error_response_terminal(write, &err.message, code).await?;
+                return Err(Error::AuthError(format!(
+                    "scram-passthrough: server refused user {username_from_parameters}: {}",
+                    err.message
+                )));
+            }
+        }
+    }
+    // Parked logins share the pool size with the servers the pool holds
+    // and age out like an idle server.
+    let user = &pool.settings.user;
+    let pool_size = user.max_pool_size.unwrap_or(0).max(user.pool_size) as usize;
+    let room = pool_size.saturating_sub(pool.database.status().size);
+    let max_age = [
+        pool.settings.idle_timeout_ms(),
+        pool.settings.server_lifetime_ms(),
+    ]
+    .into_iter()
+    .filter(|ms| *ms > 0)
+    .min()
+    .map(std::time::Duration::from_millis);
+    scram_relay::park(&pool.address, server, room, max_age);
+    Ok(())
+}
+
 /// Authenticate a user with SCRAM-SHA-256.
 /// Returns the ClientKey extracted from the client's SCRAM proof on success.
+/// `next_password` is a second verifier accepted during password rotation;
+/// `User::validate` guarantees it shares salt and iterations with
+/// `pool_password`, so one server-first message serves both.
 async fn authenticate_with_scram<S, T>(
     read: &mut S,
     write: &mut T,
     pool_password: &str,
+    next_password: Option<&str>,
     username_from_parameters: &str,
     pool_name: &str,
     client_addr: &str,
@@ -468,6 +832,7 @@ where
         Ok(server_secret) => server_secret,
         Err(err) => {
             warn!("[{username_from_parameters}@{pool_name}] SCRAM: failed to parse server secret from {client_addr}: {err}");
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
             error_response_terminal(
                 write,
                 "Server authentication configuration error. Please contact your database administrator.",
@@ -487,6 +852,7 @@ where
         Ok(client_first_message) => client_first_message,
         Err(err) => {
             warn!("[{username_from_parameters}@{pool_name}] SCRAM: client first message parse error from {client_addr}: {err}");
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
             error_response_terminal(
                     write,
                     "Authentication protocol error. Your client may not support SCRAM authentication properly.",
@@ -518,6 +884,7 @@ where
             warn!(
                 "[{username_from_parameters}@{pool_name}] SCRAM: client final message parse error from {client_addr}: {err}"
             );
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
             error_response_terminal(
                 write,
                 "Authentication protocol error. Your client sent an invalid SCRAM final message.",
@@ -529,18 +896,46 @@ where
             )));
         }
     };
-    let (server_final_message, client_key) = match prepare_server_final_message(
-        client_first_message,
-        client_final_message,
-        server_first_response,
-        server_secret.server_key,
-        server_secret.stored_key,
-    ) {
+    let mut result = prepare_server_final_message(
+        &client_first_message,
+        &client_final_message,
+        &server_first_response,
+        &server_secret.server_key,
+        &server_secret.stored_key,
+    );
+    let mut secret_used = "current";
+    if result.is_err() {
+        if let Some(next_secret) = next_password.and_then(|p| parse_server_secret(p).ok()) {
+            let next_result = prepare_server_final_message(
+                &client_first_message,
+                &client_final_message,
+                &server_first_response,
+                &next_secret.server_key,
+                &next_secret.stored_key,
+            );
+            if next_result.is_ok() {
+                result = next_result;
+                secret_used = "next";
+            }
+        }
+    }
+    if result.is_ok() && next_password.is_some() {
+        crate::web::metrics::record_auth_secret_used(
+            pool_name,
+            username_from_parameters,
+            secret_used,
+        );
+    }
+    let (server_final_message, client_key) = match result {
         Ok(result) => result,
         Err(err) => {
             warn!(
                 "[{username_from_parameters}@{pool_name}] SCRAM: server final message error from {client_addr}: {err}"
             );
+            crate::web::metrics::record_auth_failure(
+                "bad_password",
+                Some(username_from_parameters),
+            );
             error_response_terminal(
                 write,
                 "Authentication failed. Invalid credentials or authentication protocol error.",
@@ -557,13 +952,15 @@ where
     Ok(Some(client_key))
 }
 
-/// Authenticate a user with MD5
+/// Authenticate a user with MD5. `next_password` is a second stored hash
+/// accepted during password rotation.
 async fn authenticate_with_md5<S, T>(
     read: &mut S,
     write: &mut T,
     pool_password: &str,
+    next_password: Option<&str>,
     username_from_parameters: &str,
-    pool: &ConnectionPool,
+    pool_name: &str,
     client_addr: &str,
 ) -> Result<(), Error>
 where
@@ -573,12 +970,26 @@ where
     // md5 auth.
     let salt = md5_challenge(write).await?;
     let password_response = read_password(read).await?;
-    let except_md5_hash = md5_hash_second_pass(pool_password.strip_prefix("md5").unwrap(), &salt);
-    if except_md5_hash != password_response {
+    let matches = |stored: &str| {
+        stored
+            .strip_prefix(MD5_PASSWORD_PREFIX)
+            .is_some_and(|hash| md5_hash_second_pass(hash, &salt) == password_response)
+    };
+    let secret_used = if matches(pool_password) {
+        Some("current")
+    } else if next_password.is_some_and(matches) {
+        Some("next")
+    } else {
+        None
+    };
+    if let (Some(secret), Some(_)) = (secret_used, next_password) {
+        crate::web::metrics::record_auth_secret_used(pool_name, username_from_parameters, secret);
+    }
+    if secret_used.is_none() {
         error!(
-            "[{username_from_parameters}@{}] MD5 authentication failed from {client_addr}",
-            pool.address.pool_name
+            "[{username_from_parameters}@{pool_name}] MD5 authentication failed from {client_addr}"
         );
+        crate::web::metrics::record_auth_failure("bad_password", Some(username_from_parameters));
         error_response_terminal(
             write,
             "Authentication failed. Please check your username and password.",
@@ -613,6 +1024,7 @@ where
         Ok(p) => p,
         Err(err) => {
             error!("[{username_from_parameters}@{pool_name}] JWT: failed to parse token from {client_addr}: {err}");
+            crate::web::metrics::record_auth_failure("other", Some(username_from_parameters));
             error_response_terminal(
                 write,
                 "Invalid JWT token format. Token must be valid UTF-8 text.",
@@ -628,6 +1040,10 @@ where
         Ok(u) => u,
         Err(err) => {
             error!("[{username_from_parameters}@{pool_name}] JWT: validation failed from {client_addr}: {err}");
+            crate::web::metrics::record_auth_failure(
+                "bad_password",
+                Some(username_from_parameters),
+            );
             error_response_terminal(
                 write,
                 "JWT token validation failed. Please provide a valid token.",
@@ -641,6 +1057,7 @@ where
     };
     if !jwt_user_name.eq(username_from_parameters) {
         error!("[{username_from_parameters}@{pool_name}] JWT: username mismatch from {client_addr} (token={jwt_user_name})");
+        crate::web::metrics::record_auth_failure("bad_password", Some(username_from_parameters));
         error_response_terminal(
             write,
             format!("JWT token username mismatch. Token contains username '{jwt_user_name}' but you're trying to connect as '{username_from_parameters}'.").as_str(),
@@ -693,6 +1110,7 @@ where
                      Please try again later."
                 )
             } else {
+                crate::web::metrics::record_auth_failure("unknown_user", None);
                 format!(
                     "No connection pool configured for database: {pool_name}, \
                      user: {username}. Please check your connection parameters."
@@ -728,6 +1146,7 @@ where
             // User not found
             auth_fail!(aq_state);
             warn!("[{username}@{pool_name}] auth_query: user not found");
+            crate::web::metrics::record_auth_failure("unknown_user", None);
             wrong_password(write, username).await?;
             return Err(Error::AuthError(format!(
                 "auth_query: user '{username}' not found in pool '{pool_name}'"
@@ -748,6 +1167,7 @@ where
     // 4. HBA check
     let hba_decision = eval_hba_for_pool_password(&cache_entry.password_hash, client_identifier);
     if hba_decision == CheckResult::Deny {
+        crate::web::metrics::record_auth_failure("hba_reject", Some(username));
         error_response_terminal(
             write,
             &format!(
@@ -818,6 +1238,7 @@ where
                 warn!(
                     "[{username}@{pool_name}] auth_query: MD5 authentication failed (refetch did not match or was rate-limited)"
                 );
+                crate::web::metrics::record_auth_failure("bad_password", Some(username));
                 wrong_password(write, username).await?;
                 return Err(Error::AuthError(format!(
                     "MD5 authentication failed for auth_query user: {username}"
@@ -839,6 +1260,7 @@ where
                 error!(
                     "[{username}@{pool_name}] auth_query: failed to parse SCRAM verifier: {err}"
                 );
+                crate::web::metrics::record_auth_failure("other", Some(username));
                 error_response_terminal(
                     write,
                     "Server authentication configuration error. Please contact your database administrator.",
@@ -857,6 +1279,7 @@ where
             Ok(msg) => msg,
             Err(err) => {
                 warn!("[{username}@{pool_name}] auth_query: SCRAM client first message parse error: {err}");
+                crate::web::metrics::record_auth_failure("other", Some(username));
                 error_response_terminal(
                     write,
                     "Authentication protocol error. Your client may not support SCRAM authentication properly.",
@@ -882,6 +1305,7 @@ where
             Ok(msg) => msg,
             Err(err) => {
                 warn!("[{username}@{pool_name}] auth_query: SCRAM client final message parse error: {err}");
+                crate::web::metrics::record_auth_failure("other", Some(username));
                 error_response_terminal(
                     write,
                     "Authentication protocol error. Your client sent an invalid SCRAM final message.",
@@ -895,11 +1319,11 @@ where
         };
 
         match prepare_server_final_message(
-            client_first,
-            client_final,
-            server_first,
-            server_secret.server_key,
-            server_secret.stored_key,
+            &client_first,
+            &client_final,
+            &server_first,
+            &server_secret.server_key,
+            &server_secret.stored_key,
         ) {
             Ok((server_final, client_key)) => {
                 scram_server_response(write, SASL_FINAL, &server_final).await?;
@@ -917,6 +1341,7 @@ where
                 error!(
                     "[{username}@{pool_name}] auth_query: SCRAM authentication failed, cache invalidated"
                 );
+                crate::web::metrics::record_auth_failure("bad_password", Some(username));
                 wrong_password(write, username).await?;
                 return Err(Error::AuthError(format!(
                     "SCRAM authentication failed for auth_query user: {username}. Cache invalidated — please reconnect."
@@ -924,6 +1349,7 @@ where
             }
         }
     } else {
+        crate::web::metrics::record_auth_failure("other", Some(username));
         error_response_terminal(
             write,
             "Unsupported authentication method for auth_query user.",
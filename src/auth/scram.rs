@@ -364,17 +364,16 @@ pub fn parse_client_final_message(data: Cow<str>) -> Result<ClientFinalMessage,
     Ok(result)
 }
 pub fn prepare_server_final_message(
-    client_first: ClientFirstMessage,
-    client_final: ClientFinalMessage,
-    server_first: ServerFirstMessage,
-    server_secret_server_key: Vec<u8>,
-    server_secret_stored_key: Vec<u8>,
+    client_first: &ClientFirstMessage,
+    client_final: &ClientFinalMessage,
+    server_first: &ServerFirstMessage,
+    server_secret_server_key: &[u8],
+    server_secret_stored_key: &[u8],
 ) -> Result<(String, Vec<u8>), Error> {
     // checks.
     let mut gs_2_header = client_first.gs2_flag.to_string() + ",,";
-    if client_first.authzid.is_some() {
-        gs_2_header =
-            client_first.gs2_flag.to_string() + "," + client_first.authzid.unwrap().as_str() + ",";
+    if let Some(authzid) = &client_first.authzid {
+        gs_2_header = client_first.gs2_flag.to_string() + "," + authzid.as_str() + ",";
     }
     if String::from_utf8_lossy(&client_final.channel_binding) != gs_2_header {
         return Err(Error::ScramClientError(
@@ -388,7 +387,7 @@ pub fn prepare_server_final_message(
     // More concretely, this takes the form:
     // n=username,r=c‑nonce,[extensions,]r=c‑nonce‖s‑nonce,s=salt,i=iteration‑count,[extensions,]
     // c=base64(channel‑flag,[a=authzid],channel‑binding),r=c‑nonce‖s‑nonce[,extensions]
-    let auth_msg = server_first.client_first_bare
+    let auth_msg = server_first.client_first_bare.clone()
         + ","
         + &*server_first.server_first_bare
         + ","
@@ -397,7 +396,7 @@ pub fn prepare_server_final_message(
 
     // ClientProof = p = ClientKey XOR HMAC(H(ClientKey), Auth):
     //
-    let mut mac = HmacSha::new_from_slice(&server_secret_stored_key).unwrap();
+    let mut mac = HmacSha::new_from_slice(server_secret_stored_key).unwrap();
     mac.update(auth_msg.as_ref());
     let mac_result_stored_key = mac.finalize();
 
@@ -426,7 +425,7 @@ pub fn prepare_server_final_message(
         return Err(Error::ScramClientError("e=password-hash".to_string()));
     };
 
-    let mut hmac_result_server_sign = HmacSha::new_from_slice(&server_secret_server_key).unwrap();
+    let mut hmac_result_server_sign = HmacSha::new_from_slice(server_secret_server_key).unwrap();
     hmac_result_server_sign.update(auth2.as_ref());
     let mac_result_server_key = hmac_result_server_sign.finalize();
     // ServerSignature = v = HMAC(ServerKey, Auth)
@@ -447,9 +446,75 @@ impl std::fmt::Display for ClientFirstMessage {
     }
 }
 
+/// PBKDF2 iterations PostgreSQL uses by default (`scram_iterations`).
+pub const DEFAULT_ITERATIONS: u32 = 4096;
+
+/// Build an RFC 7677 verifier in the format PostgreSQL keeps in
+/// `pg_authid.rolpassword`:
+/// `SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>`.
+pub fn build_server_secret(password: &str, salt: &[u8], iterations: u32) -> String {
+    let salted_password = crate::auth::scram_client::ScramSha256::hi(
+        &crate::auth::scram_client::normalize(password.as_bytes()),
+        salt,
+        iterations,
+    );
+
+    let mut hmac =
+        HmacSha::new_from_slice(&salted_password).expect("HMAC accepts keys of any size");
+    hmac.update(b"Client Key");
+    let client_key = hmac.finalize().into_bytes();
+    let stored_key = Sha256::digest(client_key);
+
+    let mut hmac =
+        HmacSha::new_from_slice(&salted_password).expect("HMAC accepts keys of any size");
+    hmac.update(b"Server Key");
+    let server_key = hmac.finalize().into_bytes();
+
+    format!(
+        "{}${iterations}:{}${}:{}",
+        constants::SCRAM_SHA_256,
+        general_purpose::STANDARD.encode(salt),
+        general_purpose::STANDARD.encode(stored_key),
+        general_purpose::STANDARD.encode(server_key),
+    )
+}
+
+/// `build_server_secret` with a random 16-byte salt, as PostgreSQL does.
+pub fn generate_server_secret(password: &str, iterations: u32) -> String {
+    let salt: [u8; 16] = rand::rng().random();
+    build_server_secret(password, &salt, iterations)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
+
+    #[test]
+    fn build_server_secret_rfc7677_vector() {
+        // RFC 7677 section 3: user "user", password "pencil".
+        let salt = general_purpose::STANDARD
+            .decode("W22ZaJ0SNY7soEsUEjb6gQ==")
+            .unwrap();
+        assert_eq!(
+            build_server_secret("pencil", &salt, 4096),
+            "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU="
+        );
+    }
+
+    #[test]
+    fn generate_server_secret_round_trips() {
+        let secret = generate_server_secret("pencil", DEFAULT_ITERATIONS);
+        let parsed = parse_server_secret(&secret).unwrap();
+        assert_eq!(parsed.iteration, 4096);
+        assert_eq!(
+            general_purpose::STANDARD
+                .decode(&parsed.salt_base64)
+                .unwrap()
+                .len(),
+            16
+        );
+        assert_ne!(secret, generate_server_secret("pencil", DEFAULT_ITERATIONS));
+    }
     #[test]
     fn good_parse_server_secret() {
         let result = parse_server_secret(
@@ -82,6 +82,7 @@ fn test_scram_authentication() {
             &mut reader,
             &mut writer,
             &server_secret,
+            None,
             "test_user",
             "test_pool",
             "127.0.0.1:5432",
@@ -0,0 +1,226 @@
+//! AWS credentials for signing RDS IAM tokens, looked up in the order the
+//! AWS SDKs use for the sources a pooler runs with:
+//!
+//! 1. `AWS_ACCESS_KEY_ID` / `AWS_SECRET_ACCESS_KEY` / `AWS_SESSION_TOKEN`;
+//! 2. the container credentials endpoint (`AWS_CONTAINER_CREDENTIALS_RELATIVE_URI`
+//!    on ECS, `AWS_CONTAINER_CREDENTIALS_FULL_URI` with an authorization token
+//!    for EKS Pod Identity);
+//! 3. the EC2 instance metadata service (IMDSv2).
+//!
+//! Temporary credentials are cached until five minutes before they expire.
+
+use std::time::Duration;
+
+use chrono::{DateTime, Utc};
+use serde_derive::Deserialize;
+
+/// Refresh temporary credentials this long before they expire.
+const EXPIRY_MARGIN_SECS: i64 = 300;
+const METADATA_TIMEOUT: Duration = Duration::from_secs(2);
+const ECS_CREDENTIALS_HOST: &str = "http://169.254.170.2";
+const IMDS_ENDPOINT: &str = "http://169.254.169.254";
+
+#[derive(Clone)]
+pub struct Credentials {
+    pub access_key_id: String,
+    pub secret_access_key: String,
+    pub session_token: Option<String>,
+    /// `None` for long-term keys.
+    pub expires_at: Option<DateTime<Utc>>,
+}
+
+impl Credentials {
+    fn fresh(&self, now: DateTime<Utc>) -> bool {
+        match self.expires_at {
+            Some(expires_at) => (expires_at - now).num_seconds() > EXPIRY_MARGIN_SECS,
+            None => true,
+        }
+    }
+}
+
+/// Credentials document returned by both the container endpoint and IMDS.
+#[derive(Deserialize)]
+#[serde(rename_all = "PascalCase")]
+struct MetadataCredentials {
+    access_key_id: String,
+    secret_access_key: String,
+    token: Option<String>,
+    expiration: Option<String>,
+}
+
+impl TryFrom<MetadataCredentials> for Credentials {
+    type Error = String;
+
+    fn try_from(doc: MetadataCredentials) -> Result<Self, String> {
+        let expires_at = doc
+            .expiration
+            .map(|raw| {
+                DateTime::parse_from_rfc3339(&raw)
+                    .map(|t| t.with_timezone(&Utc))
+                    .map_err(|e| format!("bad Expiration {raw:?}: {e}"))
+            })
+            .transpose()?;
+        Ok(Credentials {
+            access_key_id: doc.access_key_id,
+            secret_access_key: doc.secret_access_key,
+            session_token: doc.token,
+            expires_at,
+        })
+    }
+}
+
+static CACHE: once_cell::sync::Lazy<tokio::sync::Mutex<Option<Credentials>>> =
+    once_cell::sync::Lazy::new(|| tokio::sync::Mutex::new(None));
+
+/// Current credentials, refreshed when missing or about to expire. The
+/// lock is held while fetching so a burst of new backend connections
+/// makes a single metadata request.
+pub async fn get() -> Result<Credentials, String> {
+    let mut cache = CACHE.lock().await;
+    if let Some(credentials) = cache.as_ref().filter(|c| c.fresh(Utc::now())) {
+        return Ok(credentials.clone());
+    }
+    let credentials = load().await?;
+    *cache = Some(credentials.clone());
+    Ok(credentials)
+}
+
+async fn load() -> Result<Credentials, String> {
+    if let Some(credentials) = from_env() {
+        return Ok(credentials);
+    }
+    let http = reqwest::Client::builder()
+        .timeout(METADATA_TIMEOUT)
+        .connect_timeout(METADATA_TIMEOUT)
+        .no_proxy()
+        .build()
+        .map_err(|e| format!("{e}"))?;
+    if let Some(credentials) = from_container(&http).await {
+        return credentials.map_err(|e| format!("container credentials endpoint: {e}"));
+    }
+    if std::env::var("AWS_EC2_METADATA_DISABLED").is_ok_and(|v| v.eq_ignore_ascii_case("true")) {
+        return Err(
+            "no AWS credentials found (environment, container endpoint; IMDS is disabled)".into(),
+        );
+    }
+    from_imds(&http)
+        .await
+        .map_err(|e| format!("no AWS credentials in environment or container endpoint, IMDS: {e}"))
+}
+
+fn from_env() -> Option<Credentials> {
+    let access_key_id = std::env::var("AWS_ACCESS_KEY_ID").ok()?;
+    let secret_access_key = std::env::var("AWS_SECRET_ACCESS_KEY").ok()?;
+    Some(Credentials {
+        access_key_id,
+        secret_access_key,
+        session_token: std::env::var("AWS_SESSION_TOKEN").ok(),
+        expires_at: None,
+    })
+}
+
+/// `None` when no container endpoint is configured.
+async fn from_container(http: &reqwest::Client) -> Option<Result<Credentials, String>> {
+    let url = if let Ok(relative) = std::env::var("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") {
+        format!("{ECS_CREDENTIALS_HOST}{relative}")
+    } else {
+        std::env::var("AWS_CONTAINER_CREDENTIALS_FULL_URI").ok()?
+    };
+    Some(
+        async {
+            let mut request = http.get(&url);
+            if let Some(authorization) = container_authorization()? {
+                request = request.header("Authorization", authorization);
+            }
+            let doc: MetadataCredentials = fetch_json(request).await?;
+            Credentials::try_from(doc)
+        }
+        .await,
+    )
+}
+
+fn container_authorization() -> Result<Option<String>, String> {
+    if let Ok(file) = std::env::var("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE") {
+        return std::fs::read_to_string(&file)
+            .map(|token| Some(token.trim().to_string()))
+            .map_err(|e| format!("reading {file}: {e}"));
+    }
+    Ok(std::env::var("AWS_CONTAINER_AUTHORIZATION_TOKEN").ok())
+}
+
+async fn from_imds(http: &reqwest::Client) -> Result<Credentials, String> {
+    let token = http
+        .put(format!("{IMDS_ENDPOINT}/latest/api/token"))
+        .header("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+        .send()
+        .await
+        .and_then(|r| r.error_for_status())
+        .map_err(|e| format!("{e}"))?
+        .text()
+        .await
+        .map_err(|e| format!("{e}"))?;
+    let base = format!("{IMDS_ENDPOINT}/latest/meta-data/iam/security-credentials/");
+    let role = http
+        .get(&base)
+        .header("X-aws-ec2-metadata-token", &token)
+        .send()
+        .await
+        .and_then(|r| r.error_for_status())
+        .map_err(|e| format!("{e}"))?
+        .text()
+        .await
+        .map_err(|e| format!("{e}"))?;
+    let role = role.lines().next().unwrap_or_default().trim();
+    if role.is_empty() {
+        return Err("no IAM role attached to the instance".into());
+    }
+    let doc: MetadataCredentials = fetch_json(
+        http.get(format!("{base}{role}"))
+            .header("X-aws-ec2-metadata-token", &token),
+    )
+    .await?;
+    Credentials::try_from(doc)
+}
+
+async fn fetch_json(request: reqwest::RequestBuilder) -> Result<MetadataCredentials, String> {
+    let resp = request.send().await.map_err(|e| format!("{e}"))?;
+    let status = resp.status();
+    if !status.is_success() {
+        return Err(format!("HTTP {status}"));
+    }
+    let body = resp
+        .text()
+        .await
+        .map_err(|e| format!("reading body: {e}"))?;
+    // The body holds the secret key: never echo it in parse errors.
+    serde_json::from_str(&body).map_err(|e| {
+        format!(
+            "unexpected response: {:?} error at line {} column {}",
+            e.classify(),
+            e.line(),
+            e.column()
+        )
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn metadata_document_parses() {
+        let doc: MetadataCredentials = serde_json::from_str(
+            r#"{"Code":"Success","Type":"AWS-HMAC","AccessKeyId":"ASIAEXAMPLE",
+                "SecretAccessKey":"secret","Token":"session",
+                "Expiration":"2024-01-01T12:00:00Z","LastUpdated":"2024-01-01T06:00:00Z"}"#,
+        )
+        .unwrap();
+        let credentials = Credentials::try_from(doc).unwrap();
+        assert_eq!(credentials.access_key_id, "ASIAEXAMPLE");
+        assert_eq!(credentials.session_token.as_deref(), Some("session"));
+
+        let expires_at = credentials.expires_at.unwrap();
+        assert!(credentials.fresh(expires_at - chrono::Duration::minutes(6)));
+        assert!(!credentials.fresh(expires_at - chrono::Duration::minutes(4)));
+    }
+}
@@ -0,0 +1,117 @@
+//! RDS IAM authentication for backend connections (`users[].server_rds_iam`).
+//!
+//! RDS and Aurora accept a short-lived token, a SigV4-presigned
+//! `rds-db:connect` request, in place of the password. PostgreSQL asks
+//! for it as a cleartext password, so the backend connection must use TLS.
+//! Tokens are valid for 15 minutes but only checked at login; pg_doorman
+//! reuses one per host and user for ten minutes and signs a new one after.
+
+pub mod credentials;
+pub mod sigv4;
+
+use std::collections::HashMap;
+
+use chrono::{DateTime, Duration, Utc};
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use self::sigv4::{presign, PresignRequest, EMPTY_PAYLOAD_SHA256};
+
+/// Lifetime RDS accepts for a token.
+const TOKEN_EXPIRES_SECS: u64 = 900;
+/// Sign a new token once the cached one is this old, well before RDS
+/// stops accepting it.
+const TOKEN_REUSE_SECS: i64 = 600;
+
+struct CachedToken {
+    token: String,
+    reuse_until: DateTime<Utc>,
+}
+
+static TOKENS: Lazy<Mutex<HashMap<(String, u16, String), CachedToken>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Region of an RDS endpoint: `AWS_REGION` / `AWS_DEFAULT_REGION` when set,
+/// otherwise parsed from `<name>.<id>.<region>.rds.amazonaws.com[.cn]`.
+pub fn region_for_host(host: &str) -> Option<String> {
+    for var in ["AWS_REGION", "AWS_DEFAULT_REGION"] {
+        if let Ok(region) = std::env::var(var) {
+            if !region.is_empty() {
+                return Some(region);
+            }
+        }
+    }
+    let labels: Vec<&str> = host.split('.').collect();
+    let rds = labels
+        .windows(2)
+        .position(|w| w[0] == "rds" && w[1] == "amazonaws")?;
+    (rds > 0).then(|| labels[rds - 1].to_string())
+}
+
+/// Authentication token for logging in to `host:port` as `db_user`.
+pub async fn rds_auth_token(host: &str, port: u16, db_user: &str) -> Result<String, String> {
+    let key = (host.to_string(), port, db_user.to_string());
+    let now = Utc::now();
+    if let Some(cached) = TOKENS.lock().get(&key) {
+        if cached.reuse_until > now {
+            return Ok(cached.token.clone());
+        }
+    }
+
+    let region = region_for_host(host)
+        .ok_or_else(|| format!("can't tell the AWS region of {host}; set AWS_REGION"))?;
+    let credentials = credentials::get().await?;
+    let endpoint = format!("{host}:{port}");
+    let query = presign(
+        &PresignRequest {
+            host: &endpoint,
+            path: "/",
+            params: &[("Action", "connect"), ("DBUser", db_user)],
+            region: &region,
+            service: "rds-db",
+            expires_secs: TOKEN_EXPIRES_SECS,
+            payload_sha256: EMPTY_PAYLOAD_SHA256,
+        },
+        &credentials,
+        now,
+    );
+    let token = format!("{endpoint}/?{query}");
+
+    // A token signed with temporary credentials dies with them.
+    let mut reuse_until = now + Duration::seconds(TOKEN_REUSE_SECS);
+    if let Some(expires_at) = credentials.expires_at {
+        reuse_until = reuse_until.min(expires_at - Duration::seconds(60));
+    }
+    TOKENS.lock().insert(
+        key,
+        CachedToken {
+            token: token.clone(),
+            reuse_until,
+        },
+    );
+    Ok(token)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn region_from_rds_hostname() {
+        if std::env::var_os("AWS_REGION").is_some()
+            || std::env::var_os("AWS_DEFAULT_REGION").is_some()
+        {
+            return;
+        }
+        assert_eq!(
+            region_for_host("mydb.c9akciq32.eu-central-1.rds.amazonaws.com").as_deref(),
+            Some("eu-central-1")
+        );
+        assert_eq!(
+            region_for_host("aurora.cluster-ro-abc.cn-north-1.rds.amazonaws.com.cn").as_deref(),
+            Some("cn-north-1")
+        );
+        assert_eq!(region_for_host("db.internal"), None);
+        assert_eq!(region_for_host("rds.amazonaws.com"), None);
+    }
+}
@@ -0,0 +1,95 @@
+//! Classification of statements for the audit log (`general.audit_log`).
+//!
+//! Statements are split and read like `statement_deny`: only their leading
+//! keywords count, and literals and comments are never looked at. DDL run
+//! through `EXECUTE` inside a function or `DO` block is not seen here; it
+//! is recorded only when the backend role is a superuser.
+
+use super::session_pin::{is, Words};
+
+/// Statements that define or change schema objects.
+const DDL: [&str; 7] = [
+    "create", "alter", "drop", "truncate", "comment", "security", "import",
+];
+
+/// Statements that grant or take away privileges.
+const PRIVILEGE: [&str; 3] = ["grant", "revoke", "reassign"];
+
+/// Audit class of the first audited statement of `query`: `privilege`,
+/// `role` (role management and `SET ROLE`) or `ddl`; None when no
+/// statement is audited.
+pub(crate) fn audit_class(query: &[u8]) -> Option<&'static str> {
+    let mut head: [&[u8]; 3] = [b""; 3];
+    let mut len = 0;
+    let mut words = Words::new(query);
+    loop {
+        let word = words.next();
+        if let Some(word) = word.filter(|w| *w != b";") {
+            if len < head.len() {
+                head[len] = word;
+                len += 1;
+            }
+            continue;
+        }
+        if let Some(class) = classify(head) {
+            return Some(class);
+        }
+        word?;
+        head = [b""; 3];
+        len = 0;
+    }
+}
+
+fn classify([first, second, third]: [&[u8]; 3]) -> Option<&'static str> {
+    let any = |word: &[u8], keywords: &[&str]| keywords.iter().any(|k| is(word, k));
+    if any(first, &PRIVILEGE) || (is(first, "alter") && is(second, "default")) {
+        return Some("privilege");
+    }
+    // CREATE USER MAPPING is a foreign-data object, not a role.
+    let role_object = any(second, &["role", "user", "group"]) && !is(third, "mapping");
+    let role_setting = [second, third]
+        .iter()
+        .any(|&w| any(w, &["role", "authorization", "session_authorization"]));
+    if (any(first, &["create", "alter", "drop"]) && role_object)
+        || (any(first, &["set", "reset"]) && role_setting)
+    {
+        return Some("role");
+    }
+    any(first, &DDL).then_some("ddl")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn classifies_statements() {
+        assert_eq!(audit_class(b"CREATE TABLE t (id int)"), Some("ddl"));
+        assert_eq!(audit_class(b"truncate t"), Some("ddl"));
+        assert_eq!(audit_class(b"GRANT SELECT ON t TO app"), Some("privilege"));
+        assert_eq!(
+            audit_class(b"ALTER DEFAULT PRIVILEGES GRANT SELECT ON TABLES TO app"),
+            Some("privilege")
+        );
+        assert_eq!(audit_class(b"ALTER ROLE app SUPERUSER"), Some("role"));
+        assert_eq!(
+            audit_class(b"CREATE USER MAPPING FOR app SERVER s"),
+            Some("ddl")
+        );
+        assert_eq!(audit_class(b"SET LOCAL ROLE admin"), Some("role"));
+        assert_eq!(
+            audit_class(b"set session authorization admin"),
+            Some("role")
+        );
+        assert_eq!(audit_class(b"RESET ROLE"), Some("role"));
+        assert_eq!(audit_class(b"SET search_path = app"), None);
+        assert_eq!(audit_class(b"SELECT 'drop table t'"), None);
+    }
+
+    #[test]
+    fn looks_at_every_statement() {
+        assert_eq!(audit_class(b"SELECT 1; DROP TABLE t"), Some("ddl"));
+        assert_eq!(audit_class(b"UPDATE t SET a = 1; SELECT 1"), None);
+        assert_eq!(audit_class(b"/* create */ select 1"), None);
+    }
+}
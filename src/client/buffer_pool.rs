@@ -1,45 +1,178 @@
 use bytes::BytesMut;
 use std::cell::RefCell;
 use std::ops::{Deref, DerefMut};
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
 
 const DEFAULT_BUFFER_CAPACITY: usize = 8192;
 const BUFFER_SHRINK_THRESHOLD: usize = 4 * DEFAULT_BUFFER_CAPACITY; // 32KB
-const MAX_POOL_SIZE: usize = 512; // ~5MB per thread
+
+/// Size classes by capacity. A returned buffer goes to the largest class it
+/// can serve, so a buffer that grew under a batch is reused by the next
+/// request of that size instead of being reallocated.
+const SIZE_CLASSES: [usize; 3] = [DEFAULT_BUFFER_CAPACITY, 32 * 1024, 128 * 1024];
+
+/// Buffers kept per class and thread: about 4MB per class.
+const MAX_POOL_SIZE: [usize; 3] = [512, 128, 32];
+
+/// Buffers larger than this are never pooled.
+const MAX_POOLED_CAPACITY: usize = SIZE_CLASSES[SIZE_CLASSES.len() - 1];
+
+/// A returned buffer is pooled only up to this many times its class size,
+/// so a class never holds much more memory than `MAX_POOL_SIZE` buffers
+/// of its size.
+const MAX_CLASS_OVERSHOOT: usize = 2;
 
 thread_local! {
-    static LOCAL_POOL: RefCell<Vec<BytesMut>> = RefCell::new(Vec::with_capacity(MAX_POOL_SIZE));
+    static LOCAL_POOL: RefCell<LocalPool> = RefCell::new(LocalPool(
+        MAX_POOL_SIZE.map(Vec::with_capacity),
+    ));
+}
+
+/// Per-thread free lists, one per size class.
+struct LocalPool([Vec<BytesMut>; 3]);
+
+impl Drop for LocalPool {
+    /// Buffers of an exiting thread leave the `pooled` gauge with it.
+    fn drop(&mut self) {
+        for (class, buffers) in self.0.iter().enumerate() {
+            COUNTERS[class]
+                .pooled
+                .fetch_sub(buffers.len(), Ordering::Relaxed);
+        }
+    }
+}
+
+/// Process-wide counters of one size class.
+struct ClassCounters {
+    pooled: AtomicUsize,
+    allocated: AtomicU64,
+    reused: AtomicU64,
+    returned: AtomicU64,
+    dropped: AtomicU64,
+}
+
+impl ClassCounters {
+    const fn new() -> Self {
+        ClassCounters {
+            pooled: AtomicUsize::new(0),
+            allocated: AtomicU64::new(0),
+            reused: AtomicU64::new(0),
+            returned: AtomicU64::new(0),
+            dropped: AtomicU64::new(0),
+        }
+    }
+}
+
+static COUNTERS: [ClassCounters; 3] = [const { ClassCounters::new() }; 3];
+
+/// Requests above the largest class and returned buffers above
+/// `MAX_POOLED_CAPACITY`.
+static OVERSIZE_ALLOCATED: AtomicU64 = AtomicU64::new(0);
+static OVERSIZE_DROPPED: AtomicU64 = AtomicU64::new(0);
+
+/// Snapshot of one size class for `SHOW BUFFER_POOL`. `class_size` is 0
+/// for the oversize row.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct BufferPoolStats {
+    pub class_size: usize,
+    pub pooled: usize,
+    pub allocated: u64,
+    pub reused: u64,
+    pub returned: u64,
+    pub dropped: u64,
 }
 
-/// Acquire a buffer from the thread-local pool or create a new one.
+/// Counters of every size class followed by the oversize row.
+pub fn buffer_pool_stats() -> Vec<BufferPoolStats> {
+    let mut stats: Vec<BufferPoolStats> = SIZE_CLASSES
+        .iter()
+        .zip(COUNTERS.iter())
+        .map(|(&class_size, c)| BufferPoolStats {
+            class_size,
+            pooled: c.pooled.load(Ordering::Relaxed),
+            allocated: c.allocated.load(Ordering::Relaxed),
+            reused: c.reused.load(Ordering::Relaxed),
+            returned: c.returned.load(Ordering::Relaxed),
+            dropped: c.dropped.load(Ordering::Relaxed),
+        })
+        .collect();
+    stats.push(BufferPoolStats {
+        class_size: 0,
+        pooled: 0,
+        allocated: OVERSIZE_ALLOCATED.load(Ordering::Relaxed),
+        reused: 0,
+        returned: 0,
+        dropped: OVERSIZE_DROPPED.load(Ordering::Relaxed),
+    });
+    stats
+}
+
+/// Acquire a buffer of at least `capacity` bytes from the thread-local pool
+/// or create a new one of the smallest fitting class.
 #[inline]
-fn acquire_buffer() -> BytesMut {
-    LOCAL_POOL.with(|pool| {
-        pool.borrow_mut()
-            .pop()
-            .unwrap_or_else(|| BytesMut::with_capacity(DEFAULT_BUFFER_CAPACITY))
-    })
+fn acquire_buffer(capacity: usize) -> BytesMut {
+    let Some(class) = SIZE_CLASSES.iter().position(|&size| size >= capacity) else {
+        OVERSIZE_ALLOCATED.fetch_add(1, Ordering::Relaxed);
+        return BytesMut::with_capacity(capacity);
+    };
+    let counters = &COUNTERS[class];
+    let pooled = LOCAL_POOL.with(|pool| pool.try_borrow_mut().ok()?.0[class].pop());
+    match pooled {
+        Some(buffer) => {
+            counters.pooled.fetch_sub(1, Ordering::Relaxed);
+            counters.reused.fetch_add(1, Ordering::Relaxed);
+            buffer
+        }
+        None => {
+            counters.allocated.fetch_add(1, Ordering::Relaxed);
+            BytesMut::with_capacity(SIZE_CLASSES[class])
+        }
+    }
 }
 
-/// Return a buffer to the thread-local pool.
-/// If the buffer is too large, it is dropped instead to reclaim memory.
+/// Return a buffer to the thread-local pool of its size class.
+/// If the buffer is too large for the largest class, or more than
+/// `MAX_CLASS_OVERSHOOT` times its class, it is dropped instead to reclaim
+/// memory.
 #[inline]
 fn release_buffer(mut buffer: BytesMut) {
-    if buffer.capacity() > BUFFER_SHRINK_THRESHOLD {
+    let capacity = buffer.capacity();
+    if capacity > MAX_POOLED_CAPACITY {
         // Drop it, don't pollute the pool with huge buffers
+        OVERSIZE_DROPPED.fetch_add(1, Ordering::Relaxed);
+        return;
+    }
+    let Some(class) = SIZE_CLASSES.iter().rposition(|&size| size <= capacity) else {
+        // Split off below the smallest class: useless to the next caller.
+        COUNTERS[0].dropped.fetch_add(1, Ordering::Relaxed);
+        return;
+    };
+    let counters = &COUNTERS[class];
+    if capacity > MAX_CLASS_OVERSHOOT * SIZE_CLASSES[class] {
+        counters.dropped.fetch_add(1, Ordering::Relaxed);
         return;
     }
 
     // Clear content but keep capacity
     buffer.clear();
 
-    LOCAL_POOL.with(|pool| {
-        if let Ok(mut pool) = pool.try_borrow_mut() {
-            if pool.len() < MAX_POOL_SIZE {
-                pool.push(buffer);
-            }
+    let kept = LOCAL_POOL.with(|pool| {
+        let Ok(mut pool) = pool.try_borrow_mut() else {
+            return false;
+        };
+        if pool.0[class].len() >= MAX_POOL_SIZE[class] {
+            return false;
         }
+        pool.0[class].push(buffer);
+        true
+    });
+    if kept {
+        counters.pooled.fetch_add(1, Ordering::Relaxed);
+        counters.returned.fetch_add(1, Ordering::Relaxed);
+    } else {
         // If borrow fails or pool is full, just drop the buffer
-    })
+        counters.dropped.fetch_add(1, Ordering::Relaxed);
+    }
 }
 
 /// RAII wrapper for BytesMut that returns it to the pool on Drop.
@@ -49,17 +182,26 @@ pub struct PooledBuffer(Option<BytesMut>);
 impl PooledBuffer {
     #[inline]
     pub fn new() -> Self {
-        Self(Some(acquire_buffer()))
+        Self(Some(acquire_buffer(DEFAULT_BUFFER_CAPACITY)))
+    }
+
+    /// A buffer with room for at least `capacity` bytes.
+    #[inline]
+    pub fn with_capacity(capacity: usize) -> Self {
+        Self(Some(acquire_buffer(capacity)))
     }
 
     /// Checks if the buffer capacity exceeds the threshold.
     /// If so, replaces the underlying buffer with a new standard-sized one from the pool.
-    /// The old large buffer is dropped (releasing memory).
+    /// The old large buffer goes back to the pool of its size class, or is
+    /// dropped when it outgrew that class.
     #[inline]
     pub fn shrink_if_needed(&mut self) {
         // self.0 is always Some during normal usage
         if self.capacity() > BUFFER_SHRINK_THRESHOLD {
-            self.0 = Some(acquire_buffer());
+            if let Some(large) = self.0.replace(acquire_buffer(DEFAULT_BUFFER_CAPACITY)) {
+                release_buffer(large);
+            }
         }
     }
 }
@@ -95,3 +237,87 @@ impl Drop for PooledBuffer {
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    // Counters are process-wide and other tests allocate buffers too, so
+    // each test runs on its own thread (empty thread-local pool) and checks
+    // what it can observe locally.
+
+    #[test]
+    fn released_buffer_is_reused_by_its_class() {
+        std::thread::spawn(|| {
+            let first = PooledBuffer::with_capacity(20 * 1024);
+            assert!(first.capacity() >= 32 * 1024);
+            let ptr = first.as_ptr();
+            drop(first);
+
+            let again = PooledBuffer::with_capacity(30 * 1024);
+            assert_eq!(again.as_ptr(), ptr, "32KB class buffer was not reused");
+
+            let small = PooledBuffer::new();
+            assert_ne!(small.as_ptr(), ptr, "small request took a 32KB buffer");
+            assert!(small.capacity() >= DEFAULT_BUFFER_CAPACITY);
+        })
+        .join()
+        .unwrap();
+    }
+
+    #[test]
+    fn grown_buffer_moves_to_larger_class() {
+        std::thread::spawn(|| {
+            let mut buffer = PooledBuffer::new();
+            buffer.reserve(40 * 1024);
+            let ptr = buffer.as_ptr();
+            buffer.shrink_if_needed();
+            assert!(buffer.capacity() < BUFFER_SHRINK_THRESHOLD);
+
+            // 40KB lands in the 32KB class.
+            let large = PooledBuffer::with_capacity(20 * 1024);
+            assert_eq!(large.as_ptr(), ptr, "grown buffer was not pooled");
+        })
+        .join()
+        .unwrap();
+    }
+
+    #[test]
+    fn buffer_grown_past_its_class_is_dropped() {
+        std::thread::spawn(|| {
+            let mut buffer = PooledBuffer::new();
+            buffer.reserve(100 * 1024);
+            buffer.shrink_if_needed();
+            assert!(buffer.capacity() < BUFFER_SHRINK_THRESHOLD);
+
+            // 100KB is over twice the 32KB class and under the 128KB one.
+            let pooled =
+                LOCAL_POOL.with(|pool| pool.borrow().0.iter().map(Vec::len).sum::<usize>());
+            assert_eq!(pooled, 0, "outgrown buffer was pooled");
+        })
+        .join()
+        .unwrap();
+    }
+
+    #[test]
+    fn oversize_buffers_are_not_pooled() {
+        std::thread::spawn(|| {
+            let before = buffer_pool_stats().last().unwrap().clone();
+            let huge = PooledBuffer::with_capacity(MAX_POOLED_CAPACITY + 1);
+            drop(huge);
+            let after = buffer_pool_stats().last().unwrap().clone();
+            assert_eq!(after.class_size, 0);
+            assert!(after.allocated > before.allocated);
+            assert!(after.dropped > before.dropped);
+        })
+        .join()
+        .unwrap();
+    }
+
+    #[test]
+    fn stats_list_every_class() {
+        let stats = buffer_pool_stats();
+        let sizes: Vec<usize> = stats.iter().map(|s| s.class_size).collect();
+        assert_eq!(sizes, vec![8192, 32 * 1024, 128 * 1024, 0]);
+    }
+}
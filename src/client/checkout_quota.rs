@@ -0,0 +1,184 @@
+//! Checkout quotas by application_name or client tag.
+//!
+//! Deployments sharing one database user share its `pool_size`, so a
+//! reporting job with long transactions can hold every backend its API
+//! neighbour needs. A pool's `application_name_checkout_limits` and
+//! `tag_checkout_limits` cap how many backends the clients of one
+//! application_name (as sent in the StartupMessage) or one tag
+//! (`general.client_tag_parameter`) hold at once, across all users of the
+//! pool. A client over a quota waits for a slot before it asks the pool
+//! for a server, within the same `query_wait_timeout` as the checkout
+//! itself, and gives the slot back with the server. Quotas are resolved at login; a RELOAD that changes a
+//! limit applies to clients that log in afterwards.
+
+use std::collections::HashMap;
+use std::sync::Arc;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use tokio::sync::{OwnedSemaphorePermit, Semaphore};
+use tokio::time::Instant;
+
+use crate::config::Config;
+
+/// Backends the clients of one application_name or tag may hold at once.
+pub(crate) struct CheckoutQuota {
+    pool_name: String,
+    /// `application_name` or `tag`.
+    by: &'static str,
+    key: String,
+    limit: u32,
+    slots: Arc<Semaphore>,
+}
+
+impl CheckoutQuota {
+    /// What the quota is keyed by and the key, e.g. `tag "batch"`.
+    pub(crate) fn describe(&self) -> String {
+        format!("{} \"{}\"", self.by, self.key)
+    }
+
+    pub(crate) fn limit(&self) -> u32 {
+        self.limit
+    }
+
+    /// Wait for a slot until `deadline`, or for as long as it takes
+    /// without one; None when none came free.
+    async fn wait(&self, deadline: Option<Instant>) -> Option<OwnedSemaphorePermit> {
+        if let Ok(permit) = self.slots.clone().try_acquire_owned() {
+            return Some(permit);
+        }
+        let slot = self.slots.clone().acquire_owned();
+        let permit = match deadline {
+            Some(deadline) => tokio::time::timeout_at(deadline, slot).await.ok(),
+            None => Some(slot.await),
+        }
+        .and_then(Result::ok);
+        let result = if permit.is_some() {
+            "waited"
+        } else {
+            "timeout"
+        };
+        crate::web::metrics::record_checkout_quota(&self.pool_name, self.by, &self.key, result);
+        permit
+    }
+}
+
+/// Quotas by (pool, `by`, key). An entry is replaced when its limit
+/// changes; clients holding the old one keep it until they log out.
+static QUOTAS: Lazy<Mutex<HashMap<(String, &'static str, String), Arc<CheckoutQuota>>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+fn quota(pool_name: &str, by: &'static str, key: &str, limit: u32) -> Arc<CheckoutQuota> {
+    let mut quotas = QUOTAS.lock();
+    let entry = quotas
+        .entry((pool_name.to_string(), by, key.to_string()))
+        .or_insert_with(|| new_quota(pool_name, by, key, limit));
+    if entry.limit != limit {
+        *entry = new_quota(pool_name, by, key, limit);
+    }
+    entry.clone()
+}
+
+fn new_quota(pool_name: &str, by: &'static str, key: &str, limit: u32) -> Arc<CheckoutQuota> {
+    Arc::new(CheckoutQuota {
+        pool_name: pool_name.to_string(),
+        by,
+        key: key.to_string(),
+        limit,
+        slots: Arc::new(Semaphore::new(limit as usize)),
+    })
+}
+
+/// Quotas that apply to a client of `pool_name`, application_name quota
+/// first. Empty when the pool sets none for it.
+pub(crate) fn for_client(
+    config: &Config,
+    pool_name: &str,
+    application_name: &str,
+    tag: Option<&str>,
+) -> Vec<Arc<CheckoutQuota>> {
+    let Some(pool) = config.pools.get(pool_name) else {
+        return Vec::new();
+    };
+    let mut quotas = Vec::new();
+    if let Some(&limit) = pool.application_name_checkout_limits.get(application_name) {
+        quotas.push(quota(
+            pool_name,
+            "application_name",
+            application_name,
+            limit,
+        ));
+    }
+    if let Some((tag, &limit)) = tag.and_then(|tag| pool.tag_checkout_limits.get_key_value(tag)) {
+        quotas.push(quota(pool_name, "tag", tag, limit));
+    }
+    quotas
+}
+
+/// Slots of a client's quotas, held while it has a server.
+pub(crate) struct QuotaSlots {
+    _permits: Vec<OwnedSemaphorePermit>,
+}
+
+/// Take a slot of every quota in order, waiting until `deadline` in all:
+/// the checkout deadline, so the quota and the pool share one
+/// `query_wait_timeout`. Errs with the quota that had no free slot in time.
+pub(crate) async fn acquire(
+    quotas: &[Arc<CheckoutQuota>],
+    deadline: Option<Instant>,
+) -> Result<QuotaSlots, Arc<CheckoutQuota>> {
+    let mut permits = Vec::with_capacity(quotas.len());
+    for quota in quotas {
+        match quota.wait(deadline).await {
+            Some(permit) => permits.push(permit),
+            None => return Err(quota.clone()),
+        }
+    }
+    Ok(QuotaSlots { _permits: permits })
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Duration;
+
+    use super::*;
+
+    fn config() -> Config {
+        let mut pool = crate::config::Pool::default();
+        pool.application_name_checkout_limits
+            .insert("reporting".into(), 1);
+        pool.tag_checkout_limits.insert("batch".into(), 2);
+        let mut config = Config::default();
+        config.pools.insert("quota_db".into(), pool);
+        config
+    }
+
+    #[test]
+    fn quotas_match_application_name_and_tag() {
+        let config = config();
+        let quotas = for_client(&config, "quota_db", "reporting", Some("batch"));
+        let described: Vec<_> = quotas.iter().map(|quota| quota.describe()).collect();
+        assert_eq!(
+            described,
+            ["application_name \"reporting\"", "tag \"batch\""]
+        );
+        assert!(for_client(&config, "quota_db", "api", Some("web")).is_empty());
+        assert!(for_client(&config, "other_db", "reporting", None).is_empty());
+    }
+
+    #[tokio::test]
+    async fn slot_is_released_with_the_server() {
+        let config = config();
+        let quotas = for_client(&config, "quota_db", "reporting", None);
+        let deadline = || Some(Instant::now() + Duration::from_millis(50));
+        let Ok(held) = acquire(&quotas, deadline()).await else {
+            panic!("the first checkout should get the slot");
+        };
+        let Err(refused) = acquire(&quotas, deadline()).await else {
+            panic!("the second checkout should time out");
+        };
+        assert_eq!(refused.limit(), 1);
+        drop(held);
+        assert!(acquire(&quotas, None).await.is_ok());
+    }
+}
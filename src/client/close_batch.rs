@@ -0,0 +1,85 @@
+//! Statement Closes answered without a server.
+//!
+//! Npgsql recycles its automatically prepared statements (`_auto0`,
+//! `_auto1`, ...) by closing the least used one and parsing the new query
+//! under the same name; with multiplexing, the Closes of many logical
+//! connections often arrive as batches of their own, ended by a Sync.
+//! Client statement names never reach PostgreSQL, so such a Close only
+//! has to drop the name from the client's cache. Closes that start a batch
+//! are held until the next message: a Sync is answered here with
+//! CloseComplete and ReadyForQuery, without checking out a server, and any
+//! other message takes the Closes to the server with the rest of the
+//! batch, as before.
+
+use bytes::{BufMut, BytesMut};
+use log::debug;
+
+use crate::client::core::Client;
+use crate::errors::Error;
+use crate::messages::{close_complete, ready_for_query, write_all_flush};
+
+/// Whether `message` is a Close of a prepared statement.
+fn is_statement_close(message: &[u8]) -> bool {
+    message.first() == Some(&b'C') && message.get(5) == Some(&b'S')
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// Number of statement Closes held before a server is checked out.
+    pub(crate) fn held_closes(&self) -> usize {
+        self.prepared.batch_operations.len()
+    }
+
+    /// Hold `message` when it is a statement Close starting a batch, or
+    /// following Closes already held. False for any other message, and
+    /// when the Close would exceed `max_pipeline_depth`.
+    pub(crate) fn hold_close(&mut self, message: &BytesMut) -> Result<bool, Error> {
+        if !self.prepared.enabled || !is_statement_close(message) || self.pipeline_full() {
+            return Ok(false);
+        }
+        self.process_close_immediate(message.clone())?;
+        Ok(true)
+    }
+
+    /// Answer a Sync ending a batch of held Closes. False when `message`
+    /// is not a Sync or no Close is held.
+    pub(crate) async fn answer_held_closes(&mut self, message: &BytesMut) -> Result<bool, Error> {
+        let closes = self.held_closes();
+        if message[0] != b'S' || closes == 0 {
+            return Ok(false);
+        }
+        debug!(
+            "[{}@{} #c{}] answering {closes} statement Close(s) without a server",
+            self.username, self.pool_name, self.connection_id
+        );
+        let mut response = BytesMut::with_capacity(closes * 5 + 6);
+        for _ in 0..closes {
+            response.put(close_complete());
+        }
+        // A deferred BEGIN has already told the client it is in a transaction.
+        response.put(ready_for_query(self.client_pending_begin.is_some()));
+        self.reset_buffered_state();
+        self.prepared.reset_batch();
+        write_all_flush(&mut self.write, &response).await?;
+        Ok(true)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::messages::Close;
+
+    #[test]
+    fn only_statement_closes_are_held() {
+        let statement: BytesMut = Close::new("_auto0").try_into().unwrap();
+        assert!(is_statement_close(&statement));
+        let mut portal = statement.clone();
+        portal[5] = b'P';
+        assert!(!is_statement_close(&portal));
+        assert!(!is_statement_close(b"S\0\0\0\x04"));
+    }
+}
@@ -5,9 +5,15 @@ use bytes::BytesMut;
 use lru::LruCache;
 use std::num::NonZeroUsize;
 use std::sync::Arc;
+use std::time::Duration;
 use tokio::io::BufReader;
 
 use crate::client::buffer_pool::PooledBuffer;
+use crate::client::checkout_quota::CheckoutQuota;
+use crate::client::max_query_time::MaxQueryTime;
+use crate::client::tags::ClientTag;
+use crate::client::two_phase::TwoPhaseCommand;
+use crate::config::{DriverCompat, FaultInjection, TwoPhaseCommit};
 use crate::messages::{error_response, Parse};
 use crate::pool::{get_pool, ClientServerMap, ConnectionPool};
 use crate::server::ServerParameters;
@@ -418,6 +424,11 @@ pub struct PreparedStatementState {
     /// Prometheus counter; a sustained non-zero rate signals that
     /// `client_anonymous_prepared_cache_size` is too small for the workload.
     pub anonymous_evictions: u64,
+
+    /// Server pid and its `prepared_resets()` when the first simple query
+    /// of the current round trip was forwarded. A different count once that
+    /// server is idle means the client's DEALLOCATE ALL or DISCARD ALL ran.
+    pub server_resets_before: Option<(i32, u64)>,
 }
 
 impl PreparedStatementState {
@@ -437,6 +448,7 @@ impl PreparedStatementState {
             processed_response_counts: ResponseCounts::default(),
             pending_close_complete: 0,
             anonymous_evictions: 0,
+            server_resets_before: None,
         }
     }
 
@@ -530,6 +542,9 @@ pub struct Client<S, T> {
     /// Cached string representation of addr — avoids per-query allocation in debug logging.
     pub(crate) addr_str: String,
 
+    /// Listener the client came through (`tcp` or `unix`), for metrics.
+    pub(crate) listener: &'static str,
+
     /// Reusable read buffer. Avoids heap allocation per message — clear()+reserve()
     /// reuses existing capacity. split() returns owned data to callers.
     pub(crate) read_buf: BytesMut,
@@ -558,6 +573,10 @@ pub struct Client<S, T> {
     /// Clients want to talk to admin database.
     pub(crate) admin: bool,
 
+    /// Admin database client logged in as one of `stats_users`:
+    /// only SHOW commands are allowed.
+    pub(crate) admin_read_only: bool,
+
     /// Last server process stats we talked to.
     pub(crate) last_server_stats: Option<Arc<ServerStats>>,
 
@@ -580,11 +599,68 @@ pub struct Client<S, T> {
     /// cache keys.
     pub(crate) server_parameters: ServerParameters,
 
+    /// `server_parameters` as of login: what `DISCARD ALL` returns to.
+    pub(crate) startup_parameters: ServerParameters,
+
+    /// The pool's `application_name_template` rendered for this client;
+    /// set on every backend it checks out.
+    pub(crate) backend_application_name: Option<String>,
+
     /// Prepared statements state (caching, batch operations, etc.)
     pub(crate) prepared: PreparedStatementState,
 
     pub(crate) max_memory_usage: u64,
 
+    /// `general.max_client_message_size` in bytes.
+    pub(crate) max_client_message_size: i32,
+
+    /// `general.max_pipeline_depth`; 0 when unlimited.
+    pub(crate) max_pipeline_depth: usize,
+
+    /// ErrorResponse of a pipeline pg_doorman failed. Messages are
+    /// discarded up to the next Sync, and it replaces the backend's error.
+    pub(crate) pipeline_error: Option<BytesMut>,
+
+    /// Reason of the `client_disconnect` connection event when the result
+    /// of the session does not tell it, e.g. `client_idle_timeout`.
+    pub(crate) disconnect_reason: Option<&'static str>,
+
+    /// `general.client_idle_timeout`; None when disabled.
+    pub(crate) client_idle_timeout: Option<Duration>,
+
+    /// `general.client_write_timeout`; None when disabled.
+    pub(crate) client_write_timeout: Option<Duration>,
+
+    /// `general.auto_session_pinning`: leave transaction mode for the rest
+    /// of the session after a statement that creates backend-local state.
+    pub(crate) auto_session_pinning: bool,
+
+    /// `general.two_phase_commit` when the pool runs in transaction mode;
+    /// None for session pools, where two-phase statements pass untouched.
+    pub(crate) two_phase_commit: Option<TwoPhaseCommit>,
+
+    /// The pool's `fault_injection` when `general.enable_fault_injection`
+    /// is on; None otherwise.
+    pub(crate) fault_injection: Option<FaultInjection>,
+
+    /// `max_query_time` of the user or the pool; None when disabled.
+    pub(crate) max_query_time: Option<MaxQueryTime>,
+
+    /// The pool's `driver_compat` profile.
+    pub(crate) driver_compat: Option<DriverCompat>,
+
+    /// The client's place in its tag group (`general.client_tag_parameter`);
+    /// None for untagged clients.
+    pub(crate) client_tag: Option<ClientTag>,
+
+    /// The pool's `application_name_checkout_limits` and
+    /// `tag_checkout_limits` entries that apply to this client.
+    pub(crate) checkout_quotas: Vec<Arc<CheckoutQuota>>,
+
+    /// Two-phase statement sent to the server, with the server's
+    /// `two_phase_commands()` before it. Settled when the server is idle.
+    pub(crate) pending_two_phase: Option<(TwoPhaseCommand, u64)>,
+
     pub(crate) client_last_messages_in_tx: PooledBuffer,
 
     /// Pending BEGIN message for deferred connection optimization.
@@ -592,6 +668,11 @@ pub struct Client<S, T> {
     /// and defer actual BEGIN until next query arrives.
     pub(crate) client_pending_begin: Option<BytesMut>,
 
+    /// Pool of the shard picked with `SET doorman.shard` or
+    /// `doorman.shard_key` for the current or next transaction; None
+    /// serves it from the client's own pool. See `shard`.
+    pub(crate) shard_pool: Option<ConnectionPool>,
+
     /// Raw fd of the client TCP socket. Stored before tokio::io::split()
     /// because ReadHalf/WriteHalf do not expose as_raw_fd().
     /// Used for client migration during graceful reload.
@@ -1,11 +1,14 @@
 use log::{error, info, warn};
+use std::net::SocketAddr;
 #[cfg(unix)]
 use std::os::unix::io::AsRawFd;
 use std::sync::atomic::Ordering;
+use std::sync::Arc;
 use tokio::io::split;
 use tokio::net::{TcpStream, UnixStream};
 
-use crate::config::get_config;
+use crate::config::tls::TLSMode;
+use crate::config::{get_config, Listener};
 use crate::errors::Error;
 use crate::messages::config_socket::configure_tcp_socket_for_cancel;
 use crate::messages::{error_response_terminal, write_all_flush};
@@ -16,7 +19,13 @@ use crate::utils::rate_limit::RateLimiter;
 use crate::transport::ClientTransport;
 
 use super::core::Client;
+use super::handshake::Login;
+use super::proxy_protocol::read_proxy_header;
 use super::startup::{get_startup, startup_tls, ClientConnectionType};
+use super::violation;
+
+/// First byte of a TLS handshake record (ClientHello).
+const TLS_HANDSHAKE_RECORD: u8 = 0x16;
 
 /// Identity info returned from client_entrypoint for disconnect logging.
 pub struct ClientSessionInfo {
@@ -25,6 +34,27 @@ pub struct ClientSessionInfo {
     pub connection_id: u64,
 }
 
+/// On `proxy_protocol` listeners, consume the PROXY header and return the
+/// client address it carries; otherwise return `peer` unchanged.
+async fn client_addr(
+    stream: &mut TcpStream,
+    peer: SocketAddr,
+    listener: Option<&Listener>,
+    login: &Login,
+) -> Result<SocketAddr, Error> {
+    if !listener.is_some_and(|l| l.proxy_protocol) {
+        return Ok(peer);
+    }
+    login
+        .run(read_proxy_header(stream, peer))
+        .await
+        .inspect_err(|err| {
+            if matches!(err, Error::ProxyProtocolError(_)) {
+                crate::web::metrics::record_listener_rejection("proxy_protocol");
+            }
+        })
+}
+
 /// Drive the authenticated-client lifecycle for any transport.
 ///
 /// Three places (plain TCP startup, TCP plain-continue after rejected TLS,
@@ -46,28 +76,32 @@ async fn drive_authenticated_client<S, T>(
     #[cfg(all(unix, feature = "tls-migration"))] ssl_ptr: Option<crate::client::core::SslRawPtr>,
     log_client_connections: bool,
     log_label: &'static str,
+    mut login: Login,
 ) -> Result<Option<ClientSessionInfo>, Error>
 where
     S: tokio::io::AsyncRead + Unpin + Send + 'static,
     T: tokio::io::AsyncWrite + Unpin + Send + 'static,
 {
     let peer = transport.peer_display();
-    match Client::startup(
-        read,
-        write,
-        transport,
-        bytes,
-        client_server_map,
-        admin_only,
-        connection_id,
-        #[cfg(unix)]
-        raw_fd,
-        #[cfg(all(unix, feature = "tls-migration"))]
-        ssl_ptr,
-    )
-    .await
+    let listener = transport.listener();
+    match login
+        .run(Client::startup(
+            read,
+            write,
+            transport,
+            bytes,
+            client_server_map,
+            admin_only,
+            connection_id,
+            #[cfg(unix)]
+            raw_fd,
+            #[cfg(all(unix, feature = "tls-migration"))]
+            ssl_ptr,
+        ))
+        .await
     {
         Ok(mut client) => {
+            login.finish();
             if log_client_connections {
                 info!(
                     "[{}@{} #c{}] client connected from {} ({})",
@@ -85,12 +119,99 @@ where
             }
             result.map(|_| Some(session_info))
         }
-        Err(err) => Err(err),
+        Err(err) => {
+            violation::observe(listener, &peer, &err);
+            Err(err)
+        }
+    }
+}
+
+/// Whether the client opened with a TLS ClientHello instead of a startup
+/// packet. A TLS record starts with content type 22 (handshake), which no
+/// startup packet of sane length does.
+async fn is_direct_tls(stream: &TcpStream) -> Result<bool, Error> {
+    let mut first = [0u8; 1];
+    let n = stream
+        .peek(&mut first)
+        .await
+        .map_err(|err| Error::SocketError(format!("Failed to read from client: {err}")))?;
+    Ok(n == 1 && first[0] == TLS_HANDSHAKE_RECORD)
+}
+
+/// Run a TLS session after SSLRequest was answered with 'S', or right away
+/// for direct TLS.
+#[allow(clippy::too_many_arguments)]
+async fn tls_session(
+    stream: TcpStream,
+    addr: SocketAddr,
+    listener: Option<Arc<Listener>>,
+    client_server_map: ClientServerMap,
+    admin_only: bool,
+    tls_acceptor: tokio_native_tls::TlsAcceptor,
+    tls_rate_limiter: Option<RateLimiter>,
+    connection_id: u64,
+    direct: bool,
+    mut login: Login,
+) -> Result<Option<ClientSessionInfo>, Error> {
+    TLS_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
+    if let Some(tls_rate_limiter) = tls_rate_limiter {
+        tls_rate_limiter.wait().await;
+    }
+
+    // Negotiate TLS.
+    match login
+        .run(startup_tls(
+            stream,
+            addr,
+            listener,
+            client_server_map,
+            admin_only,
+            tls_acceptor,
+            connection_id,
+            direct,
+        ))
+        .await
+    {
+        Ok(mut client) => {
+            login.finish();
+            if get_config().general.log_client_connections {
+                info!(
+                    "[{}@{} #c{}] client connected from {addr} ({})",
+                    client.username,
+                    client.pool_name,
+                    client.connection_id,
+                    if direct { "direct TLS" } else { "TLS" }
+                );
+            }
+            let session_info = ClientSessionInfo {
+                username: client.username.clone(),
+                pool_name: client.pool_name.clone(),
+                connection_id: client.connection_id,
+            };
+            let result = client.handle().await;
+            if !client.is_admin() && result.is_err() {
+                warn!(
+                    "[{}@{} #c{}] client {} disconnected with error: {}",
+                    client.username,
+                    client.pool_name,
+                    client.connection_id,
+                    addr,
+                    result.as_ref().unwrap_err()
+                );
+                client.disconnect_stats();
+            }
+            result.map(|_| Some(session_info))
+        }
+        Err(err) => {
+            violation::observe("tcp", &addr.to_string(), &err);
+            Err(err)
+        }
     }
 }
 
 pub async fn client_entrypoint_too_many_clients_already(
     mut stream: TcpStream,
+    listener: Option<Arc<Listener>>,
     client_server_map: ClientServerMap,
 ) -> Result<(), Error> {
     crate::web::metrics::record_listener_rejection("too_many_clients");
@@ -103,7 +224,15 @@ pub async fn client_entrypoint_too_many_clients_already(
         }
     };
 
-    match get_startup::<TcpStream>(&mut stream).await {
+    // A rejected client must not hold a handshake slot, but its startup
+    // read is still bounded.
+    let login = Login::deadline_only(get_config().general.client_login_timeout.as_std());
+    let addr = client_addr(&mut stream, addr, listener.as_deref(), &login).await?;
+    // A direct TLS client can't read a plain ErrorResponse; just close.
+    if login.run(is_direct_tls(&stream)).await? {
+        return Ok(());
+    }
+    match login.run(get_startup::<TcpStream>(&mut stream)).await {
         Ok((ClientConnectionType::Tls, _)) => {
             write_all_flush(&mut stream, b"N").await?;
             // здесь может быть ошибка SSL is not enabled on the server,
@@ -154,7 +283,8 @@ pub async fn client_entrypoint_too_many_clients_already_unix(
     connection_id: u64,
 ) -> Result<(), Error> {
     crate::web::metrics::record_listener_rejection("too_many_clients");
-    match get_startup::<UnixStream>(&mut stream).await {
+    let login = Login::deadline_only(get_config().general.client_login_timeout.as_std());
+    match login.run(get_startup::<UnixStream>(&mut stream)).await {
         Ok((ClientConnectionType::Tls, _)) => {
             // Unix sockets never negotiate TLS; mirror the main Unix entrypoint
             // and refuse the SSL request with the same error message.
@@ -183,8 +313,12 @@ pub async fn client_entrypoint_too_many_clients_already_unix(
 }
 
 /// Client entrypoint. Returns session identity on success for disconnect logging.
+///
+/// `listener` is the `[[listeners]]` entry the connection was accepted on,
+/// `None` for the primary listener.
 pub async fn client_entrypoint(
     mut stream: TcpStream,
+    listener: Option<Arc<Listener>>,
     client_server_map: ClientServerMap,
     admin_only: bool,
     tls_acceptor: Option<tokio_native_tls::TlsAcceptor>,
@@ -193,7 +327,15 @@ pub async fn client_entrypoint(
 ) -> Result<Option<ClientSessionInfo>, Error> {
     let config = get_config();
     let log_client_connections = config.general.log_client_connections;
-    let tls_mode = config.general.tls_mode.clone();
+    let tls_mode = match &listener {
+        Some(listener) => listener.tls_mode(&config.general),
+        None => config.general.tls_mode.as_deref(),
+    }
+    .map(TLSMode::from_string)
+    .transpose()?;
+    let only_ssl = matches!(tls_mode, Some(TLSMode::Require | TLSMode::VerifyFull));
+    // A listener with tls_mode = disable does not offer TLS at all.
+    let tls_acceptor = tls_acceptor.filter(|_| tls_mode != Some(TLSMode::Disable));
 
     // Figure out if the client wants TLS or not.
     let addr = match stream.peer_addr() {
@@ -205,66 +347,91 @@ pub async fn client_entrypoint(
         }
     };
 
-    match get_startup::<TcpStream>(&mut stream).await {
+    let mut login = Login::start(
+        config.general.client_login_timeout.as_std(),
+        config.general.max_client_handshakes,
+    )?;
+    let addr = client_addr(&mut stream, addr, listener.as_deref(), &login).await?;
+    if let Some(net) = crate::auth::access_list::denied(addr.ip()) {
+        crate::web::metrics::record_listener_rejection("denied");
+        return Err(Error::ClientError(format!(
+            "client {addr} refused: address is in the deny list entry {net}"
+        )));
+    }
+    if let Some(remaining) = crate::auth::ban::banned(addr.ip()) {
+        crate::web::metrics::record_listener_rejection("banned");
+        return Err(Error::ClientError(format!(
+            "client {addr} refused: address banned for another {}s after repeated \
+             authentication failures",
+            remaining.as_secs() + 1
+        )));
+    }
+
+    // Direct TLS: the client skipped SSLRequest and sent a ClientHello.
+    if login.run(is_direct_tls(&stream)).await? {
+        let Some(tls_acceptor) = tls_acceptor else {
+            crate::web::metrics::record_listener_rejection("protocol_error");
+            return Err(Error::ProtocolSyncError(format!(
+                "direct TLS connection from {addr} but TLS is not configured"
+            )));
+        };
+        return tls_session(
+            stream,
+            addr,
+            listener,
+            client_server_map,
+            admin_only,
+            tls_acceptor,
+            tls_rate_limiter,
+            connection_id,
+            true,
+            login,
+        )
+        .await;
+    }
+
+    match login.run(get_startup::<TcpStream>(&mut stream)).await {
         // Client requested a TLS connection.
         Ok((ClientConnectionType::Tls, _)) => {
             // TLS settings are configured, will setup TLS now.
             if let Some(tls_acceptor) = tls_acceptor {
-                TLS_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
                 write_all_flush(&mut stream, b"S").await?;
-
-                if let Some(tls_rate_limiter) = tls_rate_limiter {
-                    tls_rate_limiter.wait().await;
-                }
-
-                // Negotiate TLS.
-                match startup_tls(
+                tls_session(
                     stream,
+                    addr,
+                    listener,
                     client_server_map,
                     admin_only,
                     tls_acceptor,
+                    tls_rate_limiter,
                     connection_id,
+                    false,
+                    login,
                 )
                 .await
-                {
-                    Ok(mut client) => {
-                        if log_client_connections {
-                            info!(
-                                "[{}@{} #c{}] client connected from {addr} (TLS)",
-                                client.username, client.pool_name, client.connection_id
-                            );
-                        }
-                        let session_info = ClientSessionInfo {
-                            username: client.username.clone(),
-                            pool_name: client.pool_name.clone(),
-                            connection_id: client.connection_id,
-                        };
-                        let result = client.handle().await;
-                        if !client.is_admin() && result.is_err() {
-                            warn!(
-                                "[{}@{} #c{}] client {} disconnected with error: {}",
-                                client.username,
-                                client.pool_name,
-                                client.connection_id,
-                                addr,
-                                result.as_ref().unwrap_err()
-                            );
-                            client.disconnect_stats();
-                        }
-                        result.map(|_| Some(session_info))
-                    }
-                    Err(err) => Err(err),
-                }
             }
             // TLS is not configured, we cannot offer it.
             else {
                 // Rejecting client request for TLS.
-                PLAIN_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
                 write_all_flush(&mut stream, b"N").await?;
 
+                // No acceptor while ACME has not issued the first
+                // certificate yet; tls_mode still applies.
+                if only_ssl {
+                    error_response_terminal(
+                        &mut stream,
+                        "TLS certificate is not available yet; connection without SSL is not allowed by tls_mode.",
+                        "28000",
+                    )
+                    .await?;
+                    crate::web::metrics::record_listener_rejection("tls_required");
+                    return Err(Error::ProtocolSyncError("ssl is required".to_string()));
+                }
+                PLAIN_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
+
                 // Attempting regular startup. Client can disconnect now
                 // if they choose.
-                match get_startup::<TcpStream>(&mut stream).await {
+                match login.run(get_startup::<TcpStream>(&mut stream)).await {
                     // Client accepted unencrypted connection.
                     Ok((ClientConnectionType::Startup, bytes)) => {
                         #[cfg(unix)]
@@ -276,6 +443,7 @@ pub async fn client_entrypoint(
                             ClientTransport::Tcp {
                                 peer: addr,
                                 ssl: false,
+                                listener,
                             },
                             bytes,
                             client_server_map,
@@ -287,6 +455,7 @@ pub async fn client_entrypoint(
                             None, // no SSL for plain TCP
                             log_client_connections,
                             "plain",
+                            login,
                         )
                         .await
                     }
@@ -303,6 +472,7 @@ pub async fn client_entrypoint(
 
                     Err(err) => {
                         crate::web::metrics::record_listener_rejection("invalid_startup");
+                        violation::observe("tcp", &addr.to_string(), &err);
                         Err(err)
                     }
                 }
@@ -311,7 +481,7 @@ pub async fn client_entrypoint(
 
         // Client wants to use plain connection without encryption.
         Ok((ClientConnectionType::Startup, bytes)) => {
-            if tls_mode.is_some() && config.general.only_ssl_connections() {
+            if only_ssl {
                 error_response_terminal(
                     &mut stream,
                     "Connection without SSL is not allowed by tls_mode.",
@@ -331,6 +501,7 @@ pub async fn client_entrypoint(
                 ClientTransport::Tcp {
                     peer: addr,
                     ssl: false,
+                    listener,
                 },
                 bytes,
                 client_server_map,
@@ -342,6 +513,7 @@ pub async fn client_entrypoint(
                 None, // no SSL for plain TCP
                 log_client_connections,
                 "plain",
+                login,
             )
             .await
         }
@@ -355,6 +527,7 @@ pub async fn client_entrypoint(
             // "query cancellation failed: cancellation failed: connection to server ..."
             // We set the appropriate socket options to avoid this spurious message.
             configure_tcp_socket_for_cancel(&stream);
+            login.finish();
             let (read, write) = split(stream);
 
             // Continue with cancel query request.
@@ -375,6 +548,7 @@ pub async fn client_entrypoint(
         // Something failed, probably the socket.
         Err(err) => {
             crate::web::metrics::record_listener_rejection("invalid_startup");
+            violation::observe("tcp", &addr.to_string(), &err);
             error!("#c{connection_id} client {addr} startup failed: {err}");
             Err(err)
         }
@@ -391,7 +565,12 @@ pub async fn client_entrypoint_unix(
     let config = get_config();
     let log_client_connections = config.general.log_client_connections;
 
-    match get_startup::<UnixStream>(&mut stream).await {
+    let mut login = Login::start(
+        config.general.client_login_timeout.as_std(),
+        config.general.max_client_handshakes,
+    )?;
+
+    match login.run(get_startup::<UnixStream>(&mut stream)).await {
         Ok((ClientConnectionType::Startup, bytes)) => {
             PLAIN_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
             let raw_fd = Some(stream.as_raw_fd());
@@ -410,6 +589,7 @@ pub async fn client_entrypoint_unix(
                 None, // no SSL on Unix socket
                 log_client_connections,
                 "unix",
+                login,
             )
             .await
         }
@@ -429,6 +609,7 @@ pub async fn client_entrypoint_unix(
 
         Ok((ClientConnectionType::CancelQuery, bytes)) => {
             CANCEL_CONNECTION_COUNTER.fetch_add(1, Ordering::Relaxed);
+            login.finish();
             let (read, write) = split(stream);
 
             // Unix clients have no peer addr; use the loopback sentinel the
@@ -453,6 +634,7 @@ pub async fn client_entrypoint_unix(
 
         Err(err) => {
             crate::web::metrics::record_listener_rejection("invalid_startup");
+            violation::observe("unix", "unix:", &err);
             error!("#c{connection_id} unix client startup failed: {err}");
             Err(err)
         }
@@ -1,4 +1,5 @@
 use crate::client::core::Client;
+use crate::client::violation;
 use crate::errors::Error;
 use crate::messages::error_response;
 
@@ -18,8 +19,33 @@ where
         Err(err)
     }
 
+    /// Count and log a protocol violation behind a failed client read.
+    fn observe_protocol_violation(&self, err: &Error) {
+        match err {
+            // read_message_reuse leaves the refused header in read_buf.
+            Error::MaxMessageSize => violation::report(
+                self.listener,
+                "bad_length",
+                &self.addr_str,
+                "message longer than max_client_message_size",
+                &self.read_buf,
+            ),
+            _ => violation::observe(self.listener, &self.addr_str, err),
+        }
+    }
+
     pub(crate) async fn process_error(&mut self, err: Error) -> Result<(), Error> {
+        self.observe_protocol_violation(&err);
+        // Only reads from the client end up here: a socket error is the
+        // client going away.
+        if matches!(err, Error::SocketError(_)) {
+            self.disconnect_reason = Some("client_eof");
+        }
         match err {
+            Error::ClientProtocolViolation { ref detail, .. } => {
+                let message = format!("protocol violation: {detail}");
+                self.send_error_response(&message, "08P01", err).await
+            }
             Error::MaxMessageSize => {
                 self.send_error_response(
                     "Message exceeds maximum allowed size. Please reduce the size of your query or data.",
@@ -48,6 +74,10 @@ where
                 );
                 self.send_error_response(&message, "53000", err).await
             }
+            Error::CircuitBreakerOpen(ref msg) => {
+                let message = format!("Database unavailable: {msg}. Please try again later.");
+                self.send_error_response(&message, "08004", err).await
+            }
             Error::ServerUnavailableError(ref msg, _) => {
                 let message = format!("Server unavailable: {msg}. Please try again later.");
                 self.send_error_response(&message, "08006", err).await
@@ -0,0 +1,106 @@
+//! Eviction of idle clients above `general.max_connections_soft`.
+//!
+//! Every connection accepted while more than `max_connections_soft`
+//! clients are connected asks one idle client to leave, so the count
+//! drifts back under the soft limit without refusing anyone. Only users
+//! over their quota give up clients: the quota is the soft limit split
+//! evenly between the users that have clients, and the evicted client is
+//! the longest idle one of those users. A client is closed at its next
+//! idle point outside a transaction, never in the middle of one. At
+//! `max_connections` new connections are refused as before.
+
+use std::collections::HashMap;
+
+use log::info;
+
+use crate::pool::{get_all_pools, PoolIdentifier};
+use crate::stats::get_client_stats;
+
+/// A connected client, as seen by the eviction choice.
+struct Candidate<'a> {
+    user: &'a str,
+    /// None unless the client is idle and not already being evicted.
+    idle_ms: Option<u64>,
+}
+
+/// Index of the client to evict: the longest idle client of a user with
+/// more clients than its share of `soft_limit`.
+fn choose(candidates: &[Candidate], soft_limit: u64) -> Option<usize> {
+    let mut per_user: HashMap<&str, u64> = HashMap::new();
+    for candidate in candidates {
+        *per_user.entry(candidate.user).or_default() += 1;
+    }
+    let quota = soft_limit.div_ceil(per_user.len().max(1) as u64).max(1);
+    candidates
+        .iter()
+        .enumerate()
+        .filter(|(_, c)| per_user[c.user] > quota)
+        .filter_map(|(i, c)| Some((i, c.idle_ms?)))
+        .max_by_key(|&(_, idle_ms)| idle_ms)
+        .map(|(i, _)| i)
+}
+
+/// Ask one idle client of an over-quota user to disconnect. Called for a
+/// connection accepted above `soft_limit`.
+pub fn evict_idle_client(soft_limit: u64) {
+    let pools = get_all_pools();
+    let clients: Vec<_> = get_client_stats()
+        .into_values()
+        .filter(|stats| {
+            // The admin console has no pool and is never evicted.
+            let pool = PoolIdentifier::new(stats.pool_name(), stats.username());
+            pools.contains_key(&pool)
+        })
+        .collect();
+    let candidates: Vec<Candidate> = clients
+        .iter()
+        .map(|stats| Candidate {
+            user: stats.username(),
+            idle_ms: stats.idle_ms().filter(|_| !stats.evicting()),
+        })
+        .collect();
+    let Some(i) = choose(&candidates, soft_limit) else {
+        return;
+    };
+    let stats = &clients[i];
+    if stats.evict() {
+        crate::web::metrics::record_client_eviction(stats.username());
+        info!(
+            "[{}@{} #c{}] client {} evicted: above max_connections_soft ({soft_limit}), idle {}ms",
+            stats.username(),
+            stats.pool_name(),
+            stats.connection_id(),
+            stats.ipaddr(),
+            candidates[i].idle_ms.unwrap_or_default()
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn candidate(user: &str, idle_ms: Option<u64>) -> Candidate<'_> {
+        Candidate { user, idle_ms }
+    }
+
+    #[test]
+    fn evicts_longest_idle_client_of_over_quota_user() {
+        let candidates = [
+            candidate("batch", Some(10)),
+            candidate("batch", Some(500)),
+            candidate("batch", None),
+            candidate("web", Some(9000)),
+        ];
+        // Two users share a soft limit of 2: one client each.
+        assert_eq!(choose(&candidates, 2), Some(1));
+        // With a soft limit of 6 nobody is over quota.
+        assert_eq!(choose(&candidates, 6), None);
+    }
+
+    #[test]
+    fn busy_clients_are_not_evicted() {
+        let candidates = [candidate("batch", None), candidate("batch", None)];
+        assert_eq!(choose(&candidates, 1), None);
+    }
+}
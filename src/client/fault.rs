@@ -0,0 +1,223 @@
+//! Fault injection on the client's backend round trip
+//! (`pools.<name>.fault_injection`, gated by
+//! `general.enable_fault_injection`), for validating application retry
+//! behaviour and pooler recovery in staging.
+//!
+//! Every fault that interrupts a request marks the backend bad: the
+//! response was not delivered as PostgreSQL sent it, so the connection
+//! can't be trusted to be in sync with the client anymore.
+
+use std::time::Duration;
+
+use log::warn;
+use rand::Rng;
+
+use crate::client::core::Client;
+use crate::config::{Config, FaultInjection};
+use crate::errors::Error;
+use crate::messages::{error_response_terminal, write_all_flush};
+use crate::server::Server;
+
+/// What to do to one request.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Fault {
+    /// Forward the request normally.
+    None,
+    /// Never send the request; close the client without a reply.
+    Drop,
+    /// Forward the request, then cut the response off in the middle of a
+    /// message and close the client.
+    Truncate,
+    /// Forward the request, then close the backend connection while the
+    /// statement runs.
+    Disconnect,
+}
+
+/// Fault settings for clients of `pool_name`, or `None` when fault
+/// injection is off or the pool has nothing configured.
+pub(crate) fn for_pool(config: &Config, pool_name: &str) -> Option<FaultInjection> {
+    if !config.general.enable_fault_injection {
+        return None;
+    }
+    config
+        .pools
+        .get(pool_name)
+        .and_then(|pool| pool.fault_injection.clone())
+        .filter(FaultInjection::is_active)
+}
+
+/// Delay to add before the request, if any.
+pub(crate) fn latency(faults: &FaultInjection, rng: &mut impl Rng) -> Option<Duration> {
+    let jitter = faults.latency_jitter.as_millis();
+    let extra = if jitter > 0 {
+        rng.random_range(0..jitter)
+    } else {
+        0
+    };
+    let total = faults.latency.as_millis() + extra;
+    (total > 0).then(|| Duration::from_millis(total))
+}
+
+/// Rolls the fault for one request. The probabilities are disjoint
+/// shares of all requests and add up to at most 1.
+pub(crate) fn roll(faults: &FaultInjection, rng: &mut impl Rng) -> Fault {
+    let sample: f64 = rng.random();
+    let mut threshold = faults.drop_probability;
+    if sample < threshold {
+        return Fault::Drop;
+    }
+    threshold += faults.truncate_probability;
+    if sample < threshold {
+        return Fault::Truncate;
+    }
+    threshold += faults.disconnect_probability;
+    if sample < threshold {
+        return Fault::Disconnect;
+    }
+    Fault::None
+}
+
+/// Where to cut a response of `len` bytes: inside the first message, so
+/// the client is left with a partial frame.
+pub(crate) fn truncate_at(len: usize) -> usize {
+    (len / 2).max(5).min(len.saturating_sub(1))
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// Waits out the configured latency and rolls the fault for the
+    /// request about to be sent. A dropped request ends the client here.
+    pub(crate) async fn fault_before_send(&self, server: &mut Server) -> Result<Fault, Error> {
+        let Some(faults) = &self.fault_injection else {
+            return Ok(Fault::None);
+        };
+        let (delay, fault) = {
+            let mut rng = rand::rng();
+            (latency(faults, &mut rng), roll(faults, &mut rng))
+        };
+        if let Some(delay) = delay {
+            tokio::time::sleep(delay).await;
+        }
+        if fault == Fault::Drop {
+            self.log_fault(fault, server);
+            server.mark_bad("fault injection: request dropped");
+            return Err(Error::SocketError(
+                "fault injection: request dropped".to_string(),
+            ));
+        }
+        Ok(fault)
+    }
+
+    /// Applies a fault to a request already sent to `server`.
+    pub(crate) async fn fault_after_send(
+        &mut self,
+        fault: Fault,
+        server: &mut Server,
+    ) -> Result<(), Error> {
+        match fault {
+            Fault::None | Fault::Drop => Ok(()),
+            Fault::Truncate => {
+                self.log_fault(fault, server);
+                server.mark_bad("fault injection: response truncated");
+                let response = server
+                    .recv(&mut self.write, Some(&mut self.server_parameters))
+                    .await?;
+                let cut = truncate_at(response.len());
+                let _ = write_all_flush(&mut self.write, &response[..cut]).await;
+                Err(Error::SocketError(
+                    "fault injection: response truncated".to_string(),
+                ))
+            }
+            Fault::Disconnect => {
+                self.log_fault(fault, server);
+                // Dropping a bad server closes the socket without
+                // Terminate; PostgreSQL aborts the statement and any open
+                // transaction.
+                server.mark_bad("fault injection: backend disconnected");
+                let _ = error_response_terminal(
+                    &mut self.write,
+                    "server closed the connection unexpectedly",
+                    "08006",
+                )
+                .await;
+                Err(Error::SocketError(
+                    "fault injection: backend disconnected".to_string(),
+                ))
+            }
+        }
+    }
+
+    fn log_fault(&self, fault: Fault, server: &Server) {
+        warn!(
+            "[{}@{} #c{}] fault injection: {fault:?} on request to server pid={}",
+            self.username,
+            self.pool_name,
+            self.connection_id,
+            server.get_process_id()
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rand::rngs::StdRng;
+    use rand::SeedableRng;
+
+    #[test]
+    fn roll_respects_probabilities() {
+        let mut rng = StdRng::seed_from_u64(7);
+        let faults = FaultInjection {
+            drop_probability: 0.1,
+            truncate_probability: 0.2,
+            disconnect_probability: 0.3,
+            ..Default::default()
+        };
+        let mut counts = [0usize; 4];
+        for _ in 0..100_000 {
+            let index = match roll(&faults, &mut rng) {
+                Fault::Drop => 0,
+                Fault::Truncate => 1,
+                Fault::Disconnect => 2,
+                Fault::None => 3,
+            };
+            counts[index] += 1;
+        }
+        for (count, expected) in counts.iter().zip([10_000, 20_000, 30_000, 40_000]) {
+            assert!(count.abs_diff(expected) < 1_500, "{counts:?}");
+        }
+    }
+
+    #[test]
+    fn roll_never_faults_without_probabilities() {
+        let mut rng = StdRng::seed_from_u64(1);
+        let faults = FaultInjection::default();
+        assert!((0..1000).all(|_| roll(&faults, &mut rng) == Fault::None));
+    }
+
+    #[test]
+    fn latency_adds_jitter() {
+        let mut rng = StdRng::seed_from_u64(3);
+        let faults = FaultInjection {
+            latency: crate::config::Duration::from_millis(50),
+            latency_jitter: crate::config::Duration::from_millis(10),
+            ..Default::default()
+        };
+        for _ in 0..100 {
+            let delay = latency(&faults, &mut rng).unwrap();
+            assert!((50..60).contains(&(delay.as_millis() as u64)), "{delay:?}");
+        }
+        assert_eq!(latency(&FaultInjection::default(), &mut rng), None);
+    }
+
+    #[test]
+    fn truncate_cuts_inside_the_response() {
+        assert_eq!(truncate_at(100), 50);
+        assert_eq!(truncate_at(6), 5);
+        assert_eq!(truncate_at(3), 2);
+        assert_eq!(truncate_at(1), 0);
+    }
+}
@@ -0,0 +1,257 @@
+//! Limits on the pre-authentication phase of a client connection.
+//!
+//! Between accept and the end of authentication a client holds a socket, a
+//! task and possibly a TLS session while sending nothing useful. A
+//! [`Login`] bounds that phase in time (`client_login_timeout`) and in
+//! concurrency (`max_client_handshakes`), so clients that open a connection
+//! and stall cannot pile up.
+//!
+//! Authentication itself (password exchange, `auth_query`, the first
+//! backend login of a pool) goes through a [`LoginQueue`] slot: at most
+//! `max_concurrent_logins` clients run it at once and at most
+//! `max_login_queue` wait for their turn. During a reconnect storm the
+//! rest are told to retry right away instead of holding a socket until
+//! `client_login_timeout`.
+
+use std::future::Future;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::time::Duration;
+
+use tokio::sync::Notify;
+use tokio::time::Instant;
+
+use crate::errors::Error;
+
+/// Clients currently between accept and the end of authentication.
+static IN_HANDSHAKE: AtomicUsize = AtomicUsize::new(0);
+
+/// Clients currently authenticating.
+static LOGINS_ACTIVE: AtomicUsize = AtomicUsize::new(0);
+
+/// Clients waiting in the login queue.
+static LOGINS_WAITING: AtomicUsize = AtomicUsize::new(0);
+
+/// Signalled each time an authentication slot frees up.
+static LOGIN_SLOT_FREED: Notify = Notify::const_new();
+
+/// Take one unit of `counter` unless `max` are already taken
+/// (0 = unlimited).
+fn try_acquire(counter: &AtomicUsize, max: usize) -> bool {
+    let prev = counter.fetch_add(1, Ordering::AcqRel);
+    if max > 0 && prev >= max {
+        counter.fetch_sub(1, Ordering::AcqRel);
+        return false;
+    }
+    true
+}
+
+/// Slot in a concurrent-handshake budget, released on drop.
+struct HandshakeSlot(&'static AtomicUsize);
+
+impl HandshakeSlot {
+    /// None when `max` clients already hold a slot of `counter`
+    /// (0 = unlimited).
+    fn acquire(counter: &'static AtomicUsize, max: usize) -> Option<HandshakeSlot> {
+        try_acquire(counter, max).then(|| HandshakeSlot(counter))
+    }
+}
+
+impl Drop for HandshakeSlot {
+    fn drop(&mut self) {
+        self.0.fetch_sub(1, Ordering::AcqRel);
+    }
+}
+
+/// Deadline and handshake slot of one connecting client.
+pub struct Login {
+    deadline: Option<Instant>,
+    slot: Option<HandshakeSlot>,
+}
+
+impl Login {
+    /// Start the login phase. Fails when `max_handshakes` clients are
+    /// already in it.
+    pub fn start(timeout: Duration, max_handshakes: usize) -> Result<Login, Error> {
+        let Some(slot) = HandshakeSlot::acquire(&IN_HANDSHAKE, max_handshakes) else {
+            crate::web::metrics::record_listener_rejection("too_many_handshakes");
+            return Err(Error::ClientError(format!(
+                "too many clients logging in (max_client_handshakes={max_handshakes})"
+            )));
+        };
+        Ok(Login {
+            slot: Some(slot),
+            ..Login::deadline_only(timeout)
+        })
+    }
+
+    /// Login deadline without a handshake slot, for connections that are
+    /// rejected right after the startup packet.
+    pub fn deadline_only(timeout: Duration) -> Login {
+        Login {
+            deadline: (!timeout.is_zero()).then(|| Instant::now() + timeout),
+            slot: None,
+        }
+    }
+
+    /// Run one handshake step under the login deadline.
+    pub async fn run<T, F>(&self, step: F) -> Result<T, Error>
+    where
+        F: Future<Output = Result<T, Error>>,
+    {
+        let Some(deadline) = self.deadline else {
+            return step.await;
+        };
+        match tokio::time::timeout_at(deadline, step).await {
+            Ok(result) => result,
+            Err(_) => {
+                crate::web::metrics::record_listener_rejection("login_timeout");
+                crate::web::metrics::record_auth_failure("timeout", None);
+                Err(Error::ClientLoginTimeout)
+            }
+        }
+    }
+
+    /// The client is authenticated (or is a cancel request): free the
+    /// handshake slot and drop the deadline.
+    pub fn finish(&mut self) {
+        self.deadline = None;
+        self.slot = None;
+    }
+}
+
+/// Clients authenticating and clients waiting to, for metrics.
+pub fn login_queue_depth() -> (usize, usize) {
+    (
+        LOGINS_ACTIVE.load(Ordering::Relaxed),
+        LOGINS_WAITING.load(Ordering::Relaxed),
+    )
+}
+
+/// Authentication slot of one client, released on drop.
+pub struct LoginQueue {
+    active: &'static AtomicUsize,
+    freed: &'static Notify,
+}
+
+impl LoginQueue {
+    /// Wait for an authentication slot. `max_active` bounds the clients
+    /// authenticating at once and `max_waiting` the clients queued for a
+    /// slot (0 = unlimited for both). None when the queue is full.
+    pub async fn enter(max_active: usize, max_waiting: usize) -> Option<LoginQueue> {
+        Self::enter_with(
+            &LOGINS_ACTIVE,
+            &LOGINS_WAITING,
+            &LOGIN_SLOT_FREED,
+            max_active,
+            max_waiting,
+        )
+        .await
+    }
+
+    async fn enter_with(
+        active: &'static AtomicUsize,
+        waiting: &'static AtomicUsize,
+        freed: &'static Notify,
+        max_active: usize,
+        max_waiting: usize,
+    ) -> Option<LoginQueue> {
+        // Newcomers only take a free slot when nobody is queued, so the
+        // queue is served first.
+        if waiting.load(Ordering::Acquire) == 0 && try_acquire(active, max_active) {
+            return Some(LoginQueue { active, freed });
+        }
+        let _queued = HandshakeSlot::acquire(waiting, max_waiting)?;
+        loop {
+            let notified = freed.notified();
+            tokio::pin!(notified);
+            notified.as_mut().enable();
+            if try_acquire(active, max_active) {
+                return Some(LoginQueue { active, freed });
+            }
+            notified.await;
+        }
+    }
+}
+
+impl Drop for LoginQueue {
+    fn drop(&mut self) {
+        self.active.fetch_sub(1, Ordering::AcqRel);
+        self.freed.notify_one();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    async fn sleep_ok(ms: u64) -> Result<u64, Error> {
+        tokio::time::sleep(Duration::from_millis(ms)).await;
+        Ok(ms)
+    }
+
+    #[tokio::test]
+    async fn login_times_out() {
+        let login = Login::start(Duration::from_millis(20), 0).unwrap();
+        assert_eq!(
+            login.run(sleep_ok(5000)).await,
+            Err(Error::ClientLoginTimeout)
+        );
+    }
+
+    #[tokio::test]
+    async fn fast_login_passes() {
+        let login = Login::start(Duration::from_secs(5), 0).unwrap();
+        assert_eq!(login.run(sleep_ok(1)).await, Ok(1));
+    }
+
+    #[tokio::test]
+    async fn zero_timeout_disables_deadline() {
+        let login = Login::start(Duration::ZERO, 0).unwrap();
+        assert_eq!(login.run(sleep_ok(50)).await, Ok(50));
+    }
+
+    #[tokio::test]
+    async fn finished_login_has_no_deadline() {
+        let mut login = Login::start(Duration::from_millis(20), 0).unwrap();
+        login.finish();
+        assert_eq!(login.run(sleep_ok(50)).await, Ok(50));
+    }
+
+    #[test]
+    fn handshake_slots_are_bounded_and_released() {
+        static COUNTER: AtomicUsize = AtomicUsize::new(0);
+        let first = HandshakeSlot::acquire(&COUNTER, 2).unwrap();
+        let second = HandshakeSlot::acquire(&COUNTER, 2).unwrap();
+        assert!(HandshakeSlot::acquire(&COUNTER, 2).is_none());
+        drop(first);
+        let third = HandshakeSlot::acquire(&COUNTER, 2).unwrap();
+        drop(second);
+        drop(third);
+        assert_eq!(COUNTER.load(Ordering::Relaxed), 0);
+        let _unlimited: Vec<_> = (0..10)
+            .map(|_| HandshakeSlot::acquire(&COUNTER, 0).unwrap())
+            .collect();
+    }
+
+    #[tokio::test]
+    async fn login_queue_waits_for_a_slot_and_rejects_overflow() {
+        static ACTIVE: AtomicUsize = AtomicUsize::new(0);
+        static WAITING: AtomicUsize = AtomicUsize::new(0);
+        static FREED: Notify = Notify::const_new();
+        let enter = || LoginQueue::enter_with(&ACTIVE, &WAITING, &FREED, 1, 1);
+
+        let first = enter().await.unwrap();
+        let queued = tokio::spawn(enter());
+        while WAITING.load(Ordering::Acquire) == 0 {
+            tokio::task::yield_now().await;
+        }
+        assert!(enter().await.is_none(), "queue of one is full");
+
+        drop(first);
+        let second = queued.await.unwrap().unwrap();
+        assert_eq!(ACTIVE.load(Ordering::Acquire), 1);
+        assert_eq!(WAITING.load(Ordering::Acquire), 0);
+        drop(second);
+        assert_eq!(ACTIVE.load(Ordering::Acquire), 0);
+    }
+}
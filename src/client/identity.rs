@@ -0,0 +1,197 @@
+//! Client identity forwarded by an upstream pooler
+//! (`general.trusted_upstream_poolers`).
+//!
+//! Behind another pooler every client seems to come from the pooler's
+//! address. An upstream listed in `trusted_upstream_poolers` can name the
+//! original client in the `client_identity_parameter` startup parameter
+//! (`doorman.client_addr` by default), set on its own or with `-c` in
+//! `options`, as `ip`, `ip:port` or `[ipv6]:port`. pg_doorman then uses
+//! that address everywhere it would use the peer's: HBA rules, the deny
+//! list and bans, logs, `SHOW CLIENTS`, and its own `client_addr_guc` and
+//! `application_name_template`, so the identity survives any number of
+//! layers. The parameter never reaches PostgreSQL; sent by any other peer
+//! it is dropped with a warning.
+
+use std::collections::HashMap;
+use std::net::{IpAddr, SocketAddr};
+
+use log::{debug, warn};
+use tokio::io::AsyncWrite;
+
+use crate::auth::{access_list, ban};
+use crate::config::{get_config, General};
+use crate::errors::Error;
+use crate::messages::error_response_terminal;
+use crate::transport::ClientTransport;
+
+use super::util::startup_options_setting;
+
+/// Whether `ip` belongs to one of `trusted_upstream_poolers`.
+fn trusted(general: &General, ip: IpAddr) -> bool {
+    general
+        .trusted_upstream_poolers
+        .iter()
+        .filter_map(|upstream| access_list::parse_net(upstream))
+        .any(|net| net.contains(&ip))
+}
+
+/// The client a trusted upstream speaks for, taken out of `parameters`.
+/// None when the parameter is absent, the peer is not trusted or the
+/// client is a unix socket one. `unix`, which pg_doorman itself forwards
+/// for its unix socket clients, keeps the upstream's address too.
+fn forwarded_addr(
+    general: &General,
+    peer: Option<SocketAddr>,
+    parameters: &mut HashMap<String, String>,
+) -> Result<Option<SocketAddr>, String> {
+    let name = general.client_identity_parameter.as_str();
+    let Some(value) = parameters
+        .remove(name)
+        .or_else(|| startup_options_setting(parameters.get("options")?, name))
+    else {
+        return Ok(None);
+    };
+    let Some(peer) = peer else {
+        return Ok(None);
+    };
+    if !trusted(general, peer.ip()) {
+        warn!("client {peer} sent {name}, ignored: not in trusted_upstream_poolers");
+        return Ok(None);
+    }
+    if value == "unix" {
+        return Ok(None);
+    }
+    let client = value.parse::<SocketAddr>().ok().or_else(|| {
+        let ip = value.parse::<IpAddr>().ok()?;
+        Some(SocketAddr::new(ip, 0))
+    });
+    client
+        .map(Some)
+        .ok_or_else(|| format!("upstream pooler {peer} sent a bad {name}: {value:?}"))
+}
+
+/// `transport` with the peer replaced by the client a trusted upstream
+/// forwarded, after the deny list and bans of that client are checked.
+pub(crate) async fn apply<T>(
+    write: &mut T,
+    transport: ClientTransport,
+    parameters: &mut HashMap<String, String>,
+) -> Result<ClientTransport, Error>
+where
+    T: AsyncWrite + Unpin,
+{
+    let peer = match &transport {
+        ClientTransport::Tcp { peer, .. } => Some(*peer),
+        ClientTransport::Unix => None,
+    };
+    let client = match forwarded_addr(&get_config().general, peer, parameters) {
+        Ok(Some(client)) => client,
+        Ok(None) => return Ok(transport),
+        Err(message) => {
+            error_response_terminal(write, &message, "08P01").await?;
+            return Err(Error::ClientError(message));
+        }
+    };
+    let rejection = if let Some(net) = access_list::denied(client.ip()) {
+        crate::web::metrics::record_listener_rejection("denied");
+        Some(format!("address is in the deny list entry {net}"))
+    } else if let Some(remaining) = ban::banned(client.ip()) {
+        crate::web::metrics::record_listener_rejection("banned");
+        Some(format!(
+            "address banned for another {}s after repeated authentication failures",
+            remaining.as_secs() + 1
+        ))
+    } else {
+        None
+    };
+    if let Some(reason) = rejection {
+        error_response_terminal(write, "connection refused", "28000").await?;
+        return Err(Error::ClientError(format!(
+            "client {client} (via {}) refused: {reason}",
+            transport.peer_display()
+        )));
+    }
+    debug!(
+        "client {client} connected via upstream pooler {}",
+        transport.peer_display()
+    );
+    match transport {
+        ClientTransport::Tcp { ssl, listener, .. } => Ok(ClientTransport::Tcp {
+            peer: client,
+            ssl,
+            listener,
+        }),
+        ClientTransport::Unix => Ok(ClientTransport::Unix),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn general(trusted: &[&str]) -> General {
+        General {
+            trusted_upstream_poolers: trusted.iter().map(|s| s.to_string()).collect(),
+            ..General::default()
+        }
+    }
+
+    fn params(value: &str) -> HashMap<String, String> {
+        HashMap::from([
+            ("user".to_string(), "app".to_string()),
+            ("doorman.client_addr".to_string(), value.to_string()),
+        ])
+    }
+
+    #[test]
+    fn trusted_upstream_forwards_client_address() {
+        let general = general(&["10.0.0.0/8"]);
+        let upstream: SocketAddr = "10.1.1.1:40000".parse().unwrap();
+        let mut parameters = params("192.0.2.7:5555");
+        assert_eq!(
+            forwarded_addr(&general, Some(upstream), &mut parameters),
+            Ok(Some("192.0.2.7:5555".parse().unwrap()))
+        );
+        // The parameter is never forwarded to PostgreSQL.
+        assert!(!parameters.contains_key("doorman.client_addr"));
+        assert_eq!(
+            forwarded_addr(&general, Some(upstream), &mut params("2001:db8::7")),
+            Ok(Some("[2001:db8::7]:0".parse().unwrap()))
+        );
+        assert_eq!(
+            forwarded_addr(&general, Some(upstream), &mut params("unix")),
+            Ok(None)
+        );
+        assert!(forwarded_addr(&general, Some(upstream), &mut params("host:1")).is_err());
+    }
+
+    #[test]
+    fn untrusted_peers_keep_their_address() {
+        let general = general(&["10.0.0.0/8"]);
+        let peer: SocketAddr = "192.168.1.1:40000".parse().unwrap();
+        let mut parameters = params("192.0.2.7:5555");
+        assert_eq!(
+            forwarded_addr(&general, Some(peer), &mut parameters),
+            Ok(None)
+        );
+        assert!(!parameters.contains_key("doorman.client_addr"));
+        assert_eq!(
+            forwarded_addr(&general, None, &mut params("192.0.2.7")),
+            Ok(None)
+        );
+    }
+
+    #[test]
+    fn identity_can_come_in_options() {
+        let general = general(&["10.0.0.1"]);
+        let upstream: SocketAddr = "10.0.0.1:40000".parse().unwrap();
+        let mut parameters = HashMap::from([(
+            "options".to_string(),
+            "-c doorman.client_addr=192.0.2.9".to_string(),
+        )]);
+        assert_eq!(
+            forwarded_addr(&general, Some(upstream), &mut parameters),
+            Ok(Some("192.0.2.9:0".parse().unwrap()))
+        );
+    }
+}
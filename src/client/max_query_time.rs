@@ -0,0 +1,251 @@
+//! Per-pool and per-user `max_query_time`, so that ad-hoc queries can't
+//! hold a transaction-mode backend for hours.
+//!
+//! A request whose response has not completed `max_query_time` after it
+//! was sent is canceled the way a client cancel request would be: the
+//! client gets PostgreSQL's own `57014` error and the session goes on. If
+//! the backend still has not answered `max_query_time_grace` later, it is
+//! terminated with `pg_terminate_backend` over a connection of its own to
+//! the same host, opened outside the pool so a saturated pool can't hold
+//! it up, its socket is closed and the client is disconnected with
+//! `57P01`. A user's own `max_query_time` overrides the pool's; 0 turns
+//! the limit off.
+
+use std::time::Duration;
+
+use bytes::BytesMut;
+use log::warn;
+use tokio::time::{sleep_until, Instant};
+
+use crate::client::core::Client;
+use crate::config::Config;
+use crate::errors::Error;
+use crate::messages::error_response_terminal;
+use crate::pool::{get_pool, CancelTarget, CANCELED_PIDS};
+use crate::server::Server;
+
+/// `max_query_time_grace` when the pool does not set it.
+const DEFAULT_GRACE: Duration = Duration::from_secs(10);
+
+/// Limits of one client, resolved at login.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct MaxQueryTime {
+    limit: Duration,
+    grace: Duration,
+}
+
+impl MaxQueryTime {
+    /// Start timing a request sent now.
+    pub(crate) fn start(self) -> Deadline {
+        Deadline {
+            policy: self,
+            cancel_at: Instant::now() + self.limit,
+            canceled: false,
+        }
+    }
+}
+
+/// Progress of one request against its `MaxQueryTime`.
+pub(crate) struct Deadline {
+    policy: MaxQueryTime,
+    cancel_at: Instant,
+    canceled: bool,
+}
+
+/// `max_query_time` of `username` in `pool_name`: the user's own value,
+/// else the pool's. None when neither is set or the value is 0.
+pub(crate) fn for_user(config: &Config, pool_name: &str, username: &str) -> Option<MaxQueryTime> {
+    let pool = config.pools.get(pool_name)?;
+    let user = pool
+        .users
+        .iter()
+        .find(|user| user.username == username)
+        .or_else(|| pool.wildcard_user());
+    let limit = user
+        .and_then(|user| user.max_query_time)
+        .or(pool.max_query_time)?
+        .as_std();
+    if limit.is_zero() {
+        return None;
+    }
+    let grace = pool
+        .max_query_time_grace
+        .map_or(DEFAULT_GRACE, |grace| grace.as_std());
+    Some(MaxQueryTime { limit, grace })
+}
+
+/// Send a cancel request for the query running on `target`.
+async fn cancel(target: CancelTarget) {
+    // The cancel may land after the query ended; don't hand the
+    // connection to another client.
+    CANCELED_PIDS.lock().insert(target.process_id);
+    if let Err(err) = Server::cancel(
+        &target.host,
+        target.port,
+        target.process_id,
+        &target.secret_key,
+        &target.server_tls,
+        target.connected_with_tls,
+        &target.pool_name,
+    )
+    .await
+    {
+        warn!(
+            "[{}] failed to cancel query on server pid={}: {err}",
+            target.pool_name, target.process_id
+        );
+    }
+}
+
+/// Terminate backend `process_id` on `host:port` over a dedicated
+/// connection, as `Server::cancel` does for cancel requests: the pool may
+/// be saturated by the very queries being terminated.
+async fn terminate(pool_name: String, username: String, host: String, port: u16, process_id: i32) {
+    let Some(pool) = get_pool(&pool_name, &username) else {
+        return;
+    };
+    let query = format!("SELECT pg_terminate_backend({process_id})");
+    let server_pool = pool.database.server_pool();
+    let result = match server_pool.connect_unpooled(&host, port).await {
+        Ok(mut conn) => conn.small_simple_query(&query).await,
+        Err(err) => Err(err),
+    };
+    if let Err(err) = result {
+        warn!("[{username}@{pool_name}] failed to terminate server pid={process_id}: {err}");
+    }
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// `server.recv`, bounded by `deadline` when the client has a
+    /// `max_query_time`. Past the deadline the query is canceled; past the
+    /// grace period after that the backend is terminated and the client
+    /// closed.
+    pub(crate) async fn recv_within(
+        &mut self,
+        server: &mut Server,
+        deadline: Option<&mut Deadline>,
+    ) -> Result<BytesMut, Error> {
+        let Some(deadline) = deadline else {
+            return server
+                .recv(&mut self.write, Some(&mut self.server_parameters))
+                .await;
+        };
+        let process_id = server.get_process_id();
+        let policy = deadline.policy;
+        {
+            // Not dropped until the backend is given up: a partly read
+            // message can't be resumed.
+            let recv = server.recv(&mut self.write, Some(&mut self.server_parameters));
+            tokio::pin!(recv);
+            if !deadline.canceled {
+                tokio::select! {
+                    biased;
+                    response = &mut recv => return response,
+                    _ = sleep_until(deadline.cancel_at) => {}
+                }
+                deadline.canceled = true;
+                warn!(
+                    "[{}@{} #c{}] query running longer than max_query_time ({:?}), canceling it on server pid={process_id}",
+                    self.username, self.pool_name, self.connection_id, policy.limit
+                );
+                crate::web::metrics::record_max_query_time(
+                    &self.username,
+                    &self.pool_name,
+                    "cancel",
+                );
+                let target = self
+                    .client_server_map
+                    .get(&(self.connection_id as i32, self.secret_key))
+                    .map(|entry| entry.value().clone());
+                if let Some(target) = target {
+                    tokio::spawn(cancel(target));
+                }
+            }
+            tokio::select! {
+                biased;
+                response = &mut recv => return response,
+                _ = sleep_until(deadline.cancel_at + policy.grace) => {}
+            }
+        }
+        warn!(
+            "[{}@{} #c{}] client {} closed: query still running {:?} after cancel, terminating server pid={process_id}",
+            self.username, self.pool_name, self.connection_id, self.addr, policy.grace
+        );
+        crate::web::metrics::record_max_query_time(&self.username, &self.pool_name, "terminate");
+        tokio::spawn(terminate(
+            self.pool_name.clone(),
+            self.username.clone(),
+            server.address.host.clone(),
+            server.address.port,
+            process_id,
+        ));
+        server.set_close_reason(
+            "max_query_time",
+            Some(format!(
+                "query exceeded max_query_time ({:?})",
+                policy.limit
+            )),
+        );
+        server.mark_bad("query exceeded max_query_time");
+        self.disconnect_reason = Some("max_query_time");
+        let _ = error_response_terminal(
+            &mut self.write,
+            "terminating connection: query exceeded max_query_time",
+            "57P01",
+        )
+        .await;
+        Err(Error::ClientError(
+            "query exceeded max_query_time".to_string(),
+        ))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::{Pool, User};
+
+    fn config(pool_limit: Option<u64>, user_limit: Option<u64>) -> Config {
+        let mut config = Config::default();
+        let mut pool = Pool {
+            max_query_time: pool_limit.map(crate::config::Duration::from_millis),
+            ..Pool::default()
+        };
+        pool.users = vec![User {
+            username: "analytics".into(),
+            max_query_time: user_limit.map(crate::config::Duration::from_millis),
+            ..User::default()
+        }];
+        config.pools.insert("db".into(), pool);
+        config
+    }
+
+    #[test]
+    fn user_limit_overrides_pool_limit() {
+        let limit = |config: &Config, user: &str| {
+            for_user(config, "db", user).map(|policy| policy.limit.as_millis())
+        };
+        assert_eq!(
+            limit(&config(Some(60_000), None), "analytics"),
+            Some(60_000)
+        );
+        assert_eq!(
+            limit(&config(Some(60_000), Some(5_000)), "analytics"),
+            Some(5_000)
+        );
+        assert_eq!(limit(&config(Some(60_000), Some(0)), "analytics"), None);
+        assert_eq!(limit(&config(None, Some(5_000)), "analytics"), Some(5_000));
+        assert_eq!(limit(&config(None, None), "analytics"), None);
+        // Users not listed fall back to the pool's limit.
+        assert_eq!(
+            limit(&config(Some(60_000), Some(5_000)), "web"),
+            Some(60_000)
+        );
+        let policy = for_user(&config(Some(60_000), None), "db", "analytics").unwrap();
+        assert_eq!(policy.grace, DEFAULT_GRACE);
+    }
+}
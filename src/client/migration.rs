@@ -259,6 +259,9 @@ where
                     BackendAuthMethod::ScramPending => {
                         buf.put_u8(3);
                     }
+                    BackendAuthMethod::ScramRelay => {
+                        buf.put_u8(4);
+                    }
                 }
             } else {
                 buf.put_u8(0); // no backend auth
@@ -267,6 +270,21 @@ where
             buf.put_u8(0);
         }
 
+        // Login parameter snapshot, for DISCARD ALL. Older receivers stop
+        // reading after the backend auth tag.
+        let params = self.startup_parameters.as_hashmap();
+        buf.put_u16(params.len() as u16);
+        for (k, v) in params {
+            put_str(&mut buf, &k);
+            put_str(&mut buf, &v);
+        }
+
+        // Client tag, empty when untagged.
+        put_str(
+            &mut buf,
+            self.client_tag.as_ref().map_or("", |tag| tag.tag()),
+        );
+
         buf
     }
 }
@@ -312,6 +330,10 @@ struct DeserializedState {
     username: String,
     addr: std::net::SocketAddr,
     server_parameters: ServerParameters,
+    /// None when the sender predates the snapshot.
+    startup_parameters: Option<ServerParameters>,
+    /// `general.client_tag_parameter` the client was admitted with.
+    client_tag: Option<String>,
     prepared_enabled: bool,
     async_client: bool,
     prepared_entries: Vec<PreparedEntry>,
@@ -444,12 +466,33 @@ fn deserialize_state(mut buf: BytesMut) -> Result<DeserializedState, Error> {
                 Some(BackendAuthMethod::ScramPassthrough(key))
             }
             3 => Some(BackendAuthMethod::ScramPending),
+            4 => Some(BackendAuthMethod::ScramRelay),
             _ => None,
         }
     } else {
         None
     };
 
+    let startup_parameters = if buf.remaining() > 0 {
+        require(&buf, 2)?;
+        let param_count = buf.get_u16() as usize;
+        let mut startup_parameters = ServerParameters::new();
+        for _ in 0..param_count {
+            let k = get_str(&mut buf)?;
+            let v = get_str(&mut buf)?;
+            startup_parameters.set_param(&k, &v, true);
+        }
+        Some(startup_parameters)
+    } else {
+        None
+    };
+
+    let client_tag = if buf.remaining() > 0 {
+        Some(get_str(&mut buf)?).filter(|tag| !tag.is_empty())
+    } else {
+        None
+    };
+
     Ok(DeserializedState {
         connection_id,
         secret_key,
@@ -458,6 +501,8 @@ fn deserialize_state(mut buf: BytesMut) -> Result<DeserializedState, Error> {
         username,
         addr,
         server_parameters,
+        startup_parameters,
+        client_tag,
         prepared_enabled,
         async_client,
         prepared_entries,
@@ -516,15 +561,41 @@ pub async fn reconstruct_client(
         .cloned()
         .unwrap_or_default();
 
-    let stats = Arc::new(ClientStats::new(
-        state.connection_id,
-        &application_name,
-        &state.username,
+    let backend_application_name = crate::config::application_name_template::for_pool(
+        &config,
         &state.pool_name,
-        &state.addr.to_string(),
-        crate::utils::clock::now(),
-        false, // plain TCP
-    ));
+        &crate::config::application_name_template::ClientIdentity {
+            application_name: &application_name,
+            peer: Some(state.addr),
+            user: &state.username,
+            database: &state.pool_name,
+        },
+    );
+
+    let stats = Arc::new(
+        ClientStats::new(
+            state.connection_id,
+            &application_name,
+            &state.username,
+            &state.pool_name,
+            &state.addr.to_string(),
+            crate::utils::clock::now(),
+            false, // plain TCP
+        )
+        .with_tag(state.client_tag.as_deref().unwrap_or("")),
+    );
+    let fault_injection = crate::client::fault::for_pool(&config, &state.pool_name);
+    let max_query_time =
+        crate::client::max_query_time::for_user(&config, &state.pool_name, &state.username);
+    let checkout_quotas = crate::client::checkout_quota::for_client(
+        &config,
+        &state.pool_name,
+        &application_name,
+        state.client_tag.as_deref(),
+    );
+    let client_tag = state
+        .client_tag
+        .map(|tag| super::tags::rejoin(&config, &state.pool_name, tag));
 
     Ok(Client {
         read: BufReader::new(read),
@@ -532,6 +603,7 @@ pub async fn reconstruct_client(
         buffer: PooledBuffer::new(),
         addr: state.addr,
         addr_str: state.addr.to_string(),
+        listener: "tcp",
         read_buf: BytesMut::with_capacity(8192),
         connection_id: state.connection_id,
         cancel_mode: false,
@@ -540,16 +612,43 @@ pub async fn reconstruct_client(
         client_server_map,
         stats,
         admin: false,
+        admin_read_only: false,
         last_server_stats: None,
         connected_to_server: false,
         session_xact_start: None,
         pool_name: state.pool_name,
         username: state.username,
+        startup_parameters: state
+            .startup_parameters
+            .unwrap_or_else(|| state.server_parameters.clone()),
         server_parameters: state.server_parameters,
+        backend_application_name,
         prepared,
         client_last_messages_in_tx: PooledBuffer::new(),
         max_memory_usage: config.general.max_memory_usage.as_bytes(),
+        max_client_message_size: config.general.max_client_message_size.as_bytes() as i32,
+        max_pipeline_depth: config.general.max_pipeline_depth,
+        pipeline_error: None,
+        disconnect_reason: None,
+        client_idle_timeout: Some(config.general.client_idle_timeout.as_std())
+            .filter(|t| !t.is_zero()),
+        client_write_timeout: Some(config.general.client_write_timeout.as_std())
+            .filter(|t| !t.is_zero()),
+        auto_session_pinning: config.general.auto_session_pinning,
+        two_phase_commit: state
+            .transaction_mode
+            .then_some(config.general.two_phase_commit),
+        fault_injection,
+        max_query_time,
+        driver_compat: config
+            .pools
+            .get(&state.pool_name)
+            .and_then(|pool| pool.driver_compat),
+        client_tag,
+        checkout_quotas,
+        pending_two_phase: None,
         client_pending_begin: None,
+        shard_pool: None,
         #[cfg(unix)]
         raw_fd,
         #[cfg(all(unix, feature = "tls-migration"))]
@@ -622,15 +721,41 @@ pub async fn reconstruct_tls_client(
         .cloned()
         .unwrap_or_default();
 
-    let stats = Arc::new(ClientStats::new(
-        state.connection_id,
-        &application_name,
-        &state.username,
+    let backend_application_name = crate::config::application_name_template::for_pool(
+        &config,
         &state.pool_name,
-        &state.addr.to_string(),
-        crate::utils::clock::now(),
-        true, // TLS
-    ));
+        &crate::config::application_name_template::ClientIdentity {
+            application_name: &application_name,
+            peer: Some(state.addr),
+            user: &state.username,
+            database: &state.pool_name,
+        },
+    );
+
+    let stats = Arc::new(
+        ClientStats::new(
+            state.connection_id,
+            &application_name,
+            &state.username,
+            &state.pool_name,
+            &state.addr.to_string(),
+            crate::utils::clock::now(),
+            true, // TLS
+        )
+        .with_tag(state.client_tag.as_deref().unwrap_or("")),
+    );
+    let fault_injection = crate::client::fault::for_pool(&config, &state.pool_name);
+    let max_query_time =
+        crate::client::max_query_time::for_user(&config, &state.pool_name, &state.username);
+    let checkout_quotas = crate::client::checkout_quota::for_client(
+        &config,
+        &state.pool_name,
+        &application_name,
+        state.client_tag.as_deref(),
+    );
+    let client_tag = state
+        .client_tag
+        .map(|tag| super::tags::rejoin(&config, &state.pool_name, tag));
 
     Ok(Client {
         read: BufReader::new(read),
@@ -638,6 +763,7 @@ pub async fn reconstruct_tls_client(
         buffer: PooledBuffer::new(),
         addr: state.addr,
         addr_str: state.addr.to_string(),
+        listener: "tcp",
         read_buf: BytesMut::with_capacity(8192),
         connection_id: state.connection_id,
         cancel_mode: false,
@@ -646,16 +772,43 @@ pub async fn reconstruct_tls_client(
         client_server_map,
         stats,
         admin: false,
+        admin_read_only: false,
         last_server_stats: None,
         connected_to_server: false,
         session_xact_start: None,
         pool_name: state.pool_name,
         username: state.username,
+        startup_parameters: state
+            .startup_parameters
+            .unwrap_or_else(|| state.server_parameters.clone()),
         server_parameters: state.server_parameters,
+        backend_application_name,
         prepared,
         client_last_messages_in_tx: PooledBuffer::new(),
         max_memory_usage: config.general.max_memory_usage.as_bytes(),
+        max_client_message_size: config.general.max_client_message_size.as_bytes() as i32,
+        max_pipeline_depth: config.general.max_pipeline_depth,
+        pipeline_error: None,
+        disconnect_reason: None,
+        client_idle_timeout: Some(config.general.client_idle_timeout.as_std())
+            .filter(|t| !t.is_zero()),
+        client_write_timeout: Some(config.general.client_write_timeout.as_std())
+            .filter(|t| !t.is_zero()),
+        auto_session_pinning: config.general.auto_session_pinning,
+        two_phase_commit: state
+            .transaction_mode
+            .then_some(config.general.two_phase_commit),
+        fault_injection,
+        max_query_time,
+        driver_compat: config
+            .pools
+            .get(&state.pool_name)
+            .and_then(|pool| pool.driver_compat),
+        client_tag,
+        checkout_quotas,
+        pending_two_phase: None,
         client_pending_begin: None,
+        shard_pool: None,
         #[cfg(unix)]
         raw_fd,
         #[cfg(all(unix, feature = "tls-migration"))]
@@ -1284,6 +1437,44 @@ mod tests {
         assert_eq!(state.prepared_entries[0].hash, 0xABCD);
         assert_eq!(state.prepared_entries[0].query, "SELECT 1");
         assert_eq!(state.prepared_entries[0].param_types, vec![23]);
+        assert!(state.startup_parameters.is_none());
+        assert!(state.client_tag.is_none());
+    }
+
+    #[test]
+    fn deserialize_reads_startup_parameters_tail() {
+        let mut buf = BytesMut::new();
+        buf.put_u32(MIGRATION_MAGIC);
+        buf.put_u16(MIGRATION_VERSION);
+        buf.put_u64(1); // connection_id
+        buf.put_i32(2); // secret_key
+        buf.put_u8(1); // transaction_mode = true
+        put_str(&mut buf, "testdb");
+        put_str(&mut buf, "testuser");
+        buf.put_u16(5432);
+        buf.put_u8(9);
+        buf.put_slice(b"127.0.0.1");
+        buf.put_u16(1);
+        put_str(&mut buf, "TimeZone");
+        put_str(&mut buf, "Europe/Moscow");
+        buf.put_u8(1); // enabled
+        buf.put_u8(0); // async_client
+        buf.put_u32(0); // cache_count
+        buf.put_u8(0); // use_tls = false
+        buf.put_u8(0); // no backend auth
+        buf.put_u16(1);
+        put_str(&mut buf, "TimeZone");
+        put_str(&mut buf, "UTC");
+        put_str(&mut buf, "batch"); // client tag
+
+        let state = deserialize_state(buf).unwrap();
+        assert_eq!(state.client_tag.as_deref(), Some("batch"));
+        let startup = state.startup_parameters.unwrap();
+        assert_eq!(startup.get_param("TimeZone"), Some("UTC"));
+        assert_eq!(
+            state.server_parameters.get_param("TimeZone"),
+            Some("Europe/Moscow")
+        );
     }
 
     #[test]
@@ -1,19 +1,42 @@
+mod audit;
 mod batch_handling;
 pub mod buffer_pool;
+mod checkout_quota;
+mod close_batch;
 mod core;
 mod entrypoint;
 mod error_handling;
+mod eviction;
+mod fault;
+mod handshake;
+mod identity;
+mod max_query_time;
 #[cfg(unix)]
 pub mod migration;
+mod pipeline;
 mod protocol;
+mod proxy_protocol;
+mod read_only;
+mod rewrite;
+mod session_pin;
+mod shard;
+mod show;
 mod startup;
+mod statement_rules;
+mod tags;
+mod trace;
 mod transaction;
+mod two_phase;
 mod util;
+mod violation;
 
 pub use core::Client;
 pub use entrypoint::{
     client_entrypoint, client_entrypoint_too_many_clients_already,
     client_entrypoint_too_many_clients_already_unix, client_entrypoint_unix, ClientSessionInfo,
 };
+pub use eviction::evict_idle_client;
+pub use handshake::login_queue_depth;
 pub use startup::startup_tls;
+pub use two_phase::{prepared_transactions, PreparedTransaction};
 pub use util::PREPARED_STATEMENT_COUNTER;
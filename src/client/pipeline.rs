@@ -0,0 +1,153 @@
+//! Extended protocol pipelines: `general.max_pipeline_depth` and the
+//! recovery after an error pg_doorman raises in the middle of one.
+//!
+//! Parse, Bind, Describe, Execute and Close are held in the client buffer
+//! until Sync or Flush, so a pipeline that never syncs would grow without
+//! bound. Past `max_pipeline_depth` messages, or when a message of the
+//! pipeline is refused, the pipeline fails the way it would on
+//! PostgreSQL. A Bind of a statement that does not exist is queued in
+//! place of the refused message, every later message up to Sync is
+//! discarded, and the pipeline goes to the backend with the Sync as
+//! usual: what came before runs, the Bind fails and the backend skips to
+//! the Sync. Savepoints taken earlier in the pipeline survive, an
+//! implicit transaction is rolled back and an explicit one is left
+//! failed. The client gets pg_doorman's error in place of the backend's;
+//! when the backend failed earlier on its own, its error wins, as it
+//! would on PostgreSQL.
+
+use bytes::{BufMut, BytesMut};
+use log::debug;
+
+use crate::client::core::{BatchOperation, Client};
+use crate::messages::error_message;
+
+/// Statement named by the failing Bind. Client statement names reach the
+/// backend as `DOORMAN_<n>`, so no client can create it.
+const ABORT_STATEMENT: &str = "DOORMAN_aborted";
+
+/// A Bind of `ABORT_STATEMENT`, which PostgreSQL fails with 26000.
+fn abort_bind() -> BytesMut {
+    let mut bytes = BytesMut::with_capacity(32);
+    bytes.put_u8(b'B');
+    bytes.put_i32((4 + 1 + ABORT_STATEMENT.len() + 1 + 3 * 2) as i32);
+    // Unnamed portal; no parameter formats, parameters or result formats.
+    bytes.put_u8(0);
+    bytes.put_slice(ABORT_STATEMENT.as_bytes());
+    bytes.put_u8(0);
+    bytes.put_i16(0);
+    bytes.put_i16(0);
+    bytes.put_i16(0);
+    bytes
+}
+
+/// `response` with the backend's error about `ABORT_STATEMENT` replaced
+/// by `error`; None when it has no such error.
+fn replace_abort_error(response: &[u8], error: &[u8]) -> Option<BytesMut> {
+    let mut pos = 0;
+    while pos + 5 <= response.len() {
+        let len = u32::from_be_bytes([
+            response[pos + 1],
+            response[pos + 2],
+            response[pos + 3],
+            response[pos + 4],
+        ]) as usize;
+        let end = (pos + 1 + len).min(response.len());
+        let ours = response[pos] == b'E'
+            && response[pos..end]
+                .windows(ABORT_STATEMENT.len())
+                .any(|w| w == ABORT_STATEMENT.as_bytes());
+        if ours {
+            let mut replaced = BytesMut::with_capacity(response.len() + error.len());
+            replaced.extend_from_slice(&response[..pos]);
+            replaced.extend_from_slice(error);
+            replaced.extend_from_slice(&response[end..]);
+            return Some(replaced);
+        }
+        pos = end;
+    }
+    None
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// Whether the pipeline already holds `max_pipeline_depth` messages.
+    pub(crate) fn pipeline_full(&self) -> bool {
+        self.max_pipeline_depth > 0
+            && self.prepared.batch_operations.len() >= self.max_pipeline_depth
+    }
+
+    /// Fail the current pipeline with `message` at this point: the rest of
+    /// it up to Sync is discarded.
+    pub(crate) fn abort_pipeline(&mut self, message: &str, code: &str, reason: &str) {
+        debug!(
+            "[{}@{} #c{}] pipeline of client {} aborted: {message}",
+            self.username, self.pool_name, self.connection_id, self.addr
+        );
+        crate::web::metrics::record_pipeline_abort(&self.username, &self.pool_name, reason);
+        self.buffer.put(&abort_bind()[..]);
+        // Synthetic ParseCompletes still pending go before the error.
+        self.prepared.batch_operations.push(BatchOperation::Bind {
+            statement_name: String::new(),
+        });
+        self.pipeline_error = Some(error_message(message, code));
+    }
+
+    /// A response chunk of an aborted pipeline, with pg_doorman's error in
+    /// place of the backend's.
+    pub(crate) fn pipeline_response(&self, response: BytesMut) -> BytesMut {
+        match &self.pipeline_error {
+            Some(error) => replace_abort_error(&response, error).unwrap_or(response),
+            None => response,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn message(tag: u8, body: &[u8]) -> Vec<u8> {
+        let mut bytes = vec![tag];
+        bytes.extend_from_slice(&(4 + body.len() as u32).to_be_bytes());
+        bytes.extend_from_slice(body);
+        bytes
+    }
+
+    #[test]
+    fn abort_bind_is_well_formed() {
+        let bytes = abort_bind();
+        let len = u32::from_be_bytes([bytes[1], bytes[2], bytes[3], bytes[4]]) as usize;
+        assert_eq!(bytes[0], b'B');
+        assert_eq!(1 + len, bytes.len());
+        assert_eq!(
+            &bytes[6..6 + ABORT_STATEMENT.len()],
+            ABORT_STATEMENT.as_bytes()
+        );
+    }
+
+    #[test]
+    fn replaces_only_the_abort_error() {
+        let ours = message(
+            b'E',
+            b"C26000\0Mprepared statement \"DOORMAN_aborted\" does not exist\0\0",
+        );
+        let theirs = message(b'E', b"C42P01\0Mrelation \"t\" does not exist\0\0");
+        let ready = message(b'Z', b"I");
+        let bind_complete = message(b'2', b"");
+        let error = error_message("statement denied", "42501");
+
+        let response = [bind_complete.clone(), ours, ready.clone()].concat();
+        let replaced = replace_abort_error(&response, &error).unwrap();
+        assert_eq!(
+            replaced[..],
+            [bind_complete, error.to_vec(), ready.clone()].concat()[..]
+        );
+
+        // The backend failed before reaching the Bind: its error stands.
+        let response = [theirs, ready].concat();
+        assert_eq!(replace_abort_error(&response, &error), None);
+    }
+}
@@ -4,6 +4,7 @@ use std::convert::TryInto;
 use std::sync::atomic::{AtomicU64, Ordering};
 use std::sync::Arc;
 
+use crate::config::DriverCompat;
 use crate::errors::Error;
 use crate::messages::{error_response, Bind, Close, Describe, Parse};
 use crate::pool::ConnectionPool;
@@ -160,6 +161,14 @@ where
                 // Server connection state will need to be cleared at checkin
                 server.mark_dirty();
             }
+            // Statement name, then query text, both NUL-terminated.
+            let message = message.freeze();
+            if let Some(query) = message
+                .get(5..)
+                .and_then(|body| body.split(|b| *b == 0).nth(1))
+            {
+                self.stats.query_started(message.slice_ref(query));
+            }
             // Add directly to buffer
             self.buffer.put(&message[..]);
             // Track operation for correct expected_responses calculation in Flush
@@ -484,6 +493,7 @@ where
                 let is_anonymous = client_given_name.is_empty();
                 crate::server::record_query_count(cached.hash, is_anonymous);
                 self.prepared.last_bound_for_top = Some((cached.hash, is_anonymous));
+                self.stats.query_started(cached.parse.shared_query());
 
                 Ok(())
             }
@@ -509,32 +519,38 @@ where
                         );
                     }
                     crate::web::metrics::record_synthetic_miss();
-                    error_response(
-                        &mut self.write,
-                        "unnamed prepared statement does not exist",
-                        "26000",
-                    )
-                    .await?;
                 } else {
                     warn!(
                         "[{}@{} #c{}] Bind references unknown prepared statement {client_given_name:?}",
                         self.username, self.pool_name, self.connection_id,
                     );
-                    error_response(
-                        &mut self.write,
-                        &format!("prepared statement \"{client_given_name}\" does not exist"),
-                        "26000",
-                    )
-                    .await?;
                 }
-
-                Err(Error::ClientError(format!(
-                    "Prepared statement `{client_given_name}` doesn't exist"
-                )))
+                self.unknown_statement(&client_given_name).await
             }
         }
     }
 
+    /// Answer a Bind or Describe of a statement this client has not
+    /// prepared, or whose anonymous statement was evicted, with
+    /// PostgreSQL's 26000. Under `driver_compat = "jdbc"` the pipeline
+    /// fails and the client stays connected, as on PostgreSQL, so the
+    /// driver can prepare the statement again; otherwise it is closed.
+    async fn unknown_statement(&mut self, client_given_name: &str) -> Result<(), Error> {
+        let message = if client_given_name.is_empty() {
+            "unnamed prepared statement does not exist".to_string()
+        } else {
+            format!("prepared statement \"{client_given_name}\" does not exist")
+        };
+        if self.driver_compat == Some(DriverCompat::Jdbc) {
+            self.abort_pipeline(&message, "26000", "unknown_statement");
+            return Ok(());
+        }
+        error_response(&mut self.write, &message, "26000").await?;
+        Err(Error::ClientError(format!(
+            "Prepared statement `{client_given_name}` doesn't exist"
+        )))
+    }
+
     /// Process Describe message immediately without buffering.
     /// Adds data directly to self.buffer.
     pub(crate) async fn process_describe_immediate(
@@ -663,28 +679,13 @@ where
                         );
                     }
                     crate::web::metrics::record_synthetic_miss();
-                    error_response(
-                        &mut self.write,
-                        "unnamed prepared statement does not exist",
-                        "26000",
-                    )
-                    .await?;
                 } else {
                     warn!(
                         "[{}@{} #c{}] Describe references unknown prepared statement `{}`",
                         self.username, self.pool_name, self.connection_id, client_given_name
                     );
-                    error_response(
-                        &mut self.write,
-                        &format!("prepared statement \"{client_given_name}\" does not exist"),
-                        "26000",
-                    )
-                    .await?;
                 }
-
-                Err(Error::ClientError(format!(
-                    "Prepared statement `{client_given_name}` doesn't exist"
-                )))
+                self.unknown_statement(&client_given_name).await
             }
         }
     }
@@ -0,0 +1,196 @@
+//! PROXY protocol (v1 and v2) header parsing for listeners behind a TCP
+//! load balancer, so HBA, logs and `client_addr` see the real client.
+
+use std::net::{IpAddr, Ipv4Addr, Ipv6Addr, SocketAddr};
+
+use tokio::io::{AsyncRead, AsyncReadExt};
+
+use crate::errors::Error;
+
+const V2_SIGNATURE: [u8; 12] = *b"\r\n\r\n\0\r\nQUIT\n";
+/// Longest v1 header allowed by the specification, CRLF included.
+const V1_MAX_LEN: usize = 107;
+
+/// Read the PROXY header the load balancer sends before any client byte
+/// and return the source address it carries. `peer` is returned for
+/// `LOCAL` (v2) and `UNKNOWN` (v1) headers, which health checks use.
+pub async fn read_proxy_header<S>(stream: &mut S, peer: SocketAddr) -> Result<SocketAddr, Error>
+where
+    S: AsyncRead + Unpin,
+{
+    let mut head = [0u8; 12];
+    read_exact(stream, &mut head).await?;
+    if head == V2_SIGNATURE {
+        read_v2(stream, peer).await
+    } else if head.starts_with(b"PROXY ") {
+        read_v1(stream, &head, peer).await
+    } else {
+        Err(proxy_error("connection does not start with a PROXY header"))
+    }
+}
+
+async fn read_v1<S>(stream: &mut S, head: &[u8], peer: SocketAddr) -> Result<SocketAddr, Error>
+where
+    S: AsyncRead + Unpin,
+{
+    let mut line = head.to_vec();
+    // Byte at a time: anything after CRLF belongs to the PostgreSQL startup.
+    while !line.ends_with(b"\r\n") {
+        if line.len() >= V1_MAX_LEN {
+            return Err(proxy_error("PROXY v1 header is too long"));
+        }
+        let mut byte = [0u8; 1];
+        read_exact(stream, &mut byte).await?;
+        line.push(byte[0]);
+    }
+    let line = std::str::from_utf8(&line[..line.len() - 2])
+        .map_err(|_| proxy_error("PROXY v1 header is not ASCII"))?;
+    parse_v1(line, peer)
+}
+
+fn parse_v1(line: &str, peer: SocketAddr) -> Result<SocketAddr, Error> {
+    let fields: Vec<&str> = line.split(' ').collect();
+    match fields.as_slice() {
+        ["PROXY", "UNKNOWN", ..] => Ok(peer),
+        ["PROXY", family @ ("TCP4" | "TCP6"), src, _dst, src_port, _dst_port] => {
+            let ip: IpAddr = src
+                .parse()
+                .map_err(|_| proxy_error("PROXY v1 header has a bad source address"))?;
+            if ip.is_ipv4() != (*family == "TCP4") {
+                return Err(proxy_error("PROXY v1 source address does not match family"));
+            }
+            let port: u16 = src_port
+                .parse()
+                .map_err(|_| proxy_error("PROXY v1 header has a bad source port"))?;
+            Ok(SocketAddr::new(ip, port))
+        }
+        _ => Err(proxy_error("malformed PROXY v1 header")),
+    }
+}
+
+async fn read_v2<S>(stream: &mut S, peer: SocketAddr) -> Result<SocketAddr, Error>
+where
+    S: AsyncRead + Unpin,
+{
+    let mut fixed = [0u8; 4];
+    read_exact(stream, &mut fixed).await?;
+    let len = u16::from_be_bytes([fixed[2], fixed[3]]) as usize;
+    let mut body = vec![0u8; len];
+    read_exact(stream, &mut body).await?;
+    parse_v2(fixed[0], fixed[1], &body, peer)
+}
+
+fn parse_v2(ver_cmd: u8, family: u8, body: &[u8], peer: SocketAddr) -> Result<SocketAddr, Error> {
+    match ver_cmd {
+        0x20 => return Ok(peer),
+        0x21 => {}
+        _ => return Err(proxy_error("unsupported PROXY v2 version or command")),
+    }
+    match family {
+        // TCP over IPv4: src addr, dst addr, src port, dst port.
+        0x11 if body.len() >= 12 => {
+            let ip = Ipv4Addr::new(body[0], body[1], body[2], body[3]);
+            let port = u16::from_be_bytes([body[8], body[9]]);
+            Ok(SocketAddr::new(IpAddr::V4(ip), port))
+        }
+        0x21 if body.len() >= 36 => {
+            let mut octets = [0u8; 16];
+            octets.copy_from_slice(&body[..16]);
+            let port = u16::from_be_bytes([body[32], body[33]]);
+            Ok(SocketAddr::new(IpAddr::V6(Ipv6Addr::from(octets)), port))
+        }
+        // UNSPEC and non-TCP transports carry no usable address.
+        0x00 => Ok(peer),
+        0x11 | 0x21 => Err(proxy_error("PROXY v2 address block is truncated")),
+        _ => Err(proxy_error("unsupported PROXY v2 address family")),
+    }
+}
+
+async fn read_exact<S>(stream: &mut S, buf: &mut [u8]) -> Result<(), Error>
+where
+    S: AsyncRead + Unpin,
+{
+    stream
+        .read_exact(buf)
+        .await
+        .map(|_| ())
+        .map_err(|err| proxy_error(&format!("reading PROXY header: {err}")))
+}
+
+fn proxy_error(msg: &str) -> Error {
+    Error::ProxyProtocolError(msg.to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn peer() -> SocketAddr {
+        "10.0.0.1:40000".parse().unwrap()
+    }
+
+    async fn read(bytes: &[u8]) -> (Result<SocketAddr, Error>, Vec<u8>) {
+        let mut stream = bytes;
+        let addr = read_proxy_header(&mut stream, peer()).await;
+        (addr, stream.to_vec())
+    }
+
+    #[tokio::test]
+    async fn v1_tcp4_leaves_startup_bytes() {
+        let (addr, rest) =
+            read(b"PROXY TCP4 192.0.2.7 198.51.100.1 51234 6432\r\n\0\0\0\x08").await;
+        assert_eq!(addr.unwrap(), "192.0.2.7:51234".parse().unwrap());
+        assert_eq!(rest, b"\0\0\0\x08");
+    }
+
+    #[tokio::test]
+    async fn v1_tcp6_and_unknown() {
+        let (addr, _) = read(b"PROXY TCP6 2001:db8::7 2001:db8::1 51234 6432\r\n").await;
+        assert_eq!(addr.unwrap(), "[2001:db8::7]:51234".parse().unwrap());
+        let (addr, _) = read(b"PROXY UNKNOWN\r\n").await;
+        assert_eq!(addr.unwrap(), peer());
+    }
+
+    #[tokio::test]
+    async fn v1_rejects_malformed() {
+        assert!(read(b"PROXY TCP4 2001:db8::7 192.0.2.1 1 2\r\n")
+            .await
+            .0
+            .is_err());
+        assert!(read(b"PROXY TCP4 192.0.2.7 192.0.2.1 x 2\r\n")
+            .await
+            .0
+            .is_err());
+        assert!(read(&[b"PROXY TCP4 ".as_slice(), &[b'1'; 120]].concat())
+            .await
+            .0
+            .is_err());
+        assert!(read(b"\0\0\0\x08\x04\xd2\x16\x2f\0\0\0\0").await.0.is_err());
+    }
+
+    #[tokio::test]
+    async fn v2_proxy_and_local() {
+        let mut header = V2_SIGNATURE.to_vec();
+        header.extend_from_slice(&[0x21, 0x11, 0, 15]);
+        header.extend_from_slice(&[192, 0, 2, 7, 198, 51, 100, 1]);
+        header.extend_from_slice(&51234u16.to_be_bytes());
+        header.extend_from_slice(&6432u16.to_be_bytes());
+        header.extend_from_slice(&[0x04, 0, 0]); // empty TLV, skipped
+        header.push(b'S');
+        let (addr, rest) = read(&header).await;
+        assert_eq!(addr.unwrap(), "192.0.2.7:51234".parse().unwrap());
+        assert_eq!(rest, b"S");
+
+        let mut local = V2_SIGNATURE.to_vec();
+        local.extend_from_slice(&[0x20, 0x00, 0, 0]);
+        assert_eq!(read(&local).await.0.unwrap(), peer());
+    }
+
+    #[tokio::test]
+    async fn v2_rejects_truncated_address() {
+        let mut header = V2_SIGNATURE.to_vec();
+        header.extend_from_slice(&[0x21, 0x21, 0, 12]);
+        header.extend_from_slice(&[0; 12]);
+        assert!(read(&header).await.0.is_err());
+    }
+}
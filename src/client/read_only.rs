@@ -0,0 +1,199 @@
+//! Read-only enforcement for users with `read_only = true`.
+//!
+//! Statements of such a user are checked before they reach the server.
+//! Every statement of a query must start with a keyword that cannot change
+//! data (`SELECT`, `SHOW`, `BEGIN`, ...; not `COPY`, `CALL` or `DO`), and
+//! none may mention a keyword or function that writes, turns off read-only
+//! mode or switches role. The check is lexical, like `session_pin`: string
+//! literals and comments never match, quoted identifiers match as if they
+//! were not quoted, so a false positive is a refused statement that only
+//! mentions a writing keyword as an identifier. It is defense in depth for
+//! reporting users, on top of backend sessions that start with
+//! `default_transaction_read_only = on`; it does not replace backend
+//! grants.
+
+use super::session_pin::{is, unquoted, Words};
+
+/// Keywords a statement may start with.
+const ALLOWED_FIRST: [&str; 24] = [
+    "select",
+    "with",
+    "values",
+    "table",
+    "show",
+    "explain",
+    "begin",
+    "start",
+    "commit",
+    "end",
+    "rollback",
+    "abort",
+    "savepoint",
+    "release",
+    "prepare",
+    "execute",
+    "deallocate",
+    "declare",
+    "fetch",
+    "move",
+    "close",
+    "set",
+    "reset",
+    "discard",
+];
+
+/// Keywords and functions that write, anywhere in a statement. `update`
+/// also catches `SELECT ... FOR UPDATE`, which PostgreSQL refuses in a
+/// read-only transaction as well, and `into` `SELECT ... INTO`, which
+/// creates a table.
+const FORBIDDEN: [&str; 21] = [
+    "insert",
+    "into",
+    "update",
+    "delete",
+    "merge",
+    "truncate",
+    "create",
+    "drop",
+    "alter",
+    "grant",
+    "revoke",
+    "nextval",
+    "setval",
+    "set_config",
+    "lo_import",
+    "lo_export",
+    "lo_unlink",
+    "lo_create",
+    "lo_from_bytea",
+    "lo_put",
+    "pg_terminate_backend",
+];
+
+/// Settings that would turn the session writable again.
+const READ_ONLY_SETTINGS: [&str; 2] = ["default_transaction_read_only", "transaction_read_only"];
+
+/// Error text sent to the client; `{}` is the reason.
+pub(crate) fn rejection(reason: &str) -> String {
+    format!("cannot execute {reason}: user is read-only in pg_doorman (read_only = true)")
+}
+
+/// Why `query` is refused for a read-only user, or None when it may run.
+pub(crate) fn write_reason(query: &[u8]) -> Option<String> {
+    let mut statement_start = true;
+    let mut prev: [&[u8]; 2] = [b"", b""];
+    for word in Words::new(query) {
+        if word == b";" {
+            statement_start = true;
+            prev = [b"", b""];
+            continue;
+        }
+        if word.first() == Some(&b'\'') {
+            prev = [prev[1], word];
+            continue;
+        }
+        let word = unquoted(word);
+        if statement_start {
+            statement_start = false;
+            if !ALLOWED_FIRST.iter().any(|k| is(word, k)) {
+                return Some(upper(word));
+            }
+        }
+        if let Some(keyword) = FORBIDDEN.iter().find(|k| is(word, k)) {
+            return Some(keyword.to_ascii_uppercase());
+        }
+        if is(prev[1], "read") && is(word, "write") {
+            return Some("READ WRITE transaction".to_string());
+        }
+        if (is(word, "role") || is(word, "authorization"))
+            && (is(prev[1], "set") || is(prev[0], "set"))
+        {
+            return Some("SET ROLE".to_string());
+        }
+        if READ_ONLY_SETTINGS.iter().any(|s| is(word, s))
+            && (is(prev[1], "set") || is(prev[0], "set") || is(prev[1], "reset"))
+        {
+            return Some(format!("SET {}", String::from_utf8_lossy(word)));
+        }
+        prev = [prev[1], word];
+    }
+    None
+}
+
+fn upper(word: &[u8]) -> String {
+    String::from_utf8_lossy(word).to_ascii_uppercase()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn reason(sql: &str) -> Option<String> {
+        write_reason(sql.as_bytes())
+    }
+
+    #[test]
+    fn reads_pass() {
+        for sql in [
+            "SELECT * FROM orders WHERE note = 'delete me'",
+            "with t as (select 1) select * from t",
+            "SHOW transaction_read_only",
+            "BEGIN READ ONLY; SELECT 1; COMMIT",
+            "EXPLAIN SELECT 1",
+            "SET search_path = reports",
+            "DISCARD ALL",
+            "select 1 -- update later",
+            "",
+        ] {
+            assert_eq!(reason(sql), None, "{sql}");
+        }
+    }
+
+    #[test]
+    fn writes_are_refused() {
+        assert_eq!(
+            reason("INSERT INTO t VALUES (1)").as_deref(),
+            Some("INSERT")
+        );
+        assert_eq!(reason("select 1; delete from t").as_deref(), Some("DELETE"));
+        assert_eq!(
+            reason("WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d").as_deref(),
+            Some("DELETE")
+        );
+        assert_eq!(
+            reason("SELECT * FROM t FOR UPDATE").as_deref(),
+            Some("UPDATE")
+        );
+        assert_eq!(reason("select nextval('s')").as_deref(), Some("NEXTVAL"));
+        assert_eq!(reason("VACUUM t").as_deref(), Some("VACUUM"));
+        assert_eq!(reason("DO $$ BEGIN END $$").as_deref(), Some("DO"));
+        assert_eq!(reason("COPY t TO STDOUT").as_deref(), Some("COPY"));
+    }
+
+    #[test]
+    fn escaping_read_only_mode_is_refused() {
+        assert!(reason("BEGIN READ WRITE").is_some());
+        assert!(reason("SET TRANSACTION READ WRITE").is_some());
+        assert!(reason("SET default_transaction_read_only = off").is_some());
+        assert!(reason("set session transaction_read_only to off").is_some());
+        assert!(reason("RESET default_transaction_read_only").is_some());
+        assert!(reason("SET ROLE admin").is_some());
+        assert!(reason("SET SESSION AUTHORIZATION admin").is_some());
+        assert!(reason("select set_config('transaction_read_only', 'off', false)").is_some());
+    }
+
+    #[test]
+    fn quoted_identifiers_and_select_into_are_refused() {
+        assert_eq!(
+            reason(r#"SELECT "nextval"('s')"#).as_deref(),
+            Some("NEXTVAL")
+        );
+        assert_eq!(
+            reason(r#"SELECT "set_config"('transaction_read_only', 'off', false)"#).as_deref(),
+            Some("SET_CONFIG")
+        );
+        assert!(reason(r#"SET "default_transaction_read_only" = off"#).is_some());
+        assert_eq!(reason("SELECT * INTO t2 FROM t").as_deref(), Some("INTO"));
+        assert_eq!(reason(r#"SELECT "id" FROM "t""#), None);
+    }
+}
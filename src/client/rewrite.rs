@@ -0,0 +1,200 @@
+//! Application of the pool's `rewrite_rules` (see
+//! `crate::config::RewriteRule`) to Query and Parse messages.
+//!
+//! Statements are split and matched like `statement_deny`. Words inside
+//! string literals and comments are never renamed; dollar-quoted bodies
+//! are not recognised as literals and are treated as code.
+
+use bytes::{BufMut, BytesMut};
+
+use crate::config::CompiledRewrite;
+
+use super::session_pin::{is, Words};
+use super::statement_rules::matches;
+
+/// The Query or Parse `message` with the rules applied to its query text,
+/// or None when it is another message or no rule changed it.
+pub(crate) fn rewrite_message(rules: &[CompiledRewrite], message: &[u8]) -> Option<BytesMut> {
+    let code = *message.first()?;
+    let body = message.get(5..)?;
+    // Parse carries the statement name before the query and the parameter
+    // types after it; both are kept as they are.
+    let query_start = match code {
+        b'Q' => 0,
+        b'P' => body.iter().position(|&b| b == 0)? + 1,
+        _ => return None,
+    };
+    let query_end = query_start + body[query_start..].iter().position(|&b| b == 0)?;
+    let query = rewrite_query(rules, &body[query_start..query_end])?;
+
+    let len = body.len() - (query_end - query_start) + query.len();
+    let mut out = BytesMut::with_capacity(len + 1 + 4);
+    out.put_u8(code);
+    out.put_i32((len + 4) as i32);
+    out.put_slice(&body[..query_start]);
+    out.put_slice(&query);
+    out.put_slice(&body[query_end..]);
+    Some(out)
+}
+
+/// `query` with the rules applied, or None when no rule changed it.
+pub(crate) fn rewrite_query(rules: &[CompiledRewrite], query: &[u8]) -> Option<Vec<u8>> {
+    let mut out = Vec::with_capacity(query.len() + 64);
+    let mut copied = 0;
+    let mut changed = false;
+    let mut statement: Vec<&[u8]> = Vec::new();
+    let mut spans: Vec<(usize, usize)> = Vec::new();
+    let mut words = Words::new(query);
+    loop {
+        let word = words.next();
+        if let Some(word) = word.filter(|w| *w != b";") {
+            spans.push((words.end() - word.len(), words.end()));
+            statement.push(word);
+            continue;
+        }
+        if !statement.is_empty() {
+            changed |= rewrite_statement(rules, query, &statement, &spans, &mut copied, &mut out);
+            statement.clear();
+            spans.clear();
+        }
+        if word.is_none() {
+            break;
+        }
+    }
+    if !changed {
+        return None;
+    }
+    out.extend_from_slice(&query[copied..]);
+    Some(out)
+}
+
+/// Appends to `out` the query up to the end of the statement whose words
+/// and their byte ranges are given, edited by the rules that match it.
+/// Returns whether anything was edited.
+fn rewrite_statement(
+    rules: &[CompiledRewrite],
+    query: &[u8],
+    statement: &[&[u8]],
+    spans: &[(usize, usize)],
+    copied: &mut usize,
+    out: &mut Vec<u8>,
+) -> bool {
+    let applied: Vec<&CompiledRewrite> = rules
+        .iter()
+        .filter(|rule| {
+            rule.pattern.as_ref().is_none_or(|p| matches(p, statement))
+                && !rule.unless.as_ref().is_some_and(|u| matches(u, statement))
+        })
+        .collect();
+    if applied.is_empty() {
+        return false;
+    }
+    let (start, end) = (spans[0].0, spans[spans.len() - 1].1);
+    let mut changed = false;
+    out.extend_from_slice(&query[*copied..start]);
+    for prepend in applied.iter().filter_map(|rule| rule.prepend.as_deref()) {
+        out.extend_from_slice(prepend.as_bytes());
+        out.push(b' ');
+        changed = true;
+    }
+    let mut pos = start;
+    for (word, &(from, to)) in statement.iter().zip(spans) {
+        let renamed = applied
+            .iter()
+            .flat_map(|rule| &rule.rename)
+            .find(|(old, _)| is(word, old));
+        if let Some((_, new)) = renamed {
+            out.extend_from_slice(&query[pos..from]);
+            out.extend_from_slice(new.as_bytes());
+            pos = to;
+            changed = true;
+        }
+    }
+    out.extend_from_slice(&query[pos..end]);
+    for append in applied.iter().filter_map(|rule| rule.append.as_deref()) {
+        out.push(b' ');
+        out.extend_from_slice(append.as_bytes());
+        changed = true;
+    }
+    *copied = end;
+    changed
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::RewriteRule;
+    use std::collections::BTreeMap;
+
+    fn compile(rules: Vec<RewriteRule>) -> Vec<CompiledRewrite> {
+        rules
+            .iter()
+            .map(|r| r.compile("rewrite_rules").unwrap())
+            .collect()
+    }
+
+    fn rewrite(rules: &[CompiledRewrite], sql: &str) -> String {
+        let out = rewrite_query(rules, sql.as_bytes()).unwrap_or_else(|| sql.as_bytes().to_vec());
+        String::from_utf8(out).unwrap()
+    }
+
+    #[test]
+    fn forces_limit_on_unbounded_selects() {
+        let rules = compile(vec![RewriteRule {
+            pattern: Some("SELECT".into()),
+            unless: Some("LIMIT".into()),
+            append: Some("LIMIT 1000".into()),
+            ..RewriteRule::default()
+        }]);
+        assert_eq!(
+            rewrite(&rules, "select * from t;"),
+            "select * from t LIMIT 1000;"
+        );
+        assert_eq!(
+            rewrite(&rules, "select * from t limit 5"),
+            "select * from t limit 5"
+        );
+        assert_eq!(
+            rewrite(&rules, "SELECT 1 -- note\n; UPDATE t SET a = 1"),
+            "SELECT 1 LIMIT 1000 -- note\n; UPDATE t SET a = 1"
+        );
+        assert_eq!(rewrite_query(&rules, b"update t set a = 1"), None);
+    }
+
+    #[test]
+    fn renames_words_outside_literals() {
+        let rules = compile(vec![RewriteRule {
+            prepend: Some("/* app */".into()),
+            rename: BTreeMap::from([("old_orders".into(), "sales.orders".into())]),
+            ..RewriteRule::default()
+        }]);
+        assert_eq!(
+            rewrite(
+                &rules,
+                "  SELECT * FROM Old_Orders WHERE note <> 'old_orders'"
+            ),
+            "  /* app */ SELECT * FROM sales.orders WHERE note <> 'old_orders'"
+        );
+    }
+
+    #[test]
+    fn rebuilds_parse_message() {
+        let rules = compile(vec![RewriteRule {
+            append: Some("LIMIT 10".into()),
+            ..RewriteRule::default()
+        }]);
+        let mut parse = BytesMut::new();
+        let body = b"s1\0select 1\0\0\x01\0\0\0\x17";
+        parse.put_u8(b'P');
+        parse.put_i32(4 + body.len() as i32);
+        parse.put_slice(body);
+        let out = rewrite_message(&rules, &parse).unwrap();
+        let expected = b"s1\0select 1 LIMIT 10\0\0\x01\0\0\0\x17";
+        assert_eq!(&out[5..], &expected[..]);
+        assert_eq!(
+            i32::from_be_bytes(out[1..5].try_into().unwrap()),
+            4 + expected.len() as i32
+        );
+        assert!(rewrite_message(&rules, b"S\0\0\0\x04").is_none());
+    }
+}
@@ -0,0 +1,243 @@
+//! Detection of statements that leave backend-local state behind.
+//!
+//! Under transaction pooling the next transaction of a client may run on a
+//! different backend. Temporary tables, session advisory locks and cursors
+//! `WITH HOLD` outlive the transaction that created them, so the client
+//! would either lose them or leave them to a stranger.
+//! With `auto_session_pinning` such a client keeps its backend for the rest
+//! of the session instead.
+
+/// Session advisory lock functions. The `_xact_` variants are released at
+/// transaction end and do not pin.
+const ADVISORY_LOCKS: [&str; 4] = [
+    "pg_advisory_lock",
+    "pg_advisory_lock_shared",
+    "pg_try_advisory_lock",
+    "pg_try_advisory_lock_shared",
+];
+
+/// Why the statement needs the client to stay on its backend, or None.
+///
+/// The check is lexical: string literals and comments never match a
+/// keyword, anything else is matched case-insensitively. A false positive
+/// only costs a pinned backend, a false negative is the old behaviour.
+pub(crate) fn session_state_reason(query: &[u8]) -> Option<&'static str> {
+    let mut prev: [&[u8]; 2] = [b"", b""];
+    let mut declare = false;
+    let mut temp_table = false;
+    for word in Words::new(query) {
+        if (is(prev[1], "create")
+            || is(prev[1], "into")
+            || (is(prev[0], "create") && (is(prev[1], "global") || is(prev[1], "local"))))
+            && (is(word, "temp") || is(word, "temporary"))
+        {
+            temp_table = true;
+        } else if temp_table && is(prev[0], "on") && is(prev[1], "commit") && is(word, "drop") {
+            // CREATE TEMP TABLE ... ON COMMIT DROP lives for one transaction.
+            temp_table = false;
+        } else if ADVISORY_LOCKS.iter().any(|f| is(word, f)) {
+            return Some("session advisory lock");
+        } else if is(word, "declare") {
+            declare = true;
+        } else if declare && is(prev[1], "with") && is(word, "hold") {
+            return Some("cursor WITH HOLD");
+        }
+        prev = [prev[1], word];
+    }
+    temp_table.then_some("temporary table")
+}
+
+/// Query text of a Query or Parse message; empty for other messages.
+/// Parse carries the statement name before the query, both NUL-terminated.
+pub(crate) fn statement_text(message: &[u8]) -> &[u8] {
+    let body = message.get(5..).unwrap_or_default();
+    let query = match message.first() {
+        Some(b'Q') => body,
+        Some(b'P') => match body.iter().position(|&b| b == 0) {
+            Some(name_end) => &body[name_end + 1..],
+            None => return b"",
+        },
+        _ => return b"",
+    };
+    let query_end = query.iter().position(|&b| b == 0).unwrap_or(query.len());
+    &query[..query_end]
+}
+
+#[inline]
+pub(crate) fn is(word: &[u8], keyword: &str) -> bool {
+    word.eq_ignore_ascii_case(keyword.as_bytes())
+}
+
+/// A quoted identifier without its quotes; other words as they are.
+pub(crate) fn unquoted(word: &[u8]) -> &[u8] {
+    word.strip_prefix(b"\"")
+        .map(|w| w.strip_suffix(b"\"").unwrap_or(w))
+        .unwrap_or(word)
+}
+
+/// Identifiers and keywords of a query, quoted identifiers and string
+/// literals with their quotes, and `;` statement separators. Comments are
+/// skipped.
+pub(crate) struct Words<'a> {
+    query: &'a [u8],
+    pos: usize,
+}
+
+impl<'a> Words<'a> {
+    pub(crate) fn new(query: &'a [u8]) -> Self {
+        Words { query, pos: 0 }
+    }
+
+    /// Offset just past the last word returned.
+    pub(crate) fn end(&self) -> usize {
+        self.pos
+    }
+
+    /// Advance past the closing `end`, or to the end of the query.
+    fn skip_past(&mut self, end: &[u8]) {
+        match self.query[self.pos..]
+            .windows(end.len())
+            .position(|w| w == end)
+        {
+            Some(i) => self.pos += i + end.len(),
+            None => self.pos = self.query.len(),
+        }
+    }
+}
+
+impl<'a> Iterator for Words<'a> {
+    type Item = &'a [u8];
+
+    fn next(&mut self) -> Option<&'a [u8]> {
+        let q = self.query;
+        while self.pos < q.len() {
+            let c = q[self.pos];
+            if c.is_ascii_alphanumeric() || c == b'_' {
+                let start = self.pos;
+                while self.pos < q.len()
+                    && (q[self.pos].is_ascii_alphanumeric() || q[self.pos] == b'_')
+                {
+                    self.pos += 1;
+                }
+                return Some(&q[start..self.pos]);
+            }
+            self.pos += 1;
+            match c {
+                b'\'' => {
+                    // A doubled quote continues the literal.
+                    let start = self.pos - 1;
+                    self.skip_past(b"'");
+                    while q.get(self.pos) == Some(&b'\'') {
+                        self.pos += 1;
+                        self.skip_past(b"'");
+                    }
+                    return Some(&q[start..self.pos]);
+                }
+                b'"' => {
+                    // A doubled quote continues the identifier.
+                    let start = self.pos - 1;
+                    self.skip_past(b"\"");
+                    while q.get(self.pos) == Some(&b'"') {
+                        self.pos += 1;
+                        self.skip_past(b"\"");
+                    }
+                    return Some(&q[start..self.pos]);
+                }
+                b';' => return Some(&q[self.pos - 1..self.pos]),
+                b'-' if q.get(self.pos) == Some(&b'-') => self.skip_past(b"\n"),
+                b'/' if q.get(self.pos) == Some(&b'*') => self.skip_past(b"*/"),
+                _ => {}
+            }
+        }
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn reason(sql: &str) -> Option<&'static str> {
+        session_state_reason(sql.as_bytes())
+    }
+
+    #[test]
+    fn temporary_tables_pin() {
+        assert_eq!(
+            reason("CREATE TEMP TABLE t (id int)"),
+            Some("temporary table")
+        );
+        assert_eq!(
+            reason("create temporary table t as select 1"),
+            Some("temporary table")
+        );
+        assert_eq!(
+            reason("CREATE GLOBAL TEMPORARY TABLE t (id int)"),
+            Some("temporary table")
+        );
+        assert_eq!(
+            reason("SELECT * INTO TEMP t FROM src"),
+            Some("temporary table")
+        );
+        assert_eq!(
+            reason("CREATE TEMP VIEW v AS SELECT 1"),
+            Some("temporary table")
+        );
+    }
+
+    #[test]
+    fn on_commit_drop_temp_table_does_not_pin() {
+        assert_eq!(reason("CREATE TEMP TABLE t (id int) ON COMMIT DROP"), None);
+        assert_eq!(
+            reason("CREATE TEMP TABLE t (id int) ON COMMIT DELETE ROWS"),
+            Some("temporary table")
+        );
+    }
+
+    #[test]
+    fn session_advisory_locks_pin() {
+        assert_eq!(
+            reason("SELECT pg_advisory_lock(42)"),
+            Some("session advisory lock")
+        );
+        assert_eq!(
+            reason("select PG_TRY_ADVISORY_LOCK_SHARED(1, 2)"),
+            Some("session advisory lock")
+        );
+        assert_eq!(reason("SELECT pg_advisory_xact_lock(42)"), None);
+    }
+
+    #[test]
+    fn hold_cursors_pin() {
+        assert_eq!(
+            reason("DECLARE c CURSOR WITH HOLD FOR SELECT 1"),
+            Some("cursor WITH HOLD")
+        );
+        assert_eq!(reason("DECLARE c CURSOR WITHOUT HOLD FOR SELECT 1"), None);
+        assert_eq!(reason("DECLARE c CURSOR FOR SELECT 1"), None);
+    }
+
+    #[test]
+    fn literals_and_comments_are_ignored() {
+        assert_eq!(reason("SELECT 'pg_advisory_lock(1)'"), None);
+        assert_eq!(reason("SELECT 1 -- create temp table t\n"), None);
+        assert_eq!(reason("/* CREATE TEMP TABLE */ SELECT 1"), None);
+        assert_eq!(reason("SELECT \"temp\" FROM create_temp"), None);
+        assert_eq!(reason("SELECT temp FROM t"), None);
+    }
+
+    #[test]
+    fn statement_text_of_query_and_parse() {
+        let mut query = vec![b'Q', 0, 0, 0, 0];
+        query.extend_from_slice(b"CREATE TEMP TABLE t (id int)\0");
+        assert_eq!(statement_text(&query), b"CREATE TEMP TABLE t (id int)");
+        let mut parse = vec![b'P', 0, 0, 0, 0];
+        parse.extend_from_slice(b"s1\0SELECT pg_advisory_lock($1)\0\0\0");
+        assert_eq!(statement_text(&parse), b"SELECT pg_advisory_lock($1)");
+        let mut unnamed = vec![b'P', 0, 0, 0, 0];
+        unnamed.extend_from_slice(b"\0SELECT 1\0\0\0");
+        assert_eq!(statement_text(&unnamed), b"SELECT 1");
+        assert_eq!(statement_text(b"P"), b"");
+        assert_eq!(statement_text(b"S\0\0\0\x04"), b"");
+    }
+}
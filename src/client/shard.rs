@@ -0,0 +1,355 @@
+//! `SET doorman.shard` / `SET doorman.shard_key` routing hints.
+//!
+//! Drivers that can't put routing comments into their queries can still
+//! pick a shard. A pool's `shards` lists the pools that serve as its
+//! shards, in order; `SET doorman.shard = N` sends the rest of the
+//! transaction to the N-th of them (counting from 0), and
+//! `SET doorman.shard_key = '...'` picks the shard by the 64-bit FNV-1a
+//! hash of the key modulo the number of shards, so a key maps to the same
+//! shard across restarts and versions. The statement is answered by the
+//! pooler and must come before the first query of the transaction it
+//! pins; outside a transaction it pins the next one. `DEFAULT` returns to
+//! the client's own pool. `SESSION` and `LOCAL` are accepted and mean the
+//! same: the pin ends with the transaction. Only transaction-mode pools
+//! route; in session mode the statement goes to the server as is.
+
+use bytes::{BufMut, BytesMut};
+use log::{debug, warn};
+
+use crate::client::core::Client;
+use crate::config::{config_arc, Config};
+use crate::errors::Error;
+use crate::messages::{
+    command_complete, ready_for_query, simple_query, statement_error_message, write_all_flush,
+};
+use crate::pool::get_pool;
+
+pub(crate) const SHARD: &str = "doorman.shard";
+pub(crate) const SHARD_KEY: &str = "doorman.shard_key";
+
+/// Longest simple query inspected by [`parse`]. Real `SET
+/// doorman.shard_key = '...'` statements are short; anything longer is
+/// forwarded without parsing.
+const SHARD_SET_MAX_LEN: usize = 256;
+
+/// A `SET doorman.shard` or `SET doorman.shard_key` statement.
+#[derive(Debug, PartialEq, Eq)]
+pub(crate) struct ShardSet {
+    /// [`SHARD`] or [`SHARD_KEY`].
+    pub(crate) setting: &'static str,
+    /// The value, unquoted; None for `DEFAULT`. Err tells why a statement
+    /// that names the setting can't be read.
+    pub(crate) value: Result<Option<String>, &'static str>,
+}
+
+/// The statement when the Q message is `SET [SESSION|LOCAL]
+/// doorman.shard ...` or `SET ... doorman.shard_key ...`, matched
+/// case-insensitively. Any other query returns `None`.
+pub(crate) fn parse(message: &BytesMut) -> Option<ShardSet> {
+    if message.len() > SHARD_SET_MAX_LEN || message.len() < 6 || message[0] != b'Q' {
+        return None;
+    }
+    let query = std::str::from_utf8(&message[5..message.len() - 1]).ok()?;
+    let mut words = query
+        .trim_start()
+        .splitn(2, |c: char| c.is_ascii_whitespace());
+    if !words.next()?.eq_ignore_ascii_case("set") {
+        return None;
+    }
+    let mut rest = words.next()?.trim_start();
+    for scope in ["session ", "local "] {
+        if rest
+            .get(..scope.len())
+            .is_some_and(|s| s.eq_ignore_ascii_case(scope))
+        {
+            rest = rest[scope.len()..].trim_start();
+            break;
+        }
+    }
+    let name_len = rest
+        .find(|c: char| c.is_ascii_whitespace() || c == '=' || c == '\'')
+        .unwrap_or(rest.len());
+    let setting = [SHARD, SHARD_KEY]
+        .into_iter()
+        .find(|setting| rest[..name_len].eq_ignore_ascii_case(setting))?;
+    Some(ShardSet {
+        setting,
+        value: value(&rest[name_len..]),
+    })
+}
+
+/// The value after the setting name: `= value` or `TO value`, a single
+/// literal with at most a semicolon after it.
+fn value(rest: &str) -> Result<Option<String>, &'static str> {
+    let rest = rest.trim_start();
+    let rest = match rest.strip_prefix('=') {
+        Some(rest) => rest,
+        None if rest
+            .get(..3)
+            .is_some_and(|to| to.eq_ignore_ascii_case("to ")) =>
+        {
+            &rest[3..]
+        }
+        None => return Err("expected = or TO after the setting name"),
+    };
+    let rest = rest.trim();
+    let rest = rest.strip_suffix(';').unwrap_or(rest).trim_end();
+    if let Some(quoted) = rest.strip_prefix('\'') {
+        let inner = quoted
+            .strip_suffix('\'')
+            .ok_or("unterminated quoted value")?;
+        if inner.replace("''", "").contains('\'') {
+            return Err("the value must be a single literal, sent as a statement of its own");
+        }
+        return Ok(Some(inner.replace("''", "'")));
+    }
+    if rest.is_empty()
+        || !rest
+            .bytes()
+            .all(|b| b.is_ascii_alphanumeric() || matches!(b, b'_' | b'-' | b'.'))
+    {
+        return Err("the value must be a single literal, sent as a statement of its own");
+    }
+    if rest.eq_ignore_ascii_case("default") {
+        return Ok(None);
+    }
+    Ok(Some(rest.to_string()))
+}
+
+/// The pool that serves the shard `set` names for a client of
+/// `pool_name`; None for `DEFAULT`. Errs with the SQLSTATE and the
+/// message for the client. The message never repeats the client's value.
+pub(crate) fn resolve(
+    config: &Config,
+    pool_name: &str,
+    set: &ShardSet,
+) -> Result<Option<String>, (&'static str, String)> {
+    let value = match &set.value {
+        Ok(Some(value)) => value,
+        Ok(None) => return Ok(None),
+        Err(reason) => return Err(("42601", format!("invalid SET {}: {reason}", set.setting))),
+    };
+    let shards = config
+        .pools
+        .get(pool_name)
+        .map(|pool| pool.shards.as_slice())
+        .unwrap_or_default();
+    if shards.is_empty() {
+        return Err((
+            "0A000",
+            format!("SET {}: pool \"{pool_name}\" has no shards", set.setting),
+        ));
+    }
+    let index = if set.setting == SHARD {
+        value
+            .parse::<usize>()
+            .ok()
+            .filter(|index| *index < shards.len())
+            .ok_or_else(|| {
+                (
+                    "22023",
+                    format!(
+                        "invalid value for {SHARD}: pool \"{pool_name}\" has shards 0 to {}",
+                        shards.len() - 1
+                    ),
+                )
+            })?
+    } else {
+        (fnv1a(value.as_bytes()) % shards.len() as u64) as usize
+    };
+    Ok(Some(shards[index].clone()))
+}
+
+/// 64-bit FNV-1a.
+fn fnv1a(bytes: &[u8]) -> u64 {
+    bytes.iter().fold(0xcbf2_9ce4_8422_2325, |hash, &byte| {
+        (hash ^ byte as u64).wrapping_mul(0x0100_0000_01b3)
+    })
+}
+
+/// A statement that fails on the backend with `code` and `message`.
+fn raise(code: &str, message: &str) -> BytesMut {
+    let message = message.replace('\\', "\\\\").replace('\'', "''");
+    simple_query(&format!(
+        "DO $doorman$BEGIN RAISE EXCEPTION USING ERRCODE = '{code}', MESSAGE = E'{message}'; END$doorman$"
+    ))
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// Answer a `SET doorman.shard` / `doorman.shard_key` SimpleQuery;
+    /// true when the client got its answer. A statement that fails after
+    /// a deferred BEGIN is replaced in `message` by one that fails on the
+    /// backend, so the transaction aborts as it would on PostgreSQL, and
+    /// false is returned to send it there.
+    pub(crate) async fn set_shard(&mut self, message: &mut BytesMut) -> Result<bool, Error> {
+        if !self.transaction_mode {
+            return Ok(false);
+        }
+        let Some(set) = parse(message) else {
+            return Ok(false);
+        };
+        let in_transaction = self.client_pending_begin.is_some();
+        let shard = resolve(&config_arc(), &self.pool_name, &set).and_then(|shard| match shard {
+            None => Ok(None),
+            Some(shard) => get_pool(&shard, &self.username)
+                .map(|pool| Some((shard.clone(), pool)))
+                .ok_or_else(|| {
+                    (
+                        "3D000",
+                        format!("shard pool \"{shard}\" has no user \"{}\"", self.username),
+                    )
+                }),
+        });
+        match shard {
+            Ok(shard) => {
+                debug!(
+                    "[{}@{} #c{}] SET {}: transaction served by pool {}",
+                    self.username,
+                    self.pool_name,
+                    self.connection_id,
+                    set.setting,
+                    shard
+                        .as_ref()
+                        .map_or(self.pool_name.as_str(), |(name, _)| name.as_str()),
+                );
+                self.shard_pool = shard.map(|(_, pool)| pool);
+                let mut res = command_complete("SET");
+                res.put(ready_for_query(in_transaction));
+                write_all_flush(&mut self.write, &res).await?;
+                Ok(true)
+            }
+            Err((code, text)) => {
+                warn!(
+                    "[{}@{} #c{}] client {}: {text}",
+                    self.username, self.pool_name, self.connection_id, self.addr
+                );
+                if in_transaction {
+                    *message = raise(code, &text);
+                    return Ok(false);
+                }
+                let mut res = statement_error_message(&text, code);
+                res.put(ready_for_query(false));
+                write_all_flush(&mut self.write, &res).await?;
+                Ok(true)
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn query(sql: &str) -> BytesMut {
+        simple_query(sql)
+    }
+
+    fn value_of(sql: &str) -> Option<Result<Option<String>, &'static str>> {
+        parse(&query(sql)).map(|set| set.value)
+    }
+
+    #[test]
+    fn parse_matches_both_settings_and_scopes() {
+        let set = parse(&query("set DOORMAN.SHARD to 3;")).unwrap();
+        assert_eq!(set.setting, SHARD);
+        assert_eq!(set.value, Ok(Some("3".into())));
+        let set = parse(&query("SET LOCAL doorman.shard_key = 'tenant-42'")).unwrap();
+        assert_eq!(set.setting, SHARD_KEY);
+        assert_eq!(set.value, Ok(Some("tenant-42".into())));
+        assert_eq!(
+            value_of("  SET session doorman.shard_key='it''s'"),
+            Some(Ok(Some("it's".into())))
+        );
+        assert_eq!(value_of("SET doorman.shard = DEFAULT"), Some(Ok(None)));
+    }
+
+    #[test]
+    fn parse_rejects_values_it_cannot_read() {
+        assert!(matches!(value_of("SET doorman.shard 3"), Some(Err(_))));
+        assert!(matches!(
+            value_of("SET doorman.shard = 1; SELECT 1"),
+            Some(Err(_))
+        ));
+        assert!(matches!(
+            value_of("SET doorman.shard_key = 'a'; SELECT 'b'"),
+            Some(Err(_))
+        ));
+        assert!(matches!(
+            value_of("SET doorman.shard_key = 'a"),
+            Some(Err(_))
+        ));
+    }
+
+    #[test]
+    fn parse_ignores_other_statements() {
+        assert_eq!(parse(&query("SET search_path = public")), None);
+        assert_eq!(parse(&query("SET doorman.sharding = 1")), None);
+        assert_eq!(parse(&query("SELECT 'SET doorman.shard'")), None);
+        assert_eq!(parse(&query("SET")), None);
+    }
+
+    fn config() -> Config {
+        let mut pool = crate::config::Pool::default();
+        pool.shards = vec!["app_s0".into(), "app_s1".into(), "app_s2".into()];
+        let mut config = Config::default();
+        config.pools.insert("app".into(), pool);
+        config
+            .pools
+            .insert("plain".into(), crate::config::Pool::default());
+        config
+    }
+
+    fn resolve_sql(pool_name: &str, sql: &str) -> Result<Option<String>, (&'static str, String)> {
+        resolve(&config(), pool_name, &parse(&query(sql)).unwrap())
+    }
+
+    #[test]
+    fn resolve_picks_shard_by_number_or_key() {
+        assert_eq!(
+            resolve_sql("app", "SET doorman.shard = 1"),
+            Ok(Some("app_s1".into()))
+        );
+        assert_eq!(resolve_sql("app", "SET doorman.shard = DEFAULT"), Ok(None));
+        let key = resolve_sql("app", "SET doorman.shard_key = 'tenant-42'");
+        assert_eq!(
+            key,
+            resolve_sql("app", "SET doorman.shard_key = 'tenant-42'")
+        );
+        assert!(key.unwrap().is_some_and(|shard| shard.starts_with("app_s")));
+        // FNV-1a of "a" is 0xaf63dc4c8601ec8c, which is 1 modulo 3.
+        assert_eq!(
+            resolve_sql("app", "SET doorman.shard_key = a"),
+            Ok(Some("app_s1".into()))
+        );
+    }
+
+    #[test]
+    fn resolve_errors() {
+        assert_eq!(
+            resolve_sql("app", "SET doorman.shard = 3").unwrap_err().0,
+            "22023"
+        );
+        assert_eq!(
+            resolve_sql("app", "SET doorman.shard = -1").unwrap_err().0,
+            "22023"
+        );
+        assert_eq!(
+            resolve_sql("app", "SET doorman.shard 1").unwrap_err().0,
+            "42601"
+        );
+        assert_eq!(
+            resolve_sql("plain", "SET doorman.shard = 0").unwrap_err().0,
+            "0A000"
+        );
+    }
+
+    #[test]
+    fn raise_quotes_the_message() {
+        let sql = raise("22023", r"pool 'x\y'");
+        assert!(String::from_utf8_lossy(&sql).contains(r"MESSAGE = E'pool ''x\\y'''"));
+    }
+}
@@ -0,0 +1,193 @@
+//! `SHOW <parameter>` answered without a server
+//! (`general.show_local_parameters`).
+//!
+//! Health checks and drivers read `server_version`, `transaction_isolation`
+//! and the like with a SimpleQuery `SHOW`, and under saturation each of
+//! them waits for a pool slot like any real query. For the parameters
+//! listed in `show_local_parameters` pg_doorman answers from the client's
+//! ParameterStatus snapshot, which also holds the parameters the client set
+//! at startup. A parameter PostgreSQL does not report, such as
+//! `transaction_isolation`, is read from the backend once per pool and the
+//! value is reused afterwards. `SET` reaches the snapshot only for the
+//! parameters PostgreSQL reports, so other parameters belong in the list
+//! only when clients leave them alone. After a deferred BEGIN the query
+//! goes to the backend as usual.
+
+use bytes::{BufMut, BytesMut};
+use log::debug;
+
+use crate::client::core::Client;
+use crate::client::transaction::idle_backend_round_trip;
+use crate::errors::Error;
+use crate::messages::protocol::row_description;
+use crate::messages::{
+    command_complete, data_row, ends_with_idle_ready_for_query, has_error_response,
+    ready_for_query, write_all_flush, DataType,
+};
+use crate::pool::ConnectionPool;
+use crate::server::parameters::canonicalize_param_name;
+
+/// Parameter read by the SimpleQuery `message` when it is a `SHOW`, in
+/// lower case. `SHOW TRANSACTION ISOLATION LEVEL` reads
+/// `transaction_isolation`; quoted names are left to the backend.
+fn shown_parameter(message: &[u8]) -> Option<String> {
+    if message.first() != Some(&b'Q') || message.len() < 6 || message.len() > 128 {
+        return None;
+    }
+    let query = std::str::from_utf8(&message[5..message.len() - 1]).ok()?;
+    let mut words = query.trim().trim_end_matches(';').split_ascii_whitespace();
+    if !words.next()?.eq_ignore_ascii_case("show") {
+        return None;
+    }
+    match words.collect::<Vec<_>>()[..] {
+        [name]
+            if name
+                .bytes()
+                .all(|b| b.is_ascii_alphanumeric() || b == b'_' || b == b'.') =>
+        {
+            Some(name.to_ascii_lowercase())
+        }
+        [a, b, c]
+            if a.eq_ignore_ascii_case("transaction")
+                && b.eq_ignore_ascii_case("isolation")
+                && c.eq_ignore_ascii_case("level") =>
+        {
+            Some("transaction_isolation".to_string())
+        }
+        _ => None,
+    }
+}
+
+/// Snapshot entry holding the value of `name`. Outside a transaction
+/// `transaction_*` parameters equal their `default_transaction_*`.
+fn snapshot_key(name: &str) -> String {
+    if name.starts_with("transaction_") {
+        format!("default_{name}")
+    } else {
+        canonicalize_param_name(name.to_string())
+    }
+}
+
+/// Value of the single-column row in a successful `SHOW` response.
+fn shown_value(response: &[u8]) -> Option<String> {
+    if has_error_response(response) || !ends_with_idle_ready_for_query(response) {
+        return None;
+    }
+    let mut pos = 0;
+    while pos + 5 <= response.len() {
+        let len = u32::from_be_bytes(response[pos + 1..pos + 5].try_into().ok()?) as usize;
+        let body = response.get(pos + 5..pos + 1 + len)?;
+        if response[pos] == b'D' && body.len() >= 6 && body[..2] == [0, 1] {
+            let value_len = i32::from_be_bytes(body[2..6].try_into().ok()?);
+            let value = body.get(6..6 + usize::try_from(value_len).ok()?)?;
+            return String::from_utf8(value.to_vec()).ok();
+        }
+        pos += 1 + len;
+    }
+    None
+}
+
+impl<S, T> Client<S, T>
+where
+    S: tokio::io::AsyncRead + std::marker::Unpin,
+    T: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    /// Answer `message` when it is a `SHOW` of a parameter listed in
+    /// `show_local_parameters`. False when it goes to the backend.
+    pub(crate) async fn answer_show(
+        &mut self,
+        message: &BytesMut,
+        pool: &ConnectionPool,
+    ) -> Result<bool, Error> {
+        if self.client_pending_begin.is_some() {
+            return Ok(false);
+        }
+        let Some(name) = shown_parameter(message) else {
+            return Ok(false);
+        };
+        let listed = crate::config::config_arc()
+            .general
+            .show_local_parameters
+            .iter()
+            .any(|parameter| parameter.eq_ignore_ascii_case(&name));
+        if !listed {
+            return Ok(false);
+        }
+
+        let snapshot = self
+            .server_parameters
+            .get_param(&snapshot_key(&name))
+            .map(str::to_string);
+        let (value, source) = if let Some(value) = snapshot {
+            (value, "parameter_status")
+        } else if let Some(value) = pool.show_cache.get(&name).map(|v| v.value().clone()) {
+            (value, "cache")
+        } else {
+            let response = idle_backend_round_trip(pool, message, "SHOW").await?;
+            if let Some(value) = shown_value(&response) {
+                pool.show_cache.insert(name, value);
+                crate::web::metrics::record_show_local("backend");
+            }
+            write_all_flush(&mut self.write, &response).await?;
+            return Ok(true);
+        };
+        debug!(
+            "[{}@{} #c{}] SHOW {name} answered from {source}",
+            self.username, self.pool_name, self.connection_id
+        );
+        crate::web::metrics::record_show_local(source);
+
+        let mut response = BytesMut::new();
+        let column = canonicalize_param_name(name);
+        response.put(row_description(&vec![(column.as_str(), DataType::Text)]));
+        response.put(data_row(&[value]));
+        response.put(command_complete("SHOW"));
+        response.put(ready_for_query(false));
+        write_all_flush(&mut self.write, &response).await?;
+        Ok(true)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::messages::simple_query;
+
+    #[test]
+    fn parses_show_of_one_parameter() {
+        let show = |query: &str| shown_parameter(&simple_query(query));
+        assert_eq!(
+            show("SHOW server_version"),
+            Some("server_version".to_string())
+        );
+        assert_eq!(show("show DateStyle ;"), Some("datestyle".to_string()));
+        assert_eq!(
+            show("SHOW TRANSACTION ISOLATION LEVEL"),
+            Some("transaction_isolation".to_string())
+        );
+        assert_eq!(show("SHOW \"DateStyle\""), None);
+        assert_eq!(show("SHOW server_version; SELECT 1"), None);
+        assert_eq!(show("SELECT 1"), None);
+        assert_eq!(snapshot_key("datestyle"), "DateStyle");
+        assert_eq!(
+            snapshot_key("transaction_isolation"),
+            "default_transaction_isolation"
+        );
+    }
+
+    #[test]
+    fn reads_value_of_show_response() {
+        let mut response = BytesMut::new();
+        response.put(row_description(&vec![(
+            "transaction_isolation",
+            DataType::Text,
+        )]));
+        response.put(data_row(&["read committed"]));
+        response.put(command_complete("SHOW"));
+        response.put(ready_for_query(false));
+        assert_eq!(shown_value(&response), Some("read committed".to_string()));
+        response.truncate(response.len() - 6);
+        response.put(ready_for_query(true));
+        assert_eq!(shown_value(&response), None);
+    }
+}
@@ -1,21 +1,25 @@
 use bytes::{Buf, BufMut, BytesMut};
-use log::error;
+use log::{debug, error};
+use std::collections::HashMap;
 use std::ffi::CStr;
+use std::net::SocketAddr;
 use std::str;
 use std::sync::atomic::Ordering;
 use std::sync::Arc;
+use std::time::Instant;
 use tokio::io::{split, AsyncReadExt, BufReader, ReadHalf, WriteHalf};
 use tokio::net::TcpStream;
 
-use crate::auth::authenticate;
 use crate::auth::hba::CheckResult;
 use crate::auth::talos::{extract_talos_token, talos_role_to_string};
-use crate::config::{check_hba, get_config};
+use crate::auth::{authenticate, require_tls_for_plain_auth};
+use crate::config::tls::POSTGRESQL_ALPN;
+use crate::config::{check_hba, get_config, Listener};
 use crate::errors::{ClientIdentifier, Error};
 use crate::messages::constants::*;
 use crate::messages::{
-    error_response_terminal, parse_startup, plain_password_challenge, read_password,
-    ready_for_query, write_all_flush,
+    error_response_terminal, negotiate_protocol_version_message, parse_startup,
+    plain_password_challenge, read_password, ready_for_query, write_all_flush,
 };
 use crate::pool::ClientServerMap;
 use crate::server::ServerParameters;
@@ -24,6 +28,8 @@ use crate::transport::ClientTransport;
 
 use super::buffer_pool::PooledBuffer;
 use super::core::{Client, PreparedStatementState};
+use super::handshake::LoginQueue;
+use super::util::startup_options_setting;
 
 /// Type of connection received from client.
 pub(crate) enum ClientConnectionType {
@@ -48,7 +54,11 @@ where
     // Validate message length: minimum is 8 bytes (4 for length field + 4 for protocol code).
     // Also reject negative or excessively large lengths to prevent overflow/DoS.
     if !(8..=8 * 1024).contains(&len) {
-        return Err(Error::ClientBadStartup);
+        return Err(Error::ClientProtocolViolation {
+            kind: "bad_length",
+            detail: format!("startup packet length {len}"),
+            head: len.to_be_bytes().to_vec(),
+        });
     }
 
     // Get the rest of the message.
@@ -65,8 +75,12 @@ where
         // Client is requesting SSL (TLS).
         SSL_REQUEST_CODE => Ok((ClientConnectionType::Tls, bytes)),
 
-        // Client wants to use plain text, requesting regular startup.
-        PROTOCOL_VERSION_NUMBER => Ok((ClientConnectionType::Startup, bytes)),
+        // Client wants to use plain text, requesting regular startup with
+        // any minor version of protocol 3.
+        code if code >> 16 == PROTOCOL_VERSION_NUMBER >> 16 => {
+            negotiate_protocol_version(stream, code, &bytes).await?;
+            Ok((ClientConnectionType::Startup, bytes))
+        }
 
         // Client is requesting to cancel a running query (plain text connection).
         CANCEL_REQUEST_CODE => Ok((ClientConnectionType::CancelQuery, bytes)),
@@ -81,19 +95,79 @@ where
 
         // Something else, probably something is wrong, and it's not our fault,
         // e.g. badly implemented Postgres client.
-        _ => Err(Error::ProtocolSyncError(format!(
-            "Unexpected startup code: {code}"
-        ))),
+        _ => {
+            let mut head = len.to_be_bytes().to_vec();
+            head.extend_from_slice(&startup);
+            Err(Error::ClientProtocolViolation {
+                kind: "bad_startup",
+                detail: format!("unexpected startup code: {code}"),
+                head,
+            })
+        }
+    }
+}
+
+/// Answer NegotiateProtocolVersion, like PostgreSQL does, when the client
+/// asks for a minor version newer than 3.2 or for `_pq_.` protocol options.
+/// The client then carries on with 3.2 (or what it asked for) and without
+/// the options, which `parse_startup` drops.
+async fn negotiate_protocol_version<S>(
+    stream: &mut S,
+    code: i32,
+    params: &[u8],
+) -> Result<(), Error>
+where
+    S: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    let minor = code & 0xffff;
+    let options = protocol_options(params);
+    if minor <= PROTOCOL_LATEST_MINOR && options.is_empty() {
+        return Ok(());
     }
+    let version = PROTOCOL_VERSION_NUMBER | minor.min(PROTOCOL_LATEST_MINOR);
+    write_all_flush(
+        stream,
+        &negotiate_protocol_version_message(version, &options),
+    )
+    .await
+}
+
+/// Names of the `_pq_.` protocol options in StartupMessage parameters.
+fn protocol_options(params: &[u8]) -> Vec<String> {
+    params
+        .split(|b| *b == 0)
+        .step_by(2)
+        .filter(|name| name.starts_with(b"_pq_."))
+        .map(|name| String::from_utf8_lossy(name).into_owned())
+        .collect()
+}
+
+/// Pool the client picked with `general.client_pool_parameter`, set as a
+/// startup parameter of its own or with `-c` in `options`. A parameter of
+/// its own is removed, so it never reaches PostgreSQL.
+fn selected_pool(parameters: &mut HashMap<String, String>) -> Option<String> {
+    let config = get_config();
+    let name = config.general.client_pool_parameter.as_deref()?;
+    parameters
+        .remove(name)
+        .or_else(|| startup_options_setting(parameters.get("options")?, name))
+        .filter(|pool| !pool.is_empty())
 }
 
 /// Handle TLS connection negotiation.
+/// `addr` is the client address: the socket peer, or the source from the
+/// PROXY header on `proxy_protocol` listeners. `direct` is set when the
+/// client opened TLS without SSLRequest (PostgreSQL 17 `sslnegotiation=direct`).
+#[allow(clippy::too_many_arguments)]
 pub async fn startup_tls(
     stream: TcpStream,
+    addr: SocketAddr,
+    listener: Option<Arc<Listener>>,
     client_server_map: ClientServerMap,
     admin_only: bool,
     tls_acceptor: tokio_native_tls::TlsAcceptor,
     connection_id: u64,
+    direct: bool,
 ) -> Result<
     Client<
         ReadHalf<tokio_native_tls::TlsStream<TcpStream>>,
@@ -101,16 +175,6 @@ pub async fn startup_tls(
     >,
     Error,
 > {
-    // Negotiate TLS.
-    let addr = match stream.peer_addr() {
-        Ok(addr) => addr,
-        Err(err) => {
-            return Err(Error::SocketError(format!(
-                "Failed to get peer address: {err:?}"
-            )));
-        }
-    };
-
     // Capture TCP fd before TLS wrapping — needed for migration
     #[cfg(unix)]
     let tcp_raw_fd = {
@@ -118,17 +182,43 @@ pub async fn startup_tls(
         stream.as_raw_fd()
     };
 
+    let handshake_started = Instant::now();
     let mut stream = match tls_acceptor.accept(stream).await {
-        Ok(stream) => stream,
+        Ok(stream) => {
+            crate::web::metrics::record_client_tls_handshake(
+                stream.get_ref().protocol_version(),
+                handshake_started.elapsed().as_secs_f64(),
+            );
+            stream
+        }
 
         // TLS negotiation failed.
         Err(err) => {
             crate::web::metrics::record_listener_rejection("tls_handshake_fail");
+            crate::web::metrics::record_client_tls_handshake_error(&err.to_string());
             error!("TLS negotiation failed: {err}");
             return Err(Error::TlsError);
         }
     };
 
+    // Like PostgreSQL, only accept direct TLS from clients that negotiated
+    // the "postgresql" protocol, so a stray HTTPS client can't get in.
+    if direct {
+        let alpn = stream.get_ref().negotiated_alpn().ok().flatten();
+        if alpn.as_deref() != Some(POSTGRESQL_ALPN.as_bytes()) {
+            error_response_terminal(
+                &mut stream,
+                "received direct SSL connection request without ALPN protocol negotiation extension",
+                "08P01",
+            )
+            .await?;
+            crate::web::metrics::record_listener_rejection("protocol_error");
+            return Err(Error::ProtocolSyncError(
+                "direct TLS connection without ALPN \"postgresql\"".to_string(),
+            ));
+        }
+    }
+
     // TLS negotiation successful.
     // Continue with regular startup using encrypted connection.
     match get_startup::<tokio_native_tls::TlsStream<TcpStream>>(&mut stream).await {
@@ -150,6 +240,7 @@ pub async fn startup_tls(
                 ClientTransport::Tcp {
                     peer: addr,
                     ssl: true,
+                    listener,
                 },
                 bytes,
                 client_server_map,
@@ -177,6 +268,7 @@ pub async fn startup_tls(
 
         Err(err) => {
             crate::web::metrics::record_listener_rejection("invalid_startup");
+            super::violation::observe("tcp", &addr.to_string(), &err);
             Err(err)
         }
     }
@@ -201,6 +293,12 @@ where
         #[cfg(unix)] raw_fd: Option<std::os::unix::io::RawFd>,
         #[cfg(all(unix, feature = "tls-migration"))] ssl_ptr: Option<super::core::SslRawPtr>,
     ) -> Result<Client<S, T>, Error> {
+        let mut parameters = parse_startup(bytes)?;
+        // Behind a trusted upstream pooler the client is the one it names.
+        let transport = super::identity::apply(&mut write, transport, &mut parameters).await?;
+        let chosen_pool = selected_pool(&mut parameters);
+        let chosen_tag = super::tags::from_startup(&crate::config::config_arc(), &mut parameters);
+
         // Unix sockets have no peer address; we pin a sentinel loopback
         // value into the Client struct so the many transaction-level log
         // lines that interpolate `self.addr` keep compiling. A follow-up
@@ -212,7 +310,7 @@ where
             }
         };
         let use_tls = transport.is_tls();
-        let parameters = parse_startup(bytes)?;
+        let listener = transport.listener();
 
         // This parameter is mandatory by the protocol.
         let username_from_parameters = match parameters.get("user") {
@@ -228,6 +326,17 @@ where
             .get("database")
             .unwrap_or(username_from_parameters)
             .to_string();
+        let pool_name = match chosen_pool {
+            Some(selected) => {
+                debug!(
+                    "client {} asked for database {pool_name}, using pool {selected} \
+                     from its startup parameters",
+                    transport.peer_display()
+                );
+                selected
+            }
+            None => pool_name,
+        };
 
         let application_name = match parameters.get("application_name") {
             Some(application_name) => application_name,
@@ -240,6 +349,7 @@ where
             &pool_name,
             transport.peer_display().as_str(),
         );
+        client_identifier.secure_transport = transport.is_tls() || transport.is_unix();
         client_identifier.hba_md5 =
             check_hba(&transport, "md5", username_from_parameters, &pool_name);
         client_identifier.hba_scram = check_hba(
@@ -253,6 +363,7 @@ where
             let hba_ok = client_identifier.hba_md5 == CheckResult::Allow
                 || client_identifier.hba_scram == CheckResult::Allow;
             if username_from_parameters == TALOS_USERNAME && hba_ok {
+                require_tls_for_plain_auth(&mut write, &client_identifier, "Talos").await?;
                 plain_password_challenge(&mut write).await?;
                 let talos_token_response = read_password(&mut read).await?;
                 let talos_token_with_nul = match str::from_utf8(&talos_token_response) {
@@ -300,6 +411,7 @@ where
                 let token = match extract_talos_token(talos_token, talos_databases).await {
                     Ok(token) => token,
                     Err(err) => {
+                        crate::web::metrics::record_auth_failure("bad_password", None);
                         error_response_terminal(
                             &mut write,
                             format!("Invalid Talos token: {err:?}").as_str(),
@@ -321,6 +433,20 @@ where
             .count()
             == 1;
 
+        if !transport.serves(&pool_name) {
+            error_response_terminal(
+                &mut write,
+                &format!("database \"{pool_name}\" is not served on this listener"),
+                "28000",
+            )
+            .await?;
+            crate::web::metrics::record_listener_rejection("listener_database");
+            return Err(Error::ClientError(format!(
+                "client {} asked for database {pool_name}, which its listener does not serve",
+                transport.peer_display()
+            )));
+        }
+
         // Kick any client that's not admin while we're in admin-only mode.
         if !admin && admin_only {
             error_response_terminal(
@@ -351,6 +477,7 @@ where
             )
                 .await?;
             crate::web::metrics::record_listener_rejection("hba");
+            crate::web::metrics::record_auth_failure("hba_reject", None);
             return Err(Error::HbaForbiddenError(format!(
                 "Connection not permitted by HBA configuration for client: {} from {}",
                 client_identifier,
@@ -358,6 +485,23 @@ where
             )));
         }
 
+        // The tag is checked now, its limit only once the client has
+        // authenticated.
+        let tag = if admin {
+            None
+        } else {
+            match chosen_tag {
+                Ok(tag) => tag,
+                Err(err) => {
+                    error_response_terminal(&mut write, &err, "08P01").await?;
+                    return Err(Error::ClientError(format!(
+                        "client {} rejected: {err}",
+                        transport.peer_display()
+                    )));
+                }
+            }
+        };
+
         // Derive process_id for Cancel Protocol from monotonic connection_id.
         // Wrapping is intentional: PostgreSQL uses 32-bit PIDs with the same
         // wrapping behavior. Sequential values give fewer collisions than random
@@ -366,6 +510,34 @@ where
         let process_id: i32 = connection_id as i32;
         let secret_key: i32 = rand::random();
 
+        // Wait for an authentication slot; the admin console skips the
+        // queue so operators can get in during a reconnect storm.
+        let login_slot = if admin {
+            None
+        } else {
+            let config = crate::config::config_arc();
+            let (max_active, max_waiting) = (
+                config.general.max_concurrent_logins,
+                config.general.max_login_queue,
+            );
+            match LoginQueue::enter(max_active, max_waiting).await {
+                Some(slot) => Some(slot),
+                None => {
+                    error_response_terminal(
+                        &mut write,
+                        "too many clients are logging in, try again later",
+                        "53300",
+                    )
+                    .await?;
+                    crate::web::metrics::record_listener_rejection("login_queue_full");
+                    return Err(Error::ClientError(format!(
+                        "client {} rejected: login queue is full (max_login_queue={max_waiting})",
+                        transport.peer_display()
+                    )));
+                }
+            }
+        };
+
         // Authenticate user
         let auth_outcome = authenticate(
             &mut read,
@@ -375,7 +547,44 @@ where
             &pool_name,
             username_from_parameters,
         )
-        .await?;
+        .await
+        .inspect_err(|err| {
+            // Unix socket clients have no address to ban.
+            let tcp = matches!(transport, ClientTransport::Tcp { .. });
+            if tcp && crate::stats::events::login_failure_reason(err) == Some("auth_failure") {
+                crate::auth::ban::record_failure(addr.ip());
+            }
+        })?;
+        drop(login_slot);
+        if !admin {
+            crate::pool::autodb::touch(&pool_name);
+        }
+        let client_tag = match tag {
+            Some(tag) => {
+                let config = crate::config::config_arc();
+                match super::tags::join(&config, &pool_name, tag.clone()) {
+                    Ok(client_tag) => Some(client_tag),
+                    Err(limit) => {
+                        error_response_terminal(
+                            &mut write,
+                            &format!("too many clients with tag \"{tag}\" in pool \"{pool_name}\""),
+                            "53300",
+                        )
+                        .await?;
+                        return Err(Error::ClientError(format!(
+                            "client {} rejected: tag {tag} has {limit} clients in pool \
+                             {pool_name} (client_tag_limits)",
+                            transport.peer_display()
+                        )));
+                    }
+                }
+            }
+            None => None,
+        };
+        let admin_read_only = admin
+            && crate::config::config_arc()
+                .general
+                .is_stats_user(&client_identifier.username);
         let transaction_mode = auth_outcome.transaction_mode;
         let mut server_parameters = auth_outcome.server_parameters;
         let prepared_statements_enabled = auth_outcome.prepared_statements_enabled;
@@ -411,27 +620,74 @@ where
             key_data.put_i32(process_id);
             key_data.put_i32(secret_key);
             buf.put(key_data);
+            if !admin {
+                let info = crate::config::connect_notice::ConnectInfo {
+                    database: &pool_name,
+                    user: &client_identifier.username,
+                    pool_mode: if transaction_mode {
+                        "transaction"
+                    } else {
+                        "session"
+                    },
+                    peer: match transport {
+                        ClientTransport::Tcp { peer, .. } => Some(peer),
+                        ClientTransport::Unix => None,
+                    },
+                };
+                let config = get_config();
+                if let Some(notice) =
+                    crate::config::connect_notice::for_pool(&config, &pool_name, &info)
+                {
+                    buf.put(crate::messages::notice_message(&notice));
+                }
+            }
             buf.put(ready_for_query(false));
         }
         write_all_flush(&mut write, &buf).await?;
 
-        let stats = Arc::new(ClientStats::new(
-            connection_id,
-            client_identifier.application_name.as_str(),
-            client_identifier.username.as_str(),
-            &pool_name,
-            addr.to_string().as_str(),
-            crate::utils::clock::now(),
-            use_tls,
-        ));
+        let stats = Arc::new(
+            ClientStats::new(
+                connection_id,
+                client_identifier.application_name.as_str(),
+                client_identifier.username.as_str(),
+                &pool_name,
+                addr.to_string().as_str(),
+                crate::utils::clock::now(),
+                use_tls,
+            )
+            .with_tag(client_tag.as_ref().map_or("", |tag| tag.tag())),
+        );
 
         let config = get_config();
         let anon_cache_size =
             crate::pool::resolve_client_anon_cache_size(&pool_name, &config.general);
+        let backend_application_name = crate::config::application_name_template::for_pool(
+            &config,
+            &pool_name,
+            &crate::config::application_name_template::ClientIdentity {
+                application_name: &client_identifier.application_name,
+                peer: (!transport.is_unix()).then_some(addr),
+                user: &client_identifier.username,
+                database: &pool_name,
+            },
+        );
+        let fault_injection = crate::client::fault::for_pool(&config, &pool_name);
+        let max_query_time = crate::client::max_query_time::for_user(
+            &config,
+            &pool_name,
+            &client_identifier.username,
+        );
+        let checkout_quotas = crate::client::checkout_quota::for_client(
+            &config,
+            &pool_name,
+            &client_identifier.application_name,
+            client_tag.as_ref().map(|tag| tag.tag()),
+        );
         Ok(Client {
             read: BufReader::new(read),
             write,
             addr_str: addr.to_string(),
+            listener,
             addr,
             read_buf: BytesMut::with_capacity(8192),
             buffer: PooledBuffer::new(),
@@ -442,16 +698,39 @@ where
             client_server_map,
             stats,
             admin,
+            admin_read_only,
             last_server_stats: None,
             connected_to_server: false,
             session_xact_start: None,
             pool_name,
             username: std::mem::take(&mut client_identifier.username),
+            startup_parameters: server_parameters.clone(),
             server_parameters,
+            backend_application_name,
             prepared: PreparedStatementState::new(prepared_statements_enabled, anon_cache_size),
             client_last_messages_in_tx: PooledBuffer::new(),
             max_memory_usage: config.general.max_memory_usage.as_bytes(),
+            max_client_message_size: config.general.max_client_message_size.as_bytes() as i32,
+            max_pipeline_depth: config.general.max_pipeline_depth,
+            pipeline_error: None,
+            disconnect_reason: None,
+            client_idle_timeout: Some(config.general.client_idle_timeout.as_std())
+                .filter(|t| !t.is_zero()),
+            client_write_timeout: Some(config.general.client_write_timeout.as_std())
+                .filter(|t| !t.is_zero()),
+            auto_session_pinning: config.general.auto_session_pinning,
+            two_phase_commit: transaction_mode.then_some(config.general.two_phase_commit),
+            fault_injection,
+            max_query_time,
+            driver_compat: config
+                .pools
+                .get(&pool_name)
+                .and_then(|pool| pool.driver_compat),
+            client_tag,
+            checkout_quotas,
+            pending_two_phase: None,
             client_pending_begin: None,
+            shard_pool: None,
             #[cfg(unix)]
             raw_fd,
             #[cfg(all(unix, feature = "tls-migration"))]
@@ -467,6 +746,14 @@ where
         mut bytes: BytesMut, // The rest of the startup message.
         client_server_map: ClientServerMap,
     ) -> Result<Client<S, T>, Error> {
+        // pg_doorman hands out 4-byte keys under every protocol version, so
+        // a longer (protocol 3.2) key can't be one of ours.
+        if bytes.remaining() != 8 {
+            return Err(Error::ProtocolSyncError(format!(
+                "cancel request from {addr} has a {} byte key, expected 8",
+                bytes.remaining()
+            )));
+        }
         let target_process_id = bytes.get_i32();
         let target_secret_key = bytes.get_i32();
         // In cancel mode, connection_id stores the target's process_id for lookup.
@@ -474,6 +761,8 @@ where
             read: BufReader::new(read),
             write,
             addr_str: addr.to_string(),
+            // Cancel requests never reach the message loop.
+            listener: "tcp",
             addr,
             read_buf: BytesMut::with_capacity(8192),
             connection_id: target_process_id as u64,
@@ -484,16 +773,34 @@ where
             client_server_map,
             stats: Arc::new(ClientStats::default()),
             admin: false,
+            admin_read_only: false,
             last_server_stats: None,
             pool_name: String::from("undefined"),
             username: String::from("undefined"),
             server_parameters: ServerParameters::new(),
+            startup_parameters: ServerParameters::new(),
+            backend_application_name: None,
             prepared: PreparedStatementState::default(),
             connected_to_server: false,
             session_xact_start: None,
             client_last_messages_in_tx: PooledBuffer::new(),
             max_memory_usage: 128 * 1024 * 1024,
+            max_client_message_size: crate::messages::MAX_MESSAGE_SIZE,
+            max_pipeline_depth: 0,
+            pipeline_error: None,
+            disconnect_reason: None,
+            client_idle_timeout: None,
+            client_write_timeout: None,
+            auto_session_pinning: false,
+            two_phase_commit: None,
+            fault_injection: None,
+            max_query_time: None,
+            driver_compat: None,
+            client_tag: None,
+            checkout_quotas: Vec::new(),
+            pending_two_phase: None,
             client_pending_begin: None,
+            shard_pool: None,
             #[cfg(unix)]
             raw_fd: None,
             #[cfg(all(unix, feature = "tls-migration"))]
@@ -0,0 +1,92 @@
+//! Matching of queries against the pool's `statement_deny` and
+//! `statement_allow` rules (see `crate::config::StatementRules`).
+
+use crate::config::{StatementRule, StatementRules};
+
+use super::session_pin::{is, Words};
+
+/// The deny rule a statement of `query` matches, unless an allow rule
+/// matches the same statement.
+pub(crate) fn denied_by<'a>(rules: &'a StatementRules, query: &[u8]) -> Option<&'a str> {
+    let mut statement: Vec<&[u8]> = Vec::new();
+    let mut words = Words::new(query);
+    loop {
+        let word = words.next();
+        if let Some(word) = word.filter(|w| *w != b";") {
+            statement.push(word);
+            continue;
+        }
+        if let Some(rule) = rules.deny.iter().find(|r| matches(r, &statement)) {
+            if !rules.allow.iter().any(|r| matches(r, &statement)) {
+                return Some(&rule.text);
+            }
+        }
+        word?;
+        statement.clear();
+    }
+}
+
+/// Whether the segments of `rule` occur in `statement` in order.
+pub(crate) fn matches(rule: &StatementRule, statement: &[&[u8]]) -> bool {
+    let mut rest = statement;
+    for segment in &rule.segments {
+        let found = rest
+            .windows(segment.len())
+            .position(|window| window.iter().zip(segment).all(|(word, k)| is(word, k)));
+        match found {
+            Some(i) => rest = &rest[i + segment.len()..],
+            None => return false,
+        }
+    }
+    true
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn rules(deny: &[&str], allow: &[&str]) -> StatementRules {
+        let owned = |rules: &[&str]| rules.iter().map(|r| r.to_string()).collect::<Vec<_>>();
+        StatementRules::compile(&owned(deny), &owned(allow))
+            .unwrap()
+            .unwrap()
+    }
+
+    #[test]
+    fn deny_rules_match_keyword_sequences() {
+        let rules = rules(&["DROP DATABASE", "TRUNCATE", "COPY ... TO PROGRAM"], &[]);
+        assert_eq!(
+            denied_by(&rules, b"drop  database shop"),
+            Some("DROP DATABASE")
+        );
+        assert_eq!(denied_by(&rules, b"select 1; TRUNCATE t"), Some("TRUNCATE"));
+        assert_eq!(
+            denied_by(&rules, b"COPY t (a, b) TO PROGRAM 'gzip > /tmp/t'"),
+            Some("COPY ... TO PROGRAM")
+        );
+        assert_eq!(denied_by(&rules, b"COPY t TO STDOUT"), None);
+        assert_eq!(denied_by(&rules, b"DROP TABLE database"), None);
+    }
+
+    #[test]
+    fn literals_comments_and_statement_boundaries_do_not_match() {
+        let rules = rules(&["DROP DATABASE", "COPY ... TO PROGRAM"], &[]);
+        assert_eq!(denied_by(&rules, b"select 'drop database x'"), None);
+        assert_eq!(denied_by(&rules, b"select 1 /* drop database */"), None);
+        assert_eq!(
+            denied_by(&rules, b"copy t from stdin; select 'to' program"),
+            None
+        );
+    }
+
+    #[test]
+    fn allow_rules_are_exceptions() {
+        let rules = rules(&["DROP"], &["DROP TABLE ... tmp_report"]);
+        assert_eq!(denied_by(&rules, b"DROP TABLE IF EXISTS tmp_report"), None);
+        assert_eq!(denied_by(&rules, b"DROP TABLE orders"), Some("DROP"));
+        assert_eq!(
+            denied_by(&rules, b"DROP TABLE tmp_report; DROP TABLE orders"),
+            Some("DROP")
+        );
+    }
+}
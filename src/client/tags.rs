@@ -0,0 +1,213 @@
+//! Client tags (`general.client_tag_parameter`).
+//!
+//! Deployments sharing one database user look the same to per-user limits
+//! and metrics. A client can tag its connection, e.g. with
+//! `options='-c doorman.tag=batch'`; the pool's `client_tag_limits` then
+//! caps how many clients of each listed tag it accepts at once (0: no cap),
+//! and the clients and transactions of every tag are counted per pool.
+//! Tags a pool does not list share the uncapped `other` group, so the
+//! label set of the metrics is bounded by the config, not by the clients.
+
+use std::collections::HashMap;
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::sync::Arc;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use crate::config::{valid_client_tag, Config};
+
+use super::util::startup_options_setting;
+
+/// Group of the tags a pool does not list in `client_tag_limits`.
+pub(crate) const OTHER: &str = "other";
+
+/// Clients of one tag group in one pool.
+struct Group {
+    clients: AtomicU32,
+    connections: prometheus::IntGauge,
+    transactions: prometheus::IntCounter,
+}
+
+/// Tag groups by (pool, tag or `other`).
+static GROUPS: Lazy<Mutex<HashMap<(String, String), Arc<Group>>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// A client's place in its tag group, given back when the client goes.
+pub(crate) struct ClientTag {
+    tag: String,
+    group: Arc<Group>,
+}
+
+impl ClientTag {
+    /// The tag as the client sent it.
+    pub(crate) fn tag(&self) -> &str {
+        &self.tag
+    }
+
+    /// The client completed a transaction.
+    pub(crate) fn transaction(&self) {
+        self.group.transactions.inc();
+    }
+}
+
+impl Drop for ClientTag {
+    fn drop(&mut self) {
+        self.group.clients.fetch_sub(1, Ordering::Relaxed);
+        self.group.connections.dec();
+    }
+}
+
+/// Tag the client set with `general.client_tag_parameter`, on its own or
+/// with `-c` in `options`; an empty value leaves the client untagged.
+/// A parameter of its own is removed, so it never reaches PostgreSQL.
+/// Errs on a value that can't be a tag.
+pub(crate) fn from_startup(
+    config: &Config,
+    parameters: &mut HashMap<String, String>,
+) -> Result<Option<String>, String> {
+    let Some(name) = config.general.client_tag_parameter.as_deref() else {
+        return Ok(None);
+    };
+    let Some(tag) = parameters
+        .remove(name)
+        .or_else(|| startup_options_setting(parameters.get("options")?, name))
+        .filter(|tag| !tag.is_empty())
+    else {
+        return Ok(None);
+    };
+    if !valid_client_tag(&tag) {
+        return Err(format!(
+            "invalid {name} {tag:?}: a tag is 1 to 63 ASCII letters, digits, '_', '-' or '.'"
+        ));
+    }
+    Ok(Some(tag))
+}
+
+/// Join the group of `tag` in `pool_name`. Fails with the group's limit
+/// when it already has that many clients.
+pub(crate) fn join(config: &Config, pool_name: &str, tag: String) -> Result<ClientTag, u32> {
+    let (group, label, limit) = group(config, pool_name, &tag);
+    let clients = group.clients.fetch_add(1, Ordering::Relaxed);
+    if limit > 0 && clients >= limit {
+        group.clients.fetch_sub(1, Ordering::Relaxed);
+        crate::web::metrics::record_client_tag_rejected(pool_name, label);
+        return Err(limit);
+    }
+    group.connections.inc();
+    Ok(ClientTag { tag, group })
+}
+
+/// Join the group of `tag` in `pool_name` regardless of its limit, for a
+/// client that was admitted before it migrated to this process.
+pub(crate) fn rejoin(config: &Config, pool_name: &str, tag: String) -> ClientTag {
+    let (group, _, _) = group(config, pool_name, &tag);
+    group.clients.fetch_add(1, Ordering::Relaxed);
+    group.connections.inc();
+    ClientTag { tag, group }
+}
+
+/// The group of `tag` in `pool_name`, its label and its limit.
+fn group<'a>(config: &Config, pool_name: &str, tag: &'a str) -> (Arc<Group>, &'a str, u32) {
+    let limit = config
+        .pools
+        .get(pool_name)
+        .and_then(|pool| pool.client_tag_limits.get(tag).copied());
+    let label = if limit.is_some() { tag } else { OTHER };
+    let group = GROUPS
+        .lock()
+        .entry((pool_name.to_string(), label.to_string()))
+        .or_insert_with(|| {
+            let (connections, transactions) =
+                crate::web::metrics::client_tag_series(pool_name, label);
+            Arc::new(Group {
+                clients: AtomicU32::new(0),
+                connections,
+                transactions,
+            })
+        })
+        .clone();
+    (group, label, limit.unwrap_or(0))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn config(limits: &[(&str, u32)]) -> Config {
+        let mut pool = crate::config::Pool::default();
+        for (tag, limit) in limits {
+            pool.client_tag_limits.insert(tag.to_string(), *limit);
+        }
+        let mut config = Config::default();
+        config.pools.insert("tags_db".into(), pool);
+        config
+    }
+
+    fn params(pairs: &[(&str, &str)]) -> HashMap<String, String> {
+        pairs
+            .iter()
+            .map(|(key, value)| (key.to_string(), value.to_string()))
+            .collect()
+    }
+
+    #[test]
+    fn tag_is_read_from_startup_parameters() {
+        let mut config = Config::default();
+        config.general.client_tag_parameter = Some("doorman.tag".into());
+        let tag = |pairs: &[(&str, &str)]| from_startup(&config, &mut params(pairs));
+        assert_eq!(
+            tag(&[("options", "-c doorman.tag=batch")]),
+            Ok(Some("batch".into()))
+        );
+        assert_eq!(tag(&[("doorman.tag", "web-1")]), Ok(Some("web-1".into())));
+        assert_eq!(tag(&[("options", "-c doorman.tag=")]), Ok(None));
+        assert_eq!(tag(&[]), Ok(None));
+        assert!(tag(&[("doorman.tag", "bad tag")]).is_err());
+
+        let mut parameters = params(&[("doorman.tag", "web"), ("application_name", "app")]);
+        assert_eq!(
+            from_startup(&config, &mut parameters),
+            Ok(Some("web".into()))
+        );
+        assert_eq!(parameters, params(&[("application_name", "app")]));
+
+        config.general.client_tag_parameter = None;
+        assert_eq!(
+            from_startup(&config, &mut params(&[("doorman.tag", "web")])),
+            Ok(None)
+        );
+    }
+
+    #[test]
+    fn limit_applies_per_tag_and_frees_on_drop() {
+        let config = config(&[("batch", 2), ("web", 0)]);
+        let first = join(&config, "tags_db", "batch".into()).unwrap();
+        let _second = join(&config, "tags_db", "batch".into()).unwrap();
+        assert_eq!(join(&config, "tags_db", "batch".into()).err(), Some(2));
+        let _web = join(&config, "tags_db", "web".into()).unwrap();
+        drop(first);
+        assert!(join(&config, "tags_db", "batch".into()).is_ok());
+        // A migrated client keeps its tag even over the limit.
+        let migrated = rejoin(&config, "tags_db", "batch".into());
+        assert_eq!(migrated.tag(), "batch");
+        assert_eq!(migrated.group.clients.load(Ordering::Relaxed), 3);
+    }
+
+    #[test]
+    fn unlisted_tags_share_the_uncapped_other_group() {
+        let mut config = config(&[("batch", 1)]);
+        let pool = config.pools.remove("tags_db").unwrap();
+        config.pools.insert("other_db".into(), pool);
+        let tags: Vec<_> = (0..3)
+            .map(|i| join(&config, "other_db", format!("canary{i}")).unwrap())
+            .collect();
+        assert_eq!(tags[1].tag(), "canary1");
+        let group = GROUPS
+            .lock()
+            .get(&("other_db".to_string(), OTHER.to_string()))
+            .cloned()
+            .unwrap();
+        assert_eq!(group.clients.load(Ordering::Relaxed), 3);
+    }
+}
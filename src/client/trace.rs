@@ -0,0 +1,187 @@
+//! Per-client protocol trace, toggled at runtime by
+//! `TRACE CLIENT <id> ON [PAYLOAD]` and `TRACE CLIENT <id> OFF`.
+//!
+//! A traced client gets one info-level line per protocol message it sends
+//! or receives, with the message type, length and the backend round trip
+//! time, so a single misbehaving service can be debugged without raising
+//! `log_level` for the whole pooler. With `PAYLOAD` the leading bytes of
+//! each message body are logged in hex as well; they carry query text and
+//! bind values, so the mode is off unless asked for.
+//!
+//! Messages larger than `max_message_size` are streamed from the backend
+//! straight to the client and do not pass through the trace.
+
+use std::time::Duration;
+
+use log::info;
+
+use crate::client::core::Client;
+use crate::client::violation::hex_prefix;
+use crate::stats::client::{CLIENT_TRACE_OFF, CLIENT_TRACE_PAYLOAD};
+
+/// Bytes of each message body logged in `PAYLOAD` mode.
+const PAYLOAD_BYTES: usize = 256;
+
+/// Messages logged per buffer. A large result set arrives as thousands of
+/// DataRows in one buffer; the rest are summed up in a single line.
+const MAX_MESSAGES_PER_BUFFER: usize = 64;
+
+/// Direction of a traced buffer, as shown in the log line.
+pub(crate) const FROM_CLIENT: &str = "client ->";
+pub(crate) const TO_SERVER: &str = "-> server";
+pub(crate) const TO_CLIENT: &str = "client <-";
+
+/// One line per protocol message in `buffer`: type, length and, with
+/// `payload`, the leading body bytes in hex. A message cut off at the end
+/// of the buffer is reported with the bytes present.
+fn describe_messages(buffer: &[u8], payload: bool) -> Vec<String> {
+    let mut lines = Vec::new();
+    let mut pos = 0;
+    let mut skipped = 0usize;
+    let mut skipped_bytes = 0usize;
+    while pos + 5 <= buffer.len() {
+        let code = buffer[pos];
+        let len = i32::from_be_bytes([
+            buffer[pos + 1],
+            buffer[pos + 2],
+            buffer[pos + 3],
+            buffer[pos + 4],
+        ]);
+        if !code.is_ascii_graphic() || len < 4 {
+            lines.push(format!(
+                "unparsable data at offset {pos}: {}",
+                hex_prefix(&buffer[pos..], 16)
+            ));
+            return lines;
+        }
+        let end = pos + 1 + len as usize;
+        if lines.len() >= MAX_MESSAGES_PER_BUFFER {
+            skipped += 1;
+            skipped_bytes += end.min(buffer.len()) - pos;
+            pos = end;
+            continue;
+        }
+        let body = &buffer[pos + 5..end.min(buffer.len())];
+        let mut line = format!("{} len={len}", code as char);
+        if end > buffer.len() {
+            line.push_str(&format!(" (truncated, {} bytes in buffer)", body.len() + 5));
+        }
+        if payload && !body.is_empty() {
+            line.push_str(": ");
+            line.push_str(&hex_prefix(body, PAYLOAD_BYTES));
+        }
+        lines.push(line);
+        pos = end;
+    }
+    if skipped > 0 {
+        lines.push(format!(
+            "... {skipped} more messages, {skipped_bytes} bytes"
+        ));
+    }
+    lines
+}
+
+impl<S, T> Client<S, T> {
+    /// Logs the messages in `buffer` when this client is traced.
+    /// `sent_at` is when the request went to the backend; responses carry
+    /// the time elapsed since then.
+    #[inline(always)]
+    pub(crate) fn trace(
+        &self,
+        direction: &'static str,
+        buffer: &[u8],
+        sent_at: Option<quanta::Instant>,
+    ) {
+        let level = self.stats.trace();
+        if level == CLIENT_TRACE_OFF {
+            return;
+        }
+        self.trace_slow(direction, buffer, sent_at, level == CLIENT_TRACE_PAYLOAD);
+    }
+
+    #[cold]
+    fn trace_slow(
+        &self,
+        direction: &'static str,
+        buffer: &[u8],
+        sent_at: Option<quanta::Instant>,
+        payload: bool,
+    ) {
+        let elapsed = sent_at
+            .map(|at| format!(" +{}", format_micros(at.elapsed())))
+            .unwrap_or_default();
+        for line in describe_messages(buffer, payload) {
+            info!(
+                "[{}@{} #c{}] trace {direction} {line}{elapsed}",
+                self.username, self.pool_name, self.connection_id
+            );
+        }
+    }
+}
+
+/// `1.234ms`: round trips of interest are well under a second, and
+/// `format_elapsed` rounds them down to whole milliseconds.
+fn format_micros(elapsed: Duration) -> String {
+    let micros = elapsed.as_micros();
+    format!("{}.{:03}ms", micros / 1000, micros % 1000)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn message(code: u8, body: &[u8]) -> Vec<u8> {
+        let mut buf = vec![code];
+        buf.extend_from_slice(&((body.len() + 4) as i32).to_be_bytes());
+        buf.extend_from_slice(body);
+        buf
+    }
+
+    #[test]
+    fn describes_each_message() {
+        let mut buf = message(b'Q', b"SELECT 1\0");
+        buf.extend(message(b'Z', b"I"));
+        assert_eq!(describe_messages(&buf, false), vec!["Q len=13", "Z len=5"]);
+        assert_eq!(
+            describe_messages(&buf, true),
+            vec!["Q len=13: 53 45 4c 45 43 54 20 31 00", "Z len=5: 49"]
+        );
+    }
+
+    #[test]
+    fn reports_truncated_message() {
+        let mut buf = message(b'D', &[0; 20]);
+        buf.truncate(10);
+        assert_eq!(
+            describe_messages(&buf, false),
+            vec!["D len=24 (truncated, 10 bytes in buffer)"]
+        );
+    }
+
+    #[test]
+    fn caps_messages_per_buffer() {
+        let buf: Vec<u8> = (0..MAX_MESSAGES_PER_BUFFER + 3)
+            .flat_map(|_| message(b'D', b"xy"))
+            .collect();
+        let lines = describe_messages(&buf, false);
+        assert_eq!(lines.len(), MAX_MESSAGES_PER_BUFFER + 1);
+        assert_eq!(lines.last().unwrap(), "... 3 more messages, 21 bytes");
+    }
+
+    #[test]
+    fn stops_on_garbage() {
+        let lines = describe_messages(&[0x00, 0x00, 0x00, 0x00, 0x08, 0x01], false);
+        assert_eq!(lines.len(), 1);
+        assert!(
+            lines[0].starts_with("unparsable data at offset 0"),
+            "{}",
+            lines[0]
+        );
+    }
+
+    #[test]
+    fn formats_micros() {
+        assert_eq!(format_micros(Duration::from_micros(1234)), "1.234ms");
+        assert_eq!(format_micros(Duration::from_micros(42)), "0.042ms");
+    }
+}
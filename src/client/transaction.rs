@@ -1,4 +1,4 @@
-use bytes::{BufMut, BytesMut};
+use bytes::{BufMut, Bytes, BytesMut};
 use log::{debug, error, info, warn};
 use std::future::{poll_fn, Future};
 use std::ops::DerefMut;
@@ -9,22 +9,37 @@ use std::time::Duration;
 use crate::utils::clock::now;
 
 use crate::admin::handle_admin;
+use crate::app::audit_log::{self, AuditRecord};
 use crate::app::server::{
     CLIENTS_IN_TRANSACTIONS, MIGRATION_IN_PROGRESS, MIGRATION_TX, SHUTDOWN_IN_PROGRESS,
 };
+use crate::client::audit;
 use crate::client::batch_handling::PARSE_COMPLETE_MSG;
+use crate::client::checkout_quota;
 use crate::client::core::{BatchOperation, Client, PreparedStatementKey};
-use crate::client::util::{is_standalone_begin, QUERY_DEALLOCATE};
+use crate::client::fault::Fault;
+use crate::client::max_query_time::MaxQueryTime;
+use crate::client::read_only;
+use crate::client::rewrite;
+use crate::client::session_pin;
+use crate::client::statement_rules;
+use crate::client::trace;
+use crate::client::two_phase::{self, TwoPhaseCommand};
+use crate::client::util::{discard_command, is_standalone_begin, Discard, QUERY_DEALLOCATE};
+use crate::client::violation;
+use crate::config::{get_config, CompiledRewrite, DriverCompat, TwoPhaseCommit};
 use crate::errors::Error;
 use crate::messages::{
-    deallocate_response, ends_with_idle_ready_for_query, error_response, error_response_terminal,
-    has_error_response, insert_close_complete_after_last_close_complete, read_message_reuse,
-    write_all_flush,
+    command_complete, deallocate_response, ends_with_idle_ready_for_query, error_response,
+    error_response_terminal, has_error_response, insert_close_complete_after_last_close_complete,
+    read_message_reuse, ready_for_query, write_all_flush, write_all_flush_progress,
 };
-use crate::pool::CANCELED_PIDS;
+use crate::pool::{ConnectionPool, CANCELED_PIDS};
 use crate::server::Server;
+use crate::stats::events;
 use crate::utils::buffering_writer::BufferingWriter;
 use crate::utils::debug_messages::{log_client_to_server, log_server_to_client};
+use crate::utils::strings::truncate_query_for_log;
 use crate::web::metrics::{POOLER_CHECK_QUERY_BACKEND_TOTAL, POOLER_CHECK_QUERY_CACHE_TOTAL};
 
 // =============================================================================
@@ -137,6 +152,14 @@ use crate::web::metrics::{POOLER_CHECK_QUERY_BACKEND_TOTAL, POOLER_CHECK_QUERY_C
 /// When the buffer reaches this size, it will be flushed to avoid excessive memory usage.
 const BUFFER_FLUSH_THRESHOLD: usize = 8192;
 
+/// Pause before the n-th `server_checkout_retries` retry: n times this, up
+/// to [`CHECKOUT_RETRY_BACKOFF_MAX`]. Gives a restarting backend or a host
+/// failover a moment instead of hammering it.
+const CHECKOUT_RETRY_BACKOFF: Duration = Duration::from_millis(20);
+
+/// Longest pause between checkout retries.
+const CHECKOUT_RETRY_BACKOFF_MAX: Duration = Duration::from_millis(200);
+
 /// RAII guard for CLIENTS_IN_TRANSACTIONS counter.
 /// Increments on creation, decrements on drop.
 struct TransactionGuard;
@@ -158,6 +181,8 @@ impl Drop for TransactionGuard {
 enum NextClientMessage {
     Message(BytesMut),
     ServerDead,
+    /// Session-mode client idle outside a transaction past `client_idle_timeout`.
+    IdleTimeout,
 }
 
 /// Action to take after processing a message in the transaction loop
@@ -168,6 +193,56 @@ enum TransactionAction {
     Break,
 }
 
+/// Send the SimpleQuery `message` on an idle backend checked out of
+/// `pool` and return the whole response. `what` names the caller in errors
+/// and in the reason a failed backend is marked bad with.
+pub(super) async fn idle_backend_round_trip(
+    pool: &ConnectionPool,
+    message: &BytesMut,
+    what: &str,
+) -> Result<BytesMut, Error> {
+    let mut conn = pool
+        .database
+        .get()
+        .await
+        .map_err(|e| Error::ClientError(format!("{what}: failed to acquire backend: {e}")))?;
+
+    if let Err(err) = conn.checkin_cleanup().await {
+        conn.mark_bad(&format!("{what}: checkin_cleanup failed: {err}"));
+        return Err(err);
+    }
+
+    if let Err(err) = conn.send_and_flush(message).await {
+        conn.mark_bad(&format!("{what}: send failed: {err}"));
+        return Err(err);
+    }
+
+    // Server::recv must be drained in a loop until is_data_available()
+    // is false; otherwise responses larger than BUFFER_FLUSH_THRESHOLD
+    // leave bytes in the backend socket and the next checked-out client
+    // reads a desynced stream.
+    let mut response = BytesMut::new();
+    loop {
+        let mut overflow_buf = BytesMut::new();
+        let writer = BufferingWriter::new(&mut overflow_buf);
+        let chunk = match conn.recv(writer, None).await {
+            Ok(chunk) => chunk,
+            Err(err) => {
+                conn.mark_bad(&format!("{what}: recv failed: {err}"));
+                return Err(err);
+            }
+        };
+        response.extend_from_slice(&chunk);
+        if !overflow_buf.is_empty() {
+            response.extend_from_slice(&overflow_buf);
+        }
+        if !conn.is_data_available() {
+            break;
+        }
+    }
+    Ok(response)
+}
+
 impl<S, T> Client<S, T>
 where
     S: tokio::io::AsyncRead + std::marker::Unpin,
@@ -182,7 +257,17 @@ where
             return false;
         }
 
+        if self.pending_two_phase.is_some() {
+            self.settle_two_phase(server);
+        }
+        if self.prepared.server_resets_before.is_some() {
+            self.settle_prepared_resets(server);
+        }
+
         self.stats.transaction();
+        if let Some(tag) = &self.client_tag {
+            tag.transaction();
+        }
         server
             .stats
             .transaction(self.server_parameters.get_application_name());
@@ -202,6 +287,212 @@ where
         false
     }
 
+    /// Leave transaction mode for the rest of the session when the statement
+    /// creates backend-local state (`auto_session_pinning`). Called before the
+    /// statement reaches the server, so the current transaction is not
+    /// released on its ReadyForQuery.
+    fn pin_session_if_needed(&mut self, message: &[u8], server: &mut Server) {
+        if !self.transaction_mode || !self.auto_session_pinning {
+            return;
+        }
+        let query = session_pin::statement_text(message);
+        let Some(reason) = session_pin::session_state_reason(query) else {
+            return;
+        };
+        self.transaction_mode = false;
+        server.mark_session_state();
+        info!(
+            "[{}@{} #c{}] pinned to server pid={} until disconnect: {}",
+            self.username,
+            self.pool_name,
+            self.connection_id,
+            server.get_process_id(),
+            reason
+        );
+    }
+
+    /// Apply `two_phase_commit` to a two-phase statement before it reaches
+    /// the server. Returns true when PREPARE TRANSACTION is rejected and must
+    /// not be sent.
+    fn two_phase_rejected(&mut self, message: &[u8], server: &Server) -> bool {
+        let Some(policy) = self.two_phase_commit else {
+            return false;
+        };
+        let query = session_pin::statement_text(message);
+        let Some(command) = two_phase::two_phase_command(query) else {
+            return false;
+        };
+        if let TwoPhaseCommand::Prepare(gid) = &command {
+            if policy == TwoPhaseCommit::Reject {
+                warn!(
+                    "[{}@{} #c{}] PREPARE TRANSACTION '{}' rejected: two_phase_commit = reject",
+                    self.username, self.pool_name, self.connection_id, gid
+                );
+                return true;
+            }
+            if self.transaction_mode {
+                self.transaction_mode = false;
+                info!(
+                    "[{}@{} #c{}] pinned to server pid={} until disconnect: PREPARE TRANSACTION",
+                    self.username,
+                    self.pool_name,
+                    self.connection_id,
+                    server.get_process_id()
+                );
+            }
+        }
+        self.pending_two_phase = Some((command, server.two_phase_commands()));
+        false
+    }
+
+    /// The server is idle after a two-phase statement: record or forget the
+    /// prepared transaction if PostgreSQL completed the statement.
+    fn settle_two_phase(&mut self, server: &Server) {
+        let Some((command, before)) = self.pending_two_phase.take() else {
+            return;
+        };
+        if server.two_phase_commands() == before {
+            return;
+        }
+        match command {
+            TwoPhaseCommand::Prepare(gid) => two_phase::remember(two_phase::PreparedTransaction {
+                database: self.pool_name.clone(),
+                gid,
+                user: self.username.clone(),
+                client_addr: self.addr_str.clone(),
+                backend_pid: server.get_process_id(),
+                prepared_at: std::time::Instant::now(),
+            }),
+            TwoPhaseCommand::CommitPrepared(gid) | TwoPhaseCommand::RollbackPrepared(gid) => {
+                two_phase::forget(&self.pool_name, &gid)
+            }
+        }
+    }
+
+    /// The server is idle after a forwarded simple query: if it ran
+    /// DEALLOCATE ALL or DISCARD ALL (session mode, a batch, or inside a
+    /// transaction), drop the client's prepared statements as PostgreSQL did.
+    fn settle_prepared_resets(&mut self, server: &Server) {
+        let Some((pid, before)) = self.prepared.server_resets_before.take() else {
+            return;
+        };
+        if pid != server.get_process_id() || server.prepared_resets() == before {
+            return;
+        }
+        let count = self.prepared.cache.len();
+        self.prepared.cache.clear();
+        info!(
+            "[{}@{} #c{}] server pid={} reset prepared statements: cleared {} entries from client prepared statement cache",
+            self.username,
+            self.pool_name,
+            self.connection_id,
+            server.get_process_id(),
+            count
+        );
+    }
+
+    /// Error text and SQLSTATE for a statement the user's `read_only` or
+    /// the pool's `statement_deny` refuses, or None.
+    fn statement_rejection(
+        &self,
+        message: &[u8],
+        pool: &ConnectionPool,
+    ) -> Option<(String, &'static str)> {
+        let query = session_pin::statement_text(message);
+        if pool.settings.user.read_only {
+            let reason = if message.first() == Some(&b'F') {
+                Some("function call".to_string())
+            } else {
+                read_only::write_reason(query)
+            };
+            if let Some(reason) = reason {
+                warn!(
+                    "[{}@{} #c{}] {} rejected: user is read_only",
+                    self.username, self.pool_name, self.connection_id, reason
+                );
+                return Some((read_only::rejection(&reason), "25006"));
+            }
+        }
+        let rule = statement_rules::denied_by(pool.settings.statement_rules.as_deref()?, query)?;
+        warn!(
+            target: "pg_doorman::audit",
+            "statement denied: pool={} user={} client={} connection=#c{} rule=\"{}\" query={:?}",
+            self.pool_name,
+            self.username,
+            self.addr_str,
+            self.connection_id,
+            rule,
+            truncate_query_for_log(&String::from_utf8_lossy(query))
+        );
+        crate::web::metrics::record_statement_denied(&self.username, &self.pool_name);
+        Some((
+            format!(
+                "statement denied by pg_doorman rule \"{rule}\" of pool \"{}\"",
+                self.pool_name
+            ),
+            "42501",
+        ))
+    }
+
+    /// Write a Query or Parse to the audit log when it changes schema,
+    /// privileges or roles, or runs on a superuser backend.
+    fn audit(&self, message: &[u8], server: &Server) {
+        if !audit_log::enabled() {
+            return;
+        }
+        let query = session_pin::statement_text(message);
+        let class = audit::audit_class(query).or(server.is_superuser().then_some("superuser"));
+        let Some(class) = class else {
+            return;
+        };
+        audit_log::write(&AuditRecord {
+            class,
+            pool: &self.pool_name,
+            user: &self.username,
+            client_addr: &self.addr_str,
+            application_name: self.server_parameters.get_application_name(),
+            connection_id: self.connection_id,
+            backend_pid: server.get_process_id(),
+            statement: &String::from_utf8_lossy(query),
+        });
+    }
+
+    /// Apply the pool's `rewrite_rules` to a Query or Parse message.
+    fn rewrite(&self, rules: &[CompiledRewrite], message: BytesMut) -> BytesMut {
+        let Some(rewritten) = rewrite::rewrite_message(rules, &message) else {
+            return message;
+        };
+        let query = String::from_utf8_lossy(session_pin::statement_text(&rewritten));
+        debug!(
+            "[{}@{} #c{}] query rewritten: {}",
+            self.username,
+            self.pool_name,
+            self.connection_id,
+            truncate_query_for_log(&query)
+        );
+        crate::web::metrics::record_query_rewrite(&self.username, &self.pool_name);
+        rewritten
+    }
+
+    /// Answer a rejected simple query or function call: roll back the open
+    /// transaction, report the error and release the server.
+    async fn reject_statement(
+        &mut self,
+        server: &mut Server,
+        message: &str,
+        code: &str,
+    ) -> Result<TransactionAction, Error> {
+        if server.in_transaction() {
+            server.small_simple_query("ROLLBACK").await?;
+        }
+        error_response(&mut self.write, message, code).await?;
+        if self.complete_transaction_if_needed(server, false) {
+            self.stats.idle_read();
+            return Ok(TransactionAction::Break);
+        }
+        Ok(TransactionAction::Continue)
+    }
+
     /// Ensure server is in copy mode, return error if not
     #[inline(always)]
     fn ensure_copy_mode(&mut self, server: &mut Server) -> Result<(), Error> {
@@ -240,11 +531,18 @@ where
     ///    against `server_readable()`.  Detects dead servers (e.g.
     ///    `pg_terminate_backend`, `idle_in_transaction_session_timeout`) and
     ///    releases the pool slot early instead of holding it indefinitely.
+    ///    In session mode outside a transaction it also enforces
+    ///    `client_idle_timeout`.
     async fn wait_for_next_message(&mut self, server: &Server) -> Result<NextClientMessage, Error> {
+        let idle_deadline = self
+            .client_idle_timeout
+            .filter(|_| !self.transaction_mode && !server.in_transaction())
+            .map(|timeout| tokio::time::Instant::now() + timeout);
         let mut read_fut = std::pin::pin!(read_message_reuse(
             &mut self.read,
             &mut self.read_buf,
-            self.max_memory_usage
+            self.max_memory_usage,
+            self.max_client_message_size
         ));
 
         let instant = poll_fn(|cx| match read_fut.as_mut().poll(cx) {
@@ -261,6 +559,12 @@ where
             return result.map(NextClientMessage::Message);
         }
 
+        let mut idle = std::pin::pin!(async {
+            match idle_deadline {
+                Some(deadline) => tokio::time::sleep_until(deadline).await,
+                None => std::future::pending().await,
+            }
+        });
         loop {
             tokio::select! {
                 biased;
@@ -273,10 +577,47 @@ where
                     }
                     return Ok(NextClientMessage::ServerDead);
                 }
+                _ = &mut idle => {
+                    return Ok(NextClientMessage::IdleTimeout);
+                }
             }
         }
     }
 
+    /// Close a client idle outside a transaction for longer than
+    /// `client_idle_timeout`.
+    async fn close_idle_client(&mut self) -> Result<(), Error> {
+        self.disconnect_reason = Some("client_idle_timeout");
+        info!(
+            "[{}@{} #c{}] client {} closed: idle longer than client_idle_timeout ({:?})",
+            self.username,
+            self.pool_name,
+            self.connection_id,
+            self.addr,
+            self.client_idle_timeout.unwrap_or_default()
+        );
+        self.stats.disconnect();
+        error_response_terminal(
+            &mut self.write,
+            "terminating connection due to client_idle_timeout",
+            "57P05",
+        )
+        .await
+    }
+
+    /// Close a client evicted above `max_connections_soft`; the eviction
+    /// itself is logged by `evict_idle_client`.
+    async fn close_evicted_client(&mut self) -> Result<(), Error> {
+        self.disconnect_reason = Some("evicted");
+        self.stats.disconnect();
+        error_response_terminal(
+            &mut self.write,
+            "terminating connection: too many clients, idle connection evicted",
+            "57P01",
+        )
+        .await
+    }
+
     /// Handle cancel mode - when client wants to cancel a previously issued query.
     /// Opens a new separate connection to the server, sends the backend_id
     /// and secret_key and then closes it for security reasons.
@@ -305,7 +646,7 @@ where
             &target.host,
             target.port,
             target.process_id,
-            target.secret_key,
+            &target.secret_key,
             &target.server_tls,
             target.connected_with_tls,
             &target.pool_name,
@@ -313,7 +654,7 @@ where
         .await
     }
 
-    /// Check for pooler health check and DEALLOCATE queries, handle them without server.
+    /// Check for pooler health check, DEALLOCATE and DISCARD queries, handle them without server.
     /// Returns `Ok(true)` if query was handled (caller should continue to next iteration),
     /// `Ok(false)` if query needs normal processing.
     #[inline]
@@ -358,7 +699,8 @@ where
                     .trim()
                     .trim_end_matches(';');
 
-                if statement_part.eq_ignore_ascii_case("all") {
+                let all = statement_part.eq_ignore_ascii_case("all");
+                if all {
                     // DEALLOCATE ALL - clear entire client cache
                     let count = self.prepared.cache.len();
                     self.prepared.cache.clear();
@@ -377,7 +719,45 @@ where
                     }
                 }
 
-                write_all_flush(&mut self.write, &deallocate_response()).await?;
+                let response = if self.driver_compat == Some(DriverCompat::Jdbc) {
+                    // PostgreSQL's own response: pgjdbc forgets its server-side
+                    // statements only on the "DEALLOCATE ALL" tag.
+                    let mut response =
+                        command_complete(if all { "DEALLOCATE ALL" } else { "DEALLOCATE" });
+                    response.extend_from_slice(&ready_for_query(false));
+                    response
+                } else {
+                    deallocate_response()
+                };
+                write_all_flush(&mut self.write, &response).await?;
+                return Ok(true);
+            }
+        }
+
+        // DISCARD ALL / DISCARD PLANS between transactions. In transaction
+        // mode they would run on whichever backend the pool hands out and
+        // wipe statements pg_doorman prepared there for other clients; the
+        // client's own cache and its session parameters are the only state
+        // DISCARD ALL has to reset, and DISCARD PLANS keeps statements. Session mode and a deferred BEGIN
+        // forward them (PostgreSQL rejects DISCARD ALL in a transaction).
+        if self.transaction_mode && self.client_pending_begin.is_none() {
+            if let Some(discard) = discard_command(message) {
+                let mut response = command_complete(discard.tag());
+                if discard == Discard::All {
+                    let count = self.prepared.cache.len();
+                    self.prepared.cache.clear();
+                    // RESET ALL: the session parameters go back to their
+                    // login values, so the next checkout syncs those. Like
+                    // PostgreSQL, report the changes before ReadyForQuery.
+                    let status = self.server_parameters.reset_to(&self.startup_parameters);
+                    response.extend_from_slice(&status);
+                    info!(
+                        "[{}@{} #c{}] DISCARD ALL: cleared {} entries from client prepared statement cache, session parameters reset",
+                        self.username, self.pool_name, self.connection_id, count
+                    );
+                }
+                response.extend_from_slice(&ready_for_query(false));
+                write_all_flush(&mut self.write, &response).await?;
                 return Ok(true);
             }
         }
@@ -405,49 +785,8 @@ where
             return Ok(());
         }
 
-        let mut conn = pool.database.get().await.map_err(|e| {
-            Error::ClientError(format!(
-                "pooler_check_query: failed to acquire backend: {e}"
-            ))
-        })?;
-
-        if let Err(err) = conn.checkin_cleanup().await {
-            conn.mark_bad(&format!(
-                "pooler_check_query: checkin_cleanup failed: {err}"
-            ));
-            return Err(err);
-        }
-
-        if let Err(err) = conn.send_and_flush(message).await {
-            conn.mark_bad(&format!("pooler_check_query: send failed: {err}"));
-            return Err(err);
-        }
+        let response = idle_backend_round_trip(pool, message, "pooler_check_query").await?;
         POOLER_CHECK_QUERY_BACKEND_TOTAL.inc();
-
-        // Server::recv must be drained in a loop until is_data_available()
-        // is false; otherwise responses larger than BUFFER_FLUSH_THRESHOLD
-        // leave bytes in the backend socket and the next checked-out client
-        // reads a desynced stream.
-        let mut response = BytesMut::new();
-        loop {
-            let mut overflow_buf = BytesMut::new();
-            let writer = BufferingWriter::new(&mut overflow_buf);
-            let chunk = match conn.recv(writer, None).await {
-                Ok(chunk) => chunk,
-                Err(err) => {
-                    conn.mark_bad(&format!("pooler_check_query: recv failed: {err}"));
-                    return Err(err);
-                }
-            };
-            response.extend_from_slice(&chunk);
-            if !overflow_buf.is_empty() {
-                response.extend_from_slice(&overflow_buf);
-            }
-            if !conn.is_data_available() {
-                break;
-            }
-        }
-
         write_all_flush(&mut self.write, &response).await?;
 
         if !has_error_response(&response) && ends_with_idle_ready_for_query(&response) {
@@ -463,7 +802,7 @@ where
     #[inline]
     async fn handle_simple_query(
         &mut self,
-        message: &BytesMut,
+        message: Bytes,
         server: &mut Server,
         query_start_at: quanta::Instant,
     ) -> Result<TransactionAction, Error> {
@@ -478,7 +817,10 @@ where
         // hash into the next Sync.
         self.prepared.last_bound_for_top = None;
 
-        self.execute_server_roundtrip(Some(message), server).await?;
+        let query = message.get(5..message.len() - 1).unwrap_or_default();
+        self.stats.query_started(message.slice_ref(query));
+        self.execute_server_roundtrip(Some(&message[..]), server)
+            .await?;
         self.stats.query();
         server.stats.query(
             query_start_at.elapsed().as_micros() as u64,
@@ -507,7 +849,9 @@ where
 
         self.prepared.last_bound_for_top = None;
 
-        self.execute_server_roundtrip(Some(message), server).await?;
+        self.stats.query_started("<function call>");
+        self.execute_server_roundtrip(Some(&message[..]), server)
+            .await?;
         self.stats.query();
         server.stats.query(
             query_start_at.elapsed().as_micros() as u64,
@@ -622,6 +966,7 @@ where
         self.buffer.clear();
         // Reset batch state for next batch
         self.prepared.reset_batch();
+        self.pipeline_error = None;
 
         if self.complete_transaction_if_needed(server, true) {
             return Ok(TransactionAction::Break);
@@ -630,6 +975,16 @@ where
         Ok(TransactionAction::Continue)
     }
 
+    /// Write a server response to the client. With `client_write_timeout`
+    /// set, a client that takes no bytes for that long fails the write
+    /// instead of holding the backend while it stalls.
+    async fn write_response(&mut self, response: &[u8]) -> Result<(), Error> {
+        match self.client_write_timeout {
+            Some(limit) => write_all_flush_progress(&mut self.write, response, limit).await,
+            None => write_all_flush(&mut self.write, response).await,
+        }
+    }
+
     /// Handle CopyData (d) message.
     /// Returns the action to take after processing.
     #[inline]
@@ -639,6 +994,7 @@ where
         server: &mut Server,
     ) -> Result<TransactionAction, Error> {
         self.ensure_copy_mode(server)?;
+        server.add_copy_bytes(message.len() as u64);
         self.buffer.put(&message[..]);
 
         // Want to limit buffer size
@@ -672,7 +1028,7 @@ where
             .await?;
 
         self.stats.active_write();
-        match write_all_flush(&mut self.write, &response).await {
+        match self.write_response(&response).await {
             Ok(_) => self.stats.active_idle(),
             Err(err) => {
                 server.wait_available().await;
@@ -700,6 +1056,37 @@ where
         if self.cancel_mode {
             return self.handle_cancel_mode().await;
         }
+        self.connection_event(events::CLIENT_CONNECT, "login");
+        let result = self.serve().await;
+        let reason = match (&result, self.disconnect_reason) {
+            (_, Some(reason)) => reason,
+            (Ok(()), None) => "client_terminate",
+            (Err(err), None) => events::client_error_reason(err),
+        };
+        self.connection_event(events::CLIENT_DISCONNECT, reason);
+        result
+    }
+
+    /// Report a connection event of this client.
+    fn connection_event(&self, event: &'static str, reason: &'static str) {
+        let session = now().saturating_duration_since(self.stats.connect_time());
+        events::emit(
+            event,
+            reason,
+            format_args!(
+                "user={} pool={} conn=#c{} addr={} application_name={:?} session_ms={}",
+                self.username,
+                self.pool_name,
+                self.connection_id,
+                self.addr_str,
+                self.server_parameters.get_application_name(),
+                session.as_millis()
+            ),
+        );
+    }
+
+    /// Serve the client until it disconnects.
+    async fn serve(&mut self) -> Result<(), Error> {
         self.stats.register(self.stats.clone());
         let pool = match self.admin {
             true => None,
@@ -717,13 +1104,17 @@ where
             // and the actual migration branch to avoid redundant reads.
             #[cfg(unix)]
             if MIGRATION_IN_PROGRESS.load(Ordering::Relaxed) && !self.admin {
-                if self.client_pending_begin.is_some() || !self.read.buffer().is_empty() {
+                if self.client_pending_begin.is_some()
+                    || self.shard_pool.is_some()
+                    || !self.read.buffer().is_empty()
+                {
                     debug!(
-                        "[{}@{} #c{}] migration deferred: pending_begin={} read_buf={}",
+                        "[{}@{} #c{}] migration deferred: pending_begin={} shard_pinned={} read_buf={}",
                         self.username,
                         self.pool_name,
                         self.connection_id,
                         self.client_pending_begin.is_some(),
+                        self.shard_pool.is_some(),
                         self.read.buffer().len()
                     );
                 } else {
@@ -767,6 +1158,7 @@ where
                                     }
                                     Ok(payload) => {
                                         permit.send(payload);
+                                        self.disconnect_reason = Some("migrated");
                                         info!(
                                             "[{}@{} #c{}] client {} migrated to new process",
                                             self.username,
@@ -786,13 +1178,40 @@ where
                 }
             }
 
-            let message =
-                match read_message_reuse(&mut self.read, &mut self.read_buf, self.max_memory_usage)
-                    .await
-                {
-                    Ok(message) => message,
-                    Err(err) => return self.process_error(err).await,
-                };
+            // A deferred BEGIN means the client is inside a transaction.
+            let outside_transaction = !self.admin && self.client_pending_begin.is_none();
+            let idle_timeout = self.client_idle_timeout.filter(|_| outside_transaction);
+            let read = read_message_reuse(
+                &mut self.read,
+                &mut self.read_buf,
+                self.max_memory_usage,
+                self.max_client_message_size,
+            );
+            // An evicted client leaves at its next idle point outside a
+            // transaction (`max_connections_soft`).
+            let evicted = self.stats.evicted();
+            let read = async move {
+                tokio::select! {
+                    biased;
+                    read = read => Some(read),
+                    _ = evicted, if outside_transaction => None,
+                }
+            };
+            let read = match idle_timeout {
+                Some(timeout) => match tokio::time::timeout(timeout, read).await {
+                    Ok(read) => read,
+                    Err(_) => return self.close_idle_client().await,
+                },
+                None => read.await,
+            };
+            let Some(read) = read else {
+                return self.close_evicted_client().await;
+            };
+            let mut message = match read {
+                Ok(message) => message,
+                Err(err) => return self.process_error(err).await,
+            };
+            self.trace(trace::FROM_CLIENT, &message, None);
             if message[0] as char == 'X' {
                 debug!(
                     "[{}@{} #c{}] client {} sent Terminate",
@@ -809,6 +1228,7 @@ where
                     "[{}@{} #c{}] dropping client {}: shutting down",
                     self.username, self.pool_name, self.connection_id, self.addr
                 );
+                self.disconnect_reason = Some("shutdown");
                 error_response_terminal(&mut self.write, "pooler is shut down now", "58006")
                     .await?;
                 self.stats.disconnect();
@@ -816,23 +1236,47 @@ where
             }
             // Handle admin database queries.
             if self.admin {
-                handle_admin(&mut self.write, message, self.client_server_map.clone())
-                    .await
-                    .inspect_err(|_| self.stats.disconnect())?;
+                handle_admin(
+                    &mut self.write,
+                    message,
+                    self.client_server_map.clone(),
+                    self.admin_read_only,
+                )
+                .await
+                .inspect_err(|_| self.stats.disconnect())?;
                 continue;
             }
 
             query_start_at = now();
-            let current_pool = pool.as_ref().unwrap();
+            // A shard picked with `SET doorman.shard` serves this transaction.
+            let shard_pool = self.shard_pool.clone();
+            let current_pool = shard_pool.as_ref().unwrap_or(pool.as_ref().unwrap());
+
+            // Statement Closes starting a batch wait for the next message,
+            // and a Sync after them needs no server. See `close_batch`.
+            if self.hold_close(&message)? || self.answer_held_closes(&message).await? {
+                continue;
+            }
 
             // Handle fast queries (pooler check, DEALLOCATE) without server
-            if self
-                .try_handle_without_server(&message, current_pool)
-                .await?
+            if self.held_closes() == 0
+                && self
+                    .try_handle_without_server(&message, current_pool)
+                    .await?
             {
                 continue;
             }
 
+            // `SET doorman.shard` / `doorman.shard_key`. See `shard`.
+            if self.held_closes() == 0 && self.set_shard(&mut message).await? {
+                continue;
+            }
+
+            // SHOW of a parameter in `show_local_parameters`. See `show`.
+            if self.held_closes() == 0 && self.answer_show(&message, current_pool).await? {
+                continue;
+            }
+
             // Micro-optimization: if first message is standalone BEGIN,
             // synthesize response and defer actual BEGIN to next query.
             // BEGIN itself doesn't perform any server operations, it only
@@ -865,8 +1309,50 @@ where
                 // Grab a server from the pool.
                 let connecting_at = now();
                 self.stats.waiting();
+                // The quota wait and every checkout attempt, retries
+                // included, share one query_wait_timeout counted from here.
+                let mut timeouts = current_pool.database.timeouts();
+                let checkout_deadline =
+                    timeouts.wait.map(|wait| tokio::time::Instant::now() + wait);
+                // Slots of the client's checkout quotas, given back with
+                // the server at the end of this block.
+                let _quota_slots = if self.checkout_quotas.is_empty() {
+                    None
+                } else {
+                    match checkout_quota::acquire(&self.checkout_quotas, checkout_deadline).await {
+                        Ok(slots) => Some(slots),
+                        Err(quota) => {
+                            current_pool.address.stats.error_with_sqlstate("53300");
+                            self.stats.checkout_error();
+                            if message[0] as char == 'S' {
+                                self.reset_buffered_state();
+                            }
+                            let details = format!(
+                                "query_wait_timeout: clients of {} already hold {} server connections of pool {} (checkout limit) and none was given back in {}ms. Shorten their transactions or raise the limit.",
+                                quota.describe(),
+                                quota.limit(),
+                                self.pool_name,
+                                connecting_at.elapsed().as_millis(),
+                            );
+                            error_response(&mut self.write, &details, "53300").await?;
+                            error!(
+                                "[{}@{} #c{}] checkout limit of {} reached",
+                                self.username,
+                                self.pool_name,
+                                self.connection_id,
+                                quota.describe(),
+                            );
+                            return Err(Error::AllServersDown);
+                        }
+                    }
+                };
+                let mut checkout_retries = 0;
                 let mut conn = loop {
-                    match current_pool.database.get().await {
+                    if let Some(deadline) = checkout_deadline {
+                        timeouts.wait =
+                            Some(deadline.saturating_duration_since(tokio::time::Instant::now()));
+                    }
+                    match current_pool.database.timeout_get(&timeouts).await {
                         Ok(mut conn) => {
                             // check server candidate in canceled pids.
                             {
@@ -890,6 +1376,36 @@ where
                             };
                         }
                         Err(err) => {
+                            // Nothing reached a server yet: try again, the
+                            // next checkout may get a connection another
+                            // client returned or go to another host.
+                            if err.is_retriable_checkout() {
+                                let max_retries = get_config().general.server_checkout_retries;
+                                let backoff = CHECKOUT_RETRY_BACKOFF
+                                    .saturating_mul(checkout_retries + 1)
+                                    .min(CHECKOUT_RETRY_BACKOFF_MAX);
+                                let in_time = checkout_deadline.is_none_or(|deadline| {
+                                    tokio::time::Instant::now() + backoff < deadline
+                                });
+                                if checkout_retries < max_retries && in_time {
+                                    checkout_retries += 1;
+                                    warn!(
+                                        "[{}@{} #c{}] server checkout failed, retrying ({}/{}): {err}",
+                                        self.username,
+                                        self.pool_name,
+                                        self.connection_id,
+                                        checkout_retries,
+                                        max_retries,
+                                    );
+                                    crate::web::metrics::record_checkout_retry(
+                                        &self.username,
+                                        &self.pool_name,
+                                    );
+                                    tokio::time::sleep(backoff).await;
+                                    continue;
+                                }
+                            }
+
                             // Client is attempting to get results from the server,
                             // but we were unable to grab a connection from the pool
                             // We'll send back an error message and clean the extended
@@ -936,6 +1452,36 @@ where
                                 return Err(Error::AllServersDown);
                             }
 
+                            // Circuit breaker open: the backend has been
+                            // failing connects, so the checkout failed at
+                            // once. 08004 lets clients tell this apart from
+                            // pool saturation (53300).
+                            if let crate::pool::PoolError::Backend(Error::CircuitBreakerOpen(msg)) =
+                                &err
+                            {
+                                current_pool.address.stats.error_with_sqlstate("08004");
+                                self.stats.checkout_error();
+
+                                if message[0] as char == 'S' {
+                                    self.reset_buffered_state();
+                                }
+
+                                error_response(
+                                    &mut self.write,
+                                    &format!(
+                                        "Database unavailable: {msg}. Please try again later."
+                                    ),
+                                    "08004",
+                                )
+                                .await?;
+
+                                warn!(
+                                    "[{}@{} #c{}] checkout rejected by circuit breaker: {err}",
+                                    self.username, self.pool_name, self.connection_id,
+                                );
+                                return Err(Error::AllServersDown);
+                            }
+
                             if let crate::pool::PoolError::Backend(
                                 Error::ServerStartupParameterRejection {
                                     sqlstate,
@@ -971,12 +1517,26 @@ where
                                 self.reset_buffered_state();
                             }
 
-                            error_response(
-                                &mut self.write,
-                                format!("Could not get a database connection from the pool. All servers may be busy or down. Error details: {err}. Please try again later.").as_str(),
-                                "53300",
-                            )
-                            .await?;
+                            // Pool saturation: tell the developer which pool
+                            // and how full it is instead of a generic error.
+                            let details = if matches!(
+                                err,
+                                crate::pool::PoolError::Timeout(crate::pool::TimeoutType::Wait)
+                            ) {
+                                let status = current_pool.database.status();
+                                format!(
+                                    "query_wait_timeout: no server connection became free in {}ms for pool {} user {} (pool size {}/{}, {} clients waiting). The pool is saturated: raise pool_size or shorten transactions.",
+                                    connecting_at.elapsed().as_millis(),
+                                    self.pool_name,
+                                    self.username,
+                                    status.size,
+                                    status.max_size,
+                                    status.waiting,
+                                )
+                            } else {
+                                format!("Could not get a database connection from the pool. All servers may be busy or down. Error details: {err}. Please try again later.")
+                            };
+                            error_response(&mut self.write, &details, "53300").await?;
 
                             error!(
                                 "[{}@{} #c{}] failed to get server connection: {err}",
@@ -1037,6 +1597,7 @@ where
 
                 // Update statistics
                 self.stats.active_idle();
+                self.stats.server_assigned(server.get_process_id());
                 self.last_server_stats = Some(server.stats.clone());
 
                 debug!(
@@ -1048,8 +1609,23 @@ where
                     server.get_process_id()
                 );
 
+                // Unix socket clients have no address of their own.
+                let client_addr = match self.listener {
+                    "unix" => "unix",
+                    _ => self.addr_str.as_str(),
+                };
                 if current_pool.settings.sync_server_parameters {
-                    server.sync_parameters(&self.server_parameters).await?;
+                    server
+                        .sync_parameters(
+                            &self.server_parameters,
+                            self.backend_application_name.as_deref(),
+                            client_addr,
+                        )
+                        .await?;
+                } else {
+                    server
+                        .sync_client_identity(self.backend_application_name.as_deref(), client_addr)
+                        .await?;
                 }
                 server.set_async_mode(false);
 
@@ -1116,7 +1692,10 @@ where
                         None => {
                             self.stats.active_read();
                             match self.wait_for_next_message(server).await {
-                                Ok(NextClientMessage::Message(msg)) => msg,
+                                Ok(NextClientMessage::Message(msg)) => {
+                                    self.trace(trace::FROM_CLIENT, &msg, None);
+                                    msg
+                                }
                                 Ok(NextClientMessage::ServerDead) => {
                                     warn!(
                                         "[{}@{} #c{}] server died while idle in transaction pid={}",
@@ -1127,6 +1706,7 @@ where
                                     );
                                     server
                                         .mark_bad("server closed while client idle in transaction");
+                                    self.disconnect_reason = Some("server_closed");
                                     let _ = error_response(
                                         &mut self.write,
                                         "server closed the connection unexpectedly while client was idle in transaction",
@@ -1138,6 +1718,12 @@ where
                                     self.release();
                                     return Ok(());
                                 }
+                                Ok(NextClientMessage::IdleTimeout) => {
+                                    self.connected_to_server = false;
+                                    server.checkin_cleanup().await?;
+                                    self.release();
+                                    return self.close_idle_client().await;
+                                }
                                 Err(err) => {
                                     self.stats.disconnect();
                                     self.connected_to_server = false;
@@ -1164,22 +1750,61 @@ where
                     // The message will be forwarded to the server intact. We still would like to
                     // parse it below to figure out what to do with it.
 
+                    // Except for rewrite_rules, applied before anything else inspects the query.
+                    let message = match current_pool.settings.rewrite_rules.as_deref() {
+                        Some(rules) => self.rewrite(rules, message),
+                        None => message,
+                    };
+
                     // Safe to unwrap because we know this message has a certain length and has the code
                     // This reads the first byte without advancing the internal pointer and mutating the bytes
                     let code = *message.first().unwrap() as char;
 
+                    // After a pipeline error everything up to Sync is
+                    // discarded, as PostgreSQL does.
+                    if self.pipeline_error.is_some() && code != 'S' && code != 'X' {
+                        continue;
+                    }
+                    if matches!(code, 'P' | 'B' | 'D' | 'E' | 'C') && self.pipeline_full() {
+                        let error = format!(
+                            "pipeline exceeds max_pipeline_depth ({} messages before Sync)",
+                            self.max_pipeline_depth
+                        );
+                        self.abort_pipeline(&error, "54000", "max_pipeline_depth");
+                        continue;
+                    }
+
                     // Process message and get action
                     let action = match code {
                         // Query
                         'Q' => {
-                            self.handle_simple_query(&message, server, query_start_at)
-                                .await?
+                            if self.two_phase_rejected(&message, server) {
+                                self.reject_statement(server, two_phase::REJECTED, "0A000")
+                                    .await?
+                            } else if let Some((rejection, code)) =
+                                self.statement_rejection(&message, current_pool)
+                            {
+                                self.reject_statement(server, &rejection, code).await?
+                            } else {
+                                self.audit(&message, server);
+                                self.pin_session_if_needed(&message, server);
+                                let resets = (server.get_process_id(), server.prepared_resets());
+                                self.prepared.server_resets_before.get_or_insert(resets);
+                                self.handle_simple_query(message.freeze(), server, query_start_at)
+                                    .await?
+                            }
                         }
 
                         // FunctionCall
                         'F' => {
-                            self.handle_function_call(&message, server, query_start_at)
-                                .await?
+                            if let Some((rejection, code)) =
+                                self.statement_rejection(&message, current_pool)
+                            {
+                                self.reject_statement(server, &rejection, code).await?
+                            } else {
+                                self.handle_function_call(&message, server, query_start_at)
+                                    .await?
+                            }
                         }
 
                         // Terminate
@@ -1193,6 +1818,19 @@ where
 
                         // Parse
                         'P' => {
+                            // A refused Parse fails the whole pipeline.
+                            if self.two_phase_rejected(&message, server) {
+                                self.abort_pipeline(two_phase::REJECTED, "0A000", "rejected");
+                                continue;
+                            }
+                            if let Some((rejection, code)) =
+                                self.statement_rejection(&message, current_pool)
+                            {
+                                self.abort_pipeline(&rejection, code, "rejected");
+                                continue;
+                            }
+                            self.audit(&message, server);
+                            self.pin_session_if_needed(&message, server);
                             self.process_parse_immediate(message, current_pool, server)
                                 .await?;
                             TransactionAction::Continue
@@ -1250,6 +1888,13 @@ where
                                 "[{}@{} #c{}] unexpected message code '{}' (ASCII: {}) from client {}",
                                 self.username, self.pool_name, self.connection_id, code, code as u8, self.addr
                             );
+                            violation::report(
+                                self.listener,
+                                "unexpected_message",
+                                &self.addr_str,
+                                &format!("message type '{code}'"),
+                                &message,
+                            );
                             TransactionAction::Continue
                         }
                     };
@@ -1287,11 +1932,14 @@ where
 
             // TransactionGuard dropped at end of block above, counter already decremented.
             self.connected_to_server = false;
+            // A shard pin lasts one transaction.
+            self.shard_pool = None;
 
             // If shutdown is in progress and migration is not available,
             // send error to client and exit. When migration is active,
             // let the client return to idle loop where it will migrate.
             if shutdown_in_progress && !MIGRATION_IN_PROGRESS.load(Ordering::Relaxed) {
+                self.disconnect_reason = Some("shutdown");
                 error_response_terminal(&mut self.write, "pooler is shut down now", "58006")
                     .await?;
                 self.stats.disconnect();
@@ -1307,13 +1955,15 @@ where
 
     pub(crate) async fn execute_server_roundtrip(
         &mut self,
-        message: Option<&BytesMut>,
+        message: Option<&[u8]>,
         server: &mut Server,
     ) -> Result<(), Error> {
         if !self.transaction_mode && self.session_xact_start.is_none() {
             self.session_xact_start = Some(crate::utils::clock::now());
         }
-        let message = message.unwrap_or(&self.buffer);
+        let message = message.unwrap_or(&self.buffer[..]);
+        let fault = self.fault_before_send(server).await?;
+        let sent_at = now();
 
         // Send message with timeout
         if let Err(err) = server
@@ -1338,6 +1988,11 @@ where
 
         // Debug log: client -> server
         log_client_to_server(&self.addr_str, server.get_process_id(), message);
+        self.trace(trace::TO_SERVER, message, None);
+
+        if fault != Fault::None {
+            return self.fault_after_send(fault, server).await;
+        }
 
         // Pre-calculate fast release conditions (avoids repeated checks)
         let can_fast_release = self.transaction_mode;
@@ -1345,14 +2000,15 @@ where
         // Single initial state update
         self.stats.active_idle();
 
+        let mut deadline = self.max_query_time.map(MaxQueryTime::start);
+
         // Read all data the server has to offer, which can be multiple messages
         // buffered in 8 KiB chunks.
         loop {
-            let mut response = match server
-                .recv(&mut self.write, Some(&mut self.server_parameters))
-                .await
-            {
+            let mut response = match self.recv_within(server, deadline.as_mut()).await {
                 Ok(msg) => msg,
+                // The backend was given up by max_query_time, nothing to drain.
+                Err(err) if self.disconnect_reason == Some("max_query_time") => return Err(err),
                 Err(err) => {
                     server.wait_available().await;
                     let mut msg = String::with_capacity(64);
@@ -1386,8 +2042,12 @@ where
                 self.prepared.pending_close_complete -= inserted;
             }
 
+            // The error of a pipeline pg_doorman failed replaces the backend's.
+            response = self.pipeline_response(response);
+
             // Debug log: server -> client (after all modifications to show what client actually receives)
             log_server_to_client(&self.addr_str, server.get_process_id(), &response);
+            self.trace(trace::TO_CLIENT, &response, Some(sent_at));
 
             // Fast path: early release check before expensive operations
             // This is the most common case in transaction mode
@@ -1407,7 +2067,22 @@ where
 
             // Write response to client
             self.stats.active_write();
-            if let Err(err_write) = write_all_flush(&mut self.write, &response).await {
+            if let Err(err_write) = self.write_response(&response).await {
+                if matches!(err_write, Error::ClientWriteTimeout) {
+                    warn!(
+                        "[{}@{} #c{}] client {} closed: stopped reading a {}-byte response for client_write_timeout ({:?}), server pid={} closed",
+                        self.username,
+                        self.pool_name,
+                        self.connection_id,
+                        self.addr,
+                        response.len(),
+                        self.client_write_timeout.unwrap_or_default(),
+                        server.get_process_id()
+                    );
+                    // The rest of the response is still on the backend socket.
+                    server.mark_bad("client stopped reading the response");
+                    return Err(err_write);
+                }
                 warn!(
                     "[{}@{} #c{}] write to client failed pid={}: {err_write}",
                     self.username,
@@ -0,0 +1,170 @@
+//! Two-phase commit through the pooler (`general.two_phase_commit`).
+//!
+//! `PREPARE TRANSACTION` detaches the transaction from the session, and
+//! `COMMIT PREPARED` / `ROLLBACK PREPARED` may later come from any session.
+//! With the `pin` policy the client keeps its backend after PREPARE
+//! TRANSACTION and pg_doorman records the transaction until it is finished
+//! through the pooler, so `SHOW PREPARED_TRANSACTIONS` lists what a crashed
+//! transaction manager left behind. With `reject` the statement never reaches
+//! PostgreSQL.
+
+use std::collections::BTreeMap;
+use std::time::Instant;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use super::session_pin::{is, Words};
+
+/// Error text for PREPARE TRANSACTION under `two_phase_commit = reject`.
+pub(crate) const REJECTED: &str =
+    "PREPARE TRANSACTION is not allowed through this pooler (two_phase_commit = reject), the transaction was rolled back";
+
+/// A two-phase statement and its transaction identifier.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) enum TwoPhaseCommand {
+    Prepare(String),
+    CommitPrepared(String),
+    RollbackPrepared(String),
+}
+
+impl TwoPhaseCommand {
+    pub(crate) fn gid(&self) -> &str {
+        match self {
+            TwoPhaseCommand::Prepare(gid)
+            | TwoPhaseCommand::CommitPrepared(gid)
+            | TwoPhaseCommand::RollbackPrepared(gid) => gid,
+        }
+    }
+}
+
+/// The first two-phase statement in `query`, if any.
+pub(crate) fn two_phase_command(query: &[u8]) -> Option<TwoPhaseCommand> {
+    let mut prev: [&[u8]; 2] = [b"", b""];
+    for word in Words::new(query) {
+        if word.first() == Some(&b'\'') {
+            let gid = unquote(word);
+            if is(prev[0], "prepare") && is(prev[1], "transaction") {
+                return Some(TwoPhaseCommand::Prepare(gid));
+            }
+            if is(prev[1], "prepared") {
+                if is(prev[0], "commit") {
+                    return Some(TwoPhaseCommand::CommitPrepared(gid));
+                }
+                if is(prev[0], "rollback") {
+                    return Some(TwoPhaseCommand::RollbackPrepared(gid));
+                }
+            }
+        }
+        prev = [prev[1], word];
+    }
+    None
+}
+
+/// Literal text without the quotes, doubled quotes collapsed.
+fn unquote(literal: &[u8]) -> String {
+    let inner = literal
+        .strip_prefix(b"'")
+        .map(|l| l.strip_suffix(b"'").unwrap_or(l))
+        .unwrap_or(literal);
+    String::from_utf8_lossy(inner).replace("''", "'")
+}
+
+/// A transaction prepared through pg_doorman and not yet finished through it.
+#[derive(Debug, Clone)]
+pub struct PreparedTransaction {
+    pub database: String,
+    pub gid: String,
+    pub user: String,
+    pub client_addr: String,
+    pub backend_pid: i32,
+    pub prepared_at: Instant,
+}
+
+/// Outstanding prepared transactions by (pool, gid).
+static PREPARED_TRANSACTIONS: Lazy<Mutex<BTreeMap<(String, String), PreparedTransaction>>> =
+    Lazy::new(|| Mutex::new(BTreeMap::new()));
+
+/// PREPARE TRANSACTION succeeded.
+pub(crate) fn remember(prepared: PreparedTransaction) {
+    let key = (prepared.database.clone(), prepared.gid.clone());
+    PREPARED_TRANSACTIONS.lock().insert(key, prepared);
+}
+
+/// COMMIT PREPARED or ROLLBACK PREPARED succeeded.
+pub(crate) fn forget(database: &str, gid: &str) {
+    PREPARED_TRANSACTIONS
+        .lock()
+        .remove(&(database.to_string(), gid.to_string()));
+}
+
+/// Snapshot for `SHOW PREPARED_TRANSACTIONS`, ordered by pool and gid.
+pub fn prepared_transactions() -> Vec<PreparedTransaction> {
+    PREPARED_TRANSACTIONS.lock().values().cloned().collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn command(sql: &str) -> Option<TwoPhaseCommand> {
+        two_phase_command(sql.as_bytes())
+    }
+
+    fn prepared_transaction(database: &str, gid: &str) -> PreparedTransaction {
+        PreparedTransaction {
+            database: database.to_string(),
+            gid: gid.to_string(),
+            user: "app".to_string(),
+            client_addr: "127.0.0.1:5000".to_string(),
+            backend_pid: 42,
+            prepared_at: Instant::now(),
+        }
+    }
+
+    #[test]
+    fn parses_two_phase_statements() {
+        assert_eq!(
+            command("PREPARE TRANSACTION 'tx-1'"),
+            Some(TwoPhaseCommand::Prepare("tx-1".to_string()))
+        );
+        assert_eq!(
+            command("commit prepared 'tx-1';"),
+            Some(TwoPhaseCommand::CommitPrepared("tx-1".to_string()))
+        );
+        assert_eq!(
+            command("ROLLBACK PREPARED 'it''s'"),
+            Some(TwoPhaseCommand::RollbackPrepared("it's".to_string()))
+        );
+        assert_eq!(
+            command("INSERT INTO t VALUES (1); PREPARE TRANSACTION 'tx-2'"),
+            Some(TwoPhaseCommand::Prepare("tx-2".to_string()))
+        );
+    }
+
+    #[test]
+    fn ignores_other_statements() {
+        assert_eq!(command("PREPARE stmt AS SELECT 1"), None);
+        assert_eq!(command("COMMIT"), None);
+        assert_eq!(command("SELECT 'PREPARE TRANSACTION ''x'''"), None);
+        assert_eq!(command("-- PREPARE TRANSACTION 'x'\nSELECT 1"), None);
+    }
+
+    #[test]
+    fn registry_tracks_until_finished() {
+        remember(prepared_transaction("db_registry", "registry-test"));
+        assert!(prepared_transactions()
+            .iter()
+            .any(|p| p.database == "db_registry" && p.gid == "registry-test"));
+
+        forget("db_registry", "other");
+        assert!(prepared_transactions()
+            .iter()
+            .any(|p| p.database == "db_registry"));
+
+        forget("db_registry", "registry-test");
+        assert!(!prepared_transactions()
+            .iter()
+            .any(|p| p.database == "db_registry"));
+    }
+}
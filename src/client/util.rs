@@ -33,3 +33,152 @@ pub(crate) fn is_standalone_begin(message: &BytesMut) -> bool {
     let query = &message[5..11];
     query.eq_ignore_ascii_case(b"begin;")
 }
+
+/// The DISCARD forms pg_doorman answers itself in transaction mode.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub(crate) enum Discard {
+    /// `DISCARD ALL`: every prepared statement of the session is gone.
+    All,
+    /// `DISCARD PLANS`: cached plans are dropped, statements survive.
+    Plans,
+}
+
+impl Discard {
+    /// CommandComplete tag PostgreSQL sends for the command.
+    pub(crate) fn tag(self) -> &'static str {
+        match self {
+            Discard::All => "DISCARD ALL",
+            Discard::Plans => "DISCARD PLANS",
+        }
+    }
+}
+
+/// Longest simple query inspected by [`discard_command`].
+const DISCARD_MAX_LEN: usize = 64;
+
+/// Returns the target when the Q message is exactly `DISCARD ALL` or
+/// `DISCARD PLANS`, matched case-insensitively with an optional trailing
+/// semicolon. `DISCARD TEMP`, `DISCARD SEQUENCES` and anything batched
+/// with another statement return `None`.
+pub(crate) fn discard_command(message: &BytesMut) -> Option<Discard> {
+    if message.len() > DISCARD_MAX_LEN || message.len() < 6 || message[0] != b'Q' {
+        return None;
+    }
+    let query = std::str::from_utf8(&message[5..message.len() - 1]).ok()?;
+    let query = query.trim().trim_end_matches(';');
+    let mut words = query.split_ascii_whitespace();
+    if !words.next()?.eq_ignore_ascii_case("discard") {
+        return None;
+    }
+    let target = words.next()?;
+    if words.next().is_some() {
+        return None;
+    }
+    if target.eq_ignore_ascii_case("all") {
+        Some(Discard::All)
+    } else if target.eq_ignore_ascii_case("plans") {
+        Some(Discard::Plans)
+    } else {
+        None
+    }
+}
+
+/// Value of setting `name` in the `options` startup parameter, the way
+/// PostgreSQL reads it: whitespace-separated `-c name=value`,
+/// `-cname=value` or `--name=value` switches, with `\` escaping the next
+/// character. The last occurrence wins; names match case-insensitively.
+pub(crate) fn startup_options_setting(options: &str, name: &str) -> Option<String> {
+    let mut words = Vec::new();
+    let mut word = String::new();
+    let mut chars = options.chars();
+    while let Some(c) = chars.next() {
+        match c {
+            '\\' => word.extend(chars.next()),
+            c if c.is_ascii_whitespace() => {
+                if !word.is_empty() {
+                    words.push(std::mem::take(&mut word));
+                }
+            }
+            c => word.push(c),
+        }
+    }
+    if !word.is_empty() {
+        words.push(word);
+    }
+
+    let mut value = None;
+    let mut words = words.into_iter();
+    while let Some(word) = words.next() {
+        let setting = if word == "-c" {
+            words.next()
+        } else if let Some(setting) = word.strip_prefix("--").or_else(|| word.strip_prefix("-c")) {
+            Some(setting.to_string())
+        } else {
+            None
+        };
+        if let Some((key, val)) = setting.as_deref().and_then(|s| s.split_once('=')) {
+            if key.replace('-', "_").eq_ignore_ascii_case(name) {
+                value = Some(val.to_string());
+            }
+        }
+    }
+    value
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use bytes::BufMut;
+
+    fn query(sql: &str) -> BytesMut {
+        let mut buf = BytesMut::new();
+        buf.put_u8(b'Q');
+        buf.put_i32((4 + sql.len() + 1) as i32);
+        buf.put_slice(sql.as_bytes());
+        buf.put_u8(0);
+        buf
+    }
+
+    #[test]
+    fn startup_options_setting_forms() {
+        let name = "doorman.pool";
+        assert_eq!(
+            startup_options_setting("-c doorman.pool=analytics", name).as_deref(),
+            Some("analytics")
+        );
+        assert_eq!(
+            startup_options_setting("-cDOORMAN.POOL=a --doorman.pool=b", name).as_deref(),
+            Some("b")
+        );
+        assert_eq!(
+            startup_options_setting("-c search_path=x  -c doorman.pool=c", name).as_deref(),
+            Some("c")
+        );
+        assert_eq!(
+            startup_options_setting(r"-c doorman.pool=with\ space", name).as_deref(),
+            Some("with space")
+        );
+        assert_eq!(startup_options_setting("-c search_path=x", name), None);
+        assert_eq!(startup_options_setting("-c doorman.pool", name), None);
+        assert_eq!(startup_options_setting("", name), None);
+    }
+
+    #[test]
+    fn discard_command_matches_all_and_plans() {
+        assert_eq!(discard_command(&query("DISCARD ALL")), Some(Discard::All));
+        assert_eq!(discard_command(&query("discard all;")), Some(Discard::All));
+        assert_eq!(
+            discard_command(&query("  Discard  Plans ; ")),
+            Some(Discard::Plans)
+        );
+    }
+
+    #[test]
+    fn discard_command_ignores_other_forms() {
+        assert_eq!(discard_command(&query("DISCARD TEMP")), None);
+        assert_eq!(discard_command(&query("DISCARD SEQUENCES")), None);
+        assert_eq!(discard_command(&query("DISCARD ALL; SELECT 1")), None);
+        assert_eq!(discard_command(&query("DISCARD")), None);
+        assert_eq!(discard_command(&query("SELECT 'DISCARD ALL'")), None);
+    }
+}
@@ -0,0 +1,78 @@
+//! Client protocol violations: counted per listener and kind in
+//! `pg_doorman_client_protocol_violations_total`, and logged with the client
+//! address and a hex dump of the first bytes it sent, so the misbehaving
+//! driver can be identified from the log alone.
+
+use log::warn;
+
+use crate::errors::Error;
+
+/// Bytes of the offending message shown in the log line.
+const HEAD_BYTES: usize = 32;
+
+/// First `HEAD_BYTES` of `bytes` as space-separated hex, with the number of
+/// bytes left out.
+pub(crate) fn hex_head(bytes: &[u8]) -> String {
+    hex_prefix(bytes, HEAD_BYTES)
+}
+
+/// First `limit` bytes of `bytes` as space-separated hex, with the number
+/// of bytes left out.
+pub(crate) fn hex_prefix(bytes: &[u8], limit: usize) -> String {
+    let mut out = String::with_capacity(limit.min(bytes.len()) * 3 + 16);
+    for (i, byte) in bytes.iter().take(limit).enumerate() {
+        if i > 0 {
+            out.push(' ');
+        }
+        out.push_str(&format!("{byte:02x}"));
+    }
+    if bytes.len() > limit {
+        out.push_str(&format!(" ... (+{} bytes)", bytes.len() - limit));
+    }
+    out
+}
+
+/// Count one violation and log it.
+pub(crate) fn report(
+    listener: &'static str,
+    kind: &'static str,
+    peer: &str,
+    detail: &str,
+    head: &[u8],
+) {
+    crate::web::metrics::record_client_protocol_violation(listener, kind);
+    if head.is_empty() {
+        warn!("client {peer} ({listener}) protocol violation {kind}: {detail}");
+    } else {
+        warn!(
+            "client {peer} ({listener}) protocol violation {kind}: {detail}; first bytes: {}",
+            hex_head(head)
+        );
+    }
+}
+
+/// `report` for errors that carry a violation; other errors are ignored.
+pub(crate) fn observe(listener: &'static str, peer: &str, err: &Error) {
+    if let Error::ClientProtocolViolation { kind, detail, head } = err {
+        report(listener, kind, peer, detail, head);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn hex_head_short_message() {
+        assert_eq!(hex_head(b"Q\0\0\0\x05"), "51 00 00 00 05");
+        assert_eq!(hex_head(&[]), "");
+    }
+
+    #[test]
+    fn hex_head_truncates_long_message() {
+        let bytes = vec![0xab; HEAD_BYTES + 10];
+        let head = hex_head(&bytes);
+        assert!(head.ends_with("ab ... (+10 bytes)"), "{head}");
+        assert_eq!(head.matches("ab").count(), HEAD_BYTES);
+    }
+}
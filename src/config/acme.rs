@@ -0,0 +1,136 @@
+//! ACME (RFC 8555) settings for the client-facing TLS certificate.
+
+use serde_derive::{Deserialize, Serialize};
+
+use crate::errors::Error;
+
+use super::Duration;
+
+#[derive(Clone, PartialEq, Serialize, Deserialize, Debug)]
+pub struct Acme {
+    /// DNS names the certificate is issued for; the first one is the subject.
+    #[serde(default)]
+    pub domains: Vec<String>,
+
+    /// ACME directory of the CA.
+    #[serde(default = "Acme::default_directory_url")]
+    pub directory_url: String,
+
+    /// Account contacts, e.g. `mailto:dba@example.com`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub contact: Vec<String>,
+
+    /// Account key (PEM). Created on first use.
+    #[serde(default = "Acme::default_account_key")]
+    pub account_key: String,
+
+    /// Address the HTTP-01 challenge responder listens on while an order
+    /// is pending. The CA always connects to port 80 of each domain.
+    #[serde(default = "Acme::default_http_listen")]
+    pub http_listen: String,
+
+    /// Renew once the certificate expires in less than this.
+    #[serde(default = "Acme::default_renew_before")]
+    pub renew_before: Duration,
+
+    /// PEM bundle used to verify an internal ACME server, in addition to
+    /// the system roots.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub ca_file: Option<String>,
+}
+
+impl Acme {
+    pub fn default_directory_url() -> String {
+        "https://acme-v02.api.letsencrypt.org/directory".to_string()
+    }
+
+    pub fn default_account_key() -> String {
+        "acme-account.pem".to_string()
+    }
+
+    pub fn default_http_listen() -> String {
+        "0.0.0.0:80".to_string()
+    }
+
+    pub fn default_renew_before() -> Duration {
+        Duration::from_hours(30 * 24)
+    }
+
+    pub fn empty() -> Self {
+        Acme {
+            domains: Vec::new(),
+            directory_url: Self::default_directory_url(),
+            contact: Vec::new(),
+            account_key: Self::default_account_key(),
+            http_listen: Self::default_http_listen(),
+            renew_before: Self::default_renew_before(),
+            ca_file: None,
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.domains.is_empty()
+    }
+
+    /// ACME is configured but has not written the certificate yet.
+    pub fn awaits_certificate(&self, general: &super::General) -> bool {
+        !self.is_empty()
+            && general
+                .tls_certificate
+                .as_deref()
+                .is_some_and(|cert| !std::path::Path::new(cert).exists())
+    }
+
+    pub fn validate(&self, general: &super::General) -> Result<(), Error> {
+        if self.is_empty() {
+            return Ok(());
+        }
+        if general.tls_certificate.is_none() || general.tls_private_key.is_none() {
+            return Err(Error::BadConfig(
+                "acme: tls_certificate and tls_private_key must be set; the issued \
+                 certificate and its key are written there"
+                    .into(),
+            ));
+        }
+        for domain in &self.domains {
+            let valid = !domain.is_empty()
+                && !domain.starts_with('*')
+                && domain
+                    .chars()
+                    .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '.');
+            if !valid {
+                return Err(Error::BadConfig(format!(
+                    "acme.domains: {domain:?} is not a DNS name (wildcards need DNS-01, \
+                     which is not supported)"
+                )));
+            }
+        }
+        if !self.directory_url.starts_with("https://") && !self.directory_url.starts_with("http://")
+        {
+            return Err(Error::BadConfig(format!(
+                "acme.directory_url: expected an http(s) url, got {:?}",
+                self.directory_url
+            )));
+        }
+        if self.http_listen.parse::<std::net::SocketAddr>().is_err() {
+            return Err(Error::BadConfig(format!(
+                "acme.http_listen: expected ip:port, got {:?}",
+                self.http_listen
+            )));
+        }
+        if self.renew_before.as_millis() == 0 {
+            return Err(Error::BadConfig(
+                "acme.renew_before must be greater than 0".into(),
+            ));
+        }
+        if let Some(ca_file) = &self.ca_file {
+            let pem = std::fs::read(ca_file).map_err(|err| {
+                Error::BadConfig(format!("acme.ca_file: can't read {ca_file}: {err}"))
+            })?;
+            reqwest::Certificate::from_pem_bundle(&pem).map_err(|err| {
+                Error::BadConfig(format!("acme.ca_file: invalid PEM in {ca_file}: {err}"))
+            })?;
+        }
+        Ok(())
+    }
+}
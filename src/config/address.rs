@@ -20,6 +20,9 @@ pub enum BackendAuthMethod {
     /// SCRAM pending: passthrough configured but ClientKey not yet available.
     /// Transitions to ScramPassthrough after first successful client SCRAM auth.
     ScramPending,
+    /// SCRAM relay (`password = "scram-passthrough"`): no secret at all;
+    /// connections are opened from client logins relayed to the server.
+    ScramRelay,
 }
 
 /// Pool mode:
@@ -44,6 +47,62 @@ impl Display for PoolMode {
     }
 }
 
+/// Backend role accepted by a pool whose `server_host` lists several hosts,
+/// following libpq `target_session_attrs`:
+/// - any: the first reachable host,
+/// - primary (read-write): a host that is not in recovery,
+/// - standby (read-only): a host that is in recovery.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Copy, Hash, Default)]
+pub enum TargetSessionAttrs {
+    #[default]
+    #[serde(alias = "any", alias = "Any")]
+    Any,
+
+    #[serde(alias = "primary", alias = "Primary", alias = "read-write")]
+    Primary,
+
+    #[serde(alias = "standby", alias = "Standby", alias = "read-only")]
+    Standby,
+}
+
+impl Display for TargetSessionAttrs {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let str = match *self {
+            TargetSessionAttrs::Any => "any",
+            TargetSessionAttrs::Primary => "primary",
+            TargetSessionAttrs::Standby => "standby",
+        };
+        write!(f, "{str}")
+    }
+}
+
+/// How a pool spreads new connections over the hosts of a `server_host`
+/// list (`load_balance_hosts`):
+/// - disable: in the listed order, failing over to the next host,
+/// - random: weighted random order (`server_host_weights`),
+/// - least_connections: fewest open connections per unit of weight first,
+/// - ewma_latency: lowest recent query latency first.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Copy, Hash)]
+#[serde(rename_all = "snake_case")]
+pub enum LoadBalanceHosts {
+    Disable,
+    Random,
+    LeastConnections,
+    EwmaLatency,
+}
+
+impl Display for LoadBalanceHosts {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let str = match *self {
+            LoadBalanceHosts::Disable => "disable",
+            LoadBalanceHosts::Random => "random",
+            LoadBalanceHosts::LeastConnections => "least_connections",
+            LoadBalanceHosts::EwmaLatency => "ewma_latency",
+        };
+        write!(f, "{str}")
+    }
+}
+
 /// Address identifying a PostgreSQL server uniquely.
 #[derive(Clone, Debug)]
 pub struct Address {
@@ -83,6 +142,7 @@ impl Default for Address {
             server_tls: Arc::new(crate::config::tls::ServerTlsConfig {
                 mode: crate::config::tls::ServerTlsMode::Disable,
                 connector: None,
+                direct: false,
                 cert_hash: None,
             }),
         }
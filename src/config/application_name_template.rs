@@ -0,0 +1,194 @@
+//! `application_name_template`: the `application_name` pg_doorman sets on a
+//! backend while it serves a client, built from that client's identity so
+//! `pg_stat_activity` shows where a query came from instead of only the
+//! pooler's own name.
+//!
+//! A template is plain text with `{placeholder}` substitutions, for example
+//! `"{client_app}@{client_ip}:{client_port}"`. Unknown placeholders and
+//! unbalanced braces are rejected at config load.
+
+use std::net::SocketAddr;
+
+use crate::errors::Error;
+
+/// Placeholders a template may reference.
+pub const PLACEHOLDERS: &[&str] = &["client_app", "client_ip", "client_port", "user", "database"];
+
+/// PostgreSQL keeps the first `NAMEDATALEN - 1` bytes of `application_name`
+/// and silently drops the rest; truncate here so the value pg_doorman
+/// tracks matches the one the backend reports.
+pub const MAX_APPLICATION_NAME_LEN: usize = 63;
+
+/// Who the backend is working for. `peer` is `None` for unix socket
+/// clients, rendered as `client_ip = "unix"` and an empty `client_port`.
+pub struct ClientIdentity<'a> {
+    pub application_name: &'a str,
+    pub peer: Option<SocketAddr>,
+    pub user: &'a str,
+    pub database: &'a str,
+}
+
+pub(crate) enum Piece<'a> {
+    Text(&'a str),
+    Placeholder(&'a str),
+}
+
+/// Split `template` into text and `{placeholder}` pieces, accepting only the
+/// names in `placeholders`. Shared with [`crate::config::connect_notice`].
+pub(crate) fn parse<'a>(
+    template: &'a str,
+    placeholders: &[&str],
+) -> Result<Vec<Piece<'a>>, String> {
+    let mut pieces = Vec::new();
+    let mut rest = template;
+    while !rest.is_empty() {
+        match rest.find(['{', '}']) {
+            None => {
+                pieces.push(Piece::Text(rest));
+                break;
+            }
+            Some(pos) => {
+                if rest.as_bytes()[pos] == b'}' {
+                    return Err(format!(
+                        "unmatched '}}' at byte {}",
+                        template.len() - rest.len() + pos
+                    ));
+                }
+                if pos > 0 {
+                    pieces.push(Piece::Text(&rest[..pos]));
+                }
+                let after = &rest[pos + 1..];
+                let Some(end) = after.find('}') else {
+                    return Err("unclosed '{'".to_string());
+                };
+                let name = &after[..end];
+                if !placeholders.contains(&name) {
+                    return Err(format!(
+                        "unknown placeholder '{{{name}}}', expected one of: {}",
+                        placeholders
+                            .iter()
+                            .map(|p| format!("{{{p}}}"))
+                            .collect::<Vec<_>>()
+                            .join(", ")
+                    ));
+                }
+                pieces.push(Piece::Placeholder(name));
+                rest = &after[end + 1..];
+            }
+        }
+    }
+    Ok(pieces)
+}
+
+/// Reject templates `render` could not expand.
+pub fn validate(template: &str, scope: &str) -> Result<(), Error> {
+    if template.is_empty() {
+        return Err(Error::BadConfig(format!("{scope}: template is empty")));
+    }
+    parse(template, PLACEHOLDERS)
+        .map(|_| ())
+        .map_err(|err| Error::BadConfig(format!("{scope}: {err}")))
+}
+
+/// Expand `template` for one client. Invalid templates never reach this
+/// point (see [`validate`]); if one does, it is used verbatim.
+pub fn render(template: &str, client: &ClientIdentity<'_>) -> String {
+    let Ok(pieces) = parse(template, PLACEHOLDERS) else {
+        return crate::utils::strings::truncate_bytes(template, MAX_APPLICATION_NAME_LEN)
+            .to_string();
+    };
+    let mut out = String::with_capacity(template.len() + 32);
+    for piece in pieces {
+        match piece {
+            Piece::Text(text) => out.push_str(text),
+            Piece::Placeholder("client_app") => out.push_str(client.application_name),
+            Piece::Placeholder("client_ip") => match client.peer {
+                Some(peer) => out.push_str(&peer.ip().to_string()),
+                None => out.push_str("unix"),
+            },
+            Piece::Placeholder("client_port") => {
+                if let Some(peer) = client.peer {
+                    out.push_str(&peer.port().to_string());
+                }
+            }
+            Piece::Placeholder("user") => out.push_str(client.user),
+            Piece::Placeholder("database") => out.push_str(client.database),
+            Piece::Placeholder(_) => {}
+        }
+    }
+    let len = crate::utils::strings::truncate_bytes(&out, MAX_APPLICATION_NAME_LEN).len();
+    out.truncate(len);
+    out
+}
+
+/// Render the `application_name_template` of pool `pool_name`, or `None`
+/// when the pool has no template.
+pub fn for_pool(
+    config: &crate::config::Config,
+    pool_name: &str,
+    client: &ClientIdentity<'_>,
+) -> Option<String> {
+    let template = config
+        .pools
+        .get(pool_name)?
+        .application_name_template
+        .as_deref()?;
+    Some(render(template, client))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn tcp_client(app: &'static str) -> ClientIdentity<'static> {
+        ClientIdentity {
+            application_name: app,
+            peer: Some("10.1.2.3:54321".parse().unwrap()),
+            user: "alice",
+            database: "orders",
+        }
+    }
+
+    #[test]
+    fn renders_all_placeholders() {
+        let client = tcp_client("billing");
+        assert_eq!(
+            render("{client_app}@{client_ip}:{client_port}", &client),
+            "billing@10.1.2.3:54321"
+        );
+        assert_eq!(
+            render("{user}/{database} via pgd", &client),
+            "alice/orders via pgd"
+        );
+    }
+
+    #[test]
+    fn unix_client_has_no_port() {
+        let client = ClientIdentity {
+            peer: None,
+            ..tcp_client("psql")
+        };
+        assert_eq!(
+            render("{client_app}@{client_ip}:{client_port}", &client),
+            "psql@unix:"
+        );
+    }
+
+    #[test]
+    fn truncates_to_postgres_limit_on_char_boundary() {
+        let app: &'static str = Box::leak("я".repeat(40).into_boxed_str());
+        let rendered = render("{client_app}", &tcp_client(app));
+        assert_eq!(rendered.len(), 62);
+        assert!(rendered.chars().all(|c| c == 'я'));
+    }
+
+    #[test]
+    fn validate_rejects_bad_templates() {
+        let scope = "pools.x.application_name_template";
+        assert!(validate("{client_app}@{client_ip}", scope).is_ok());
+        assert!(validate("static-name", scope).is_ok());
+        for bad in ["", "{client_host}", "{client_app", "app}", "{}"] {
+            assert!(validate(bad, scope).is_err(), "{bad:?} should be rejected");
+        }
+    }
+}
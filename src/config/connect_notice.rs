@@ -0,0 +1,123 @@
+//! `connect_notice`: a NoticeResponse pg_doorman sends to every client right
+//! after login, e.g. `"connected via pg_doorman pool {database}, {pool_mode}
+//! mode"`, so whoever debugs an application can see which pooler, pool and
+//! mode it actually ended up on. psql and most drivers print or log it.
+//!
+//! The template syntax is the one of `application_name_template`; unknown
+//! placeholders and unbalanced braces are rejected at config load.
+
+use std::net::SocketAddr;
+
+use crate::config::application_name_template::{parse, Piece};
+use crate::errors::Error;
+
+/// Placeholders a template may reference.
+pub const PLACEHOLDERS: &[&str] = &["database", "user", "pool_mode", "client_ip", "version"];
+
+/// The connection the notice describes. `peer` is `None` for unix socket
+/// clients, rendered as `client_ip = "unix"`.
+pub struct ConnectInfo<'a> {
+    pub database: &'a str,
+    pub user: &'a str,
+    pub pool_mode: &'a str,
+    pub peer: Option<SocketAddr>,
+}
+
+/// Reject templates `render` could not expand. An empty template is
+/// allowed: on a pool it turns off the `general` notice.
+pub fn validate(template: &str, scope: &str) -> Result<(), Error> {
+    if template.contains('\0') {
+        return Err(Error::BadConfig(format!("{scope}: NUL byte in template")));
+    }
+    parse(template, PLACEHOLDERS)
+        .map(|_| ())
+        .map_err(|err| Error::BadConfig(format!("{scope}: {err}")))
+}
+
+/// Expand `template` for one connection. Invalid templates never reach
+/// this point (see [`validate`]); if one does, it is used verbatim.
+pub fn render(template: &str, info: &ConnectInfo<'_>) -> String {
+    let Ok(pieces) = parse(template, PLACEHOLDERS) else {
+        return template.to_string();
+    };
+    let mut out = String::with_capacity(template.len() + 32);
+    for piece in pieces {
+        match piece {
+            Piece::Text(text) => out.push_str(text),
+            Piece::Placeholder("database") => out.push_str(info.database),
+            Piece::Placeholder("user") => out.push_str(info.user),
+            Piece::Placeholder("pool_mode") => out.push_str(info.pool_mode),
+            Piece::Placeholder("client_ip") => match info.peer {
+                Some(peer) => out.push_str(&peer.ip().to_string()),
+                None => out.push_str("unix"),
+            },
+            Piece::Placeholder("version") => out.push_str(crate::config::VERSION),
+            Piece::Placeholder(_) => {}
+        }
+    }
+    out
+}
+
+/// Rendered notice for a client of pool `pool_name`: the pool's
+/// `connect_notice` if set, else `general.connect_notice`. `None` when
+/// neither is set or the chosen one is empty.
+pub fn for_pool(
+    config: &crate::config::Config,
+    pool_name: &str,
+    info: &ConnectInfo<'_>,
+) -> Option<String> {
+    let template = config
+        .pools
+        .get(pool_name)
+        .and_then(|pool| pool.connect_notice.as_deref())
+        .or(config.general.connect_notice.as_deref())?;
+    if template.is_empty() {
+        return None;
+    }
+    Some(render(template, info))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn info() -> ConnectInfo<'static> {
+        ConnectInfo {
+            database: "orders",
+            user: "alice",
+            pool_mode: "transaction",
+            peer: Some("10.1.2.3:54321".parse().unwrap()),
+        }
+    }
+
+    #[test]
+    fn renders_all_placeholders() {
+        assert_eq!(
+            render(
+                "connected via pg_doorman pool {database}, {pool_mode} mode",
+                &info()
+            ),
+            "connected via pg_doorman pool orders, transaction mode"
+        );
+        assert_eq!(render("{user}@{client_ip}", &info()), "alice@10.1.2.3");
+        assert_eq!(
+            render("pg_doorman {version}", &info()),
+            format!("pg_doorman {}", crate::config::VERSION)
+        );
+        let unix = ConnectInfo {
+            peer: None,
+            ..info()
+        };
+        assert_eq!(render("{client_ip}", &unix), "unix");
+    }
+
+    #[test]
+    fn validate_rejects_bad_templates() {
+        let scope = "general.connect_notice";
+        assert!(validate("pool {database}", scope).is_ok());
+        assert!(validate("", scope).is_ok());
+        for bad in ["{client_app}", "{database", "mode}", "a\0b"] {
+            assert!(validate(bad, scope).is_err(), "{bad:?} should be rejected");
+        }
+    }
+}
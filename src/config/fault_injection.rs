@@ -0,0 +1,122 @@
+//! Per-pool fault injection (`pools.<name>.fault_injection`) for chaos
+//! tests in staging: artificial latency, dropped requests, truncated
+//! responses and backend disconnects. Ignored unless
+//! `general.enable_fault_injection` is set, so a copied staging pool
+//! section cannot break production by itself.
+
+use serde::{Deserialize, Serialize};
+use std::hash::{Hash, Hasher};
+
+use super::Duration;
+use crate::errors::Error;
+
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq)]
+pub struct FaultInjection {
+    /// Delay added before every request reaches the backend.
+    #[serde(default)]
+    pub latency: Duration,
+
+    /// Random extra delay on top of `latency`, uniform in `0..latency_jitter`.
+    #[serde(default)]
+    pub latency_jitter: Duration,
+
+    /// Share of requests (0.0–1.0) that never reach the backend; the
+    /// client connection is closed without a reply, as if the network
+    /// lost it.
+    #[serde(default)]
+    pub drop_probability: f64,
+
+    /// Share of requests (0.0–1.0) whose response is cut off in the
+    /// middle of a message before the client connection is closed.
+    #[serde(default)]
+    pub truncate_probability: f64,
+
+    /// Share of requests (0.0–1.0) after which the backend connection is
+    /// closed while the statement runs; the client gets SQLSTATE 08006.
+    #[serde(default)]
+    pub disconnect_probability: f64,
+}
+
+// Probabilities are checked by `validate`, so NaN never gets this far.
+impl Eq for FaultInjection {}
+
+impl Hash for FaultInjection {
+    fn hash<H: Hasher>(&self, state: &mut H) {
+        self.latency.hash(state);
+        self.latency_jitter.hash(state);
+        self.drop_probability.to_bits().hash(state);
+        self.truncate_probability.to_bits().hash(state);
+        self.disconnect_probability.to_bits().hash(state);
+    }
+}
+
+impl FaultInjection {
+    pub fn validate(&self) -> Result<(), Error> {
+        for (name, value) in [
+            ("drop_probability", self.drop_probability),
+            ("truncate_probability", self.truncate_probability),
+            ("disconnect_probability", self.disconnect_probability),
+        ] {
+            if !(0.0..=1.0).contains(&value) {
+                return Err(Error::BadConfig(format!(
+                    "fault_injection.{name} must be between 0.0 and 1.0, got {value}"
+                )));
+            }
+        }
+        let total = self.drop_probability + self.truncate_probability + self.disconnect_probability;
+        if total > 1.0 {
+            return Err(Error::BadConfig(format!(
+                "fault_injection probabilities must add up to at most 1.0, got {total}"
+            )));
+        }
+        Ok(())
+    }
+
+    /// Whether any fault is configured.
+    pub fn is_active(&self) -> bool {
+        self.latency.as_millis() > 0
+            || self.latency_jitter.as_millis() > 0
+            || self.drop_probability > 0.0
+            || self.truncate_probability > 0.0
+            || self.disconnect_probability > 0.0
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn rejects_probability_out_of_range() {
+        let faults = FaultInjection {
+            drop_probability: 1.5,
+            ..Default::default()
+        };
+        assert!(faults.validate().is_err());
+        let faults = FaultInjection {
+            disconnect_probability: f64::NAN,
+            ..Default::default()
+        };
+        assert!(faults.validate().is_err());
+        let faults = FaultInjection {
+            drop_probability: 0.6,
+            disconnect_probability: 0.6,
+            ..Default::default()
+        };
+        assert!(faults.validate().is_err());
+    }
+
+    #[test]
+    fn parses_durations_and_probabilities() {
+        let faults: FaultInjection = serde_yaml::from_str(
+            "latency: 50ms\nlatency_jitter: 20ms\ndisconnect_probability: 0.01\n",
+        )
+        .unwrap();
+        assert_eq!(faults.latency, Duration::from_millis(50));
+        assert_eq!(faults.latency_jitter, Duration::from_millis(20));
+        assert_eq!(faults.disconnect_probability, 0.01);
+        assert!(faults.validate().is_ok());
+        assert!(faults.is_active());
+        assert!(!FaultInjection::default().is_active());
+    }
+}
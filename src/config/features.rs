@@ -0,0 +1,167 @@
+//! Feature flags for experimental behavior (`general.features`, admin
+//! `SET FEATURE`).
+//!
+//! Every flag is on unless `general.features` turns it off, so a flag is a
+//! kill switch: a behavior that misbehaves on one instance can be switched
+//! off there, from the config file or from the admin console, without a
+//! rebuild. `SET FEATURE` outlives `RELOAD` (an unrelated reload must not
+//! switch a disabled behavior back on) and is lost on restart;
+//! `SET FEATURE <name> = default` goes back to the config value.
+
+use std::collections::BTreeMap;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use super::config_arc;
+use crate::errors::Error;
+
+/// Adaptive pool sizing (`users[].max_pool_size`). Off holds every pool at
+/// `pool_size`.
+pub const ADAPTIVE_POOL_SIZING: &str = "adaptive_pool_sizing";
+/// Direct TLS to servers (`server_tls_negotiation = "direct"`). Off sends
+/// SSLRequest first, as with `postgres` negotiation.
+pub const DIRECT_TLS: &str = "direct_tls";
+
+/// Known flags with the description shown by `SHOW FEATURES`.
+pub const FEATURES: &[(&str, &str)] = &[
+    (
+        ADAPTIVE_POOL_SIZING,
+        "grow pools toward users[].max_pool_size under checkout waits",
+    ),
+    (
+        DIRECT_TLS,
+        "start server TLS without SSLRequest when server_tls_negotiation = direct",
+    ),
+];
+
+/// Flags set with `SET FEATURE`.
+static OVERRIDES: Lazy<Mutex<BTreeMap<&'static str, bool>>> =
+    Lazy::new(|| Mutex::new(BTreeMap::new()));
+
+/// One row of `SHOW FEATURES`.
+pub struct FeatureState {
+    pub name: &'static str,
+    pub enabled: bool,
+    /// `default`, `file` or `runtime`, as the `origin` of `SHOW CONFIG`.
+    pub origin: &'static str,
+    pub description: &'static str,
+}
+
+fn known(name: &str) -> Option<&'static str> {
+    FEATURES
+        .iter()
+        .map(|(known, _)| *known)
+        .find(|known| known.eq_ignore_ascii_case(name))
+}
+
+fn unknown(name: &str) -> String {
+    let names: Vec<&str> = FEATURES.iter().map(|(name, _)| *name).collect();
+    format!(
+        "unknown feature {name}. Known features: {}",
+        names.join(", ")
+    )
+}
+
+fn state(
+    name: &'static str,
+    file: &BTreeMap<String, bool>,
+    overrides: &BTreeMap<&'static str, bool>,
+) -> (bool, &'static str) {
+    if let Some(&enabled) = overrides.get(name) {
+        (enabled, "runtime")
+    } else if let Some(&enabled) = file.get(name) {
+        (enabled, "file")
+    } else {
+        (true, "default")
+    }
+}
+
+/// Whether the flag `name` (one of the constants above) is on.
+pub fn enabled(name: &'static str) -> bool {
+    state(name, &config_arc().general.features, &OVERRIDES.lock()).0
+}
+
+/// All flags, for `SHOW FEATURES`.
+pub fn list() -> Vec<FeatureState> {
+    let config = config_arc();
+    let overrides = OVERRIDES.lock();
+    FEATURES
+        .iter()
+        .map(|&(name, description)| {
+            let (enabled, origin) = state(name, &config.general.features, &overrides);
+            FeatureState {
+                name,
+                enabled,
+                origin,
+                description,
+            }
+        })
+        .collect()
+}
+
+/// Apply `SET FEATURE <name> = on | off | default` and return the flag's
+/// canonical name.
+pub fn set(name: &str, value: &str) -> Result<&'static str, String> {
+    let key = known(name).ok_or_else(|| unknown(name))?;
+    let mut overrides = OVERRIDES.lock();
+    match value.to_ascii_lowercase().as_str() {
+        "on" | "true" | "yes" | "1" => overrides.insert(key, true),
+        "off" | "false" | "no" | "0" => overrides.insert(key, false),
+        "default" => overrides.remove(key),
+        _ => {
+            return Err(format!(
+                "invalid value for feature {key}: '{value}' (expected on, off or default)"
+            ));
+        }
+    };
+    Ok(key)
+}
+
+/// Reject unknown names in `general.features`.
+pub fn validate(features: &BTreeMap<String, bool>) -> Result<(), Error> {
+    for name in features.keys() {
+        if FEATURES.iter().all(|(known, _)| known != name) {
+            return Err(Error::BadConfig(format!(
+                "general.features: {}",
+                unknown(name)
+            )));
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn runtime_wins_over_file_and_file_over_default() {
+        let mut file = BTreeMap::new();
+        let mut overrides = BTreeMap::new();
+        assert_eq!(state(DIRECT_TLS, &file, &overrides), (true, "default"));
+        file.insert(DIRECT_TLS.to_string(), false);
+        assert_eq!(state(DIRECT_TLS, &file, &overrides), (false, "file"));
+        overrides.insert(DIRECT_TLS, true);
+        assert_eq!(state(DIRECT_TLS, &file, &overrides), (true, "runtime"));
+        assert_eq!(
+            state(ADAPTIVE_POOL_SIZING, &file, &overrides),
+            (true, "default")
+        );
+    }
+
+    #[test]
+    fn names_are_checked() {
+        assert_eq!(known("Direct_TLS"), Some(DIRECT_TLS));
+        assert!(set("turbo", "on")
+            .unwrap_err()
+            .contains("adaptive_pool_sizing"));
+        assert!(set(DIRECT_TLS, "maybe").is_err());
+
+        let mut features = BTreeMap::new();
+        features.insert(ADAPTIVE_POOL_SIZING.to_string(), false);
+        assert!(validate(&features).is_ok());
+        features.insert("turbo".to_string(), true);
+        assert!(validate(&features).is_err());
+    }
+}
@@ -6,6 +6,7 @@ use serde_derive::{Deserialize, Serialize};
 use super::tls;
 use super::{ByteSize, Duration, Include};
 use crate::auth::hba::PgHba;
+use crate::messages::constants::{PROTOCOL_VERSION_3_2, PROTOCOL_VERSION_NUMBER};
 
 /// General configuration.
 #[derive(Serialize, Deserialize, Debug, Clone, PartialEq)]
@@ -28,7 +29,26 @@ pub struct General {
     #[serde(default = "General::default_query_wait_timeout")]
     pub query_wait_timeout: Duration,
 
-    #[serde(default = "General::default_idle_timeout")]
+    /// Drop clients that have not finished startup and authentication
+    /// within this time (0 = no limit).
+    #[serde(default = "General::default_client_login_timeout")]
+    pub client_login_timeout: Duration,
+
+    /// Close clients idle outside a transaction for longer than this
+    /// (0 = disabled).
+    #[serde(default = "General::default_client_idle_timeout")]
+    pub client_idle_timeout: Duration,
+
+    /// Disconnect a client that does not read a server response for longer
+    /// than this (0 = disabled).
+    #[serde(default = "General::default_client_write_timeout")]
+    pub client_write_timeout: Duration,
+
+    /// Also accepted as `server_idle_timeout`, the PgBouncer name.
+    #[serde(
+        default = "General::default_idle_timeout",
+        alias = "server_idle_timeout"
+    )]
     pub idle_timeout: Duration,
 
     #[serde(default = "General::default_tcp_keepalives_idle")]
@@ -46,10 +66,21 @@ pub struct General {
     /// Helps detect dead connections faster than keepalive by setting a timeout
     /// on unacknowledged data. Only supported on Linux.
     /// 0 means disabled (uses OS default).
-    /// Default: 0 (disabled)
+    /// Default: 60
     #[serde(default = "General::default_tcp_user_timeout")]
     pub tcp_user_timeout: u64,
 
+    /// Backend-socket overrides of `tcp_keepalives_*` and `tcp_user_timeout`
+    /// (seconds). Unset: backend sockets use the client-side values.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_tcp_keepalives_idle: Option<u64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_tcp_keepalives_interval: Option<u64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_tcp_keepalives_count: Option<u32>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_tcp_user_timeout: Option<u64>,
+
     #[serde(default = "General::default_unix_socket_buffer_size")]
     pub unix_socket_buffer_size: ByteSize,
 
@@ -82,18 +113,89 @@ pub struct General {
     #[serde(default)] // True
     pub log_client_disconnections: bool,
 
+    /// Log client and server connection events with their reasons under
+    /// the `pg_doorman::events` target. They are counted either way.
+    #[serde(default)]
+    pub log_connection_events: bool,
+
     #[serde(default = "General::default_shutdown_timeout")] // 10_000
     pub shutdown_timeout: Duration,
 
+    /// How long `HOLD` queues new transactions before the pool resumes by
+    /// itself.
+    #[serde(default = "General::default_hold_timeout")] // 30_000
+    pub hold_timeout: Duration,
+
     #[serde(default = "General::default_message_size_to_be_stream")] // 1024 * 1024
     pub message_size_to_be_stream: ByteSize,
 
     #[serde(default = "General::default_max_memory_usage")] // 256m
     pub max_memory_usage: ByteSize,
 
+    /// Largest message a client may send (Query, Parse, Bind, CopyData, ...).
+    /// Longer length prefixes are rejected before any allocation.
+    #[serde(default = "General::default_max_client_message_size")] // 256m
+    pub max_client_message_size: ByteSize,
+
+    /// Maximum number of extended protocol messages a client may queue
+    /// before Sync or Flush (0 = unlimited).
+    #[serde(default)]
+    pub max_pipeline_depth: usize,
+
     #[serde(default = "General::default_max_connections")]
     pub max_connections: u64,
 
+    /// Number of clients above which each new connection evicts the
+    /// longest idle client of a user over its share (0 = no eviction).
+    #[serde(default)]
+    pub max_connections_soft: u64,
+
+    /// Maximum number of clients in startup or authentication at once
+    /// (0 = unlimited). Extra connections are closed without a reply.
+    #[serde(default = "General::default_max_client_handshakes")]
+    pub max_client_handshakes: usize,
+
+    /// Maximum number of clients authenticating at once (0 = unlimited).
+    /// Others wait in the login queue.
+    #[serde(default = "General::default_max_concurrent_logins")]
+    pub max_concurrent_logins: usize,
+
+    /// Maximum number of clients waiting in the login queue
+    /// (0 = unlimited). Extra clients are rejected with SQLSTATE 53300.
+    #[serde(default = "General::default_max_login_queue")]
+    pub max_login_queue: usize,
+
+    /// Authentication failures from one IP address within
+    /// `auth_ban_window` after which the address is banned (0 = never).
+    #[serde(default)]
+    pub auth_ban_threshold: u32,
+
+    #[serde(default = "General::default_auth_ban_window")]
+    pub auth_ban_window: Duration,
+
+    /// Length of the first ban of an address; each further ban is twice
+    /// as long, up to `auth_ban_max_time`.
+    #[serde(default = "General::default_auth_ban_time")]
+    pub auth_ban_time: Duration,
+
+    #[serde(default = "General::default_auth_ban_max_time")]
+    pub auth_ban_max_time: Duration,
+
+    /// Addresses or CIDRs of upstream poolers whose
+    /// `client_identity_parameter` is taken as the client's address.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub trusted_upstream_poolers: Vec<String>,
+
+    /// Startup parameter in which a trusted upstream pooler names the
+    /// original client.
+    #[serde(default = "General::default_client_identity_parameter")]
+    pub client_identity_parameter: String,
+
+    /// Open file descriptors, as a percentage of RLIMIT_NOFILE, above
+    /// which a warning is logged (0-100, 0 = no warning).
+    #[serde(default = "General::default_fd_usage_warn_percent")]
+    pub fd_usage_warn_percent: u32,
+
     /// Maximum number of server connections that can be created concurrently.
     /// Uses a semaphore to limit parallel connection creation instead of serializing with mutex.
     #[serde(default = "General::default_max_concurrent_creates")]
@@ -115,6 +217,16 @@ pub struct General {
     #[serde(default = "General::default_scaling_max_parallel_creates")]
     pub scaling_max_parallel_creates: u32,
 
+    /// Mean checkout wait above which a pool with `max_pool_size` grows
+    /// (adaptive pool sizing). It shrinks back once the wait stays below
+    /// half of this and backends sit idle.
+    #[serde(default = "General::default_adaptive_pool_wait_target")]
+    pub adaptive_pool_wait_target: Duration,
+
+    /// How often adaptive pool sizing re-evaluates each pool.
+    #[serde(default = "General::default_adaptive_pool_interval")]
+    pub adaptive_pool_interval: Duration,
+
     #[serde(default = "General::default_server_lifetime")]
     pub server_lifetime: Duration,
 
@@ -127,6 +239,24 @@ pub struct General {
     #[serde(default = "General::default_retain_connections_max")]
     pub retain_connections_max: usize,
 
+    /// Drop a pool created from the `pools."*"` template once no client
+    /// has connected to it for this long.
+    #[serde(default = "General::default_autodb_idle_timeout")]
+    pub autodb_idle_timeout: Duration,
+
+    /// Most pools created from templates at a time. 0 means unlimited.
+    #[serde(default = "General::default_autodb_max_pools")]
+    pub autodb_max_pools: usize,
+
+    /// Most pools created from templates per second. 0 means unlimited.
+    #[serde(default = "General::default_autodb_create_rate")]
+    pub autodb_create_rate: usize,
+
+    /// File that pools created with the admin `CREATE POOL` command are
+    /// kept in, so they survive a restart. Unset: they last until restart.
+    #[serde(default)]
+    pub managed_pools_file: Option<String>,
+
     /// Time after which an idle server connection should be checked before being
     /// given to a client. This helps detect dead connections caused by PostgreSQL
     /// restart, network issues, or server-side idle timeouts.
@@ -135,12 +265,100 @@ pub struct General {
     #[serde(default = "General::default_server_idle_check_timeout")]
     pub server_idle_check_timeout: Duration,
 
+    /// Re-resolve backend hostnames on this interval and retire pooled
+    /// connections whose address left the DNS record.
+    /// 0 means disabled.
+    /// Default: 0
+    #[serde(default = "General::default_dns_refresh_interval")]
+    pub dns_refresh_interval: Duration,
+
+    /// Re-check `pg_is_in_recovery()` on pooled connections of pools with
+    /// `target_session_attrs` at most this often, and close connections to
+    /// hosts that switched roles.
+    /// 0 means disabled (role checked only when connecting).
+    /// Default: 0
+    #[serde(default = "General::default_server_role_check_interval")]
+    pub server_role_check_interval: Duration,
+
+    /// Check the backend memory of pooled connections of pools with
+    /// `server_max_memory` at most this often.
+    /// Default: 5m
+    #[serde(default = "General::default_server_memory_check_interval")]
+    pub server_memory_check_interval: Duration,
+
+    /// Maintenance windows (`[DAYS ]HH:MM-HH:MM`, local time) during which
+    /// server connections opened before the window are recycled at
+    /// `server_recycle_rate`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub server_recycle_windows: Vec<String>,
+
+    /// Server connections closed per second inside a recycle window,
+    /// across all pools.
+    /// Default: 5
+    #[serde(default = "General::default_server_recycle_rate")]
+    pub server_recycle_rate: usize,
+
+    /// Connect failures in a row that open a pool's backend circuit
+    /// breaker. 0 disables the breaker.
+    /// Default: 0
+    #[serde(default = "General::default_circuit_breaker_threshold")]
+    pub circuit_breaker_threshold: u32,
+
+    /// How long an open circuit breaker fails checkouts before letting one
+    /// probe connect through.
+    /// Default: 10s
+    #[serde(default = "General::default_circuit_breaker_cooldown")]
+    pub circuit_breaker_cooldown: Duration,
+
+    /// How many times a checkout that failed to reach a backend is
+    /// repeated before the client gets the error.
+    /// Default: 0
+    #[serde(default = "General::default_server_checkout_retries")]
+    pub server_checkout_retries: u32,
+
+    /// Custom startup parameter (e.g. `doorman.pool`) a client sets, on
+    /// its own or with `-c` in `options`, to pick the pool to use instead
+    /// of the one named after its database. Unset: disabled.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub client_pool_parameter: Option<String>,
+
+    /// Custom startup parameter (e.g. `doorman.tag`) a client sets, on
+    /// its own or with `-c` in `options`, to tag its connection for the
+    /// pool's `client_tag_limits` and the per-tag metrics. Unset: disabled.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub client_tag_parameter: Option<String>,
+
+    /// NoticeResponse sent to every client after login, e.g.
+    /// `"connected via pg_doorman pool {database}, {pool_mode} mode"`.
+    /// See [`crate::config::connect_notice`]. Unset: no notice.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub connect_notice: Option<String>,
+
     #[serde(default = "General::default_server_round_robin")] // False
     pub server_round_robin: bool,
 
+    /// Protocol version requested from PostgreSQL: "3.0" or "3.2".
+    /// Servers older than PostgreSQL 18 negotiate 3.2 down to 3.0.
+    #[serde(default = "General::default_server_max_protocol_version")]
+    pub server_max_protocol_version: String,
+
     #[serde(default = "General::default_sync_server_parameters")] // False
     pub sync_server_parameters: bool,
 
+    /// In transaction mode, keep a client on its backend for the rest of the
+    /// session after it creates temp tables, session advisory locks or
+    /// cursors WITH HOLD.
+    /// Default: true
+    #[serde(default = "General::default_auto_session_pinning")]
+    pub auto_session_pinning: bool,
+
+    /// What to do with PREPARE TRANSACTION in transaction mode.
+    /// Default: pin
+    #[serde(default)]
+    pub two_phase_commit: TwoPhaseCommit,
+
+    /// Tokio worker threads. 0 = one per CPU available to the process,
+    /// resolved at config load.
     #[serde(default = "General::default_worker_threads")]
     pub worker_threads: usize,
 
@@ -150,6 +368,16 @@ pub struct General {
     // worker_cpu_affinity_pinning: пытаемся пинить каждый worker на CPU, начиная со второго CPU.
     #[serde(default = "General::default_worker_cpu_affinity_pinning")]
     pub worker_cpu_affinity_pinning: bool,
+    /// Log a state dump when a worker's event loop makes no progress for
+    /// this long (0 = disabled).
+    #[serde(default = "General::default_stall_watchdog_timeout")]
+    pub stall_watchdog_timeout: Duration,
+    /// Directory for `DUMP STATE` / SIGUSR1 state dump files.
+    #[serde(default = "General::default_state_dump_dir")]
+    pub state_dump_dir: String,
+    /// Honour `fault_injection` sections of pools. Staging only.
+    #[serde(default = "General::default_enable_fault_injection")]
+    pub enable_fault_injection: bool,
     // worker_stack_size: размера стэка каждого воркера.
     #[serde(default, skip_serializing_if = "Option::is_none")]
     pub worker_stack_size: Option<ByteSize>,
@@ -164,6 +392,10 @@ pub struct General {
     #[serde(default = "General::default_pooler_check_query")]
     pub pooler_check_query: String,
 
+    // show_local_parameters: parameters whose `SHOW` is answered without a backend.
+    #[serde(default = "General::default_show_local_parameters")]
+    pub show_local_parameters: Vec<String>,
+
     #[serde(skip_serializing_if = "Option::is_none")]
     pub tls_certificate: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
@@ -174,10 +406,31 @@ pub struct General {
     pub tls_mode: Option<String>,
     #[serde(default = "General::default_tls_rate_limit_per_second")]
     pub tls_rate_limit_per_second: usize,
+    // Client TLS policy: protocol versions ("1.2", "1.3"), cipher list for
+    // TLS 1.2, TLS 1.3 cipher suites and key exchange groups (OpenSSL syntax).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_min_version: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_max_version: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_ciphers: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_ciphersuites: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_groups: Option<String>,
+
+    /// Refuse logins that send a secret in clear text (PAM passwords, JWT
+    /// and Talos tokens) unless the client is on TLS or a Unix socket.
+    #[serde(default)]
+    pub plain_auth_require_tls: bool,
 
     #[serde(default = "General::default_server_tls_mode")]
     pub server_tls_mode: String,
 
+    /// `postgres` (SSLRequest) or `direct` (TLS with ALPN right away).
+    #[serde(default = "General::default_server_tls_negotiation")]
+    pub server_tls_negotiation: String,
+
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_tls_ca_cert: Option<String>,
 
@@ -208,9 +461,18 @@ pub struct General {
     #[serde(default, skip_serializing_if = "Option::is_none")]
     pub fallback_lifetime: Option<super::Duration>,
 
+    /// Default Patroni discovery interval for pools with `patroni_api_urls`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub patroni_discovery_interval: Option<super::Duration>,
+
     pub admin_username: String,
     pub admin_password: String,
 
+    /// Users allowed into the admin database for `SHOW` commands only.
+    /// They log in with the password of the same user under `pools.*.users`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub stats_users: Vec<String>,
+
     #[serde(default = "General::default_prepared_statements")]
     pub prepared_statements: bool,
 
@@ -262,12 +524,23 @@ pub struct General {
     #[serde(default = "General::default_query_interner_anon_idle_ttl_seconds")]
     pub query_interner_anon_idle_ttl_seconds: u64,
 
+    /// Upper bound on anonymous interner entries. When a GC sweep finds
+    /// more, the least recently used entries are dropped until the count
+    /// fits. `0` means no limit (only the idle TTL bounds the interner).
+    #[serde(default = "General::default_query_interner_anon_max_entries")]
+    pub query_interner_anon_max_entries: usize,
+
     #[serde(default = "General::default_daemon_pid_file")]
     pub daemon_pid_file: String, // can be enabled only in daemon mode.
 
     #[serde(skip_serializing_if = "Option::is_none")]
     pub syslog_prog_name: Option<String>,
 
+    /// Destination of the audit log of DDL, privilege and role changes and
+    /// superuser statements: a file path, or `syslog`. Disabled when unset.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub audit_log: Option<String>,
+
     #[serde(
         default = "General::default_hba",
         skip_serializing_if = "<[_]>::is_empty"
@@ -289,6 +562,34 @@ pub struct General {
     /// retry, fallback, or per-key quarantine for the backend's verdict.
     #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
     pub startup_parameters: std::collections::BTreeMap<String, String>,
+
+    /// Switches for experimental behavior (`config::features`). Every
+    /// feature is on unless turned off here or with `SET FEATURE`.
+    #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
+    pub features: std::collections::BTreeMap<String, bool>,
+}
+
+/// Policy for `PREPARE TRANSACTION` in transaction mode:
+/// - pin: keep the client on its backend and track the prepared transaction,
+/// - reject: refuse the statement and roll the transaction back.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Copy, Default)]
+pub enum TwoPhaseCommit {
+    #[default]
+    #[serde(alias = "pin", alias = "Pin")]
+    Pin,
+
+    #[serde(alias = "reject", alias = "Reject")]
+    Reject,
+}
+
+impl std::fmt::Display for TwoPhaseCommit {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let str = match *self {
+            TwoPhaseCommit::Pin => "pin",
+            TwoPhaseCommit::Reject => "reject",
+        };
+        write!(f, "{str}")
+    }
 }
 
 impl General {
@@ -307,6 +608,10 @@ impl General {
     pub fn default_server_tls_mode() -> String {
         "allow".to_string()
     }
+
+    pub fn default_server_tls_negotiation() -> String {
+        "postgres".to_string()
+    }
     pub fn default_server_lifetime() -> Duration {
         Duration::from_mins(20) // 20 min
     }
@@ -319,10 +624,50 @@ impl General {
         3 // close up to 3 connections per retain cycle
     }
 
+    pub fn default_autodb_idle_timeout() -> Duration {
+        Duration::from_hours(1)
+    }
+
+    pub fn default_autodb_max_pools() -> usize {
+        100
+    }
+
+    pub fn default_autodb_create_rate() -> usize {
+        10
+    }
+
     pub fn default_server_idle_check_timeout() -> Duration {
         Duration::from_secs(60) // 60 seconds
     }
 
+    pub fn default_dns_refresh_interval() -> Duration {
+        Duration::from_millis(0) // disabled
+    }
+
+    pub fn default_server_role_check_interval() -> Duration {
+        Duration::from_millis(0) // disabled
+    }
+
+    pub fn default_server_memory_check_interval() -> Duration {
+        Duration::from_mins(5)
+    }
+
+    pub fn default_server_recycle_rate() -> usize {
+        5
+    }
+
+    pub fn default_circuit_breaker_threshold() -> u32 {
+        0 // disabled
+    }
+
+    pub fn default_circuit_breaker_cooldown() -> Duration {
+        Duration::from_secs(10)
+    }
+
+    pub fn default_server_checkout_retries() -> u32 {
+        0 // disabled
+    }
+
     pub fn default_connect_timeout() -> Duration {
         Duration::from_millis(3_000)
     }
@@ -331,6 +676,18 @@ impl General {
         Duration::from_millis(5000)
     }
 
+    pub fn default_client_login_timeout() -> Duration {
+        Duration::from_millis(60_000)
+    }
+
+    pub fn default_client_idle_timeout() -> Duration {
+        Duration::from_millis(0)
+    }
+
+    pub fn default_client_write_timeout() -> Duration {
+        Duration::from_millis(0)
+    }
+
     pub fn default_tcp_so_linger() -> u64 {
         0 // 0 seconds
     }
@@ -379,6 +736,18 @@ impl General {
         false
     }
 
+    pub fn default_stall_watchdog_timeout() -> Duration {
+        Duration::from_millis(0)
+    }
+
+    pub fn default_state_dump_dir() -> String {
+        "/tmp".to_string()
+    }
+
+    pub fn default_enable_fault_injection() -> bool {
+        false
+    }
+
     pub fn default_max_memory_usage() -> ByteSize {
         ByteSize::from_mb(256) // 256mb
     }
@@ -387,6 +756,38 @@ impl General {
         8 * 1024
     }
 
+    pub fn default_max_client_handshakes() -> usize {
+        0
+    }
+
+    pub fn default_max_concurrent_logins() -> usize {
+        0
+    }
+
+    pub fn default_max_login_queue() -> usize {
+        0
+    }
+
+    pub fn default_auth_ban_window() -> Duration {
+        Duration::from_mins(1)
+    }
+
+    pub fn default_auth_ban_time() -> Duration {
+        Duration::from_mins(1)
+    }
+
+    pub fn default_auth_ban_max_time() -> Duration {
+        Duration::from_hours(1)
+    }
+
+    pub fn default_client_identity_parameter() -> String {
+        "doorman.client_addr".to_string()
+    }
+
+    pub fn default_fd_usage_warn_percent() -> u32 {
+        80
+    }
+
     /// Default maximum number of concurrent server connection creates.
     /// Allows up to 4 connections to be created in parallel per pool.
     pub fn default_max_concurrent_creates() -> usize {
@@ -408,6 +809,14 @@ impl General {
         2
     }
 
+    pub fn default_adaptive_pool_wait_target() -> Duration {
+        Duration::from_millis(50)
+    }
+
+    pub fn default_adaptive_pool_interval() -> Duration {
+        Duration::from_secs(10)
+    }
+
     pub fn default_backlog() -> u32 {
         0
     }
@@ -420,6 +829,22 @@ impl General {
         false
     }
 
+    pub fn default_server_max_protocol_version() -> String {
+        "3.0".to_string()
+    }
+
+    /// StartupMessage protocol version for backend connections.
+    pub fn server_protocol_version(&self) -> i32 {
+        match self.server_max_protocol_version.as_str() {
+            "3.2" => PROTOCOL_VERSION_3_2,
+            _ => PROTOCOL_VERSION_NUMBER,
+        }
+    }
+
+    pub fn default_auto_session_pinning() -> bool {
+        true
+    }
+
     // These keepalive defaults should detect a dead connection within 30 seconds.
     // Tokio defaults to disabling keepalives which keeps dead connections around indefinitely.
     // This can lead to permanent server pool exhaustion
@@ -448,6 +873,10 @@ impl General {
         Duration::from_secs(10) // 10 seconds
     }
 
+    pub fn default_hold_timeout() -> Duration {
+        Duration::from_secs(30) // 30 seconds
+    }
+
     pub fn default_proxy_copy_data_timeout() -> Duration {
         Duration::from_secs(15) // 15 seconds
     }
@@ -456,10 +885,23 @@ impl General {
         ByteSize::from_mb(1) // 1mb
     }
 
+    pub fn default_max_client_message_size() -> ByteSize {
+        ByteSize::from_mb(256)
+    }
+
     pub fn default_worker_threads() -> usize {
         4
     }
 
+    /// CPUs this process may run on. Includes the affinity mask and the
+    /// cgroup CPU quota, so a container limited to 2 CPUs gets 2 on a
+    /// 64-core host.
+    pub fn available_cpus() -> usize {
+        std::thread::available_parallelism()
+            .map(|n| n.get())
+            .unwrap_or_else(|_| Self::default_worker_threads())
+    }
+
     pub fn default_server_round_robin() -> bool {
         false
     }
@@ -479,6 +921,10 @@ impl General {
         60
     }
 
+    pub fn default_query_interner_anon_max_entries() -> usize {
+        0
+    }
+
     pub fn default_daemon_pid_file() -> String {
         "/tmp/pg_doorman.pid".to_string()
     }
@@ -504,6 +950,22 @@ impl General {
         ";".to_string()
     }
 
+    pub fn default_show_local_parameters() -> Vec<String> {
+        [
+            "server_version",
+            "server_encoding",
+            "client_encoding",
+            "DateStyle",
+            "IntervalStyle",
+            "TimeZone",
+            "standard_conforming_strings",
+            "integer_datetimes",
+        ]
+        .iter()
+        .map(|s| s.to_string())
+        .collect()
+    }
+
     pub fn default_hba() -> Vec<IpNet> {
         vec![]
     }
@@ -518,6 +980,12 @@ impl General {
         }
     }
 
+    /// True when `username` may only read the admin console. The admin
+    /// user keeps full access even if it is also listed in `stats_users`.
+    pub fn is_stats_user(&self, username: &str) -> bool {
+        username != self.admin_username && self.stats_users.iter().any(|user| user == username)
+    }
+
     pub fn only_ssl_connections(&self) -> bool {
         self.tls_mode
             .as_ref()
@@ -543,18 +1011,39 @@ impl Default for General {
             tokio_event_interval: None,
             connect_timeout: General::default_connect_timeout(),
             query_wait_timeout: General::default_query_wait_timeout(),
+            client_login_timeout: General::default_client_login_timeout(),
+            client_idle_timeout: General::default_client_idle_timeout(),
+            client_write_timeout: General::default_client_write_timeout(),
             idle_timeout: General::default_idle_timeout(),
             shutdown_timeout: Self::default_shutdown_timeout(),
+            hold_timeout: Self::default_hold_timeout(),
             proxy_copy_data_timeout: Self::default_proxy_copy_data_timeout(),
             message_size_to_be_stream: Self::default_message_size_to_be_stream(),
             max_memory_usage: Self::default_max_memory_usage(),
+            max_client_message_size: Self::default_max_client_message_size(),
             max_connections: Self::default_max_connections(),
+            max_connections_soft: 0,
+            max_client_handshakes: Self::default_max_client_handshakes(),
+            max_concurrent_logins: Self::default_max_concurrent_logins(),
+            max_login_queue: Self::default_max_login_queue(),
+            auth_ban_threshold: 0,
+            auth_ban_window: Self::default_auth_ban_window(),
+            auth_ban_time: Self::default_auth_ban_time(),
+            auth_ban_max_time: Self::default_auth_ban_max_time(),
+            trusted_upstream_poolers: Vec::new(),
+            client_identity_parameter: Self::default_client_identity_parameter(),
+            fd_usage_warn_percent: Self::default_fd_usage_warn_percent(),
             max_concurrent_creates: Self::default_max_concurrent_creates(),
             scaling_warm_pool_ratio: Self::default_scaling_warm_pool_ratio(),
             scaling_fast_retries: Self::default_scaling_fast_retries(),
             scaling_max_parallel_creates: Self::default_scaling_max_parallel_creates(),
+            adaptive_pool_wait_target: Self::default_adaptive_pool_wait_target(),
+            adaptive_pool_interval: Self::default_adaptive_pool_interval(),
             worker_threads: Self::default_worker_threads(),
             worker_cpu_affinity_pinning: Self::default_worker_cpu_affinity_pinning(),
+            stall_watchdog_timeout: Self::default_stall_watchdog_timeout(),
+            state_dump_dir: Self::default_state_dump_dir(),
+            enable_fault_injection: Self::default_enable_fault_injection(),
             worker_stack_size: None,
             max_blocking_threads: None,
             tcp_keepalives_idle: Self::default_tcp_keepalives_idle(),
@@ -563,19 +1052,34 @@ impl Default for General {
             tcp_so_linger: Self::default_tcp_so_linger(),
             tcp_no_delay: Self::default_tcp_no_delay(),
             tcp_user_timeout: Self::default_tcp_user_timeout(),
+            server_tcp_keepalives_idle: None,
+            server_tcp_keepalives_interval: None,
+            server_tcp_keepalives_count: None,
+            server_tcp_user_timeout: None,
             unix_socket_buffer_size: Self::default_unix_socket_buffer_size(),
             tcp_socket_buffer_size: Self::default_tcp_socket_buffer_size(),
             unix_socket_dir: None,
             unix_socket_mode: Self::default_unix_socket_mode(),
             log_client_connections: true,
             log_client_disconnections: true,
+            log_connection_events: false,
             sync_server_parameters: Self::default_sync_server_parameters(),
+            server_max_protocol_version: Self::default_server_max_protocol_version(),
+            auto_session_pinning: Self::default_auto_session_pinning(),
+            two_phase_commit: TwoPhaseCommit::default(),
             tls_certificate: None,
             tls_private_key: None,
             tls_ca_cert: None,
             tls_mode: None,
             tls_rate_limit_per_second: Self::default_tls_rate_limit_per_second(),
+            tls_min_version: None,
+            tls_max_version: None,
+            tls_ciphers: None,
+            tls_ciphersuites: None,
+            tls_groups: None,
+            plain_auth_require_tls: false,
             server_tls_mode: Self::default_server_tls_mode(),
+            server_tls_negotiation: Self::default_server_tls_negotiation(),
             server_tls_ca_cert: None,
             server_tls_certificate: None,
             server_tls_private_key: None,
@@ -584,12 +1088,29 @@ impl Default for General {
             patroni_api_timeout: None,
             fallback_connect_timeout: None,
             fallback_lifetime: None,
+            patroni_discovery_interval: None,
             admin_username: String::from("admin"),
             admin_password: String::from("admin"),
+            stats_users: Vec::new(),
             server_lifetime: Self::default_server_lifetime(),
             retain_connections_time: Self::default_retain_connections_time(),
             retain_connections_max: Self::default_retain_connections_max(),
+            autodb_idle_timeout: Self::default_autodb_idle_timeout(),
+            autodb_max_pools: Self::default_autodb_max_pools(),
+            autodb_create_rate: Self::default_autodb_create_rate(),
+            managed_pools_file: None,
             server_idle_check_timeout: Self::default_server_idle_check_timeout(),
+            dns_refresh_interval: Self::default_dns_refresh_interval(),
+            server_role_check_interval: Self::default_server_role_check_interval(),
+            server_memory_check_interval: Self::default_server_memory_check_interval(),
+            server_recycle_windows: Vec::new(),
+            server_recycle_rate: Self::default_server_recycle_rate(),
+            circuit_breaker_threshold: Self::default_circuit_breaker_threshold(),
+            circuit_breaker_cooldown: Self::default_circuit_breaker_cooldown(),
+            server_checkout_retries: Self::default_server_checkout_retries(),
+            client_pool_parameter: None,
+            client_tag_parameter: None,
+            connect_notice: None,
             server_round_robin: Self::default_server_round_robin(),
             prepared_statements: Self::default_prepared_statements(),
             prepared_statements_cache_size: Self::default_prepared_statements_cache_size(),
@@ -598,12 +1119,16 @@ impl Default for General {
             query_interner_gc_interval_seconds: Self::default_query_interner_gc_interval_seconds(),
             query_interner_anon_idle_ttl_seconds:
                 Self::default_query_interner_anon_idle_ttl_seconds(),
+            query_interner_anon_max_entries: Self::default_query_interner_anon_max_entries(),
             hba: Self::default_hba(),
             pg_hba: None,
             startup_parameters: std::collections::BTreeMap::new(),
+            features: std::collections::BTreeMap::new(),
             daemon_pid_file: Self::default_daemon_pid_file(),
             syslog_prog_name: None,
+            audit_log: None,
             pooler_check_query: Self::default_pooler_check_query(),
+            show_local_parameters: Self::default_show_local_parameters(),
             backlog: Self::default_backlog(),
         }
     }
@@ -818,4 +1343,19 @@ client_prepared_statements_cache_size = 2048
             Some(2048),
         );
     }
+
+    #[test]
+    fn stats_users_never_demote_the_admin() {
+        let yaml = r#"
+host: "0.0.0.0"
+port: 6432
+admin_username: "admin"
+admin_password: "x"
+stats_users: ["monitoring", "admin"]
+"#;
+        let parsed: General = serde_yaml::from_str(yaml).unwrap();
+        assert!(parsed.is_stats_user("monitoring"));
+        assert!(!parsed.is_stats_user("admin"));
+        assert!(!parsed.is_stats_user("app"));
+    }
 }
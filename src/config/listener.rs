@@ -0,0 +1,160 @@
+//! Extra client listeners (`[[listeners]]`) next to `general.host:port`.
+
+use std::collections::HashMap;
+use std::net::{IpAddr, SocketAddr};
+
+use serde_derive::{Deserialize, Serialize};
+
+use crate::errors::Error;
+
+use super::tls::TLSMode;
+use super::{General, Pool};
+
+/// Admin console databases, always reachable through `databases`.
+const ADMIN_DATABASES: [&str; 2] = ["pgdoorman", "pgbouncer"];
+
+#[derive(Clone, PartialEq, Serialize, Deserialize, Debug)]
+pub struct Listener {
+    /// Label used in logs; defaults to `host:port`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub name: Option<String>,
+
+    /// IP address to bind.
+    #[serde(default = "General::default_host")]
+    pub host: String,
+
+    pub port: u16,
+
+    /// Overrides `general.tls_mode` for this listener. The certificate and
+    /// client certificate checks come from `general`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tls_mode: Option<String>,
+
+    /// Pools clients of this listener may connect to; empty means all.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub databases: Vec<String>,
+
+    /// Expect a PROXY protocol v1/v2 header before the startup packet and
+    /// use the address it carries as the client address.
+    #[serde(default)]
+    pub proxy_protocol: bool,
+}
+
+impl Listener {
+    /// Bind address; `None` when `host` is not an IP address.
+    pub fn socket_addr(&self) -> Option<SocketAddr> {
+        self.host
+            .parse::<IpAddr>()
+            .ok()
+            .map(|ip| SocketAddr::new(ip, self.port))
+    }
+
+    pub fn display_name(&self) -> String {
+        self.name
+            .clone()
+            .unwrap_or_else(|| format!("{}:{}", self.host, self.port))
+    }
+
+    /// Effective `tls_mode` of this listener.
+    pub fn tls_mode<'a>(&'a self, general: &'a General) -> Option<&'a str> {
+        self.tls_mode.as_deref().or(general.tls_mode.as_deref())
+    }
+
+    /// Whether clients of this listener may connect to `database`.
+    pub fn serves(&self, database: &str) -> bool {
+        self.databases.is_empty()
+            || ADMIN_DATABASES.contains(&database)
+            || self.databases.iter().any(|db| db == database)
+    }
+
+    fn validate(&self, general: &General, pools: &HashMap<String, Pool>) -> Result<(), Error> {
+        let name = self.display_name();
+        if self.socket_addr().is_none() {
+            return Err(Error::BadConfig(format!(
+                "listener {name}: host must be an IP address, got {:?}",
+                self.host
+            )));
+        }
+        if self.port == 0 {
+            return Err(Error::BadConfig(format!(
+                "listener {name}: port must be greater than 0"
+            )));
+        }
+        if let Some(mode) = &self.tls_mode {
+            let mode = TLSMode::from_string(mode)?;
+            if mode != TLSMode::Disable
+                && mode != TLSMode::Allow
+                && (general.tls_certificate.is_none() || general.tls_private_key.is_none())
+            {
+                return Err(Error::BadConfig(format!(
+                    "listener {name}: tls_mode is {mode} but tls_certificate or \
+                     tls_private_key is not set"
+                )));
+            }
+            // Client certificate verification is a property of the shared
+            // acceptor, so it can't be switched on per listener.
+            let general_mode = general
+                .tls_mode
+                .as_deref()
+                .map(TLSMode::from_string)
+                .transpose()?;
+            if mode == TLSMode::VerifyFull && general_mode != Some(TLSMode::VerifyFull) {
+                return Err(Error::BadConfig(format!(
+                    "listener {name}: tls_mode verify-full requires general.tls_mode \
+                     verify-full"
+                )));
+            }
+        }
+        if let Some(db) = self
+            .databases
+            .iter()
+            .find(|db| !pools.contains_key(*db) && !ADMIN_DATABASES.contains(&db.as_str()))
+        {
+            return Err(Error::BadConfig(format!(
+                "listener {name}: unknown database {db:?}"
+            )));
+        }
+        Ok(())
+    }
+}
+
+/// Two binds conflict on the same port unless both are distinct
+/// specific addresses.
+fn overlaps(a: SocketAddr, b: SocketAddr) -> bool {
+    a.port() == b.port() && (a.ip() == b.ip() || a.ip().is_unspecified() || b.ip().is_unspecified())
+}
+
+pub(super) fn validate(
+    listeners: &[Listener],
+    general: &General,
+    pools: &HashMap<String, Pool>,
+) -> Result<(), Error> {
+    let primary = general
+        .host
+        .parse::<IpAddr>()
+        .ok()
+        .map(|ip| SocketAddr::new(ip, general.port));
+    let mut seen: Vec<SocketAddr> = Vec::with_capacity(listeners.len());
+    for listener in listeners {
+        listener.validate(general, pools)?;
+        let addr = listener.socket_addr().expect("validated above");
+        let clashes_primary = match primary {
+            Some(primary) => overlaps(addr, primary),
+            None => addr.port() == general.port,
+        };
+        if clashes_primary {
+            return Err(Error::BadConfig(format!(
+                "listener {}: {addr} overlaps general.host:port",
+                listener.display_name()
+            )));
+        }
+        if seen.iter().any(|other| overlaps(addr, *other)) {
+            return Err(Error::BadConfig(format!(
+                "listener {}: {addr} overlaps another listener",
+                listener.display_name()
+            )));
+        }
+        seen.push(addr);
+    }
+    Ok(())
+}
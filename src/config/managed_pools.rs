@@ -0,0 +1,258 @@
+//! Pools added at runtime with the admin `CREATE POOL`, `ALTER POOL` and
+//! `DROP POOL` commands.
+//!
+//! They are kept apart from the pools of the config file and merged into
+//! every config `parse` loads, so RELOAD keeps them. With
+//! `general.managed_pools_file` set they are also written to that file and
+//! read back from it on every load; without it they last until restart.
+//! Pools from the config file can't be altered or dropped this way, and a
+//! config file pool with the same name replaces a managed one.
+
+use std::collections::BTreeMap;
+
+use log::{info, warn};
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use serde_derive::{Deserialize, Serialize};
+
+use crate::errors::Error;
+use crate::pool::{get_client_server_map, ConnectionPool};
+
+use super::{
+    config_arc, lock_config_updates, parse_config_content, store_config, Config, ConfigFormat,
+    Pool, AUTODB_TEMPLATE,
+};
+
+/// Pools created with `CREATE POOL` and still present.
+static MANAGED_POOLS: Lazy<Mutex<BTreeMap<String, Pool>>> =
+    Lazy::new(|| Mutex::new(BTreeMap::new()));
+
+/// Serializes the admin commands; each one works on the config the
+/// previous one stored.
+static UPDATE_LOCK: Lazy<tokio::sync::Mutex<()>> = Lazy::new(|| tokio::sync::Mutex::new(()));
+
+/// Databases the admin console answers to; never a pool name.
+const RESERVED_NAMES: [&str; 3] = [AUTODB_TEMPLATE, "pgdoorman", "pgbouncer"];
+
+/// Contents of `general.managed_pools_file`.
+#[derive(Serialize, Deserialize, Default)]
+struct ManagedPoolsFile {
+    #[serde(default)]
+    pools: BTreeMap<String, Pool>,
+}
+
+/// Called by config parsing before validation: add the managed pools to a
+/// freshly loaded config, reading them from `general.managed_pools_file`
+/// first when it is set. A missing file means no managed pools yet.
+pub(crate) async fn merge(config: &mut Config) -> Result<(), Error> {
+    if let Some(path) = &config.general.managed_pools_file {
+        let pools = load(path).await?;
+        *MANAGED_POOLS.lock() = pools;
+    }
+
+    let mut managed = MANAGED_POOLS.lock();
+    managed.retain(|name, _| {
+        let configured = config.pools.contains_key(name);
+        if configured {
+            warn!("[pool: {name}] defined in the config file, dropping the managed pool");
+        }
+        !configured
+    });
+    for (name, pool) in managed.iter() {
+        config.pools.insert(name.clone(), pool.clone());
+    }
+    Ok(())
+}
+
+/// `CREATE POOL`: add a pool from its JSON definition, in the shape of a
+/// `pools.<name>` config section.
+pub async fn create_pool(name: &str, definition: &str) -> Result<(), Error> {
+    check_name(name)?;
+    let pool: Pool = serde_json::from_str(definition)
+        .map_err(|err| Error::BadConfig(format!("invalid pool definition: {err}")))?;
+
+    let _lock = UPDATE_LOCK.lock().await;
+    if config_arc().pools.contains_key(name) {
+        return Err(Error::BadConfig(format!("pool {name} already exists")));
+    }
+    apply(name, Some(pool)).await?;
+    info!("[pool: {name}] created");
+    Ok(())
+}
+
+/// `ALTER POOL`: replace the top-level settings given in a JSON object;
+/// `null` resets one to its default.
+pub async fn alter_pool(name: &str, changes: &str) -> Result<(), Error> {
+    let changes: serde_json::Map<String, serde_json::Value> = serde_json::from_str(changes)
+        .map_err(|err| Error::BadConfig(format!("invalid pool changes: {err}")))?;
+
+    let _lock = UPDATE_LOCK.lock().await;
+    let pool = managed_pool(name)?;
+    apply(name, Some(patch_pool(&pool, changes)?)).await?;
+    info!("[pool: {name}] altered");
+    Ok(())
+}
+
+/// `DROP POOL`: remove a managed pool. Its clients keep their server
+/// connections until they disconnect, as with a pool removed by RELOAD.
+pub async fn drop_pool(name: &str) -> Result<(), Error> {
+    let _lock = UPDATE_LOCK.lock().await;
+    managed_pool(name)?;
+    apply(name, None).await?;
+    info!("[pool: {name}] dropped");
+    Ok(())
+}
+
+fn check_name(name: &str) -> Result<(), Error> {
+    if name.is_empty() || RESERVED_NAMES.contains(&name) || crate::pool::autodb::is_pattern(name) {
+        return Err(Error::BadConfig(format!("{name:?} can't be a pool name")));
+    }
+    Ok(())
+}
+
+fn managed_pool(name: &str) -> Result<Pool, Error> {
+    if let Some(pool) = MANAGED_POOLS.lock().get(name) {
+        return Ok(pool.clone());
+    }
+    if config_arc().pools.contains_key(name) {
+        return Err(Error::BadConfig(format!(
+            "pool {name} is not managed by CREATE POOL; change it in the config file"
+        )));
+    }
+    Err(Error::BadConfig(format!("pool {name} does not exist")))
+}
+
+fn patch_pool(
+    pool: &Pool,
+    changes: serde_json::Map<String, serde_json::Value>,
+) -> Result<Pool, Error> {
+    let mut value = serde_json::to_value(pool)
+        .map_err(|err| Error::BadConfig(format!("can't serialize pool: {err}")))?;
+    let fields = value
+        .as_object_mut()
+        .ok_or_else(|| Error::BadConfig("pool is not serialized as an object".into()))?;
+    for (key, change) in changes {
+        if change.is_null() {
+            fields.remove(&key);
+        } else {
+            fields.insert(key, change);
+        }
+    }
+    serde_json::from_value(value)
+        .map_err(|err| Error::BadConfig(format!("invalid pool changes: {err}")))
+}
+
+/// Validate the live config with `name` set to `pool` (or removed), then
+/// save it, store it and rebuild the pools. Nothing changes on error.
+async fn apply(name: &str, pool: Option<Pool>) -> Result<(), Error> {
+    let _update = lock_config_updates().await;
+    let mut config = (*config_arc()).clone();
+    let mut managed = MANAGED_POOLS.lock().clone();
+    match pool {
+        Some(pool) => {
+            config.pools.insert(name.to_string(), pool.clone());
+            managed.insert(name.to_string(), pool);
+        }
+        None => {
+            config.pools.remove(name);
+            managed.remove(name);
+        }
+    }
+    config.validate().await?;
+
+    if let Some(path) = &config.general.managed_pools_file {
+        save(path, &managed).await?;
+    }
+    *MANAGED_POOLS.lock() = managed;
+    store_config(config);
+    crate::web::metrics::refresh_static_info_metrics();
+
+    let client_server_map = get_client_server_map()
+        .ok_or_else(|| Error::BadConfig("pools are not initialized yet".into()))?;
+    ConnectionPool::from_config(client_server_map).await
+}
+
+async fn load(path: &str) -> Result<BTreeMap<String, Pool>, Error> {
+    let contents = match tokio::fs::read_to_string(path).await {
+        Ok(contents) => contents,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(BTreeMap::new()),
+        Err(err) => {
+            return Err(Error::BadConfig(format!(
+                "Could not read managed pools file '{path}': {err}"
+            )))
+        }
+    };
+    let file: ManagedPoolsFile = parse_config_content(&contents, ConfigFormat::detect(path))?;
+    Ok(file.pools)
+}
+
+/// Write the managed pools through a temporary file, so a crash never
+/// leaves a half-written one behind.
+async fn save(path: &str, pools: &BTreeMap<String, Pool>) -> Result<(), Error> {
+    let file = ManagedPoolsFile {
+        pools: pools.clone(),
+    };
+    let contents = match ConfigFormat::detect(path) {
+        ConfigFormat::Toml => toml::to_string(&file).map_err(|err| err.to_string()),
+        ConfigFormat::Yaml => serde_yaml::to_string(&file).map_err(|err| err.to_string()),
+    }
+    .map_err(|err| Error::BadConfig(format!("Could not serialize managed pools: {err}")))?;
+
+    let tmp_path = format!("{path}.tmp");
+    tokio::fs::write(&tmp_path, contents)
+        .await
+        .map_err(|err| Error::BadConfig(format!("Could not write '{tmp_path}': {err}")))?;
+    tokio::fs::rename(&tmp_path, path)
+        .await
+        .map_err(|err| Error::BadConfig(format!("Could not write '{path}': {err}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pool() -> Pool {
+        serde_json::from_str(
+            r#"{"server_host": "10.0.0.1", "server_port": 5432, "pool_mode": "session",
+                "users": [{"username": "app", "password": "secret", "pool_size": 10}]}"#,
+        )
+        .unwrap()
+    }
+
+    #[test]
+    fn patch_replaces_given_settings_only() {
+        let changes = serde_json::from_str(r#"{"server_host": "10.0.0.2"}"#).unwrap();
+        let patched = patch_pool(&pool(), changes).unwrap();
+        assert_eq!(patched.server_host, "10.0.0.2");
+        assert_eq!(patched.server_port, 5432);
+        assert_eq!(patched.users, pool().users);
+    }
+
+    #[test]
+    fn patch_null_resets_to_default() {
+        let changes = serde_json::from_str(r#"{"server_port": null}"#).unwrap();
+        let patched = patch_pool(&pool(), changes).unwrap();
+        assert_eq!(patched.server_port, Pool::default_server_port());
+    }
+
+    #[test]
+    fn reserved_names_are_rejected() {
+        for name in ["", "*", "tenant_*", "pgdoorman", "pgbouncer"] {
+            assert!(check_name(name).is_err(), "{name:?} accepted");
+        }
+        assert!(check_name("tenant_1").is_ok());
+    }
+
+    #[test]
+    fn managed_pools_round_trip_through_both_formats() {
+        let file = ManagedPoolsFile {
+            pools: BTreeMap::from([("tenant".to_string(), pool())]),
+        };
+        let toml = toml::to_string(&file).unwrap();
+        let yaml = serde_yaml::to_string(&file).unwrap();
+        for (contents, format) in [(toml, ConfigFormat::Toml), (yaml, ConfigFormat::Yaml)] {
+            let parsed: ManagedPoolsFile = parse_config_content(&contents, format).unwrap();
+            assert_eq!(parsed.pools, file.pools);
+        }
+    }
+}
@@ -13,43 +13,65 @@ use std::sync::Arc;
 use tokio::fs::File;
 use tokio::io::AsyncReadExt;
 
-use self::tls::{load_identity, TLSMode};
-use crate::auth::hba::CheckResult;
+use self::tls::TLSMode;
+use crate::auth::hba::{CheckResult, PgHba};
 use crate::errors::Error;
+use crate::messages::MAX_MESSAGE_SIZE;
 use crate::pool::{ClientServerMap, ConnectionPool};
 use crate::transport::ClientTransport;
 use crate::utils::format_duration_ms;
 
 // Sub-modules
+mod acme;
 mod address;
+pub mod application_name_template;
 mod byte_size;
+pub mod connect_notice;
 mod duration;
+mod fault_injection;
+pub mod features;
 mod general;
 mod include;
+mod listener;
+pub mod managed_pools;
 mod pool;
 mod pooler_check_query;
+mod recycle_window;
+mod rewrite_rule;
+pub mod runtime;
 pub mod startup_parameters;
+mod statement_rules;
 mod talos;
 pub mod tls;
 mod user;
+mod vault;
 pub mod web;
 
 #[cfg(test)]
 mod tests;
 
 // Re-exports
-pub use address::{Address, BackendAuthMethod, PoolMode};
+pub use acme::Acme;
+pub use address::{Address, BackendAuthMethod, LoadBalanceHosts, PoolMode, TargetSessionAttrs};
 pub use byte_size::ByteSize;
 pub use duration::Duration;
-pub use general::General;
+pub use fault_injection::FaultInjection;
+pub use general::{General, TwoPhaseCommit};
 pub use include::{GeneralWithInclude, Include, ServerConfig};
-pub use pool::{AuthQueryConfig, Pool};
+pub use listener::Listener;
+pub(crate) use pool::host_spec_matches;
+pub(crate) use pool::valid_client_tag;
+pub use pool::{AuthQueryConfig, DriverCompat, Pool};
 pub use pooler_check_query::{
     update_pooler_check_query_snapshot, PoolerCheckQuerySnapshot, POOLER_CHECK_QUERY_SNAPSHOT,
 };
+pub use recycle_window::RecycleWindow;
+pub use rewrite_rule::{compile_rewrite_rules, CompiledRewrite, RewriteRule};
+pub use statement_rules::{StatementRule, StatementRules};
 pub use talos::Talos;
 pub use tls::{ServerTlsConfig, ServerTlsMode};
-pub use user::User;
+pub use user::{User, WILDCARD_USER};
+pub use vault::Vault;
 pub use web::Web;
 
 pub const VERSION: &str = env!("CARGO_PKG_VERSION");
@@ -192,9 +214,23 @@ fn content_to_toml_string(contents: &str, format: ConfigFormat) -> Result<String
     }
 }
 
+/// Pool name of the template for databases that are not configured.
+pub const AUTODB_TEMPLATE: &str = "*";
+
 /// Globally available configuration.
 static CONFIG: Lazy<ArcSwap<Config>> = Lazy::new(|| ArcSwap::from_pointee(Config::default()));
 
+/// Serializes changes to the live configuration: RELOAD, RELOAD HBA,
+/// `SET`, `CREATE/ALTER/DROP POOL` and pools created from templates. Each
+/// of them copies the live config, changes the copy and stores it, so two
+/// running at once would lose one of the changes.
+static CONFIG_UPDATE: Lazy<tokio::sync::Mutex<()>> = Lazy::new(|| tokio::sync::Mutex::new(()));
+
+/// Hold while copying, changing and storing the live config.
+pub(crate) async fn lock_config_updates() -> tokio::sync::MutexGuard<'static, ()> {
+    CONFIG_UPDATE.lock().await
+}
+
 /// Configuration wrapper.
 #[derive(Serialize, Deserialize, Debug, Clone, PartialEq)]
 pub struct Config {
@@ -226,9 +262,27 @@ pub struct Config {
     #[serde(default = "Talos::empty", skip_serializing_if = "Talos::is_empty")]
     pub talos: Talos,
 
+    // Vault settings for backend credentials.
+    #[serde(default = "Vault::empty", skip_serializing_if = "Vault::is_empty")]
+    pub vault: Vault,
+
+    // ACME settings for the client-facing TLS certificate.
+    #[serde(default = "Acme::empty", skip_serializing_if = "Acme::is_empty")]
+    pub acme: Acme,
+
+    // Extra client listeners next to general.host:port.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub listeners: Vec<Listener>,
+
     // Connection pools.
     pub pools: HashMap<String, Pool>,
 
+    // Pools whose name contains `*` (`pools."*"`, `pools."tenant_*"`),
+    // taken out of `pools` after validation, most specific first: the
+    // templates for databases no pool is configured for.
+    #[serde(skip)]
+    pub autodb_templates: Vec<(String, Pool)>,
+
     // Include files.
     #[serde(
         default = "General::default_include",
@@ -241,6 +295,15 @@ impl Config {
     pub fn default_path() -> String {
         String::from("pg_doorman.toml")
     }
+
+    /// The most specific template whose pattern matches `database`, with
+    /// the pattern.
+    pub fn autodb_template(&self, database: &str) -> Option<(&str, &Pool)> {
+        self.autodb_templates
+            .iter()
+            .find(|(pattern, _)| crate::pool::autodb::pattern_matches(pattern, database))
+            .map(|(pattern, pool)| (pattern.as_str(), pool))
+    }
 }
 
 impl Default for Config {
@@ -250,10 +313,14 @@ impl Default for Config {
             general: General::default(),
             web: Web::empty(),
             pools: HashMap::default(),
+            autodb_templates: Vec::new(),
             talos: Talos {
                 keys: vec![],
                 databases: vec![],
             },
+            vault: Vault::empty(),
+            acme: Acme::empty(),
+            listeners: Vec::new(),
             include: Include { files: Vec::new() },
         }
     }
@@ -298,6 +365,50 @@ impl From<&Config> for std::collections::HashMap<String, String> {
                 "shutdown_timeout".to_string(),
                 config.general.shutdown_timeout.to_string(),
             ),
+            (
+                "hold_timeout".to_string(),
+                config.general.hold_timeout.to_string(),
+            ),
+            (
+                "worker_threads".to_string(),
+                config.general.worker_threads.to_string(),
+            ),
+            (
+                "query_wait_timeout".to_string(),
+                config.general.query_wait_timeout.to_string(),
+            ),
+            (
+                "client_idle_timeout".to_string(),
+                config.general.client_idle_timeout.to_string(),
+            ),
+            (
+                "client_login_timeout".to_string(),
+                config.general.client_login_timeout.to_string(),
+            ),
+            (
+                "client_write_timeout".to_string(),
+                config.general.client_write_timeout.to_string(),
+            ),
+            (
+                "proxy_copy_data_timeout".to_string(),
+                config.general.proxy_copy_data_timeout.to_string(),
+            ),
+            (
+                "max_connections".to_string(),
+                config.general.max_connections.to_string(),
+            ),
+            (
+                "log_client_connections".to_string(),
+                config.general.log_client_connections.to_string(),
+            ),
+            (
+                "log_client_disconnections".to_string(),
+                config.general.log_client_disconnections.to_string(),
+            ),
+            (
+                "log_connection_events".to_string(),
+                config.general.log_connection_events.to_string(),
+            ),
         ];
 
         r.append(&mut static_settings);
@@ -337,6 +448,10 @@ impl Config {
             "Max memory usage for processing messages: {}",
             self.general.max_memory_usage
         );
+        info!(
+            "Max client message size: {}",
+            self.general.max_client_message_size
+        );
         info!(
             "Default max server lifetime: {}",
             format_duration_ms(self.general.server_lifetime.as_millis())
@@ -366,7 +481,15 @@ impl Config {
             }
         };
 
+        info!(
+            "server_max_protocol_version: {}",
+            self.general.server_max_protocol_version
+        );
         info!("server_tls_mode: {}", self.general.server_tls_mode);
+        info!(
+            "server_tls_negotiation: {}",
+            self.general.server_tls_negotiation
+        );
         if let Some(ref ca) = self.general.server_tls_ca_cert {
             info!("server_tls_ca_cert: {ca}");
         }
@@ -374,12 +497,42 @@ impl Config {
             info!("server_tls_certificate: {cert}");
         }
 
+        for (pattern, template) in &self.autodb_templates {
+            info!(
+                "Autodb template \"{}\": {}:{}, idle timeout: {}",
+                pattern,
+                template.server_host,
+                template.server_port,
+                format_duration_ms(self.general.autodb_idle_timeout.as_millis())
+            );
+        }
+
+        if let Some(path) = &self.general.managed_pools_file {
+            info!("Managed pools file: {path}");
+        }
+
         for (pool_name, pool) in &self.pools {
             info!("[pool: {}] Pool mode: {}", pool_name, pool.pool_mode);
             info!(
                 "[pool: {}] Server: {}:{}",
                 pool_name, pool.server_host, pool.server_port
             );
+            if pool.target_session_attrs != TargetSessionAttrs::Any {
+                info!(
+                    "[pool: {}] Target session attrs: {}",
+                    pool_name, pool.target_session_attrs
+                );
+            }
+            if let Some(interval) = pool
+                .patroni_discovery_interval
+                .or(self.general.patroni_discovery_interval)
+            {
+                info!(
+                    "[pool: {}] Patroni discovery interval: {}ms",
+                    pool_name,
+                    interval.as_millis()
+                );
+            }
             info!(
                 "[pool: {}] Cleanup server connections: {}",
                 pool_name, pool.cleanup_server_connections
@@ -423,9 +576,68 @@ impl Config {
 
     /// Validate the configuration.
     pub async fn validate(&mut self) -> Result<(), Error> {
+        if self.general.worker_threads == 0 {
+            self.general.worker_threads = General::available_cpus();
+        }
+
         // Validate Talos
         self.talos.validate().await?;
 
+        // Validate Vault; users reading backend credentials from it need the section.
+        self.vault.validate()?;
+        if self.vault.is_empty() {
+            for (pool_name, pool_config) in &self.pools {
+                if let Some(user) = pool_config
+                    .users
+                    .iter()
+                    .find(|user| user.server_vault_path.is_some())
+                {
+                    return Err(Error::BadConfig(format!(
+                        "pools.{pool_name}: user {} sets server_vault_path, but vault.addr is not configured",
+                        user.username
+                    )));
+                }
+            }
+        }
+
+        // RDS IAM tokens travel as cleartext passwords: refuse TLS modes
+        // that could send one over a plain connection.
+        for (pool_name, pool_config) in &self.pools {
+            if !pool_config.users.iter().any(|user| user.server_rds_iam) {
+                continue;
+            }
+            let tls_mode = pool_config
+                .server_tls_mode
+                .as_deref()
+                .unwrap_or(&self.general.server_tls_mode)
+                .parse::<tls::ServerTlsMode>()?;
+            if !matches!(
+                tls_mode,
+                tls::ServerTlsMode::Require
+                    | tls::ServerTlsMode::VerifyCa
+                    | tls::ServerTlsMode::VerifyFull
+            ) {
+                return Err(Error::BadConfig(format!(
+                    "pools.{pool_name}: server_rds_iam requires server_tls_mode require, \
+                     verify-ca or verify-full, got {tls_mode}"
+                )));
+            }
+            for (host, _) in pool_config.server_hosts() {
+                if host.starts_with('/') {
+                    return Err(Error::BadConfig(format!(
+                        "pools.{pool_name}: server_rds_iam needs a TCP server_host, got {host}"
+                    )));
+                }
+                if crate::aws::region_for_host(&host).is_none() {
+                    return Err(Error::BadConfig(format!(
+                        "pools.{pool_name}: can't tell the AWS region of {host}; set AWS_REGION"
+                    )));
+                }
+            }
+        }
+
+        features::validate(&self.general.features)?;
+
         // Validate operator-supplied PostgreSQL startup parameters at the
         // general level; per-pool maps are validated inside `Pool::validate`.
         startup_parameters::validate(
@@ -448,7 +660,7 @@ impl Config {
             // the runtime byte count.
             let merged = startup_parameters::cascade_canonical_keys(&[
                 &self.general.startup_parameters,
-                &pool_config.startup_parameters,
+                &pool_config.server_startup_parameters(),
             ]);
             let merged_size = startup_parameters::serialized_bytes(&merged);
             if merged_size > startup_parameters::MAX_OPERATOR_BUDGET {
@@ -525,6 +737,63 @@ impl Config {
             ));
         }
 
+        let stall_watchdog_timeout = self.general.stall_watchdog_timeout.as_millis();
+        if stall_watchdog_timeout > 0 && stall_watchdog_timeout < 100 {
+            return Err(Error::BadConfig(
+                "general.stall_watchdog_timeout must be 0 (disabled) or at least 100ms".to_string(),
+            ));
+        }
+
+        if self.general.state_dump_dir.is_empty() {
+            return Err(Error::BadConfig(
+                "general.state_dump_dir must not be empty".to_string(),
+            ));
+        }
+
+        if self.general.fd_usage_warn_percent > 100 {
+            return Err(Error::BadConfig(
+                "general.fd_usage_warn_percent must be 0-100".to_string(),
+            ));
+        }
+
+        let max_connections_soft = self.general.max_connections_soft;
+        if max_connections_soft > 0 && max_connections_soft >= self.general.max_connections {
+            return Err(Error::BadConfig(
+                "general.max_connections_soft must be less than general.max_connections"
+                    .to_string(),
+            ));
+        }
+
+        if self.general.auth_ban_threshold > 0 {
+            if self.general.auth_ban_window.as_millis() == 0
+                || self.general.auth_ban_time.as_millis() == 0
+            {
+                return Err(Error::BadConfig(
+                    "general.auth_ban_window and general.auth_ban_time must be greater than 0 \
+                     when auth_ban_threshold is set"
+                        .to_string(),
+                ));
+            }
+            if self.general.auth_ban_max_time.as_millis() < self.general.auth_ban_time.as_millis() {
+                return Err(Error::BadConfig(
+                    "general.auth_ban_max_time must not be less than general.auth_ban_time"
+                        .to_string(),
+                ));
+            }
+        }
+
+        for upstream in &self.general.trusted_upstream_poolers {
+            if crate::auth::access_list::parse_net(upstream).is_none() {
+                return Err(Error::BadConfig(format!(
+                    "general.trusted_upstream_poolers: {upstream:?} is not an address or CIDR"
+                )));
+            }
+        }
+        pool::validate_custom_guc_name(
+            &self.general.client_identity_parameter,
+            "general.client_identity_parameter",
+        )?;
+
         // Validate scaling_warm_pool_ratio
         if self.general.scaling_warm_pool_ratio > 100 {
             return Err(Error::BadConfig(
@@ -539,6 +808,52 @@ impl Config {
             ));
         }
 
+        if self.general.adaptive_pool_interval.as_millis() == 0 {
+            return Err(Error::BadConfig(
+                "general.adaptive_pool_interval must be greater than 0".to_string(),
+            ));
+        }
+
+        if self.general.server_memory_check_interval.as_millis() == 0 {
+            return Err(Error::BadConfig(
+                "general.server_memory_check_interval must be greater than 0".to_string(),
+            ));
+        }
+
+        for window in &self.general.server_recycle_windows {
+            RecycleWindow::parse(window)?;
+        }
+        if self.general.server_recycle_rate == 0 {
+            return Err(Error::BadConfig(
+                "general.server_recycle_rate must be greater than 0".to_string(),
+            ));
+        }
+
+        if self.general.circuit_breaker_cooldown.as_millis() == 0 {
+            return Err(Error::BadConfig(
+                "general.circuit_breaker_cooldown must be greater than 0".to_string(),
+            ));
+        }
+
+        if let Some(name) = &self.general.client_pool_parameter {
+            pool::validate_custom_guc_name(name, "general.client_pool_parameter")?;
+        }
+
+        if let Some(name) = &self.general.client_tag_parameter {
+            pool::validate_custom_guc_name(name, "general.client_tag_parameter")?;
+        }
+
+        if let Some(template) = &self.general.connect_notice {
+            connect_notice::validate(template, "general.connect_notice")?;
+        }
+
+        let max_client_message_size = self.general.max_client_message_size.as_bytes();
+        if max_client_message_size < 1024 || max_client_message_size > MAX_MESSAGE_SIZE as u64 {
+            return Err(Error::BadConfig(format!(
+                "general.max_client_message_size must be between 1KB and {MAX_MESSAGE_SIZE} bytes"
+            )));
+        }
+
         // Validate unix_socket_mode upfront so misconfigurations fail at startup
         // rather than at the moment the listener tries to chmod the socket file.
         General::parse_unix_socket_mode(&self.general.unix_socket_mode)
@@ -639,9 +954,29 @@ impl Config {
                 }
             }
 
-            if let Some(tls_certificate) = self.general.tls_certificate.clone() {
+            let policy = tls::TlsPolicy::from_general(&self.general)?;
+
+            self.acme.validate(&self.general)?;
+
+            // With ACME, the certificate may not have been issued yet.
+            let awaiting_acme = self.acme.awaits_certificate(&self.general);
+
+            if let Some(tls_certificate) = self
+                .general
+                .tls_certificate
+                .clone()
+                .filter(|_| !awaiting_acme)
+            {
                 if let Some(tls_private_key) = self.general.tls_private_key.clone() {
-                    match load_identity(Path::new(&tls_certificate), Path::new(&tls_private_key)) {
+                    // Builds the acceptor as startup does, so cipher and
+                    // group lists OpenSSL rejects are caught here.
+                    match tls::build_acceptor(
+                        Path::new(&tls_certificate),
+                        Path::new(&tls_private_key),
+                        self.general.tls_ca_cert.clone(),
+                        self.general.tls_mode.clone(),
+                        &policy,
+                    ) {
                         Ok(_) => (),
                         Err(err) => {
                             return Err(Error::BadConfig(format!(
@@ -653,9 +988,33 @@ impl Config {
             };
         }
 
+        listener::validate(&self.listeners, &self.general, &self.pools)?;
+
+        if !matches!(
+            self.general.server_max_protocol_version.as_str(),
+            "3.0" | "3.2"
+        ) {
+            return Err(Error::BadConfig(format!(
+                "server_max_protocol_version must be \"3.0\" or \"3.2\", got {:?}",
+                self.general.server_max_protocol_version
+            )));
+        }
+
         // Validate server-facing TLS
         {
             let global_mode = self.general.server_tls_mode.parse::<tls::ServerTlsMode>()?;
+            let global_negotiation = self
+                .general
+                .server_tls_negotiation
+                .parse::<tls::ServerTlsNegotiation>()?;
+            if global_negotiation == tls::ServerTlsNegotiation::Direct
+                && !global_mode.requires_tls()
+            {
+                return Err(Error::BadConfig(format!(
+                    "server_tls_negotiation is 'direct' but server_tls_mode is '{global_mode}'; \
+                     direct TLS needs require, verify-ca or verify-full"
+                )));
+            }
 
             if global_mode.requires_ca() && self.general.server_tls_ca_cert.is_none() {
                 return Err(Error::BadConfig(format!(
@@ -686,6 +1045,7 @@ impl Config {
             if global_mode != tls::ServerTlsMode::Disable {
                 tls::ServerTlsConfig::new(
                     global_mode,
+                    global_negotiation,
                     self.general.server_tls_ca_cert.as_deref().map(Path::new),
                     self.general
                         .server_tls_certificate
@@ -710,6 +1070,38 @@ impl Config {
                     ))
                 })?;
 
+                let effective_negotiation = pool_config
+                    .server_tls_negotiation
+                    .as_deref()
+                    .unwrap_or(&self.general.server_tls_negotiation);
+                let negotiation = effective_negotiation
+                    .parse::<tls::ServerTlsNegotiation>()
+                    .map_err(|_| {
+                        Error::BadConfig(format!(
+                            "pool '{pool_name}': invalid server_tls_negotiation \
+                             '{effective_negotiation}'"
+                        ))
+                    })?;
+                if negotiation == tls::ServerTlsNegotiation::Direct && !mode.requires_tls() {
+                    return Err(Error::BadConfig(format!(
+                        "pool '{pool_name}': server_tls_negotiation is 'direct' but \
+                         server_tls_mode is '{mode}'"
+                    )));
+                }
+                // As in libpq, TLS is never used over unix sockets.
+                if mode.requires_tls() {
+                    if let Some((host, _)) = pool_config
+                        .server_hosts()
+                        .into_iter()
+                        .find(|(host, _)| host.starts_with('/'))
+                    {
+                        warn!(
+                            "pool '{pool_name}': server_tls_mode is '{mode}' but {host} is a \
+                             unix socket directory; connections through it are not encrypted"
+                        );
+                    }
+                }
+
                 let effective_ca = pool_config
                     .server_tls_ca_cert
                     .as_ref()
@@ -762,10 +1154,54 @@ impl Config {
             }
         }
 
+        if let Some(ref dur) = self.general.patroni_discovery_interval {
+            if dur.as_millis() == 0 {
+                return Err(Error::BadConfig(
+                    "general.patroni_discovery_interval must be > 0".into(),
+                ));
+            }
+        }
+        for (pool_name, pool) in &self.pools {
+            if pool.patroni_discovery_interval.is_some()
+                && pool.patroni_api_urls.is_none()
+                && self.general.patroni_api_urls.is_none()
+            {
+                return Err(Error::BadConfig(format!(
+                    "pool '{pool_name}': patroni_discovery_interval requires patroni_api_urls"
+                )));
+            }
+            if let Some(shard) = pool.shards.iter().find(|s| !self.pools.contains_key(*s)) {
+                return Err(Error::BadConfig(format!(
+                    "pool '{pool_name}': shard '{shard}' is not a configured pool"
+                )));
+            }
+        }
+
         for pool in self.pools.values_mut() {
             pool.validate().await?;
         }
 
+        let faulty: Vec<&str> = self
+            .pools
+            .iter()
+            .filter(|(_, pool)| pool.fault_injection.as_ref().is_some_and(|f| f.is_active()))
+            .map(|(name, _)| name.as_str())
+            .collect();
+        if !faulty.is_empty() {
+            if self.general.enable_fault_injection {
+                log::warn!(
+                    "fault injection is ON for pools {}: requests are delayed, dropped, \
+                     truncated or disconnected on purpose. Never run this in production",
+                    faulty.join(", ")
+                );
+            } else {
+                log::warn!(
+                    "fault_injection of pools {} is ignored: general.enable_fault_injection is off",
+                    faulty.join(", ")
+                );
+            }
+        }
+
         // Cross-config validation: coordinator timeouts vs query_wait_timeout
         let qwt = self.general.query_wait_timeout.as_millis();
         for (pool_name, pool_config) in &self.pools {
@@ -807,6 +1243,14 @@ pub fn config_arc() -> Arc<Config> {
     CONFIG.load_full()
 }
 
+/// Replace the live configuration. Only for runtime additions to an
+/// already validated config, such as pools created from the `"*"` template
+/// or a setting changed with the admin `SET` command, made while holding
+/// [`lock_config_updates`].
+pub(crate) fn store_config(config: Config) {
+    CONFIG.store(Arc::new(config));
+}
+
 async fn load_file(path: &str) -> Result<String, Error> {
     let mut contents = String::new();
     let mut file = match File::open(path).await {
@@ -870,9 +1314,12 @@ pub async fn parse(path: &str) -> Result<(), Error> {
         }
     };
 
+    managed_pools::merge(&mut config).await?;
     config.validate().await?;
 
     config.path = path.to_string();
+    config.autodb_templates = crate::pool::autodb::take_templates(&mut config.pools);
+    crate::pool::autodb::restore(&mut config);
 
     // Update the configuration globally.
     CONFIG.store(Arc::new(config.clone()));
@@ -882,6 +1329,7 @@ pub async fn parse(path: &str) -> Result<(), Error> {
 }
 
 pub async fn reload_config(client_server_map: ClientServerMap) -> Result<bool, Error> {
+    let _update = lock_config_updates().await;
     let old_config = get_config();
 
     match parse(&old_config.path).await {
@@ -891,6 +1339,8 @@ pub async fn reload_config(client_server_map: ClientServerMap) -> Result<bool, E
             return Err(Error::BadConfig(format!("Config reload error: {err:?}")));
         }
     };
+    // The file is authoritative again: values set with `SET` are gone.
+    runtime::clear_overrides();
 
     let new_config = get_config();
     // Refresh the web listener's reload-aware options whether or not
@@ -906,6 +1356,36 @@ pub async fn reload_config(client_server_map: ClientServerMap) -> Result<bool, E
     // /metrics on this same scrape.
     crate::web::metrics::refresh_static_info_metrics();
 
+    // Reopen the audit log, which also lets logrotate move the file away.
+    if let Err(err) = crate::app::audit_log::configure(&new_config.general) {
+        error!("Audit log reload failed, keeping the previous destination: {err}");
+    }
+
+    // Pools may have grown past the descriptors checked at startup.
+    if let Err(err) = crate::app::fd_limit::ensure_fd_limit(&new_config) {
+        error!("{err}");
+    }
+
+    // Pick up a replaced client certificate (or tls_mode / tls_ca_cert)
+    // for new connections. Certificates ACME has not issued yet are left
+    // to the ACME task.
+    if !new_config.acme.awaits_certificate(&new_config.general) {
+        match crate::app::tls::reload_client_acceptor(&new_config) {
+            Ok(true) => info!("TLS certificate reloaded"),
+            Ok(false) => (),
+            Err(err) => error!("TLS certificate reload failed, keeping the previous one: {err}"),
+        }
+    }
+
+    // Sockets are bound once at startup; only per-listener settings of
+    // addresses that are already bound change on reload.
+    let bound = |config: &Config| -> Vec<Option<std::net::SocketAddr>> {
+        config.listeners.iter().map(Listener::socket_addr).collect()
+    };
+    if bound(&old_config) != bound(&new_config) {
+        warn!("listeners added, removed or moved by reload take effect after a restart");
+    }
+
     if old_config != new_config {
         info!("Config changed, reloading");
         ConnectionPool::from_config(client_server_map).await?;
@@ -915,6 +1395,31 @@ pub async fn reload_config(client_server_map: ClientServerMap) -> Result<bool, E
     }
 }
 
+/// Read the `general.pg_hba` file again and swap in its rules, leaving
+/// the rest of the live config alone. Returns the number of rules loaded.
+/// Errs, keeping the rules in use, when pg_hba is not set from a file or
+/// the file does not load; connected clients are never re-checked.
+pub async fn reload_hba() -> Result<usize, Error> {
+    let _update = lock_config_updates().await;
+    let config = config_arc();
+    let Some(path) = config
+        .general
+        .pg_hba
+        .as_ref()
+        .and_then(|hba| hba.path.clone())
+    else {
+        return Err(Error::BadConfig(
+            "RELOAD HBA needs general.pg_hba = { path = \"...\" }".to_string(),
+        ));
+    };
+    let hba = PgHba::load(&path).map_err(|err| Error::BadConfig(format!("pg_hba: {err}")))?;
+    let rules = hba.rules.len();
+    let mut config = (*config).clone();
+    config.general.pg_hba = Some(hba);
+    store_config(config);
+    Ok(rules)
+}
+
 pub fn check_hba(
     transport: &ClientTransport,
     type_auth: &str,
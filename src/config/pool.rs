@@ -4,12 +4,16 @@ use crate::errors::Error;
 use log::warn;
 use serde::de::{self, MapAccess, SeqAccess, Visitor};
 use serde::{Deserialize, Deserializer, Serialize};
+use std::borrow::Cow;
 use std::collections::hash_map::DefaultHasher;
 use std::collections::HashSet;
 use std::fmt;
 use std::hash::{Hash, Hasher};
 
-use super::{Duration, PoolMode, User};
+use super::{
+    ByteSize, Duration, FaultInjection, LoadBalanceHosts, PoolMode, RewriteRule,
+    TargetSessionAttrs, User, WILDCARD_USER,
+};
 
 /// Custom deserializer for users field that supports both formats:
 /// - Array format (recommended): `users: [{ username: "user1", ... }]`
@@ -69,8 +73,10 @@ pub struct Pool {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub connect_timeout: Option<u64>,
 
-    /// Close idle connections that have been opened for longer than this.
-    #[serde(skip_serializing_if = "Option::is_none")]
+    /// Close server connections that have been idle for longer than this.
+    /// Overrides `general.idle_timeout` for this pool. Also accepted as
+    /// `server_idle_timeout`, the PgBouncer name.
+    #[serde(skip_serializing_if = "Option::is_none", alias = "server_idle_timeout")]
     pub idle_timeout: Option<u64>,
 
     /// Close server connections that have been opened for longer than this.
@@ -79,6 +85,68 @@ pub struct Pool {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_lifetime: Option<u64>,
 
+    /// Close server connections whose backend memory
+    /// (`pg_backend_memory_contexts`) exceeds this. Checked on checkout
+    /// every `general.server_memory_check_interval`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_max_memory: Option<ByteSize>,
+
+    /// Cancel a query that has run this long, and close its backend and
+    /// client if it is still running `max_query_time_grace` later. Users
+    /// can override it with their own `max_query_time`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_query_time: Option<Duration>,
+
+    /// Time a query canceled by `max_query_time` gets to stop before its
+    /// backend is terminated. Defaults to 10 seconds.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_query_time_grace: Option<Duration>,
+
+    /// Default `statement_timeout` of the pool's backends. Sent in the
+    /// StartupMessage like `startup_parameters`, so a client `SET` wins
+    /// until the connection is reset.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub statement_timeout: Option<Duration>,
+
+    /// Default `lock_timeout` of the pool's backends, as `statement_timeout`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub lock_timeout: Option<Duration>,
+
+    /// Default `idle_in_transaction_session_timeout` of the pool's backends,
+    /// as `statement_timeout`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub idle_in_transaction_session_timeout: Option<Duration>,
+
+    /// Attempts per new backend connection when the host is unreachable
+    /// or not accepting connections yet. Defaults to 1 (no retry).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_connect_attempts: Option<u32>,
+
+    /// Delay before the second connect attempt; doubles on every further
+    /// attempt.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_connect_backoff: Option<Duration>,
+
+    /// After a login failure (SQLSTATE class 28), stop connecting to that
+    /// host for this long and fail new connections with the same error.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_login_retry: Option<Duration>,
+
+    /// Idle server pick order for this pool. Overrides
+    /// `general.server_round_robin`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_round_robin: Option<bool>,
+
+    /// DataRow bytes buffered before they are flushed to the client.
+    /// 0 flushes after every row. Default: 8KB.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub data_row_flush_threshold: Option<ByteSize>,
+
+    /// CopyData bytes (COPY ... TO STDOUT) buffered before they are
+    /// flushed to the client. 0 flushes after every message. Default: 8KB.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub copy_data_flush_threshold: Option<ByteSize>,
+
     #[serde(default = "Pool::default_cleanup_server_connections")]
     pub cleanup_server_connections: bool,
 
@@ -88,12 +156,76 @@ pub struct Pool {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub application_name: Option<String>,
 
+    /// `application_name` set on the backend while it serves a client,
+    /// e.g. `"{client_app}@{client_ip}:{client_port}"`. See
+    /// [`crate::config::application_name_template`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub application_name_template: Option<String>,
+
+    /// NoticeResponse sent to this pool's clients after login. Overrides
+    /// `general.connect_notice`; empty turns it off for the pool. See
+    /// [`crate::config::connect_notice`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub connect_notice: Option<String>,
+
+    /// Custom GUC (e.g. `doorman.client_addr`) set to the client's
+    /// `ip:port` on every checkout, for server-side auditing.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub client_addr_guc: Option<String>,
+
+    /// Clients of each tag (set with `general.client_tag_parameter`) the
+    /// pool accepts at once; 0 counts the tag without a cap. Tags not
+    /// listed here share the uncapped `other` group.
+    #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
+    pub client_tag_limits: std::collections::BTreeMap<String, u32>,
+
+    /// Backends the clients of each application_name (as sent in the
+    /// StartupMessage) may hold at once, across all users of the pool.
+    #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
+    pub application_name_checkout_limits: std::collections::BTreeMap<String, u32>,
+
+    /// Backends the clients of each tag (`general.client_tag_parameter`)
+    /// may hold at once, across all users of the pool.
+    #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
+    pub tag_checkout_limits: std::collections::BTreeMap<String, u32>,
+
+    /// Statements refused before they reach the server, as keyword rules
+    /// (`"DROP DATABASE"`, `"COPY ... TO PROGRAM"`). See
+    /// [`crate::config::StatementRules`].
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub statement_deny: Vec<String>,
+
+    /// Exceptions to `statement_deny`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub statement_allow: Vec<String>,
+
+    /// Pools serving as this pool's shards, in order, for
+    /// `SET doorman.shard` / `doorman.shard_key`. See `client::shard`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub shards: Vec<String>,
+
+    /// Behavior a client driver relies on, see [`DriverCompat`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub driver_compat: Option<DriverCompat>,
+
+    /// `server_version` reported to clients in place of the backend's,
+    /// e.g. `"16.4"`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_version: Option<String>,
+
+    /// Backend host, or a comma-separated list of `host[:port]` entries
+    /// tried in order (`"pg1:5432,pg2:5432,pg3"`), or `"srv+<name>"` to
+    /// take the list from DNS SRV records.
     #[serde(default = "Pool::default_server_host")]
     pub server_host: String,
 
     #[serde(default = "Pool::default_server_port")]
     pub server_port: u16,
 
+    /// Role a host from `server_host` must have to be used.
+    #[serde(default = "Pool::default_target_session_attrs")]
+    pub target_session_attrs: TargetSessionAttrs,
+
     // The real name of the database on the server. If it is not specified, the pool name is used.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_database: Option<String>,
@@ -125,7 +257,9 @@ pub struct Pool {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub min_connection_lifetime: Option<u64>,
 
-    /// Extra connections beyond max_db_connections, used as last resort. Default: 0.
+    /// Extra connections beyond max_db_connections, used as last resort.
+    /// Without max_db_connections: extra connections beyond each user's
+    /// pool_size (PgBouncer semantics). Default: 0.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub reserve_pool_size: Option<u32>,
 
@@ -161,9 +295,29 @@ pub struct Pool {
     #[serde(default, skip_serializing_if = "Option::is_none")]
     pub fallback_lifetime: Option<Duration>,
 
+    /// Poll Patroni `/cluster` on this interval and take the backend list
+    /// from it instead of `server_host`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub patroni_discovery_interval: Option<Duration>,
+
+    /// Relative share of new connections per `server_host` entry, keyed
+    /// by `host` or `host:port`. Setting it turns the host list into a set
+    /// of equivalent backends picked in weighted random order; unlisted
+    /// hosts weigh 1, weight 0 hosts are only used when the others fail.
+    #[serde(default, skip_serializing_if = "std::collections::BTreeMap::is_empty")]
+    pub server_host_weights: std::collections::BTreeMap<String, u16>,
+
+    /// Order in which new connections try the hosts of `server_host`.
+    /// Unset: `random` with `server_host_weights`, `disable` without.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub load_balance_hosts: Option<LoadBalanceHosts>,
+
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_tls_mode: Option<String>,
 
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_tls_negotiation: Option<String>,
+
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_tls_ca_cert: Option<String>,
 
@@ -176,6 +330,17 @@ pub struct Pool {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub auth_query: Option<AuthQueryConfig>,
 
+    /// Artificial latency, dropped requests, truncated responses and
+    /// backend disconnects for chaos tests. Needs
+    /// `general.enable_fault_injection`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub fault_injection: Option<FaultInjection>,
+
+    /// Edits applied to statements before they are forwarded. See
+    /// [`crate::config::RewriteRule`].
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub rewrite_rules: Vec<RewriteRule>,
+
     /// Pool-level PostgreSQL configuration parameters added to backend
     /// `StartupMessage`s. These values override general settings per key;
     /// passthrough `auth_query` rows can override them per user. Config
@@ -221,6 +386,54 @@ impl Pool {
         true
     }
 
+    pub fn default_target_session_attrs() -> TargetSessionAttrs {
+        TargetSessionAttrs::Any
+    }
+
+    /// Hosts listed in `server_host`, in priority order. Entries without an
+    /// explicit port use `server_port`. An unparsable list (rejected by
+    /// `validate`) degrades to the raw value as a single host.
+    pub fn server_hosts(&self) -> Vec<(String, u16)> {
+        parse_server_hosts(&self.server_host, self.server_port)
+            .unwrap_or_else(|_| vec![(self.server_host.clone(), self.server_port)])
+    }
+
+    /// The `"*"` entry of `users`, used for users that are not listed.
+    pub fn wildcard_user(&self) -> Option<&User> {
+        self.users
+            .iter()
+            .find(|user| user.username == WILDCARD_USER)
+    }
+
+    /// `server_host_weights` resolved to the `(host, port)` entries of
+    /// `server_host`. Empty when no weights are set.
+    pub fn resolved_host_weights(&self) -> std::collections::HashMap<(String, u16), u16> {
+        let mut weights = std::collections::HashMap::new();
+        if self.server_host_weights.is_empty() {
+            return weights;
+        }
+        for (host, port) in self.server_hosts() {
+            if let Some(weight) = self
+                .server_host_weights
+                .iter()
+                .find(|(spec, _)| host_spec_matches(spec, &host, port))
+                .map(|(_, weight)| *weight)
+            {
+                weights.insert((host, port), weight);
+            }
+        }
+        weights
+    }
+
+    /// First host of `server_host`, used where a single address is needed
+    /// (auth_query executors, pool identity in logs and stats).
+    pub fn primary_server(&self) -> (String, u16) {
+        self.server_hosts()
+            .into_iter()
+            .next()
+            .unwrap_or_else(|| (self.server_host.clone(), self.server_port))
+    }
+
     /// Resolve scaling config by merging pool-level overrides with general defaults.
     /// Anticipation/burst params are global-only by design (no per-pool override).
     pub fn resolve_scaling_config(
@@ -240,11 +453,224 @@ impl Pool {
         }
     }
 
+    /// Per-user reserve with PgBouncer semantics. Only applies without
+    /// `max_db_connections`: the coordinator then owns the reserve for the
+    /// whole database and user pools stay within `pool_size`.
+    pub fn resolve_reserve_config(&self) -> crate::pool::ReserveConfig {
+        if self.max_db_connections.unwrap_or(0) > 0 {
+            return crate::pool::ReserveConfig::default();
+        }
+        crate::pool::ReserveConfig {
+            size: self.reserve_pool_size.unwrap_or(0) as usize,
+            timeout: std::time::Duration::from_millis(self.reserve_pool_timeout.unwrap_or(3000)),
+        }
+    }
+
+    /// `statement_timeout`, `lock_timeout` and
+    /// `idle_in_transaction_session_timeout` that are set, by GUC name.
+    fn session_timeouts(&self) -> impl Iterator<Item = (&'static str, Duration)> {
+        [
+            ("statement_timeout", self.statement_timeout),
+            ("lock_timeout", self.lock_timeout),
+            (
+                "idle_in_transaction_session_timeout",
+                self.idle_in_transaction_session_timeout,
+            ),
+        ]
+        .into_iter()
+        .filter_map(|(name, timeout)| timeout.map(|timeout| (name, timeout)))
+    }
+
+    /// The pool level of the backend startup parameter cascade:
+    /// `startup_parameters` plus the session timeouts, in milliseconds.
+    pub fn server_startup_parameters(&self) -> Cow<'_, std::collections::BTreeMap<String, String>> {
+        let mut timeouts = self.session_timeouts().peekable();
+        if timeouts.peek().is_none() {
+            return Cow::Borrowed(&self.startup_parameters);
+        }
+        let mut parameters = self.startup_parameters.clone();
+        for (name, timeout) in timeouts {
+            parameters.insert(name.to_string(), timeout.as_millis().to_string());
+        }
+        Cow::Owned(parameters)
+    }
+
+    /// DataRow and CopyData flush thresholds in bytes.
+    pub fn flush_thresholds(&self) -> (usize, usize) {
+        let default = ByteSize::from_kb(8);
+        (
+            self.data_row_flush_threshold.unwrap_or(default).as_bytes() as usize,
+            self.copy_data_flush_threshold.unwrap_or(default).as_bytes() as usize,
+        )
+    }
+
     pub async fn validate(&mut self) -> Result<(), Error> {
         crate::config::startup_parameters::validate(
             &self.startup_parameters,
             "pool.startup_parameters",
         )?;
+        for (name, _) in self.session_timeouts() {
+            if self
+                .startup_parameters
+                .keys()
+                .any(|k| k.eq_ignore_ascii_case(name))
+            {
+                return Err(Error::BadConfig(format!(
+                    "pool.{name} cannot be combined with {name} in startup_parameters"
+                )));
+            }
+        }
+
+        if let Some(template) = &self.application_name_template {
+            crate::config::application_name_template::validate(
+                template,
+                "pool.application_name_template",
+            )?;
+            if self
+                .startup_parameters
+                .keys()
+                .any(|k| k.eq_ignore_ascii_case("application_name"))
+            {
+                return Err(Error::BadConfig(
+                    "application_name_template cannot be combined with application_name \
+                     in startup_parameters"
+                        .into(),
+                ));
+            }
+        }
+
+        if let Some(template) = &self.connect_notice {
+            crate::config::connect_notice::validate(template, "pool.connect_notice")?;
+        }
+
+        if let Some(guc) = &self.client_addr_guc {
+            validate_custom_guc_name(guc, "pool.client_addr_guc")?;
+        }
+
+        if let Some(tag) = self
+            .client_tag_limits
+            .keys()
+            .find(|tag| !valid_client_tag(tag) || *tag == "other")
+        {
+            return Err(Error::BadConfig(format!(
+                "pool.client_tag_limits: '{tag}' is not a valid tag \
+                 (1 to 63 ASCII letters, digits, '_', '-' or '.'; 'other' is reserved)"
+            )));
+        }
+
+        if self.application_name_checkout_limits.contains_key("") {
+            return Err(Error::BadConfig(
+                "pool.application_name_checkout_limits: the application_name can't be empty".into(),
+            ));
+        }
+        if let Some(tag) = self
+            .tag_checkout_limits
+            .keys()
+            .find(|tag| !valid_client_tag(tag))
+        {
+            return Err(Error::BadConfig(format!(
+                "pool.tag_checkout_limits: '{tag}' is not a valid tag \
+                 (1 to 63 ASCII letters, digits, '_', '-' or '.')"
+            )));
+        }
+        for (field, limits) in [
+            (
+                "application_name_checkout_limits",
+                &self.application_name_checkout_limits,
+            ),
+            ("tag_checkout_limits", &self.tag_checkout_limits),
+        ] {
+            if let Some(key) = limits
+                .iter()
+                .find(|(_, limit)| **limit == 0)
+                .map(|(key, _)| key)
+            {
+                return Err(Error::BadConfig(format!(
+                    "pool.{field}: the limit of '{key}' must be greater than 0"
+                )));
+            }
+        }
+
+        if let Some(version) = &self.server_version {
+            if !version.starts_with(|c: char| c.is_ascii_digit())
+                || version.chars().any(|c| c.is_control())
+            {
+                return Err(Error::BadConfig(format!(
+                    "pool.server_version: {version:?} must start with the major version, e.g. \"16.4\""
+                )));
+            }
+        }
+
+        crate::config::StatementRules::compile(&self.statement_deny, &self.statement_allow)?;
+
+        if let Some(name) = crate::pool::srv::srv_name(&self.server_host) {
+            if name.is_empty() || name.contains(',') {
+                return Err(Error::BadConfig(format!(
+                    "server_host: '{}' must name exactly one SRV record",
+                    self.server_host
+                )));
+            }
+            // Executors connect to a single fixed address.
+            if self.auth_query.is_some() {
+                return Err(Error::BadConfig(
+                    "server_host: SRV discovery cannot be combined with auth_query".into(),
+                ));
+            }
+        }
+        let hosts = parse_server_hosts(&self.server_host, self.server_port)
+            .map_err(|err| Error::BadConfig(format!("server_host: {err}")))?;
+        if hosts.len() == 1
+            && crate::pool::srv::srv_name(&self.server_host).is_none()
+            && self.target_session_attrs != TargetSessionAttrs::Any
+        {
+            warn!(
+                "target_session_attrs = \"{}\" with a single server_host: \
+                 connections are refused while that host has the wrong role",
+                self.target_session_attrs
+            );
+        }
+
+        let balanced = self
+            .load_balance_hosts
+            .is_some_and(|policy| policy != LoadBalanceHosts::Disable);
+        if !self.server_host_weights.is_empty() || balanced {
+            let setting = if balanced {
+                "load_balance_hosts"
+            } else {
+                "server_host_weights"
+            };
+            if self.load_balance_hosts == Some(LoadBalanceHosts::Disable) {
+                return Err(Error::BadConfig(
+                    "server_host_weights cannot be combined with load_balance_hosts = \"disable\""
+                        .into(),
+                ));
+            }
+            if crate::pool::srv::srv_name(&self.server_host).is_some() {
+                return Err(Error::BadConfig(format!(
+                    "{setting} cannot be combined with an SRV server_host; \
+                     SRV records carry their own weights"
+                )));
+            }
+            if self.patroni_discovery_interval.is_some() {
+                return Err(Error::BadConfig(format!(
+                    "{setting} cannot be combined with patroni_discovery_interval"
+                )));
+            }
+            if hosts.len() < 2 {
+                return Err(Error::BadConfig(format!(
+                    "{setting} needs a server_host list of two or more hosts"
+                )));
+            }
+            if let Some(spec) = self.server_host_weights.keys().find(|spec| {
+                !hosts
+                    .iter()
+                    .any(|(host, port)| host_spec_matches(spec, host, *port))
+            }) {
+                return Err(Error::BadConfig(format!(
+                    "server_host_weights: '{spec}' is not in server_host"
+                )));
+            }
+        }
 
         // Validate scaling_warm_pool_ratio
         if let Some(ratio) = self.scaling_warm_pool_ratio {
@@ -288,6 +714,15 @@ impl Pool {
                             max,
                             max
                         );
+                    } else if user.max_pool_size.is_some_and(|size| size > max) {
+                        log::warn!(
+                            "user '{}' max_pool_size ({}) exceeds max_db_connections ({}); \
+                             adaptive sizing is effectively capped at {}",
+                            user.username,
+                            user.max_pool_size.unwrap_or_default(),
+                            max,
+                            max
+                        );
                     }
                 }
 
@@ -326,6 +761,13 @@ impl Pool {
             }
         }
 
+        if self.auth_query.is_some() && self.wildcard_user().is_some() {
+            return Err(Error::BadConfig(format!(
+                "user \"{WILDCARD_USER}\" can't be combined with auth_query, which already \
+                 serves users that are not listed"
+            )));
+        }
+
         // Validate username uniqueness
         let mut seen_usernames = HashSet::new();
         for user in &self.users {
@@ -393,6 +835,41 @@ impl Pool {
             }
         }
 
+        if self
+            .server_max_memory
+            .is_some_and(|max| max.as_bytes() == 0)
+        {
+            return Err(Error::BadConfig(
+                "server_max_memory must be greater than 0".into(),
+            ));
+        }
+
+        if self
+            .max_query_time_grace
+            .is_some_and(|grace| grace.as_millis() == 0)
+        {
+            return Err(Error::BadConfig("max_query_time_grace must be > 0".into()));
+        }
+
+        if self.server_connect_attempts == Some(0) {
+            return Err(Error::BadConfig(
+                "server_connect_attempts must be >= 1".into(),
+            ));
+        }
+
+        if let Some(ref dur) = self.patroni_discovery_interval {
+            if dur.as_millis() == 0 {
+                return Err(Error::BadConfig(
+                    "patroni_discovery_interval must be > 0".into(),
+                ));
+            }
+            if crate::pool::srv::srv_name(&self.server_host).is_some() {
+                return Err(Error::BadConfig(
+                    "patroni_discovery_interval cannot be combined with an SRV server_host".into(),
+                ));
+            }
+        }
+
         // Lifetime longer than the cooldown lets fallback connections outlive
         // the local-backend recovery, mixing primary and fallback in the pool.
         if let (Some(ref lifetime), Some(ref cooldown)) =
@@ -409,6 +886,14 @@ impl Pool {
             }
         }
 
+        if let Some(faults) = &self.fault_injection {
+            faults.validate()?;
+        }
+
+        for (i, rule) in self.rewrite_rules.iter().enumerate() {
+            rule.compile(&format!("rewrite_rules[{i}]"))?;
+        }
+
         // Validate auth_query config
         if let Some(ref aq) = self.auth_query {
             if aq.query.is_empty() {
@@ -438,6 +923,84 @@ impl Pool {
     }
 }
 
+/// True when `spec` (`host`, `host:port` or `[host]:port`) names the
+/// `server_host` entry `host:port`. A bare host matches every port.
+pub(crate) fn host_spec_matches(spec: &str, host: &str, port: u16) -> bool {
+    spec == host || spec == format!("{host}:{port}") || spec == format!("[{host}]:{port}")
+}
+
+/// Split `server_host` into `(host, port)` pairs. Accepts `host`,
+/// `host:port`, `[v6addr]:port` and unix socket directories; a bare IPv6
+/// address without brackets is taken as a host without a port.
+pub(crate) fn parse_server_hosts(
+    spec: &str,
+    default_port: u16,
+) -> Result<Vec<(String, u16)>, String> {
+    if !spec.contains(',') {
+        return Ok(vec![(spec.to_string(), default_port)]);
+    }
+    let mut hosts = Vec::new();
+    for entry in spec.split(',').map(str::trim) {
+        if entry.is_empty() {
+            return Err(format!("empty entry in host list '{spec}'"));
+        }
+        let (host, port) = if let Some(rest) = entry.strip_prefix('[') {
+            match rest.split_once(']') {
+                Some((host, "")) => (host, None),
+                Some((host, port)) => match port.strip_prefix(':') {
+                    Some(port) => (host, Some(port)),
+                    None => return Err(format!("invalid host entry '{entry}'")),
+                },
+                None => return Err(format!("unterminated '[' in host entry '{entry}'")),
+            }
+        } else if entry.starts_with('/') || entry.matches(':').count() != 1 {
+            (entry, None)
+        } else {
+            let (host, port) = entry.split_once(':').expect("one colon");
+            (host, Some(port))
+        };
+        let port = match port {
+            Some(port) => port
+                .parse::<u16>()
+                .map_err(|_| format!("invalid port '{port}' in host entry '{entry}'"))?,
+            None => default_port,
+        };
+        if host.is_empty() {
+            return Err(format!("empty host in host entry '{entry}'"));
+        }
+        hosts.push((host.to_string(), port));
+    }
+    Ok(hosts)
+}
+
+/// Custom GUCs are written unquoted into `SET`, so accept only what
+/// PostgreSQL takes as a placeholder variable: two or more lowercase
+/// identifiers joined by dots.
+pub(crate) fn validate_custom_guc_name(name: &str, scope: &str) -> Result<(), Error> {
+    let valid_part = |part: &str| {
+        part.starts_with(|c: char| c.is_ascii_lowercase() || c == '_')
+            && part
+                .chars()
+                .all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || c == '_')
+    };
+    if !name.contains('.') || !name.split('.').all(valid_part) {
+        return Err(Error::BadConfig(format!(
+            "{scope}: '{name}' must be a custom parameter name such as 'doorman.client_addr' \
+             (lowercase letters, digits and '_', with a '.' after the prefix)"
+        )));
+    }
+    Ok(())
+}
+
+/// Whether `tag` can be a client tag: 1 to 63 ASCII letters, digits,
+/// `_`, `-` or `.`.
+pub(crate) fn valid_client_tag(tag: &str) -> bool {
+    (1..=63).contains(&tag.len())
+        && tag
+            .bytes()
+            .all(|b| b.is_ascii_alphanumeric() || matches!(b, b'_' | b'-' | b'.'))
+}
+
 impl Default for Pool {
     fn default() -> Pool {
         Pool {
@@ -445,13 +1008,37 @@ impl Default for Pool {
             users: Vec::new(),
             server_port: 5432,
             server_host: String::from("127.0.0.1"),
+            target_session_attrs: TargetSessionAttrs::Any,
             server_database: None,
             connect_timeout: None,
             idle_timeout: None,
             server_lifetime: None,
+            server_connect_attempts: None,
+            server_connect_backoff: None,
+            server_login_retry: None,
+            server_round_robin: None,
+            server_max_memory: None,
+            max_query_time: None,
+            max_query_time_grace: None,
+            statement_timeout: None,
+            lock_timeout: None,
+            idle_in_transaction_session_timeout: None,
+            data_row_flush_threshold: None,
+            copy_data_flush_threshold: None,
             cleanup_server_connections: true,
             log_client_parameter_status_changes: false,
             application_name: None,
+            application_name_template: None,
+            connect_notice: None,
+            client_addr_guc: None,
+            client_tag_limits: std::collections::BTreeMap::new(),
+            application_name_checkout_limits: std::collections::BTreeMap::new(),
+            tag_checkout_limits: std::collections::BTreeMap::new(),
+            statement_deny: Vec::new(),
+            statement_allow: Vec::new(),
+            shards: Vec::new(),
+            driver_compat: None,
+            server_version: None,
             prepared_statements_cache_size: None,
             server_prepared_statements_cache_size: None,
             scaling_warm_pool_ratio: None,
@@ -466,16 +1053,42 @@ impl Default for Pool {
             patroni_api_timeout: None,
             fallback_connect_timeout: None,
             fallback_lifetime: None,
+            patroni_discovery_interval: None,
+            server_host_weights: std::collections::BTreeMap::new(),
+            load_balance_hosts: None,
             server_tls_mode: None,
+            server_tls_negotiation: None,
             server_tls_ca_cert: None,
             server_tls_certificate: None,
             server_tls_private_key: None,
             auth_query: None,
+            fault_injection: None,
+            rewrite_rules: Vec::new(),
             startup_parameters: std::collections::BTreeMap::new(),
         }
     }
 }
 
+/// Driver compatibility profile of a pool (`driver_compat`):
+/// - jdbc: the PostgreSQL JDBC driver. A Bind or Describe of a statement
+///   pg_doorman does not know fails its pipeline instead of closing the
+///   client, so the driver can prepare it again, and `DEALLOCATE` is
+///   answered exactly as PostgreSQL answers it.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Copy, Hash)]
+#[serde(rename_all = "snake_case")]
+pub enum DriverCompat {
+    Jdbc,
+}
+
+impl fmt::Display for DriverCompat {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let str = match *self {
+            DriverCompat::Jdbc => "jdbc",
+        };
+        write!(f, "{str}")
+    }
+}
+
 #[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash)]
 pub struct AuthQueryConfig {
     /// SQL query to fetch credentials. Must return (username, password_hash).
@@ -0,0 +1,172 @@
+//! Maintenance windows for scheduled server connection recycling
+//! (`general.server_recycle_windows`).
+//!
+//! A window is written like the day and time fields of a cron line:
+//! `[DAYS ]HH:MM-HH:MM`, where `DAYS` is `*`, a day name (`Sun`), a list
+//! (`Sat,Sun`) or a range (`Mon-Fri`). Without `DAYS` the window opens
+//! every day. Times are in the local time zone of the pg_doorman host; a
+//! window whose end is before its start runs past midnight and belongs to
+//! the day it starts on.
+
+use crate::errors::Error;
+
+const DAY_NAMES: [&str; 7] = [
+    "monday",
+    "tuesday",
+    "wednesday",
+    "thursday",
+    "friday",
+    "saturday",
+    "sunday",
+];
+const SECONDS_PER_DAY: u32 = 24 * 60 * 60;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct RecycleWindow {
+    /// Days the window opens on, Monday first.
+    days: [bool; 7],
+    /// Seconds since midnight.
+    start: u32,
+    end: u32,
+}
+
+impl RecycleWindow {
+    pub fn parse(spec: &str) -> Result<Self, Error> {
+        let bad = |reason: &str| {
+            Error::BadConfig(format!(
+                "server_recycle_windows: invalid window \"{spec}\": {reason}"
+            ))
+        };
+        let (days, times) = match spec.trim().rsplit_once(char::is_whitespace) {
+            Some((days, times)) => (parse_days(days.trim()).map_err(|e| bad(&e))?, times),
+            None => ([true; 7], spec.trim()),
+        };
+        let (start, end) = times
+            .split_once('-')
+            .ok_or_else(|| bad("expected HH:MM-HH:MM"))?;
+        let start = parse_time(start).map_err(|e| bad(&e))?;
+        let end = parse_time(end).map_err(|e| bad(&e))?;
+        if start == end {
+            return Err(bad("start and end are equal"));
+        }
+        Ok(RecycleWindow { days, start, end })
+    }
+
+    /// Seconds since the window opened, or None when it is closed.
+    /// `weekday` counts from Monday = 0; `second` is seconds since local
+    /// midnight.
+    pub fn open_for(&self, weekday: usize, second: u32) -> Option<u32> {
+        let yesterday = (weekday + 6) % 7;
+        if self.start < self.end {
+            return (self.days[weekday] && (self.start..self.end).contains(&second))
+                .then(|| second - self.start);
+        }
+        // Past midnight: the evening part belongs to today, the morning
+        // part to the window opened yesterday.
+        if self.days[weekday] && second >= self.start {
+            Some(second - self.start)
+        } else if self.days[yesterday] && second < self.end {
+            Some(SECONDS_PER_DAY - self.start + second)
+        } else {
+            None
+        }
+    }
+}
+
+fn parse_days(spec: &str) -> Result<[bool; 7], String> {
+    if spec == "*" {
+        return Ok([true; 7]);
+    }
+    let mut days = [false; 7];
+    for part in spec.split(',') {
+        match part.split_once('-') {
+            Some((from, to)) => {
+                let (from, to) = (parse_day(from)?, parse_day(to)?);
+                let mut day = from;
+                loop {
+                    days[day] = true;
+                    if day == to {
+                        break;
+                    }
+                    day = (day + 1) % 7;
+                }
+            }
+            None => days[parse_day(part)?] = true,
+        }
+    }
+    Ok(days)
+}
+
+/// `Mon`, `monday` or any prefix of the full name of at least three letters.
+fn parse_day(name: &str) -> Result<usize, String> {
+    let lower = name.trim().to_ascii_lowercase();
+    DAY_NAMES
+        .iter()
+        .position(|day| lower.len() >= 3 && day.starts_with(lower.as_str()))
+        .ok_or_else(|| format!("unknown day \"{name}\""))
+}
+
+fn parse_time(time: &str) -> Result<u32, String> {
+    let bad = || format!("invalid time \"{time}\", expected HH:MM");
+    let (hours, minutes) = time.trim().split_once(':').ok_or_else(bad)?;
+    let hours: u32 = hours.parse().map_err(|_| bad())?;
+    let minutes: u32 = minutes.parse().map_err(|_| bad())?;
+    // 24:00 is the end of the day.
+    if minutes > 59 || hours > 24 || (hours == 24 && minutes > 0) {
+        return Err(bad());
+    }
+    Ok((hours * 60 + minutes) * 60)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const HOUR: u32 = 3600;
+
+    #[test]
+    fn daily_window() {
+        let window = RecycleWindow::parse("03:00-05:30").unwrap();
+        assert_eq!(window.open_for(2, 2 * HOUR), None);
+        assert_eq!(window.open_for(2, 3 * HOUR), Some(0));
+        assert_eq!(window.open_for(6, 5 * HOUR), Some(2 * HOUR));
+        assert_eq!(window.open_for(6, 5 * HOUR + 30 * 60), None);
+    }
+
+    #[test]
+    fn days_and_ranges() {
+        let window = RecycleWindow::parse("Sat,Sun 02:00-04:00").unwrap();
+        assert_eq!(window.open_for(4, 3 * HOUR), None);
+        assert_eq!(window.open_for(5, 3 * HOUR), Some(HOUR));
+        let window = RecycleWindow::parse("fri-mon 02:00-04:00").unwrap();
+        assert!(window.open_for(0, 3 * HOUR).is_some());
+        assert!(window.open_for(1, 3 * HOUR).is_none());
+        assert!(window.open_for(6, 3 * HOUR).is_some());
+        let window = RecycleWindow::parse("Sunday 02:00-04:00").unwrap();
+        assert!(window.open_for(6, 3 * HOUR).is_some());
+    }
+
+    #[test]
+    fn window_past_midnight_belongs_to_start_day() {
+        let window = RecycleWindow::parse("Sun 23:00-01:00").unwrap();
+        assert_eq!(window.open_for(6, 23 * HOUR), Some(0));
+        assert_eq!(window.open_for(0, HOUR / 2), Some(HOUR + HOUR / 2));
+        assert_eq!(window.open_for(6, HOUR / 2), None);
+        assert_eq!(window.open_for(0, 23 * HOUR), None);
+    }
+
+    #[test]
+    fn rejects_malformed_windows() {
+        for spec in [
+            "",
+            "03:00",
+            "03:00-03:00",
+            "25:00-26:00",
+            "Xyz 01:00-02:00",
+            "1:60-2:00",
+        ] {
+            assert!(RecycleWindow::parse(spec).is_err(), "{spec}");
+        }
+        assert!(RecycleWindow::parse("* 22:00-24:00").is_ok());
+    }
+}
@@ -0,0 +1,169 @@
+//! Per-pool query rewrite rules (`pools.<name>.rewrite_rules`).
+//!
+//! Each rule selects statements with the keyword rules of
+//! `statement_deny` (`match`, `unless`) and edits them before they are
+//! forwarded: words are renamed, and text is put in front of or after the
+//! statement. Like the deny rules they work on words, not regular
+//! expressions, so string literals and comments are never touched.
+
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+
+use super::StatementRule;
+use crate::errors::Error;
+
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq, Eq, Hash)]
+pub struct RewriteRule {
+    /// Keyword rule a statement must match; every statement when unset.
+    #[serde(default, rename = "match", skip_serializing_if = "Option::is_none")]
+    pub pattern: Option<String>,
+
+    /// Keyword rule that exempts a matching statement, e.g. `LIMIT`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub unless: Option<String>,
+
+    /// Users the rule applies to; all users of the pool when empty.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub users: Vec<String>,
+
+    /// Text put in front of the statement, e.g. `/* app */`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub prepend: Option<String>,
+
+    /// Text put after the statement, e.g. `LIMIT 1000`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub append: Option<String>,
+
+    /// Words replaced by others, e.g. a renamed table.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub rename: BTreeMap<String, String>,
+}
+
+/// A rule ready to be applied.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CompiledRewrite {
+    pub pattern: Option<StatementRule>,
+    pub unless: Option<StatementRule>,
+    pub prepend: Option<String>,
+    pub append: Option<String>,
+    /// Lowercase word and its replacement.
+    pub rename: Vec<(String, String)>,
+}
+
+impl RewriteRule {
+    pub fn compile(&self, scope: &str) -> Result<CompiledRewrite, Error> {
+        let keyword_rule = |rule: &Option<String>, key: &str| {
+            rule.as_deref()
+                .map(|r| StatementRule::parse(r, &format!("{scope}.{key}")))
+                .transpose()
+        };
+        if self.prepend.is_none() && self.append.is_none() && self.rename.is_empty() {
+            return Err(Error::BadConfig(format!(
+                "{scope}: a rule needs prepend, append or rename"
+            )));
+        }
+        for (key, text) in [("prepend", &self.prepend), ("append", &self.append)] {
+            if text.as_deref().is_some_and(|t| t.contains(['\0', ';'])) {
+                return Err(Error::BadConfig(format!(
+                    "{scope}.{key}: must not contain ';' or NUL bytes"
+                )));
+            }
+        }
+        let is_word =
+            |w: &str| !w.is_empty() && w.chars().all(|c| c.is_ascii_alphanumeric() || c == '_');
+        let mut rename = Vec::with_capacity(self.rename.len());
+        for (from, to) in &self.rename {
+            let qualified = to.split('.').all(is_word);
+            if !is_word(from) || !qualified {
+                return Err(Error::BadConfig(format!(
+                    "{scope}.rename: \"{from}\" = \"{to}\": expected a bare word and a word \
+                     or schema-qualified name"
+                )));
+            }
+            rename.push((from.to_ascii_lowercase(), to.clone()));
+        }
+        Ok(CompiledRewrite {
+            pattern: keyword_rule(&self.pattern, "match")?,
+            unless: keyword_rule(&self.unless, "unless")?,
+            prepend: self.prepend.clone(),
+            append: self.append.clone(),
+            rename,
+        })
+    }
+
+    pub fn applies_to(&self, username: &str) -> bool {
+        self.users.is_empty() || self.users.iter().any(|u| u == username)
+    }
+}
+
+/// Rules of `rules` that apply to `username`, compiled; None when there
+/// are none.
+pub fn compile_rewrite_rules(
+    rules: &[RewriteRule],
+    username: &str,
+) -> Result<Option<Vec<CompiledRewrite>>, Error> {
+    let compiled = rules
+        .iter()
+        .enumerate()
+        .filter(|(_, rule)| rule.applies_to(username))
+        .map(|(i, rule)| rule.compile(&format!("rewrite_rules[{i}]")))
+        .collect::<Result<Vec<_>, _>>()?;
+    Ok((!compiled.is_empty()).then_some(compiled))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn compiles_rules() {
+        let rule = RewriteRule {
+            pattern: Some("SELECT".into()),
+            unless: Some("LIMIT".into()),
+            append: Some("LIMIT 1000".into()),
+            rename: BTreeMap::from([("Old_Orders".into(), "sales.orders".into())]),
+            ..RewriteRule::default()
+        };
+        let compiled = rule.compile("rewrite_rules[0]").unwrap();
+        assert_eq!(
+            compiled.rename,
+            vec![("old_orders".to_string(), "sales.orders".to_string())]
+        );
+        assert!(compiled.pattern.is_some() && compiled.unless.is_some());
+    }
+
+    #[test]
+    fn rejects_malformed_rules() {
+        let no_action = RewriteRule {
+            pattern: Some("SELECT".into()),
+            ..RewriteRule::default()
+        };
+        let semicolon = RewriteRule {
+            append: Some("; DROP TABLE t".into()),
+            ..RewriteRule::default()
+        };
+        let bad_rename = RewriteRule {
+            rename: BTreeMap::from([("orders".into(), "drop table".into())]),
+            ..RewriteRule::default()
+        };
+        let bad_match = RewriteRule {
+            pattern: Some("SELECT *".into()),
+            prepend: Some("/* app */".into()),
+            ..RewriteRule::default()
+        };
+        for rule in [no_action, semicolon, bad_rename, bad_match] {
+            assert!(rule.compile("rewrite_rules[0]").is_err(), "{rule:?}");
+        }
+    }
+
+    #[test]
+    fn filters_by_user() {
+        let rules = vec![RewriteRule {
+            users: vec!["report".into()],
+            append: Some("LIMIT 1000".into()),
+            ..RewriteRule::default()
+        }];
+        assert!(compile_rewrite_rules(&rules, "report").unwrap().is_some());
+        assert!(compile_rewrite_rules(&rules, "app").unwrap().is_none());
+    }
+}
@@ -0,0 +1,157 @@
+//! `[general]` settings changed at runtime with the admin `SET` command.
+//!
+//! `SET` replaces the live config without touching the config file, so
+//! the change lasts until the next RELOAD re-reads the file. Only settings
+//! that are read again for every new client or checkout are accepted;
+//! anything captured once at startup or baked into a pool would silently
+//! keep its old value.
+
+use std::collections::BTreeSet;
+
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use super::{config_arc, lock_config_updates, store_config, Duration, General};
+
+/// Settings accepted by `SET`, besides `log_level`.
+pub const SETTABLE: &[&str] = &[
+    "query_wait_timeout",
+    "client_idle_timeout",
+    "client_login_timeout",
+    "client_write_timeout",
+    "proxy_copy_data_timeout",
+    "max_connections",
+    "log_client_connections",
+    "log_client_disconnections",
+    "log_connection_events",
+];
+
+/// Settings changed with `SET` since the config file was last read.
+static OVERRIDES: Lazy<Mutex<BTreeSet<&'static str>>> = Lazy::new(|| Mutex::new(BTreeSet::new()));
+
+/// Where the current value of a setting comes from, as shown by
+/// `SHOW CONFIG`.
+pub fn origin(key: &str, value: &str, default: Option<&str>) -> &'static str {
+    if OVERRIDES.lock().contains(key) {
+        "runtime"
+    } else if default == Some(value) {
+        "default"
+    } else {
+        "file"
+    }
+}
+
+/// Forget runtime changes; called once the config file has been re-read.
+pub fn clear_overrides() {
+    OVERRIDES.lock().clear();
+}
+
+/// Apply `SET <name> = <value>` to the live config and return the new
+/// value as `SHOW CONFIG` prints it.
+pub async fn set_general(name: &str, value: &str) -> Result<String, String> {
+    let name = name.to_ascii_lowercase();
+    let Some(key) = SETTABLE.iter().copied().find(|key| *key == name) else {
+        return Err(format!(
+            "Unknown SET parameter: {name}. Supported: log_level, {}",
+            SETTABLE.join(", ")
+        ));
+    };
+
+    let _update = lock_config_updates().await;
+    let mut config = (*config_arc()).clone();
+    let shown = apply(&mut config.general, key, value)?;
+    let wait = config.general.query_wait_timeout.as_std();
+    store_config(config);
+    if key == "query_wait_timeout" {
+        // Pools keep their wait timeout from creation; push the new one
+        // into the pools that already exist, before a RELOAD can replace
+        // them.
+        for pool in crate::pool::get_all_pools().values() {
+            pool.database.set_wait_timeout(Some(wait));
+        }
+    }
+    OVERRIDES.lock().insert(key);
+    Ok(shown)
+}
+
+fn apply(general: &mut General, key: &str, value: &str) -> Result<String, String> {
+    let duration = |value: &str| -> Result<Duration, String> {
+        value
+            .parse::<Duration>()
+            .map_err(|err| format!("invalid value for {key}: {err}"))
+    };
+    let shown = match key {
+        "query_wait_timeout" => {
+            general.query_wait_timeout = duration(value)?;
+            general.query_wait_timeout.to_string()
+        }
+        "client_idle_timeout" => {
+            general.client_idle_timeout = duration(value)?;
+            general.client_idle_timeout.to_string()
+        }
+        "client_login_timeout" => {
+            general.client_login_timeout = duration(value)?;
+            general.client_login_timeout.to_string()
+        }
+        "client_write_timeout" => {
+            general.client_write_timeout = duration(value)?;
+            general.client_write_timeout.to_string()
+        }
+        "proxy_copy_data_timeout" => {
+            general.proxy_copy_data_timeout = duration(value)?;
+            general.proxy_copy_data_timeout.to_string()
+        }
+        "max_connections" => {
+            general.max_connections = value
+                .parse()
+                .map_err(|_| format!("invalid value for {key}: '{value}' is not a number"))?;
+            general.max_connections.to_string()
+        }
+        "log_client_connections" => {
+            general.log_client_connections = parse_bool(key, value)?;
+            general.log_client_connections.to_string()
+        }
+        "log_client_disconnections" => {
+            general.log_client_disconnections = parse_bool(key, value)?;
+            general.log_client_disconnections.to_string()
+        }
+        "log_connection_events" => {
+            general.log_connection_events = parse_bool(key, value)?;
+            general.log_connection_events.to_string()
+        }
+        _ => unreachable!("{key} is listed in SETTABLE"),
+    };
+    Ok(shown)
+}
+
+fn parse_bool(key: &str, value: &str) -> Result<bool, String> {
+    match value.to_ascii_lowercase().as_str() {
+        "on" | "true" | "yes" | "1" => Ok(true),
+        "off" | "false" | "no" | "0" => Ok(false),
+        _ => Err(format!(
+            "invalid value for {key}: '{value}' is not a boolean"
+        )),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn apply_parses_durations_and_booleans() {
+        let mut general = General::default();
+        assert_eq!(
+            apply(&mut general, "query_wait_timeout", "3s").unwrap(),
+            "3000"
+        );
+        assert_eq!(general.query_wait_timeout.as_millis(), 3000);
+        assert_eq!(
+            apply(&mut general, "log_client_connections", "off").unwrap(),
+            "false"
+        );
+        assert!(!general.log_client_connections);
+        assert!(apply(&mut general, "max_connections", "many").is_err());
+        assert!(apply(&mut general, "client_idle_timeout", "-1s").is_err());
+    }
+}
@@ -0,0 +1,134 @@
+//! Per-pool statement rules (`statement_deny`, `statement_allow`).
+//!
+//! A rule is a sequence of SQL keywords such as `DROP DATABASE` or
+//! `COPY ... TO PROGRAM`, where `...` stands for any words in between. It
+//! matches a statement that contains those keywords in that order, next to
+//! each other except across `...`; case is ignored. Statements are matched
+//! lexically by the client, like `auto_session_pinning`: string literals
+//! and comments never match. Rules are keywords rather than regular
+//! expressions to keep `regex` out of the runtime dependency set and the
+//! check cheap on every query.
+
+use crate::errors::Error;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct StatementRule {
+    /// The rule as written, for the client error and the audit log.
+    pub text: String,
+    /// Runs of adjacent keywords, lowercase; `...` separates them.
+    pub segments: Vec<Vec<String>>,
+}
+
+impl StatementRule {
+    pub fn parse(text: &str, scope: &str) -> Result<Self, Error> {
+        let bad =
+            |reason: &str| Error::BadConfig(format!("{scope}: invalid rule \"{text}\": {reason}"));
+        let mut segments: Vec<Vec<String>> = vec![Vec::new()];
+        for token in text.split_whitespace() {
+            if token == "..." {
+                if segments.last().is_some_and(Vec::is_empty) {
+                    return Err(bad("`...` must stand between keywords"));
+                }
+                segments.push(Vec::new());
+            } else if token.chars().all(|c| c.is_ascii_alphanumeric() || c == '_') {
+                if let Some(segment) = segments.last_mut() {
+                    segment.push(token.to_ascii_lowercase());
+                }
+            } else {
+                return Err(bad(&format!("\"{token}\" is not a keyword")));
+            }
+        }
+        if segments.last().is_some_and(Vec::is_empty) {
+            return Err(bad(if segments.len() == 1 {
+                "no keywords"
+            } else {
+                "`...` must stand between keywords"
+            }));
+        }
+        Ok(StatementRule {
+            text: text.split_whitespace().collect::<Vec<_>>().join(" "),
+            segments,
+        })
+    }
+}
+
+/// Compiled rules of one pool.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct StatementRules {
+    pub deny: Vec<StatementRule>,
+    /// Exceptions: a statement matching an allow rule is never denied.
+    pub allow: Vec<StatementRule>,
+}
+
+impl StatementRules {
+    /// None when there are no deny rules, so pools without rules skip the
+    /// check entirely.
+    pub fn compile(deny: &[String], allow: &[String]) -> Result<Option<Self>, Error> {
+        if deny.is_empty() {
+            if !allow.is_empty() {
+                return Err(Error::BadConfig(
+                    "statement_allow: allow rules are exceptions to statement_deny, \
+                     which is empty"
+                        .into(),
+                ));
+            }
+            return Ok(None);
+        }
+        let parse = |rules: &[String], scope: &str| -> Result<Vec<StatementRule>, Error> {
+            rules
+                .iter()
+                .map(|r| StatementRule::parse(r, scope))
+                .collect()
+        };
+        Ok(Some(StatementRules {
+            deny: parse(deny, "statement_deny")?,
+            allow: parse(allow, "statement_allow")?,
+        }))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_keywords_and_gaps() {
+        let rule = StatementRule::parse("COPY ...  to Program", "statement_deny").unwrap();
+        assert_eq!(rule.text, "COPY ... to Program");
+        assert_eq!(
+            rule.segments,
+            vec![
+                vec!["copy".to_string()],
+                vec!["to".to_string(), "program".to_string()]
+            ]
+        );
+    }
+
+    #[test]
+    fn rejects_malformed_rules() {
+        for rule in [
+            "",
+            "   ",
+            "... DROP",
+            "DROP ...",
+            "DROP ... ... TABLE",
+            "DROP DATABASE;",
+        ] {
+            assert!(
+                StatementRule::parse(rule, "statement_deny").is_err(),
+                "{rule}"
+            );
+        }
+    }
+
+    #[test]
+    fn allow_needs_deny() {
+        assert_eq!(StatementRules::compile(&[], &[]).unwrap(), None);
+        assert!(StatementRules::compile(&[], &["DROP TABLE".into()]).is_err());
+        let rules = StatementRules::compile(&["DROP".into()], &["DROP TABLE".into()])
+            .unwrap()
+            .unwrap();
+        assert_eq!(rules.deny.len(), 1);
+        assert_eq!(rules.allow.len(), 1);
+    }
+}
@@ -116,6 +116,32 @@ async fn test_validate_valid_config() {
     assert!(result.is_ok());
 }
 
+#[tokio::test]
+async fn test_validate_resolves_auto_worker_threads() {
+    let mut config = Config::default();
+    config.general.worker_threads = 0;
+    config.validate().await.unwrap();
+    assert_eq!(config.general.worker_threads, General::available_cpus());
+    assert!(config.general.worker_threads >= 1);
+
+    config.general.worker_threads = 3;
+    config.validate().await.unwrap();
+    assert_eq!(config.general.worker_threads, 3);
+}
+
+#[tokio::test]
+async fn test_validate_max_client_message_size() {
+    let mut config = Config::default();
+    config.general.max_client_message_size = ByteSize::from_bytes(512);
+    assert!(config.validate().await.is_err());
+
+    config.general.max_client_message_size = ByteSize::from_gb(1);
+    assert!(config.validate().await.is_err());
+
+    config.general.max_client_message_size = ByteSize::from_mb(16);
+    assert!(config.validate().await.is_ok());
+}
+
 #[tokio::test]
 async fn test_validate_tls_rate_limit_less_than_100() {
     let mut config = Config::default();
@@ -1662,7 +1688,11 @@ async fn test_validate_reserve_pool_timeout_skipped_when_coordinator_disabled()
 
 fn tcp_transport(ip: &str) -> ClientTransport {
     let peer = std::net::SocketAddr::new(ip.parse().unwrap(), 12345);
-    ClientTransport::Tcp { peer, ssl: false }
+    ClientTransport::Tcp {
+        peer,
+        ssl: false,
+        listener: None,
+    }
 }
 
 #[test]
@@ -2102,3 +2132,656 @@ async fn reject_merged_general_pool_startup_parameters_overflow() {
         other => panic!("expected BadConfig, got {other:?}"),
     }
 }
+
+// --- Multi-host server_host ---
+
+#[test]
+fn test_server_hosts_single_host_is_kept_verbatim() {
+    let pool = Pool {
+        server_host: "/var/run/postgresql".to_string(),
+        server_port: 6432,
+        ..Pool::default()
+    };
+    assert_eq!(
+        pool.server_hosts(),
+        vec![("/var/run/postgresql".to_string(), 6432)]
+    );
+}
+
+#[test]
+fn test_server_hosts_list_with_mixed_ports() {
+    let pool = Pool {
+        server_host: "pg1:5433, pg2 ,[::1]:5434,fe80::1".to_string(),
+        server_port: 5432,
+        ..Pool::default()
+    };
+    assert_eq!(
+        pool.server_hosts(),
+        vec![
+            ("pg1".to_string(), 5433),
+            ("pg2".to_string(), 5432),
+            ("::1".to_string(), 5434),
+            ("fe80::1".to_string(), 5432),
+        ]
+    );
+    assert_eq!(pool.primary_server(), ("pg1".to_string(), 5433));
+}
+
+#[tokio::test]
+async fn test_validate_rejects_malformed_host_list() {
+    for spec in ["pg1,,pg2", "pg1:notaport,pg2", "[::1:5432,pg2", ":5432,pg2"] {
+        let mut pool = Pool {
+            server_host: spec.to_string(),
+            ..Pool::default()
+        };
+        let err = pool.validate().await.unwrap_err().to_string();
+        assert!(err.contains("server_host"), "{spec}: {err}");
+    }
+}
+
+#[tokio::test]
+async fn test_server_host_weights_resolve_and_validate() {
+    let mut pool = Pool {
+        server_host: "pg1:5433,pg2,[::1]:6432".to_string(),
+        server_host_weights: std::collections::BTreeMap::from([
+            ("pg1".to_string(), 3),
+            ("[::1]:6432".to_string(), 0),
+        ]),
+        ..Pool::default()
+    };
+    pool.validate().await.unwrap();
+    assert_eq!(
+        pool.resolved_host_weights(),
+        std::collections::HashMap::from([
+            (("pg1".to_string(), 5433), 3),
+            (("::1".to_string(), 6432), 0),
+        ])
+    );
+
+    pool.server_host_weights.insert("pg3".to_string(), 1);
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("'pg3' is not in server_host"), "{err}");
+
+    let mut single = Pool {
+        server_host: "pg1".to_string(),
+        server_host_weights: std::collections::BTreeMap::from([("pg1".to_string(), 1)]),
+        ..Pool::default()
+    };
+    let err = single.validate().await.unwrap_err().to_string();
+    assert!(err.contains("two or more hosts"), "{err}");
+
+    pool.server_host_weights.remove("pg3");
+    pool.load_balance_hosts = Some(LoadBalanceHosts::Disable);
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("load_balance_hosts = \"disable\""), "{err}");
+
+    let mut policy_only = Pool {
+        server_host: "pg1".to_string(),
+        load_balance_hosts: Some(LoadBalanceHosts::EwmaLatency),
+        ..Pool::default()
+    };
+    let err = policy_only.validate().await.unwrap_err().to_string();
+    assert!(err.contains("load_balance_hosts needs"), "{err}");
+}
+
+#[test]
+fn test_target_session_attrs_aliases() {
+    #[derive(serde::Deserialize)]
+    struct Wrapper {
+        attrs: TargetSessionAttrs,
+    }
+    for (raw, expected) in [
+        ("any", TargetSessionAttrs::Any),
+        ("primary", TargetSessionAttrs::Primary),
+        ("read-write", TargetSessionAttrs::Primary),
+        ("standby", TargetSessionAttrs::Standby),
+        ("read-only", TargetSessionAttrs::Standby),
+    ] {
+        let parsed: Wrapper = toml::from_str(&format!("attrs = \"{raw}\"")).unwrap();
+        assert_eq!(parsed.attrs, expected, "{raw}");
+    }
+}
+
+#[test]
+fn test_server_hosts_srv_spec_is_kept_verbatim() {
+    let pool = Pool {
+        server_host: "srv+_postgres._tcp.mycluster.internal".to_string(),
+        ..Pool::default()
+    };
+    assert_eq!(
+        pool.server_hosts(),
+        vec![("srv+_postgres._tcp.mycluster.internal".to_string(), 5432)]
+    );
+}
+
+#[tokio::test]
+async fn test_validate_rejects_bad_srv_host() {
+    for spec in ["srv+", "srv+_pg._tcp.a,pg2"] {
+        let mut pool = Pool {
+            server_host: spec.to_string(),
+            ..Pool::default()
+        };
+        let err = pool.validate().await.unwrap_err().to_string();
+        assert!(err.contains("SRV record"), "{spec}: {err}");
+    }
+
+    let mut pool = Pool {
+        server_host: "srv+_postgres._tcp.mycluster.internal".to_string(),
+        ..Pool::default()
+    };
+    assert!(pool.validate().await.is_ok());
+    pool.auth_query = Some(pool::AuthQueryConfig {
+        query: "SELECT usename, passwd FROM pg_shadow WHERE usename = $1".to_string(),
+        user: "pg_doorman_auth".to_string(),
+        password: "secret".to_string(),
+        database: None,
+        workers: 2,
+        server_user: None,
+        server_password: None,
+        pool_size: 40,
+        min_pool_size: 0,
+        cache_ttl: Duration::from_hours(1),
+        cache_failure_ttl: Duration::from_secs(30),
+        min_interval: Duration::from_secs(1),
+    });
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("auth_query"), "{err}");
+}
+
+#[tokio::test]
+async fn test_validate_patroni_discovery_requires_urls() {
+    let mut config = Config::default();
+    let mut pool = Pool {
+        patroni_discovery_interval: Some(Duration::from_secs(2)),
+        ..Pool::default()
+    };
+    pool.users.push(User {
+        username: "test_user".to_string(),
+        password: "test_password".to_string(),
+        pool_size: 50,
+        ..User::default()
+    });
+    config.pools.insert("test_pool".to_string(), pool);
+    config.general.tls_rate_limit_per_second = 100;
+    config.general.prepared_statements = true;
+    config.general.prepared_statements_cache_size = 1024;
+
+    let err = config.validate().await.unwrap_err().to_string();
+    assert!(err.contains("requires patroni_api_urls"), "{err}");
+
+    config.general.patroni_api_urls = Some(vec!["http://10.0.0.1:8008".to_string()]);
+    assert!(config.validate().await.is_ok());
+}
+
+#[tokio::test]
+async fn test_validate_patroni_discovery_rejects_srv_and_zero() {
+    let mut pool = Pool {
+        patroni_discovery_interval: Some(Duration::from_millis(0)),
+        ..Pool::default()
+    };
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(
+        err.contains("patroni_discovery_interval must be > 0"),
+        "{err}"
+    );
+
+    pool.patroni_discovery_interval = Some(Duration::from_secs(2));
+    pool.server_host = "srv+_postgres._tcp.mycluster.internal".to_string();
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("SRV"), "{err}");
+}
+
+#[test]
+fn test_server_idle_timeout_alias() {
+    let pool: Pool = toml::from_str(
+        r#"
+server_host = "127.0.0.1"
+server_port = 5432
+server_idle_timeout = 15000
+"#,
+    )
+    .unwrap();
+    assert_eq!(pool.idle_timeout, Some(15000));
+
+    let general: General = serde_yaml::from_str(
+        r#"
+host: "0.0.0.0"
+port: 6432
+admin_username: "admin"
+admin_password: "x"
+server_idle_timeout: "30s"
+"#,
+    )
+    .unwrap();
+    assert_eq!(general.idle_timeout.as_millis(), 30_000);
+}
+
+#[tokio::test]
+async fn test_validate_server_connect_attempts() {
+    let mut pool = Pool {
+        server_connect_attempts: Some(0),
+        ..Pool::default()
+    };
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(
+        err.contains("server_connect_attempts must be >= 1"),
+        "{err}"
+    );
+
+    pool.server_connect_attempts = Some(3);
+    pool.server_connect_backoff = Some(Duration::from_millis(200));
+    pool.server_login_retry = Some(Duration::from_secs(15));
+    assert!(pool.validate().await.is_ok());
+}
+
+#[test]
+fn test_flush_thresholds() {
+    assert_eq!(Pool::default().flush_thresholds(), (8192, 8192));
+
+    let pool: Pool = toml::from_str(
+        r#"
+server_host = "127.0.0.1"
+server_port = 5432
+data_row_flush_threshold = 0
+copy_data_flush_threshold = "256KB"
+"#,
+    )
+    .unwrap();
+    assert_eq!(pool.flush_thresholds(), (0, 256 * 1024));
+}
+
+#[tokio::test]
+async fn test_validate_client_addr_guc() {
+    let mut pool = Pool {
+        client_addr_guc: Some("doorman.client_addr".into()),
+        ..Pool::default()
+    };
+    assert!(pool.validate().await.is_ok());
+
+    for bad in [
+        "client_addr",
+        "doorman.",
+        "Doorman.addr",
+        "doorman.addr;drop",
+        "1x.addr",
+    ] {
+        pool.client_addr_guc = Some(bad.into());
+        let err = pool.validate().await.unwrap_err().to_string();
+        assert!(err.contains("pool.client_addr_guc"), "{bad}: {err}");
+    }
+}
+
+#[tokio::test]
+async fn test_validate_server_version() {
+    let mut pool = Pool {
+        server_version: Some("16.4 (Debian 16.4-1.pgdg120+2)".into()),
+        ..Pool::default()
+    };
+    assert!(pool.validate().await.is_ok());
+
+    for bad in ["", "v16", "16\n4"] {
+        pool.server_version = Some(bad.into());
+        let err = pool.validate().await.unwrap_err().to_string();
+        assert!(err.contains("pool.server_version"), "{bad:?}: {err}");
+    }
+}
+
+#[tokio::test]
+async fn test_pool_session_timeouts_join_startup_parameters() {
+    let mut pool = Pool {
+        statement_timeout: Some(Duration::from_secs(30)),
+        idle_in_transaction_session_timeout: Some(Duration::from_millis(0)),
+        ..Pool::default()
+    };
+    pool.startup_parameters
+        .insert("work_mem".to_string(), "64MB".to_string());
+    assert!(pool.validate().await.is_ok());
+
+    let parameters = pool.server_startup_parameters();
+    assert_eq!(parameters["statement_timeout"], "30000");
+    assert_eq!(parameters["idle_in_transaction_session_timeout"], "0");
+    assert_eq!(parameters["work_mem"], "64MB");
+    assert!(!parameters.contains_key("lock_timeout"));
+
+    pool.startup_parameters
+        .insert("Statement_Timeout".to_string(), "1s".to_string());
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("pool.statement_timeout"), "{err}");
+}
+
+#[tokio::test]
+async fn test_validate_next_password() {
+    let current = "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU=";
+    let salt = base64::Engine::decode(
+        &base64::engine::general_purpose::STANDARD,
+        "W22ZaJ0SNY7soEsUEjb6gQ==",
+    )
+    .unwrap();
+    let mut user = User {
+        password: current.to_string(),
+        next_password: Some(crate::auth::scram::build_server_secret(
+            "rotated", &salt, 4096,
+        )),
+        ..User::default()
+    };
+    assert!(user.validate().await.is_ok());
+
+    // A fresh salt cannot be served by the same SCRAM challenge.
+    user.next_password = Some(crate::auth::scram::generate_server_secret("rotated", 4096));
+    let err = user.validate().await.unwrap_err().to_string();
+    assert!(err.contains("same salt and iterations"), "{err}");
+
+    user.next_password = Some("md520c46e3762c864548e296b33c3406aa9".to_string());
+    let err = user.validate().await.unwrap_err().to_string();
+    assert!(err.contains("same kind as password"), "{err}");
+
+    user.password = "md5d41d8cd98f00b204e9800998ecf8427e".to_string();
+    assert!(user.validate().await.is_ok());
+}
+
+#[tokio::test]
+async fn test_validate_server_vault_path() {
+    let mut user = User {
+        username: "app".to_string(),
+        password: "md5d41d8cd98f00b204e9800998ecf8427e".to_string(),
+        server_vault_path: Some("database/creds/app".to_string()),
+        ..User::default()
+    };
+    assert!(user.validate().await.is_ok());
+
+    user.server_vault_path = Some("/v1/database/creds/app".to_string());
+    let err = user.validate().await.unwrap_err().to_string();
+    assert!(err.contains("relative to /v1/"), "{err}");
+
+    user.server_vault_path = Some("database/static-creds/app".to_string());
+    user.server_username = Some("app".to_string());
+    let err = user.validate().await.unwrap_err().to_string();
+    assert!(err.contains("can't be combined"), "{err}");
+
+    // The user is fine on its own, but the config has no vault section.
+    user.server_username = None;
+    let mut config = Config::default();
+    let mut pool = Pool::default();
+    pool.users.push(user);
+    config.pools.insert("app_db".to_string(), pool);
+    let err = config.validate().await.unwrap_err().to_string();
+    assert!(err.contains("vault.addr is not configured"), "{err}");
+}
+
+#[tokio::test]
+async fn test_validate_server_rds_iam() {
+    let user = User {
+        username: "app".to_string(),
+        password: "md5d41d8cd98f00b204e9800998ecf8427e".to_string(),
+        server_rds_iam: true,
+        ..User::default()
+    };
+    assert!(user.validate().await.is_ok());
+    let with_password = User {
+        server_username: Some("app".to_string()),
+        server_password: Some("secret".to_string()),
+        ..user.clone()
+    };
+    let err = with_password.validate().await.unwrap_err().to_string();
+    assert!(err.contains("remove server_password"), "{err}");
+
+    // The token is sent as a cleartext password: plain-capable TLS modes
+    // are rejected.
+    let mut config = Config::default();
+    let mut pool = Pool {
+        server_host: "orders.c9akciq32.eu-west-1.rds.amazonaws.com".to_string(),
+        ..Pool::default()
+    };
+    pool.users.push(user);
+    config.pools.insert("orders".to_string(), pool);
+    config.general.server_tls_mode = "allow".to_string();
+    let err = config.validate().await.unwrap_err().to_string();
+    assert!(
+        err.contains("server_rds_iam requires server_tls_mode"),
+        "{err}"
+    );
+
+    config.pools.get_mut("orders").unwrap().server_tls_mode = Some("require".to_string());
+    if let Err(err) = config.validate().await {
+        assert!(!err.to_string().contains("server_rds_iam"), "{err}");
+    }
+}
+
+#[tokio::test]
+async fn test_validate_scram_passthrough() {
+    let user = User {
+        username: "app".to_string(),
+        password: "scram-passthrough".to_string(),
+        ..User::default()
+    };
+    assert!(user.validate().await.is_ok());
+    let same_name = User {
+        server_username: Some("app".to_string()),
+        ..user.clone()
+    };
+    assert!(same_name.validate().await.is_ok());
+
+    for invalid in [
+        User {
+            server_username: Some("owner".to_string()),
+            server_password: Some("secret".to_string()),
+            ..user.clone()
+        },
+        User {
+            server_vault_path: Some("database/creds/app".to_string()),
+            ..user.clone()
+        },
+        User {
+            min_pool_size: Some(2),
+            ..user.clone()
+        },
+    ] {
+        let err = invalid.validate().await.unwrap_err().to_string();
+        assert!(err.contains("can't be combined with"), "{err}");
+    }
+}
+
+#[test]
+fn test_validate_acme() {
+    let mut general = Config::default().general;
+    let acme = Acme {
+        domains: vec!["db.example.com".to_string()],
+        ..Acme::empty()
+    };
+    assert!(Acme::empty().validate(&general).is_ok());
+
+    // The issued certificate has to be written somewhere.
+    let err = acme.validate(&general).unwrap_err().to_string();
+    assert!(err.contains("tls_certificate and tls_private_key"), "{err}");
+
+    general.tls_certificate = Some("/nonexistent/server.crt".to_string());
+    general.tls_private_key = Some("/nonexistent/server.key".to_string());
+    assert!(acme.validate(&general).is_ok());
+    assert!(acme.awaits_certificate(&general));
+
+    let wildcard = Acme {
+        domains: vec!["*.example.com".to_string()],
+        ..acme.clone()
+    };
+    let err = wildcard.validate(&general).unwrap_err().to_string();
+    assert!(err.contains("wildcards need DNS-01"), "{err}");
+
+    let bad_listen = Acme {
+        http_listen: "80".to_string(),
+        ..acme.clone()
+    };
+    let err = bad_listen.validate(&general).unwrap_err().to_string();
+    assert!(err.contains("acme.http_listen"), "{err}");
+}
+
+#[test]
+fn test_tls_policy_from_general() {
+    let mut general = Config::default().general;
+    assert_eq!(
+        tls::TlsPolicy::from_general(&general).unwrap(),
+        tls::TlsPolicy::default()
+    );
+
+    general.tls_min_version = Some("TLSv1.3".to_string());
+    general.tls_ciphersuites = Some("TLS_AES_256_GCM_SHA384".to_string());
+    general.tls_groups = Some("X25519:P-256".to_string());
+    let policy = tls::TlsPolicy::from_general(&general).unwrap();
+    assert_eq!(policy.min_version, tls::TlsVersion::Tls13);
+    assert_eq!(policy.max_version, None);
+    assert_eq!(policy.groups.as_deref(), Some("X25519:P-256"));
+
+    general.tls_max_version = Some("1.2".to_string());
+    let err = tls::TlsPolicy::from_general(&general)
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("older than tls_min_version"), "{err}");
+
+    general.tls_max_version = None;
+    general.tls_min_version = Some("1.1".to_string());
+    let err = tls::TlsPolicy::from_general(&general)
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("the minimum is 1.2"), "{err}");
+
+    general.tls_min_version = None;
+    general.tls_ciphers = Some(" ".to_string());
+    let err = tls::TlsPolicy::from_general(&general)
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("tls_ciphers must not be empty"), "{err}");
+}
+
+#[test]
+fn test_validate_listeners() {
+    let mut general = Config::default().general;
+    general.host = "0.0.0.0".to_string();
+    general.port = 6432;
+    let pools = HashMap::from([("app".to_string(), Pool::default())]);
+    let listener = Listener {
+        name: Some("lb".to_string()),
+        host: "10.0.0.5".to_string(),
+        port: 6433,
+        tls_mode: None,
+        databases: vec!["app".to_string()],
+        proxy_protocol: true,
+    };
+    let check = |listeners: &[Listener], general: &General| {
+        listener::validate(listeners, general, &pools).map_err(|e| e.to_string())
+    };
+    assert!(check(std::slice::from_ref(&listener), &general).is_ok());
+
+    let same_port = Listener {
+        port: 6432,
+        ..listener.clone()
+    };
+    let err = check(&[same_port], &general).unwrap_err();
+    assert!(err.contains("overlaps general.host:port"), "{err}");
+
+    let other = Listener {
+        name: None,
+        host: "10.0.0.6".to_string(),
+        ..listener.clone()
+    };
+    assert!(check(&[listener.clone(), other.clone()], &general).is_ok());
+    let wildcard = Listener {
+        host: "0.0.0.0".to_string(),
+        ..other
+    };
+    let err = check(&[listener.clone(), wildcard], &general).unwrap_err();
+    assert!(err.contains("overlaps another listener"), "{err}");
+
+    let unknown_db = Listener {
+        databases: vec!["missing".to_string(), "pgdoorman".to_string()],
+        ..listener.clone()
+    };
+    let err = check(&[unknown_db], &general).unwrap_err();
+    assert!(err.contains("unknown database \"missing\""), "{err}");
+
+    let hostname = Listener {
+        host: "localhost".to_string(),
+        ..listener.clone()
+    };
+    let err = check(&[hostname], &general).unwrap_err();
+    assert!(err.contains("must be an IP address"), "{err}");
+
+    let tls = Listener {
+        tls_mode: Some("require".to_string()),
+        ..listener.clone()
+    };
+    let err = check(std::slice::from_ref(&tls), &general).unwrap_err();
+    assert!(err.contains("tls_certificate"), "{err}");
+    general.tls_certificate = Some("server.crt".to_string());
+    general.tls_private_key = Some("server.key".to_string());
+    assert!(check(&[tls], &general).is_ok());
+
+    let verify = Listener {
+        tls_mode: Some("verify-full".to_string()),
+        ..listener.clone()
+    };
+    let err = check(&[verify], &general).unwrap_err();
+    assert!(
+        err.contains("requires general.tls_mode verify-full"),
+        "{err}"
+    );
+
+    assert!(listener.serves("app"));
+    assert!(listener.serves("pgbouncer"));
+    assert!(!listener.serves("other"));
+}
+
+/// The "*" user logs in as the client: backend identities, per-user
+/// credentials and MD5 hashes are rejected, and auth_query can't be added.
+#[tokio::test]
+async fn test_wildcard_user_validation() {
+    let wildcard = User {
+        username: WILDCARD_USER.to_string(),
+        ..User::default()
+    };
+    let mut pool = Pool {
+        users: vec![wildcard.clone()],
+        ..Pool::default()
+    };
+    assert!(pool.validate().await.is_ok());
+    assert_eq!(pool.wildcard_user(), Some(&wildcard));
+
+    // server_password alone is fine: it is used for the client's username.
+    pool.users[0].server_password = Some("jwt-priv-key-fpath:/dev/null".to_string());
+    assert!(pool.validate().await.is_ok());
+
+    for user in [
+        User {
+            server_username: Some("app".to_string()),
+            ..wildcard.clone()
+        },
+        User {
+            password: "md5dd9a0f26a4302744db881776a09bbfad".to_string(),
+            ..wildcard.clone()
+        },
+        User {
+            server_rds_iam: true,
+            ..wildcard.clone()
+        },
+    ] {
+        pool.users = vec![user];
+        let err = pool.validate().await.unwrap_err().to_string();
+        assert!(err.contains("user \"*\" can't use"), "{err}");
+    }
+
+    pool.users = vec![wildcard];
+    pool.auth_query = Some(pool::AuthQueryConfig {
+        query: "SELECT usename, passwd FROM pg_shadow WHERE usename = $1".to_string(),
+        user: "pg_doorman_auth".to_string(),
+        password: "secret".to_string(),
+        database: None,
+        workers: 2,
+        server_user: None,
+        server_password: None,
+        pool_size: 40,
+        min_pool_size: 0,
+        cache_ttl: Duration::from_hours(1),
+        cache_failure_ttl: Duration::from_secs(30),
+        min_interval: Duration::from_secs(1),
+    });
+    let err = pool.validate().await.unwrap_err().to_string();
+    assert!(err.contains("auth_query"), "{err}");
+}
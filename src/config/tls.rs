@@ -97,6 +97,43 @@ impl ServerTlsMode {
     }
 }
 
+/// How TLS is started on server-facing connections, as libpq `sslnegotiation`.
+#[derive(Default, PartialEq, Eq, Debug, Copy, Clone)]
+pub enum ServerTlsNegotiation {
+    /// Send SSLRequest and start TLS after the server answers 'S'.
+    #[default]
+    Postgres,
+    /// Start TLS right away with ALPN `postgresql` (PostgreSQL 17+), saving
+    /// a round trip.
+    Direct,
+}
+
+impl std::fmt::Display for ServerTlsNegotiation {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            ServerTlsNegotiation::Postgres => write!(f, "postgres"),
+            ServerTlsNegotiation::Direct => write!(f, "direct"),
+        }
+    }
+}
+
+impl std::str::FromStr for ServerTlsNegotiation {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "postgres" => Ok(Self::Postgres),
+            "direct" => Ok(Self::Direct),
+            _ => Err(Error::BadConfig(format!(
+                "invalid server_tls_negotiation: {s} (expected postgres or direct)"
+            ))),
+        }
+    }
+}
+
+/// ALPN protocol of PostgreSQL direct TLS.
+pub const POSTGRESQL_ALPN: &str = "postgresql";
+
 /// TLS mode options for connections
 #[derive(PartialEq, Eq, PartialOrd, Ord, Debug, Copy, Clone)]
 pub enum TLSMode {
@@ -134,6 +171,110 @@ impl TLSMode {
     }
 }
 
+/// TLS protocol version accepted in `tls_min_version` / `tls_max_version`.
+/// Versions older than 1.2 are not offered.
+#[derive(PartialEq, Eq, PartialOrd, Ord, Debug, Copy, Clone)]
+pub enum TlsVersion {
+    Tls12,
+    Tls13,
+}
+
+impl std::fmt::Display for TlsVersion {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            TlsVersion::Tls12 => write!(f, "1.2"),
+            TlsVersion::Tls13 => write!(f, "1.3"),
+        }
+    }
+}
+
+impl std::str::FromStr for TlsVersion {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Error> {
+        let version = s.trim().to_ascii_lowercase();
+        match version.strip_prefix("tlsv").unwrap_or(&version) {
+            "1.2" => Ok(TlsVersion::Tls12),
+            "1.3" => Ok(TlsVersion::Tls13),
+            "1" | "1.0" | "1.1" => Err(Error::BadConfig(format!(
+                "TLS version {s} is not supported, the minimum is 1.2"
+            ))),
+            _ => Err(Error::BadConfig(format!(
+                "Invalid TLS version: {s} (expected 1.2 or 1.3)"
+            ))),
+        }
+    }
+}
+
+impl TlsVersion {
+    fn protocol(self) -> Protocol {
+        match self {
+            TlsVersion::Tls12 => Protocol::Tlsv12,
+            TlsVersion::Tls13 => Protocol::Tlsv13,
+        }
+    }
+}
+
+/// Protocol versions, ciphers and key exchange groups offered to clients.
+#[derive(PartialEq, Eq, Debug, Clone)]
+pub struct TlsPolicy {
+    pub min_version: TlsVersion,
+    /// `None`: the newest version OpenSSL supports.
+    pub max_version: Option<TlsVersion>,
+    /// OpenSSL cipher string for TLS 1.2.
+    pub ciphers: Option<String>,
+    /// TLS 1.3 cipher suites, colon-separated.
+    pub ciphersuites: Option<String>,
+    /// Key exchange groups (curves) in preference order, colon-separated.
+    pub groups: Option<String>,
+}
+
+impl Default for TlsPolicy {
+    fn default() -> Self {
+        TlsPolicy {
+            min_version: TlsVersion::Tls12,
+            max_version: None,
+            ciphers: None,
+            ciphersuites: None,
+            groups: None,
+        }
+    }
+}
+
+impl TlsPolicy {
+    /// Policy from the `tls_*` settings of `general`.
+    pub fn from_general(general: &super::General) -> Result<Self, Error> {
+        let min_version = match &general.tls_min_version {
+            Some(v) => v.parse::<TlsVersion>()?,
+            None => TlsVersion::Tls12,
+        };
+        let max_version = general
+            .tls_max_version
+            .as_deref()
+            .map(str::parse::<TlsVersion>)
+            .transpose()?;
+        if max_version.is_some_and(|max| max < min_version) {
+            return Err(Error::BadConfig(format!(
+                "tls_max_version {} is older than tls_min_version {min_version}",
+                max_version.unwrap()
+            )));
+        }
+        let non_empty = |name: &str, value: &Option<String>| match value {
+            Some(v) if v.trim().is_empty() => {
+                Err(Error::BadConfig(format!("{name} must not be empty")))
+            }
+            _ => Ok(value.clone()),
+        };
+        Ok(TlsPolicy {
+            min_version,
+            max_version,
+            ciphers: non_empty("tls_ciphers", &general.tls_ciphers)?,
+            ciphersuites: non_empty("tls_ciphersuites", &general.tls_ciphersuites)?,
+            groups: non_empty("tls_groups", &general.tls_groups)?,
+        })
+    }
+}
+
 /// Convert TLSMode to native_tls TlsClientCertificateVerification
 #[allow(dead_code)]
 fn tls_mode_to_verification(mode: &str) -> Result<TlsClientCertificateVerification, Error> {
@@ -213,6 +354,8 @@ fn load_certificates(path: &Path) -> Result<Vec<Certificate>, Error> {
 pub struct ServerTlsConfig {
     pub mode: ServerTlsMode,
     pub connector: Option<tokio_native_tls::TlsConnector>,
+    /// Start TLS without SSLRequest (`server_tls_negotiation = direct`).
+    pub direct: bool,
     /// SHA-256 hash of certificate file contents (ca + client cert + client key).
     /// Used to detect cert changes on SIGHUP reload without comparing opaque
     /// TlsConnector objects.
@@ -220,11 +363,11 @@ pub struct ServerTlsConfig {
 }
 
 /// Manual impl: `connector` is opaque (no PartialEq), so equality is
-/// determined by `mode` + `cert_hash`. Update this if new config fields
-/// are added to `ServerTlsConfig`.
+/// determined by `mode` + `direct` + `cert_hash`. Update this if new config
+/// fields are added to `ServerTlsConfig`.
 impl PartialEq for ServerTlsConfig {
     fn eq(&self, other: &Self) -> bool {
-        self.mode == other.mode && self.cert_hash == other.cert_hash
+        self.mode == other.mode && self.direct == other.direct && self.cert_hash == other.cert_hash
     }
 }
 
@@ -233,14 +376,25 @@ impl Eq for ServerTlsConfig {}
 impl ServerTlsConfig {
     pub fn new(
         mode: ServerTlsMode,
+        negotiation: ServerTlsNegotiation,
         ca_cert: Option<&Path>,
         client_cert: Option<&Path>,
         client_key: Option<&Path>,
     ) -> Result<Self, Error> {
+        let direct = negotiation == ServerTlsNegotiation::Direct;
+        // Direct TLS can't fall back to plain text, as in libpq.
+        if direct && !mode.requires_tls() {
+            return Err(Error::BadConfig(format!(
+                "server_tls_negotiation 'direct' requires server_tls_mode require, \
+                 verify-ca or verify-full, got '{mode}'"
+            )));
+        }
+
         if mode == ServerTlsMode::Disable {
             return Ok(ServerTlsConfig {
                 mode,
                 connector: None,
+                direct,
                 cert_hash: None,
             });
         }
@@ -291,6 +445,10 @@ impl ServerTlsConfig {
             builder.identity(identity);
         }
 
+        if direct {
+            builder.request_alpns(&[POSTGRESQL_ALPN]);
+        }
+
         let connector = builder
             .build()
             .map(tokio_native_tls::TlsConnector::from)
@@ -321,6 +479,7 @@ impl ServerTlsConfig {
         Ok(ServerTlsConfig {
             mode,
             connector: Some(connector),
+            direct,
             cert_hash,
         })
     }
@@ -333,6 +492,7 @@ pub fn build_acceptor(
     key: &Path,
     ca_path: Option<impl AsRef<Path>>,
     mode: Option<String>,
+    policy: &TlsPolicy,
 ) -> Result<tokio_native_tls::TlsAcceptor, Error> {
     // Load identity from certificate and key
     let identity = load_identity(cert, key).map_err(|err| {
@@ -358,8 +518,17 @@ pub fn build_acceptor(
     let mut builder = native_tls::TlsAcceptor::builder(identity);
 
     // Set protocol versions
-    builder.min_protocol_version(Some(Protocol::Tlsv12)); // Upgraded from Tlsv10 for better security
-    builder.max_protocol_version(None);
+    builder.min_protocol_version(Some(policy.min_version.protocol()));
+    builder.max_protocol_version(policy.max_version.map(TlsVersion::protocol));
+
+    #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
+    builder
+        .cipher_list(policy.ciphers.clone())
+        .ciphersuites(policy.ciphersuites.clone())
+        .groups_list(policy.groups.clone())
+        // Direct TLS clients must offer "postgresql"; clients that send
+        // SSLRequest first may offer it too (libpq 17+ does).
+        .alpn_protocols(&[POSTGRESQL_ALPN]);
 
     // Configure client certificate verification
     #[cfg(not(any(target_os = "macos", target_os = "windows", target_os = "ios")))]
@@ -480,28 +649,85 @@ mod tests {
 
     #[test]
     fn test_server_tls_config_disable() {
-        let config = ServerTlsConfig::new(ServerTlsMode::Disable, None, None, None).unwrap();
+        let config = ServerTlsConfig::new(
+            ServerTlsMode::Disable,
+            ServerTlsNegotiation::Postgres,
+            None,
+            None,
+            None,
+        )
+        .unwrap();
         assert_eq!(config.mode, ServerTlsMode::Disable);
         assert!(config.connector.is_none());
     }
 
     #[test]
     fn test_server_tls_config_prefer_no_certs() {
-        let config = ServerTlsConfig::new(ServerTlsMode::Prefer, None, None, None).unwrap();
+        let config = ServerTlsConfig::new(
+            ServerTlsMode::Prefer,
+            ServerTlsNegotiation::Postgres,
+            None,
+            None,
+            None,
+        )
+        .unwrap();
         assert_eq!(config.mode, ServerTlsMode::Prefer);
         assert!(config.connector.is_some());
     }
 
     #[test]
     fn test_server_tls_config_require_no_certs() {
-        let config = ServerTlsConfig::new(ServerTlsMode::Require, None, None, None).unwrap();
+        let config = ServerTlsConfig::new(
+            ServerTlsMode::Require,
+            ServerTlsNegotiation::Postgres,
+            None,
+            None,
+            None,
+        )
+        .unwrap();
         assert_eq!(config.mode, ServerTlsMode::Require);
         assert!(config.connector.is_some());
     }
 
+    #[test]
+    fn test_server_tls_config_direct() {
+        let config = ServerTlsConfig::new(
+            ServerTlsMode::Require,
+            ServerTlsNegotiation::Direct,
+            None,
+            None,
+            None,
+        )
+        .unwrap();
+        assert!(config.direct);
+        assert!(config.connector.is_some());
+
+        // No plain-text fallback with direct TLS.
+        for mode in [ServerTlsMode::Allow, ServerTlsMode::Prefer] {
+            let err = ServerTlsConfig::new(mode, ServerTlsNegotiation::Direct, None, None, None)
+                .unwrap_err();
+            assert!(
+                err.to_string().contains("server_tls_negotiation"),
+                "unexpected error: {err}"
+            );
+        }
+        assert_eq!(
+            "Direct".parse::<ServerTlsNegotiation>().unwrap(),
+            ServerTlsNegotiation::Direct
+        );
+        assert!("sslrequest".parse::<ServerTlsNegotiation>().is_err());
+    }
+
     #[test]
     fn test_server_tls_config_verify_ca_without_ca_cert_is_error() {
-        let err = ServerTlsConfig::new(ServerTlsMode::VerifyCa, None, None, None).unwrap_err();
+        let err = ServerTlsConfig::new(
+            ServerTlsMode::VerifyCa,
+            ServerTlsNegotiation::Postgres,
+            None,
+            None,
+            None,
+        )
+        .unwrap_err();
         assert!(
             err.to_string().contains("server_tls_ca_cert"),
             "unexpected error: {err}"
@@ -510,7 +736,14 @@ mod tests {
 
     #[test]
     fn test_server_tls_config_verify_full_without_ca_cert_is_error() {
-        let err = ServerTlsConfig::new(ServerTlsMode::VerifyFull, None, None, None).unwrap_err();
+        let err = ServerTlsConfig::new(
+            ServerTlsMode::VerifyFull,
+            ServerTlsNegotiation::Postgres,
+            None,
+            None,
+            None,
+        )
+        .unwrap_err();
         assert!(
             err.to_string().contains("server_tls_ca_cert"),
             "unexpected error: {err}"
@@ -523,8 +756,14 @@ mod tests {
         if !ca_path.exists() {
             return; // skip if test certs not available
         }
-        let config =
-            ServerTlsConfig::new(ServerTlsMode::VerifyCa, Some(&ca_path), None, None).unwrap();
+        let config = ServerTlsConfig::new(
+            ServerTlsMode::VerifyCa,
+            ServerTlsNegotiation::Postgres,
+            Some(&ca_path),
+            None,
+            None,
+        )
+        .unwrap();
         assert_eq!(config.mode, ServerTlsMode::VerifyCa);
         assert!(config.connector.is_some());
     }
@@ -585,6 +824,7 @@ mod tests {
                 &key_path,
                 Some(&ca_path),
                 Some("require".to_string()),
+                &TlsPolicy::default(),
             );
             assert!(
                 result.is_ok(),
@@ -598,6 +838,7 @@ mod tests {
                 &key_path,
                 None::<&Path>,
                 Some("require".to_string()),
+                &TlsPolicy::default(),
             );
             assert!(
                 result.is_ok(),
@@ -606,12 +847,39 @@ mod tests {
             );
 
             // Test without mode
-            let result = build_acceptor(&cert_path, &key_path, Some(&ca_path), None);
+            let result = build_acceptor(
+                &cert_path,
+                &key_path,
+                Some(&ca_path),
+                None,
+                &TlsPolicy::default(),
+            );
             assert!(
                 result.is_ok(),
                 "Failed to build acceptor without mode: {:?}",
                 result.err()
             );
+
+            // TLS 1.3 only with restricted suites and groups
+            let policy = TlsPolicy {
+                min_version: TlsVersion::Tls13,
+                max_version: Some(TlsVersion::Tls13),
+                ciphers: None,
+                ciphersuites: Some("TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256".into()),
+                groups: Some("X25519:P-256".into()),
+            };
+            let result = build_acceptor(&cert_path, &key_path, None::<&Path>, None, &policy);
+            assert!(
+                result.is_ok(),
+                "Failed to build TLS 1.3 acceptor: {:?}",
+                result.err()
+            );
+
+            let policy = TlsPolicy {
+                ciphers: Some("NO-SUCH-CIPHER".into()),
+                ..TlsPolicy::default()
+            };
+            assert!(build_acceptor(&cert_path, &key_path, None::<&Path>, None, &policy).is_err());
         }
     }
 }
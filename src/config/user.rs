@@ -3,23 +3,42 @@
 use serde_derive::{Deserialize, Serialize};
 
 use crate::auth::jwt::load_jwt_pub_key;
+use crate::auth::scram::parse_server_secret;
 use crate::errors::Error;
-use crate::messages::JWT_PUB_KEY_PASSWORD_PREFIX;
+use crate::messages::{
+    JWT_PUB_KEY_PASSWORD_PREFIX, MD5_PASSWORD_PREFIX, SCRAM_PASSTHROUGH_PASSWORD, SCRAM_SHA_256,
+};
 
-use super::PoolMode;
+use super::{Duration, PoolMode};
+
+/// Username of the pool entry that stands for every user not listed.
+pub const WILDCARD_USER: &str = "*";
 
 /// PostgreSQL user.
 #[derive(Clone, PartialEq, Hash, Eq, Serialize, Deserialize, Debug)]
 pub struct User {
     pub username: String,
     pub password: String,
+    // Second secret accepted while rotating `password`. Same kind as
+    // `password`; SCRAM verifiers must share its salt and iterations.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub next_password: Option<String>,
     pub pool_size: u32,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub min_pool_size: Option<u32>,
+    // Upper bound for adaptive pool sizing: when set above pool_size,
+    // the pool grows toward it while clients wait longer than
+    // general.adaptive_pool_wait_target and shrinks back when idle.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_pool_size: Option<u32>,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub pool_mode: Option<PoolMode>,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_lifetime: Option<u64>,
+    // Queue priority at the pool coordinator (max_db_connections).
+    // Higher values get a freed connection slot first.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub priority: Option<u8>,
     // Override backend credentials. When omitted, passthrough auth is used:
     // pg_doorman reuses the client's MD5 hash or SCRAM ClientKey to authenticate.
     // Only needed when the backend PostgreSQL user differs from the pool username.
@@ -27,9 +46,24 @@ pub struct User {
     pub server_username: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub server_password: Option<String>,
+    // Vault path (`<mount>/creds/<role>` or `<mount>/static-creds/<role>`)
+    // the backend username and password are read from instead.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub server_vault_path: Option<String>,
+    // Log in to RDS/Aurora with an IAM auth token signed for
+    // server_username (or username) instead of a password.
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub server_rds_iam: bool,
     // Pam auth
     #[serde(skip_serializing_if = "Option::is_none")]
     pub auth_pam_service: Option<String>,
+    // Refuse statements that write, checked by pg_doorman before they
+    // reach the server.
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub read_only: bool,
+    // Overrides the pool's max_query_time for this user; 0 turns it off.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_query_time: Option<Duration>,
 }
 
 impl Default for User {
@@ -37,18 +71,93 @@ impl Default for User {
         User {
             username: String::from("postgres"),
             password: String::from(""),
+            next_password: None,
             pool_size: 40,
             min_pool_size: None,
+            max_pool_size: None,
             pool_mode: None,
             server_lifetime: None,
+            priority: None,
             server_username: None,
             server_password: None,
+            server_vault_path: None,
+            server_rds_iam: false,
             auth_pam_service: None,
+            read_only: false,
+            max_query_time: None,
         }
     }
 }
 
 impl User {
+    /// Startup parameters the user's backend sessions get on top of the
+    /// pool's. A `read_only` user's sessions start read-only, so
+    /// PostgreSQL refuses the writes pg_doorman's check lets through.
+    pub fn server_startup_parameters(&self) -> std::collections::BTreeMap<String, String> {
+        let mut parameters = std::collections::BTreeMap::new();
+        if self.read_only {
+            parameters.insert(
+                "default_transaction_read_only".to_string(),
+                "on".to_string(),
+            );
+        }
+        parameters
+    }
+
+    /// The `"*"` user logs in to PostgreSQL as the client, so backend
+    /// identities and username-salted MD5 hashes don't apply to it.
+    fn validate_wildcard(&self) -> Result<(), Error> {
+        let unsupported = if self.server_username.is_some() {
+            Some("server_username (the backend user is the client's)")
+        } else if self.server_vault_path.is_some() {
+            Some("server_vault_path")
+        } else if self.server_rds_iam {
+            Some("server_rds_iam")
+        } else if self.password.starts_with(MD5_PASSWORD_PREFIX) {
+            Some("an MD5 password (MD5 hashes are salted with the username)")
+        } else {
+            None
+        };
+        match unsupported {
+            Some(what) => Err(Error::BadConfig(format!(
+                "user \"{WILDCARD_USER}\" can't use {what}"
+            ))),
+            None => Ok(()),
+        }
+    }
+
+    /// A scram-passthrough user logs in to PostgreSQL as itself, on backend
+    /// connections its clients authenticated, so it has no credentials of
+    /// its own and no connections before a client logs in.
+    fn validate_scram_passthrough(&self) -> Result<(), Error> {
+        let unsupported = if self
+            .server_username
+            .as_ref()
+            .is_some_and(|server_username| *server_username != self.username)
+        {
+            Some("server_username")
+        } else if self.server_password.is_some() {
+            Some("server_password")
+        } else if self.server_vault_path.is_some() {
+            Some("server_vault_path")
+        } else if self.server_rds_iam {
+            Some("server_rds_iam")
+        } else if self.auth_pam_service.is_some() {
+            Some("auth_pam_service")
+        } else if self.min_pool_size.is_some_and(|size| size > 0) {
+            Some("min_pool_size (connections are opened by client logins)")
+        } else {
+            None
+        };
+        match unsupported {
+            Some(what) => Err(Error::BadConfig(format!(
+                "user {}: password \"{SCRAM_PASSTHROUGH_PASSWORD}\" can't be combined with {what}",
+                self.username
+            ))),
+            None => Ok(()),
+        }
+    }
+
     pub async fn validate(&self) -> Result<(), Error> {
         if self.password.starts_with(JWT_PUB_KEY_PASSWORD_PREFIX) {
             let jwt_pub_key_file = self
@@ -58,11 +167,45 @@ impl User {
                 .to_string();
             load_jwt_pub_key(jwt_pub_key_file).await?;
         }
-        if self.server_password.is_some() && self.server_username.is_none() {
+        if let Some(next_password) = &self.next_password {
+            validate_next_password(&self.password, next_password)?;
+        }
+        if self.username == WILDCARD_USER {
+            self.validate_wildcard()?;
+        } else if self.server_password.is_some() && self.server_username.is_none() {
             return Err(Error::BadConfig(
                 "server_password requires server_username to be set".to_string(),
             ));
         }
+        if let Some(path) = &self.server_vault_path {
+            if self.server_username.is_some() || self.server_password.is_some() {
+                return Err(Error::BadConfig(format!(
+                    "user {}: server_vault_path can't be combined with server_username or server_password",
+                    self.username
+                )));
+            }
+            if self.server_rds_iam {
+                return Err(Error::BadConfig(format!(
+                    "user {}: server_vault_path can't be combined with server_rds_iam",
+                    self.username
+                )));
+            }
+            if path.is_empty() || path.starts_with('/') || path.starts_with("v1/") {
+                return Err(Error::BadConfig(format!(
+                    "user {}: server_vault_path must be relative to /v1/, e.g. \"database/creds/{}\"",
+                    self.username, self.username
+                )));
+            }
+        }
+        if self.server_rds_iam && self.server_password.is_some() {
+            return Err(Error::BadConfig(format!(
+                "user {}: server_rds_iam logs in with IAM tokens, remove server_password",
+                self.username
+            )));
+        }
+        if self.password == SCRAM_PASSTHROUGH_PASSWORD {
+            self.validate_scram_passthrough()?;
+        }
         if let Some(min_pool_size) = self.min_pool_size {
             if min_pool_size > self.pool_size {
                 return Err(Error::BadConfig(format!(
@@ -71,7 +214,42 @@ impl User {
                 )));
             }
         };
+        if let Some(max_pool_size) = self.max_pool_size {
+            if max_pool_size < self.pool_size {
+                return Err(Error::BadConfig(format!(
+                    "max_pool_size of {} cannot be smaller than pool_size of {}",
+                    max_pool_size, self.pool_size
+                )));
+            }
+        }
 
         Ok(())
     }
 }
+
+/// `next_password` must be usable in the same exchange as `password`: md5
+/// next to md5, or a SCRAM verifier with the same salt and iteration count,
+/// because the salt is sent to the client before it proves either one.
+fn validate_next_password(password: &str, next_password: &str) -> Result<(), Error> {
+    if password.starts_with(MD5_PASSWORD_PREFIX) && next_password.starts_with(MD5_PASSWORD_PREFIX) {
+        return Ok(());
+    }
+    if password.starts_with(SCRAM_SHA_256) && next_password.starts_with(SCRAM_SHA_256) {
+        let current = parse_server_secret(password)
+            .map_err(|err| Error::BadConfig(format!("password: {err}")))?;
+        let next = parse_server_secret(next_password)
+            .map_err(|err| Error::BadConfig(format!("next_password: {err}")))?;
+        if current.salt_base64 != next.salt_base64 || current.iteration != next.iteration {
+            return Err(Error::BadConfig(
+                "next_password must use the same salt and iterations as password; \
+                 generate it with `pg_doorman gen-password --salt-from '<password>'`"
+                    .to_string(),
+            ));
+        }
+        return Ok(());
+    }
+    Err(Error::BadConfig(
+        "next_password must be the same kind as password: both md5 hashes or both SCRAM-SHA-256 verifiers"
+            .to_string(),
+    ))
+}
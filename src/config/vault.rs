@@ -0,0 +1,79 @@
+//! HashiCorp Vault settings for backend credentials (`users[].server_vault_path`).
+
+use serde_derive::{Deserialize, Serialize};
+
+use crate::errors::Error;
+
+use super::Duration;
+
+#[derive(Clone, PartialEq, Serialize, Deserialize, Debug)]
+pub struct Vault {
+    /// Vault address, e.g. `https://vault.example.com:8200`.
+    #[serde(default)]
+    pub addr: String,
+
+    /// File holding the Vault token. Re-read before every request, so a
+    /// token renewed on disk by Vault Agent is picked up without a reload.
+    /// When unset, the `VAULT_TOKEN` environment variable is used.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub token_file: Option<String>,
+
+    /// PEM bundle used to verify the Vault server certificate in addition
+    /// to the system roots.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub ca_file: Option<String>,
+
+    /// Timeout for a single Vault HTTP request.
+    #[serde(default = "Vault::default_request_timeout")]
+    pub request_timeout: Duration,
+}
+
+impl Vault {
+    pub fn default_request_timeout() -> Duration {
+        Duration::from_secs(5)
+    }
+
+    pub fn empty() -> Self {
+        Vault {
+            addr: String::new(),
+            token_file: None,
+            ca_file: None,
+            request_timeout: Self::default_request_timeout(),
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.addr.is_empty()
+    }
+
+    pub fn validate(&self) -> Result<(), Error> {
+        if self.is_empty() {
+            return Ok(());
+        }
+        if !self.addr.starts_with("http://") && !self.addr.starts_with("https://") {
+            return Err(Error::BadConfig(format!(
+                "vault.addr: expected an http:// or https:// url, got {:?}",
+                self.addr
+            )));
+        }
+        if self.request_timeout.as_millis() == 0 {
+            return Err(Error::BadConfig(
+                "vault.request_timeout must be greater than 0".into(),
+            ));
+        }
+        if let Some(ca_file) = &self.ca_file {
+            let pem = std::fs::read(ca_file).map_err(|err| {
+                Error::BadConfig(format!("vault.ca_file: can't read {ca_file}: {err}"))
+            })?;
+            reqwest::Certificate::from_pem_bundle(&pem).map_err(|err| {
+                Error::BadConfig(format!("vault.ca_file: invalid PEM in {ca_file}: {err}"))
+            })?;
+        }
+        if self.token_file.is_none() && std::env::var_os("VAULT_TOKEN").is_none() {
+            return Err(Error::BadConfig(
+                "vault: set vault.token_file or the VAULT_TOKEN environment variable".into(),
+            ));
+        }
+        Ok(())
+    }
+}
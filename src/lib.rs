@@ -1,6 +1,8 @@
+pub mod acme;
 pub mod admin;
 pub mod app;
 pub mod auth;
+pub mod aws;
 pub mod client;
 pub mod config;
 pub mod daemon;
@@ -17,5 +19,6 @@ pub mod server;
 pub mod stats;
 pub mod transport;
 pub mod utils;
+pub mod vault;
 pub mod web;
 pub use config::tls;
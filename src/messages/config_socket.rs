@@ -37,22 +37,92 @@ pub fn configure_tcp_socket_for_cancel(stream: &TcpStream) {
     }
 }
 
-/// Configure TCP socket parameters.
+/// Keepalive probes and TCP_USER_TIMEOUT of one side of the pooler, in
+/// seconds.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+struct KeepaliveSettings {
+    idle: u64,
+    interval: u64,
+    count: u32,
+    user_timeout: u64,
+}
+
+impl KeepaliveSettings {
+    /// Client and web sockets: the `tcp_keepalives_*` / `tcp_user_timeout` values.
+    fn client(conf: &Config) -> KeepaliveSettings {
+        KeepaliveSettings {
+            idle: conf.general.tcp_keepalives_idle,
+            interval: conf.general.tcp_keepalives_interval,
+            count: conf.general.tcp_keepalives_count,
+            user_timeout: conf.general.tcp_user_timeout,
+        }
+    }
+
+    /// Backend sockets: `server_tcp_*` where set, client values otherwise.
+    fn server(conf: &Config) -> KeepaliveSettings {
+        let client = KeepaliveSettings::client(conf);
+        KeepaliveSettings {
+            idle: conf
+                .general
+                .server_tcp_keepalives_idle
+                .unwrap_or(client.idle),
+            interval: conf
+                .general
+                .server_tcp_keepalives_interval
+                .unwrap_or(client.interval),
+            count: conf
+                .general
+                .server_tcp_keepalives_count
+                .unwrap_or(client.count),
+            user_timeout: conf
+                .general
+                .server_tcp_user_timeout
+                .unwrap_or(client.user_timeout),
+        }
+    }
+}
+
+/// Configure accepted client TCP socket parameters.
 pub fn configure_tcp_socket(stream: &TcpStream) {
-    let sock_ref = SockRef::from(stream);
     let conf = get_config();
+    configure_pooler_tcp_socket(
+        stream,
+        &conf,
+        KeepaliveSettings::client(&conf),
+        "TCP socket",
+    );
+}
+
+/// Configure backend TCP socket parameters.
+pub fn configure_server_tcp_socket(stream: &TcpStream) {
+    let conf = get_config();
+    configure_pooler_tcp_socket(
+        stream,
+        &conf,
+        KeepaliveSettings::server(&conf),
+        "backend TCP socket",
+    );
+}
+
+fn configure_pooler_tcp_socket(
+    stream: &TcpStream,
+    conf: &Config,
+    keepalive: KeepaliveSettings,
+    label: &str,
+) {
+    let sock_ref = SockRef::from(stream);
 
     match sock_ref.set_linger(Some(Duration::from_secs(conf.general.tcp_so_linger))) {
         Ok(_) => {}
-        Err(err) => error!("failed to set SO_LINGER on TCP socket: {err}"),
+        Err(err) => error!("failed to set SO_LINGER on {label}: {err}"),
     }
 
     match sock_ref.set_tcp_nodelay(conf.general.tcp_no_delay) {
         Ok(_) => {}
-        Err(err) => error!("failed to set TCP_NODELAY on TCP socket: {err}"),
+        Err(err) => error!("failed to set TCP_NODELAY on {label}: {err}"),
     }
 
-    configure_tcp_socket_without_linger(&sock_ref, &conf, "TCP socket");
+    configure_tcp_socket_without_linger(&sock_ref, conf, keepalive, label);
 }
 
 /// Configure accepted web TCP socket parameters.
@@ -68,10 +138,20 @@ pub fn configure_web_tcp_socket(stream: &TcpStream) {
         Err(err) => error!("failed to set TCP_NODELAY on web TCP socket: {err}"),
     }
 
-    configure_tcp_socket_without_linger(&sock_ref, &conf, "web TCP socket");
+    configure_tcp_socket_without_linger(
+        &sock_ref,
+        &conf,
+        KeepaliveSettings::client(&conf),
+        "web TCP socket",
+    );
 }
 
-fn configure_tcp_socket_without_linger(sock_ref: &SockRef<'_>, conf: &Config, label: &str) {
+fn configure_tcp_socket_without_linger(
+    sock_ref: &SockRef<'_>,
+    conf: &Config,
+    keepalive: KeepaliveSettings,
+    label: &str,
+) {
     // Opt-in SO_RCVBUF/SO_SNDBUF. A non-zero value disables Linux TCP
     // autotuning for this socket and sets fixed send/receive buffer
     // limits. Linux doubles the requested values internally and may
@@ -116,9 +196,9 @@ fn configure_tcp_socket_without_linger(sock_ref: &SockRef<'_>, conf: &Config, la
         Ok(_) => {
             match sock_ref.set_tcp_keepalive(
                 &TcpKeepalive::new()
-                    .with_interval(Duration::from_secs(conf.general.tcp_keepalives_interval))
-                    .with_retries(conf.general.tcp_keepalives_count)
-                    .with_time(Duration::from_secs(conf.general.tcp_keepalives_idle)),
+                    .with_interval(Duration::from_secs(keepalive.interval))
+                    .with_retries(keepalive.count)
+                    .with_time(Duration::from_secs(keepalive.idle)),
             ) {
                 Ok(_) => (),
                 Err(err) => error!("failed to set TCP keepalive parameters on {label}: {err}"),
@@ -129,12 +209,36 @@ fn configure_tcp_socket_without_linger(sock_ref: &SockRef<'_>, conf: &Config, la
 
     // TCP_USER_TIMEOUT is only supported on Linux
     #[cfg(target_os = "linux")]
-    if conf.general.tcp_user_timeout > 0 {
-        match sock_ref
-            .set_tcp_user_timeout(Some(Duration::from_secs(conf.general.tcp_user_timeout)))
-        {
+    if keepalive.user_timeout > 0 {
+        match sock_ref.set_tcp_user_timeout(Some(Duration::from_secs(keepalive.user_timeout))) {
             Ok(_) => (),
             Err(err) => error!("failed to set TCP_USER_TIMEOUT on {label}: {err}"),
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn server_keepalive_falls_back_to_client_values() {
+        let mut conf = Config::default();
+        assert_eq!(
+            KeepaliveSettings::server(&conf),
+            KeepaliveSettings::client(&conf)
+        );
+
+        conf.general.server_tcp_keepalives_idle = Some(30);
+        conf.general.server_tcp_user_timeout = Some(0);
+        let server = KeepaliveSettings::server(&conf);
+        assert_eq!(server.idle, 30);
+        assert_eq!(server.user_timeout, 0);
+        assert_eq!(server.interval, conf.general.tcp_keepalives_interval);
+        assert_eq!(server.count, conf.general.tcp_keepalives_count);
+        assert_eq!(
+            KeepaliveSettings::client(&conf).idle,
+            conf.general.tcp_keepalives_idle
+        );
+    }
+}
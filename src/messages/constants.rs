@@ -9,6 +9,8 @@ pub const SCRAM_SHA_256: &str = "SCRAM-SHA-256";
 pub const MD5_PASSWORD_PREFIX: &str = "md5";
 pub const JWT_PUB_KEY_PASSWORD_PREFIX: &str = "jwt-pkey-fpath:";
 pub const JWT_PRIV_KEY_PASSWORD_PREFIX: &str = "jwt-priv-key-fpath:";
+// User password that relays the client's SCRAM exchange to the server.
+pub const SCRAM_PASSTHROUGH_PASSWORD: &str = "scram-passthrough";
 pub const NONCE_LENGTH: usize = 24;
 
 pub const TALOS_USERNAME: &str = "talos";
@@ -24,6 +26,16 @@ pub const AUTHENTICATION_CLEAR_PASSWORD: i32 = 3;
 // Used in the StartupMessage to indicate regular handshake.
 pub const PROTOCOL_VERSION_NUMBER: i32 = 196608;
 
+// Protocol 3.2 (PostgreSQL 18): BackendKeyData carries a variable-length
+// secret key.
+pub const PROTOCOL_VERSION_3_2: i32 = 196610;
+
+// Newest minor version of protocol 3 pg_doorman speaks.
+pub const PROTOCOL_LATEST_MINOR: i32 = 2;
+
+// Longest cancel secret key a server may send (protocol 3.2).
+pub const MAX_CANCEL_KEY_LENGTH: usize = 256;
+
 // SSLRequest: used to indicate we want an SSL connection.
 pub const SSL_REQUEST_CODE: i32 = 80877103;
 
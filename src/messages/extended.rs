@@ -225,6 +225,11 @@ impl Parse {
         &self.query
     }
 
+    /// The query text as a shared handle, without copying it.
+    pub fn shared_query(&self) -> Arc<str> {
+        self.query.clone()
+    }
+
     pub fn param_types(&self) -> &[i32] {
         &self.param_types
     }
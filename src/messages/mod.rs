@@ -13,7 +13,10 @@ pub mod protocol;
 pub mod socket;
 pub mod types;
 
-pub use config_socket::{configure_tcp_socket, configure_unix_socket, configure_web_tcp_socket};
+pub use config_socket::{
+    configure_server_tcp_socket, configure_tcp_socket, configure_unix_socket,
+    configure_web_tcp_socket,
+};
 pub use error::PgErrorMsg;
 pub use extended::{close_complete, Bind, Close, Describe, ExtendedProtocolData, Parse};
 pub use protocol::{
@@ -22,15 +25,16 @@ pub use protocol::{
     has_error_response, insert_close_complete_after_last_close_complete,
     insert_close_complete_before_ready_for_query, insert_parse_complete_before_bind_complete,
     insert_parse_complete_before_parameter_description, md5_challenge, md5_hash_password,
-    md5_hash_second_pass, md5_password, md5_password_with_hash, notify, parse_complete,
-    parse_params, parse_startup, plain_password_challenge, read_password, ready_for_query,
-    scram_server_response, scram_start_challenge, server_parameter_message, simple_query,
-    ssl_request, startup, sync, wrong_password,
+    md5_hash_second_pass, md5_password, md5_password_with_hash, negotiate_protocol_version_message,
+    notice_message, notify, parse_complete, parse_params, parse_startup, plain_password_challenge,
+    read_password, ready_for_query, scram_server_response, scram_start_challenge,
+    server_parameter_message, simple_query, ssl_request, startup, statement_error_message, sync,
+    wrong_password,
 };
 pub use socket::{
     proxy_copy_data, proxy_copy_data_with_timeout, read_message, read_message_body_reuse,
     read_message_data, read_message_header, read_message_reuse, write_all, write_all_flush,
-    write_all_half,
+    write_all_flush_progress, write_all_half,
 };
 pub use types::{vec_to_string, BytesMutReader, DataType};
 
@@ -101,6 +101,10 @@ where
     }
 }
 
+/// Longest password message accepted from a client: PostgreSQL's
+/// `PG_MAX_AUTH_TOKEN_LENGTH` plus the length field.
+const MAX_PASSWORD_MESSAGE_LEN: i32 = 65535 + 4;
+
 /// Read password from client.
 pub async fn read_password<S>(stream: &mut S) -> Result<Vec<u8>, Error>
 where
@@ -116,11 +120,22 @@ where
         }
     }
 
+    if code[0] == b'X' {
+        // Terminate: the client gave up on authentication, e.g. psql
+        // with no password to offer. Not a protocol violation.
+        return Err(Error::ProtocolSyncError(
+            "Client sent Terminate instead of a password message".to_string(),
+        ));
+    }
     if code[0] != b'p' {
-        return Err(Error::ProtocolSyncError(format!(
-            "Protocol synchronization error: Expected password message (p), received '{}' instead",
-            code[0] as char
-        )));
+        return Err(Error::ClientProtocolViolation {
+            kind: "auth_desync",
+            detail: format!(
+                "expected password message (p), received '{}'",
+                code[0] as char
+            ),
+            head: code.to_vec(),
+        });
     }
 
     let mut len_buf = [0u8; 4];
@@ -134,6 +149,15 @@ where
     }
 
     let len = i32::from_be_bytes(len_buf);
+    if !(4..=MAX_PASSWORD_MESSAGE_LEN).contains(&len) {
+        let mut head = code.to_vec();
+        head.extend_from_slice(&len_buf);
+        return Err(Error::ClientProtocolViolation {
+            kind: "bad_length",
+            detail: format!("invalid password message length: {len}"),
+            head,
+        });
+    }
     let mut password = vec![0u8; (len - 4) as usize];
     match stream.read_exact(&mut password).await {
         Ok(_) => {}
@@ -166,6 +190,7 @@ pub fn simple_query(query: &str) -> BytesMut {
 /// overrides the default application name.
 pub async fn startup<S>(
     stream: &mut S,
+    protocol_version: i32,
     user: &str,
     database: &str,
     application_name: &str,
@@ -181,8 +206,7 @@ where
 
     // Length prefix (includes itself).
     startup.put_i32(total_size as i32);
-    // Protocol version 3.0.
-    startup.put_i32(196608);
+    startup.put_i32(protocol_version);
 
     // User.
     startup.put(&b"user\0"[..]);
@@ -288,10 +312,29 @@ pub fn parse_params(mut bytes: BytesMut) -> Result<HashMap<String, String>, Erro
     Ok(result)
 }
 
+/// NegotiateProtocolVersion: the newest protocol version we support for the
+/// major version the client asked for, and the protocol options we don't.
+pub fn negotiate_protocol_version_message(version: i32, unsupported: &[String]) -> BytesMut {
+    let len = 4 + 4 + 4 + unsupported.iter().map(|o| o.len() + 1).sum::<usize>();
+    let mut bytes = BytesMut::with_capacity(len + 1);
+    bytes.put_u8(b'v');
+    bytes.put_i32(len as i32);
+    bytes.put_i32(version);
+    bytes.put_i32(unsupported.len() as i32);
+    for option in unsupported {
+        bytes.put_slice(option.as_bytes());
+        bytes.put_u8(0);
+    }
+    bytes
+}
+
 /// Parse StartupMessage parameters.
 /// e.g. user, database, application_name, etc.
 pub fn parse_startup(bytes: BytesMut) -> Result<HashMap<String, String>, Error> {
-    let result = parse_params(bytes)?;
+    let mut result = parse_params(bytes)?;
+    // Protocol options were refused with NegotiateProtocolVersion; they are
+    // not run-time parameters.
+    result.retain(|name, _| !name.starts_with("_pq_."));
 
     // Minimum required parameters
     // I want to have the user at the very minimum, according to the protocol spec.
@@ -377,13 +420,23 @@ where
 }
 
 pub fn error_message(message: &str, code: &str) -> BytesMut {
+    error_message_with_severity(b"FATAL\0", message, code)
+}
+
+/// ErrorResponse with severity ERROR: only the statement failed and the
+/// session goes on, unlike the FATAL [`error_message`].
+pub fn statement_error_message(message: &str, code: &str) -> BytesMut {
+    error_message_with_severity(b"ERROR\0", message, code)
+}
+
+fn error_message_with_severity(severity: &[u8], message: &str, code: &str) -> BytesMut {
     let mut error = BytesMut::new();
     // Error level
     error.put_u8(b'S');
-    error.put_slice(&b"FATAL\0"[..]);
+    error.put_slice(severity);
     // Error level (non-translatable)
     error.put_u8(b'V');
-    error.put_slice(&b"FATAL\0"[..]);
+    error.put_slice(severity);
 
     // Error code: not sure how much this matters.
     error.put_u8(b'C');
@@ -405,6 +458,26 @@ pub fn error_message(message: &str, code: &str) -> BytesMut {
     res
 }
 
+/// NoticeResponse with severity NOTICE and `message` as its text.
+pub fn notice_message(message: &str) -> BytesMut {
+    let mut notice = BytesMut::new();
+    notice.put_u8(b'S');
+    notice.put_slice(&b"NOTICE\0"[..]);
+    notice.put_u8(b'V');
+    notice.put_slice(&b"NOTICE\0"[..]);
+    notice.put_u8(b'C');
+    notice.put_slice(&b"00000\0"[..]);
+    notice.put_u8(b'M');
+    notice.put_slice(format!("{message}\0").as_bytes());
+    notice.put_u8(0);
+
+    let mut res = BytesMut::with_capacity(notice.len() + 5);
+    res.put_u8(b'N');
+    res.put_i32(notice.len() as i32 + 4);
+    res.put(notice);
+    res
+}
+
 pub async fn error_response_terminal<S>(
     stream: &mut S,
     message: &str,
@@ -1000,6 +1073,7 @@ pub fn insert_close_complete_before_ready_for_query(mut buffer: BytesMut, count:
 #[cfg(test)]
 mod startup_tests {
     use super::*;
+    use crate::messages::constants::PROTOCOL_VERSION_NUMBER;
     use std::collections::BTreeMap;
 
     #[tokio::test]
@@ -1012,9 +1086,16 @@ mod startup_tests {
         );
         params.insert("work_mem".to_string(), "64MB".to_string());
 
-        startup(&mut buf, "alice", "appdb", "myapp", &params)
-            .await
-            .expect("startup");
+        startup(
+            &mut buf,
+            PROTOCOL_VERSION_NUMBER,
+            "alice",
+            "appdb",
+            "myapp",
+            &params,
+        )
+        .await
+        .expect("startup");
 
         // Skip the 4-byte length prefix and 4-byte protocol version.
         let body = &buf[8..];
@@ -1043,9 +1124,16 @@ mod startup_tests {
     #[tokio::test]
     async fn startup_with_empty_params_keeps_pre_feature_format() {
         let mut buf: Vec<u8> = Vec::new();
-        startup(&mut buf, "alice", "appdb", "myapp", &BTreeMap::new())
-            .await
-            .expect("startup");
+        startup(
+            &mut buf,
+            PROTOCOL_VERSION_NUMBER,
+            "alice",
+            "appdb",
+            "myapp",
+            &BTreeMap::new(),
+        )
+        .await
+        .expect("startup");
         let body = &buf[8..];
         let s = String::from_utf8_lossy(body);
         assert!(s.contains("user\0alice"));
@@ -1059,9 +1147,16 @@ mod startup_tests {
         let mut params = BTreeMap::new();
         params.insert("application_name".to_string(), "operator_app".to_string());
 
-        startup(&mut buf, "alice", "appdb", "ignored", &params)
-            .await
-            .expect("startup");
+        startup(
+            &mut buf,
+            PROTOCOL_VERSION_NUMBER,
+            "alice",
+            "appdb",
+            "ignored",
+            &params,
+        )
+        .await
+        .expect("startup");
 
         let body = &buf[8..];
         let s = String::from_utf8_lossy(body);
@@ -1079,7 +1174,7 @@ mod startup_tests {
         params.insert("k1".to_string(), "v1".to_string());
         params.insert("k2".to_string(), "v2".to_string());
 
-        startup(&mut buf, "u", "d", "a", &params)
+        startup(&mut buf, PROTOCOL_VERSION_NUMBER, "u", "d", "a", &params)
             .await
             .expect("startup");
 
@@ -1091,4 +1186,25 @@ mod startup_tests {
             buf.len()
         );
     }
+
+    #[test]
+    fn negotiate_protocol_version_lists_unsupported_options() {
+        let msg = negotiate_protocol_version_message(196610, &["_pq_.foo".to_string()]);
+        assert_eq!(msg[0], b'v');
+        assert_eq!(
+            i32::from_be_bytes(msg[1..5].try_into().unwrap()) as usize,
+            msg.len() - 1
+        );
+        assert_eq!(i32::from_be_bytes(msg[5..9].try_into().unwrap()), 196610);
+        assert_eq!(i32::from_be_bytes(msg[9..13].try_into().unwrap()), 1);
+        assert_eq!(&msg[13..], b"_pq_.foo\0");
+    }
+
+    #[test]
+    fn parse_startup_drops_protocol_options() {
+        let params =
+            parse_startup(BytesMut::from(&b"user\0alice\0_pq_.foo\0on\0\0"[..])).expect("startup");
+        assert_eq!(params.get("user").map(String::as_str), Some("alice"));
+        assert!(!params.contains_key("_pq_.foo"));
+    }
 }
@@ -1,7 +1,7 @@
 use std::sync::atomic::Ordering;
 
 use bytes::{BufMut, BytesMut};
-use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::io::{AsyncBufReadExt, AsyncReadExt, AsyncWriteExt};
 use tokio::time::timeout;
 
 use crate::errors::Error;
@@ -73,6 +73,43 @@ where
     }
 }
 
+/// Like [`write_all_flush`], but fails with [`Error::ClientWriteTimeout`]
+/// when the stream takes no bytes for `limit`. The timer restarts after
+/// every write that makes progress, so a slow reader that keeps reading is
+/// never cut off however large the buffer.
+pub async fn write_all_flush_progress<S>(
+    stream: &mut S,
+    mut buf: &[u8],
+    limit: std::time::Duration,
+) -> Result<(), Error>
+where
+    S: tokio::io::AsyncWrite + std::marker::Unpin,
+{
+    while !buf.is_empty() {
+        match timeout(limit, stream.write(buf)).await {
+            Ok(Ok(0)) => {
+                return Err(Error::SocketError(
+                    "Error writing to socket: connection closed".to_string(),
+                ));
+            }
+            Ok(Ok(written)) => buf = &buf[written..],
+            Ok(Err(err)) => {
+                return Err(Error::SocketError(format!(
+                    "Error writing to socket: {err:?}"
+                )));
+            }
+            Err(_) => return Err(Error::ClientWriteTimeout),
+        }
+    }
+    match timeout(limit, stream.flush()).await {
+        Ok(Ok(())) => Ok(()),
+        Ok(Err(err)) => Err(Error::SocketError(format!(
+            "Error flushing socket: {err:?}"
+        ))),
+        Err(_) => Err(Error::ClientWriteTimeout),
+    }
+}
+
 /// Read message header.
 pub async fn read_message_header<S>(stream: &mut S) -> Result<(u8, i32), Error>
 where
@@ -154,11 +191,17 @@ where
 /// allocation until exhausted. A buffer that grew past
 /// `REUSE_BUF_SHRINK_THRESHOLD` is dropped before the next read, so a single
 /// oversized message does not pin its allocation across the connection.
+///
+/// A length prefix above `max_message_size` fails with `MaxMessageSize`
+/// before anything is allocated, leaving the 5-byte header in `buf` for
+/// diagnostics; the body stays unread, so the caller must close the
+/// connection.
 #[inline]
 pub async fn read_message_reuse<S>(
     stream: &mut S,
     buf: &mut BytesMut,
     max_memory_usage: u64,
+    max_message_size: i32,
 ) -> Result<BytesMut, Error>
 where
     S: tokio::io::AsyncRead + std::marker::Unpin,
@@ -166,14 +209,20 @@ where
     let (code, len) = read_message_header(stream).await?;
 
     if len < 4 {
-        return Err(Error::ProtocolSyncError(format!(
-            "Message length is too small: {len}"
-        )));
+        let mut head = vec![code];
+        head.extend_from_slice(&len.to_be_bytes());
+        return Err(Error::ClientProtocolViolation {
+            kind: "bad_length",
+            detail: format!("message length is too small: {len}"),
+            head,
+        });
     }
-    if len > MAX_MESSAGE_SIZE {
-        return Err(Error::ProtocolSyncError(format!(
-            "Message length is too large: {len}"
-        )));
+    if len > max_message_size.min(MAX_MESSAGE_SIZE) {
+        shrink_reuse_buf(buf);
+        buf.clear();
+        buf.put_u8(code);
+        buf.put_i32(len);
+        return Err(Error::MaxMessageSize);
     }
 
     let prev = CURRENT_MEMORY.fetch_add(len as i64, Ordering::Relaxed);
@@ -252,7 +301,7 @@ pub async fn proxy_copy_data_with_timeout<R, W>(
     copied: &mut usize,
 ) -> Result<(), Error>
 where
-    R: tokio::io::AsyncRead + std::marker::Unpin,
+    R: tokio::io::AsyncBufRead + std::marker::Unpin,
     W: tokio::io::AsyncWrite + std::marker::Unpin,
 {
     match timeout(duration, proxy_copy_data(read, write, len, copied)).await {
@@ -264,6 +313,11 @@ where
 
 /// Copy data from one stream to another.
 ///
+/// Chunks are written straight out of the reader's own buffer
+/// (`fill_buf`/`consume`), so a multi-GB result costs one userspace copy
+/// per byte (socket into the read buffer) instead of two. Bytes past `len`
+/// stay in the reader for the next message.
+///
 /// The caller passes `copied` initialized to zero; the function bumps
 /// it as each chunk lands in the writer. On `Err` the value reflects
 /// what actually reached the wire before the failure, which the
@@ -276,33 +330,25 @@ pub async fn proxy_copy_data<R, W>(
     copied: &mut usize,
 ) -> Result<(), Error>
 where
-    R: tokio::io::AsyncRead + std::marker::Unpin,
+    R: tokio::io::AsyncBufRead + std::marker::Unpin,
     W: tokio::io::AsyncWrite + std::marker::Unpin,
 {
-    const MAX_BUFFER_CHUNK: usize = 4096; // гарантия того что вызовы read из
-                                          // буфферизированного stream 8kb будет быстрым.
     let mut bytes_remained = len;
-    let mut bytes_readed: usize;
-    let mut buffer_size: usize = MAX_BUFFER_CHUNK;
-    if buffer_size > len {
-        buffer_size = len
-    }
-    let mut buffer = [0; MAX_BUFFER_CHUNK];
-    loop {
-        // read.
-        match read.read(&mut buffer[..buffer_size]).await {
-            Ok(n) => bytes_readed = n,
+    while bytes_remained > 0 {
+        let chunk = match read.fill_buf().await {
+            Ok(chunk) => chunk,
             Err(err) => {
                 return Err(Error::SocketError(format!(
                     "Error reading from socket: {err:?}"
                 )))
             }
         };
-        if bytes_readed == 0 {
+        if chunk.is_empty() {
             return Err(Error::SocketError(
                 "Error reading from socket: connection closed".to_string(),
             ));
         }
+        let chunk = &chunk[..chunk.len().min(bytes_remained)];
 
         // Write in a partial-aware loop so `copied` reflects bytes
         // that actually reached the writer even when the underlying
@@ -310,8 +356,8 @@ where
         // that signal because it returns Err without saying how much
         // of the buffer it managed to push first.
         let mut written = 0usize;
-        while written < bytes_readed {
-            match write.write(&buffer[written..bytes_readed]).await {
+        while written < chunk.len() {
+            match write.write(&chunk[written..]).await {
                 Ok(0) => {
                     return Err(Error::SocketError(
                         "Error writing to socket: writer accepted no bytes".to_string(),
@@ -329,13 +375,8 @@ where
             }
         }
 
-        bytes_remained -= bytes_readed;
-        if bytes_remained == 0 {
-            break;
-        }
-        if bytes_remained < buffer_size {
-            buffer_size = bytes_remained;
-        }
+        read.consume(written);
+        bytes_remained -= written;
     }
     Ok(())
 }
@@ -358,6 +399,39 @@ mod tests {
         msg
     }
 
+    // =========================================================================
+    // write_all_flush_progress — no-progress timer
+    // =========================================================================
+
+    /// A reader that keeps taking bytes is never cut off, even when the
+    /// whole write takes several times the limit.
+    #[tokio::test]
+    async fn progress_write_survives_slow_reader() {
+        let (mut writer, mut reader) = tokio::io::duplex(8);
+        let drain = tokio::spawn(async move {
+            let mut chunk = [0u8; 8];
+            let mut total = 0;
+            while total < 64 {
+                tokio::time::sleep(std::time::Duration::from_millis(30)).await;
+                total += reader.read(&mut chunk).await.unwrap();
+            }
+        });
+        let limit = std::time::Duration::from_millis(100);
+        write_all_flush_progress(&mut writer, &[7u8; 64], limit)
+            .await
+            .unwrap();
+        drain.await.unwrap();
+    }
+
+    /// A reader that stops reading fails the write once the limit passes.
+    #[tokio::test]
+    async fn progress_write_times_out_stalled_reader() {
+        let (mut writer, _reader) = tokio::io::duplex(8);
+        let limit = std::time::Duration::from_millis(50);
+        let result = write_all_flush_progress(&mut writer, &[7u8; 64], limit).await;
+        assert!(matches!(result, Err(Error::ClientWriteTimeout)));
+    }
+
     // =========================================================================
     // read_message_reuse — wire protocol validation
     // =========================================================================
@@ -370,7 +444,7 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
 
@@ -388,7 +462,7 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
 
@@ -407,7 +481,7 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
 
@@ -425,9 +499,15 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX).await;
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE).await;
 
-        assert!(result.is_err());
+        match result {
+            Err(Error::ClientProtocolViolation { kind, head, .. }) => {
+                assert_eq!(kind, "bad_length");
+                assert_eq!(head, b"X\0\0\0\x03");
+            }
+            other => panic!("expected bad_length violation, got {other:?}"),
+        }
         // Note: CURRENT_MEMORY is a global shared by all tests — don't assert absolute value
     }
 
@@ -440,7 +520,7 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX).await;
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE).await;
 
         assert!(result.is_err());
         // Note: CURRENT_MEMORY is a global shared by all tests — don't assert absolute value
@@ -454,12 +534,37 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX).await;
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE).await;
 
-        assert!(result.is_err());
+        assert_eq!(result.unwrap_err(), Error::MaxMessageSize);
         // Note: CURRENT_MEMORY is a global shared by all tests — don't assert absolute value
     }
 
+    /// max_client_message_size below the built-in cap: a 2GB length prefix
+    /// and a message one byte over the limit are refused without allocating
+    /// the body; only the header is kept for the violation log.
+    #[tokio::test]
+    async fn reuse_len_exceeds_configured_limit() {
+        let mut data = vec![b'P'];
+        data.extend_from_slice(&i32::MAX.to_be_bytes());
+        let mut stream = Cursor::new(data);
+        let mut buf = BytesMut::new();
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, 1024).await;
+        assert_eq!(result.unwrap_err(), Error::MaxMessageSize);
+        assert_eq!(&buf[..], b"P\x7f\xff\xff\xff");
+        assert!(buf.capacity() < 1024);
+
+        let mut stream = Cursor::new(wire_msg(b'B', &[0u8; 1021]));
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, 1024).await;
+        assert_eq!(result.unwrap_err(), Error::MaxMessageSize);
+
+        let mut stream = Cursor::new(wire_msg(b'B', &[0u8; 1020]));
+        let msg = read_message_reuse(&mut stream, &mut buf, u64::MAX, 1024)
+            .await
+            .unwrap();
+        assert_eq!(msg.len(), 1025);
+    }
+
     // =========================================================================
     // read_message_reuse — memory pressure
     // =========================================================================
@@ -474,7 +579,7 @@ mod tests {
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
         // High limit — always accepted regardless of CURRENT_MEMORY from other tests
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX).await;
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE).await;
         assert!(result.is_ok());
     }
 
@@ -486,7 +591,7 @@ mod tests {
         let mut stream = Cursor::new(data);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let result = read_message_reuse(&mut stream, &mut buf, 1).await;
+        let result = read_message_reuse(&mut stream, &mut buf, 1, MAX_MESSAGE_SIZE).await;
         assert!(result.is_err());
     }
 
@@ -499,7 +604,7 @@ mod tests {
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
         let before = CURRENT_MEMORY.load(Ordering::SeqCst);
-        let _ = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let _ = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         let after = CURRENT_MEMORY.load(Ordering::SeqCst);
@@ -522,7 +627,7 @@ mod tests {
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
         let before = CURRENT_MEMORY.load(Ordering::SeqCst);
-        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX).await;
+        let result = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE).await;
         let after = CURRENT_MEMORY.load(Ordering::SeqCst);
 
         assert!(result.is_err());
@@ -554,17 +659,17 @@ mod tests {
         let mut stream = Cursor::new(all);
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
-        let r1 = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let r1 = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         let cap_after_first = buf.capacity();
 
-        let r2 = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let r2 = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         let cap_after_second = buf.capacity();
 
-        let r3 = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let r3 = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         let cap_after_third = buf.capacity();
@@ -596,13 +701,13 @@ mod tests {
         let mut buf = BytesMut::with_capacity(READ_BUF_DEFAULT_CAPACITY);
 
         // Read large message — reserve() grows, split() takes the data
-        let large_msg = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let large_msg = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         assert_eq!(large_msg.len(), 1 + 4 + 100_000);
 
         // Read small message — reserve() allocates fresh small buffer
-        let small_msg = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+        let small_msg = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
             .await
             .unwrap();
         assert_eq!(small_msg[0], b'Z');
@@ -639,13 +744,13 @@ mod tests {
         // Read the large Q and immediately drop it — that's what handle_simple_query
         // does once execute_server_roundtrip returns.
         {
-            let _ = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+            let _ = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
                 .await
                 .unwrap();
         }
 
         for _ in 0..50 {
-            let _msg = read_message_reuse(&mut stream, &mut buf, u64::MAX)
+            let _msg = read_message_reuse(&mut stream, &mut buf, u64::MAX, MAX_MESSAGE_SIZE)
                 .await
                 .unwrap();
         }
@@ -845,6 +950,28 @@ mod tests {
             "split() leaves remainder capacity ({cap_after}) much less than original ({cap_before})");
     }
 
+    /// A streamed payload is forwarded byte for byte and the bytes of the
+    /// next message stay in the reader.
+    #[tokio::test]
+    async fn proxy_copy_data_forwards_exactly_len() {
+        let payload: Vec<u8> = (0..100_000u32).map(|i| i as u8).collect();
+        let mut source = payload.clone();
+        source.extend_from_slice(b"Z\0\0\0\x05I");
+        let mut reader = tokio::io::BufReader::new(Cursor::new(source));
+        let mut writer = Vec::new();
+
+        let mut copied: usize = 0;
+        proxy_copy_data(&mut reader, &mut writer, payload.len(), &mut copied)
+            .await
+            .unwrap();
+
+        assert_eq!(copied, payload.len());
+        assert_eq!(writer, payload);
+        let mut rest = Vec::new();
+        reader.read_to_end(&mut rest).await.unwrap();
+        assert_eq!(rest, b"Z\0\0\0\x05I");
+    }
+
     /// `proxy_copy_data` must report the bytes that actually reached the
     /// writer when the writer fails partway through, not the full
     /// declared frame size. The streaming-byte counter relies on this
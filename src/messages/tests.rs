@@ -309,3 +309,32 @@ fn test_pg_error_msg_parsing() {
         err_fields
     );
 }
+
+#[tokio::test]
+async fn test_read_password_protocol_violations() {
+    use crate::messages::protocol::read_password;
+
+    let mut stream = std::io::Cursor::new(b"Q\0\0\0\x05".to_vec());
+    match read_password(&mut stream).await {
+        Err(Error::ClientProtocolViolation { kind, head, .. }) => {
+            assert_eq!(kind, "auth_desync");
+            assert_eq!(head, b"Q");
+        }
+        other => panic!("expected auth_desync, got {other:?}"),
+    }
+
+    let mut stream = std::io::Cursor::new(b"p\xff\xff\xff\xff".to_vec());
+    match read_password(&mut stream).await {
+        Err(Error::ClientProtocolViolation { kind, .. }) => assert_eq!(kind, "bad_length"),
+        other => panic!("expected bad_length, got {other:?}"),
+    }
+
+    let mut stream = std::io::Cursor::new(b"X\0\0\0\x04".to_vec());
+    assert!(matches!(
+        read_password(&mut stream).await,
+        Err(Error::ProtocolSyncError(_))
+    ));
+
+    let mut stream = std::io::Cursor::new(b"p\0\0\0\x08pwd\0".to_vec());
+    assert_eq!(read_password(&mut stream).await.unwrap(), b"pwd\0");
+}
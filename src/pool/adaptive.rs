@@ -0,0 +1,303 @@
+//! Adaptive pool sizing (`users[].max_pool_size`).
+//!
+//! Every `adaptive_pool_interval` each pool whose user has `max_pool_size`
+//! above `pool_size` is sampled: the mean checkout wait since the last
+//! sample and the number of idle backends. A wait above
+//! `adaptive_pool_wait_target` grows the pool one step toward
+//! `max_pool_size`. Three quiet intervals in a row (wait below half the
+//! target, idle backends left) shrink it one step back toward `pool_size`.
+//! The gap between the two thresholds and the streak keep a pool from
+//! flapping on a single noisy interval. With the `adaptive_pool_sizing`
+//! feature off every pool goes back to `pool_size` and stays there.
+
+use std::collections::HashMap;
+use std::sync::atomic::Ordering;
+
+use log::info;
+
+use crate::config::{features, get_config};
+use crate::utils::format_duration_ms;
+
+use super::{get_all_pools, ConnectionPool, PoolIdentifier};
+
+/// Quiet intervals in a row before the pool shrinks.
+const SHRINK_AFTER_QUIET_INTERVALS: u32 = 3;
+
+/// What to do with a pool after one sample.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Decision {
+    Hold,
+    Resize(usize),
+}
+
+/// One observation of a pool.
+#[derive(Debug, Clone, Copy)]
+struct Sample {
+    /// Mean checkout wait since the previous sample, microseconds.
+    mean_wait_us: u64,
+    /// Idle backends right now.
+    idle: usize,
+    /// Current pool size.
+    size: usize,
+    /// `pool_size`: the pool never shrinks below it.
+    floor: usize,
+    /// `max_pool_size`, capped by `max_db_connections`.
+    ceiling: usize,
+}
+
+/// Controller state of one pool between samples.
+#[derive(Debug, Default)]
+struct PoolState {
+    /// `AddressStats::generation` the counters below belong to; a RELOAD
+    /// that recreates the pool starts over from `pool_size`.
+    generation: u64,
+    wait_us: u64,
+    checkouts: u64,
+    quiet_intervals: u32,
+}
+
+/// Resize step: a quarter of the adaptive range, at least one connection.
+fn step(floor: usize, ceiling: usize) -> usize {
+    (ceiling.saturating_sub(floor) / 4).max(1)
+}
+
+fn decide(sample: Sample, target_us: u64, quiet_intervals: &mut u32) -> Decision {
+    let step = step(sample.floor, sample.ceiling);
+    if sample.mean_wait_us > target_us {
+        *quiet_intervals = 0;
+        if sample.size < sample.ceiling {
+            return Decision::Resize((sample.size + step).min(sample.ceiling));
+        }
+        return Decision::Hold;
+    }
+    if sample.mean_wait_us > target_us / 2 || sample.idle == 0 || sample.size <= sample.floor {
+        *quiet_intervals = 0;
+        return Decision::Hold;
+    }
+    *quiet_intervals += 1;
+    if *quiet_intervals < SHRINK_AFTER_QUIET_INTERVALS {
+        return Decision::Hold;
+    }
+    *quiet_intervals = 0;
+    let by = step.min(sample.idle);
+    Decision::Resize(sample.size.saturating_sub(by).max(sample.floor))
+}
+
+impl ConnectionPool {
+    /// Upper bound for adaptive sizing of this pool, or None when the
+    /// user has a fixed size.
+    fn adaptive_ceiling(&self) -> Option<usize> {
+        let user = &self.settings.user;
+        let max = user.max_pool_size.filter(|&max| max > user.pool_size)? as usize;
+        Some(match &self.coordinator {
+            Some(coordinator) => max.min(coordinator.config().max_db_connections),
+            None => max,
+        })
+    }
+
+    /// Shrinks a pool grown by adaptive sizing back to `pool_size`, once
+    /// the `adaptive_pool_sizing` feature is off.
+    fn hold_at_pool_size(&self) {
+        let floor = self.settings.user.pool_size as usize;
+        if self.adaptive_ceiling().is_none() || self.database.status().max_size == floor {
+            return;
+        }
+        info!(
+            "[{}@{}] adaptive pool sizing is off: pool size back to pool_size={floor}",
+            self.address.username, self.address.pool_name
+        );
+        self.database.resize(floor);
+        crate::web::metrics::record_adaptive_resize(
+            &self.address.username,
+            &self.address.pool_name,
+            "shrink",
+        );
+    }
+
+    /// Takes one sample and resizes the pool if the controller says so.
+    fn adapt_size(&self, state: &mut PoolState, ceiling: usize, target_us: u64) {
+        let stats = &self.address.stats;
+        let wait_us = stats.total.wait_time.load(Ordering::Relaxed);
+        let checkouts = stats.checkout_count.load(Ordering::Relaxed);
+        if state.generation != stats.generation {
+            *state = PoolState {
+                generation: stats.generation,
+                wait_us,
+                checkouts,
+                quiet_intervals: 0,
+            };
+            return;
+        }
+        let status = self.database.status();
+        let new_checkouts = checkouts.saturating_sub(state.checkouts);
+        let mean_wait_us = match wait_us
+            .saturating_sub(state.wait_us)
+            .checked_div(new_checkouts)
+        {
+            Some(mean) => mean,
+            // Nobody got a connection: clients still queued count as
+            // waiting longer than any target.
+            None if status.waiting > 0 => u64::MAX,
+            None => 0,
+        };
+        state.wait_us = wait_us;
+        state.checkouts = checkouts;
+
+        let sample = Sample {
+            mean_wait_us,
+            idle: status.available,
+            size: status.max_size,
+            floor: self.settings.user.pool_size as usize,
+            ceiling,
+        };
+        let Decision::Resize(new_size) = decide(sample, target_us, &mut state.quiet_intervals)
+        else {
+            return;
+        };
+        let direction = if new_size > sample.size {
+            "grow"
+        } else {
+            "shrink"
+        };
+        let wait = if mean_wait_us == u64::MAX {
+            "no checkout completed".to_string()
+        } else {
+            format!("mean wait {}", format_duration_ms(mean_wait_us / 1000))
+        };
+        info!(
+            "[{}@{}] adaptive pool sizing: {direction} pool size {} -> {new_size} \
+             ({wait}, {} idle, pool_size={}, max_pool_size={ceiling})",
+            self.address.username, self.address.pool_name, sample.size, sample.idle, sample.floor,
+        );
+        self.database.resize(new_size);
+        crate::web::metrics::record_adaptive_resize(
+            &self.address.username,
+            &self.address.pool_name,
+            direction,
+        );
+    }
+}
+
+/// Spawn the adaptive pool sizing task. Idles while no user has
+/// `max_pool_size`.
+pub fn spawn_adaptive_pool_sizing() {
+    tokio::spawn(async move {
+        let mut states: HashMap<PoolIdentifier, PoolState> = HashMap::new();
+        loop {
+            let (interval, target) = {
+                let config = get_config();
+                (
+                    config.general.adaptive_pool_interval,
+                    config.general.adaptive_pool_wait_target,
+                )
+            };
+            tokio::time::sleep(interval.as_std()).await;
+
+            let pools = get_all_pools();
+            if !features::enabled(features::ADAPTIVE_POOL_SIZING) {
+                states.clear();
+                for pool in pools.values() {
+                    pool.hold_at_pool_size();
+                }
+                continue;
+            }
+            states.retain(|id, _| pools.contains_key(id));
+            for (id, pool) in pools.iter() {
+                let Some(ceiling) = pool.adaptive_ceiling() else {
+                    states.remove(id);
+                    continue;
+                };
+                if pool.database.is_paused() {
+                    continue;
+                }
+                let state = states.entry(id.clone()).or_default();
+                pool.adapt_size(state, ceiling, target.as_millis() * 1000);
+            }
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sample(mean_wait_us: u64, idle: usize, size: usize) -> Sample {
+        Sample {
+            mean_wait_us,
+            idle,
+            size,
+            floor: 10,
+            ceiling: 30,
+        }
+    }
+
+    #[test]
+    fn grows_by_a_step_up_to_the_ceiling() {
+        let mut quiet = 2;
+        assert_eq!(
+            decide(sample(80_000, 0, 10), 50_000, &mut quiet),
+            Decision::Resize(15)
+        );
+        assert_eq!(quiet, 0);
+        assert_eq!(
+            decide(sample(80_000, 0, 28), 50_000, &mut quiet),
+            Decision::Resize(30)
+        );
+        assert_eq!(
+            decide(sample(80_000, 0, 30), 50_000, &mut quiet),
+            Decision::Hold
+        );
+    }
+
+    #[test]
+    fn shrinks_only_after_quiet_streak() {
+        let mut quiet = 0;
+        assert_eq!(
+            decide(sample(1_000, 8, 30), 50_000, &mut quiet),
+            Decision::Hold
+        );
+        assert_eq!(
+            decide(sample(1_000, 8, 30), 50_000, &mut quiet),
+            Decision::Hold
+        );
+        assert_eq!(
+            decide(sample(1_000, 8, 30), 50_000, &mut quiet),
+            Decision::Resize(25)
+        );
+        assert_eq!(quiet, 0);
+    }
+
+    #[test]
+    fn wait_between_thresholds_resets_streak() {
+        let mut quiet = 0;
+        decide(sample(1_000, 8, 30), 50_000, &mut quiet);
+        decide(sample(1_000, 8, 30), 50_000, &mut quiet);
+        assert_eq!(
+            decide(sample(30_000, 8, 30), 50_000, &mut quiet),
+            Decision::Hold
+        );
+        assert_eq!(quiet, 0);
+    }
+
+    #[test]
+    fn shrink_is_bounded_by_idle_backends_and_floor() {
+        let mut quiet = SHRINK_AFTER_QUIET_INTERVALS - 1;
+        assert_eq!(
+            decide(sample(0, 2, 30), 50_000, &mut quiet),
+            Decision::Resize(28)
+        );
+        let mut quiet = SHRINK_AFTER_QUIET_INTERVALS - 1;
+        assert_eq!(
+            decide(sample(0, 8, 12), 50_000, &mut quiet),
+            Decision::Resize(10)
+        );
+        let mut quiet = SHRINK_AFTER_QUIET_INTERVALS - 1;
+        assert_eq!(decide(sample(0, 8, 10), 50_000, &mut quiet), Decision::Hold);
+    }
+
+    #[test]
+    fn step_is_at_least_one() {
+        assert_eq!(step(10, 11), 1);
+        assert_eq!(step(10, 30), 5);
+    }
+}
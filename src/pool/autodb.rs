@@ -0,0 +1,307 @@
+//! Pools created on demand from the `pools."*"` template.
+//!
+//! A client asking for a database no pool is configured for gets one built
+//! from the template, the way pgbouncer handles `* = ...` in `[databases]`.
+//! Any pool whose name contains `*` is such a template for the databases
+//! its name matches (`pools."tenant_*"`), so one pg_doorman can front
+//! several clusters split by database name; the most specific pattern
+//! wins and `"*"` catches the rest.
+//! The pool is built once the client has authenticated against the
+//! template's users, at most `general.autodb_create_rate` a second and
+//! `general.autodb_max_pools` in all.
+//! The pool is added to the live config and rebuilt with the rest through
+//! `ConnectionPool::from_config`, so RELOAD keeps it (from the new template)
+//! and everything that walks `config.pools` sees it. Once no client has
+//! connected for `general.autodb_idle_timeout` and none is left, it is
+//! dropped again.
+
+use std::collections::HashMap;
+use std::time::{Duration, Instant};
+
+use log::{error, info};
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+
+use crate::config::{config_arc, lock_config_updates, store_config, Config, Pool};
+use crate::errors::Error;
+
+use super::{get_client_server_map, ConnectionPool};
+
+/// Databases created from the template, with the time of the last client
+/// that connected to each.
+static AUTODBS: Lazy<Mutex<HashMap<String, Instant>>> = Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Start of the current one-second window and the pools created in it,
+/// for `general.autodb_create_rate`.
+static CREATE_WINDOW: Lazy<Mutex<(Instant, usize)>> = Lazy::new(|| Mutex::new((Instant::now(), 0)));
+
+/// Make sure `database` has a pool, creating it from the template when
+/// there is one. Call only for an authenticated client. A database over
+/// `autodb_max_pools` or `autodb_create_rate` gets `Error::ClientError`.
+pub async fn ensure(database: &str) -> Result<(), Error> {
+    if config_arc().pools.contains_key(database) {
+        touch(database);
+        return Ok(());
+    }
+    if config_arc().autodb_template(database).is_none() {
+        return Ok(());
+    }
+
+    // Under the config update lock, so a pool is built only once when
+    // several clients ask for the same new database.
+    let _update = lock_config_updates().await;
+    let config = config_arc();
+    if config.pools.contains_key(database) {
+        touch(database);
+        return Ok(());
+    }
+    let Some((pattern, template)) = config.autodb_template(database) else {
+        return Ok(());
+    };
+    let max_pools = config.general.autodb_max_pools;
+    if max_pools > 0 && AUTODBS.lock().len() >= max_pools {
+        return Err(Error::ClientError(format!(
+            "too many pools created from templates (autodb_max_pools={max_pools})"
+        )));
+    }
+    let rate = config.general.autodb_create_rate;
+    if !take_create_slot(&mut CREATE_WINDOW.lock(), rate, Instant::now()) {
+        return Err(Error::ClientError(format!(
+            "pools are being created from templates too fast (autodb_create_rate={rate})"
+        )));
+    }
+    let pattern = pattern.to_string();
+    let template = template.clone();
+    let mut config = (*config).clone();
+    config.pools.insert(database.to_string(), template);
+    AUTODBS.lock().insert(database.to_string(), Instant::now());
+    info!("[pool: {database}] creating pool from the \"{pattern}\" template");
+    apply(config).await.inspect_err(|err| {
+        error!("[pool: {database}] failed to create pool from the \"{pattern}\" template: {err}");
+    })
+}
+
+/// Count one pool creation against `rate` a second. False once the
+/// current second's budget is spent; a `rate` of 0 has no limit.
+fn take_create_slot(window: &mut (Instant, usize), rate: usize, now: Instant) -> bool {
+    if rate == 0 {
+        return true;
+    }
+    if now.saturating_duration_since(window.0) >= Duration::from_secs(1) {
+        *window = (now, 0);
+    }
+    if window.1 >= rate {
+        return false;
+    }
+    window.1 += 1;
+    true
+}
+
+/// Whether a pool name is a template pattern rather than a database.
+pub fn is_pattern(name: &str) -> bool {
+    name.contains('*')
+}
+
+/// Glob match where `*` stands for any run of characters.
+pub fn pattern_matches(pattern: &str, database: &str) -> bool {
+    let mut parts = pattern.split('*');
+    let first = parts.next().unwrap_or_default();
+    let Some(mut rest) = database.strip_prefix(first) else {
+        return false;
+    };
+    let mut parts: Vec<&str> = parts.collect();
+    let Some(last) = parts.pop() else {
+        // No `*` at all.
+        return rest.is_empty();
+    };
+    for part in parts {
+        match rest.find(part) {
+            Some(at) => rest = &rest[at + part.len()..],
+            None => return false,
+        }
+    }
+    rest.len() >= last.len() && rest.ends_with(last)
+}
+
+/// Called by config parsing after validation: take the template patterns
+/// out of `pools`, most specific (most literal characters) first.
+pub(crate) fn take_templates(pools: &mut HashMap<String, Pool>) -> Vec<(String, Pool)> {
+    let names: Vec<String> = pools
+        .keys()
+        .filter(|name| is_pattern(name))
+        .cloned()
+        .collect();
+    let mut templates: Vec<(String, Pool)> = names
+        .into_iter()
+        .filter_map(|name| pools.remove(&name).map(|pool| (name, pool)))
+        .collect();
+    templates.sort_by(|(a, _), (b, _)| {
+        let literal = |name: &str| name.chars().filter(|&c| c != '*').count();
+        literal(b).cmp(&literal(a)).then_with(|| a.cmp(b))
+    });
+    templates
+}
+
+/// Called by config parsing: add the databases created so far to a freshly
+/// loaded config, built from the template they match now. Databases that
+/// are now configured explicitly, or match no template, stop being
+/// autodbs.
+pub(crate) fn restore(config: &mut Config) {
+    let mut autodbs = AUTODBS.lock();
+    autodbs.retain(|database, _| {
+        !config.pools.contains_key(database) && config.autodb_template(database).is_some()
+    });
+    for database in autodbs.keys() {
+        if let Some((_, template)) = config.autodb_template(database) {
+            let template = template.clone();
+            config.pools.insert(database.clone(), template);
+        }
+    }
+}
+
+/// Record a client login to `database`, which keeps an autodb pool from
+/// being dropped as idle.
+pub fn touch(database: &str) {
+    if let Some(last_used) = AUTODBS.lock().get_mut(database) {
+        *last_used = Instant::now();
+    }
+}
+
+async fn apply(config: Config) -> Result<(), Error> {
+    store_config(config);
+    let client_server_map = get_client_server_map()
+        .ok_or_else(|| Error::BadConfig("pools are not initialized yet".into()))?;
+    ConnectionPool::from_config(client_server_map).await
+}
+
+/// Spawn the task that drops autodb pools idle for longer than
+/// `general.autodb_idle_timeout`. Cheap no-op while there are none.
+pub fn spawn_autodb_gc(interval: Duration) {
+    tokio::spawn(async move {
+        let mut ticker = tokio::time::interval(interval);
+        loop {
+            ticker.tick().await;
+            gc_idle_autodbs().await;
+        }
+    });
+}
+
+async fn gc_idle_autodbs() {
+    let timeout = config_arc().general.autodb_idle_timeout.as_std();
+    let expired = expired_autodbs(&AUTODBS.lock(), timeout, Instant::now());
+    if expired.is_empty() {
+        return;
+    }
+    let clients = crate::stats::get_client_stats();
+    let mut idle: Vec<String> = expired
+        .into_iter()
+        .filter(|database| {
+            !clients
+                .values()
+                .any(|client| client.pool_name() == database.as_str())
+        })
+        .collect();
+    if idle.is_empty() {
+        return;
+    }
+
+    let _update = lock_config_updates().await;
+    let mut config = (*config_arc()).clone();
+    {
+        // A client may have connected since the check above.
+        let mut autodbs = AUTODBS.lock();
+        let still_expired = expired_autodbs(&autodbs, timeout, Instant::now());
+        idle.retain(|database| still_expired.contains(database));
+        for database in &idle {
+            autodbs.remove(database);
+            config.pools.remove(database);
+        }
+    }
+    if idle.is_empty() {
+        return;
+    }
+    info!(
+        "GC: removed {} idle autodb pool(s): {}",
+        idle.len(),
+        idle.join(", ")
+    );
+    if let Err(err) = apply(config).await {
+        error!("GC: failed to remove idle autodb pools: {err}");
+    }
+}
+
+fn expired_autodbs(
+    autodbs: &HashMap<String, Instant>,
+    timeout: Duration,
+    now: Instant,
+) -> Vec<String> {
+    autodbs
+        .iter()
+        .filter(|(_, last_used)| now.saturating_duration_since(**last_used) >= timeout)
+        .map(|(database, _)| database.clone())
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn patterns_match_globs() {
+        assert!(pattern_matches("*", "anything"));
+        assert!(pattern_matches("tenant_*", "tenant_42"));
+        assert!(pattern_matches("tenant_*", "tenant_"));
+        assert!(!pattern_matches("tenant_*", "other_42"));
+        assert!(pattern_matches("*_eu", "shop_eu"));
+        assert!(!pattern_matches("*_eu", "shop_us"));
+        assert!(pattern_matches("a*b*c", "axxbyyc"));
+        assert!(!pattern_matches("a*b*c", "axxcyyb"));
+        assert!(!pattern_matches("ab*ba", "aba"));
+    }
+
+    #[test]
+    fn templates_sorted_most_specific_first() {
+        let mut pools = HashMap::from([
+            ("*".to_string(), Pool::default()),
+            ("tenant_*".to_string(), Pool::default()),
+            ("tenant_eu_*".to_string(), Pool::default()),
+            ("app".to_string(), Pool::default()),
+        ]);
+        let templates = take_templates(&mut pools);
+        let names: Vec<&str> = templates.iter().map(|(name, _)| name.as_str()).collect();
+        assert_eq!(names, vec!["tenant_eu_*", "tenant_*", "*"]);
+        assert_eq!(pools.keys().collect::<Vec<_>>(), vec!["app"]);
+    }
+
+    #[test]
+    fn only_databases_unused_for_the_timeout_expire() {
+        let now = Instant::now();
+        let timeout = Duration::from_secs(60);
+        let autodbs = HashMap::from([
+            ("fresh".to_string(), now - Duration::from_secs(10)),
+            ("stale".to_string(), now - Duration::from_secs(61)),
+        ]);
+        assert_eq!(expired_autodbs(&autodbs, timeout, now), vec!["stale"]);
+    }
+
+    #[test]
+    fn creations_are_limited_per_second() {
+        let start = Instant::now();
+        let mut window = (start, 0);
+        assert!(take_create_slot(&mut window, 2, start));
+        assert!(take_create_slot(&mut window, 2, start));
+        assert!(!take_create_slot(
+            &mut window,
+            2,
+            start + Duration::from_millis(999)
+        ));
+        assert!(take_create_slot(
+            &mut window,
+            2,
+            start + Duration::from_secs(1)
+        ));
+
+        let mut unlimited = (start, 0);
+        assert!((0..100).all(|_| take_create_slot(&mut unlimited, 0, start)));
+    }
+}
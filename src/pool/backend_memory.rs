@@ -0,0 +1,104 @@
+//! Backend memory recycling (`pools.<name>.server_max_memory`).
+//!
+//! A long-lived backend keeps every relation and catalog entry it has ever
+//! touched in its relcache and catcache, so on databases with many tables
+//! it grows to hundreds of megabytes and never gives the memory back. When
+//! a connection is taken from the pool and its last check is older than
+//! `server_memory_check_interval`, the backend's own memory contexts are
+//! summed up from `pg_backend_memory_contexts` (PostgreSQL 14+); above the
+//! limit the connection is closed and the pool opens a fresh one.
+//!
+//! The view needs superuser (PostgreSQL 14) or `pg_read_all_stats`
+//! (PostgreSQL 15+). When the query fails the pool logs one warning and
+//! stops checking until the pool is recreated, instead of closing working
+//! connections.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
+
+use log::warn;
+
+use crate::errors::Error;
+use crate::server::Server;
+
+const MEMORY_QUERY: &str = "SELECT sum(total_bytes) FROM pg_backend_memory_contexts";
+
+/// Memory limit of the backends of one pool.
+#[derive(Debug)]
+pub struct MemoryLimit {
+    max_bytes: u64,
+    check_interval: Duration,
+    /// Set after the first failed query; checks stop for this pool.
+    unsupported: AtomicBool,
+}
+
+impl MemoryLimit {
+    pub fn new(max_bytes: u64, check_interval: Duration) -> Self {
+        MemoryLimit {
+            max_bytes,
+            check_interval,
+            unsupported: AtomicBool::new(false),
+        }
+    }
+
+    /// Whether `server` is due for a memory check.
+    pub fn check_due(&self, server: &Server) -> bool {
+        !self.unsupported.load(Ordering::Relaxed)
+            && server
+                .memory_checked_at
+                .is_none_or(|at| at.elapsed() >= self.check_interval)
+    }
+
+    /// Asks the backend for its memory footprint. Returns the footprint
+    /// when it exceeds the limit. A query PostgreSQL rejects turns the
+    /// checks off for the pool; only a broken connection is an error.
+    pub async fn check(&self, server: &mut Server) -> Result<Option<u64>, Error> {
+        server.memory_checked_at = Some(Instant::now());
+        match server.query_first_value(MEMORY_QUERY).await {
+            Ok(value) => Ok(parse_bytes(value.as_deref()).filter(|&bytes| bytes > self.max_bytes)),
+            Err(Error::QueryError(err)) => {
+                if !self.unsupported.swap(true, Ordering::Relaxed) {
+                    warn!(
+                        "[{}@{}] server_max_memory disabled for this pool: {err} \
+                         (needs PostgreSQL 14+ and superuser or pg_read_all_stats)",
+                        server.address.username, server.address.pool_name,
+                    );
+                }
+                Ok(None)
+            }
+            Err(err) => Err(err),
+        }
+    }
+
+    pub fn max_bytes(&self) -> u64 {
+        self.max_bytes
+    }
+}
+
+/// `sum(total_bytes)` as text; NULL or garbage reads as unknown.
+fn parse_bytes(value: Option<&str>) -> Option<u64> {
+    value?.parse().ok()
+}
+
+/// `123.4MB`, for log lines.
+pub fn format_mb(bytes: u64) -> String {
+    format!("{:.1}MB", bytes as f64 / (1024.0 * 1024.0))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_sum() {
+        assert_eq!(parse_bytes(Some("268435456")), Some(268_435_456));
+        assert_eq!(parse_bytes(None), None);
+        assert_eq!(parse_bytes(Some("")), None);
+    }
+
+    #[test]
+    fn formats_megabytes() {
+        assert_eq!(format_mb(256 * 1024 * 1024), "256.0MB");
+        assert_eq!(format_mb(1536 * 1024), "1.5MB");
+    }
+}
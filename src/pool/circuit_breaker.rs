@@ -0,0 +1,234 @@
+//! Backend circuit breaker (`general.circuit_breaker_threshold`).
+//!
+//! After `circuit_breaker_threshold` backend connects in a row fail, the
+//! breaker opens: for `circuit_breaker_cooldown` every checkout that needs
+//! a new server connection fails at once with SQLSTATE 08004 instead of
+//! queueing for `query_wait_timeout` behind a database that is down, and
+//! no connects are attempted. When the cooldown ends the breaker is
+//! half-open: one connect goes through as a probe while the others keep
+//! failing fast. A successful probe closes the breaker; a failed one opens
+//! it for another cooldown.
+//!
+//! Login failures and local errors (file descriptor exhaustion, rejected
+//! `startup_parameters`) do not count: they are not a sign of a dead
+//! backend and have handling of their own.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
+
+use parking_lot::Mutex;
+
+use crate::errors::Error;
+
+#[derive(Debug)]
+enum State {
+    Closed { failures: u32 },
+    Open { until: Instant, last_error: String },
+    HalfOpen,
+}
+
+/// Whether a new server connection may be opened.
+#[derive(Debug, PartialEq)]
+pub enum Admission {
+    Pass,
+    /// The connect probes a half-open breaker; its outcome decides the
+    /// state.
+    Probe,
+    Reject(Error),
+}
+
+/// Breaker state change worth logging.
+#[derive(Debug, PartialEq, Eq)]
+pub enum Transition {
+    None,
+    Opened,
+    Closed,
+}
+
+#[derive(Debug)]
+pub struct CircuitBreaker {
+    threshold: u32,
+    cooldown: Duration,
+    /// False while closed, so checkouts of a healthy pool skip the lock.
+    tripped: AtomicBool,
+    state: Mutex<State>,
+}
+
+impl CircuitBreaker {
+    pub fn new(threshold: u32, cooldown: Duration) -> Self {
+        CircuitBreaker {
+            threshold: threshold.max(1),
+            cooldown,
+            tripped: AtomicBool::new(false),
+            state: Mutex::new(State::Closed { failures: 0 }),
+        }
+    }
+
+    pub fn cooldown(&self) -> Duration {
+        self.cooldown
+    }
+
+    /// Decides whether a new server connection may be opened.
+    #[inline]
+    pub fn admit(&self) -> Admission {
+        if !self.tripped.load(Ordering::Relaxed) {
+            return Admission::Pass;
+        }
+        let mut state = self.state.lock();
+        match &*state {
+            State::Closed { .. } => Admission::Pass,
+            State::Open { until, last_error } if Instant::now() < *until => {
+                Admission::Reject(open_error(last_error, *until))
+            }
+            State::Open { .. } => {
+                *state = State::HalfOpen;
+                Admission::Probe
+            }
+            State::HalfOpen => Admission::Reject(Error::CircuitBreakerOpen(
+                "backend circuit breaker is half-open, a probe connection is in progress"
+                    .to_string(),
+            )),
+        }
+    }
+
+    pub fn record_success(&self) -> Transition {
+        let mut state = self.state.lock();
+        let transition = match *state {
+            State::Closed { .. } => Transition::None,
+            _ => Transition::Closed,
+        };
+        *state = State::Closed { failures: 0 };
+        self.tripped.store(false, Ordering::Relaxed);
+        transition
+    }
+
+    pub fn record_failure(&self, err: &str) -> Transition {
+        let mut state = self.state.lock();
+        let failures = match *state {
+            State::Closed { failures } => failures + 1,
+            // A failed probe, or a connect that started before the
+            // breaker opened.
+            State::HalfOpen => self.threshold,
+            State::Open { .. } => return Transition::None,
+        };
+        if failures < self.threshold {
+            *state = State::Closed { failures };
+            return Transition::None;
+        }
+        *state = State::Open {
+            until: Instant::now() + self.cooldown,
+            last_error: err.to_string(),
+        };
+        self.tripped.store(true, Ordering::Relaxed);
+        Transition::Opened
+    }
+
+    /// A probe ended without an outcome (the client went away, or a local
+    /// error): let the next connect probe instead.
+    fn abandon_probe(&self) {
+        let mut state = self.state.lock();
+        if matches!(*state, State::HalfOpen) {
+            *state = State::Open {
+                until: Instant::now(),
+                last_error: "probe abandoned".to_string(),
+            };
+        }
+    }
+}
+
+/// Held by the probing connect; abandons the probe when dropped before
+/// an outcome was recorded.
+pub struct ProbeGuard<'a>(pub &'a CircuitBreaker);
+
+impl Drop for ProbeGuard<'_> {
+    fn drop(&mut self) {
+        self.0.abandon_probe();
+    }
+}
+
+fn open_error(last_error: &str, until: Instant) -> Error {
+    let left = until.saturating_duration_since(Instant::now());
+    Error::CircuitBreakerOpen(format!(
+        "backend circuit breaker is open after repeated connection failures \
+         (last error: {last_error}); retrying in {}s",
+        left.as_secs() + 1
+    ))
+}
+
+/// Whether a failed connect says something about the backend's health.
+pub fn counts_as_failure(err: &Error) -> bool {
+    !matches!(
+        err,
+        Error::CircuitBreakerOpen(_)
+            | Error::ConnectResourceExhausted(_)
+            | Error::ServerStartupParameterRejection { .. }
+    ) && !super::connect_retry::is_login_failure(err)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn opens_after_threshold_consecutive_failures() {
+        let breaker = CircuitBreaker::new(3, Duration::from_secs(60));
+        assert_eq!(breaker.record_failure("refused"), Transition::None);
+        assert_eq!(breaker.record_failure("refused"), Transition::None);
+        assert_eq!(breaker.admit(), Admission::Pass);
+        assert_eq!(breaker.record_failure("refused"), Transition::Opened);
+        assert!(matches!(breaker.admit(), Admission::Reject(_)));
+    }
+
+    #[test]
+    fn success_resets_failure_count() {
+        let breaker = CircuitBreaker::new(2, Duration::from_secs(60));
+        breaker.record_failure("refused");
+        assert_eq!(breaker.record_success(), Transition::None);
+        assert_eq!(breaker.record_failure("refused"), Transition::None);
+        assert_eq!(breaker.admit(), Admission::Pass);
+    }
+
+    #[test]
+    fn half_open_admits_one_probe() {
+        let breaker = CircuitBreaker::new(1, Duration::ZERO);
+        breaker.record_failure("refused");
+        assert_eq!(breaker.admit(), Admission::Probe);
+        assert!(matches!(breaker.admit(), Admission::Reject(_)));
+        assert_eq!(breaker.record_success(), Transition::Closed);
+        assert_eq!(breaker.admit(), Admission::Pass);
+    }
+
+    #[test]
+    fn failed_probe_reopens() {
+        let breaker = CircuitBreaker::new(5, Duration::ZERO);
+        for _ in 0..5 {
+            breaker.record_failure("refused");
+        }
+        assert_eq!(breaker.admit(), Admission::Probe);
+        assert_eq!(breaker.record_failure("refused"), Transition::Opened);
+    }
+
+    #[test]
+    fn abandoned_probe_lets_next_checkout_probe() {
+        let breaker = CircuitBreaker::new(1, Duration::ZERO);
+        breaker.record_failure("refused");
+        assert_eq!(breaker.admit(), Admission::Probe);
+        drop(ProbeGuard(&breaker));
+        assert_eq!(breaker.admit(), Admission::Probe);
+        let guard = ProbeGuard(&breaker);
+        assert_eq!(breaker.record_success(), Transition::Closed);
+        drop(guard);
+        assert_eq!(breaker.admit(), Admission::Pass);
+    }
+
+    #[test]
+    fn login_and_local_errors_do_not_count() {
+        assert!(counts_as_failure(&Error::ConnectError("refused".into())));
+        assert!(!counts_as_failure(&Error::ConnectResourceExhausted(
+            "too many open files".into()
+        )));
+        assert!(!counts_as_failure(&Error::CircuitBreakerOpen(
+            "open".into()
+        )));
+    }
+}
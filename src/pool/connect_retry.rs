@@ -0,0 +1,188 @@
+//! Backend connect retry policy and login-failure circuit breaker.
+//!
+//! A new backend connection is attempted up to `server_connect_attempts`
+//! times when the host is unreachable or still starting up, with an
+//! exponential backoff between attempts. Login failures are never retried:
+//! with `server_login_retry` set, the host is blocked for that long after a
+//! failed login and connection requests get the stored error at once, so a
+//! wrong password costs PostgreSQL one failed login per interval instead of
+//! one per client.
+
+use std::collections::HashMap;
+use std::time::{Duration, Instant};
+
+use parking_lot::Mutex;
+
+use crate::errors::Error;
+
+/// Upper bound for a single backoff step.
+const MAX_BACKOFF: Duration = Duration::from_secs(10);
+
+/// Default delay before the second attempt.
+pub const DEFAULT_BACKOFF: Duration = Duration::from_millis(100);
+
+pub struct ConnectRetry {
+    attempts: u32,
+    backoff: Duration,
+    /// Zero disables the login circuit breaker.
+    login_retry: Duration,
+    /// Hosts with a recent login failure: block deadline and the error.
+    blocked: Mutex<HashMap<(String, u16), (Instant, Error)>>,
+}
+
+impl Default for ConnectRetry {
+    fn default() -> ConnectRetry {
+        ConnectRetry::new(1, DEFAULT_BACKOFF, Duration::ZERO)
+    }
+}
+
+impl ConnectRetry {
+    pub fn new(attempts: u32, backoff: Duration, login_retry: Duration) -> ConnectRetry {
+        ConnectRetry {
+            attempts: attempts.max(1),
+            backoff,
+            login_retry,
+            blocked: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Total attempts per new connection, at least 1.
+    pub fn attempts(&self) -> u32 {
+        self.attempts
+    }
+
+    /// Delay after failed attempt number `attempt` (1-based).
+    pub fn backoff(&self, attempt: u32) -> Duration {
+        let factor = 1u32 << attempt.saturating_sub(1).min(16);
+        self.backoff.saturating_mul(factor).min(MAX_BACKOFF)
+    }
+
+    /// The stored login error while `host:port` is blocked.
+    pub fn blocked(&self, host: &str, port: u16) -> Option<Error> {
+        if self.login_retry.is_zero() {
+            return None;
+        }
+        let mut blocked = self.blocked.lock();
+        let key = (host.to_string(), port);
+        match blocked.get(&key) {
+            Some((until, err)) if Instant::now() < *until => Some(err.clone()),
+            Some(_) => {
+                blocked.remove(&key);
+                None
+            }
+            None => None,
+        }
+    }
+
+    /// Block `host:port` after a login failure. Returns true when the host
+    /// was not blocked before, so the caller logs the failure once.
+    pub fn block(&self, host: &str, port: u16, err: &Error) -> bool {
+        if self.login_retry.is_zero() {
+            return false;
+        }
+        let until = Instant::now() + self.login_retry;
+        self.blocked
+            .lock()
+            .insert((host.to_string(), port), (until, err.clone()))
+            .is_none()
+    }
+
+    /// Forget a block after a successful login. Returns true when the host
+    /// had been blocked.
+    pub fn unblock(&self, host: &str, port: u16) -> bool {
+        if self.login_retry.is_zero() {
+            return false;
+        }
+        let mut blocked = self.blocked.lock();
+        if blocked.is_empty() {
+            return false;
+        }
+        blocked.remove(&(host.to_string(), port)).is_some()
+    }
+
+    pub fn login_retry(&self) -> Duration {
+        self.login_retry
+    }
+}
+
+/// Backend rejected the login: SQLSTATE class 28 (invalid password, no
+/// pg_hba entry) or a client-side authentication failure.
+pub fn is_login_failure(err: &Error) -> bool {
+    match err {
+        Error::ServerAuthError(_, _) => true,
+        Error::ServerStartupError(message, _) => message.starts_with("28"),
+        _ => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::errors::ServerIdentifier;
+
+    fn login_err() -> Error {
+        Error::ServerStartupError(
+            "28P01: password authentication failed for user \"alice\"".into(),
+            ServerIdentifier::new("alice".to_string(), "db", "pool_a"),
+        )
+    }
+
+    #[test]
+    fn backoff_doubles_and_is_capped() {
+        let retry = ConnectRetry::new(5, Duration::from_millis(100), Duration::ZERO);
+        assert_eq!(retry.backoff(1), Duration::from_millis(100));
+        assert_eq!(retry.backoff(2), Duration::from_millis(200));
+        assert_eq!(retry.backoff(3), Duration::from_millis(400));
+        assert_eq!(retry.backoff(40), MAX_BACKOFF);
+    }
+
+    #[test]
+    fn attempts_is_at_least_one() {
+        assert_eq!(
+            ConnectRetry::new(0, DEFAULT_BACKOFF, Duration::ZERO).attempts(),
+            1
+        );
+    }
+
+    #[test]
+    fn login_failure_classification() {
+        assert!(is_login_failure(&login_err()));
+        let id = ServerIdentifier::new("alice".to_string(), "db", "pool_a");
+        assert!(is_login_failure(&Error::ServerAuthError(
+            "SCRAM failed".into(),
+            id.clone()
+        )));
+        assert!(!is_login_failure(&Error::ServerStartupError(
+            "3D000: database \"x\" does not exist".into(),
+            id
+        )));
+        assert!(!is_login_failure(&Error::ConnectError("refused".into())));
+    }
+
+    #[test]
+    fn disabled_breaker_never_blocks() {
+        let retry = ConnectRetry::default();
+        assert!(!retry.block("pg1", 5432, &login_err()));
+        assert!(retry.blocked("pg1", 5432).is_none());
+    }
+
+    #[test]
+    fn breaker_blocks_host_until_unblocked() {
+        let retry = ConnectRetry::new(1, DEFAULT_BACKOFF, Duration::from_secs(60));
+        assert!(retry.block("pg1", 5432, &login_err()));
+        assert!(!retry.block("pg1", 5432, &login_err()), "already blocked");
+        assert_eq!(retry.blocked("pg1", 5432), Some(login_err()));
+        assert!(retry.blocked("pg2", 5432).is_none());
+        assert!(retry.unblock("pg1", 5432));
+        assert!(retry.blocked("pg1", 5432).is_none());
+    }
+
+    #[test]
+    fn breaker_expires() {
+        let retry = ConnectRetry::new(1, DEFAULT_BACKOFF, Duration::from_millis(10));
+        retry.block("pg1", 5432, &login_err());
+        std::thread::sleep(Duration::from_millis(20));
+        assert!(retry.blocked("pg1", 5432).is_none());
+        assert!(retry.block("pg1", 5432, &login_err()), "logged again");
+    }
+}
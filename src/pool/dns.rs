@@ -0,0 +1,213 @@
+//! Periodic DNS re-resolution of backend hosts.
+//!
+//! Backend connects resolve the host through the system resolver every
+//! time, so new connections already follow DNS changes. Pooled connections
+//! do not: after a Kubernetes service or an RDS endpoint moves, idle
+//! connections keep talking to the old address. With
+//! `dns_refresh_interval` set, every hostname used by a pool is resolved on
+//! that interval (and right after a connect failure); idle connections
+//! whose peer address is no longer in the answer are closed, and busy ones
+//! are refused on their next checkout.
+
+use std::collections::{HashMap, HashSet};
+use std::net::IpAddr;
+use std::time::{Duration, Instant};
+
+use log::{debug, info, warn};
+use once_cell::sync::Lazy;
+use parking_lot::{Mutex, RwLock};
+
+use crate::config::get_config;
+
+use super::get_all_pools;
+
+/// Latest DNS answer per `(host, port)`. Empty until the refresh task
+/// resolves the host for the first time, so nothing is ever considered
+/// stale when the feature is disabled.
+static RESOLVED: Lazy<RwLock<HashMap<(String, u16), HashSet<IpAddr>>>> =
+    Lazy::new(|| RwLock::new(HashMap::new()));
+
+/// Last failure-triggered refresh per host, to keep a connect storm from
+/// turning into a resolver storm.
+static LAST_FAILURE_REFRESH: Lazy<Mutex<HashMap<(String, u16), Instant>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+/// Minimum spacing between failure-triggered refreshes of one host.
+const FAILURE_REFRESH_MIN_INTERVAL: Duration = Duration::from_secs(1);
+
+/// True when `host` is a DNS name rather than an IP literal or a unix
+/// socket directory.
+pub fn is_hostname(host: &str) -> bool {
+    !host.is_empty() && !host.starts_with('/') && host.parse::<IpAddr>().is_err()
+}
+
+/// True when `ip` was resolved for `host:port` earlier but is missing from
+/// the latest DNS answer.
+pub fn is_stale(host: &str, port: u16, ip: IpAddr) -> bool {
+    RESOLVED
+        .read()
+        .get(&(host.to_string(), port))
+        .is_some_and(|ips| !ips.contains(&ip))
+}
+
+/// Resolve `host:port` and store the answer. Returns true when the set of
+/// addresses changed compared to the previous answer. An empty or failed
+/// lookup keeps the previous answer: a resolver hiccup must not retire
+/// every pooled connection.
+async fn refresh_host(host: &str, port: u16) -> bool {
+    let ips: HashSet<IpAddr> = match tokio::net::lookup_host((host, port)).await {
+        Ok(addrs) => addrs.map(|a| a.ip()).collect(),
+        Err(err) => {
+            warn!("dns refresh: failed to resolve {host}:{port}: {err}");
+            return false;
+        }
+    };
+    if ips.is_empty() {
+        warn!("dns refresh: {host}:{port} resolved to no addresses, keeping previous answer");
+        return false;
+    }
+    let key = (host.to_string(), port);
+    let previous = RESOLVED.write().insert(key, ips.clone());
+    match previous {
+        Some(previous) if previous == ips => false,
+        Some(previous) => {
+            info!(
+                "dns refresh: {host}:{port} changed from {} to {}",
+                format_ips(&previous),
+                format_ips(&ips)
+            );
+            true
+        }
+        None => {
+            debug!(
+                "dns refresh: {host}:{port} resolved to {}",
+                format_ips(&ips)
+            );
+            false
+        }
+    }
+}
+
+fn format_ips(ips: &HashSet<IpAddr>) -> String {
+    let mut list: Vec<String> = ips.iter().map(|ip| ip.to_string()).collect();
+    list.sort();
+    list.join(",")
+}
+
+/// Hostnames listed in `server_host` across all configured pools.
+fn pool_hostnames() -> HashSet<(String, u16)> {
+    crate::config::config_arc()
+        .pools
+        .values()
+        .filter(|pool| super::srv::srv_name(&pool.server_host).is_none())
+        .flat_map(|pool| pool.server_hosts())
+        .filter(|(host, _)| is_hostname(host))
+        .collect()
+}
+
+/// Close idle connections whose backend address left the DNS record.
+fn retain_stale_connections() {
+    for pool in get_all_pools().values() {
+        let before = pool.database.status().available;
+        pool.database.retain("dns_change", |server, _| {
+            !server
+                .resolved_ip
+                .is_some_and(|ip| is_stale(&server.address.host, server.address.port, ip))
+        });
+        let closed = before.saturating_sub(pool.database.status().available);
+        if closed > 0 {
+            info!(
+                "[{}@{}] closed {} idle server{}: address no longer in DNS",
+                pool.address().username,
+                pool.address().pool_name,
+                closed,
+                if closed == 1 { "" } else { "s" },
+            );
+        }
+    }
+}
+
+/// Re-resolve a host right after a connect failure, at most once per
+/// second per host. No-op when `dns_refresh_interval` is disabled.
+pub fn refresh_after_failure(host: &str, port: u16) {
+    if get_config().general.dns_refresh_interval.as_millis() == 0 || !is_hostname(host) {
+        return;
+    }
+    let key = (host.to_string(), port);
+    {
+        let mut last = LAST_FAILURE_REFRESH.lock();
+        let now = Instant::now();
+        if last
+            .get(&key)
+            .is_some_and(|at| now.duration_since(*at) < FAILURE_REFRESH_MIN_INTERVAL)
+        {
+            return;
+        }
+        last.insert(key.clone(), now);
+    }
+    tokio::spawn(async move {
+        if refresh_host(&key.0, key.1).await {
+            retain_stale_connections();
+        }
+    });
+}
+
+/// Spawn the periodic refresh task. The interval is re-read from the live
+/// config on every tick, so RELOAD can enable, disable or retune it.
+pub fn spawn_dns_refresh() {
+    tokio::spawn(async move {
+        loop {
+            let interval = get_config().general.dns_refresh_interval.as_std();
+            if interval.is_zero() {
+                RESOLVED.write().clear();
+                tokio::time::sleep(Duration::from_secs(1)).await;
+                continue;
+            }
+            let mut changed = false;
+            for (host, port) in pool_hostnames() {
+                changed |= refresh_host(&host, port).await;
+            }
+            if changed {
+                retain_stale_connections();
+            }
+            tokio::time::sleep(interval).await;
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn hostname_detection() {
+        assert!(is_hostname("db.example.com"));
+        assert!(is_hostname("postgres"));
+        assert!(!is_hostname("10.0.0.1"));
+        assert!(!is_hostname("::1"));
+        assert!(!is_hostname("/var/run/postgresql"));
+        assert!(!is_hostname(""));
+    }
+
+    #[test]
+    fn unknown_host_is_never_stale() {
+        assert!(!is_stale(
+            "never-resolved.invalid",
+            5432,
+            "10.0.0.1".parse().unwrap()
+        ));
+    }
+
+    #[test]
+    fn stale_after_answer_changes() {
+        let key = ("stale-test.invalid".to_string(), 5432);
+        let ip_old: IpAddr = "10.0.0.1".parse().unwrap();
+        let ip_new: IpAddr = "10.0.0.2".parse().unwrap();
+        RESOLVED
+            .write()
+            .insert(key.clone(), HashSet::from([ip_new]));
+        assert!(is_stale(&key.0, key.1, ip_old));
+        assert!(!is_stale(&key.0, key.1, ip_new));
+        RESOLVED.write().remove(&key);
+    }
+}
@@ -1,21 +1,26 @@
-//! Dynamic pool creation for auth_query passthrough mode.
+//! Dynamic pool creation for auth_query passthrough mode and `"*"` users.
 //!
 //! When a client authenticates via `auth_query` in passthrough mode (no `server_user`),
+//! or logs in as a user that only the pool's `"*"` user covers,
 //! pg_doorman creates a per-user pool on the fly. These pools are tracked in `DYNAMIC_POOLS`
 //! and garbage-collected when idle. On RELOAD, dynamic pools are dropped and recreated
 //! on the next client connection with fresh settings.
 
+use std::collections::BTreeMap;
 use std::sync::atomic::{AtomicBool, AtomicU32, Ordering};
 use std::sync::Arc;
 
+use dashmap::DashMap;
 use log::{debug, info, warn};
 
-use crate::config::{get_config, BackendAuthMethod, PoolMode, User};
+use crate::config::{
+    get_config, BackendAuthMethod, Config, Pool as ConfigPool, PoolMode, User, WILDCARD_USER,
+};
 use crate::errors::Error;
 use crate::server::ServerParameters;
 use crate::stats::AddressStats;
 
-use super::types::{PoolConfig, QueueMode, Timeouts};
+use super::types::{PoolConfig, Timeouts};
 use super::{
     build_server_tls_for_pool, get_auth_query_state, get_coordinator, get_pool,
     register_dynamic_pool, resolve_server_cache_size, Address, CheckQueryCache, ConnectionPool,
@@ -88,15 +93,129 @@ pub fn create_dynamic_pool(
             "auth_query: config not found in pool '{pool_name}' for dynamic pool"
         ))
     })?;
+    let user = User {
+        username: username.to_string(),
+        password: String::new(),
+        pool_size: aq_config.pool_size,
+        min_pool_size: if aq_config.min_pool_size > 0 {
+            Some(aq_config.min_pool_size)
+        } else {
+            None
+        },
+        server_username: Some(username.to_string()),
+        server_password: None,
+        ..Default::default()
+    };
+
+    // Convert the caller's HashMap snapshot into the BTreeMap shape
+    // ServerPool stores. The snapshot comes from the auth_query row used
+    // for this login, so TTL expiry or an interleaved refetch cannot
+    // change the overlay while the pool is created. Dedicated-mode pools
+    // should not reach this path, but keep the guard so a future caller
+    // cannot attach a per-user overlay to a shared backend pool.
+    let per_user_startup_overlay: std::sync::Arc<std::collections::BTreeMap<String, String>> = {
+        let is_dedicated = super::get_auth_query_state(pool_name)
+            .map(|state| state.config.is_dedicated_mode())
+            .unwrap_or(false);
+        if is_dedicated || fetched_overlay.is_empty() {
+            std::sync::Arc::new(std::collections::BTreeMap::new())
+        } else {
+            let map: std::collections::BTreeMap<String, String> = fetched_overlay
+                .iter()
+                .map(|(k, v)| (k.clone(), v.clone()))
+                .collect();
+            std::sync::Arc::new(map)
+        }
+    };
+
+    // The auth_query cache compares the new fetched per-user map against
+    // this value after every refetch; a mismatch drops the dynamic pool
+    // so the next connect rebuilds with the new reset_val. The caller
+    // already has the hash precomputed on the `CacheEntry`, so we reuse
+    // it instead of re-running per_user_overlay_hash on the same map.
+    build_dynamic_pool(
+        &config,
+        pool_config,
+        pool_name,
+        user,
+        backend_auth.map(|ba| Arc::new(parking_lot::RwLock::new(ba))),
+        per_user_startup_overlay,
+        fetched_overlay_hash,
+        // auth_query pools are checked against their AuthQueryState on reload
+        0,
+    )
+}
+
+/// Create the pool of a user not listed in the pool config from the
+/// pool's `"*"` user: same settings and client authentication, with the
+/// backend login done as the client's username. Returns the existing pool
+/// when there is one.
+pub fn create_wildcard_user_pool(
+    pool_name: &str,
+    username: &str,
+) -> Result<(ConnectionPool, super::PoolInitGuard), Error> {
+    if let Some(existing) = get_pool(pool_name, username) {
+        return Ok((existing, super::PoolInitGuard::already_committed()));
+    }
+
+    let config = get_config();
+    let pool_config = config.pools.get(pool_name).ok_or_else(|| {
+        Error::AuthError(format!(
+            "pool config '{pool_name}' not found for user {username}"
+        ))
+    })?;
+    let template = pool_config.wildcard_user().ok_or_else(|| {
+        Error::AuthError(format!(
+            "pool '{pool_name}' has no \"{WILDCARD_USER}\" user for {username}"
+        ))
+    })?;
+    let user = User {
+        username: username.to_string(),
+        // server_password authenticates the client's own name.
+        server_username: template
+            .server_password
+            .as_ref()
+            .map(|_| username.to_string()),
+        ..template.clone()
+    };
+    let backend_auth = super::passthrough_backend_auth(&user, pool_name);
+    let config_hash =
+        super::pool_config_hash(pool_config, super::general_startup_hash(&config.general));
+    build_dynamic_pool(
+        &config,
+        pool_config,
+        pool_name,
+        user,
+        backend_auth,
+        Arc::new(BTreeMap::new()),
+        super::empty_overlay_hash(),
+        config_hash,
+    )
+}
+
+/// Build a per-user pool and publish it in `POOLS` and `DYNAMIC_POOLS`.
+/// `config_hash` is compared with the pool config on reload, see
+/// `ConnectionPool::from_config`.
+#[allow(clippy::too_many_arguments)]
+fn build_dynamic_pool(
+    config: &Config,
+    pool_config: &ConfigPool,
+    pool_name: &str,
+    user: User,
+    backend_auth: Option<Arc<parking_lot::RwLock<BackendAuthMethod>>>,
+    per_user_startup_overlay: Arc<BTreeMap<String, String>>,
+    overlay_hash: u64,
+    config_hash: u64,
+) -> Result<(ConnectionPool, super::PoolInitGuard), Error> {
+    let username = user.username.clone();
     let client_server_map = super::get_client_server_map()
-        .ok_or_else(|| Error::AuthError("auth_query: client_server_map not initialized".into()))?;
+        .ok_or_else(|| Error::AuthError("client_server_map not initialized".into()))?;
 
     let server_database = pool_config
         .server_database
         .clone()
         .unwrap_or_else(|| pool_name.to_string());
 
-    let ba_arc = backend_auth.map(|ba| Arc::new(parking_lot::RwLock::new(ba)));
     debug!(
         "[{username}@{pool_name}] building server TLS config (mode={})",
         pool_config
@@ -106,32 +225,19 @@ pub fn create_dynamic_pool(
     );
     let server_tls = build_server_tls_for_pool(pool_config, &config.general)?;
 
+    let (server_host, server_port) = pool_config.primary_server();
     let address = Address {
         database: pool_name.to_string(),
-        host: pool_config.server_host.clone(),
-        port: pool_config.server_port,
+        host: server_host,
+        port: server_port,
         username: username.to_string(),
-        password: String::new(),
+        password: user.password.clone(),
         pool_name: pool_name.to_string(),
         stats: Arc::new(AddressStats::default()),
-        backend_auth: ba_arc,
+        backend_auth,
         server_tls,
     };
 
-    let user = User {
-        username: username.to_string(),
-        password: String::new(),
-        pool_size: aq_config.pool_size,
-        min_pool_size: if aq_config.min_pool_size > 0 {
-            Some(aq_config.min_pool_size)
-        } else {
-            None
-        },
-        server_username: Some(username.to_string()),
-        server_password: None,
-        ..Default::default()
-    };
-
     let prepared_statements_cache_size = match config.general.prepared_statements {
         true => pool_config
             .prepared_statements_cache_size
@@ -161,31 +267,11 @@ pub fn create_dynamic_pool(
     let base_startup_parameters = std::sync::Arc::new(
         crate::config::startup_parameters::cascade_canonical_keys(&[
             &config.general.startup_parameters,
-            &pool_config.startup_parameters,
+            &pool_config.server_startup_parameters(),
+            &user.server_startup_parameters(),
         ]),
     );
 
-    // Convert the caller's HashMap snapshot into the BTreeMap shape
-    // ServerPool stores. The snapshot comes from the auth_query row used
-    // for this login, so TTL expiry or an interleaved refetch cannot
-    // change the overlay while the pool is created. Dedicated-mode pools
-    // should not reach this path, but keep the guard so a future caller
-    // cannot attach a per-user overlay to a shared backend pool.
-    let per_user_startup_overlay: std::sync::Arc<std::collections::BTreeMap<String, String>> = {
-        let is_dedicated = super::get_auth_query_state(pool_name)
-            .map(|state| state.config.is_dedicated_mode())
-            .unwrap_or(false);
-        if is_dedicated || fetched_overlay.is_empty() {
-            std::sync::Arc::new(std::collections::BTreeMap::new())
-        } else {
-            let map: std::collections::BTreeMap<String, String> = fetched_overlay
-                .iter()
-                .map(|(k, v)| (k.clone(), v.clone()))
-                .collect();
-            std::sync::Arc::new(map)
-        }
-    };
-
     let manager = ServerPool::new(
         address.clone(),
         user.clone(),
@@ -209,19 +295,17 @@ pub fn create_dynamic_pool(
         fallback_state,
         base_startup_parameters,
         per_user_startup_overlay.clone(),
-    );
-
-    // The auth_query cache compares the new fetched per-user map against
-    // this value after every refetch; a mismatch drops the dynamic pool
-    // so the next connect rebuilds with the new reset_val. The caller
-    // already has the hash precomputed on the `CacheEntry`, so we reuse
-    // it instead of re-running per_user_overlay_hash on the same map.
-    let overlay_hash = fetched_overlay_hash;
-
-    let queue_strategy = match config.general.server_round_robin {
-        true => QueueMode::Fifo,
-        false => QueueMode::Lifo,
-    };
+    )
+    .with_host_list(super::build_host_list(
+        pool_name,
+        pool_config,
+        &config.general,
+    ))
+    .with_connect_retry(super::build_connect_retry(pool_config))
+    .with_memory_limit(super::build_memory_limit(pool_config, &config.general))
+    .with_circuit_breaker(super::build_circuit_breaker(&config.general));
+
+    let queue_strategy = super::queue_mode(pool_config, &config.general);
 
     let pool = Pool::builder(manager)
         .coordinator(get_coordinator(pool_name))
@@ -236,13 +320,14 @@ pub fn create_dynamic_pool(
             },
             queue_mode: queue_strategy,
             scaling: pool_config.resolve_scaling_config(&config.general),
+            reserve: pool_config.resolve_reserve_config(),
         })
         .build();
 
     let conn_pool = ConnectionPool {
         database: pool,
         address,
-        config_hash: 0, // dynamic pools don't participate in hash-based reload
+        config_hash,
         per_user_startup_overlay_hash: overlay_hash,
         original_server_parameters: Arc::new(tokio::sync::Mutex::new(ServerParameters::new())),
         settings: PoolSettings {
@@ -257,6 +342,9 @@ pub fn create_dynamic_pool(
                 .unwrap_or(config.general.server_lifetime.as_millis()),
             sync_server_parameters: config.general.sync_server_parameters,
             min_guaranteed_pool_size: pool_config.min_guaranteed_pool_size.unwrap_or(0),
+            statement_rules: super::build_statement_rules(pool_config),
+            rewrite_rules: super::build_rewrite_rules(pool_config, &username),
+            server_version: pool_config.server_version.clone(),
         },
         prepared_statement_cache: match config.general.prepared_statements {
             false => None,
@@ -266,13 +354,14 @@ pub fn create_dynamic_pool(
             ))),
         },
         check_query_cache: Arc::new(CheckQueryCache::new()),
+        show_cache: Arc::new(DashMap::new()),
         coordinator: get_coordinator(pool_name),
         replenish_failures: Arc::new(AtomicU32::new(0)),
         init_complete: Arc::new(AtomicBool::new(false)),
     };
 
     // Atomic insert into POOLS
-    let identifier = PoolIdentifier::new(pool_name, username);
+    let identifier = PoolIdentifier::new(pool_name, &username);
     let current = POOLS.load();
     let mut new_pools = (**current).clone();
 
@@ -315,6 +404,7 @@ pub fn create_dynamic_pool(
                 BackendAuthMethod::Md5PassTheHash(_) => "md5-pass-the-hash",
                 BackendAuthMethod::ScramPassthrough(_) => "scram-passthrough",
                 BackendAuthMethod::ScramPending => "scram-pending",
+                BackendAuthMethod::ScramRelay => "scram-relay",
             }
         }
         None => "none",
@@ -325,9 +415,9 @@ pub fn create_dynamic_pool(
     register_dynamic_pool(&identifier);
 
     // Prewarm: spawn background task to create min_pool_size connections
-    if aq_config.min_pool_size > 0 {
+    if let Some(min) = conn_pool.settings.user.min_pool_size.filter(|&min| min > 0) {
         let pool_clone = conn_pool.clone();
-        let min = aq_config.min_pool_size as usize;
+        let min = min as usize;
         let pn = pool_name.to_string();
         let un = username.to_string();
         tokio::spawn(async move {
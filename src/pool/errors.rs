@@ -78,6 +78,25 @@ pub enum PoolError {
     DbLimitExhausted(NoConnectionInfo),
 }
 
+impl PoolError {
+    /// Whether a checkout that failed with this error can be repeated
+    /// without the client noticing: the backend could not be reached,
+    /// timed out, or was starting up or shutting down, so nothing was sent
+    /// to a server yet and another connection or host may do.
+    pub fn is_retriable_checkout(&self) -> bool {
+        match self {
+            Self::Timeout(TimeoutType::Create) => true,
+            Self::Backend(e) => matches!(
+                e,
+                Error::ConnectError(_)
+                    | Error::ServerUnavailableError(_, _)
+                    | Error::SocketError(_)
+            ),
+            _ => false,
+        }
+    }
+}
+
 impl From<Error> for PoolError {
     fn from(e: Error) -> Self {
         Self::Backend(e)
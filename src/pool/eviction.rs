@@ -85,11 +85,18 @@ impl pool_coordinator::EvictionSource for PoolEvictionSource {
             return false;
         }
 
-        // Slow pools (high p95 xact time) donate first — they tolerate
-        // the re-create cost better. 1ms of pool wait adds 6.7% to a
-        // 15ms p95 but 104% to a 0.96ms p95. Spare count as tiebreaker
-        // when p95 is equal or not yet computed (0).
-        candidates.sort_by(|a, b| b.3.cmp(&a.3).then_with(|| b.2.cmp(&a.2)));
+        // Low-priority users donate first. Within a priority, slow pools
+        // (high p95 xact time) donate first — they tolerate the re-create
+        // cost better. 1ms of pool wait adds 6.7% to a 15ms p95 but 104%
+        // to a 0.96ms p95. Spare count as tiebreaker when p95 is equal or
+        // not yet computed (0).
+        candidates.sort_by(|a, b| {
+            a.1.database
+                .priority()
+                .cmp(&b.1.database.priority())
+                .then_with(|| b.3.cmp(&a.3))
+                .then_with(|| b.2.cmp(&a.2))
+        });
 
         debug!(
             "[{requesting_user}@{}] eviction: {} candidate(s) with spare connections ({})",
@@ -161,6 +168,12 @@ impl pool_coordinator::EvictionSource for PoolEvictionSource {
             .unwrap_or(0)
     }
 
+    fn priority(&self, user: &str) -> u8 {
+        get_pool(&self.database, user)
+            .map(|p| p.database.priority())
+            .unwrap_or(0)
+    }
+
     fn is_starving(&self, user: &str) -> bool {
         get_pool(&self.database, user)
             .map(|p| {
@@ -172,11 +172,15 @@ mod tests {
                 life_time_ms: 60_000,
                 sync_server_parameters: false,
                 min_guaranteed_pool_size: 0,
+                statement_rules: None,
+                rewrite_rules: None,
+                server_version: None,
             },
             config_hash: 0,
             per_user_startup_overlay_hash: crate::pool::empty_overlay_hash(),
             prepared_statement_cache: None,
             check_query_cache: Arc::new(CheckQueryCache::new()),
+            show_cache: Arc::new(DashMap::new()),
             coordinator: None,
             replenish_failures: Arc::new(AtomicU32::new(0)),
             init_complete: Arc::new(AtomicBool::new(init_complete)),
@@ -18,6 +18,9 @@ use parking_lot::Mutex;
 
 use tokio::sync::{oneshot, Notify, Semaphore, SemaphorePermit, TryAcquireError};
 
+use super::circuit_breaker::{
+    counts_as_failure, Admission, CircuitBreaker, ProbeGuard, Transition,
+};
 use super::errors::{PoolError, RecycleError, TimeoutType};
 use super::pool_coordinator;
 use super::types::{Metrics, PoolConfig, QueueMode, Status, Timeouts};
@@ -47,6 +50,16 @@ struct ObjectInner {
     coordinator_permit: Option<pool_coordinator::CoordinatorPermit>,
 }
 
+/// Close connections taken out of the pool, tagging those without a close
+/// reason with `reason`. Returns how many were closed.
+fn close_evicted(evicted: Vec<ObjectInner>, reason: &'static str) -> usize {
+    let closed = evicted.len();
+    for mut obj in evicted {
+        obj.obj.set_close_reason(reason, None);
+    }
+    closed
+}
+
 /// Wrapper around the actual pooled object which implements Deref and DerefMut.
 /// When dropped, the object is returned to the pool.
 pub struct Object {
@@ -79,7 +92,9 @@ impl Drop for Object {
                         let mut slots = pool.slots.lock();
                         slots.size = slots.size.saturating_sub(1);
                     }
-                    pool.semaphore.add_permits(1);
+                    if !pool.release_reserve() && !pool.release_shrink() {
+                        pool.semaphore.add_permits(1);
+                    }
                     pool.notify_return_observers();
                 } else {
                     inner.metrics.recycled = Some(clock::now());
@@ -222,6 +237,8 @@ struct PoolInner {
     pool_name: String,
     /// Username for this pool, used in coordinator error messages.
     username: String,
+    /// Queue priority of this user at the coordinator (`users[].priority`).
+    priority: u8,
     /// Number of server connection creates currently in-flight on this pool.
     /// This is NOT the count of currently-held connections — only those being
     /// established right now via `server_pool.create()`. Bounded by
@@ -239,8 +256,24 @@ struct PoolInner {
     /// `MAX_CONCURRENT_PRE_REPLACEMENTS` to prevent a burst of expiring
     /// connections from spawning too many background creates at once.
     pre_replacements_in_flight: AtomicUsize,
+    /// Semaphore permits added beyond `max_size` for clients that waited
+    /// longer than `config.reserve.timeout`. Bounded by
+    /// `config.reserve.size`; each one is taken back when a connection
+    /// returns with nobody waiting.
+    reserve_in_use: AtomicUsize,
+    /// Semaphore permits still to be taken back after `resize` shrank the
+    /// pool while those permits were checked out. Each one is absorbed
+    /// when a connection returns instead of going back to the semaphore.
+    shrink_pending: AtomicUsize,
+    /// `timeouts.wait` in milliseconds, `NO_WAIT_TIMEOUT` when unset.
+    /// Kept outside `config` so `SET query_wait_timeout` and RELOAD can
+    /// change it on a live pool.
+    wait_timeout_ms: AtomicU64,
 }
 
+/// `wait_timeout_ms` value meaning "no wait timeout".
+const NO_WAIT_TIMEOUT: u64 = u64::MAX;
+
 enum RecycleOutcome {
     Reused(Box<ObjectInner>),
     Failed,
@@ -470,20 +503,27 @@ impl PoolInner {
         timeouts: &Timeouts,
         coordinator_permit: Option<pool_coordinator::CoordinatorPermit>,
     ) -> Result<ObjectInner, PoolError> {
-        let obj = match timeouts.create {
+        let breaker = self.server_pool.circuit_breaker();
+        let _probe = match breaker.map(CircuitBreaker::admit) {
+            Some(Admission::Reject(e)) => return Err(PoolError::Backend(e)),
+            Some(Admission::Probe) => breaker.map(ProbeGuard),
+            _ => None,
+        };
+
+        let result = match timeouts.create {
             Some(duration) => {
                 match tokio::time::timeout(duration, self.server_pool.create()).await {
-                    Ok(Ok(obj)) => obj,
-                    Ok(Err(e)) => return Err(PoolError::Backend(e)),
-                    Err(_) => return Err(PoolError::Timeout(TimeoutType::Create)),
+                    Ok(Ok(obj)) => Ok(obj),
+                    Ok(Err(e)) => Err(PoolError::Backend(e)),
+                    Err(_) => Err(PoolError::Timeout(TimeoutType::Create)),
                 }
             }
-            None => self
-                .server_pool
-                .create()
-                .await
-                .map_err(PoolError::Backend)?,
+            None => self.server_pool.create().await.map_err(PoolError::Backend),
         };
+        if let Some(breaker) = breaker {
+            self.record_connect_outcome(breaker, &result);
+        }
+        let obj = result?;
 
         {
             let mut slots = self.slots.lock();
@@ -493,6 +533,41 @@ impl PoolInner {
         Ok(self.new_object_inner(obj, coordinator_permit))
     }
 
+    /// Feeds the outcome of a connect into the circuit breaker and logs
+    /// its state changes.
+    fn record_connect_outcome(&self, breaker: &CircuitBreaker, result: &Result<Server, PoolError>) {
+        let transition = match result {
+            Ok(_) => breaker.record_success(),
+            Err(PoolError::Backend(e)) if !counts_as_failure(e) => return,
+            Err(e) => breaker.record_failure(&e.to_string()),
+        };
+        match transition {
+            Transition::Opened => {
+                warn!(
+                    "[{}@{}] circuit breaker open: failing checkouts that need a new server \
+                     connection for {}s (last error: {})",
+                    self.username,
+                    self.pool_name,
+                    breaker.cooldown().as_secs(),
+                    result
+                        .as_ref()
+                        .err()
+                        .map(ToString::to_string)
+                        .unwrap_or_default(),
+                );
+                crate::web::metrics::record_circuit_breaker_trip(&self.username, &self.pool_name);
+            }
+            Transition::Closed => {
+                log::info!(
+                    "[{}@{}] circuit breaker closed: server connection established",
+                    self.username,
+                    self.pool_name,
+                );
+            }
+            Transition::None => {}
+        }
+    }
+
     /// Returns true when every permit is in use — clients are either holding
     /// connections or queued behind the semaphore. Used to suppress lifetime
     /// housekeeping (`recycle` lifetime expiry, retain-loop trimming) so we
@@ -572,6 +647,16 @@ impl PoolInner {
             }
         }
 
+        // No waiters and the pool is above pool_size (reserve) or above a
+        // size it was shrunk to: close the connection instead of keeping it
+        // idle, and keep its permit.
+        if self.release_reserve() || self.release_shrink() {
+            slots.size = slots.size.saturating_sub(1);
+            drop(slots);
+            drop(inner);
+            return;
+        }
+
         // No waiters — normal path.
         push_idle(self.config.queue_mode, &mut slots.vec, inner);
         drop(slots);
@@ -579,6 +664,50 @@ impl PoolInner {
         self.notify_return_observers();
     }
 
+    /// Let one more client past the semaphore when the reserve has room.
+    fn try_grow_reserve(&self) -> bool {
+        let grown = self
+            .reserve_in_use
+            .fetch_update(Ordering::AcqRel, Ordering::Acquire, |n| {
+                (n < self.config.reserve.size).then_some(n + 1)
+            })
+            .is_ok();
+        if grown {
+            self.semaphore.add_permits(1);
+            log::info!(
+                "[{}@{}] pool is full for {}ms, using reserve connection ({}/{})",
+                self.username,
+                self.pool_name,
+                self.config.reserve.timeout.as_millis(),
+                self.reserve_in_use.load(Ordering::Relaxed),
+                self.config.reserve.size,
+            );
+        }
+        grown
+    }
+
+    /// Take back one reserve permit. Returns false when the pool is within
+    /// `max_size`, so the caller returns the permit to the semaphore.
+    #[inline(always)]
+    fn release_reserve(&self) -> bool {
+        self.reserve_in_use.load(Ordering::Relaxed) > 0
+            && self
+                .reserve_in_use
+                .fetch_update(Ordering::AcqRel, Ordering::Acquire, |n| n.checked_sub(1))
+                .is_ok()
+    }
+
+    /// Take back one permit owed by a shrinking `resize`. Returns false
+    /// when nothing is owed.
+    #[inline(always)]
+    fn release_shrink(&self) -> bool {
+        self.shrink_pending.load(Ordering::Relaxed) > 0
+            && self
+                .shrink_pending
+                .fetch_update(Ordering::AcqRel, Ordering::Acquire, |n| n.checked_sub(1))
+                .is_ok()
+    }
+
     /// Wake peer-pool coordinator waiter after a connection lands in
     /// `slots.vec` (the no-waiter path of `return_object`). The coordinator
     /// Phase C waiter scans this pool's idle vec via `evict_one_idle` and
@@ -768,8 +897,9 @@ impl Pool {
             return Ok(CoordinatorJitResult::Create { permit: None, gate });
         };
 
-        // Fast path: non-blocking CAS.
-        if let Some(p) = coordinator.try_acquire() {
+        // Fast path: non-blocking CAS, unless a higher-priority user is
+        // already waiting for a permit.
+        if let Some(p) = coordinator.try_acquire_ranked(self.inner.priority) {
             debug!(
                 "[{}@{}] coordinator: permit via fast JIT path \
                  (permit_type=main)",
@@ -784,10 +914,16 @@ impl Pool {
         // Slow path: release gate slot so peers can create while we wait.
         drop(gate);
         let eviction = super::PoolEvictionSource::new(&self.inner.pool_name);
-        let p = match coordinator
+        let wait_start = tokio::time::Instant::now();
+        let acquired = coordinator
             .acquire(&self.inner.pool_name, &self.inner.username, &eviction)
-            .await
-        {
+            .await;
+        crate::web::metrics::observe_coordinator_wait(
+            &self.inner.pool_name,
+            self.inner.priority,
+            wait_start.elapsed().as_secs_f64(),
+        );
+        let p = match acquired {
             Ok(p) => p,
             Err(pool_coordinator::AcquireError::NoConnection(info)) => {
                 let slots = self.inner.slots.lock();
@@ -828,7 +964,9 @@ impl Pool {
         }
     }
 
-    /// Block if the pool is paused, waiting for resume or timeout.
+    /// Block if the pool is paused, waiting for resume or timeout. A held
+    /// pool (`HOLD`) is waited out regardless of the wait timeout: the
+    /// hold ends by itself after `hold_timeout`.
     ///
     /// IMPORTANT: `resume_notified()` must be called BEFORE `is_paused()`
     /// to avoid a race where RESUME fires between the two calls and the
@@ -836,7 +974,12 @@ impl Pool {
     async fn wait_if_paused(&self, timeouts: &Timeouts) -> Result<(), PoolError> {
         let resume_notify = self.inner.server_pool.resume_notified();
         if self.inner.server_pool.is_paused() {
-            match timeouts.wait {
+            let wait = if self.inner.server_pool.is_held() {
+                None
+            } else {
+                timeouts.wait
+            };
+            match wait {
                 Some(duration) => {
                     if tokio::time::timeout(duration, resume_notify).await.is_err() {
                         return Err(PoolError::Timeout(TimeoutType::Wait));
@@ -874,7 +1017,27 @@ impl Pool {
                     TryAcquireError::NoPermits => PoolError::Timeout(TimeoutType::Wait),
                 })
             } else {
+                let reserve = self.inner.config.reserve;
                 match timeouts.wait {
+                    Some(duration) if reserve.size > 0 && reserve.timeout < duration => {
+                        // Wait reserve.timeout for a regular permit, then
+                        // grow into the reserve and keep waiting on the same
+                        // acquire, so the client stays in its queue position.
+                        let deadline = tokio::time::Instant::now() + duration;
+                        let acquire = self.inner.semaphore.acquire();
+                        tokio::pin!(acquire);
+                        if let Ok(result) =
+                            tokio::time::timeout(reserve.timeout, &mut acquire).await
+                        {
+                            return result.map_err(|_| PoolError::Closed);
+                        }
+                        self.inner.try_grow_reserve();
+                        match tokio::time::timeout_at(deadline, acquire).await {
+                            Ok(Ok(p)) => Ok(p),
+                            Ok(Err(_)) => Err(PoolError::Closed),
+                            Err(_) => Err(PoolError::Timeout(TimeoutType::Wait)),
+                        }
+                    }
                     Some(duration) => {
                         match tokio::time::timeout(duration, self.inner.semaphore.acquire()).await {
                             Ok(Ok(p)) => Ok(p),
@@ -1012,14 +1175,24 @@ impl Pool {
                 }),
                 users: AtomicUsize::new(0),
                 semaphore: Semaphore::new(builder.config.max_size),
+                wait_timeout_ms: AtomicU64::new(
+                    builder
+                        .config
+                        .timeouts
+                        .wait
+                        .map_or(NO_WAIT_TIMEOUT, |t| t.as_millis() as u64),
+                ),
                 config: builder.config,
                 coordinator: builder.coordinator,
                 pool_name: builder.pool_name,
                 username: builder.username,
+                priority: builder.priority,
                 inflight_creates: AtomicUsize::new(0),
                 create_done: Notify::new(),
                 scaling_stats: ScalingStats::default(),
                 pre_replacements_in_flight: AtomicUsize::new(0),
+                reserve_in_use: AtomicUsize::new(0),
+                shrink_pending: AtomicUsize::new(0),
             }),
         }
     }
@@ -1119,38 +1292,47 @@ impl Pool {
     }
 
     /// Resizes the pool.
+    ///
+    /// Shrinking closes idle connections above the new size and takes
+    /// back free semaphore permits; permits held by checked-out
+    /// connections are taken back as those connections return, which
+    /// closes them. Growing first cancels such pending take-backs.
     pub fn resize(&self, max_size: usize) {
-        let mut slots = self.inner.slots.lock();
-        let old_max_size = slots.max_size;
-        slots.max_size = max_size;
-
-        // Shrink pool
-        if max_size < old_max_size {
-            while slots.vec.len() > max_size {
-                if slots.vec.pop_back().is_some() {
-                    slots.size = slots.size.saturating_sub(1);
+        let evicted: Vec<ObjectInner> = {
+            let mut slots = self.inner.slots.lock();
+            let old_max_size = slots.max_size;
+            slots.max_size = max_size;
+            let mut evicted = Vec::new();
+
+            // Shrink pool
+            if max_size < old_max_size {
+                while slots.size > max_size {
+                    let Some(obj) = slots.vec.pop_back() else {
+                        break;
+                    };
+                    slots.size -= 1;
+                    evicted.push(obj);
                 }
+                let excess = old_max_size - max_size;
+                let forgotten = self.inner.semaphore.forget_permits(excess);
+                self.inner
+                    .shrink_pending
+                    .fetch_add(excess - forgotten, Ordering::AcqRel);
             }
-            // Reduce semaphore permits
-            let permits_to_remove = old_max_size - max_size;
-            let _ = self
-                .inner
-                .semaphore
-                .try_acquire_many(permits_to_remove as u32);
-            // Reallocate vec
-            let mut vec = VecDeque::with_capacity(max_size);
-            for obj in slots.vec.drain(..) {
-                vec.push_back(obj);
-            }
-            slots.vec = vec;
-        }
 
-        // Grow pool
-        if max_size > old_max_size {
-            let additional = max_size - old_max_size;
-            slots.vec.reserve_exact(additional);
-            self.inner.semaphore.add_permits(additional);
-        }
+            // Grow pool
+            if max_size > old_max_size {
+                let mut additional = max_size - old_max_size;
+                while additional > 0 && self.inner.release_shrink() {
+                    additional -= 1;
+                }
+                slots.vec.reserve(additional);
+                self.inner.semaphore.add_permits(additional);
+            }
+            evicted
+        };
+        // Close evicted servers outside the slots lock, as `retain` does.
+        close_evicted(evicted, "pool_resize");
     }
 
     /// Retains only the objects specified by the given function.
@@ -1161,7 +1343,9 @@ impl Pool {
     /// `CoordinatorPermit::drop` (a tokio `Notify::notify_one` that itself
     /// briefly takes an internal mutex). Holding `slots.lock()` across these
     /// blocks any peer caller trying to recycle from the same pool.
-    pub fn retain(&self, f: impl Fn(&Server, Metrics) -> bool) {
+    ///
+    /// `reason` is the close reason logged for evicted connections.
+    pub fn retain(&self, reason: &'static str, f: impl Fn(&Server, Metrics) -> bool) {
         let evicted: Vec<ObjectInner> = {
             let mut guard = self.inner.slots.lock();
             // Common case on a healthy retain cycle: nothing to evict.
@@ -1183,7 +1367,7 @@ impl Pool {
             evicted
         };
         // Lock released here. Syscalls and notify_one fire below, off-lock.
-        drop(evicted);
+        close_evicted(evicted, reason);
     }
 
     /// Retains connections, closing oldest first when max limit is set.
@@ -1196,6 +1380,7 @@ impl Pool {
     /// on PG `Terminate` syscalls or coordinator wake-ups.
     pub fn retain_oldest_first(
         &self,
+        reason: &'static str,
         should_close: impl Fn(&Server, &Metrics) -> bool,
         max_to_close: usize,
     ) -> usize {
@@ -1264,10 +1449,8 @@ impl Pool {
                 evicted
             }
         };
-        let closed = evicted.len();
         // Lock released here. Drops below run off-lock.
-        drop(evicted);
-        closed
+        close_evicted(evicted, reason)
     }
 
     /// Evict the oldest idle connection whose age exceeds `min_lifetime_ms`.
@@ -1279,6 +1462,7 @@ impl Pool {
     /// Returns `true` if a connection was evicted.
     pub fn evict_one_idle(&self, min_lifetime_ms: u64) -> bool {
         self.retain_oldest_first(
+            "coordinator_eviction",
             |_, metrics| metrics.age().as_millis() >= u128::from(min_lifetime_ms),
             1,
         ) > 0
@@ -1383,16 +1567,29 @@ impl Pool {
             guard.size -= evicted.len();
             evicted
         };
-        let closed = evicted.len();
         // Lock released here. Reserve permit drops fire below.
-        drop(evicted);
-        closed
+        close_evicted(evicted, "reserve_expired")
     }
 
     /// Get current timeout configuration.
     #[inline(always)]
     pub fn timeouts(&self) -> Timeouts {
-        self.inner.config.timeouts
+        let mut timeouts = self.inner.config.timeouts;
+        timeouts.wait = match self.inner.wait_timeout_ms.load(Ordering::Relaxed) {
+            NO_WAIT_TIMEOUT => None,
+            ms => Some(Duration::from_millis(ms)),
+        };
+        timeouts
+    }
+
+    /// Replace the wait timeout used by [`Pool::get`] and by the fallback
+    /// path. Checkouts already waiting keep the timeout they started with.
+    pub fn set_wait_timeout(&self, wait: Option<Duration>) {
+        let ms = wait.map_or(NO_WAIT_TIMEOUT, |t| t.as_millis() as u64);
+        self.inner.wait_timeout_ms.store(ms, Ordering::Relaxed);
+        if let Some(wait) = wait {
+            self.inner.server_pool.set_query_wait_timeout(wait);
+        }
     }
 
     /// Creates new connections to bring the pool up to the desired count.
@@ -1489,6 +1686,11 @@ impl Pool {
         self.inner.semaphore.is_closed()
     }
 
+    /// Queue priority of this pool's user at the coordinator.
+    pub fn priority(&self) -> u8 {
+        self.inner.priority
+    }
+
     /// Retrieves Status of this Pool.
     #[must_use]
     pub fn status(&self) -> Status {
@@ -1545,6 +1747,28 @@ impl Pool {
         self.inner.server_pool.is_paused()
     }
 
+    /// Holds the pool — new checkouts queue until [`Self::release_hold`]
+    /// or `RESUME`. Returns the hold generation.
+    pub fn hold(&self) -> u64 {
+        self.inner.server_pool.hold()
+    }
+
+    /// Ends the hold `generation` unless a later command replaced it.
+    pub fn release_hold(&self, generation: u64) -> bool {
+        self.inner.server_pool.release_hold(generation)
+    }
+
+    /// Returns whether the pool is held.
+    pub fn is_held(&self) -> bool {
+        self.inner.server_pool.is_held()
+    }
+
+    /// Number of server connections checked out by clients.
+    pub fn in_use(&self) -> usize {
+        let slots = self.inner.slots.lock();
+        slots.size.saturating_sub(slots.vec.len())
+    }
+
     /// Effective merged startup_parameters cascade keyed by parameter, with
     /// the layer that contributed each winning value. Delegates to
     /// `ServerPool` so admin `SHOW STARTUP_PARAMETERS` and the
@@ -1569,10 +1793,15 @@ impl Pool {
     pub fn reconnect(&self) -> u32 {
         let new_epoch = self.inner.server_pool.bump_epoch();
         // Drain all idle connections — they have the old epoch
-        self.retain(|_, _| false);
+        self.retain("admin_reconnect", |_, _| false);
         new_epoch
     }
 
+    /// Ordered backend host list of the underlying server pool.
+    pub fn host_list(&self) -> Option<&std::sync::Arc<super::multi_host::HostList>> {
+        self.inner.server_pool.host_list()
+    }
+
     /// Returns the current reconnect epoch.
     pub fn reconnect_epoch(&self) -> u32 {
         self.inner.server_pool.current_epoch()
@@ -1709,6 +1938,7 @@ pub struct PoolBuilder {
     coordinator: Option<Arc<pool_coordinator::PoolCoordinator>>,
     pool_name: String,
     username: String,
+    priority: u8,
 }
 
 impl PoolBuilder {
@@ -1719,6 +1949,7 @@ impl PoolBuilder {
             coordinator: None,
             pool_name: String::new(),
             username: String::new(),
+            priority: 0,
         }
     }
 
@@ -1749,6 +1980,12 @@ impl PoolBuilder {
         self
     }
 
+    /// Sets the queue priority used when competing for coordinator permits.
+    pub fn priority(mut self, priority: u8) -> Self {
+        self.priority = priority;
+        self
+    }
+
     /// Builds the Pool.
     pub fn build(self) -> Pool {
         Pool::from_builder(self)
@@ -2080,10 +2317,18 @@ mod tests {
     /// real backend connection — it only exercises the in-memory notify
     /// machinery on the resulting `PoolInner`.
     fn test_pool_with_coordinator(coord: Arc<pool_coordinator::PoolCoordinator>) -> Pool {
+        Pool::builder(test_server_pool())
+            .coordinator(Some(coord))
+            .pool_name("test_db".to_string())
+            .username("test_user".to_string())
+            .build()
+    }
+
+    fn test_server_pool() -> ServerPool {
         use crate::config::{Address, User};
         use dashmap::DashMap;
 
-        let server_pool = ServerPool::new(
+        ServerPool::new(
             Address::default(),
             User::default(),
             "test_db",
@@ -2102,12 +2347,71 @@ mod tests {
             None,
             Arc::new(std::collections::BTreeMap::new()),
             Arc::new(std::collections::BTreeMap::new()),
+        )
+    }
+
+    #[tokio::test]
+    async fn hold_outlasts_wait_timeout_until_released() {
+        let pool = Pool::builder(test_server_pool()).build();
+        let timeouts = Timeouts {
+            wait: Some(Duration::from_millis(20)),
+            create: None,
+            recycle: None,
+        };
+
+        let stale = pool.hold();
+        let generation = pool.hold();
+        assert!(pool.is_paused() && pool.is_held());
+        assert!(
+            !pool.release_hold(stale),
+            "an earlier hold must not end a later one"
         );
-        Pool::builder(server_pool)
-            .coordinator(Some(coord))
-            .pool_name("test_db".to_string())
-            .username("test_user".to_string())
-            .build()
+
+        let waiter = {
+            let pool = pool.clone();
+            tokio::spawn(async move { pool.wait_if_paused(&timeouts).await })
+        };
+        tokio::time::sleep(Duration::from_millis(100)).await;
+        assert!(!waiter.is_finished(), "a held checkout must not time out");
+
+        assert!(pool.release_hold(generation));
+        assert!(waiter.await.unwrap().is_ok());
+        assert!(!pool.is_paused() && !pool.is_held());
+
+        // PAUSE turns a hold into a pause the hold timer does not end.
+        let generation = pool.hold();
+        pool.pause();
+        assert!(!pool.release_hold(generation));
+        assert!(pool.is_paused() && !pool.is_held());
+        assert!(matches!(
+            pool.wait_if_paused(&timeouts).await,
+            Err(PoolError::Timeout(TimeoutType::Wait))
+        ));
+    }
+
+    #[test]
+    fn resize_takes_back_checked_out_permits_later() {
+        let pool = Pool::builder(test_server_pool())
+            .config(PoolConfig::new(4))
+            .build();
+        // Three connections checked out, one permit free.
+        pool.inner.semaphore.try_acquire_many(3).unwrap().forget();
+
+        pool.resize(2);
+        assert_eq!(pool.inner.semaphore.available_permits(), 0);
+        assert_eq!(pool.inner.shrink_pending.load(Ordering::Acquire), 1);
+
+        // Growing cancels the pending take-back before adding permits.
+        pool.resize(3);
+        assert_eq!(pool.inner.shrink_pending.load(Ordering::Acquire), 0);
+        assert_eq!(pool.inner.semaphore.available_permits(), 0);
+
+        pool.resize(1);
+        assert_eq!(pool.inner.shrink_pending.load(Ordering::Acquire), 2);
+        assert!(pool.inner.release_shrink());
+        assert!(pool.inner.release_shrink());
+        assert!(!pool.inner.release_shrink());
+        assert_eq!(pool.status().max_size, 1);
     }
 
     /// `notify_return_observers` wakes the peer-pool coordinator Phase C
@@ -2318,6 +2622,48 @@ mod tests {
         );
     }
 
+    // ------------------------------------------------------------------
+    // Reserve pool — reserve_pool_size without max_db_connections
+    // ------------------------------------------------------------------
+
+    /// A client that waits longer than `reserve.timeout` gets a permit
+    /// beyond `max_size`; at most `reserve.size` such permits exist, and
+    /// each is taken back exactly once.
+    #[tokio::test]
+    async fn reserve_grows_after_timeout_and_is_bounded() {
+        let pool = Pool::builder(test_server_pool())
+            .config(PoolConfig {
+                reserve: crate::pool::ReserveConfig {
+                    size: 1,
+                    timeout: Duration::from_millis(20),
+                },
+                ..PoolConfig::new(1)
+            })
+            .build();
+        let timeouts = Timeouts {
+            wait: Some(Duration::from_millis(300)),
+            create: None,
+            recycle: None,
+        };
+
+        let regular = pool.acquire_semaphore(&timeouts).await.unwrap();
+        let start = tokio::time::Instant::now();
+        let reserve = pool.acquire_semaphore(&timeouts).await.unwrap();
+        assert!(start.elapsed() >= Duration::from_millis(20));
+        assert_eq!(pool.inner.reserve_in_use.load(Ordering::Relaxed), 1);
+
+        // Reserve exhausted: the third client times out.
+        assert!(matches!(
+            pool.acquire_semaphore(&timeouts).await,
+            Err(PoolError::Timeout(TimeoutType::Wait))
+        ));
+
+        drop(reserve);
+        drop(regular);
+        assert!(pool.inner.release_reserve());
+        assert!(!pool.inner.release_reserve());
+    }
+
     // ------------------------------------------------------------------
     // Direct handoff — oneshot channel mechanics
     // ------------------------------------------------------------------
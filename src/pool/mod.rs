@@ -1,4 +1,5 @@
 use arc_swap::ArcSwap;
+use bytes::Bytes;
 use dashmap::DashMap;
 use log::{debug, info};
 use once_cell::sync::{Lazy, OnceCell};
@@ -9,7 +10,8 @@ use std::sync::atomic::{AtomicBool, AtomicU32, AtomicU64, Ordering};
 use std::sync::Arc;
 
 use crate::config::{
-    get_config, tls, Address, BackendAuthMethod, General, Pool as ConfigPool, PoolMode, User,
+    compile_rewrite_rules, get_config, tls, Address, BackendAuthMethod, CompiledRewrite, General,
+    Pool as ConfigPool, PoolMode, StatementRules, User, WILDCARD_USER,
 };
 use crate::errors::Error;
 use crate::messages::Parse;
@@ -22,28 +24,37 @@ mod errors;
 mod inner;
 mod types;
 
-pub use errors::{PoolError, RecycleError, RecycleResult};
+pub use errors::{PoolError, RecycleError, RecycleResult, TimeoutType};
 pub use inner::{Object, Pool, PoolBuilder, ScalingStatsSnapshot};
-pub use types::{Metrics, PoolConfig, QueueMode, ScalingConfig, Status, Timeouts};
+pub use types::{Metrics, PoolConfig, QueueMode, ReserveConfig, ScalingConfig, Status, Timeouts};
 
 pub use crate::server::PreparedStatementCache;
 
+pub mod adaptive;
 mod auth_query_state;
+pub mod autodb;
+mod backend_memory;
 mod check_query_cache;
+mod circuit_breaker;
+mod connect_retry;
+pub mod dns;
 mod dynamic;
 mod eviction;
 pub mod gc;
 mod init_guard;
+pub mod multi_host;
 pub mod pool_coordinator;
 pub mod retain;
+pub mod scheduled_recycle;
 mod server_pool;
+pub mod srv;
 pub mod startup_resolver;
 
 pub mod fallback;
 
 pub use auth_query_state::AuthQueryState;
 pub use check_query_cache::CheckQueryCache;
-pub use dynamic::create_dynamic_pool;
+pub use dynamic::{create_dynamic_pool, create_wildcard_user_pool};
 pub use eviction::PoolEvictionSource;
 pub use init_guard::PoolInitGuard;
 pub use server_pool::ServerPool;
@@ -57,7 +68,8 @@ pub type ServerPort = u16;
 #[derive(Debug, Clone)]
 pub struct CancelTarget {
     pub process_id: ProcessId,
-    pub secret_key: SecretKey,
+    /// Backend secret key: 4 bytes, or up to 256 with protocol 3.2.
+    pub secret_key: Bytes,
     pub host: ServerHost,
     pub port: ServerPort,
     pub server_tls: Arc<tls::ServerTlsConfig>,
@@ -145,6 +157,11 @@ pub(crate) fn build_server_tls_for_pool(
         .as_deref()
         .unwrap_or(&general.server_tls_mode);
     let mode = mode_str.parse::<tls::ServerTlsMode>()?;
+    let negotiation = pool_config
+        .server_tls_negotiation
+        .as_deref()
+        .unwrap_or(&general.server_tls_negotiation)
+        .parse::<tls::ServerTlsNegotiation>()?;
 
     let ca = pool_config
         .server_tls_ca_cert
@@ -161,6 +178,7 @@ pub(crate) fn build_server_tls_for_pool(
 
     let config = tls::ServerTlsConfig::new(
         mode,
+        negotiation,
         ca.map(|s| std::path::Path::new(s.as_str())),
         cert.map(|s| std::path::Path::new(s.as_str())),
         key.map(|s| std::path::Path::new(s.as_str())),
@@ -281,6 +299,15 @@ pub struct PoolSettings {
     /// Pool-level minimum connections protected from coordinator eviction.
     /// Effective protection = max(user.min_pool_size, this value).
     pub min_guaranteed_pool_size: u32,
+
+    /// Compiled `statement_deny` / `statement_allow`; None without rules.
+    pub statement_rules: Option<Arc<StatementRules>>,
+
+    /// Compiled `rewrite_rules` that apply to `user`; None without any.
+    pub rewrite_rules: Option<Arc<Vec<CompiledRewrite>>>,
+
+    /// `server_version` reported to clients in place of the backend's.
+    pub server_version: Option<String>,
 }
 
 impl Default for PoolSettings {
@@ -293,10 +320,27 @@ impl Default for PoolSettings {
             life_time_ms: General::default_server_lifetime().as_millis(),
             sync_server_parameters: General::default_sync_server_parameters(),
             min_guaranteed_pool_size: 0,
+            statement_rules: None,
+            rewrite_rules: None,
+            server_version: None,
         }
     }
 }
 
+impl PoolSettings {
+    /// Effective `idle_timeout` of the pool's connections, in
+    /// milliseconds; 0 when disabled.
+    pub fn idle_timeout_ms(&self) -> u64 {
+        self.idle_timeout_ms
+    }
+
+    /// Effective `server_lifetime` of the pool's connections, in
+    /// milliseconds; 0 when disabled.
+    pub fn server_lifetime_ms(&self) -> u64 {
+        self.life_time_ms
+    }
+}
+
 /// The globally accessible connection pool.
 #[derive(Clone, Debug)]
 pub struct ConnectionPool {
@@ -335,6 +379,11 @@ pub struct ConnectionPool {
     /// self-invalidates when `general.pooler_check_query` changes via RELOAD.
     pub check_query_cache: Arc<CheckQueryCache>,
 
+    /// Values of `general.show_local_parameters` that PostgreSQL does not
+    /// report in ParameterStatus, by lower-case name. Filled by the first
+    /// `SHOW` of each such parameter that reaches the backend.
+    pub show_cache: Arc<DashMap<String, String>>,
+
     /// Database-level connection coordinator. `Some` when `max_db_connections > 0`
     /// in the pool config, `None` otherwise (disabled, zero overhead).
     /// Shared across all user pools for the same database.
@@ -413,12 +462,7 @@ impl ConnectionPool {
         // pinned to the previous `reset_val` until the connection rotates
         // through `lifetime_ms`, so clients would see mixed defaults from
         // the same pool depending on which backend they got.
-        let general_startup_hash = {
-            use std::hash::{Hash, Hasher};
-            let mut hasher = std::collections::hash_map::DefaultHasher::new();
-            config.general.startup_parameters.hash(&mut hasher);
-            hasher.finish()
-        };
+        let general_startup_hash = general_startup_hash(&config.general);
         // Load only; the hash is not advanced until the new pool map has
         // been committed at the bottom of from_config. Otherwise a reload
         // that fails halfway poisons the hash, and the next reload of the
@@ -431,17 +475,15 @@ impl ConnectionPool {
         let general_startup_parameters_changed = previous_general_startup_hash != 0
             && previous_general_startup_hash != general_startup_hash;
         for (pool_name, pool_config) in &config.pools {
-            let new_pool_hash_value = {
-                use std::hash::Hasher;
-                let mut hasher = std::collections::hash_map::DefaultHasher::new();
-                hasher.write_u64(pool_config.hash_value());
-                hasher.write_u64(general_startup_hash);
-                hasher.finish()
-            };
+            let new_pool_hash_value = pool_config_hash(pool_config, general_startup_hash);
             let server_tls_config = build_server_tls_for_pool(pool_config, &config.general)?;
 
             // There is one pool per database/user pair.
             for user in &pool_config.users {
+                // Pools for the "*" user are created per client at login.
+                if user.username == WILDCARD_USER {
+                    continue;
+                }
                 let old_pool_ref = get_pool(pool_name, &user.username);
                 let identifier = PoolIdentifier::new(pool_name, &user.username);
 
@@ -473,43 +515,13 @@ impl ConnectionPool {
                     .clone()
                     .unwrap_or(pool_name.clone().to_string());
 
-                // Detect passthrough-eligible static users:
-                // server_password is None AND (server_username is None OR equals username)
-                let backend_auth = if user.server_password.is_none()
-                    && (user.server_username.is_none()
-                        || user.server_username.as_deref() == Some(&user.username))
-                {
-                    if user
-                        .password
-                        .starts_with(crate::messages::constants::MD5_PASSWORD_PREFIX)
-                    {
-                        info!(
-                            "[{}@{}] static passthrough: MD5 pass-the-hash",
-                            user.username, pool_name
-                        );
-                        Some(Arc::new(RwLock::new(BackendAuthMethod::Md5PassTheHash(
-                            user.password.clone(),
-                        ))))
-                    } else if user
-                        .password
-                        .starts_with(crate::messages::constants::SCRAM_SHA_256)
-                    {
-                        info!(
-                            "[{}@{}] static passthrough: SCRAM pending",
-                            user.username, pool_name
-                        );
-                        Some(Arc::new(RwLock::new(BackendAuthMethod::ScramPending)))
-                    } else {
-                        None
-                    }
-                } else {
-                    None
-                };
+                let backend_auth = passthrough_backend_auth(user, pool_name);
 
+                let (server_host, server_port) = pool_config.primary_server();
                 let address = Address {
                     database: pool_name.clone(),
-                    host: pool_config.server_host.clone(),
-                    port: pool_config.server_port,
+                    host: server_host,
+                    port: server_port,
                     username: user.username.clone(),
                     password: user.password.clone(),
                     pool_name: pool_name.clone(),
@@ -553,7 +565,8 @@ impl ConnectionPool {
                 let base_startup_parameters = Arc::new(
                     crate::config::startup_parameters::cascade_canonical_keys(&[
                         &config.general.startup_parameters,
-                        &pool_config.startup_parameters,
+                        &pool_config.server_startup_parameters(),
+                        &user.server_startup_parameters(),
                     ]),
                 );
 
@@ -581,17 +594,19 @@ impl ConnectionPool {
                     base_startup_parameters,
                     // Static pools carry no per-user auth_query overlay.
                     Arc::new(std::collections::BTreeMap::new()),
-                );
+                )
+                .with_host_list(build_host_list(pool_name, pool_config, &config.general))
+                .with_connect_retry(build_connect_retry(pool_config))
+                .with_memory_limit(build_memory_limit(pool_config, &config.general))
+                .with_circuit_breaker(build_circuit_breaker(&config.general));
 
-                let queue_strategy = match config.general.server_round_robin {
-                    true => QueueMode::Fifo,
-                    false => QueueMode::Lifo,
-                };
+                let queue_strategy = queue_mode(pool_config, &config.general);
 
                 let mut builder_config = Pool::builder(manager)
                     .coordinator(coordinators.get(pool_name).cloned())
                     .pool_name(pool_name.clone())
-                    .username(user.username.clone());
+                    .username(user.username.clone())
+                    .priority(user.priority.unwrap_or(0));
                 builder_config = builder_config.config(PoolConfig {
                     max_size: user.pool_size as usize,
                     timeouts: Timeouts {
@@ -601,6 +616,7 @@ impl ConnectionPool {
                     },
                     queue_mode: queue_strategy,
                     scaling: pool_config.resolve_scaling_config(&config.general),
+                    reserve: pool_config.resolve_reserve_config(),
                 });
 
                 let pool = builder_config.build();
@@ -629,6 +645,9 @@ impl ConnectionPool {
                             .unwrap_or(config.general.server_lifetime.as_millis()),
                         sync_server_parameters: config.general.sync_server_parameters,
                         min_guaranteed_pool_size: pool_config.min_guaranteed_pool_size.unwrap_or(0),
+                        statement_rules: build_statement_rules(pool_config),
+                        rewrite_rules: build_rewrite_rules(pool_config, &user.username),
+                        server_version: pool_config.server_version.clone(),
                     },
                     prepared_statement_cache: match config.general.prepared_statements {
                         false => None,
@@ -638,6 +657,7 @@ impl ConnectionPool {
                         ))),
                     },
                     check_query_cache: Arc::new(CheckQueryCache::new()),
+                    show_cache: Arc::new(DashMap::new()),
                     coordinator: coordinators.get(pool_name).cloned(),
                     replenish_failures: Arc::new(AtomicU32::new(0)),
                     init_complete: Arc::new(AtomicBool::new(true)),
@@ -661,7 +681,7 @@ impl ConnectionPool {
                 let pool_startup_hash = {
                     use std::hash::{Hash, Hasher};
                     let mut hasher = std::collections::hash_map::DefaultHasher::new();
-                    pool_config.startup_parameters.hash(&mut hasher);
+                    pool_config.server_startup_parameters().hash(&mut hasher);
                     hasher.finish()
                 };
                 // Parent fingerprint folds every other parent input the
@@ -731,10 +751,11 @@ impl ConnectionPool {
                         let server_tls_config =
                             build_server_tls_for_pool(pool_config, &config.general)?;
 
+                        let (server_host, server_port) = pool_config.primary_server();
                         let address = Address {
                             database: pool_name.clone(),
-                            host: pool_config.server_host.clone(),
-                            port: pool_config.server_port,
+                            host: server_host,
+                            port: server_port,
                             username: shared_user.username.clone(),
                             password: shared_user.password.clone(),
                             pool_name: pool_name.clone(),
@@ -770,7 +791,7 @@ impl ConnectionPool {
                         let base_startup_parameters = Arc::new(
                             crate::config::startup_parameters::cascade_canonical_keys(&[
                                 &config.general.startup_parameters,
-                                &pool_config.startup_parameters,
+                                &pool_config.server_startup_parameters(),
                             ]),
                         );
 
@@ -799,12 +820,13 @@ impl ConnectionPool {
                             // Dedicated-mode shared pool serves multiple
                             // dynamic users — no single per-user override.
                             Arc::new(std::collections::BTreeMap::new()),
-                        );
+                        )
+                        .with_host_list(build_host_list(pool_name, pool_config, &config.general))
+                        .with_connect_retry(build_connect_retry(pool_config))
+                        .with_memory_limit(build_memory_limit(pool_config, &config.general))
+                        .with_circuit_breaker(build_circuit_breaker(&config.general));
 
-                        let queue_strategy = match config.general.server_round_robin {
-                            true => QueueMode::Fifo,
-                            false => QueueMode::Lifo,
-                        };
+                        let queue_strategy = queue_mode(pool_config, &config.general);
 
                         info!(
                             "[{}@{}] creating auth_query shared pool",
@@ -824,6 +846,7 @@ impl ConnectionPool {
                                 },
                                 queue_mode: queue_strategy,
                                 scaling: pool_config.resolve_scaling_config(&config.general),
+                                reserve: pool_config.resolve_reserve_config(),
                             })
                             .build();
 
@@ -854,6 +877,9 @@ impl ConnectionPool {
                                 min_guaranteed_pool_size: pool_config
                                     .min_guaranteed_pool_size
                                     .unwrap_or(0),
+                                statement_rules: build_statement_rules(pool_config),
+                                rewrite_rules: build_rewrite_rules(pool_config, su),
+                                server_version: pool_config.server_version.clone(),
                             },
                             prepared_statement_cache: match config.general.prepared_statements {
                                 false => None,
@@ -863,6 +889,7 @@ impl ConnectionPool {
                                 ))),
                             },
                             check_query_cache: Arc::new(CheckQueryCache::new()),
+                            show_cache: Arc::new(DashMap::new()),
                             coordinator: coordinators.get(pool_name).cloned(),
                             replenish_failures: Arc::new(AtomicU32::new(0)),
                             init_complete: Arc::new(AtomicBool::new(true)),
@@ -876,6 +903,8 @@ impl ConnectionPool {
                     None // passthrough mode — dynamic pool created on first client connection
                 };
 
+                // auth_query executors connect to the first listed host.
+                let (executor_host, executor_port) = pool_config.primary_server();
                 auth_query_states.insert(
                     pool_name.clone(),
                     Arc::new(AuthQueryState::new(
@@ -883,8 +912,8 @@ impl ConnectionPool {
                         pool_startup_hash,
                         parent_fingerprint,
                         pool_name.clone(),
-                        pool_config.server_host.clone(),
-                        pool_config.server_port,
+                        executor_host,
+                        executor_port,
                         shared_pool_id,
                         Arc::new(AuthQueryStats::default()),
                     )),
@@ -910,7 +939,7 @@ impl ConnectionPool {
             let new_pool_startup_hash = new_pool_config.map(|p| {
                 use std::hash::{Hash, Hasher};
                 let mut hasher = std::collections::hash_map::DefaultHasher::new();
-                p.startup_parameters.hash(&mut hasher);
+                p.server_startup_parameters().hash(&mut hasher);
                 hasher.finish()
             });
             let new_parent_fingerprint =
@@ -968,8 +997,27 @@ impl ConnectionPool {
             }
         }
 
-        // 3. Carry over surviving dynamic pools
+        // 2c. Pools of the "*" user follow the pool config they were
+        //     built from: drop them when it changed or lost the "*" user.
         let old_pools = POOLS.load();
+        for id in DYNAMIC_POOLS.load().iter() {
+            if pools_to_remove.contains(id) || auth_query_states.contains_key(&id.db) {
+                continue;
+            }
+            let wildcard_hash = config
+                .pools
+                .get(&id.db)
+                .filter(|pool_config| pool_config.wildcard_user().is_some())
+                .map(|pool_config| pool_config_hash(pool_config, general_startup_hash));
+            if wildcard_hash.is_none()
+                || wildcard_hash != old_pools.get(id).map(|pool| pool.config_hash)
+            {
+                info!("[{id}] pool config changed — collecting \"*\" user pool for removal");
+                pools_to_remove.push(id.clone());
+            }
+        }
+
+        // 3. Carry over surviving dynamic pools
         for id in DYNAMIC_POOLS.load().iter() {
             if pools_to_remove.contains(id) {
                 continue;
@@ -1010,6 +1058,33 @@ impl ConnectionPool {
         // PREVIOUS_GENERAL_STARTUP_HASH alone so the next reload still
         // sees the old value and re-evaluates the change correctly.
         PREVIOUS_GENERAL_STARTUP_HASH.store(general_startup_hash, Ordering::Relaxed);
+
+        // query_wait_timeout is not part of the reuse hash: pools kept
+        // across the reload pick up the current value here, which also
+        // drops a value set earlier with `SET query_wait_timeout`.
+        let query_wait_timeout = config.general.query_wait_timeout.as_std();
+        for pool in new_pools.values() {
+            pool.database.set_wait_timeout(Some(query_wait_timeout));
+        }
+
+        // Clients that logged in before the reload keep their old pool.
+        // Hosts dropped from its `server_host` drain there rather than
+        // serving those clients until they disconnect.
+        for (id, pool) in old_pools.iter() {
+            let (Some(hosts), Some(pool_config)) =
+                (pool.database.host_list(), config.pools.get(&id.db))
+            else {
+                continue;
+            };
+            let retired = hosts.retire_missing(&pool_config.server_hosts());
+            if retired.is_empty() {
+                continue;
+            }
+            for (host, port) in &retired {
+                info!("[{id}] server_host {host}:{port} removed, draining its connections");
+            }
+            pool.drain_hosts_out_of_rotation();
+        }
         Ok(())
     }
 
@@ -1081,6 +1156,11 @@ impl ConnectionPool {
             };
             guard.set_from_hashmap(&conn.server_parameters_as_hashmap(), true);
         }
+        // Clients see the configured version in ParameterStatus and in
+        // `SHOW server_version` answered by `show_local_parameters`.
+        if let Some(version) = &self.settings.server_version {
+            guard.set_param("server_version", version.as_str(), true);
+        }
         Ok(guard.clone())
     }
 
@@ -1097,6 +1177,72 @@ impl ConnectionPool {
     }
 }
 
+fn general_startup_hash(general: &General) -> u64 {
+    use std::hash::{Hash, Hasher};
+    let mut hasher = std::collections::hash_map::DefaultHasher::new();
+    general.startup_parameters.hash(&mut hasher);
+    hasher.finish()
+}
+
+/// Reuse key of a pool: its config plus the general startup_parameters
+/// baseline.
+fn pool_config_hash(pool_config: &ConfigPool, general_startup_hash: u64) -> u64 {
+    use std::hash::Hasher;
+    let mut hasher = std::collections::hash_map::DefaultHasher::new();
+    hasher.write_u64(pool_config.hash_value());
+    hasher.write_u64(general_startup_hash);
+    hasher.finish()
+}
+
+/// Backend auth for users without backend credentials of their own:
+/// server_password is None AND (server_username is None OR equals username).
+/// The client's MD5 hash is passed through, or its SCRAM ClientKey once a
+/// client has logged in; scram-passthrough users log in on relayed logins.
+pub(crate) fn passthrough_backend_auth(
+    user: &User,
+    pool_name: &str,
+) -> Option<Arc<RwLock<BackendAuthMethod>>> {
+    if user.server_password.is_some()
+        || user.server_vault_path.is_some()
+        || user.server_rds_iam
+        || user
+            .server_username
+            .as_deref()
+            .is_some_and(|server_username| server_username != user.username)
+    {
+        return None;
+    }
+    if user
+        .password
+        .starts_with(crate::messages::constants::MD5_PASSWORD_PREFIX)
+    {
+        info!(
+            "[{}@{}] static passthrough: MD5 pass-the-hash",
+            user.username, pool_name
+        );
+        Some(Arc::new(RwLock::new(BackendAuthMethod::Md5PassTheHash(
+            user.password.clone(),
+        ))))
+    } else if user
+        .password
+        .starts_with(crate::messages::constants::SCRAM_SHA_256)
+    {
+        info!(
+            "[{}@{}] static passthrough: SCRAM pending",
+            user.username, pool_name
+        );
+        Some(Arc::new(RwLock::new(BackendAuthMethod::ScramPending)))
+    } else if user.password == crate::messages::constants::SCRAM_PASSTHROUGH_PASSWORD {
+        info!(
+            "[{}@{}] static passthrough: SCRAM relayed to the server",
+            user.username, pool_name
+        );
+        Some(Arc::new(RwLock::new(BackendAuthMethod::ScramRelay)))
+    } else {
+        None
+    }
+}
+
 /// Compute how many connections are above the effective guaranteed minimum.
 /// Pure function extracted from `ConnectionPool::spare_above_min()` for testability.
 fn compute_spare(
@@ -1121,6 +1267,10 @@ fn build_fallback_state(
         .patroni_api_urls
         .as_ref()
         .or(general.patroni_api_urls.as_ref())?;
+    // Discovery already routes around a dead primary.
+    if patroni_discovery_interval(pool_config, general).is_some() {
+        return None;
+    }
 
     let cooldown = pool_config
         .fallback_cooldown
@@ -1159,6 +1309,174 @@ fn build_fallback_state(
     }
 }
 
+/// Patroni discovery interval for a pool, when discovery is enabled: the
+/// pool or `general` sets `patroni_discovery_interval`, Patroni URLs are
+/// configured and `server_host` is not an SRV record.
+fn patroni_discovery_interval(
+    pool_config: &ConfigPool,
+    general: &crate::config::General,
+) -> Option<std::time::Duration> {
+    if srv::srv_name(&pool_config.server_host).is_some() {
+        return None;
+    }
+    pool_config
+        .patroni_api_urls
+        .as_ref()
+        .or(general.patroni_api_urls.as_ref())?;
+    pool_config
+        .patroni_discovery_interval
+        .or(general.patroni_discovery_interval)
+        .map(|d| d.as_std())
+}
+
+/// Idle server order: the pool's `server_round_robin`, falling back to
+/// `general.server_round_robin`.
+fn queue_mode(pool_config: &ConfigPool, general: &General) -> QueueMode {
+    match pool_config
+        .server_round_robin
+        .unwrap_or(general.server_round_robin)
+    {
+        true => QueueMode::Fifo,
+        false => QueueMode::Lifo,
+    }
+}
+
+/// Build the connect retry policy from `server_connect_attempts`,
+/// `server_connect_backoff` and `server_login_retry`.
+fn build_connect_retry(pool_config: &ConfigPool) -> connect_retry::ConnectRetry {
+    connect_retry::ConnectRetry::new(
+        pool_config.server_connect_attempts.unwrap_or(1),
+        pool_config
+            .server_connect_backoff
+            .map(|d| d.as_std())
+            .unwrap_or(connect_retry::DEFAULT_BACKOFF),
+        pool_config
+            .server_login_retry
+            .map(|d| d.as_std())
+            .unwrap_or_default(),
+    )
+}
+
+/// Build the backend memory limit of a pool that sets `server_max_memory`.
+fn build_memory_limit(
+    pool_config: &ConfigPool,
+    general: &crate::config::General,
+) -> Option<backend_memory::MemoryLimit> {
+    let max_memory = pool_config.server_max_memory?;
+    Some(backend_memory::MemoryLimit::new(
+        max_memory.as_bytes(),
+        general.server_memory_check_interval.as_std(),
+    ))
+}
+
+/// Build the backend circuit breaker; None while `circuit_breaker_threshold`
+/// is 0.
+fn build_circuit_breaker(
+    general: &crate::config::General,
+) -> Option<circuit_breaker::CircuitBreaker> {
+    (general.circuit_breaker_threshold > 0).then(|| {
+        circuit_breaker::CircuitBreaker::new(
+            general.circuit_breaker_threshold,
+            general.circuit_breaker_cooldown.as_std(),
+        )
+    })
+}
+
+/// Compile the pool's statement rules, already checked by config
+/// validation; None when it has no `statement_deny`.
+fn build_statement_rules(pool_config: &ConfigPool) -> Option<Arc<StatementRules>> {
+    StatementRules::compile(&pool_config.statement_deny, &pool_config.statement_allow)
+        .ok()
+        .flatten()
+        .map(Arc::new)
+}
+
+/// Compile the pool's `rewrite_rules` for `username`, already checked by
+/// config validation; None when none apply.
+fn build_rewrite_rules(
+    pool_config: &ConfigPool,
+    username: &str,
+) -> Option<Arc<Vec<CompiledRewrite>>> {
+    compile_rewrite_rules(&pool_config.rewrite_rules, username)
+        .ok()
+        .flatten()
+        .map(Arc::new)
+}
+
+/// Build the ordered host list for a pool whose `server_host` names more
+/// than one host or an SRV record, that discovers its hosts through
+/// Patroni, or that asks for a specific `target_session_attrs`.
+/// Cooldown and failover-connection lifetime reuse the `fallback_cooldown`
+/// and `fallback_lifetime` settings. Returns None for a plain single-host
+/// pool.
+fn build_host_list(
+    pool_name: &str,
+    pool_config: &ConfigPool,
+    general: &crate::config::General,
+) -> Option<Arc<multi_host::HostList>> {
+    let srv_name = srv::srv_name(&pool_config.server_host);
+    let discovery_interval = patroni_discovery_interval(pool_config, general);
+    let hosts = pool_config.server_hosts();
+    if srv_name.is_none()
+        && discovery_interval.is_none()
+        && hosts.len() < 2
+        && pool_config.target_session_attrs == crate::config::TargetSessionAttrs::Any
+    {
+        return None;
+    }
+    let cooldown = pool_config
+        .fallback_cooldown
+        .or(general.fallback_cooldown)
+        .map(|d| d.as_std())
+        .unwrap_or(std::time::Duration::from_secs(30));
+    let lifetime = pool_config
+        .fallback_lifetime
+        .or(general.fallback_lifetime)
+        .map(|d| d.as_millis())
+        .unwrap_or(cooldown.as_millis() as u64);
+    let host_list = multi_host::HostList::new(
+        pool_name.to_string(),
+        hosts,
+        pool_config.target_session_attrs,
+        cooldown,
+        lifetime,
+    )
+    .with_role_check_interval(general.server_role_check_interval.as_std())
+    .with_weights(pool_config.resolved_host_weights())
+    .with_policy(pool_config.load_balance_hosts);
+    if let Some(name) = srv_name {
+        // SRV answers are re-queried on the DNS refresh interval, or every
+        // 30s when periodic re-resolution is disabled.
+        let refresh = match general.dns_refresh_interval.as_std() {
+            interval if interval.is_zero() => std::time::Duration::from_secs(30),
+            interval => interval,
+        };
+        return Some(Arc::new(host_list.with_srv(name.to_string(), refresh)));
+    }
+    if let Some(interval) = discovery_interval {
+        let urls = pool_config
+            .patroni_api_urls
+            .as_ref()
+            .or(general.patroni_api_urls.as_ref())
+            .cloned()
+            .unwrap_or_default();
+        let api_timeout = pool_config
+            .patroni_api_timeout
+            .or(general.patroni_api_timeout)
+            .map(|d| d.as_std())
+            .unwrap_or(std::time::Duration::from_secs(5));
+        match crate::patroni::client::PatroniClient::new(api_timeout, api_timeout) {
+            Ok(client) => {
+                return Some(Arc::new(host_list.with_patroni(urls, client, interval)));
+            }
+            Err(e) => {
+                log::error!("pool {pool_name}: Patroni discovery disabled: failed to build HTTP client: {e}");
+            }
+        }
+    }
+    Some(Arc::new(host_list))
+}
+
 /// Resolve the per-backend prepared-statement LRU size for a pool.
 ///
 /// Resolution order (most specific wins):
@@ -1447,4 +1765,18 @@ mod tests {
         let g = General::test_with_cache_sizes(8192, Some(0));
         assert_eq!(resolve_client_anon_cache_size_inner(&g, Some(1024)), 0);
     }
+
+    #[test]
+    fn queue_mode_pool_overrides_general() {
+        let mut general = General::default();
+        let mut pool = ConfigPool::default();
+        assert!(matches!(queue_mode(&pool, &general), QueueMode::Lifo));
+        general.server_round_robin = true;
+        assert!(matches!(queue_mode(&pool, &general), QueueMode::Fifo));
+        pool.server_round_robin = Some(false);
+        assert!(matches!(queue_mode(&pool, &general), QueueMode::Lifo));
+        general.server_round_robin = false;
+        pool.server_round_robin = Some(true);
+        assert!(matches!(queue_mode(&pool, &general), QueueMode::Fifo));
+    }
 }
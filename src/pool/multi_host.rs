@@ -0,0 +1,1176 @@
+//! Ordered multi-host backend list.
+//!
+//! A pool whose `server_host` lists several hosts (`"pg1:5432,pg2,pg3"`)
+//! tries them in configuration order, libpq style. With
+//! `server_host = "srv+<name>"` the list comes from DNS SRV records instead
+//! and is re-queried periodically: lower priority values first, weighted
+//! random order within one priority. With `patroni_discovery_interval` the
+//! list comes from Patroni `/cluster` instead, polled in the background so
+//! the pool follows a switchover without waiting for DNS; `server_host`
+//! then only seeds the list until the first answer arrives.
+//!
+//! A host that refuses the connection or reports the wrong role for
+//! `target_session_attrs` is put in cooldown and skipped until it expires.
+//! Connections opened on a lower-priority host get a bounded lifetime, so
+//! once a preferred host recovers the pool drifts back to it through normal
+//! recycling.
+//!
+//! With `server_host_weights`, or a weight set from the admin console, the
+//! hosts of `server_host` are equivalent instead: each connect tries them
+//! in weighted random order, so heavier hosts get a proportional share of
+//! the pool's connections. `load_balance_hosts` can instead rank them by
+//! open connections per unit of weight, or by an EWMA of recent query
+//! latency, so a degraded host gets fewer new connections.
+//!
+//! A host taken out of rotation, with the admin `DISABLE HOST` command or
+//! by a reload that drops it from `server_host`, drains instead of being
+//! cut off: it gets no new connections, and its connections are closed
+//! when they come back to the pool, so transactions and sessions already
+//! running on it finish first.
+
+use std::collections::{HashMap, HashSet};
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use log::{info, warn};
+use once_cell::sync::Lazy;
+use parking_lot::{Mutex, RwLock};
+
+use crate::config::{LoadBalanceHosts, TargetSessionAttrs};
+use crate::errors::Error;
+use crate::patroni::client::PatroniClient;
+use crate::patroni::types::{Member, Role};
+use crate::server::Server;
+
+use super::srv::{self, SrvRecord};
+
+/// Weight of a host not listed in `server_host_weights`.
+pub const DEFAULT_WEIGHT: u16 = 1;
+
+/// Weights set with the admin `WEIGHT` command, per `(pool, host, port)`.
+/// They take precedence over `server_host_weights` and outlive reloads.
+static WEIGHT_OVERRIDES: Lazy<RwLock<HashMap<(String, String, u16), u16>>> =
+    Lazy::new(|| RwLock::new(HashMap::new()));
+
+/// Set (`Some`) or clear (`None`) the runtime weight of a host.
+pub fn set_weight_override(pool_name: &str, host: &str, port: u16, weight: Option<u16>) {
+    let key = (pool_name.to_string(), host.to_string(), port);
+    let mut overrides = WEIGHT_OVERRIDES.write();
+    match weight {
+        Some(weight) => overrides.insert(key, weight),
+        None => overrides.remove(&key),
+    };
+}
+
+/// Hosts taken out of rotation with the admin `DISABLE HOST` command, per
+/// `(pool, host, port)`. Like weights they outlive reloads.
+static DISABLED_HOSTS: Lazy<RwLock<HashSet<(String, String, u16)>>> =
+    Lazy::new(|| RwLock::new(HashSet::new()));
+
+/// Take a host out of rotation (`true`) or put it back (`false`).
+/// Returns false when it already was in that state.
+pub fn set_host_disabled(pool_name: &str, host: &str, port: u16, disabled: bool) -> bool {
+    let key = (pool_name.to_string(), host.to_string(), port);
+    let mut hosts = DISABLED_HOSTS.write();
+    if disabled {
+        hosts.insert(key)
+    } else {
+        hosts.remove(&key)
+    }
+}
+
+/// Weight of one configured host, as reported by `SHOW HOST_WEIGHTS`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct HostWeight {
+    pub host: String,
+    pub port: u16,
+    pub weight: u16,
+    /// `"admin"`, `"config"` or `"default"`.
+    pub source: &'static str,
+}
+
+/// Live load of one backend host, fed by the server connections of the
+/// pool that were opened on it.
+#[derive(Debug, Default)]
+pub struct HostLoad {
+    connections: AtomicUsize,
+    /// EWMA of query time in microseconds; 0 while unknown.
+    latency_us: AtomicU64,
+}
+
+impl HostLoad {
+    /// Smoothing of the latency average: each query moves it 1/8 of the
+    /// way, as TCP does for its RTT estimate.
+    const EWMA_SHIFT: u32 = 3;
+
+    pub fn opened(&self) {
+        self.connections.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// A connection closed. The last one also forgets the latency, so a
+    /// host that was avoided for being slow is probed again.
+    pub fn closed(&self) {
+        let previous = self
+            .connections
+            .fetch_update(Ordering::Relaxed, Ordering::Relaxed, |n| n.checked_sub(1))
+            .unwrap_or(0);
+        if previous == 1 {
+            self.latency_us.store(0, Ordering::Relaxed);
+        }
+    }
+
+    pub fn observe(&self, microseconds: u64) {
+        let sample = microseconds.max(1);
+        let _ = self
+            .latency_us
+            .fetch_update(Ordering::Relaxed, Ordering::Relaxed, |average| {
+                Some(if average == 0 {
+                    sample
+                } else {
+                    average - (average >> Self::EWMA_SHIFT) + (sample >> Self::EWMA_SHIFT)
+                })
+            });
+    }
+
+    pub fn connections(&self) -> usize {
+        self.connections.load(Ordering::Relaxed)
+    }
+
+    pub fn latency_us(&self) -> u64 {
+        self.latency_us.load(Ordering::Relaxed)
+    }
+}
+
+/// One host to try, in attempt order.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Candidate {
+    pub host: String,
+    pub port: u16,
+    /// Top-priority host: connections to it keep the regular lifetime.
+    pub preferred: bool,
+}
+
+/// Rate limit shared by the dynamic host sources.
+struct RefreshSchedule {
+    interval: Duration,
+    refreshed_at: Mutex<Option<Instant>>,
+}
+
+impl RefreshSchedule {
+    fn new(interval: Duration) -> RefreshSchedule {
+        RefreshSchedule {
+            interval,
+            refreshed_at: Mutex::new(None),
+        }
+    }
+
+    /// True when a refresh should run now; records the attempt. Even a
+    /// forced refresh waits a second between lookups.
+    fn start(&self, force: bool) -> bool {
+        let mut refreshed_at = self.refreshed_at.lock();
+        let now = Instant::now();
+        let due = match *refreshed_at {
+            None => true,
+            Some(at) if force => now.duration_since(at) >= Duration::from_secs(1),
+            Some(at) => now.duration_since(at) >= self.interval,
+        };
+        if due {
+            *refreshed_at = Some(now);
+        }
+        due
+    }
+
+    /// Let the next checkout retry instead of waiting a full interval.
+    fn reset(&self) {
+        *self.refreshed_at.lock() = None;
+    }
+}
+
+/// Where the host list comes from.
+enum Source {
+    /// `server_host` as written.
+    Static,
+    /// DNS SRV records of `name`.
+    Srv {
+        name: String,
+        schedule: RefreshSchedule,
+        records: RwLock<Vec<SrvRecord>>,
+    },
+    /// Members reported by Patroni `/cluster`.
+    Patroni {
+        urls: Vec<String>,
+        client: PatroniClient,
+        schedule: RefreshSchedule,
+        members: RwLock<Vec<Member>>,
+    },
+}
+
+pub struct HostList {
+    pool_name: String,
+    /// Hosts from `server_host` in priority order. Seeds the Patroni list
+    /// until the first answer; empty for SRV pools.
+    hosts: Vec<(String, u16)>,
+    /// `server_host_weights` per `(host, port)`; empty when not set.
+    weights: HashMap<(String, u16), u16>,
+    /// `load_balance_hosts`, when set.
+    policy: Option<LoadBalanceHosts>,
+    /// Load per `(host, port)`, for the load-aware policies.
+    loads: Mutex<HashMap<(String, u16), Arc<HostLoad>>>,
+    source: Source,
+    /// Cooldown deadline per `(host, port)`.
+    down_until: Mutex<HashMap<(String, u16), Instant>>,
+    target: TargetSessionAttrs,
+    cooldown: Duration,
+    /// Lifetime of connections opened on a non-preferred host.
+    failover_lifetime_ms: u64,
+    /// How often pooled connections re-check their role; zero disables.
+    role_check_interval: Duration,
+    /// Last observed `pg_is_in_recovery()` per `(host, port)`.
+    roles: Mutex<HashMap<(String, u16), bool>>,
+    /// Hosts a reload dropped from `server_host` while clients still use
+    /// this list.
+    removed: RwLock<HashSet<(String, u16)>>,
+}
+
+impl HostList {
+    pub fn new(
+        pool_name: String,
+        hosts: Vec<(String, u16)>,
+        target: TargetSessionAttrs,
+        cooldown: Duration,
+        failover_lifetime_ms: u64,
+    ) -> HostList {
+        HostList {
+            pool_name,
+            hosts,
+            weights: HashMap::new(),
+            policy: None,
+            loads: Mutex::new(HashMap::new()),
+            source: Source::Static,
+            down_until: Mutex::new(HashMap::new()),
+            target,
+            cooldown,
+            failover_lifetime_ms,
+            role_check_interval: Duration::ZERO,
+            roles: Mutex::new(HashMap::new()),
+            removed: RwLock::new(HashSet::new()),
+        }
+    }
+
+    /// Re-check the role of pooled connections at most this often
+    /// (`server_role_check_interval`). Zero keeps the check to connect time.
+    pub fn with_role_check_interval(mut self, interval: Duration) -> HostList {
+        self.role_check_interval = interval;
+        self
+    }
+
+    /// Balance connects over the static hosts by `server_host_weights`.
+    pub fn with_weights(mut self, weights: HashMap<(String, u16), u16>) -> HostList {
+        self.weights = weights;
+        self
+    }
+
+    /// Order balanced hosts by `load_balance_hosts`.
+    pub fn with_policy(mut self, policy: Option<LoadBalanceHosts>) -> HostList {
+        self.policy = policy;
+        self
+    }
+
+    /// The policy in effect: the configured one, or `random` once weights
+    /// are set. `disable` keeps the configured order unless a weight is
+    /// set from the admin console.
+    pub fn policy(&self) -> LoadBalanceHosts {
+        match self.policy {
+            Some(policy) if policy != LoadBalanceHosts::Disable => policy,
+            _ if self.host_weights().is_some() => LoadBalanceHosts::Random,
+            _ => LoadBalanceHosts::Disable,
+        }
+    }
+
+    /// Load tracker of `host:port`; server connections opened there report
+    /// to it.
+    pub fn load(&self, host: &str, port: u16) -> Arc<HostLoad> {
+        self.loads
+            .lock()
+            .entry((host.to_string(), port))
+            .or_default()
+            .clone()
+    }
+
+    /// Take the hosts from the SRV records of `name`, re-queried every
+    /// `refresh_interval`.
+    pub fn with_srv(mut self, name: String, refresh_interval: Duration) -> HostList {
+        self.hosts.clear();
+        self.source = Source::Srv {
+            name,
+            schedule: RefreshSchedule::new(refresh_interval),
+            records: RwLock::new(Vec::new()),
+        };
+        self
+    }
+
+    /// Take the hosts from Patroni `/cluster`, polled every `interval`.
+    pub fn with_patroni(
+        mut self,
+        urls: Vec<String>,
+        client: PatroniClient,
+        interval: Duration,
+    ) -> HostList {
+        self.source = Source::Patroni {
+            urls,
+            client,
+            schedule: RefreshSchedule::new(interval),
+            members: RwLock::new(Vec::new()),
+        };
+        self
+    }
+
+    /// True when the list is polled from Patroni.
+    pub fn is_patroni(&self) -> bool {
+        matches!(self.source, Source::Patroni { .. })
+    }
+
+    pub fn target(&self) -> TargetSessionAttrs {
+        self.target
+    }
+
+    pub fn failover_lifetime_ms(&self) -> u64 {
+        self.failover_lifetime_ms
+    }
+
+    /// Re-query the host source when the previous answer is older than its
+    /// refresh interval, or right away when `force` is set (every host
+    /// failed). A failed lookup keeps the previous answer. No-op for static
+    /// lists.
+    ///
+    /// Returns true when Patroni reports a different preferred host (a
+    /// switchover happened): the caller retires the pool's connections so
+    /// they move to the new host. SRV changes only reorder new connects.
+    pub async fn refresh(&self, force: bool) -> Result<bool, Error> {
+        match self.source {
+            Source::Static => Ok(false),
+            Source::Srv {
+                ref name,
+                ref schedule,
+                ref records,
+            } => {
+                if !schedule.start(force) {
+                    return Ok(false);
+                }
+                match srv::lookup(name).await {
+                    Ok(answer) => {
+                        let mut current = records.write();
+                        if *current != answer {
+                            info!(
+                                "[{}] SRV {} resolved to {}",
+                                self.pool_name,
+                                name,
+                                format_records(&answer)
+                            );
+                            *current = answer;
+                        }
+                        Ok(false)
+                    }
+                    Err(err) if !records.read().is_empty() => {
+                        warn!(
+                            "[{}] {err}; keeping the previous SRV answer",
+                            self.pool_name
+                        );
+                        Ok(false)
+                    }
+                    Err(err) => {
+                        schedule.reset();
+                        Err(err)
+                    }
+                }
+            }
+            Source::Patroni {
+                ref urls,
+                ref client,
+                ref schedule,
+                ref members,
+            } => {
+                if !schedule.start(force) {
+                    return Ok(false);
+                }
+                let cluster = match client.fetch_cluster(urls).await {
+                    Ok(cluster) => cluster,
+                    Err(err) => {
+                        // Seed hosts or the previous answer stay in use.
+                        warn!(
+                            "[{}] patroni discovery: {err}; keeping the current host list",
+                            self.pool_name
+                        );
+                        return Ok(false);
+                    }
+                };
+                let usable: Vec<Member> = cluster
+                    .members
+                    .into_iter()
+                    .filter(|m| is_usable_state(&m.state))
+                    .collect();
+                if usable.is_empty() {
+                    warn!(
+                        "[{}] patroni discovery: /cluster lists no running members; keeping the current host list",
+                        self.pool_name
+                    );
+                    return Ok(false);
+                }
+                let before = self.preferred_hosts();
+                *members.write() = usable;
+                let after = self.preferred_hosts();
+                if before == after {
+                    return Ok(false);
+                }
+                info!(
+                    "[{}] patroni discovery: preferred host changed from {} to {}",
+                    self.pool_name,
+                    format_hosts(&before),
+                    format_hosts(&after)
+                );
+                Ok(true)
+            }
+        }
+    }
+
+    /// Every host in attempt order, cooldown ignored.
+    fn ordered(&self) -> Vec<Candidate> {
+        match self.source {
+            Source::Srv { ref records, .. } => {
+                let records = records.read().clone();
+                let top_priority = records.iter().map(|r| r.priority).min();
+                srv::order_records(records, &mut rand::rng())
+                    .into_iter()
+                    .map(|r| Candidate {
+                        preferred: Some(r.priority) == top_priority,
+                        host: r.target,
+                        port: r.port,
+                    })
+                    .collect()
+            }
+            Source::Patroni { ref members, .. } => {
+                let members = members.read();
+                if members.is_empty() {
+                    self.configured()
+                } else {
+                    order_members(&members, self.target)
+                }
+            }
+            Source::Static => match self.balanced_weights() {
+                Some(weights) => match self.policy {
+                    Some(LoadBalanceHosts::LeastConnections) => self
+                        .ranked(weights, |load, weight| {
+                            load.connections() as u64 * u16::MAX as u64 / weight as u64
+                        }),
+                    Some(LoadBalanceHosts::EwmaLatency) => {
+                        self.ranked(weights, |load, _| load.latency_us())
+                    }
+                    _ => self.weighted(weights, &mut rand::rng()),
+                },
+                None => self.configured(),
+            },
+        }
+    }
+
+    /// Weights of the static hosts, when they are balanced: weights come
+    /// from the config or the admin console.
+    pub fn host_weights(&self) -> Option<Vec<HostWeight>> {
+        if !matches!(self.source, Source::Static) {
+            return None;
+        }
+        let overrides = WEIGHT_OVERRIDES.read();
+        let mut balanced = !self.weights.is_empty()
+            || self
+                .policy
+                .is_some_and(|policy| policy != LoadBalanceHosts::Disable);
+        let weights = self
+            .hosts
+            .iter()
+            .map(|(host, port)| {
+                let key = (self.pool_name.clone(), host.clone(), *port);
+                let (weight, source) = if let Some(weight) = overrides.get(&key) {
+                    balanced = true;
+                    (*weight, "admin")
+                } else if let Some(weight) = self.weights.get(&(host.clone(), *port)) {
+                    (*weight, "config")
+                } else {
+                    (DEFAULT_WEIGHT, "default")
+                };
+                HostWeight {
+                    host: host.clone(),
+                    port: *port,
+                    weight,
+                    source,
+                }
+            })
+            .collect();
+        balanced.then_some(weights)
+    }
+
+    fn balanced_weights(&self) -> Option<Vec<u16>> {
+        self.host_weights()
+            .map(|weights| weights.into_iter().map(|w| w.weight).collect())
+    }
+
+    /// Static hosts in weighted random order. Every host with a weight is
+    /// preferred; weight 0 hosts come last and only serve as a fallback,
+    /// unless all weights are 0.
+    fn weighted(&self, weights: Vec<u16>, rng: &mut impl rand::Rng) -> Vec<Candidate> {
+        let all_zero = weights.iter().all(|weight| *weight == 0);
+        let records = self
+            .hosts
+            .iter()
+            .zip(weights)
+            .map(|((host, port), weight)| SrvRecord {
+                priority: 0,
+                weight,
+                port: *port,
+                target: host.clone(),
+            })
+            .collect();
+        srv::order_records(records, rng)
+            .into_iter()
+            .map(|r| Candidate {
+                preferred: r.weight > 0 || all_zero,
+                host: r.target,
+                port: r.port,
+            })
+            .collect()
+    }
+
+    /// Static hosts by ascending `score(load, weight)`, ties in random
+    /// order. Weight 0 hosts come last, as with `weighted`.
+    fn ranked(&self, weights: Vec<u16>, score: impl Fn(&HostLoad, u16) -> u64) -> Vec<Candidate> {
+        use rand::seq::SliceRandom;
+
+        let all_zero = weights.iter().all(|weight| *weight == 0);
+        let mut ranked: Vec<(u64, Candidate)> = self
+            .hosts
+            .iter()
+            .zip(weights)
+            .map(|((host, port), weight)| {
+                let rank = match weight {
+                    0 => u64::MAX,
+                    weight => score(&self.load(host, *port), weight),
+                };
+                let candidate = Candidate {
+                    host: host.clone(),
+                    port: *port,
+                    preferred: weight > 0 || all_zero,
+                };
+                (rank, candidate)
+            })
+            .collect();
+        ranked.shuffle(&mut rand::rng());
+        ranked.sort_by_key(|(rank, _)| *rank);
+        ranked.into_iter().map(|(_, candidate)| candidate).collect()
+    }
+
+    /// Hosts of `server_host` that can be weighed; empty for SRV and
+    /// Patroni lists.
+    pub fn static_hosts(&self) -> &[(String, u16)] {
+        match self.source {
+            Source::Static => &self.hosts,
+            _ => &[],
+        }
+    }
+
+    /// Hosts of `server_host`. The first host not last seen with the
+    /// wrong role for `target_session_attrs` is preferred, so after a
+    /// switchover the new primary keeps its connections for their full
+    /// lifetime; the first host when all of them were.
+    fn configured(&self) -> Vec<Candidate> {
+        let preferred = {
+            let roles = self.roles.lock();
+            self.hosts
+                .iter()
+                .position(|(host, port)| {
+                    roles
+                        .get(&(host.clone(), *port))
+                        .is_none_or(|in_recovery| role_accepted(self.target, *in_recovery))
+                })
+                .unwrap_or(0)
+        };
+        self.hosts
+            .iter()
+            .enumerate()
+            .map(|(index, (host, port))| Candidate {
+                host: host.clone(),
+                port: *port,
+                preferred: index == preferred,
+            })
+            .collect()
+    }
+
+    /// True when a connection just opened on the host is on a preferred
+    /// one. Asked after the role check, which may have changed the answer
+    /// since the candidates were listed.
+    pub fn is_preferred(&self, host: &str, port: u16) -> bool {
+        self.serving()
+            .iter()
+            .any(|c| c.preferred && c.host == host && c.port == port)
+    }
+
+    fn preferred_hosts(&self) -> Vec<(String, u16)> {
+        let mut hosts: Vec<(String, u16)> = self
+            .ordered()
+            .into_iter()
+            .filter(|c| c.preferred)
+            .map(|c| (c.host, c.port))
+            .collect();
+        hosts.sort();
+        hosts
+    }
+
+    /// Take the static hosts missing from `current` out of rotation, after
+    /// a reload changed `server_host`. Returns the hosts newly removed.
+    pub fn retire_missing(&self, current: &[(String, u16)]) -> Vec<(String, u16)> {
+        let mut removed = self.removed.write();
+        self.static_hosts()
+            .iter()
+            .filter(|host| !current.contains(*host) && removed.insert((*host).clone()))
+            .cloned()
+            .collect()
+    }
+
+    fn out_of_rotation(&self, host: &str, port: u16) -> bool {
+        let removed = self.removed.read();
+        if !removed.is_empty() && removed.contains(&(host.to_string(), port)) {
+            return true;
+        }
+        let disabled = DISABLED_HOSTS.read();
+        !disabled.is_empty() && disabled.contains(&(self.pool_name.clone(), host.to_string(), port))
+    }
+
+    /// True when connections to the host should be closed instead of
+    /// reused: it is out of rotation and another host still serves the
+    /// pool.
+    pub fn is_draining(&self, host: &str, port: u16) -> bool {
+        self.out_of_rotation(host, port)
+            && self
+                .ordered()
+                .iter()
+                .any(|c| !self.out_of_rotation(&c.host, c.port))
+    }
+
+    /// Hosts in attempt order without the ones out of rotation, unless that
+    /// leaves none. The first remaining host is preferred when the
+    /// preferred ones are all gone, so its connections keep their full
+    /// lifetime.
+    fn serving(&self) -> Vec<Candidate> {
+        let all = self.ordered();
+        let mut serving: Vec<Candidate> = all
+            .iter()
+            .filter(|c| !self.out_of_rotation(&c.host, c.port))
+            .cloned()
+            .collect();
+        if serving.is_empty() {
+            return all;
+        }
+        if !serving.iter().any(|c| c.preferred) {
+            serving[0].preferred = true;
+        }
+        serving
+    }
+
+    /// Hosts to try, in attempt order. Hosts out of rotation are left out,
+    /// and hosts in cooldown skipped; when every host is in cooldown all of
+    /// them are returned so the pool never stops trying.
+    pub fn candidates(&self) -> Vec<Candidate> {
+        let all = self.serving();
+        let now = Instant::now();
+        let down = self.down_until.lock();
+        let available: Vec<Candidate> = all
+            .iter()
+            .filter(|c| {
+                down.get(&(c.host.clone(), c.port))
+                    .is_none_or(|until| *until <= now)
+            })
+            .cloned()
+            .collect();
+        if available.is_empty() {
+            all
+        } else {
+            available
+        }
+    }
+
+    /// Put the host in cooldown after a failed connect or a role mismatch.
+    pub fn mark_down(&self, host: &str, port: u16) {
+        self.down_until
+            .lock()
+            .insert((host.to_string(), port), Instant::now() + self.cooldown);
+    }
+
+    /// Clear the cooldown after a successful connect. Logs the recovery
+    /// once, on the transition.
+    pub fn mark_up(&self, host: &str, port: u16) {
+        if self
+            .down_until
+            .lock()
+            .remove(&(host.to_string(), port))
+            .is_some()
+        {
+            info!(
+                "[{}] server_host {host}:{port} is usable again",
+                self.pool_name
+            );
+        }
+    }
+
+    /// Check that a freshly started connection has the role requested by
+    /// `target_session_attrs`. PostgreSQL 14+ reports `in_hot_standby` in
+    /// the startup ParameterStatus; older servers are asked directly.
+    pub async fn role_matches(&self, server: &mut Server) -> Result<bool, Error> {
+        if self.target == TargetSessionAttrs::Any {
+            return Ok(true);
+        }
+        let reported = server
+            .server_parameters_as_hashmap()
+            .get("in_hot_standby")
+            .map(|value| value == "on");
+        let in_recovery = match reported {
+            Some(in_recovery) => in_recovery,
+            None => query_in_recovery(server).await?,
+        };
+        self.observe_role(server, in_recovery);
+        Ok(role_accepted(self.target, in_recovery))
+    }
+
+    /// True when a pooled connection is due for a role re-check.
+    pub fn role_check_due(&self, server: &Server) -> bool {
+        self.target != TargetSessionAttrs::Any
+            && !self.role_check_interval.is_zero()
+            && server
+                .role_checked_at
+                .is_none_or(|at| at.elapsed() >= self.role_check_interval)
+    }
+
+    /// Re-check the role of a pooled connection. Always asks the server:
+    /// the startup `in_hot_standby` value goes stale after a promotion.
+    pub async fn recheck_role(&self, server: &mut Server) -> Result<bool, Error> {
+        let in_recovery = query_in_recovery(server).await?;
+        self.observe_role(server, in_recovery);
+        Ok(role_accepted(self.target, in_recovery))
+    }
+
+    /// Record the role seen on `server` and report a change of its host.
+    fn observe_role(&self, server: &mut Server, in_recovery: bool) {
+        server.role_checked_at = Some(Instant::now());
+        let (host, port) = (server.address.host.clone(), server.address.port);
+        let port_label = port.to_string();
+        crate::web::metrics::SERVER_IN_RECOVERY
+            .with_label_values(&[&self.pool_name, &host, &port_label])
+            .set(if in_recovery { 1.0 } else { 0.0 });
+        let previous = self.roles.lock().insert((host.clone(), port), in_recovery);
+        if previous.is_some_and(|previous| previous != in_recovery) {
+            crate::web::metrics::SERVER_ROLE_CHANGES_TOTAL
+                .with_label_values(&[&self.pool_name, &host, &port_label])
+                .inc();
+            warn!(
+                "[{}] server_host {host}:{port} changed role: {} -> {}",
+                self.pool_name,
+                role_name(!in_recovery),
+                role_name(in_recovery),
+            );
+        }
+    }
+}
+
+async fn query_in_recovery(server: &mut Server) -> Result<bool, Error> {
+    Ok(server
+        .query_first_value("SELECT pg_is_in_recovery()")
+        .await?
+        .as_deref()
+        == Some("t"))
+}
+
+fn role_name(in_recovery: bool) -> &'static str {
+    if in_recovery {
+        "standby"
+    } else {
+        "primary"
+    }
+}
+
+fn role_accepted(target: TargetSessionAttrs, in_recovery: bool) -> bool {
+    match target {
+        TargetSessionAttrs::Any => true,
+        TargetSessionAttrs::Primary => !in_recovery,
+        TargetSessionAttrs::Standby => in_recovery,
+    }
+}
+
+/// Patroni member states that can serve connections.
+fn is_usable_state(state: &str) -> bool {
+    matches!(state, "running" | "streaming" | "in archive recovery")
+}
+
+/// Order Patroni members for `target`. `any` and `primary` start with the
+/// leader, then synchronous and asynchronous replicas; `standby` starts with
+/// load-balanced replicas and keeps the leader as the last resort. Members
+/// of one rank are ordered by replication lag. The first rank is preferred.
+fn order_members(members: &[Member], target: TargetSessionAttrs) -> Vec<Candidate> {
+    let rank = |m: &Member| -> u8 {
+        match (target, &m.role) {
+            (TargetSessionAttrs::Standby, Role::SyncStandby | Role::Replica)
+                if !m.tags.noloadbalance =>
+            {
+                0
+            }
+            (TargetSessionAttrs::Standby, Role::Leader) => 2,
+            (TargetSessionAttrs::Standby, _) => 1,
+            (_, Role::Leader) => 0,
+            (_, Role::SyncStandby) => 1,
+            (_, Role::Replica) => 2,
+            (_, Role::Other(_)) => 3,
+        }
+    };
+    let mut ranked: Vec<(u8, &Member)> = members.iter().map(|m| (rank(m), m)).collect();
+    ranked.sort_by_key(|(rank, m)| (*rank, m.lag.unwrap_or(u64::MAX)));
+    ranked
+        .into_iter()
+        .map(|(rank, m)| Candidate {
+            host: m.host.clone(),
+            port: m.port,
+            preferred: rank == 0,
+        })
+        .collect()
+}
+
+fn format_hosts(hosts: &[(String, u16)]) -> String {
+    if hosts.is_empty() {
+        return "none".to_string();
+    }
+    hosts
+        .iter()
+        .map(|(host, port)| format!("{host}:{port}"))
+        .collect::<Vec<_>>()
+        .join(",")
+}
+
+fn format_records(records: &[SrvRecord]) -> String {
+    records
+        .iter()
+        .map(|r| format!("{}:{}(p={},w={})", r.target, r.port, r.priority, r.weight))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+/// Spawn the Patroni discovery poller. Every second it refreshes the pools
+/// whose host list comes from Patroni (each at its own interval) and
+/// reconnects a pool when its preferred host changed, so idle connections
+/// to the old primary are closed and busy ones are dropped on return.
+pub fn spawn_patroni_discovery() {
+    tokio::spawn(async move {
+        loop {
+            tokio::time::sleep(Duration::from_secs(1)).await;
+            let pools = super::get_all_pools();
+            for pool in pools.values() {
+                let Some(hosts) = pool.database.host_list() else {
+                    continue;
+                };
+                if !hosts.is_patroni() {
+                    continue;
+                }
+                match hosts.refresh(false).await {
+                    Ok(true) => {
+                        pool.database.reconnect();
+                    }
+                    Ok(false) => {}
+                    Err(err) => warn!("[{}] patroni discovery: {err}", hosts.pool_name),
+                }
+            }
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn list(cooldown: Duration) -> HostList {
+        HostList::new(
+            "db".to_string(),
+            vec![
+                ("pg1".to_string(), 5432),
+                ("pg2".to_string(), 5432),
+                ("pg3".to_string(), 6432),
+            ],
+            TargetSessionAttrs::Primary,
+            cooldown,
+            30_000,
+        )
+    }
+
+    fn names(candidates: &[Candidate]) -> Vec<&str> {
+        candidates.iter().map(|c| c.host.as_str()).collect()
+    }
+
+    #[test]
+    fn candidates_follow_config_order() {
+        let hosts = list(Duration::from_secs(30));
+        let candidates = hosts.candidates();
+        assert_eq!(names(&candidates), vec!["pg1", "pg2", "pg3"]);
+        assert!(candidates[0].preferred);
+        assert!(!candidates[1].preferred);
+        assert_eq!(candidates[2].port, 6432);
+    }
+
+    #[test]
+    fn first_host_with_the_requested_role_is_preferred() {
+        let hosts = list(Duration::from_secs(30));
+        hosts.roles.lock().insert(("pg1".to_string(), 5432), true);
+        let candidates = hosts.candidates();
+        assert_eq!(names(&candidates), vec!["pg1", "pg2", "pg3"]);
+        assert!(!candidates[0].preferred);
+        assert!(candidates[1].preferred);
+        assert!(hosts.is_preferred("pg2", 5432));
+        assert!(!hosts.is_preferred("pg1", 5432));
+
+        hosts.roles.lock().insert(("pg1".to_string(), 5432), false);
+        assert!(hosts.is_preferred("pg1", 5432));
+        assert!(!hosts.is_preferred("pg2", 5432));
+    }
+
+    #[test]
+    fn weighted_hosts_are_all_preferred_and_zero_weight_goes_last() {
+        let hosts = list(Duration::from_secs(30)).with_weights(HashMap::from([
+            (("pg1".to_string(), 5432), 0),
+            (("pg2".to_string(), 5432), 3),
+        ]));
+        for _ in 0..20 {
+            let candidates = hosts.candidates();
+            assert_eq!(candidates.len(), 3);
+            assert_eq!(candidates[2].host, "pg1");
+            assert!(!candidates[2].preferred);
+            assert!(candidates[0].preferred && candidates[1].preferred);
+        }
+    }
+
+    #[test]
+    fn weight_override_turns_on_balancing_until_cleared() {
+        let hosts = HostList::new(
+            "weighted_db".to_string(),
+            vec![("pg1".to_string(), 5432), ("pg2".to_string(), 5432)],
+            TargetSessionAttrs::Any,
+            Duration::from_secs(30),
+            30_000,
+        );
+        assert!(hosts.host_weights().is_none());
+
+        set_weight_override("weighted_db", "pg1", 5432, Some(0));
+        let weights = hosts.host_weights().unwrap();
+        assert_eq!((weights[0].weight, weights[0].source), (0, "admin"));
+        assert_eq!((weights[1].weight, weights[1].source), (1, "default"));
+        assert_eq!(names(&hosts.candidates()), vec!["pg2", "pg1"]);
+
+        set_weight_override("weighted_db", "pg1", 5432, None);
+        assert!(hosts.host_weights().is_none());
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2"]);
+    }
+
+    #[test]
+    fn disabled_host_drains_until_enabled() {
+        let hosts = HostList::new(
+            "draining_db".to_string(),
+            vec![("pg1".to_string(), 5432), ("pg2".to_string(), 5432)],
+            TargetSessionAttrs::Any,
+            Duration::from_secs(30),
+            30_000,
+        );
+        assert!(set_host_disabled("draining_db", "pg1", 5432, true));
+        assert!(!set_host_disabled("draining_db", "pg1", 5432, true));
+        let candidates = hosts.candidates();
+        assert_eq!(names(&candidates), vec!["pg2"]);
+        assert!(candidates[0].preferred);
+        assert!(hosts.is_draining("pg1", 5432));
+        assert!(!hosts.is_draining("pg2", 5432));
+
+        // The last host in rotation keeps serving.
+        set_host_disabled("draining_db", "pg2", 5432, true);
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2"]);
+        assert!(!hosts.is_draining("pg1", 5432));
+
+        set_host_disabled("draining_db", "pg1", 5432, false);
+        set_host_disabled("draining_db", "pg2", 5432, false);
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2"]);
+        assert!(!hosts.is_draining("pg1", 5432));
+    }
+
+    #[test]
+    fn hosts_dropped_by_reload_are_retired_once() {
+        let hosts = list(Duration::from_secs(30));
+        let current = vec![("pg1".to_string(), 5432), ("pg3".to_string(), 6432)];
+        assert_eq!(
+            hosts.retire_missing(&current),
+            vec![("pg2".to_string(), 5432)]
+        );
+        assert!(hosts.retire_missing(&current).is_empty());
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg3"]);
+        assert!(hosts.is_draining("pg2", 5432));
+    }
+
+    #[test]
+    fn least_connections_prefers_fewest_connections_per_weight() {
+        let hosts = list(Duration::from_secs(30))
+            .with_weights(HashMap::from([(("pg1".to_string(), 5432), 2)]))
+            .with_policy(Some(LoadBalanceHosts::LeastConnections));
+        for _ in 0..3 {
+            hosts.load("pg1", 5432).opened();
+        }
+        hosts.load("pg2", 5432).opened();
+        assert_eq!(names(&hosts.candidates()), vec!["pg3", "pg2", "pg1"]);
+        assert_eq!(hosts.policy(), LoadBalanceHosts::LeastConnections);
+    }
+
+    #[test]
+    fn ewma_latency_prefers_fast_hosts_and_reprobes_idle_ones() {
+        let hosts = list(Duration::from_secs(30)).with_policy(Some(LoadBalanceHosts::EwmaLatency));
+        for (host, port, latency) in [
+            ("pg1", 5432, 50_000),
+            ("pg2", 5432, 1_000),
+            ("pg3", 6432, 5_000),
+        ] {
+            let load = hosts.load(host, port);
+            load.opened();
+            load.observe(latency);
+        }
+        assert_eq!(names(&hosts.candidates()), vec!["pg2", "pg3", "pg1"]);
+
+        hosts.load("pg1", 5432).closed();
+        assert_eq!(hosts.load("pg1", 5432).latency_us(), 0);
+        assert_eq!(names(&hosts.candidates())[0], "pg1");
+    }
+
+    #[test]
+    fn latency_average_moves_an_eighth_of_the_way() {
+        let load = HostLoad::default();
+        load.observe(800);
+        assert_eq!(load.latency_us(), 800);
+        load.observe(1_600);
+        assert_eq!(load.latency_us(), 900);
+    }
+
+    #[test]
+    fn hosts_in_cooldown_are_skipped_until_marked_up() {
+        let hosts = list(Duration::from_secs(30));
+        hosts.mark_down("pg1", 5432);
+        assert_eq!(names(&hosts.candidates()), vec!["pg2", "pg3"]);
+        hosts.mark_up("pg1", 5432);
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2", "pg3"]);
+    }
+
+    #[test]
+    fn all_hosts_returned_when_everything_is_down() {
+        let hosts = list(Duration::from_secs(30));
+        hosts.mark_down("pg1", 5432);
+        hosts.mark_down("pg2", 5432);
+        hosts.mark_down("pg3", 6432);
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2", "pg3"]);
+    }
+
+    #[test]
+    fn cooldown_expires() {
+        let hosts = list(Duration::from_millis(0));
+        hosts.mark_down("pg1", 5432);
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2", "pg3"]);
+    }
+
+    #[test]
+    fn srv_candidates_prefer_lowest_priority() {
+        let hosts = list(Duration::from_secs(30))
+            .with_srv("_pg._tcp.db".to_string(), Duration::from_secs(30));
+        assert!(hosts.candidates().is_empty());
+        let Source::Srv { ref records, .. } = hosts.source else {
+            unreachable!()
+        };
+        *records.write() = vec![
+            SrvRecord {
+                priority: 20,
+                weight: 0,
+                port: 5432,
+                target: "replica".to_string(),
+            },
+            SrvRecord {
+                priority: 10,
+                weight: 0,
+                port: 5433,
+                target: "primary".to_string(),
+            },
+        ];
+        let candidates = hosts.candidates();
+        assert_eq!(names(&candidates), vec!["primary", "replica"]);
+        assert!(candidates[0].preferred);
+        assert!(!candidates[1].preferred);
+    }
+
+    fn members(json: &str) -> Vec<Member> {
+        serde_json::from_str::<crate::patroni::types::ClusterResponse>(json)
+            .unwrap()
+            .members
+    }
+
+    const CLUSTER: &str = r#"{"members": [
+        {"name": "a", "role": "replica", "state": "streaming", "host": "pg-a", "port": 5432, "lag": 50},
+        {"name": "b", "role": "leader", "state": "running", "host": "pg-b", "port": 5432},
+        {"name": "c", "role": "sync_standby", "state": "streaming", "host": "pg-c", "port": 5432, "lag": 0},
+        {"name": "d", "role": "replica", "state": "streaming", "host": "pg-d", "port": 5432, "lag": 10,
+         "tags": {"noloadbalance": true}}
+    ]}"#;
+
+    #[test]
+    fn patroni_members_leader_first_for_primary() {
+        let ordered = order_members(&members(CLUSTER), TargetSessionAttrs::Primary);
+        assert_eq!(names(&ordered), vec!["pg-b", "pg-c", "pg-d", "pg-a"]);
+        assert!(ordered[0].preferred);
+        assert!(ordered[1..].iter().all(|c| !c.preferred));
+    }
+
+    #[test]
+    fn patroni_members_replicas_first_for_standby() {
+        let ordered = order_members(&members(CLUSTER), TargetSessionAttrs::Standby);
+        assert_eq!(names(&ordered), vec!["pg-c", "pg-a", "pg-d", "pg-b"]);
+        assert!(ordered[0].preferred && ordered[1].preferred);
+        assert!(!ordered[2].preferred && !ordered[3].preferred);
+    }
+
+    #[test]
+    fn patroni_seed_hosts_until_first_answer() {
+        let hosts = list(Duration::from_secs(30)).with_patroni(
+            vec!["http://127.0.0.1:8008".to_string()],
+            PatroniClient::new(Duration::from_secs(1), Duration::from_secs(1)).unwrap(),
+            Duration::from_secs(5),
+        );
+        assert!(hosts.is_patroni());
+        assert_eq!(names(&hosts.candidates()), vec!["pg1", "pg2", "pg3"]);
+        assert_eq!(hosts.preferred_hosts(), vec![("pg1".to_string(), 5432)]);
+
+        let Source::Patroni {
+            members: ref slot, ..
+        } = hosts.source
+        else {
+            unreachable!()
+        };
+        *slot.write() = members(CLUSTER);
+        assert_eq!(hosts.preferred_hosts(), vec![("pg-b".to_string(), 5432)]);
+    }
+
+    #[test]
+    fn patroni_member_states() {
+        assert!(is_usable_state("running"));
+        assert!(is_usable_state("streaming"));
+        assert!(!is_usable_state("stopped"));
+        assert!(!is_usable_state("starting"));
+    }
+
+    #[test]
+    fn role_accepted_matches_target() {
+        assert!(role_accepted(TargetSessionAttrs::Any, true));
+        assert!(role_accepted(TargetSessionAttrs::Primary, false));
+        assert!(!role_accepted(TargetSessionAttrs::Primary, true));
+        assert!(role_accepted(TargetSessionAttrs::Standby, true));
+        assert!(!role_accepted(TargetSessionAttrs::Standby, false));
+    }
+}
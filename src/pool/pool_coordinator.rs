@@ -1,8 +1,10 @@
-use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::collections::BTreeMap;
+use std::sync::atomic::{AtomicBool, AtomicU64, AtomicUsize, Ordering};
 use std::sync::Arc;
 use std::time::Duration;
 
 use log::{debug, info, warn};
+use parking_lot::Mutex;
 use tokio::sync::{mpsc, Notify, Semaphore};
 
 /// Source of eviction candidates and user state.
@@ -17,6 +19,11 @@ pub trait EvictionSource: Send + Sync {
 
     /// True if user has fewer connections than their guaranteed minimum.
     fn is_starving(&self, user: &str) -> bool;
+
+    /// Queue priority of the user; higher is served first.
+    fn priority(&self, _user: &str) -> u8 {
+        0
+    }
 }
 
 #[derive(Clone, Debug, PartialEq, Eq)]
@@ -67,7 +74,7 @@ impl Drop for CoordinatorPermit {
             .coordinator
             .total_connections
             .fetch_sub(1, Ordering::Relaxed);
-        self.coordinator.connection_returned.notify_one();
+        self.coordinator.wake_waiters();
         debug!(
             "[pool: {}] coordinator: {} permit released (active: {} -> {})",
             self.coordinator.database,
@@ -115,6 +122,69 @@ impl Drop for ReserveGrant {
     }
 }
 
+/// Phase C waiters counted by queue priority.
+///
+/// A waiter does not take a freed permit while a higher-priority waiter is
+/// parked, for at most the first half of its own wait (starvation
+/// protection). With waiters of mixed priority a freed permit wakes all of
+/// them, so the highest one is guaranteed to see it.
+#[derive(Default)]
+struct PriorityWaiters {
+    counts: Mutex<BTreeMap<u8, usize>>,
+    /// Highest waiting priority plus one; 0 when nobody waits.
+    top: AtomicUsize,
+    /// Waiters of more than one priority are parked.
+    mixed: AtomicBool,
+}
+
+impl PriorityWaiters {
+    fn register(&self, priority: u8) -> PriorityWaiter<'_> {
+        *self.counts.lock().entry(priority).or_insert(0) += 1;
+        self.refresh();
+        PriorityWaiter {
+            waiters: self,
+            priority,
+        }
+    }
+
+    fn refresh(&self) {
+        let counts = self.counts.lock();
+        let top = counts.keys().next_back().map_or(0, |p| *p as usize + 1);
+        self.top.store(top, Ordering::Relaxed);
+        self.mixed.store(counts.len() > 1, Ordering::Relaxed);
+    }
+
+    /// A waiter with priority above `priority` is parked.
+    fn outranks(&self, priority: u8) -> bool {
+        self.top.load(Ordering::Relaxed) > priority as usize + 1
+    }
+
+    fn mixed(&self) -> bool {
+        self.mixed.load(Ordering::Relaxed)
+    }
+}
+
+/// Registration of one Phase C waiter, removed on drop.
+struct PriorityWaiter<'a> {
+    waiters: &'a PriorityWaiters,
+    priority: u8,
+}
+
+impl Drop for PriorityWaiter<'_> {
+    fn drop(&mut self) {
+        {
+            let mut counts = self.waiters.counts.lock();
+            if let Some(count) = counts.get_mut(&self.priority) {
+                *count -= 1;
+                if *count == 0 {
+                    counts.remove(&self.priority);
+                }
+            }
+        }
+        self.waiters.refresh();
+    }
+}
+
 pub struct PoolCoordinator {
     database: String,
     db_semaphore: Semaphore,
@@ -133,6 +203,7 @@ pub struct PoolCoordinator {
     /// Phase C handles both cases uniformly: on every wake it retries
     /// `eviction_source.try_evict_one(user)` before `try_acquire()`.
     connection_returned: Notify,
+    waiters: PriorityWaiters,
     config: CoordinatorConfig,
     evictions_total: AtomicU64,
     reserve_acquisitions_total: AtomicU64,
@@ -163,7 +234,7 @@ const ARBITER_RESPONSE_TIMEOUT: Duration = Duration::from_millis(100);
 
 struct ReserveRequest {
     user: String,
-    score: (u8, usize), // (starving, queued_clients)
+    score: (u8, u8, usize), // (starving, priority, queued_clients)
     response: tokio::sync::oneshot::Sender<ReserveGrant>,
 }
 
@@ -198,6 +269,7 @@ impl PoolCoordinator {
             total_connections: AtomicUsize::new(0),
             reserve_in_use: AtomicUsize::new(0),
             connection_returned: Notify::new(),
+            waiters: PriorityWaiters::default(),
             evictions_total: AtomicU64::new(0),
             reserve_acquisitions_total: AtomicU64::new(0),
             exhaustions_total: AtomicU64::new(0),
@@ -229,6 +301,24 @@ impl PoolCoordinator {
         }
     }
 
+    /// `try_acquire` unless a caller with a higher queue priority is
+    /// waiting for a permit.
+    pub fn try_acquire_ranked(self: &Arc<Self>, priority: u8) -> Option<CoordinatorPermit> {
+        if self.waiters.outranks(priority) {
+            return None;
+        }
+        self.try_acquire()
+    }
+
+    /// Wake Phase C waiters after a permit or an idle connection came back.
+    fn wake_waiters(&self) {
+        if self.waiters.mixed() {
+            self.connection_returned.notify_waiters();
+        } else {
+            self.connection_returned.notify_one();
+        }
+    }
+
     /// Full acquisition path: try → reserve-first → evict → wait → reserve → error.
     ///
     /// Reserve-first short-circuit: after Phase A proves the database is
@@ -247,6 +337,10 @@ impl PoolCoordinator {
     /// pressure — that is exactly the job it is doing here. Eviction and
     /// Phase C wait stay as the fallback path for the case where the reserve
     /// is already fully used.
+    ///
+    /// Queue priority (`EvictionSource::priority`): while a higher-priority
+    /// caller is parked in Phase C, the free-permit paths and eviction are
+    /// skipped, so a freed slot goes to the more important user first.
     pub async fn acquire(
         self: &Arc<Self>,
         database: &str,
@@ -254,9 +348,10 @@ impl PoolCoordinator {
         eviction_source: &dyn EvictionSource,
     ) -> Result<CoordinatorPermit, AcquireError> {
         let max = self.config.max_db_connections;
+        let priority = eviction_source.priority(user);
 
         // Phase A: fast path — non-blocking semaphore acquire
-        if let Some(permit) = self.try_acquire() {
+        if let Some(permit) = self.try_acquire_ranked(priority) {
             debug!(
                 "[{}@{}] coordinator: permit acquired via fast path \
                  (active={}/{})",
@@ -282,7 +377,7 @@ impl PoolCoordinator {
         // closing a peer backend that didn't need to be closed is
         // unrecoverable damage, and a single extra atomic CAS is essentially
         // free compared to the alternative.
-        if let Some(permit) = self.try_acquire() {
+        if let Some(permit) = self.try_acquire_ranked(priority) {
             debug!(
                 "[{}@{}] coordinator: permit became free between fast-path \
                  tries, reserve/eviction avoided (active={}/{})",
@@ -314,8 +409,11 @@ impl PoolCoordinator {
             // Phase C wakes before we end up back at the Phase D retry.
         }
 
-        // Phase B: try eviction — close an idle connection from another user
-        let evicted = eviction_source.try_evict_one(user);
+        // Phase B: try eviction — close an idle connection from another user.
+        // Skipped while a higher-priority caller waits: the freed slot
+        // would be theirs.
+        let outranked = self.waiters.outranks(priority);
+        let evicted = !outranked && eviction_source.try_evict_one(user);
         if evicted {
             self.evictions_total.fetch_add(1, Ordering::Relaxed);
             if let Some(permit) = self.try_acquire() {
@@ -337,6 +435,12 @@ impl PoolCoordinator {
                 self.total_connections.load(Ordering::Relaxed),
                 max,
             );
+        } else if outranked {
+            debug!(
+                "[{}@{}] coordinator: higher-priority caller waiting, \
+                 eviction skipped (priority={})",
+                user, database, priority,
+            );
         } else {
             debug!(
                 "[{}@{}] coordinator: eviction found no eligible \
@@ -354,7 +458,12 @@ impl PoolCoordinator {
         // Register `notified()` BEFORE `try_acquire()` so that the
         // `notify_one` from CoordinatorPermit::drop is not lost.
         let timeout_ms = self.config.reserve_pool_timeout_ms;
-        let deadline = tokio::time::Instant::now() + Duration::from_millis(timeout_ms);
+        let wait_start = tokio::time::Instant::now();
+        let deadline = wait_start + Duration::from_millis(timeout_ms);
+        // Starvation protection: defer to higher priorities only for the
+        // first half of the wait, then compete for permits as usual.
+        let defer_until = wait_start + Duration::from_millis(timeout_ms / 2);
+        let _waiter = self.waiters.register(priority);
         let mut wait_wakeups = 0u32;
 
         debug!(
@@ -379,6 +488,23 @@ impl PoolCoordinator {
             // `Pool::timeout_get`.
             let notified = self.connection_returned.notified();
 
+            // Defer to a higher-priority waiter: leave freed permits and
+            // eviction to them until `defer_until`.
+            if tokio::time::Instant::now() < defer_until && self.waiters.outranks(priority) {
+                debug!(
+                    "[{}@{}] coordinator: deferring to higher-priority waiter \
+                     (priority={}, wakeups={})",
+                    user, database, priority, wait_wakeups,
+                );
+                tokio::select! {
+                    _ = notified => {
+                        wait_wakeups += 1;
+                    }
+                    _ = tokio::time::sleep_until(defer_until) => {}
+                }
+                continue;
+            }
+
             // Cheap path first: a previous wake (or any concurrent
             // `CoordinatorPermit::drop`) may have already left a free permit
             // in the semaphore. `try_evict_one` would close a peer connection
@@ -519,7 +645,7 @@ impl PoolCoordinator {
     /// timeout into Phase D even though the cross-pool system had headroom
     /// every few milliseconds.
     pub(crate) fn notify_idle_returned(&self) {
-        self.connection_returned.notify_one();
+        self.wake_waiters();
     }
 
     /// Send a reserve request to the arbiter and wait for the grant.
@@ -535,15 +661,17 @@ impl PoolCoordinator {
     ) -> Option<CoordinatorPermit> {
         let max = self.config.max_db_connections;
         let starving = u8::from(eviction_source.is_starving(user));
+        let priority = eviction_source.priority(user);
         let queued = eviction_source.queued_clients(user);
         let reserve_in_use = self.reserve_in_use.load(Ordering::Relaxed);
 
         debug!(
             "[{}@{}] coordinator: requesting reserve permit \
-             (starving={}, queued_clients={}, reserve_in_use={}/{})",
+             (starving={}, priority={}, queued_clients={}, reserve_in_use={}/{})",
             user,
             database,
             starving == 1,
+            priority,
             queued,
             reserve_in_use,
             self.config.reserve_pool_size,
@@ -555,7 +683,7 @@ impl PoolCoordinator {
             .reserve_tx
             .send(ReserveRequest {
                 user: user.to_string(),
-                score: (starving, queued),
+                score: (starving, priority, queued),
                 response: tx,
             })
             .await
@@ -731,8 +859,8 @@ async fn reserve_arbiter(
         while let Ok(req) = rx.try_recv() {
             debug!(
                 "[{}@{}] arbiter: received reserve request \
-                 (score=starving:{}, queued:{})",
-                req.user, coordinator.database, req.score.0, req.score.1,
+                 (score=starving:{}, priority:{}, queued:{})",
+                req.user, coordinator.database, req.score.0, req.score.1, req.score.2,
             );
             pending.push(req);
         }
@@ -747,8 +875,8 @@ async fn reserve_arbiter(
                 if sent.is_ok() {
                     debug!(
                         "[{}@{}] arbiter: granted reserve permit \
-                         (score=starving:{}, queued:{})",
-                        req.user, coordinator.database, req.score.0, req.score.1,
+                         (score=starving:{}, priority:{}, queued:{})",
+                        req.user, coordinator.database, req.score.0, req.score.1, req.score.2,
                     );
                 } else {
                     debug!(
@@ -810,8 +938,8 @@ async fn reserve_arbiter(
                     Some(req) => {
                         debug!(
                             "[pool: {}] arbiter: received reserve request from '{}' \
-                             (score=starving:{}, queued:{})",
-                            coordinator.database, req.user, req.score.0, req.score.1,
+                             (score=starving:{}, priority:{}, queued:{})",
+                            coordinator.database, req.user, req.score.0, req.score.1, req.score.2,
                         );
                         pending.push(req);
                     }
@@ -967,13 +1095,120 @@ mod tests {
         assert!(!result.unwrap().is_reserve);
     }
 
+    // --- Queue priority tests ---
+
+    /// Eviction mock where users named `oltp*` have priority 10.
+    struct PriorityEviction;
+    impl EvictionSource for PriorityEviction {
+        fn try_evict_one(&self, _user: &str) -> bool {
+            false
+        }
+        fn queued_clients(&self, _user: &str) -> usize {
+            0
+        }
+        fn is_starving(&self, _user: &str) -> bool {
+            false
+        }
+        fn priority(&self, user: &str) -> u8 {
+            if user.starts_with("oltp") {
+                10
+            } else {
+                0
+            }
+        }
+    }
+
+    #[test]
+    fn priority_waiters_track_top_and_mix() {
+        let waiters = PriorityWaiters::default();
+        assert!(!waiters.outranks(0));
+        let low = waiters.register(0);
+        assert!(!waiters.outranks(0));
+        assert!(!waiters.mixed());
+        let high = waiters.register(5);
+        assert!(waiters.outranks(0));
+        assert!(waiters.outranks(4));
+        assert!(!waiters.outranks(5));
+        assert!(waiters.mixed());
+        drop(high);
+        assert!(!waiters.outranks(0));
+        assert!(!waiters.mixed());
+        drop(low);
+        assert_eq!(waiters.top.load(Ordering::Relaxed), 0);
+    }
+
+    #[tokio::test]
+    async fn try_acquire_ranked_yields_to_higher_waiter() {
+        let coord = PoolCoordinator::new("test_db".to_string(), test_config(2, 0));
+        let high = coord.waiters.register(3);
+        assert!(coord.try_acquire_ranked(1).is_none());
+        let permit = coord.try_acquire_ranked(3).unwrap();
+        drop(high);
+        assert!(coord.try_acquire_ranked(1).is_some());
+        drop(permit);
+    }
+
+    #[tokio::test]
+    async fn freed_permit_goes_to_higher_priority_waiter() {
+        let config = CoordinatorConfig {
+            reserve_pool_timeout_ms: 2000,
+            ..test_config(1, 0)
+        };
+        let coord = PoolCoordinator::new("test_db".to_string(), config);
+        let held = coord.try_acquire().unwrap();
+
+        let c = coord.clone();
+        let batch =
+            tokio::spawn(async move { c.acquire("testdb", "batch", &PriorityEviction).await });
+        tokio::time::sleep(Duration::from_millis(10)).await;
+        let c = coord.clone();
+        let oltp =
+            tokio::spawn(async move { c.acquire("testdb", "oltp", &PriorityEviction).await });
+        tokio::time::sleep(Duration::from_millis(10)).await;
+
+        drop(held);
+        let permit = oltp.await.unwrap().unwrap();
+        assert!(
+            !batch.is_finished(),
+            "batch waited longer but has lower priority"
+        );
+
+        drop(permit);
+        assert!(batch.await.unwrap().is_ok());
+    }
+
+    #[tokio::test]
+    async fn low_priority_waiter_stops_deferring_after_half_the_wait() {
+        let config = CoordinatorConfig {
+            reserve_pool_timeout_ms: 200,
+            ..test_config(1, 0)
+        };
+        let coord = PoolCoordinator::new("test_db".to_string(), config);
+        // A higher-priority waiter that never takes the free permit.
+        let _high = coord.waiters.register(10);
+
+        let start = std::time::Instant::now();
+        let permit = coord
+            .acquire("testdb", "batch", &PriorityEviction)
+            .await
+            .unwrap();
+        let waited = start.elapsed();
+        assert!(!permit.is_reserve);
+        assert!(waited >= Duration::from_millis(90), "waited {waited:?}");
+        assert!(waited < Duration::from_millis(200), "waited {waited:?}");
+    }
+
     // --- ReserveRequest ordering tests ---
 
     fn make_request(starving: u8, queued: usize) -> ReserveRequest {
+        make_priority_request(starving, 0, queued)
+    }
+
+    fn make_priority_request(starving: u8, priority: u8, queued: usize) -> ReserveRequest {
         let (tx, _rx) = tokio::sync::oneshot::channel();
         ReserveRequest {
             user: "test".to_string(),
-            score: (starving, queued),
+            score: (starving, priority, queued),
             response: tx,
         }
     }
@@ -986,6 +1221,15 @@ mod tests {
         assert!(starving > normal);
     }
 
+    #[test]
+    fn reserve_ordering_priority_beats_queued_but_not_starving() {
+        let oltp = make_priority_request(0, 10, 1);
+        let batch = make_priority_request(0, 0, 100);
+        let starving_batch = make_priority_request(1, 0, 1);
+        assert!(oltp > batch);
+        assert!(starving_batch > oltp);
+    }
+
     #[test]
     fn reserve_ordering_more_queued_wins() {
         let many = make_request(0, 50);
@@ -1009,9 +1253,9 @@ mod tests {
         heap.push(make_request(0, 50));
 
         let top = heap.pop().unwrap();
-        assert_eq!(top.score, (1, 1)); // starving wins
+        assert_eq!(top.score, (1, 0, 1)); // starving wins
         let next = heap.pop().unwrap();
-        assert_eq!(next.score, (0, 50)); // most queued among non-starving
+        assert_eq!(next.score, (0, 0, 50)); // most queued among non-starving
     }
 
     #[tokio::test]
@@ -1025,7 +1269,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "leaker".to_string(),
-                score: (0, 1),
+                score: (0, 0, 1),
                 response: tx,
             })
             .await;
@@ -1079,7 +1323,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "test".to_string(),
-                score: (0, 1),
+                score: (0, 0, 1),
                 response: tx,
             })
             .await;
@@ -1648,7 +1892,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "low".to_string(),
-                score: (0, 2), // not starving, 2 queued
+                score: (0, 0, 2), // not starving, 2 queued
                 response: tx_low,
             })
             .await;
@@ -1659,7 +1903,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "high".to_string(),
-                score: (1, 1), // starving — absolute priority
+                score: (1, 0, 1), // starving — absolute priority
                 response: tx_high,
             })
             .await;
@@ -2243,7 +2487,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "low".to_string(),
-                score: (0, 1), // not starving, 1 queued
+                score: (0, 0, 1), // not starving, 1 queued
                 response: tx1,
             })
             .await;
@@ -2251,7 +2495,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "mid".to_string(),
-                score: (0, 10), // not starving, 10 queued
+                score: (0, 0, 10), // not starving, 10 queued
                 response: tx2,
             })
             .await;
@@ -2259,7 +2503,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "high".to_string(),
-                score: (1, 5), // starving — highest priority
+                score: (1, 0, 5), // starving — highest priority
                 response: tx3,
             })
             .await;
@@ -2318,7 +2562,7 @@ mod tests {
             .reserve_tx
             .send(ReserveRequest {
                 user: "orphan".to_string(),
-                score: (0, 1),
+                score: (0, 0, 1),
                 response: tx,
             })
             .await;
@@ -2363,7 +2607,7 @@ mod tests {
                 .reserve_tx
                 .send(ReserveRequest {
                     user: format!("flood_{i}"),
-                    score: (0, i), // ascending priority
+                    score: (0, 0, i), // ascending priority
                     response: tx,
                 })
                 .await;
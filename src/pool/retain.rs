@@ -16,6 +16,9 @@ impl ConnectionPool {
     /// If `max` > 0, at most `max` connections will be closed across all pools,
     /// prioritizing the oldest connections first.
     ///
+    /// Idle timeout stops at the user's `min_pool_size`; server lifetime
+    /// does not, so long-lived connections still rotate.
+    ///
     /// Pools under client pressure are skipped: closing an idle connection
     /// the moment a client is queued behind it just turns a free recycle
     /// into a fresh connect on the wait path.
@@ -24,24 +27,6 @@ impl ConnectionPool {
             return 0;
         }
 
-        // Closure to determine if a connection should be closed
-        // Uses per-connection timeouts with jitter to prevent mass closures
-        let should_close = |_: &crate::server::Server, metrics: &crate::pool::Metrics| -> bool {
-            // Check idle timeout (per-connection with jitter, 0 = disabled)
-            if metrics.idle_timeout_ms > 0 {
-                if let Some(v) = metrics.recycled {
-                    if (v.elapsed().as_millis() as u64) > metrics.idle_timeout_ms {
-                        return true;
-                    }
-                }
-            }
-            // Check server lifetime (per-connection with jitter, 0 = disabled)
-            if metrics.lifetime_ms > 0 && (metrics.age().as_millis() as u64) > metrics.lifetime_ms {
-                return true;
-            }
-            false
-        };
-
         // Calculate remaining quota for this pool
         let current_count = count.load(Ordering::Relaxed);
         if max > 0 && current_count >= max {
@@ -53,10 +38,50 @@ impl ConnectionPool {
             0 // 0 means unlimited
         };
 
+        // Server lifetime (per-connection with jitter, 0 = disabled). Expired
+        // connections are always rotated; the replenish phase refills the
+        // floor afterwards.
+        let lifetime_expired =
+            |_: &crate::server::Server, metrics: &crate::pool::Metrics| -> bool {
+                metrics.lifetime_ms > 0 && (metrics.age().as_millis() as u64) > metrics.lifetime_ms
+            };
+        // Idle timeout (per-connection with jitter, 0 = disabled).
+        let idle_expired = |_: &crate::server::Server, metrics: &crate::pool::Metrics| -> bool {
+            metrics.idle_timeout_ms > 0
+                && metrics
+                    .recycled
+                    .is_some_and(|v| (v.elapsed().as_millis() as u64) > metrics.idle_timeout_ms)
+        };
+
         // Use retain_oldest_first which sorts by age when max > 0
-        let closed = self
-            .database
-            .retain_oldest_first(should_close, max_to_close);
+        let mut closed =
+            self.database
+                .retain_oldest_first("server_lifetime", lifetime_expired, max_to_close);
+
+        // Idle expiry never shrinks the pool below min_pool_size: closing a
+        // quiet connection only to reopen it in the replenish phase is pure
+        // churn, and the next client after a quiet period should find a warm
+        // server instead of paying for a fresh connect.
+        let quota_left = if max_to_close > 0 {
+            max_to_close.saturating_sub(closed)
+        } else {
+            usize::MAX
+        };
+        let idle_budget = idle_close_budget(
+            self.database.status().size,
+            self.settings.user.min_pool_size,
+            quota_left,
+        );
+        if idle_budget > 0 {
+            let limit = if idle_budget == usize::MAX {
+                0
+            } else {
+                idle_budget
+            };
+            closed += self
+                .database
+                .retain_oldest_first("server_idle_timeout", idle_expired, limit);
+        }
         count.fetch_add(closed, Ordering::Relaxed);
 
         if closed > 0 {
@@ -92,7 +117,7 @@ impl ConnectionPool {
         let idle_before = status_before.available;
 
         // Close all idle connections by returning false for all
-        self.database.retain(|_, _| false);
+        self.database.retain("shutdown", |_, _| false);
 
         let status_after = self.database.status();
         let closed = idle_before.saturating_sub(status_after.available);
@@ -109,6 +134,39 @@ impl ConnectionPool {
 
         closed
     }
+
+    /// Close the idle connections to hosts taken out of rotation (`DISABLE
+    /// HOST`, or dropped from `server_host` by a reload). Connections in use
+    /// are closed when they come back, by the recycle check.
+    pub fn drain_hosts_out_of_rotation(&self) -> usize {
+        let Some(hosts) = self.database.host_list() else {
+            return 0;
+        };
+        let closed = self.database.retain_oldest_first(
+            "host_out_of_rotation",
+            |server, _| hosts.is_draining(&server.address.host, server.address.port),
+            0,
+        );
+        if closed > 0 {
+            info!(
+                "[{}@{}] closed {} idle server{} on hosts out of rotation",
+                self.address.username,
+                self.address.pool_name,
+                closed,
+                if closed == 1 { "" } else { "s" }
+            );
+        }
+        closed
+    }
+}
+
+/// How many idle-expired connections a pool of `size` may close with
+/// `quota_left` of the cycle's quota: idle expiry stops at `min_pool_size`.
+fn idle_close_budget(size: usize, min_pool_size: Option<u32>, quota_left: usize) -> usize {
+    match min_pool_size {
+        Some(min) => size.saturating_sub(min as usize).min(quota_left),
+        None => quota_left,
+    }
 }
 
 pub async fn retain_connections() {
@@ -221,6 +279,7 @@ pub async fn retain_connections() {
             pool.retain_pool_connections(count.clone(), retain_max);
         }
         count.store(0, Ordering::Relaxed);
+        crate::server::scram_relay::expire();
 
         // Replenish pools below min_pool_size
         for pool in &pool_refs {
@@ -342,11 +401,15 @@ mod tests {
                 life_time_ms: 1, // tiny: any connection would be "expired"
                 sync_server_parameters: false,
                 min_guaranteed_pool_size: 0,
+                statement_rules: None,
+                rewrite_rules: None,
+                server_version: None,
             },
             config_hash: 0,
             per_user_startup_overlay_hash: crate::pool::empty_overlay_hash(),
             prepared_statement_cache: None,
             check_query_cache: Arc::new(crate::pool::CheckQueryCache::new()),
+            show_cache: Arc::new(DashMap::new()),
             coordinator: None,
             replenish_failures: Arc::new(AtomicU32::new(0)),
             init_complete: Arc::new(AtomicBool::new(true)),
@@ -386,4 +449,25 @@ mod tests {
             "shared retain counter must not advance",
         );
     }
+
+    /// Idle expiry never takes a pool below `min_pool_size`, whatever the
+    /// pool size and the quota left.
+    #[test]
+    fn idle_budget_never_drops_below_min_pool_size() {
+        assert_eq!(idle_close_budget(5, Some(3), usize::MAX), 2);
+        assert_eq!(idle_close_budget(3, Some(3), usize::MAX), 0);
+        assert_eq!(idle_close_budget(1, Some(3), usize::MAX), 0);
+        assert_eq!(idle_close_budget(10, Some(3), 4), 4);
+        assert_eq!(idle_close_budget(5, None, usize::MAX), usize::MAX);
+
+        for size in 0..20 {
+            for min in 0..10u32 {
+                let closed = idle_close_budget(size, Some(min), usize::MAX);
+                assert!(
+                    size - closed >= size.min(min as usize),
+                    "size={size} min_pool_size={min} closes {closed}",
+                );
+            }
+        }
+    }
 }
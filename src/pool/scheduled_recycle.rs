@@ -0,0 +1,149 @@
+//! Scheduled server connection recycling (`general.server_recycle_windows`).
+//!
+//! Inside a maintenance window, idle server connections opened before the
+//! window started are closed at `server_recycle_rate` per second across all
+//! pools, oldest first; connections in use are picked up once they come
+//! back. After a nightly restart or upgrade of PostgreSQL the pool is thus
+//! re-established gradually during the window instead of all at once when
+//! the old connections hit `server_lifetime` at peak.
+
+use chrono::{Datelike, Local, Timelike};
+use log::info;
+use rand::seq::SliceRandom;
+
+use crate::config::{config_arc, RecycleWindow};
+
+use super::get_all_pools;
+
+/// The window currently open, if any.
+struct OpenWindow {
+    spec: String,
+    recycled: usize,
+}
+
+impl OpenWindow {
+    fn log_closed(self) {
+        info!(
+            "server recycle window \"{}\" closed: {} server connection{} recycled",
+            self.spec,
+            self.recycled,
+            if self.recycled == 1 { "" } else { "s" },
+        );
+    }
+}
+
+/// Seconds since the longest-open configured window started, and its spec.
+fn open_window(specs: &[String], weekday: usize, second: u32) -> Option<(u32, &str)> {
+    specs
+        .iter()
+        .filter_map(|spec| {
+            let window = RecycleWindow::parse(spec).ok()?;
+            Some((window.open_for(weekday, second)?, spec.as_str()))
+        })
+        .max_by_key(|(elapsed, _)| *elapsed)
+}
+
+/// Spawn the scheduled recycling task. Idles while
+/// `server_recycle_windows` is empty.
+pub fn spawn_scheduled_recycle() {
+    tokio::spawn(async move {
+        let mut tick = tokio::time::interval(std::time::Duration::from_secs(1));
+        let mut current: Option<OpenWindow> = None;
+        loop {
+            tick.tick().await;
+            let config = config_arc();
+            let now = Local::now();
+            let weekday = now.weekday().num_days_from_monday() as usize;
+            let open = open_window(
+                &config.general.server_recycle_windows,
+                weekday,
+                now.num_seconds_from_midnight(),
+            );
+
+            let Some((elapsed, spec)) = open else {
+                if let Some(window) = current.take() {
+                    window.log_closed();
+                }
+                continue;
+            };
+            if current.as_ref().is_none_or(|window| window.spec != spec) {
+                if let Some(window) = current.take() {
+                    window.log_closed();
+                }
+                info!(
+                    "server recycle window \"{spec}\" opened: recycling server connections \
+                     opened before it, up to {}/s",
+                    config.general.server_recycle_rate,
+                );
+                current = Some(OpenWindow {
+                    spec: spec.to_string(),
+                    recycled: 0,
+                });
+            }
+            if let Some(window) = current.as_mut() {
+                window.recycled += recycle_step(
+                    std::time::Duration::from_secs(elapsed as u64),
+                    config.general.server_recycle_rate,
+                );
+            }
+        }
+    });
+}
+
+/// Closes up to `budget` idle connections older than `opened_ago`, skipping
+/// pools under client pressure. Returns the number closed.
+fn recycle_step(opened_ago: std::time::Duration, budget: usize) -> usize {
+    let pools = get_all_pools();
+    // Same reason as the retain loop: HashMap order is fixed within a
+    // process, so without shuffling one pool would take the whole budget.
+    let mut pool_refs: Vec<_> = pools.values().collect();
+    pool_refs.shuffle(&mut rand::rng());
+
+    let mut closed = 0;
+    for pool in pool_refs {
+        if closed >= budget {
+            break;
+        }
+        if pool.database.under_pressure() || pool.database.is_paused() {
+            continue;
+        }
+        let n = pool.database.retain_oldest_first(
+            "scheduled_recycle",
+            |_, metrics| metrics.age() > opened_ago,
+            budget - closed,
+        );
+        if n > 0 {
+            crate::web::metrics::record_scheduled_recycle(
+                &pool.address.username,
+                &pool.address.pool_name,
+                n,
+            );
+        }
+        closed += n;
+    }
+    closed
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn picks_longest_open_window() {
+        let specs = vec![
+            "Mon 02:00-04:00".to_string(),
+            "01:00-03:00".to_string(),
+            "bogus".to_string(),
+        ];
+        assert_eq!(
+            open_window(&specs, 0, 2 * 3600),
+            Some((3600, "01:00-03:00"))
+        );
+        assert_eq!(
+            open_window(&specs, 0, 3 * 3600 + 60),
+            Some((3660, "Mon 02:00-04:00"))
+        );
+        assert_eq!(open_window(&specs, 1, 3 * 3600 + 60), None);
+        assert_eq!(open_window(&[], 0, 0), None);
+    }
+}
@@ -16,7 +16,7 @@ use crate::config::startup_parameters as sp;
 use crate::config::{Address, User};
 use crate::errors::Error;
 use crate::patroni::types::Role;
-use crate::server::Server;
+use crate::server::{Server, StreamInner};
 use crate::stats::ServerStats;
 use crate::utils::format_duration_ms;
 
@@ -207,8 +207,9 @@ pub struct ServerPool {
     /// Hard upper bound on how long a single client may wait for a server
     /// connection. Used as the outer deadline around the entire fallback
     /// path: there's no point spending more time than the client itself is
-    /// willing to wait. Sourced from `general.query_wait_timeout`.
-    query_wait_timeout: Duration,
+    /// willing to wait. Sourced from `general.query_wait_timeout`, in
+    /// milliseconds; `SET query_wait_timeout` and RELOAD replace it.
+    query_wait_timeout_ms: AtomicU64,
 
     /// Session mode flag passed to created Server connections.
     session_mode: bool,
@@ -216,9 +217,27 @@ pub struct ServerPool {
     /// Patroni-assisted fallback state.
     fallback_state: Option<Arc<super::fallback::FallbackState>>,
 
-    /// Combined pool state: bit 32 = paused, bits 0-31 = reconnect epoch (u32).
+    /// Ordered host list for multi-host `server_host`. When set, `address`
+    /// holds the first host and serves only as the pool identity.
+    host_list: Option<Arc<super::multi_host::HostList>>,
+
+    /// Connect retry policy and login-failure circuit breaker.
+    connect_retry: super::connect_retry::ConnectRetry,
+
+    /// Backend memory limit (`server_max_memory`); None when unset.
+    memory_limit: Option<super::backend_memory::MemoryLimit>,
+
+    /// Backend circuit breaker (`circuit_breaker_threshold`); None when off.
+    circuit_breaker: Option<super::circuit_breaker::CircuitBreaker>,
+
+    /// Combined pool state: bit 33 = held, bit 32 = paused, bits 0-31 =
+    /// reconnect epoch (u32).
     pool_state: AtomicU64,
 
+    /// Generation of the latest `HOLD`, so an expiry timer of an earlier
+    /// hold does not end a later one.
+    holds: AtomicU64,
+
     /// Notify to wake up clients blocked on PAUSE.
     resume_notify: Notify,
 
@@ -339,11 +358,16 @@ impl ServerPool {
             idle_timeout_ms,
             idle_check_timeout_ms,
             connect_timeout,
-            query_wait_timeout,
+            query_wait_timeout_ms: AtomicU64::new(query_wait_timeout.as_millis() as u64),
             pool_state: AtomicU64::new(0),
+            holds: AtomicU64::new(0),
             resume_notify: Notify::new(),
             session_mode,
             fallback_state,
+            host_list: None,
+            connect_retry: super::connect_retry::ConnectRetry::default(),
+            memory_limit: None,
+            circuit_breaker: None,
             per_user_startup_overlay,
             operator_managed_startup_keys,
             resolved_startup_map,
@@ -351,6 +375,41 @@ impl ServerPool {
         }
     }
 
+    /// Attach the ordered host list built from a multi-host `server_host`.
+    pub fn with_host_list(mut self, host_list: Option<Arc<super::multi_host::HostList>>) -> Self {
+        self.host_list = host_list;
+        self
+    }
+
+    /// Set the connect retry policy (`server_connect_attempts`,
+    /// `server_connect_backoff`, `server_login_retry`).
+    pub fn with_connect_retry(mut self, connect_retry: super::connect_retry::ConnectRetry) -> Self {
+        self.connect_retry = connect_retry;
+        self
+    }
+
+    /// Set the backend memory limit (`server_max_memory`).
+    pub fn with_memory_limit(
+        mut self,
+        memory_limit: Option<super::backend_memory::MemoryLimit>,
+    ) -> Self {
+        self.memory_limit = memory_limit;
+        self
+    }
+
+    /// Set the backend circuit breaker (`circuit_breaker_threshold`).
+    pub fn with_circuit_breaker(
+        mut self,
+        circuit_breaker: Option<super::circuit_breaker::CircuitBreaker>,
+    ) -> Self {
+        self.circuit_breaker = circuit_breaker;
+        self
+    }
+
+    pub(crate) fn circuit_breaker(&self) -> Option<&super::circuit_breaker::CircuitBreaker> {
+        self.circuit_breaker.as_ref()
+    }
+
     /// See `operator_managed_startup_keys` field.
     pub fn operator_managed_startup_keys(&self) -> Arc<HashSet<String>> {
         self.operator_managed_startup_keys.clone()
@@ -405,15 +464,6 @@ impl ServerPool {
             }
         }
 
-        let conn_num = self.connection_counter.fetch_add(1, Ordering::Relaxed) + 1;
-        info!(
-            "[{}@{}] new server connection #{} to {}:{}",
-            self.address.username,
-            self.address.pool_name,
-            conn_num,
-            self.address.host,
-            self.address.port,
-        );
         // Resolve before any `ServerStats` is registered. The budget
         // preflight can return `ServerStartupParameterRejection`; if we
         // had already published the stats entry via `stats.register`,
@@ -424,8 +474,96 @@ impl ServerPool {
         // sslmode=allow retry still see one parameter set.
         let startup_parameters = self.resolved_startup_parameters()?;
 
+        let mut attempt = 1;
+        let result = loop {
+            let result = match self.host_list {
+                Some(ref hosts) => self.connect_host_list(hosts, &startup_parameters).await,
+                None => self.connect_to(&self.address, &startup_parameters).await,
+            };
+            match result {
+                Err(ref err)
+                    if attempt < self.connect_retry.attempts() && is_backend_unreachable(err) =>
+                {
+                    let delay = self.connect_retry.backoff(attempt);
+                    warn!(
+                        "[{}@{}] connect attempt {}/{} failed: {err}; retrying in {}",
+                        self.address.username,
+                        self.address.pool_name,
+                        attempt,
+                        self.connect_retry.attempts(),
+                        format_duration_ms(delay.as_millis() as u64),
+                    );
+                    tokio::time::sleep(delay).await;
+                    attempt += 1;
+                }
+                result => break result,
+            }
+        };
+
+        match result {
+            Ok(conn) => {
+                // Permit is released automatically when _permit goes out of scope
+                conn.stats.idle(0);
+                Ok(conn)
+            }
+            Err(err) => {
+                // Local backend unreachable + Patroni-assisted fallback configured: route via fallback.
+                if is_backend_unreachable(&err) {
+                    if let Some(ref fallback) = self.fallback_state {
+                        fallback.blacklist();
+                        crate::web::metrics::FALLBACK_ACTIVE
+                            .with_label_values(&[&self.address.pool_name])
+                            .set(1.0);
+                        info!(
+                            "[{}@{}] fallback: routing through fallback (original error: {err})",
+                            self.address.username, self.address.pool_name,
+                        );
+                        return self.create_fallback_connection().await;
+                    }
+                }
+                // Brief backoff on error to avoid hammering a failing server
+                tokio::time::sleep(Duration::from_millis(10)).await;
+                Err(err)
+            }
+        }
+    }
+
+    /// Open a connection to `host:port` outside the pool, for a query of
+    /// pg_doorman's own against a backend of the pool, such as terminating
+    /// it. It neither waits for nor takes a pool slot, and is closed when
+    /// dropped.
+    pub(crate) async fn connect_unpooled(&self, host: &str, port: u16) -> Result<Server, Error> {
+        let startup_parameters = self.resolved_startup_parameters()?;
+        let mut address = self.address.clone();
+        address.host = host.to_string();
+        address.port = port;
+        self.connect_to(&address, &startup_parameters).await
+    }
+
+    /// Start one backend connection to `address`, including the
+    /// sslmode=allow TLS retry. Stats registered for a failed attempt are
+    /// disconnected before returning.
+    async fn connect_to(
+        &self,
+        address: &Address,
+        startup_parameters: &BTreeMap<String, String>,
+    ) -> Result<Server, Error> {
+        if let Some(err) = self.connect_retry.blocked(&address.host, address.port) {
+            debug!(
+                "[{}@{}] {}:{} blocked after login failure (server_login_retry)",
+                address.username, address.pool_name, address.host, address.port,
+            );
+            return Err(err);
+        }
+
+        let conn_num = self.connection_counter.fetch_add(1, Ordering::Relaxed) + 1;
+        info!(
+            "[{}@{}] new server connection #{} to {}:{}",
+            address.username, address.pool_name, conn_num, address.host, address.port,
+        );
+
         let stats = Arc::new(ServerStats::new(
-            self.address.clone(),
+            address.clone(),
             crate::utils::clock::now(),
         ));
 
@@ -433,10 +571,10 @@ impl ServerPool {
 
         let result = startup_with_timeout(
             self.connect_timeout,
-            &self.address.host,
-            self.address.port,
+            &address.host,
+            address.port,
             Server::startup(
-                &self.address,
+                address,
                 &self.user,
                 &self.database,
                 self.client_server_map.clone(),
@@ -446,7 +584,7 @@ impl ServerPool {
                 self.prepared_statement_cache_size,
                 self.application_name.clone(),
                 self.session_mode,
-                &startup_parameters,
+                startup_parameters,
                 self.operator_managed_startup_keys.clone(),
             ),
         )
@@ -460,7 +598,7 @@ impl ServerPool {
         //
         // Reference: PostgreSQL docs, "SSL Support" → sslmode parameter.
         let should_tls_retry = match &result {
-            Err(err) if self.address.server_tls.mode.retries_with_tls() => !matches!(
+            Err(err) if address.server_tls.mode.retries_with_tls() => !matches!(
                 err,
                 Error::ConnectError(_)
                     | Error::ConnectResourceExhausted(_)
@@ -472,21 +610,22 @@ impl ServerPool {
         let (result, active_stats) = if should_tls_retry {
             info!(
                 "plain connection rejected, retrying with tls, user={} pool={} host={} port={} server_tls_mode=allow",
-                self.address.username, self.address.pool_name,
-                self.address.host, self.address.port,
+                address.username, address.pool_name,
+                address.host, address.port,
             );
             // Disconnect the plain-attempt stats before registering the TLS-retry stats.
             // Without this, both entries would remain in SERVER_STATS: the plain one
             // as a ghost if the retry succeeds, or the retry one leaking if it fails.
             stats.disconnect();
-            let mut retry_address = self.address.clone();
+            let mut retry_address = address.clone();
             retry_address.server_tls = std::sync::Arc::new(crate::config::tls::ServerTlsConfig {
                 mode: crate::config::tls::ServerTlsMode::Require,
-                connector: self.address.server_tls.connector.clone(),
-                cert_hash: self.address.server_tls.cert_hash,
+                connector: address.server_tls.connector.clone(),
+                direct: false,
+                cert_hash: address.server_tls.cert_hash,
             });
             let retry_stats = Arc::new(ServerStats::new(
-                self.address.clone(),
+                address.clone(),
                 crate::utils::clock::now(),
             ));
             retry_stats.register(retry_stats.clone());
@@ -505,7 +644,7 @@ impl ServerPool {
                     self.prepared_statement_cache_size,
                     self.application_name.clone(),
                     self.session_mode,
-                    &startup_parameters,
+                    startup_parameters,
                     self.operator_managed_startup_keys.clone(),
                 ),
             )
@@ -516,32 +655,113 @@ impl ServerPool {
         };
 
         match result {
-            Ok(conn) => {
-                // Permit is released automatically when _permit goes out of scope
-                conn.stats.idle(0);
-                Ok(conn)
+            Ok(_) => {
+                if self.connect_retry.unblock(&address.host, address.port) {
+                    info!(
+                        "[{}@{}] login to {}:{} succeeded, connections resumed",
+                        address.username, address.pool_name, address.host, address.port,
+                    );
+                }
             }
-            Err(err) => {
+            Err(ref err) => {
                 active_stats.disconnect();
-                // Local backend unreachable + Patroni-assisted fallback configured: route via fallback.
-                if is_backend_unreachable(&err) {
-                    if let Some(ref fallback) = self.fallback_state {
-                        fallback.blacklist();
-                        crate::web::metrics::FALLBACK_ACTIVE
-                            .with_label_values(&[&self.address.pool_name])
-                            .set(1.0);
-                        info!(
-                            "[{}@{}] fallback: routing through fallback (original error: {err})",
-                            self.address.username, self.address.pool_name,
-                        );
-                        return self.create_fallback_connection().await;
+                if is_backend_unreachable(err) {
+                    super::dns::refresh_after_failure(&address.host, address.port);
+                }
+                if super::connect_retry::is_login_failure(err)
+                    && self.connect_retry.block(&address.host, address.port, err)
+                {
+                    warn!(
+                        "[{}@{}] login to {}:{} failed: {err}; no new connections to this host for {} (server_login_retry)",
+                        address.username,
+                        address.pool_name,
+                        address.host,
+                        address.port,
+                        format_duration_ms(self.connect_retry.login_retry().as_millis() as u64),
+                    );
+                }
+            }
+        }
+        result
+    }
+
+    /// Try the hosts of a multi-host or SRV `server_host` in priority
+    /// order. Hosts that fail to connect or have the wrong role for
+    /// `target_session_attrs` go into cooldown; the last error is returned
+    /// when no host is usable. A connection on a non-preferred host gets a
+    /// bounded lifetime so the pool returns to the preferred host once it
+    /// is back.
+    async fn connect_host_list(
+        &self,
+        hosts: &super::multi_host::HostList,
+        startup_parameters: &BTreeMap<String, String>,
+    ) -> Result<Server, Error> {
+        // A switchover seen here retires older connections on their next
+        // recycle; the discovery poller also drains the idle ones.
+        if hosts.refresh(false).await? {
+            self.bump_epoch();
+        }
+        let mut last_err = None;
+        for candidate in hosts.candidates() {
+            let (host, port) = (candidate.host.as_str(), candidate.port);
+            let mut address = self.address.clone();
+            address.host = host.to_string();
+            address.port = port;
+
+            let mut conn = match self.connect_to(&address, startup_parameters).await {
+                Ok(conn) => conn,
+                // Another host would be rejected the same way.
+                Err(err) if is_host_independent_error(&err) => return Err(err),
+                Err(err) => {
+                    warn!(
+                        "[{}@{}] server_host {host}:{port} failed: {err}",
+                        self.address.username, self.address.pool_name,
+                    );
+                    hosts.mark_down(host, port);
+                    last_err = Some(err);
+                    continue;
+                }
+            };
+
+            match hosts.role_matches(&mut conn).await {
+                Ok(true) => {
+                    hosts.mark_up(host, port);
+                    conn.stats.track_host_load(hosts.load(host, port));
+                    if !hosts.is_preferred(host, port) {
+                        conn.override_lifetime_ms = Some(hosts.failover_lifetime_ms());
                     }
+                    return Ok(conn);
+                }
+                Ok(false) => {
+                    warn!(
+                        "[{}@{}] server_host {host}:{port} is not a {} (target_session_attrs), trying next host",
+                        self.address.username, self.address.pool_name, hosts.target(),
+                    );
+                    last_err = Some(Error::ConnectError(format!(
+                        "no server_host matches target_session_attrs={}",
+                        hosts.target()
+                    )));
+                }
+                Err(err) => {
+                    conn.mark_bad(&format!("target_session_attrs check failed: {err}"));
+                    last_err = Some(err);
                 }
-                // Brief backoff on error to avoid hammering a failing server
-                tokio::time::sleep(Duration::from_millis(10)).await;
-                Err(err)
             }
+            hosts.mark_down(host, port);
         }
+        // Every host failed: the SRV or Patroni answer may be out of date.
+        match hosts.refresh(true).await {
+            Ok(true) => {
+                self.bump_epoch();
+            }
+            Ok(false) => {}
+            Err(err) => warn!(
+                "[{}@{}] {err}",
+                self.address.username, self.address.pool_name
+            ),
+        }
+        Err(last_err
+            .unwrap_or_else(|| Error::ConnectError("server_host list has no hosts".to_string())))
     }
 
     /// Returns the address of this pool.
@@ -549,6 +769,26 @@ impl ServerPool {
         &self.address
     }
 
+    /// Open the backend connection a scram-passthrough login is relayed
+    /// on, up to its SCRAM challenge.
+    pub async fn scram_relay_connect(&self) -> Result<StreamInner, Error> {
+        let startup_parameters = self.resolved_startup_parameters()?;
+        let connect = crate::server::scram_relay::connect(
+            &self.address,
+            &self.database,
+            &self.application_name,
+            &startup_parameters,
+        );
+        tokio::time::timeout(self.connect_timeout, connect)
+            .await
+            .map_err(|_| {
+                Error::ConnectError(format!(
+                    "{}:{}: timed out opening a scram-passthrough connection",
+                    self.address.host, self.address.port
+                ))
+            })?
+    }
+
     /// Return the effective startup parameter cascade with the winning
     /// source layer **and** the application state for each key. Used by
     /// `SHOW STARTUP_PARAMETERS` and `/api/pools`.
@@ -588,8 +828,7 @@ impl ServerPool {
         let pool_params = cfg
             .pools
             .get(&self.address.pool_name)
-            .map(|p| &p.startup_parameters)
-            .cloned()
+            .map(|p| p.server_startup_parameters().into_owned())
             .unwrap_or_default();
         let auth_query_params: Option<std::collections::HashMap<String, String>> =
             match super::get_auth_query_state(&self.address.pool_name) {
@@ -741,10 +980,16 @@ impl ServerPool {
         }
     }
 
+    /// Replace the fallback deadline; fallbacks already running keep theirs.
+    pub(crate) fn set_query_wait_timeout(&self, timeout: Duration) {
+        self.query_wait_timeout_ms
+            .store(timeout.as_millis() as u64, Ordering::Relaxed);
+    }
+
     /// Establish a fallback connection within `query_wait_timeout`.
     async fn create_fallback_connection(&self) -> Result<Server, Error> {
         // Outer deadline bounds total fallback time for this checkout.
-        let deadline = self.query_wait_timeout;
+        let deadline = Duration::from_millis(self.query_wait_timeout_ms.load(Ordering::Relaxed));
         info!(
             "[{}@{}] fallback: local backend unavailable, entering fallback path (deadline={}ms)",
             self.address.username,
@@ -1110,6 +1355,7 @@ impl ServerPool {
             retry_address.server_tls = std::sync::Arc::new(crate::config::tls::ServerTlsConfig {
                 mode: crate::config::tls::ServerTlsMode::Require,
                 connector: fallback_address.server_tls.connector.clone(),
+                direct: false,
                 cert_hash: fallback_address.server_tls.cert_hash,
             });
             let retry_stats = Arc::new(ServerStats::new(
@@ -1165,8 +1411,16 @@ impl ServerPool {
         self.idle_timeout_ms
     }
 
+    /// Ordered backend host list, when `server_host` names several hosts or
+    /// the pool discovers its backends.
+    pub fn host_list(&self) -> Option<&Arc<super::multi_host::HostList>> {
+        self.host_list.as_ref()
+    }
+
     /// Bit flag for the paused state within `pool_state`.
     const PAUSED_BIT: u64 = 1 << 32;
+    /// Bit flag for the held state within `pool_state`.
+    const HELD_BIT: u64 = 1 << 33;
     /// Mask for the reconnect epoch (lower 32 bits) within `pool_state`.
     const EPOCH_MASK: u64 = 0xFFFF_FFFF;
 
@@ -1175,16 +1429,44 @@ impl ServerPool {
         self.pool_state.load(Ordering::Acquire) & Self::PAUSED_BIT != 0
     }
 
-    /// Sets the pool as paused.
+    /// Sets the pool as paused. Turns a hold into a plain pause, which
+    /// does not expire.
     pub fn pause(&self) {
         self.pool_state
             .fetch_or(Self::PAUSED_BIT, Ordering::Release);
+        self.pool_state
+            .fetch_and(!Self::HELD_BIT, Ordering::Release);
+    }
+
+    /// Returns whether the pool is held (`HOLD`). A held pool is also paused.
+    pub fn is_held(&self) -> bool {
+        self.pool_state.load(Ordering::Acquire) & Self::HELD_BIT != 0
+    }
+
+    /// Pauses the pool as a hold: checkouts wait for the hold to end
+    /// instead of `query_wait_timeout`. Returns the hold generation for
+    /// [`Self::release_hold`].
+    pub fn hold(&self) -> u64 {
+        let generation = self.holds.fetch_add(1, Ordering::AcqRel) + 1;
+        self.pool_state
+            .fetch_or(Self::PAUSED_BIT | Self::HELD_BIT, Ordering::Release);
+        generation
+    }
+
+    /// Resumes the pool if it is still under the hold `generation`; returns
+    /// whether it did. A later `HOLD`, `PAUSE` or `RESUME` wins.
+    pub fn release_hold(&self, generation: u64) -> bool {
+        if self.holds.load(Ordering::Acquire) != generation || !self.is_held() {
+            return false;
+        }
+        self.resume();
+        true
     }
 
     /// Resumes the pool and wakes all waiting clients.
     pub fn resume(&self) {
         self.pool_state
-            .fetch_and(!Self::PAUSED_BIT, Ordering::Release);
+            .fetch_and(!(Self::PAUSED_BIT | Self::HELD_BIT), Ordering::Release);
         self.resume_notify.notify_waiters();
     }
 
@@ -1200,7 +1482,7 @@ impl ServerPool {
 
     /// Increments the reconnect epoch and returns the new value.
     /// Uses CAS loop to modify only the lower 32 bits, preventing
-    /// epoch overflow from corrupting PAUSED_BIT at bit 32.
+    /// epoch overflow from corrupting PAUSED_BIT and HELD_BIT.
     pub fn bump_epoch(&self) -> u32 {
         loop {
             let old = self.pool_state.load(Ordering::Acquire);
@@ -1228,13 +1510,14 @@ impl ServerPool {
         skip_lifetime: bool,
     ) -> RecycleResult {
         if conn.is_bad() {
-            conn.close_reason = Some("bad connection".to_string());
+            conn.set_close_reason("bad_connection", None);
             return Err(RecycleError::StaticMessage("Bad connection"));
         }
 
         // RECONNECT epoch check: reject connections created before current epoch
         if metrics.epoch < self.current_epoch() {
-            conn.close_reason = Some("reconnect epoch outdated".to_string());
+            let detail = "reconnect epoch outdated".to_string();
+            conn.set_close_reason("admin_reconnect", Some(detail));
             return Err(RecycleError::StaticMessage(
                 "Connection outdated (RECONNECT)",
             ));
@@ -1242,14 +1525,102 @@ impl ServerPool {
 
         // Lifetime cleanup is skipped while the pool is under pressure.
         if let Some(age_ms) = lifetime_exceeded(metrics, skip_lifetime) {
-            conn.close_reason = Some(format!(
+            let detail = format!(
                 "lifetime exceeded (age={}, limit={})",
                 format_duration_ms(age_ms),
                 format_duration_ms(metrics.lifetime_ms),
-            ));
+            );
+            conn.set_close_reason("server_lifetime", Some(detail));
             return Err(RecycleError::StaticMessage("Connection exceeded lifetime"));
         }
 
+        // The backend address left the DNS record (`dns_refresh_interval`).
+        if let Some(ip) = conn.resolved_ip {
+            if super::dns::is_stale(&conn.address.host, conn.address.port, ip) {
+                let detail = format!("address {ip} no longer in DNS");
+                conn.set_close_reason("dns_change", Some(detail));
+                return Err(RecycleError::StaticMessage(
+                    "Connection address no longer in DNS",
+                ));
+            }
+        }
+
+        // The host was taken out of rotation (`DISABLE HOST`, or dropped
+        // from `server_host` by a reload): the work that held this
+        // connection is done, so close it instead of handing it out again.
+        if let Some(ref hosts) = self.host_list {
+            if hosts.is_draining(&conn.address.host, conn.address.port) {
+                let detail = format!(
+                    "server_host {}:{} out of rotation",
+                    conn.address.host, conn.address.port
+                );
+                conn.set_close_reason("host_out_of_rotation", Some(detail));
+                return Err(RecycleError::StaticMessage(
+                    "Connection host out of rotation",
+                ));
+            }
+        }
+
+        // Re-check the backend role (`server_role_check_interval`). A
+        // mismatch means the host switched roles since the connection was
+        // opened, so the rest of the pool is retired with it.
+        if let Some(ref hosts) = self.host_list {
+            if hosts.role_check_due(conn) {
+                match hosts.recheck_role(conn).await {
+                    Ok(true) => {}
+                    Ok(false) => {
+                        hosts.mark_down(&conn.address.host, conn.address.port);
+                        self.bump_epoch();
+                        let detail = format!(
+                            "backend is no longer a {} (target_session_attrs)",
+                            hosts.target()
+                        );
+                        conn.set_close_reason("role_mismatch", Some(detail));
+                        return Err(RecycleError::StaticMessage(
+                            "Connection role no longer matches target_session_attrs",
+                        ));
+                    }
+                    Err(err) => {
+                        let detail = format!("role check failed: {err}");
+                        conn.set_close_reason("role_check_failed", Some(detail));
+                        return Err(RecycleError::StaticMessage("Connection failed role check"));
+                    }
+                }
+            }
+        }
+
+        // Recycle backends whose memory grew past `server_max_memory`.
+        // Skipped under pressure, like lifetime cleanup.
+        if let Some(ref limit) = self.memory_limit {
+            if !skip_lifetime && limit.check_due(conn) {
+                match limit.check(conn).await {
+                    Ok(None) => {}
+                    Ok(Some(bytes)) => {
+                        crate::web::metrics::record_server_memory_recycle(
+                            &self.address.username,
+                            &self.address.pool_name,
+                        );
+                        let detail = format!(
+                            "backend memory exceeded (used={}, limit={})",
+                            super::backend_memory::format_mb(bytes),
+                            super::backend_memory::format_mb(limit.max_bytes()),
+                        );
+                        conn.set_close_reason("server_max_memory", Some(detail));
+                        return Err(RecycleError::StaticMessage(
+                            "Connection exceeded server_max_memory",
+                        ));
+                    }
+                    Err(err) => {
+                        let detail = format!("memory check failed: {err}");
+                        conn.set_close_reason("memory_check_failed", Some(detail));
+                        return Err(RecycleError::StaticMessage(
+                            "Connection failed memory check",
+                        ));
+                    }
+                }
+            }
+        }
+
         // Probe long-idle connections before reuse.
         if self.idle_check_timeout_ms > 0 {
             if let Some(recycled) = metrics.recycled {
@@ -1260,10 +1631,11 @@ impl ServerPool {
                         conn, idle_time_ms
                     );
                     if conn.check_alive(self.connect_timeout).await.is_err() {
-                        conn.close_reason = Some(format!(
+                        let detail = format!(
                             "failed alive check after {} idle",
                             format_duration_ms(idle_time_ms),
-                        ));
+                        );
+                        conn.set_close_reason("alive_check_failed", Some(detail));
                         return Err(RecycleError::StaticMessage("Connection failed alive check"));
                     }
                     debug!("Connection {} passed alive check", conn);
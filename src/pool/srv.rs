@@ -0,0 +1,341 @@
+//! DNS SRV lookup for `server_host = "srv+_postgres._tcp.cluster.internal"`.
+//!
+//! The system resolver (`getaddrinfo`) has no SRV support, so this module
+//! sends a single SRV question to the first `nameserver` from
+//! `/etc/resolv.conf` over UDP, retrying over TCP when the answer is
+//! truncated. Only the answer section is used; targets are resolved to
+//! addresses later by the normal connect path.
+
+use std::net::{IpAddr, Ipv4Addr, SocketAddr};
+use std::time::Duration;
+
+use rand::Rng;
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::net::{TcpStream, UdpSocket};
+
+use crate::errors::Error;
+
+/// `server_host` prefix that selects SRV discovery.
+pub const SRV_PREFIX: &str = "srv+";
+
+const DNS_PORT: u16 = 53;
+const TYPE_SRV: u16 = 33;
+const CLASS_IN: u16 = 1;
+const LOOKUP_TIMEOUT: Duration = Duration::from_secs(2);
+/// Upper bound on compression pointer jumps while reading one name.
+const MAX_NAME_JUMPS: usize = 16;
+
+/// One SRV answer record.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SrvRecord {
+    pub priority: u16,
+    pub weight: u16,
+    pub port: u16,
+    pub target: String,
+}
+
+/// SRV name from a `srv+<name>` host spec, `None` for any other host.
+pub fn srv_name(server_host: &str) -> Option<&str> {
+    server_host.trim().strip_prefix(SRV_PREFIX)
+}
+
+/// Query the SRV records of `name`. Fails when the name does not exist
+/// or has no SRV records.
+pub async fn lookup(name: &str) -> Result<Vec<SrvRecord>, Error> {
+    let nameserver = system_nameserver().await;
+    let id: u16 = rand::rng().random();
+    let query = build_query(id, name)?;
+
+    let response = tokio::time::timeout(LOOKUP_TIMEOUT, query_udp(nameserver, &query))
+        .await
+        .map_err(|_| srv_error(name, "timed out"))?
+        .map_err(|err| srv_error(name, &err.to_string()))?;
+    let response = if is_truncated(&response) {
+        tokio::time::timeout(LOOKUP_TIMEOUT, query_tcp(nameserver, &query))
+            .await
+            .map_err(|_| srv_error(name, "timed out over tcp"))?
+            .map_err(|err| srv_error(name, &err.to_string()))?
+    } else {
+        response
+    };
+
+    let records = parse_response(id, &response).map_err(|err| srv_error(name, &err))?;
+    if records.is_empty() {
+        return Err(srv_error(name, "no SRV records"));
+    }
+    Ok(records)
+}
+
+fn srv_error(name: &str, reason: &str) -> Error {
+    Error::ConnectError(format!("SRV lookup for {name} failed: {reason}"))
+}
+
+/// First `nameserver` in /etc/resolv.conf, or the local resolver.
+async fn system_nameserver() -> SocketAddr {
+    let conf = tokio::fs::read_to_string("/etc/resolv.conf")
+        .await
+        .unwrap_or_default();
+    let ip = conf
+        .lines()
+        .filter_map(|line| line.trim().strip_prefix("nameserver"))
+        .filter_map(|rest| rest.trim().parse::<IpAddr>().ok())
+        .next()
+        .unwrap_or(IpAddr::V4(Ipv4Addr::LOCALHOST));
+    SocketAddr::new(ip, DNS_PORT)
+}
+
+async fn query_udp(nameserver: SocketAddr, query: &[u8]) -> std::io::Result<Vec<u8>> {
+    let bind: SocketAddr = if nameserver.is_ipv4() {
+        (Ipv4Addr::UNSPECIFIED, 0).into()
+    } else {
+        (std::net::Ipv6Addr::UNSPECIFIED, 0).into()
+    };
+    let socket = UdpSocket::bind(bind).await?;
+    socket.connect(nameserver).await?;
+    socket.send(query).await?;
+    let mut buf = vec![0u8; 4096];
+    let len = socket.recv(&mut buf).await?;
+    buf.truncate(len);
+    Ok(buf)
+}
+
+async fn query_tcp(nameserver: SocketAddr, query: &[u8]) -> std::io::Result<Vec<u8>> {
+    let mut stream = TcpStream::connect(nameserver).await?;
+    let mut framed = Vec::with_capacity(query.len() + 2);
+    framed.extend_from_slice(&(query.len() as u16).to_be_bytes());
+    framed.extend_from_slice(query);
+    stream.write_all(&framed).await?;
+    let len = stream.read_u16().await? as usize;
+    let mut buf = vec![0u8; len];
+    stream.read_exact(&mut buf).await?;
+    Ok(buf)
+}
+
+fn build_query(id: u16, name: &str) -> Result<Vec<u8>, Error> {
+    let mut query = Vec::with_capacity(name.len() + 18);
+    query.extend_from_slice(&id.to_be_bytes());
+    // Flags: recursion desired. One question, no other sections.
+    query.extend_from_slice(&[0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0]);
+    for label in name.trim_end_matches('.').split('.') {
+        if label.is_empty() || label.len() > 63 {
+            return Err(srv_error(name, "invalid DNS name"));
+        }
+        query.push(label.len() as u8);
+        query.extend_from_slice(label.as_bytes());
+    }
+    query.push(0);
+    query.extend_from_slice(&TYPE_SRV.to_be_bytes());
+    query.extend_from_slice(&CLASS_IN.to_be_bytes());
+    Ok(query)
+}
+
+fn is_truncated(response: &[u8]) -> bool {
+    response.len() >= 4 && response[2] & 0x02 != 0
+}
+
+fn read_u16(msg: &[u8], pos: usize) -> Result<u16, String> {
+    msg.get(pos..pos + 2)
+        .map(|b| u16::from_be_bytes([b[0], b[1]]))
+        .ok_or_else(|| "truncated message".to_string())
+}
+
+/// Read a possibly compressed name at `pos`. Returns the name and the
+/// position right after it in the original (uncompressed) stream.
+fn read_name(msg: &[u8], mut pos: usize) -> Result<(String, usize), String> {
+    let mut labels: Vec<String> = Vec::new();
+    let mut end = None;
+    let mut jumps = 0;
+    loop {
+        let len = *msg.get(pos).ok_or("truncated name")? as usize;
+        if len & 0xC0 == 0xC0 {
+            let low = *msg.get(pos + 1).ok_or("truncated name pointer")? as usize;
+            end.get_or_insert(pos + 2);
+            jumps += 1;
+            if jumps > MAX_NAME_JUMPS {
+                return Err("name compression loop".to_string());
+            }
+            pos = ((len & 0x3F) << 8) | low;
+            continue;
+        }
+        if len == 0 {
+            end.get_or_insert(pos + 1);
+            break;
+        }
+        let label = msg.get(pos + 1..pos + 1 + len).ok_or("truncated label")?;
+        labels.push(String::from_utf8_lossy(label).into_owned());
+        pos += 1 + len;
+    }
+    Ok((labels.join("."), end.unwrap_or(pos)))
+}
+
+fn parse_response(id: u16, msg: &[u8]) -> Result<Vec<SrvRecord>, String> {
+    if read_u16(msg, 0)? != id {
+        return Err("response id mismatch".to_string());
+    }
+    let flags = read_u16(msg, 2)?;
+    if flags & 0x8000 == 0 {
+        return Err("not a response".to_string());
+    }
+    match flags & 0x000F {
+        0 => {}
+        3 => return Err("no such name".to_string()),
+        rcode => return Err(format!("server returned rcode {rcode}")),
+    }
+    let questions = read_u16(msg, 4)?;
+    let answers = read_u16(msg, 6)?;
+
+    let mut pos = 12;
+    for _ in 0..questions {
+        let (_, next) = read_name(msg, pos)?;
+        pos = next + 4;
+    }
+
+    let mut records = Vec::new();
+    for _ in 0..answers {
+        let (_, next) = read_name(msg, pos)?;
+        let rtype = read_u16(msg, next)?;
+        let rdlength = read_u16(msg, next + 8)? as usize;
+        let rdata = next + 10;
+        if msg.len() < rdata + rdlength {
+            return Err("truncated record".to_string());
+        }
+        if rtype == TYPE_SRV {
+            let (target, _) = read_name(msg, rdata + 6)?;
+            records.push(SrvRecord {
+                priority: read_u16(msg, rdata)?,
+                weight: read_u16(msg, rdata + 2)?,
+                port: read_u16(msg, rdata + 4)?,
+                target,
+            });
+        }
+        pos = rdata + rdlength;
+    }
+    // A lone "." target means the service is explicitly unavailable.
+    records.retain(|r| !r.target.is_empty());
+    Ok(records)
+}
+
+/// Order records for connection attempts (RFC 2782): ascending priority,
+/// and within one priority a weighted random order, so heavier targets
+/// are tried first more often.
+pub fn order_records(mut records: Vec<SrvRecord>, rng: &mut impl Rng) -> Vec<SrvRecord> {
+    records.sort_by_key(|r| r.priority);
+    let mut ordered = Vec::with_capacity(records.len());
+    let mut rest = records.as_slice();
+    while let Some(first) = rest.first() {
+        let same = rest
+            .iter()
+            .take_while(|r| r.priority == first.priority)
+            .count();
+        let mut group: Vec<SrvRecord> = rest[..same].to_vec();
+        rest = &rest[same..];
+        while !group.is_empty() {
+            let total: u32 = group.iter().map(|r| r.weight as u32).sum();
+            let index = if total == 0 {
+                0
+            } else {
+                let mut pick = rng.random_range(0..total);
+                group
+                    .iter()
+                    .position(|r| {
+                        if pick < r.weight as u32 {
+                            true
+                        } else {
+                            pick -= r.weight as u32;
+                            false
+                        }
+                    })
+                    .unwrap_or(0)
+            };
+            ordered.push(group.remove(index));
+        }
+    }
+    ordered
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn record(priority: u16, weight: u16, port: u16, target: &str) -> SrvRecord {
+        SrvRecord {
+            priority,
+            weight,
+            port,
+            target: target.to_string(),
+        }
+    }
+
+    /// Response to `build_query(id, "_pg._tcp.db")` with two SRV answers;
+    /// the second target is compressed to point at the question suffix.
+    fn sample_response(id: u16) -> Vec<u8> {
+        let mut msg = build_query(id, "_pg._tcp.db").unwrap();
+        msg[2] = 0x81;
+        msg[3] = 0x80;
+        msg[7] = 2;
+        // Answer 1: name -> pointer to question (offset 12), target pg1.db.
+        msg.extend_from_slice(&[0xC0, 12, 0, 33, 0, 1, 0, 0, 0, 30]);
+        let target1 = [3, b'p', b'g', b'1', 2, b'd', b'b', 0];
+        msg.extend_from_slice(&((6 + target1.len()) as u16).to_be_bytes());
+        msg.extend_from_slice(&[0, 10, 0, 5, 0x15, 0x38]);
+        msg.extend_from_slice(&target1);
+        // Answer 2: target "pg2" + pointer to "db" inside the question.
+        msg.extend_from_slice(&[0xC0, 12, 0, 33, 0, 1, 0, 0, 0, 30]);
+        let db_offset = 12 + 4 + 5; // "\x03_pg\x04_tcp" precedes "\x02db"
+        let target2 = [3, b'p', b'g', b'2', 0xC0, db_offset as u8];
+        msg.extend_from_slice(&((6 + target2.len()) as u16).to_be_bytes());
+        msg.extend_from_slice(&[0, 20, 0, 0, 0x19, 0x99]);
+        msg.extend_from_slice(&target2);
+        msg
+    }
+
+    #[test]
+    fn srv_name_requires_prefix() {
+        assert_eq!(srv_name("srv+_pg._tcp.db"), Some("_pg._tcp.db"));
+        assert_eq!(srv_name("db.example.com"), None);
+    }
+
+    #[test]
+    fn parses_answers_with_compression() {
+        let records = parse_response(7, &sample_response(7)).unwrap();
+        assert_eq!(
+            records,
+            vec![record(10, 5, 5432, "pg1.db"), record(20, 0, 6553, "pg2.db")]
+        );
+    }
+
+    #[test]
+    fn rejects_mismatched_id_and_nxdomain() {
+        assert!(parse_response(8, &sample_response(7)).is_err());
+        let mut msg = sample_response(7);
+        msg[3] = 0x83;
+        assert_eq!(parse_response(7, &msg).unwrap_err(), "no such name");
+    }
+
+    #[test]
+    fn order_puts_lower_priority_first() {
+        let mut rng = rand::rng();
+        let ordered = order_records(
+            vec![
+                record(20, 100, 5432, "c"),
+                record(10, 0, 5432, "a"),
+                record(10, 0, 5432, "b"),
+            ],
+            &mut rng,
+        );
+        assert_eq!(ordered[2].target, "c");
+        assert!(ordered[..2].iter().all(|r| r.priority == 10));
+    }
+
+    #[test]
+    fn zero_weight_loses_to_positive_weight() {
+        let mut rng = rand::rng();
+        for _ in 0..20 {
+            let ordered = order_records(
+                vec![record(10, 0, 5432, "light"), record(10, 50, 5432, "heavy")],
+                &mut rng,
+            );
+            assert_eq!(ordered[0].target, "heavy");
+        }
+    }
+}
@@ -38,6 +38,26 @@ impl Default for ScalingConfig {
     }
 }
 
+/// Per-pool reserve for queue spikes (PgBouncer `reserve_pool_size`).
+#[derive(Clone, Copy, Debug)]
+pub struct ReserveConfig {
+    /// Connections allowed beyond `max_size`. 0 disables the reserve.
+    pub size: usize,
+
+    /// How long a client waits for a regular slot before the pool grows
+    /// into the reserve.
+    pub timeout: Duration,
+}
+
+impl Default for ReserveConfig {
+    fn default() -> Self {
+        Self {
+            size: 0,
+            timeout: Duration::from_millis(3000),
+        }
+    }
+}
+
 /// Pool configuration.
 #[derive(Clone, Copy, Debug)]
 pub struct PoolConfig {
@@ -53,6 +73,9 @@ pub struct PoolConfig {
 
     /// Scaling configuration for gradual pool growth.
     pub scaling: ScalingConfig,
+
+    /// Extra connections for clients that waited too long.
+    pub reserve: ReserveConfig,
 }
 
 impl PoolConfig {
@@ -64,6 +87,7 @@ impl PoolConfig {
             timeouts: Timeouts::default(),
             queue_mode: QueueMode::default(),
             scaling: ScalingConfig::default(),
+            reserve: ReserveConfig::default(),
         }
     }
 }
@@ -199,3 +223,40 @@ impl Default for Metrics {
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn jitter_disabled_for_zero() {
+        let metrics = Metrics::new(0, 0, 0);
+        assert_eq!(metrics.lifetime_ms, 0);
+        assert_eq!(metrics.idle_timeout_ms, 0);
+    }
+
+    #[test]
+    fn jitter_stays_within_twenty_percent() {
+        for _ in 0..1000 {
+            let metrics = Metrics::new(3_600_000, 600_000, 0);
+            assert!((2_880_000..=4_320_000).contains(&metrics.lifetime_ms));
+            assert!((480_000..=720_000).contains(&metrics.idle_timeout_ms));
+        }
+    }
+
+    #[test]
+    fn jitter_spreads_lifetimes() {
+        // Connections opened together must not all expire together.
+        let lifetimes: std::collections::HashSet<u64> = (0..100)
+            .map(|_| Metrics::new(3_600_000, 0, 0).lifetime_ms)
+            .collect();
+        assert!(lifetimes.len() > 1);
+    }
+
+    #[test]
+    fn jitter_never_rounds_small_timeout_to_zero() {
+        for _ in 0..100 {
+            assert!(Metrics::new(1, 1, 0).lifetime_ms >= 1);
+        }
+    }
+}
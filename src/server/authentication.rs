@@ -121,6 +121,17 @@ pub(crate) async fn handle_authentication(
             let server_password = user.server_password.as_ref().unwrap().clone();
             let server_username = user.server_username.as_ref().unwrap().clone();
 
+            // RDS IAM: the token is the password. Config validation only
+            // allows server_rds_iam with TLS-only server_tls_mode.
+            if user.server_rds_iam {
+                let mut password_response = BytesMut::new();
+                password_response.put_u8(b'p');
+                password_response.put_i32(server_password.len() as i32 + 4 + 1);
+                password_response.put_slice(server_password.as_bytes());
+                password_response.put_u8(b'\0');
+                return write_all_flush(stream, &password_response).await;
+            }
+
             if !server_password.starts_with(JWT_PRIV_KEY_PASSWORD_PREFIX) {
                 return Err(Error::ServerAuthError(
                     "plain password is not supported".into(),
@@ -8,6 +8,10 @@ pub(crate) struct CleanupState {
 
     /// If server connection requires CLOSE ALL before checkin because of declare statement
     pub(crate) needs_cleanup_declare: bool,
+
+    /// If server connection requires DISCARD ALL before checkin because a pinned
+    /// client left temp tables, advisory locks or hold cursors on it
+    pub(crate) needs_cleanup_discard: bool,
 }
 
 impl CleanupState {
@@ -16,12 +20,16 @@ impl CleanupState {
             needs_cleanup_set: false,
             needs_cleanup_prepare: false,
             needs_cleanup_declare: false,
+            needs_cleanup_discard: false,
         }
     }
 
     #[inline(always)]
     pub(crate) fn needs_cleanup(&self) -> bool {
-        self.needs_cleanup_set || self.needs_cleanup_prepare || self.needs_cleanup_declare
+        self.needs_cleanup_set
+            || self.needs_cleanup_prepare
+            || self.needs_cleanup_declare
+            || self.needs_cleanup_discard
     }
 
     #[inline(always)]
@@ -36,6 +44,7 @@ impl CleanupState {
         self.needs_cleanup_set = false;
         self.needs_cleanup_prepare = false;
         self.needs_cleanup_declare = false;
+        self.needs_cleanup_discard = false;
     }
 }
 
@@ -43,8 +52,202 @@ impl std::fmt::Display for CleanupState {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
         write!(
             f,
-            "SET: {}, PREPARE: {}, DECLARE: {}",
-            self.needs_cleanup_set, self.needs_cleanup_prepare, self.needs_cleanup_declare
+            "SET: {}, PREPARE: {}, DECLARE: {}, DISCARD: {}",
+            self.needs_cleanup_set,
+            self.needs_cleanup_prepare,
+            self.needs_cleanup_declare,
+            self.needs_cleanup_discard
         )
     }
 }
+
+/// SET statements completed inside the open transaction block, one flag per
+/// level: the transaction itself, then each open savepoint. A SET needs the
+/// checkin `RESET ALL` only once its level commits; `ROLLBACK TO SAVEPOINT`
+/// and `ROLLBACK` undo it together with the GUC change, `SET LOCAL` included.
+///
+/// Only CommandComplete tags are seen, so savepoint names are unknown and
+/// `RELEASE` / `ROLLBACK TO` act on the innermost level. PostgreSQL may
+/// release or roll back more levels than that; a SET is then tracked too
+/// deep, which at worst costs a `RESET ALL` that was not needed.
+#[derive(Clone, Debug, Default)]
+pub(crate) struct SetScopes {
+    levels: Vec<bool>,
+    /// A ROLLBACK tag with a savepoint open is either `ROLLBACK TO` or the
+    /// end of the transaction, and only ReadyForQuery tells which. Whether
+    /// a SET completed after it is kept until then.
+    set_after_rollback: Option<bool>,
+}
+
+impl SetScopes {
+    /// `BEGIN` / `START TRANSACTION`.
+    pub(crate) fn begin(&mut self) {
+        if self.levels.is_empty() {
+            self.levels.push(false);
+        }
+    }
+
+    /// `SAVEPOINT`.
+    pub(crate) fn savepoint(&mut self) {
+        if !self.levels.is_empty() {
+            self.levels.push(false);
+        }
+    }
+
+    /// `RELEASE SAVEPOINT`: the savepoint's SETs now belong to its parent.
+    pub(crate) fn release(&mut self) {
+        if self.levels.len() > 1 {
+            let set = self.levels.pop().unwrap_or(false);
+            if let Some(parent) = self.levels.last_mut() {
+                *parent |= set;
+            }
+        }
+    }
+
+    /// A completed `SET`. Returns true when it changed the session outside
+    /// a transaction block.
+    pub(crate) fn set(&mut self) -> bool {
+        if let Some(after) = self.set_after_rollback.as_mut() {
+            *after = true;
+        }
+        match self.levels.last_mut() {
+            Some(level) => {
+                *level = true;
+                false
+            }
+            None => true,
+        }
+    }
+
+    /// `RESET` / `RESET ALL`: earlier SETs no longer need a checkin reset.
+    pub(crate) fn reset(&mut self) {
+        self.levels.iter_mut().for_each(|level| *level = false);
+        if let Some(after) = self.set_after_rollback.as_mut() {
+            *after = false;
+        }
+    }
+
+    /// `ROLLBACK`, `ROLLBACK TO SAVEPOINT` or a `COMMIT` of a failed
+    /// transaction, which all share the tag.
+    pub(crate) fn rollback(&mut self) {
+        match self.levels.len() {
+            0 => {}
+            1 => self.levels.clear(),
+            _ => {
+                if let Some(level) = self.levels.last_mut() {
+                    *level = false;
+                }
+                self.set_after_rollback = Some(false);
+            }
+        }
+    }
+
+    /// `COMMIT` / `PREPARE TRANSACTION`. Returns true when a SET committed.
+    pub(crate) fn commit(&mut self) -> bool {
+        self.set_after_rollback = None;
+        std::mem::take(&mut self.levels).into_iter().any(|set| set)
+    }
+
+    /// ReadyForQuery; `idle` is false inside a transaction block. Returns
+    /// true when a SET outlived a transaction that ended without a COMMIT
+    /// or ROLLBACK tag of its own.
+    pub(crate) fn ready_for_query(&mut self, idle: bool) -> bool {
+        let set_after_rollback = self.set_after_rollback.take();
+        if !idle || self.levels.is_empty() {
+            return false;
+        }
+        let levels = std::mem::take(&mut self.levels);
+        match set_after_rollback {
+            // The ROLLBACK ended the transaction: only SETs after it are
+            // session changes.
+            Some(after) => after,
+            None => levels.into_iter().any(|set| set),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn set_outside_transaction_changes_session() {
+        let mut scopes = SetScopes::default();
+        assert!(scopes.set());
+    }
+
+    #[test]
+    fn committed_set_changes_session() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        assert!(!scopes.set());
+        assert!(scopes.commit());
+        assert!(!scopes.ready_for_query(true));
+    }
+
+    #[test]
+    fn rolled_back_transaction_drops_set() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.set();
+        scopes.rollback();
+        assert!(!scopes.ready_for_query(true));
+    }
+
+    #[test]
+    fn rollback_to_savepoint_drops_set_inside_it() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.savepoint();
+        scopes.set();
+        scopes.rollback();
+        assert!(!scopes.ready_for_query(false));
+        assert!(!scopes.commit());
+    }
+
+    #[test]
+    fn released_savepoint_keeps_set() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.savepoint();
+        scopes.set();
+        scopes.release();
+        assert!(scopes.commit());
+    }
+
+    #[test]
+    fn set_before_savepoint_survives_rollback_to() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.set();
+        scopes.savepoint();
+        scopes.rollback();
+        assert!(!scopes.ready_for_query(false));
+        assert!(scopes.commit());
+    }
+
+    #[test]
+    fn set_after_transaction_rollback_in_one_batch_changes_session() {
+        // BEGIN; SAVEPOINT a; SET ...; ROLLBACK; SET ... — the second SET
+        // ran outside the transaction, which only ReadyForQuery reveals.
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.savepoint();
+        scopes.set();
+        scopes.rollback();
+        assert!(!scopes.set());
+        assert!(scopes.ready_for_query(true));
+    }
+
+    #[test]
+    fn set_after_rollback_to_is_tracked_in_the_savepoint() {
+        let mut scopes = SetScopes::default();
+        scopes.begin();
+        scopes.savepoint();
+        scopes.rollback();
+        scopes.set();
+        assert!(!scopes.ready_for_query(false));
+        scopes.rollback();
+        assert!(!scopes.commit());
+    }
+}
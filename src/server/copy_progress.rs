@@ -0,0 +1,98 @@
+//! COPY accounting for one backend connection, behind the
+//! `pg_doorman_copy_*` metrics.
+
+/// CopyData bytes collected before they are added to
+/// `pg_doorman_copy_bytes_total`. psql and most drivers send one
+/// CopyData per row, so a per-message registry lookup would cost more
+/// than forwarding the row; 1 MiB still keeps a long COPY visible
+/// while it runs.
+const FLUSH_BYTES: u64 = 1024 * 1024;
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq)]
+pub(crate) enum CopyDirection {
+    /// COPY FROM STDIN: the client sends CopyData to the server.
+    In,
+    /// COPY TO STDOUT: the server sends CopyData to the client.
+    Out,
+}
+
+impl CopyDirection {
+    fn label(self) -> &'static str {
+        match self {
+            CopyDirection::In => "in",
+            CopyDirection::Out => "out",
+        }
+    }
+}
+
+/// A COPY in progress. Counted in `pg_doorman_copy_active` from
+/// `start` until `finish`, which the owner must call on every way out
+/// of COPY mode, including dropping the connection.
+#[derive(Debug)]
+pub(crate) struct CopyProgress {
+    direction: CopyDirection,
+    pending_bytes: u64,
+}
+
+impl CopyProgress {
+    pub(crate) fn start(direction: CopyDirection, user: &str, database: &str) -> Self {
+        crate::web::metrics::observe_copy_active(user, database, direction.label(), 1);
+        CopyProgress {
+            direction,
+            pending_bytes: 0,
+        }
+    }
+
+    /// Counts one CopyData message, header included.
+    #[inline]
+    pub(crate) fn add_bytes(&mut self, bytes: u64, user: &str, database: &str) {
+        self.pending_bytes += bytes;
+        if self.pending_bytes >= FLUSH_BYTES {
+            self.flush(0, user, database);
+        }
+    }
+
+    /// Ends the COPY. `rows` is the count from the `COPY n` CommandComplete
+    /// tag; a COPY that failed or was cut short reports none.
+    pub(crate) fn finish(mut self, rows: u64, user: &str, database: &str) {
+        self.flush(rows, user, database);
+        crate::web::metrics::observe_copy_active(user, database, self.direction.label(), -1);
+    }
+
+    fn flush(&mut self, rows: u64, user: &str, database: &str) {
+        crate::web::metrics::observe_copy_transfer(
+            user,
+            database,
+            self.direction.label(),
+            self.pending_bytes,
+            rows,
+        );
+        self.pending_bytes = 0;
+    }
+}
+
+/// Row count of a `COPY n` CommandComplete tag, `None` for other tags.
+pub(crate) fn copy_rows_from_tag(tag: &[u8]) -> Option<u64> {
+    let count = tag.strip_prefix(b"COPY ")?;
+    let count = count.strip_suffix(b"\0").unwrap_or(count);
+    std::str::from_utf8(count).ok()?.parse().ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::copy_rows_from_tag;
+
+    #[test]
+    fn copy_tag_yields_row_count() {
+        assert_eq!(copy_rows_from_tag(b"COPY 0\0"), Some(0));
+        assert_eq!(copy_rows_from_tag(b"COPY 1048576\0"), Some(1_048_576));
+        assert_eq!(copy_rows_from_tag(b"COPY 12"), Some(12));
+    }
+
+    #[test]
+    fn other_tags_yield_nothing() {
+        assert_eq!(copy_rows_from_tag(b"SELECT 5\0"), None);
+        assert_eq!(copy_rows_from_tag(b"COPY\0"), None);
+        assert_eq!(copy_rows_from_tag(b"COPY x\0"), None);
+    }
+}
@@ -0,0 +1,166 @@
+//! RFC 8305 Happy Eyeballs for backend connects.
+//!
+//! `TcpStream::connect` tries the resolved addresses one after another, so
+//! a hostname with AAAA and A records on a network where one family is
+//! black-holed waits out a full TCP timeout before trying the other. Here
+//! attempts start 250 ms apart with the address families interleaved, and
+//! the first socket to connect wins; the rest are dropped.
+
+use std::io;
+use std::net::SocketAddr;
+use std::time::Duration;
+
+use futures::stream::{FuturesUnordered, StreamExt};
+use tokio::net::TcpStream;
+
+/// RFC 8305 "Connection Attempt Delay".
+const CONNECTION_ATTEMPT_DELAY: Duration = Duration::from_millis(250);
+
+/// Resolve `host` and connect to the first address that answers.
+pub(crate) async fn connect(host: &str, port: u16) -> io::Result<TcpStream> {
+    let addrs: Vec<SocketAddr> = tokio::net::lookup_host((host, port)).await?.collect();
+    connect_addrs(interleave(addrs), CONNECTION_ATTEMPT_DELAY).await
+}
+
+/// Alternate address families, starting with the family the resolver put
+/// first (RFC 8305 section 4). Order within a family is kept.
+fn interleave(addrs: Vec<SocketAddr>) -> Vec<SocketAddr> {
+    let Some(first_v6) = addrs.first().map(SocketAddr::is_ipv6) else {
+        return addrs;
+    };
+    let (preferred, other): (Vec<_>, Vec<_>) = addrs
+        .into_iter()
+        .partition(|addr| addr.is_ipv6() == first_v6);
+    let mut ordered = Vec::with_capacity(preferred.len() + other.len());
+    let mut preferred = preferred.into_iter();
+    let mut other = other.into_iter();
+    loop {
+        match (preferred.next(), other.next()) {
+            (None, None) => return ordered,
+            (a, b) => {
+                ordered.extend(a);
+                ordered.extend(b);
+            }
+        }
+    }
+}
+
+/// Start an attempt every `delay`, or right away when the previous one
+/// fails, until one connects. Returns the last error when all fail.
+async fn connect_addrs(addrs: Vec<SocketAddr>, delay: Duration) -> io::Result<TcpStream> {
+    let mut pending = addrs.into_iter();
+    let mut attempts = FuturesUnordered::new();
+    let mut last_err = None;
+    loop {
+        if attempts.is_empty() {
+            match pending.next() {
+                Some(addr) => attempts.push(attempt(addr)),
+                None => {
+                    return Err(last_err.unwrap_or_else(|| {
+                        io::Error::new(io::ErrorKind::NotFound, "host resolved to no addresses")
+                    }))
+                }
+            }
+        }
+        tokio::select! {
+            Some((addr, result)) = attempts.next() => match result {
+                Ok(stream) => return Ok(stream),
+                Err(err) => {
+                    log::debug!("connect to {addr} failed: {err}");
+                    last_err = Some(err);
+                    if let Some(next) = pending.next() {
+                        attempts.push(attempt(next));
+                    }
+                }
+            },
+            _ = tokio::time::sleep(delay), if !pending.as_slice().is_empty() => {
+                if let Some(next) = pending.next() {
+                    attempts.push(attempt(next));
+                }
+            }
+        }
+    }
+}
+
+async fn attempt(addr: SocketAddr) -> (SocketAddr, io::Result<TcpStream>) {
+    (addr, TcpStream::connect(addr).await)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::Instant;
+    use tokio::net::TcpListener;
+
+    fn addr(s: &str) -> SocketAddr {
+        s.parse().unwrap()
+    }
+
+    #[test]
+    fn interleave_alternates_families() {
+        let ordered = interleave(vec![
+            addr("[2001:db8::1]:5432"),
+            addr("[2001:db8::2]:5432"),
+            addr("[2001:db8::3]:5432"),
+            addr("192.0.2.1:5432"),
+        ]);
+        assert_eq!(
+            ordered,
+            vec![
+                addr("[2001:db8::1]:5432"),
+                addr("192.0.2.1:5432"),
+                addr("[2001:db8::2]:5432"),
+                addr("[2001:db8::3]:5432"),
+            ]
+        );
+        assert!(interleave(vec![]).is_empty());
+    }
+
+    /// Closed port for a refused attempt.
+    async fn refused_addr() -> SocketAddr {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        listener.local_addr().unwrap()
+    }
+
+    #[tokio::test]
+    async fn failed_attempt_starts_the_next_one_without_delay() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let good = listener.local_addr().unwrap();
+        let started = Instant::now();
+        let stream = connect_addrs(vec![refused_addr().await, good], Duration::from_secs(10))
+            .await
+            .unwrap();
+        assert_eq!(stream.peer_addr().unwrap(), good);
+        assert!(started.elapsed() < Duration::from_secs(5));
+    }
+
+    #[tokio::test]
+    async fn hanging_attempt_does_not_hold_up_the_next_address() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let good = listener.local_addr().unwrap();
+        // TEST-NET-1 is not routed: the SYN goes nowhere (or the network is
+        // reported unreachable), unlike a refused port.
+        let stream = tokio::time::timeout(
+            Duration::from_secs(5),
+            connect_addrs(
+                vec![addr("192.0.2.1:5432"), good],
+                Duration::from_millis(50),
+            ),
+        )
+        .await
+        .expect("second address must not wait for the first attempt's timeout")
+        .unwrap();
+        assert_eq!(stream.peer_addr().unwrap(), good);
+    }
+
+    #[tokio::test]
+    async fn all_attempts_failing_returns_an_error() {
+        let err = connect_addrs(vec![refused_addr().await], Duration::from_millis(10))
+            .await
+            .unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::ConnectionRefused);
+        assert!(connect_addrs(vec![], Duration::from_millis(10))
+            .await
+            .is_err());
+    }
+}
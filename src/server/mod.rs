@@ -2,9 +2,12 @@
 
 pub(crate) mod authentication;
 pub(crate) mod cleanup;
+pub(crate) mod copy_progress;
+pub(crate) mod happy_eyeballs;
 pub(crate) mod parameters;
 pub(crate) mod prepared_statements;
 pub(crate) mod protocol_io;
+pub(crate) mod scram_relay;
 pub(crate) mod startup_cancel;
 pub(crate) mod startup_error;
 pub(crate) mod stream;
@@ -16,8 +19,9 @@ pub use parameters::ServerParameters;
 pub use prepared_statement_cache::{
     anon_len, anon_snapshot, gc_sweep_anon, gc_sweep_named, intern_query, named_len,
     named_snapshot, now_monotonic_ms, record_query_count, record_query_duration_us,
-    reset_interners_force, set_interner_worker_threads, AnonEntry, CacheEntryKind, GcStats,
-    NamedEntry, PreparedStatementCache,
+    reset_anon_interner_force, reset_interners_force, set_interner_worker_threads,
+    take_interner_lookups, AnonEntry, CacheEntryKind, GcStats, InternerLookups, NamedEntry,
+    PreparedStatementCache,
 };
 
 #[cfg(test)]
@@ -274,6 +274,28 @@ impl ServerParameters {
         diff
     }
 
+    /// Return to `defaults`, the snapshot taken at login, the way
+    /// `RESET ALL` returns a backend to its session defaults. Returns the
+    /// ParameterStatus messages PostgreSQL sends for the reported
+    /// parameters that changed.
+    pub fn reset_to(&mut self, defaults: &ServerParameters) -> BytesMut {
+        let mut changes = BytesMut::new();
+        for (key, value) in &defaults.parameters {
+            if TRACKED_PARAMETERS.contains(key)
+                && !PARAMETER_STATUS_SUPPRESSED.contains(key.as_str())
+                && self.parameters.get(key) != Some(value)
+            {
+                ServerParameters::add_parameter_message(key, value, &mut changes);
+            }
+        }
+        *self = defaults.clone();
+        changes
+    }
+
+    pub fn get_param(&self, key: &str) -> Option<&str> {
+        self.parameters.get(key).map(String::as_str)
+    }
+
     pub fn get_application_name(&self) -> &String {
         // Can unwrap because we set it in the constructor.
         self.parameters.get("application_name").unwrap()
@@ -376,6 +398,30 @@ static PARAMETER_STATUS_SUPPRESSED: Lazy<HashSet<&'static str>> = Lazy::new(|| {
 mod tests {
     use super::*;
 
+    #[test]
+    fn reset_to_restores_login_values_and_reports_changes() {
+        let mut defaults = ServerParameters::new();
+        defaults.set_param("TimeZone", "UTC", true);
+        defaults.set_param("application_name", "app", true);
+        defaults.set_param("search_path", "public", true);
+
+        let mut current = defaults.clone();
+        current.set_param("TimeZone", "Europe/Moscow", false);
+        current.set_param("search_path", "tenant", true);
+        current.set_param("DateStyle", "German", false);
+
+        let status = current.reset_to(&defaults);
+        assert_eq!(current.as_hashmap(), defaults.as_hashmap());
+        // Only the reported parameter that changed gets a ParameterStatus.
+        assert_eq!(&status[..], &server_parameter_status("TimeZone", "UTC")[..]);
+    }
+
+    fn server_parameter_status(key: &str, value: &str) -> BytesMut {
+        let mut bytes = BytesMut::new();
+        ServerParameters::add_parameter_message(key, value, &mut bytes);
+        bytes
+    }
+
     #[test]
     fn canonicalize_timezone_matches_any_case() {
         assert_eq!(canonicalize_param_name("timezone".to_string()), "TimeZone");
@@ -1,5 +1,5 @@
 use dashmap::DashMap;
-use log::{info, log_enabled, trace, Level};
+use log::{debug, info, log_enabled, trace, Level};
 use once_cell::sync::Lazy;
 use std::sync::atomic::{AtomicU64, AtomicU8, AtomicUsize, Ordering};
 use std::sync::Arc;
@@ -139,6 +139,39 @@ static NAMED_INTERNER: Lazy<DashMap<u64, Arc<NamedEntry>>> =
 static ANON_INTERNER: Lazy<DashMap<u64, Arc<AnonEntry>>> =
     Lazy::new(|| new_dashmap_with_capacity(8192, interner_worker_threads()));
 
+/// Interner lookups since the last GC sweep. Drained into
+/// `pg_doorman_query_interner_lookups_total` by every sweep so `Parse`
+/// only pays a relaxed add.
+static NAMED_HITS: AtomicU64 = AtomicU64::new(0);
+static NAMED_MISSES: AtomicU64 = AtomicU64::new(0);
+static ANON_HITS: AtomicU64 = AtomicU64::new(0);
+static ANON_MISSES: AtomicU64 = AtomicU64::new(0);
+static ANON_COLLISIONS: AtomicU64 = AtomicU64::new(0);
+
+/// Interner lookups by kind and result, as returned by
+/// [`take_interner_lookups`].
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct InternerLookups {
+    pub named_hits: u64,
+    pub named_misses: u64,
+    pub anon_hits: u64,
+    pub anon_misses: u64,
+    /// Anonymous lookups that found a different query text under the same
+    /// hash. The caller gets its own text, which is not interned.
+    pub anon_collisions: u64,
+}
+
+/// Lookups since the previous call.
+pub fn take_interner_lookups() -> InternerLookups {
+    InternerLookups {
+        named_hits: NAMED_HITS.swap(0, Ordering::Relaxed),
+        named_misses: NAMED_MISSES.swap(0, Ordering::Relaxed),
+        anon_hits: ANON_HITS.swap(0, Ordering::Relaxed),
+        anon_misses: ANON_MISSES.swap(0, Ordering::Relaxed),
+        anon_collisions: ANON_COLLISIONS.swap(0, Ordering::Relaxed),
+    }
+}
+
 /// Monotonic millisecond clock anchored at the first call. Used by
 /// `AnonEntry::last_used` so wall-clock jumps don't perturb TTL decisions.
 pub fn now_monotonic_ms() -> u64 {
@@ -186,8 +219,10 @@ pub fn intern_query(query: &str, hash: u64, is_anonymous: bool) -> Arc<str> {
 fn intern_named(query: &str, hash: u64) -> Arc<str> {
     if let Some(entry) = NAMED_INTERNER.get(&hash) {
         entry.touch();
+        NAMED_HITS.fetch_add(1, Ordering::Relaxed);
         return entry.text.clone();
     }
+    NAMED_MISSES.fetch_add(1, Ordering::Relaxed);
     let arc_str: Arc<str> = Arc::from(query);
     let new_entry = Arc::new(NamedEntry::new(arc_str.clone()));
     NAMED_INTERNER.entry(hash).or_insert(new_entry).text.clone()
@@ -196,9 +231,21 @@ fn intern_named(query: &str, hash: u64) -> Arc<str> {
 fn intern_anon(query: &str, hash: u64) -> Arc<str> {
     let now = now_monotonic_ms();
     if let Some(entry) = ANON_INTERNER.get(&hash) {
+        if *entry.text != *query {
+            // Another text under the same hash: never hand out the wrong
+            // query, and leave the interned one alone.
+            ANON_COLLISIONS.fetch_add(1, Ordering::Relaxed);
+            debug!(
+                "query_interner anon hash collision: hash={hash:#x}, query=\"{}\"",
+                truncate_query_for_log(query)
+            );
+            return Arc::from(query);
+        }
         entry.touch(now);
+        ANON_HITS.fetch_add(1, Ordering::Relaxed);
         return entry.text.clone();
     }
+    ANON_MISSES.fetch_add(1, Ordering::Relaxed);
     let arc_str: Arc<str> = Arc::from(query);
     let new_entry = Arc::new(AnonEntry::new(arc_str.clone(), now));
     ANON_INTERNER.entry(hash).or_insert(new_entry).text.clone()
@@ -234,6 +281,11 @@ pub fn reset_interners_force() {
     ANON_INTERNER.clear();
 }
 
+/// Force-clear the anonymous interner only (`RESET INTERNER ANONYMOUS`).
+pub fn reset_anon_interner_force() {
+    ANON_INTERNER.clear();
+}
+
 #[cfg(test)]
 pub fn reset_interners_for_test() {
     reset_interners_force();
@@ -256,6 +308,9 @@ pub fn anon_entry_for_test(hash: u64) -> Option<Arc<AnonEntry>> {
 pub struct GcStats {
     pub marked: u64,
     pub evicted: u64,
+    /// Entries removed because the interner was over its size limit
+    /// (anonymous side, `query_interner_anon_max_entries`).
+    pub limited: u64,
     /// Total bytes of interned text alive at the end of the sweep — the
     /// gauge value Prometheus needs without taking a second snapshot.
     pub bytes: u64,
@@ -339,7 +394,11 @@ pub fn gc_sweep_named() -> GcStats {
 /// the named sweep — `intern_query` touch resets the mark. Pass
 /// `u64::MAX` to disable TTL eviction (used when the operator sets
 /// `query_interner_anon_idle_ttl_seconds = 0`).
-pub fn gc_sweep_anon(anon_idle_ttl_ms: u64) -> GcStats {
+///
+/// Afterwards, when more than `max_entries` (0 = no limit) are left, the
+/// least recently used entries above the limit are removed at once,
+/// without the grace cycle.
+pub fn gc_sweep_anon(anon_idle_ttl_ms: u64, max_entries: usize) -> GcStats {
     let now = now_monotonic_ms();
     let mut stats = GcStats::default();
     for (hash, entry) in anon_snapshot() {
@@ -362,6 +421,17 @@ pub fn gc_sweep_anon(anon_idle_ttl_ms: u64) -> GcStats {
             },
         );
     }
+    if max_entries > 0 && ANON_INTERNER.len() > max_entries {
+        let mut entries = anon_snapshot();
+        entries.sort_unstable_by_key(|(_, entry)| entry.last_used.load(Ordering::Relaxed));
+        let excess = entries.len().saturating_sub(max_entries);
+        for (hash, entry) in entries.into_iter().take(excess) {
+            if ANON_INTERNER.remove(&hash).is_some() {
+                stats.limited += 1;
+                stats.bytes = stats.bytes.saturating_sub(entry.text.len() as u64);
+            }
+        }
+    }
     stats
 }
 
@@ -992,11 +1062,11 @@ mod tests {
         reset_interners_for_test();
         let _arc = intern_query("select stale_anon", 0x103, true);
         std::thread::sleep(std::time::Duration::from_millis(20));
-        let s1 = gc_sweep_anon(10);
+        let s1 = gc_sweep_anon(10, 0);
         assert!(s1.marked >= 1);
         assert_eq!(s1.evicted, 0);
         assert!(anon_entry_for_test(0x103).is_some());
-        let s2 = gc_sweep_anon(10);
+        let s2 = gc_sweep_anon(10, 0);
         assert!(s2.evicted >= 1);
         assert!(anon_entry_for_test(0x103).is_none());
     }
@@ -1009,9 +1079,9 @@ mod tests {
         reset_interners_for_test();
         let _arc = intern_query("select touched_anon", 0x104, true);
         std::thread::sleep(std::time::Duration::from_millis(20));
-        gc_sweep_anon(10);
+        gc_sweep_anon(10, 0);
         let _arc2 = intern_query("select touched_anon", 0x104, true);
-        gc_sweep_anon(10);
+        gc_sweep_anon(10, 0);
         assert!(anon_entry_for_test(0x104).is_some());
     }
 
@@ -1024,11 +1094,46 @@ mod tests {
         let _arc = intern_query("select forever", 0x105, true);
         std::thread::sleep(std::time::Duration::from_millis(20));
         for _ in 0..5 {
-            gc_sweep_anon(u64::MAX);
+            gc_sweep_anon(u64::MAX, 0);
         }
         assert!(anon_entry_for_test(0x105).is_some());
     }
 
+    /// Over `max_entries`, the least recently used entries go in one sweep.
+    #[test]
+    #[serial(query_interner)]
+    fn anon_size_limit_evicts_least_recently_used() {
+        reset_interners_for_test();
+        for (i, hash) in [0x106, 0x107, 0x108].into_iter().enumerate() {
+            let _ = intern_query(&format!("select {i}"), hash, true);
+            std::thread::sleep(std::time::Duration::from_millis(2));
+        }
+        let _ = intern_query("select 0", 0x106, true);
+        let stats = gc_sweep_anon(u64::MAX, 2);
+        assert_eq!(stats.limited, 1);
+        assert!(anon_entry_for_test(0x107).is_none());
+        assert!(anon_entry_for_test(0x106).is_some());
+        assert!(anon_entry_for_test(0x108).is_some());
+    }
+
+    /// A different text under an interned hash is returned as is and
+    /// counted as a collision.
+    #[test]
+    #[serial(query_interner)]
+    fn anon_hash_collision_returns_own_text() {
+        reset_interners_for_test();
+        let first = intern_query("select 1", 0x109, true);
+        let hit = intern_query("select 1", 0x109, true);
+        assert!(Arc::ptr_eq(&first, &hit));
+        let other = intern_query("select 2", 0x109, true);
+        assert_eq!(&*other, "select 2");
+        assert_eq!(&**anon_entry_for_test(0x109).unwrap().text(), "select 1");
+        // Other tests may intern concurrently; only lower bounds hold.
+        let lookups = take_interner_lookups();
+        assert!(lookups.anon_misses >= 1 && lookups.anon_hits >= 1);
+        assert!(lookups.anon_collisions >= 1);
+    }
+
     #[test]
     #[serial(query_interner)]
     fn record_query_count_increments_named_entry() {
@@ -32,6 +32,7 @@ use crate::messages::{
     write_all_flush, BytesMutReader,
 };
 
+use super::copy_progress::{copy_rows_from_tag, CopyDirection};
 use super::parameters::ServerParameters;
 use super::server_backend::Server;
 
@@ -65,15 +66,29 @@ const COMMAND_COMPLETE_BY_DEALLOCATE_ALL: &[u8; 15] = b"DEALLOCATE ALL\0";
 /// `DISCARD ALL` CommandComplete tag — equivalent to `RESET ALL; DEALLOCATE ALL;
 /// CLOSE ALL; UNLISTEN *; ...`, so disarms every `needs_cleanup_*` flag.
 const COMMAND_COMPLETE_BY_DISCARD_ALL: &[u8; 12] = b"DISCARD ALL\0";
-
-/// Buffer flush threshold in bytes (8 KiB).
-/// When the buffer reaches this size, it will be flushed to avoid excessive memory usage.
+/// Transaction control tags — bound the scope of a `SET` inside a transaction
+/// block (see `SetScopes`). `END` reports `COMMIT`; `ABORT`, `ROLLBACK TO
+/// SAVEPOINT` and `COMMIT` of a failed transaction all report `ROLLBACK`.
+const COMMAND_COMPLETE_BY_BEGIN: &[u8; 6] = b"BEGIN\0";
+const COMMAND_COMPLETE_BY_START_TRANSACTION: &[u8; 18] = b"START TRANSACTION\0";
+const COMMAND_COMPLETE_BY_SAVEPOINT: &[u8; 10] = b"SAVEPOINT\0";
+const COMMAND_COMPLETE_BY_RELEASE: &[u8; 8] = b"RELEASE\0";
+const COMMAND_COMPLETE_BY_COMMIT: &[u8; 7] = b"COMMIT\0";
+const COMMAND_COMPLETE_BY_ROLLBACK: &[u8; 9] = b"ROLLBACK\0";
+/// Two-phase commit CommandComplete tags — counted, not cleanup-relevant.
+const COMMAND_COMPLETE_BY_PREPARE_TRANSACTION: &[u8; 20] = b"PREPARE TRANSACTION\0";
+const COMMAND_COMPLETE_BY_COMMIT_PREPARED: &[u8; 16] = b"COMMIT PREPARED\0";
+const COMMAND_COMPLETE_BY_ROLLBACK_PREPARED: &[u8; 18] = b"ROLLBACK PREPARED\0";
+
+/// Initial server buffer capacity and the default flush threshold (8 KiB).
+/// Pools override the threshold per message class with
+/// `data_row_flush_threshold` and `copy_data_flush_threshold`.
 const BUFFER_FLUSH_THRESHOLD: usize = 8192;
 
 /// Flushes messages within `duration`; timeout marks the server bad.
 pub(crate) async fn send_and_flush_timeout(
     server: &mut Server,
-    messages: &BytesMut,
+    messages: &[u8],
     duration: Duration,
 ) -> Result<(), Error> {
     match timeout(duration, send_and_flush(server, messages)).await {
@@ -92,7 +107,7 @@ pub(crate) async fn send_and_flush_timeout(
 }
 
 /// Flushes messages and records write stats/activity.
-pub(crate) async fn send_and_flush(server: &mut Server, messages: &BytesMut) -> Result<(), Error> {
+pub(crate) async fn send_and_flush(server: &mut Server, messages: &[u8]) -> Result<(), Error> {
     server.stats.data_sent(messages.len());
     server.stats.wait_writing();
 
@@ -268,6 +283,7 @@ where
         res.is_ok(),
         HEADER_BYTES + payload_copied as u64,
     );
+    server.add_copy_bytes(HEADER_BYTES + payload_copied as u64);
     res?;
 
     server.bad = prev_bad;
@@ -300,16 +316,21 @@ fn handle_ready_for_query(server: &mut Server, message: &mut BytesMut) -> Result
         // 'T' - In transaction block
         'T' => {
             server.in_transaction = true;
+            server.set_scopes.ready_for_query(false);
         }
 
         // 'I' - Idle (not in transaction)
         'I' => {
             server.in_transaction = false;
+            if server.set_scopes.ready_for_query(true) {
+                server.cleanup_state.needs_cleanup_set = true;
+            }
         }
 
         // 'E' - In failed transaction block (requires ROLLBACK)
         'E' => {
             server.in_transaction = true;
+            server.set_scopes.ready_for_query(false);
             if let Ok(msg) = PgErrorMsg::parse(message) {
                 let mut details =
                     format!(
@@ -363,7 +384,7 @@ fn handle_error_response(server: &mut Server, message: &mut BytesMut) {
             "[{}@{}] server error pid={}: severity={}, code={}, message=\"{}\", in_transaction={}, in_copy={}",
             server.address.username, server.address.pool_name, server.get_process_id(),
             msg.severity, msg.code, sanitize_for_log(&msg.message),
-            server.in_transaction, server.in_copy_mode,
+            server.in_transaction, server.in_copy_mode(),
         );
         if let Some(ref hint) = msg.hint {
             details.push_str(&format!(", hint=\"{}\"", sanitize_for_log(hint)));
@@ -394,9 +415,7 @@ fn handle_error_response(server: &mut Server, message: &mut BytesMut) {
     }
 
     // Exit COPY mode on error
-    if server.in_copy_mode {
-        server.in_copy_mode = false;
-    }
+    server.end_copy(0);
 
     // Reset prepared statements cache on error
     if server.prepared_statement_cache.is_some() {
@@ -450,6 +469,20 @@ enum CommandCompleteEffect {
     /// UNLISTEN *; ...` executed atomically; disarm every `needs_cleanup_*` flag
     /// and drop the LRU.
     DisarmAll,
+    /// `PREPARE TRANSACTION` / `COMMIT PREPARED` / `ROLLBACK PREPARED` —
+    /// bump `two_phase_commands` so the client can confirm its command.
+    TwoPhase,
+    /// `BEGIN` / `START TRANSACTION` — later SETs belong to the transaction.
+    Begin,
+    /// `SAVEPOINT` — later SETs belong to the savepoint.
+    Savepoint,
+    /// `RELEASE SAVEPOINT` — the savepoint's SETs move to its parent.
+    Release,
+    /// `COMMIT` — SETs of the transaction now belong to the session.
+    Commit,
+    /// `ROLLBACK` / `ROLLBACK TO SAVEPOINT` — SETs of the rolled back level
+    /// are gone.
+    Rollback,
 }
 
 /// Pure classifier for CommandComplete tags relevant to session cleanup tracking.
@@ -470,6 +503,21 @@ fn classify_command_complete(tag: &[u8]) -> CommandCompleteEffect {
         CommandCompleteEffect::DisarmPrepare
     } else if tag == COMMAND_COMPLETE_BY_DISCARD_ALL {
         CommandCompleteEffect::DisarmAll
+    } else if tag == COMMAND_COMPLETE_BY_PREPARE_TRANSACTION
+        || tag == COMMAND_COMPLETE_BY_COMMIT_PREPARED
+        || tag == COMMAND_COMPLETE_BY_ROLLBACK_PREPARED
+    {
+        CommandCompleteEffect::TwoPhase
+    } else if tag == COMMAND_COMPLETE_BY_BEGIN || tag == COMMAND_COMPLETE_BY_START_TRANSACTION {
+        CommandCompleteEffect::Begin
+    } else if tag == COMMAND_COMPLETE_BY_SAVEPOINT {
+        CommandCompleteEffect::Savepoint
+    } else if tag == COMMAND_COMPLETE_BY_RELEASE {
+        CommandCompleteEffect::Release
+    } else if tag == COMMAND_COMPLETE_BY_COMMIT {
+        CommandCompleteEffect::Commit
+    } else if tag == COMMAND_COMPLETE_BY_ROLLBACK {
+        CommandCompleteEffect::Rollback
     } else {
         CommandCompleteEffect::None
     }
@@ -478,6 +526,7 @@ fn classify_command_complete(tag: &[u8]) -> CommandCompleteEffect {
 /// Drop the pg_doorman-side prepared statement LRU after the server confirms it
 /// just executed an equivalent of `DEALLOCATE ALL` or `DISCARD ALL`.
 fn drop_prepared_statement_cache_on_reset(server: &mut Server, reason: &'static str) {
+    server.prepared_resets += 1;
     server.registering_prepared_statement.clear();
     let Some(cache_size) = server
         .prepared_statement_cache
@@ -504,21 +553,28 @@ fn drop_prepared_statement_cache_on_reset(server: &mut Server, reason: &'static
 /// next checkin does not issue a redundant `RESET ALL` round-trip on a connection
 /// the client has already cleaned up.
 fn handle_command_complete(server: &mut Server, message: &BytesMut) {
-    // Exit COPY mode if we were in it
-    if server.in_copy_mode {
-        server.in_copy_mode = false;
+    // Exit COPY mode if we were in it; `COPY n` carries the row count.
+    if server.in_copy_mode() {
+        server.end_copy(copy_rows_from_tag(&message[..]).unwrap_or(0));
     }
 
     match classify_command_complete(&message[..]) {
         CommandCompleteEffect::None => {}
         CommandCompleteEffect::ArmSet => {
-            server.cleanup_state.needs_cleanup_set = true;
+            // Inside a transaction block the SET arms cleanup only once its
+            // transaction or savepoint commits.
+            if server.set_scopes.set() {
+                server.cleanup_state.needs_cleanup_set = true;
+            }
+            server.client_addr_sent = None;
         }
         CommandCompleteEffect::ArmDeclare => {
             server.cleanup_state.needs_cleanup_declare = true;
         }
         CommandCompleteEffect::DisarmSet => {
             server.cleanup_state.needs_cleanup_set = false;
+            server.set_scopes.reset();
+            server.client_addr_sent = None;
         }
         CommandCompleteEffect::DisarmDeclare => {
             server.cleanup_state.needs_cleanup_declare = false;
@@ -529,8 +585,26 @@ fn handle_command_complete(server: &mut Server, message: &BytesMut) {
         }
         CommandCompleteEffect::DisarmAll => {
             server.cleanup_state.reset();
+            server.set_scopes.reset();
+            server.client_addr_sent = None;
             drop_prepared_statement_cache_on_reset(server, "DISCARD ALL");
         }
+        CommandCompleteEffect::TwoPhase => {
+            server.two_phase_commands += 1;
+            // PREPARE TRANSACTION keeps the transaction's SETs like COMMIT.
+            if server.set_scopes.commit() {
+                server.cleanup_state.needs_cleanup_set = true;
+            }
+        }
+        CommandCompleteEffect::Begin => server.set_scopes.begin(),
+        CommandCompleteEffect::Savepoint => server.set_scopes.savepoint(),
+        CommandCompleteEffect::Release => server.set_scopes.release(),
+        CommandCompleteEffect::Commit => {
+            if server.set_scopes.commit() {
+                server.cleanup_state.needs_cleanup_set = true;
+            }
+        }
+        CommandCompleteEffect::Rollback => server.set_scopes.rollback(),
     }
 }
 
@@ -754,28 +828,29 @@ where
                 server.data_available = true;
 
                 // Don't flush yet, the more we buffer, the faster this goes...up to a limit.
-                if server.buffer.len() >= BUFFER_FLUSH_THRESHOLD {
+                if server.buffer.len() >= server.data_row_flush_threshold {
                     break;
                 }
             }
 
             // CopyInResponse: copy is starting from client to server.
             'G' => {
-                server.in_copy_mode = true;
+                server.start_copy(CopyDirection::In);
                 break;
             }
 
             // CopyOutResponse: copy is starting from the server to the client.
             'H' => {
-                server.in_copy_mode = true;
+                server.start_copy(CopyDirection::Out);
                 server.data_available = true;
                 break;
             }
 
             // CopyData
             'd' => {
+                server.add_copy_bytes(message_len as u64 + 1);
                 // Don't flush yet, buffer until we reach limit
-                if server.buffer.len() >= BUFFER_FLUSH_THRESHOLD {
+                if server.buffer.len() >= server.copy_data_flush_threshold {
                     break;
                 }
             }
@@ -889,6 +964,35 @@ where
     Ok(bytes)
 }
 
+/// Extract the first column of the first DataRow from a buffered backend
+/// response. Returns `None` when the response has no rows, the value is
+/// NULL, or the framing is truncated.
+pub(crate) fn first_data_row_value(response: &[u8]) -> Option<String> {
+    let mut pos = 0;
+    while pos + 5 <= response.len() {
+        let code = response[pos];
+        let len = i32::from_be_bytes(response[pos + 1..pos + 5].try_into().ok()?) as usize;
+        let end = (pos + 1).checked_add(len)?;
+        if len < 4 || end > response.len() {
+            return None;
+        }
+        if code == b'D' {
+            let body = &response[pos + 5..end];
+            if body.len() < 6 || i16::from_be_bytes([body[0], body[1]]) < 1 {
+                return None;
+            }
+            let col_len = i32::from_be_bytes([body[2], body[3], body[4], body[5]]);
+            if col_len < 0 {
+                return None;
+            }
+            let value = body.get(6..6 + col_len as usize)?;
+            return Some(String::from_utf8_lossy(value).into_owned());
+        }
+        pos = end;
+    }
+    None
+}
+
 #[cfg(test)]
 mod tests {
     //! Pure-function tests for CommandComplete tag classification.
@@ -902,7 +1006,7 @@ mod tests {
     //! * `RESET ALL` is reported as `RESET\0`, not `RESET ALL\0`.
     //! * `CLOSE ALL` is reported as `CLOSE CURSOR ALL\0`, not `CLOSE ALL\0`.
 
-    use super::{classify_command_complete, CommandCompleteEffect};
+    use super::{classify_command_complete, first_data_row_value, CommandCompleteEffect};
 
     #[test]
     fn set_tag_arms_set_cleanup() {
@@ -965,6 +1069,34 @@ mod tests {
         );
     }
 
+    #[test]
+    fn two_phase_tags_are_counted() {
+        for tag in [
+            &b"PREPARE TRANSACTION\0"[..],
+            b"COMMIT PREPARED\0",
+            b"ROLLBACK PREPARED\0",
+        ] {
+            assert_eq!(
+                classify_command_complete(tag),
+                CommandCompleteEffect::TwoPhase,
+            );
+        }
+    }
+
+    #[test]
+    fn transaction_control_tags_scope_set() {
+        for (tag, effect) in [
+            (&b"BEGIN\0"[..], CommandCompleteEffect::Begin),
+            (b"START TRANSACTION\0", CommandCompleteEffect::Begin),
+            (b"SAVEPOINT\0", CommandCompleteEffect::Savepoint),
+            (b"RELEASE\0", CommandCompleteEffect::Release),
+            (b"COMMIT\0", CommandCompleteEffect::Commit),
+            (b"ROLLBACK\0", CommandCompleteEffect::Rollback),
+        ] {
+            assert_eq!(classify_command_complete(tag), effect);
+        }
+    }
+
     #[test]
     fn partial_discard_tags_are_inert() {
         // DISCARD PLANS drops the plan cache, DISCARD TEMP drops temp tables,
@@ -994,11 +1126,7 @@ mod tests {
             b"INSERT 0 1\0",
             b"UPDATE 5\0",
             b"DELETE 10\0",
-            b"BEGIN\0",
-            b"COMMIT\0",
-            b"ROLLBACK\0",
             b"UNLISTEN\0",
-            b"SAVEPOINT\0",
         ] {
             assert_eq!(
                 classify_command_complete(tag),
@@ -1041,4 +1169,36 @@ mod tests {
             CommandCompleteEffect::None,
         );
     }
+
+    fn data_row(value: Option<&[u8]>) -> Vec<u8> {
+        let mut body = vec![0u8, 1];
+        match value {
+            Some(v) => {
+                body.extend_from_slice(&(v.len() as i32).to_be_bytes());
+                body.extend_from_slice(v);
+            }
+            None => body.extend_from_slice(&(-1i32).to_be_bytes()),
+        }
+        let mut msg = vec![b'D'];
+        msg.extend_from_slice(&((body.len() + 4) as i32).to_be_bytes());
+        msg.extend_from_slice(&body);
+        msg
+    }
+
+    #[test]
+    fn first_data_row_value_skips_row_description() {
+        // RowDescription framing is skipped by length; its contents do not matter.
+        let mut response = vec![b'T', 0, 0, 0, 6, 0, 0];
+        response.extend(data_row(Some(b"t")));
+        response.extend(data_row(Some(b"f")));
+        response.extend_from_slice(b"Z\0\0\0\x05I");
+        assert_eq!(first_data_row_value(&response).as_deref(), Some("t"));
+    }
+
+    #[test]
+    fn first_data_row_value_handles_null_and_empty() {
+        assert_eq!(first_data_row_value(&data_row(None)), None);
+        assert_eq!(first_data_row_value(b"Z\0\0\0\x05I"), None);
+        assert_eq!(first_data_row_value(&[b'D', 0, 0]), None);
+    }
 }
@@ -0,0 +1,232 @@
+//! SCRAM passthrough (`password = "scram-passthrough"`).
+//!
+//! pg_doorman keeps no password or verifier for such a user. The client's
+//! SCRAM exchange is relayed to a backend connection opened with the
+//! client's username, and PostgreSQL decides whether the proof is valid.
+//! A SCRAM proof can't be replayed and yields no key without the stored
+//! verifier, so every server connection of the user's pool needs a login
+//! of its own: the backend connection that accepted a client is parked
+//! here, and the pool opens its server connections from parked logins.
+//! Parked logins count against the pool size with the pool's servers,
+//! and are closed once older than its `idle_timeout` or `server_lifetime`.
+
+use std::collections::{BTreeMap, HashMap, VecDeque};
+use std::time::{Duration, Instant};
+
+use bytes::{Buf, BufMut, BytesMut};
+use log::debug;
+use once_cell::sync::Lazy;
+use parking_lot::Mutex;
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+use crate::config::{get_config, Address};
+use crate::errors::{Error, ServerIdentifier};
+use crate::messages::constants::{AUTHENTICATION_SUCCESSFUL, SASL, SASL_CONTINUE, SASL_FINAL};
+use crate::messages::{read_message_data, startup, PgErrorMsg, SCRAM_SHA_256};
+
+use super::stream::{create_tcp_stream_inner, create_unix_stream_inner, StreamInner};
+
+/// Authenticated backend connections by (pool, user), oldest first. Each
+/// has been read up to its AuthenticationOk.
+static PARKED: Lazy<Mutex<HashMap<(String, String), VecDeque<Parked>>>> =
+    Lazy::new(|| Mutex::new(HashMap::new()));
+
+struct Parked {
+    stream: StreamInner,
+    parked_at: Instant,
+    /// Closed once parked this long; None to keep it until taken.
+    max_age: Option<Duration>,
+}
+
+impl Parked {
+    fn expired(&self, now: Instant) -> bool {
+        self.max_age
+            .is_some_and(|max_age| now.duration_since(self.parked_at) > max_age)
+    }
+}
+
+/// A server message read while relaying.
+pub(crate) enum Reply {
+    /// AuthenticationSASLContinue, to forward to the client as is.
+    Continue(BytesMut),
+    /// AuthenticationSASLFinal, to forward to the client as is.
+    Final(BytesMut),
+    /// AuthenticationOk: PostgreSQL accepted the client's proof.
+    Ok,
+    /// ErrorResponse: PostgreSQL refused the login.
+    Refused(PgErrorMsg),
+}
+
+/// Open a backend connection as `address.username` and send its
+/// StartupMessage. Errs unless PostgreSQL answers with a SCRAM-SHA-256
+/// challenge, which is what the client is then asked for.
+pub(crate) async fn connect(
+    address: &Address,
+    database: &str,
+    application_name: &str,
+    startup_parameters: &BTreeMap<String, String>,
+) -> Result<StreamInner, Error> {
+    let identifier = ServerIdentifier::new(address.username.clone(), database, &address.pool_name);
+    let mut stream = if address.host.starts_with('/') {
+        create_unix_stream_inner(&address.host, address.port).await?
+    } else {
+        create_tcp_stream_inner(
+            &address.host,
+            address.port,
+            &address.server_tls,
+            &address.pool_name,
+        )
+        .await?
+    };
+    startup(
+        &mut stream,
+        get_config().general.server_protocol_version(),
+        &address.username,
+        database,
+        application_name,
+        startup_parameters,
+    )
+    .await?;
+
+    // NegotiateProtocolVersion from an older server only tells the
+    // version it carries on with.
+    let mut message = read(&mut stream).await?;
+    while message[0] == b'v' {
+        message = read(&mut stream).await?;
+    }
+    let mut body = &message[5..];
+    match message[0] {
+        b'R' if body.len() >= 4 && body.get_i32() == SASL => {
+            let mechanisms = String::from_utf8_lossy(body);
+            if mechanisms.split('\0').any(|mechanism| mechanism == SCRAM_SHA_256) {
+                return Ok(stream);
+            }
+            Err(Error::ServerAuthError(
+                format!("server offered no {SCRAM_SHA_256} for scram-passthrough"),
+                identifier,
+            ))
+        }
+        b'R' => Err(Error::ServerAuthError(
+            "server asked for a method other than SCRAM; scram-passthrough needs scram-sha-256 in pg_hba.conf"
+                .into(),
+            identifier,
+        )),
+        b'E' => {
+            let msg = PgErrorMsg::parse(body).unwrap_or_default();
+            Err(Error::ServerStartupError(
+                format!("{}: {}", msg.code, msg.message),
+                identifier,
+            ))
+        }
+        code => Err(Error::ServerStartupError(
+            format!("unexpected message '{}' instead of SASL challenge", code as char),
+            identifier,
+        )),
+    }
+}
+
+/// Send the body of a client's SASLInitialResponse or SASLResponse.
+pub(crate) async fn send(stream: &mut StreamInner, body: &[u8]) -> Result<(), Error> {
+    let mut message = BytesMut::with_capacity(body.len() + 5);
+    message.put_u8(b'p');
+    message.put_i32(body.len() as i32 + 4);
+    message.put_slice(body);
+    stream
+        .write_all(&message)
+        .await
+        .map_err(|err| Error::SocketError(format!("Failed to relay SCRAM message: {err}")))
+}
+
+/// Read the server's answer to the last message sent.
+pub(crate) async fn reply(stream: &mut StreamInner) -> Result<Reply, Error> {
+    let message = read(stream).await?;
+    let mut body = &message[5..];
+    let reply = match message[0] {
+        b'R' if body.len() >= 4 => match body.get_i32() {
+            SASL_CONTINUE => Reply::Continue(message),
+            SASL_FINAL => Reply::Final(message),
+            AUTHENTICATION_SUCCESSFUL => Reply::Ok,
+            auth_code => {
+                return Err(Error::ProtocolSyncError(format!(
+                    "unexpected authentication code {auth_code} while relaying SCRAM"
+                )))
+            }
+        },
+        b'E' => Reply::Refused(PgErrorMsg::parse(body).unwrap_or_default()),
+        code => {
+            return Err(Error::ProtocolSyncError(format!(
+                "unexpected message '{}' while relaying SCRAM",
+                code as char
+            )))
+        }
+    };
+    Ok(reply)
+}
+
+/// Keep a connection that reached AuthenticationOk for the pool of
+/// `address`, dropping the oldest beyond `room`: the pool size less the
+/// servers the pool holds. It is closed once parked longer than `max_age`.
+pub(crate) fn park(address: &Address, stream: StreamInner, room: usize, max_age: Option<Duration>) {
+    let mut parked = PARKED.lock();
+    let queue = parked
+        .entry((address.pool_name.clone(), address.username.clone()))
+        .or_default();
+    expire_queue(address, queue);
+    queue.push_back(Parked {
+        stream,
+        parked_at: Instant::now(),
+        max_age,
+    });
+    while queue.len() > room {
+        queue.pop_front();
+        debug!(
+            "[{}@{}] scram-passthrough: closed a parked login over the pool size",
+            address.username, address.pool_name
+        );
+    }
+}
+
+/// The newest parked connection for the pool of `address`.
+pub(crate) fn take(address: &Address) -> Option<StreamInner> {
+    let mut parked = PARKED.lock();
+    let queue = parked.get_mut(&(address.pool_name.clone(), address.username.clone()))?;
+    expire_queue(address, queue);
+    queue.pop_back().map(|parked| parked.stream)
+}
+
+/// Close the parked connections of every pool that outlived their
+/// `max_age`. Run by the retain task.
+pub(crate) fn expire() {
+    let now = Instant::now();
+    PARKED.lock().retain(|_, queue| {
+        queue.retain(|parked| !parked.expired(now));
+        !queue.is_empty()
+    });
+}
+
+fn expire_queue(address: &Address, queue: &mut VecDeque<Parked>) {
+    let now = Instant::now();
+    let before = queue.len();
+    queue.retain(|parked| !parked.expired(now));
+    if queue.len() < before {
+        debug!(
+            "[{}@{}] scram-passthrough: closed {} expired parked login(s)",
+            address.username,
+            address.pool_name,
+            before - queue.len()
+        );
+    }
+}
+
+/// Read one whole message, code and length included.
+async fn read(stream: &mut StreamInner) -> Result<BytesMut, Error> {
+    let code = stream
+        .read_u8()
+        .await
+        .map_err(|err| Error::SocketError(format!("Failed to read relayed SCRAM reply: {err}")))?;
+    let len = stream
+        .read_i32()
+        .await
+        .map_err(|err| Error::SocketError(format!("Failed to read relayed SCRAM reply: {err}")))?;
+    read_message_data(stream, code, len).await
+}
@@ -6,7 +6,7 @@ use std::string::ToString;
 use std::sync::Arc;
 use std::time::{Duration, Instant, SystemTime};
 
-use bytes::{Buf, BufMut, BytesMut};
+use bytes::{Buf, BufMut, Bytes, BytesMut};
 use log::{error, info, warn};
 use lru::LruCache;
 use tokio::io::{AsyncReadExt, BufStream};
@@ -17,12 +17,15 @@ use crate::errors::{Error, ServerIdentifier};
 use crate::messages::PgErrorMsg;
 use crate::messages::{
     read_message_data, simple_query, startup, sync, BytesMutReader, Close, Parse,
+    MAX_CANCEL_KEY_LENGTH,
 };
 use crate::pool::{CancelTarget, ClientServerMap, CANCELED_PIDS};
+use crate::stats::events::{self, SERVER_CLOSE, SERVER_CONNECT};
 use crate::stats::ServerStats;
 
 use super::authentication::handle_authentication;
-use super::cleanup::CleanupState;
+use super::cleanup::{CleanupState, SetScopes};
+use super::copy_progress::{CopyDirection, CopyProgress};
 use super::parameters::ServerParameters;
 use super::stream::{create_tcp_stream_inner, create_unix_stream_inner, StreamInner};
 use super::{prepared_statements, protocol_io, startup_cancel};
@@ -31,6 +34,14 @@ use super::{prepared_statements, protocol_io, startup_cancel};
 /// When the buffer reaches this size, it will be flushed to avoid excessive memory usage.
 const BUFFER_FLUSH_THRESHOLD: usize = 8192;
 
+/// Why a server connection is closed, set before dropping it.
+pub(crate) struct CloseReason {
+    /// Reason of the `server_close` connection event.
+    pub code: &'static str,
+    /// Detail for the log line; the code stands in for it when None.
+    pub detail: Option<String>,
+}
+
 /// Represents a connection to a PostgreSQL server (backend).
 ///
 /// This structure maintains the state of a single connection to a PostgreSQL database server,
@@ -58,8 +69,9 @@ pub struct Server {
     /// PostgreSQL backend process ID, used for query cancellation requests.
     process_id: i32,
 
-    /// Secret key associated with the backend process, required for query cancellation.
-    secret_key: i32,
+    /// Secret key associated with the backend process, required for query
+    /// cancellation. Longer than 4 bytes with protocol 3.2.
+    secret_key: Bytes,
 
     /// Transaction state: true if the server is currently inside a transaction block.
     pub(crate) in_transaction: bool,
@@ -68,9 +80,9 @@ pub struct Server {
     /// Set to false when ReadyForQuery message is received.
     pub(crate) data_available: bool,
 
-    /// COPY mode state: true when the server is in COPY IN or COPY OUT mode.
+    /// COPY mode state: set while the server is in COPY IN or COPY OUT mode.
     /// In this mode, data transfer follows a different protocol.
-    pub(crate) in_copy_mode: bool,
+    copy: Option<CopyProgress>,
 
     /// Async mode state: true when using Flush messages instead of Sync.
     /// In async mode, the server doesn't wait for ReadyForQuery after each command.
@@ -89,6 +101,20 @@ pub struct Server {
     /// before being returned to the pool. Set when SET, PREPARE, or DECLARE statements are executed.
     pub(crate) cleanup_state: CleanupState,
 
+    /// SETs of the open transaction block, by savepoint level. They arm
+    /// `cleanup_state.needs_cleanup_set` only once committed.
+    pub(crate) set_scopes: SetScopes,
+
+    /// Completed PREPARE TRANSACTION / COMMIT PREPARED / ROLLBACK PREPARED
+    /// commands. The client compares it across a round trip to learn whether
+    /// its two-phase command succeeded.
+    pub(crate) two_phase_commands: u64,
+
+    /// Completed DEALLOCATE ALL / DISCARD ALL commands. The client compares
+    /// it across a round trip to learn that its own prepared statements are
+    /// gone server-side.
+    pub(crate) prepared_resets: u64,
+
     /// Shared mapping of client-to-server connections for query cancellation support.
     /// Allows canceling queries by mapping client process IDs to server process IDs.
     client_server_map: ClientServerMap,
@@ -149,18 +175,43 @@ pub struct Server {
     /// A value of 0 disables streaming.
     pub(crate) max_message_size: i32,
 
+    /// Buffered bytes at which DataRow and CopyData responses are flushed
+    /// to the client; from the pool's `data_row_flush_threshold` and
+    /// `copy_data_flush_threshold`. 0 flushes after every message.
+    pub(crate) data_row_flush_threshold: usize,
+    pub(crate) copy_data_flush_threshold: usize,
+
+    /// Custom GUC carrying the client address (pool `client_addr_guc`),
+    /// and the value the backend holds now. `client_addr_sent` is cleared
+    /// whenever a SET, RESET or DISCARD may have changed it.
+    pub(crate) client_addr_guc: Option<String>,
+    pub(crate) client_addr_sent: Option<String>,
+
     /// Large message header saved when recv() needs to return accumulated buffer first.
     /// The large DataRow/CopyData/FunctionCallResponse will be streamed on the next recv() call.
     pub(crate) pending_large_message: Option<(u8, i32)>,
 
     /// Reason for closing this connection, set before dropping.
     /// Used by Drop to produce a single log line with cause and effect.
-    pub(crate) close_reason: Option<String>,
+    pub(crate) close_reason: Option<CloseReason>,
 
     /// Per-connection lifetime override (ms). Set on fallback connections so
     /// they expire before the local backend recovers.
     pub(crate) override_lifetime_ms: Option<u64>,
 
+    /// Backend IP this connection was opened to, recorded only when the
+    /// configured host is a DNS name. Compared against the latest DNS
+    /// answer to retire connections to addresses that left the record.
+    pub(crate) resolved_ip: Option<std::net::IpAddr>,
+
+    /// When the backend role was last verified for `target_session_attrs`.
+    /// Drives the periodic re-check (`server_role_check_interval`).
+    pub(crate) role_checked_at: Option<std::time::Instant>,
+
+    /// When the backend memory footprint was last checked against
+    /// `server_max_memory`.
+    pub(crate) memory_checked_at: Option<std::time::Instant>,
+
     /// GUC names injected by configured `startup_parameters` for this backend.
     /// Checkout sync must not overwrite them with client StartupMessage
     /// values. Shared because every backend from the same pool uses the
@@ -225,6 +276,42 @@ impl Server {
         Ok(())
     }
 
+    /// Execute a single-value query with the simple query protocol and
+    /// return the first column of the first row as text. `None` means
+    /// the query produced no rows or a NULL value.
+    pub async fn query_first_value(&mut self, query: &str) -> Result<Option<String>, Error> {
+        let query = simple_query(query);
+
+        self.last_sql_error = None;
+
+        self.send_and_flush(&query).await?;
+
+        let mut response = BytesMut::new();
+        loop {
+            let mut overflow = BytesMut::new();
+            let chunk = self
+                .recv(
+                    crate::utils::buffering_writer::BufferingWriter::new(&mut overflow),
+                    None,
+                )
+                .await?;
+            response.extend_from_slice(&chunk);
+            response.extend_from_slice(&overflow);
+
+            if !self.data_available {
+                break;
+            }
+        }
+
+        if let Some((sqlstate, message)) = self.last_sql_error.take() {
+            return Err(Error::QueryError(format!(
+                "backend rejected query (SQLSTATE {sqlstate}): {message}"
+            )));
+        }
+
+        Ok(protocol_io::first_data_row_value(&response))
+    }
+
     /// Check if the connection is alive by sending a minimal query (`;`).
     /// Uses the provided timeout for the operation.
     /// Returns Ok(()) if connection is alive, Err if dead or timeout exceeded.
@@ -255,6 +342,12 @@ impl Server {
         self.process_id
     }
 
+    /// Whether the backend's current role is a superuser, as last reported
+    /// by PostgreSQL in the `is_superuser` ParameterStatus.
+    pub fn is_superuser(&self) -> bool {
+        self.server_parameters.get_param("is_superuser") == Some("on")
+    }
+
     /// Returns a copy of all server parameters as a HashMap.
     /// Includes runtime parameters like client_encoding, TimeZone, DateStyle, etc.
     #[inline(always)]
@@ -276,6 +369,14 @@ impl Server {
         protocol_io::recv(self, client_stream, client_server_parameters).await
     }
 
+    /// Record why the connection is about to be closed. The first reason
+    /// recorded is kept.
+    pub(crate) fn set_close_reason(&mut self, code: &'static str, detail: Option<String>) {
+        if self.close_reason.is_none() {
+            self.close_reason = Some(CloseReason { code, detail });
+        }
+    }
+
     /// Indicate that this server connection cannot be re-used and must be discarded.
     pub fn mark_bad(&mut self, reason: &str) {
         error!(
@@ -364,7 +465,7 @@ impl Server {
 
     pub async fn send_and_flush_timeout(
         &mut self,
-        messages: &BytesMut,
+        messages: &[u8],
         duration: Duration,
     ) -> Result<(), Error> {
         protocol_io::send_and_flush_timeout(self, messages, duration).await
@@ -385,7 +486,33 @@ impl Server {
     /// In COPY mode, data transfer follows a different protocol than normal queries.
     #[inline(always)]
     pub fn in_copy_mode(&self) -> bool {
-        self.in_copy_mode
+        self.copy.is_some()
+    }
+
+    /// Enter COPY mode on CopyInResponse or CopyOutResponse.
+    pub(crate) fn start_copy(&mut self, direction: CopyDirection) {
+        self.end_copy(0);
+        self.copy = Some(CopyProgress::start(
+            direction,
+            &self.address.username,
+            &self.address.pool_name,
+        ));
+    }
+
+    /// Count a CopyData message forwarded in either direction.
+    #[inline]
+    pub(crate) fn add_copy_bytes(&mut self, bytes: u64) {
+        if let Some(copy) = self.copy.as_mut() {
+            copy.add_bytes(bytes, &self.address.username, &self.address.pool_name);
+        }
+    }
+
+    /// Leave COPY mode, if in it. `rows` comes from the `COPY n`
+    /// CommandComplete tag and is 0 when the COPY did not complete.
+    pub(crate) fn end_copy(&mut self, rows: u64) {
+        if let Some(copy) = self.copy.take() {
+            copy.finish(rows, &self.address.username, &self.address.pool_name);
+        }
     }
 
     /// Returns a string representation of the server address (host:port/database@user).
@@ -471,20 +598,27 @@ impl Server {
             );
             let mut reset_string = String::from("RESET ROLE;");
 
-            if self.cleanup_state.needs_cleanup_set {
+            // DISCARD ALL also covers RESET ALL, DEALLOCATE ALL and CLOSE ALL.
+            let discard = self.cleanup_state.needs_cleanup_discard;
+            if discard {
+                reset_string.push_str("DISCARD ALL;");
+            };
+
+            if self.cleanup_state.needs_cleanup_set && !discard {
                 reset_string.push_str("RESET ALL;");
             };
 
-            if self.cleanup_state.needs_cleanup_prepare {
+            if self.cleanup_state.needs_cleanup_prepare && !discard {
                 reset_string.push_str("DEALLOCATE ALL;");
             };
 
-            if self.cleanup_state.needs_cleanup_declare {
+            if self.cleanup_state.needs_cleanup_declare && !discard {
                 reset_string.push_str("CLOSE ALL;");
             };
 
             self.small_simple_query(&reset_string).await?;
-            if self.cleanup_state.needs_cleanup_prepare {
+            self.client_addr_sent = None;
+            if self.cleanup_state.needs_cleanup_prepare || discard {
                 // flush prepared.
                 self.registering_prepared_statement.clear();
                 if self.prepared_statement_cache.is_some() {
@@ -499,7 +633,7 @@ impl Server {
             self.cleanup_state.reset();
         }
         self.in_transaction = false;
-        self.in_copy_mode = false;
+        self.end_copy(0);
         Ok(())
     }
 
@@ -646,7 +780,7 @@ impl Server {
             (process_id, secret_key),
             CancelTarget {
                 process_id: self.process_id,
-                secret_key: self.secret_key,
+                secret_key: self.secret_key.clone(),
                 host: self.address.host.clone(),
                 port: self.address.port,
                 server_tls: self.address.server_tls.clone(),
@@ -707,7 +841,15 @@ impl Server {
         Ok(())
     }
 
-    pub async fn sync_parameters(&mut self, parameters: &ServerParameters) -> Result<(), Error> {
+    /// `application_name`, when set, is the pool's rendered
+    /// `application_name_template` and replaces the client's own value.
+    /// `client_addr` is forwarded when the pool has `client_addr_guc`.
+    pub async fn sync_parameters(
+        &mut self,
+        parameters: &ServerParameters,
+        application_name: Option<&str>,
+        client_addr: &str,
+    ) -> Result<(), Error> {
         let mut parameter_diff = self.server_parameters.compare_params(parameters);
 
         // Configured startup_parameters win over client StartupMessage values.
@@ -715,6 +857,53 @@ impl Server {
             parameter_diff.retain(|k, _| !self.operator_managed_startup_keys.contains(k));
         }
 
+        self.add_client_identity(&mut parameter_diff, application_name, client_addr);
+        self.apply_parameter_diff(parameter_diff).await
+    }
+
+    /// Set only the client identity (`application_name_template`,
+    /// `client_addr_guc`), for pools without `sync_server_parameters`.
+    /// No round trip when the backend already carries both values.
+    pub async fn sync_client_identity(
+        &mut self,
+        application_name: Option<&str>,
+        client_addr: &str,
+    ) -> Result<(), Error> {
+        let mut parameter_diff = HashMap::new();
+        self.add_client_identity(&mut parameter_diff, application_name, client_addr);
+        self.apply_parameter_diff(parameter_diff).await
+    }
+
+    fn add_client_identity(
+        &self,
+        parameter_diff: &mut HashMap<String, crate::server::parameters::ParamAction>,
+        application_name: Option<&str>,
+        client_addr: &str,
+    ) {
+        use crate::server::parameters::ParamAction;
+
+        if let Some(name) = application_name {
+            parameter_diff.remove("application_name");
+            if self.server_parameters.get_param("application_name") != Some(name) {
+                parameter_diff.insert(
+                    "application_name".to_string(),
+                    ParamAction::SetTo(name.to_string()),
+                );
+            }
+        }
+
+        if let Some(guc) = &self.client_addr_guc {
+            parameter_diff.remove(guc);
+            if self.client_addr_sent.as_deref() != Some(client_addr) {
+                parameter_diff.insert(guc.clone(), ParamAction::SetTo(client_addr.to_string()));
+            }
+        }
+    }
+
+    async fn apply_parameter_diff(
+        &mut self,
+        parameter_diff: HashMap<String, crate::server::parameters::ParamAction>,
+    ) -> Result<(), Error> {
         if parameter_diff.is_empty() {
             return Ok(());
         }
@@ -746,6 +935,13 @@ impl Server {
         if res.is_ok() {
             for (key, action) in parameter_diff {
                 match action {
+                    // Tracked apart from the parameter snapshot so it is
+                    // never copied to clients or reset by checkout sync.
+                    crate::server::parameters::ParamAction::SetTo(value)
+                        if self.client_addr_guc.as_ref() == Some(&key) =>
+                    {
+                        self.client_addr_sent = Some(value);
+                    }
                     crate::server::parameters::ParamAction::SetTo(value) => {
                         let _ = self.server_parameters.set_param(&key, value, true);
                     }
@@ -767,7 +963,7 @@ impl Server {
         host: &str,
         port: u16,
         process_id: i32,
-        secret_key: i32,
+        secret_key: &[u8],
         server_tls: &tls::ServerTlsConfig,
         connected_with_tls: bool,
         pool_name: &str,
@@ -789,6 +985,24 @@ impl Server {
         self.cleanup_state.set_true();
     }
 
+    /// Two-phase commands completed on this connection.
+    #[inline(always)]
+    pub fn two_phase_commands(&self) -> u64 {
+        self.two_phase_commands
+    }
+
+    /// DEALLOCATE ALL / DISCARD ALL commands completed on this connection.
+    #[inline(always)]
+    pub fn prepared_resets(&self) -> u64 {
+        self.prepared_resets
+    }
+
+    // Marks a connection as needing DISCARD ALL at checkin: a pinned client
+    // left session-level state (temp tables, advisory locks) on it
+    pub fn mark_session_state(&mut self) {
+        self.cleanup_state.needs_cleanup_discard = true;
+    }
+
     /// Pretend to be the Postgres client and connect to the server given host, port and credentials.
     /// Perform the authentication and return the server in a ready for query state.
     ///
@@ -813,6 +1027,43 @@ impl Server {
     ) -> Result<Server, Error> {
         let config = get_config();
 
+        // server_vault_path users log in with the credentials currently
+        // issued by Vault.
+        let vault_user;
+        let user = if user.server_vault_path.is_some() {
+            vault_user = crate::vault::backend_user(&address.pool_name, user).ok_or_else(|| {
+                Error::ServerStartupError(
+                    "backend credentials have not been read from vault yet".into(),
+                    ServerIdentifier::new(user.username.clone(), database, &address.pool_name),
+                )
+            })?;
+            &vault_user
+        } else {
+            user
+        };
+        // server_rds_iam users log in with an IAM token signed for the
+        // host being connected to.
+        let iam_user;
+        let user = if user.server_rds_iam {
+            let db_user = user.server_username.as_deref().unwrap_or(&user.username);
+            let token = crate::aws::rds_auth_token(&address.host, address.port, db_user)
+                .await
+                .map_err(|err| {
+                    Error::ServerAuthError(
+                        format!("rds iam token: {err}"),
+                        ServerIdentifier::new(db_user.to_string(), database, &address.pool_name),
+                    )
+                })?;
+            iam_user = User {
+                server_username: Some(db_user.to_string()),
+                server_password: Some(token),
+                ..user.clone()
+            };
+            &iam_user
+        } else {
+            user
+        };
+
         log::debug!(
             "[{}@{}] server startup connecting to {}:{} server_tls_mode={}",
             user.username,
@@ -822,7 +1073,21 @@ impl Server {
             address.server_tls.mode
         );
 
-        let mut stream = if address.host.starts_with('/') {
+        // scram-passthrough users have no secret to log in with: the pool
+        // takes over a backend connection a client login was relayed on,
+        // already past its StartupMessage and authentication.
+        let relayed = address
+            .backend_auth
+            .as_ref()
+            .is_some_and(|ba| matches!(*ba.read(), BackendAuthMethod::ScramRelay));
+        let mut stream = if relayed {
+            super::scram_relay::take(address).ok_or_else(|| {
+                Error::ServerStartupError(
+                    "no client login to open a scram-passthrough connection with".into(),
+                    ServerIdentifier::new(user.username.clone(), database, &address.pool_name),
+                )
+            })?
+        } else if address.host.starts_with('/') {
             create_unix_stream_inner(&address.host, address.port).await?
         } else {
             create_tcp_stream_inner(
@@ -835,6 +1100,11 @@ impl Server {
         };
 
         let connected_with_tls = matches!(&stream, StreamInner::TCPTls { .. });
+        let resolved_ip = if crate::pool::dns::is_hostname(&address.host) {
+            stream.peer_ip()
+        } else {
+            None
+        };
         log::debug!(
             "[{}@{}] server connection to {}:{} established tls={}",
             user.username,
@@ -855,17 +1125,20 @@ impl Server {
         let auth_started = Instant::now();
         let mut startup_started: Option<Instant> = None;
 
-        startup(
-            &mut stream,
-            username.as_str(),
-            database,
-            application_name.as_str(),
-            startup_parameters,
-        )
-        .await?;
+        if !relayed {
+            startup(
+                &mut stream,
+                config.general.server_protocol_version(),
+                username.as_str(),
+                database,
+                application_name.as_str(),
+                startup_parameters,
+            )
+            .await?;
+        }
 
         let mut process_id: i32 = 0;
-        let mut secret_key: i32 = 0;
+        let mut secret_key = Bytes::new();
         let server_identifier =
             ServerIdentifier::new(username.clone(), database, &address.pool_name);
 
@@ -1056,19 +1329,42 @@ impl Server {
                 // BackendKeyData
                 'K' => {
                     // The frontend must save these values if it wishes to be able to issue CancelRequest messages later.
-                    process_id = stream.read_i32().await.map_err(|_| {
-                        Error::ServerStartupError(
-                            "failed to read process ID during startup".into(),
+                    // With protocol 3.2 the secret key is 4 to 256 bytes long.
+                    let key_len = (len as usize).saturating_sub(8);
+                    if len < 12 || key_len > MAX_CANCEL_KEY_LENGTH {
+                        return Err(Error::ServerStartupError(
+                            format!("invalid BackendKeyData length {len} during startup"),
                             server_identifier.clone(),
-                        )
-                    })?;
+                        ));
+                    }
+                    let mut bytes = read_message_data(&mut stream, code as u8, len).await?;
+                    bytes.advance(5);
+                    process_id = bytes.get_i32();
+                    secret_key = bytes.freeze();
+                }
 
-                    secret_key = stream.read_i32().await.map_err(|_| {
-                        Error::ServerStartupError(
-                            "failed to read secret key during startup".into(),
+                // NegotiateProtocolVersion: the server is older than the
+                // protocol version we asked for and carries on with the one
+                // it reports.
+                'v' => {
+                    let mut bytes = read_message_data(&mut stream, code as u8, len).await?;
+                    bytes.advance(5);
+                    if bytes.remaining() < 4 {
+                        return Err(Error::ServerStartupError(
+                            "truncated NegotiateProtocolVersion during startup".into(),
                             server_identifier.clone(),
-                        )
-                    })?;
+                        ));
+                    }
+                    let version = bytes.get_i32();
+                    log::debug!(
+                        "[{}@{}] server {}:{} negotiated protocol {}.{}",
+                        server_identifier.username,
+                        server_identifier.pool_name,
+                        address.host,
+                        address.port,
+                        version >> 16,
+                        version & 0xffff
+                    );
                 }
 
                 // ReadyForQuery
@@ -1087,6 +1383,16 @@ impl Server {
                         phase_started.elapsed().as_secs_f64(),
                     );
 
+                    let (data_row_flush_threshold, copy_data_flush_threshold) = config
+                        .pools
+                        .get(&address.pool_name)
+                        .map(|pool| pool.flush_thresholds())
+                        .unwrap_or((BUFFER_FLUSH_THRESHOLD, BUFFER_FLUSH_THRESHOLD));
+                    let client_addr_guc = config
+                        .pools
+                        .get(&address.pool_name)
+                        .and_then(|pool| pool.client_addr_guc.clone());
+
                     let server = Server {
                         address: address.to_owned(),
                         stream: BufStream::new(stream),
@@ -1096,12 +1402,15 @@ impl Server {
                         process_id,
                         secret_key,
                         in_transaction: false,
-                        in_copy_mode: false,
+                        copy: None,
                         data_available: false,
                         bad: false,
                         async_mode: false,
                         expected_responses: 0,
                         cleanup_state: CleanupState::new(),
+                        set_scopes: SetScopes::default(),
+                        two_phase_commands: 0,
+                        prepared_resets: 0,
                         client_server_map,
                         connected_at: chrono::offset::Utc::now().naive_utc(),
                         stats,
@@ -1122,14 +1431,34 @@ impl Server {
                         session_mode,
                         max_message_size: config.general.message_size_to_be_stream.as_bytes()
                             as i32,
+                        data_row_flush_threshold,
+                        copy_data_flush_threshold,
+                        client_addr_guc,
+                        client_addr_sent: None,
                         pending_large_message: None,
                         close_reason: None,
                         override_lifetime_ms: None,
+                        resolved_ip,
+                        role_checked_at: None,
+                        memory_checked_at: None,
                         operator_managed_startup_keys,
                         last_sql_error: None,
                     };
                     server.stats.update_process_id(process_id);
                     server.stats.set_tls(connected_with_tls);
+                    events::emit(
+                        SERVER_CONNECT,
+                        "startup",
+                        format_args!(
+                            "user={} pool={} pid={} host={}:{} tls={}",
+                            server.address.username,
+                            server.address.pool_name,
+                            process_id,
+                            server.address.host,
+                            server.address.port,
+                            connected_with_tls
+                        ),
+                    );
 
                     return Ok(server);
                 }
@@ -1154,6 +1483,7 @@ impl Drop for Server {
     fn drop(&mut self) {
         // Update statistics
         self.stats.disconnect();
+        self.end_copy(0);
         {
             let mut guard = CANCELED_PIDS.lock();
             guard.remove(&self.process_id);
@@ -1180,10 +1510,33 @@ impl Drop for Server {
         let duration = now - self.connected_at;
         let session = crate::utils::format_duration(&duration);
 
+        let reason = match &self.close_reason {
+            Some(reason) => reason.code,
+            None if self.bad => "server_error",
+            None => "closed",
+        };
+        events::emit(
+            SERVER_CLOSE,
+            reason,
+            format_args!(
+                "user={} pool={} pid={} host={}:{} session_ms={}",
+                self.address.username,
+                self.address.pool_name,
+                self.process_id,
+                self.address.host,
+                self.address.port,
+                duration.num_milliseconds()
+            ),
+        );
+
         match (&self.close_reason, self.bad) {
             (Some(reason), _) => info!(
                 "[{}@{}] server closed pid={}: {}, session={}",
-                self.address.username, self.address.pool_name, self.process_id, reason, session,
+                self.address.username,
+                self.address.pool_name,
+                self.process_id,
+                reason.detail.as_deref().unwrap_or(reason.code),
+                session,
             ),
             (None, true) => info!(
                 "[{}@{}] server terminated pid={}, session={}",
@@ -15,7 +15,7 @@ pub(crate) async fn cancel(
     host: &str,
     port: u16,
     process_id: i32,
-    secret_key: i32,
+    secret_key: &[u8],
     server_tls: &ServerTlsConfig,
     connected_with_tls: bool,
     pool_name: &str,
@@ -23,6 +23,7 @@ pub(crate) async fn cancel(
     let disable_config = ServerTlsConfig {
         mode: ServerTlsMode::Disable,
         connector: None,
+        direct: false,
         cert_hash: None,
     };
     let cancel_tls = if connected_with_tls {
@@ -39,11 +40,14 @@ pub(crate) async fn cancel(
 
     warn!("cancel request forwarded to {host}:{port} pid={process_id}");
 
-    let mut bytes = BytesMut::with_capacity(16);
-    bytes.put_i32(16);
+    // The key is as long as the server sent it: 4 bytes, or more with
+    // protocol 3.2.
+    let len = 12 + secret_key.len();
+    let mut bytes = BytesMut::with_capacity(len);
+    bytes.put_i32(len as i32);
     bytes.put_i32(CANCEL_REQUEST_CODE);
     bytes.put_i32(process_id);
-    bytes.put_i32(secret_key);
+    bytes.put_slice(secret_key);
 
     write_all_flush(&mut stream, &bytes).await
 }
@@ -1,9 +1,12 @@
 use std::io;
 use std::time::Instant;
 
-use crate::config::tls::ServerTlsConfig;
+use crate::config::features;
+use crate::config::tls::{ServerTlsConfig, POSTGRESQL_ALPN};
 use crate::errors::Error;
-use crate::messages::{configure_tcp_socket, configure_unix_socket, ssl_request};
+use crate::messages::{configure_server_tcp_socket, configure_unix_socket, ssl_request};
+
+use super::happy_eyeballs;
 
 use pin_project_lite::pin_project;
 use tokio::io::{AsyncRead, AsyncReadExt, AsyncWrite};
@@ -125,6 +128,21 @@ impl StreamInner {
         }
     }
 
+    /// Remote IP address of a TCP stream; `None` for unix sockets.
+    pub fn peer_ip(&self) -> Option<std::net::IpAddr> {
+        match self {
+            StreamInner::TCPPlain { stream } => stream.peer_addr().ok().map(|a| a.ip()),
+            StreamInner::TCPTls { stream } => stream
+                .get_ref()
+                .get_ref()
+                .get_ref()
+                .peer_addr()
+                .ok()
+                .map(|a| a.ip()),
+            StreamInner::UnixSocket { .. } => None,
+        }
+    }
+
     /// Returns true if this stream uses TLS encryption.
     pub fn is_tls(&self) -> bool {
         matches!(self, StreamInner::TCPTls { .. })
@@ -172,7 +190,7 @@ pub(crate) async fn create_tcp_stream_inner(
     pool_name: &str,
 ) -> Result<StreamInner, Error> {
     let tcp_started = Instant::now();
-    let mut stream = match TcpStream::connect(&format!("{host}:{port}")).await {
+    let mut stream = match happy_eyeballs::connect(host, port).await {
         Ok(stream) => stream,
         Err(err) => {
             log::error!("Failed to connect to TCP {host}:{port}: {err}");
@@ -180,7 +198,7 @@ pub(crate) async fn create_tcp_stream_inner(
         }
     };
 
-    configure_tcp_socket(&stream);
+    configure_server_tcp_socket(&stream);
 
     crate::web::metrics::observe_backend_create_phase(
         "tcp_connect",
@@ -195,11 +213,30 @@ pub(crate) async fn create_tcp_stream_inner(
         return Ok(StreamInner::TCPPlain { stream });
     }
 
+    let tls_started = Instant::now();
+    // `direct_tls` off sends SSLRequest first; servers accept it either way.
+    let direct = server_tls.direct && features::enabled(features::DIRECT_TLS);
+    if direct {
+        log::debug!(
+            "direct tls negotiation started, server_tls_mode={} host={host} port={port}",
+            server_tls.mode
+        );
+        return tls_connect(
+            host,
+            port,
+            stream,
+            server_tls,
+            direct,
+            pool_name,
+            tls_started,
+        )
+        .await;
+    }
+
     log::debug!(
         "tls negotiation started, server_tls_mode={} host={host} port={port}",
         server_tls.mode
     );
-    let tls_started = Instant::now();
     ssl_request(&mut stream).await?;
 
     let response = match stream.read_u8().await {
@@ -221,48 +258,16 @@ pub(crate) async fn create_tcp_stream_inner(
 
     match response {
         'S' => {
-            let connector = server_tls.connector.as_ref().ok_or_else(|| {
-                Error::SocketError(format!(
-                    "tls connector not configured but server accepted tls, host={host} port={port}"
-                ))
-            })?;
-
-            let start = Instant::now();
-            match connector.connect(host, stream).await {
-                Ok(tls_stream) => {
-                    let elapsed = start.elapsed();
-                    log::info!(
-                        "tls connection established, host={host} port={port} server_tls_mode={} handshake_ms={:.1}",
-                        server_tls.mode,
-                        elapsed.as_secs_f64() * 1000.0
-                    );
-                    crate::web::metrics::SHOW_SERVER_TLS_HANDSHAKE_DURATION
-                        .with_label_values(&[pool_name])
-                        .observe(elapsed.as_secs_f64());
-                    crate::web::metrics::observe_backend_create_phase(
-                        "tls",
-                        tls_started.elapsed().as_secs_f64(),
-                    );
-                    Ok(StreamInner::TCPTls { stream: tls_stream })
-                }
-                // We do NOT retry on a new plain TCP socket when TLS handshake
-                // fails after server responded 'S'. The TCP connection is already
-                // consumed by the partial handshake.
-                Err(err) => {
-                    let elapsed = start.elapsed();
-                    log::error!(
-                        "tls handshake failed, host={host} port={port} server_tls_mode={} handshake_ms={:.1}: {err}",
-                        server_tls.mode,
-                        elapsed.as_secs_f64() * 1000.0
-                    );
-                    crate::web::metrics::SHOW_SERVER_TLS_HANDSHAKE_ERRORS
-                        .with_label_values(&[pool_name])
-                        .inc();
-                    Err(Error::SocketError(format!(
-                        "tls handshake failed, host={host} port={port}: {err}"
-                    )))
-                }
-            }
+            tls_connect(
+                host,
+                port,
+                stream,
+                server_tls,
+                false,
+                pool_name,
+                tls_started,
+            )
+            .await
         }
         'N' => {
             if server_tls.mode.requires_tls() {
@@ -297,6 +302,77 @@ pub(crate) async fn create_tcp_stream_inner(
     }
 }
 
+/// Run the TLS handshake on `stream`, after the server answered 'S' to
+/// SSLRequest or right away with `server_tls_negotiation = direct` (`direct`).
+async fn tls_connect(
+    host: &str,
+    port: u16,
+    stream: TcpStream,
+    server_tls: &ServerTlsConfig,
+    direct: bool,
+    pool_name: &str,
+    tls_started: Instant,
+) -> Result<StreamInner, Error> {
+    let connector = server_tls.connector.as_ref().ok_or_else(|| {
+        Error::SocketError(format!(
+            "tls connector not configured but server accepted tls, host={host} port={port}"
+        ))
+    })?;
+
+    let start = Instant::now();
+    match connector.connect(host, stream).await {
+        Ok(tls_stream) => {
+            let elapsed = start.elapsed();
+            // A server that completes a direct handshake without selecting
+            // the protocol is not speaking PostgreSQL on the other side.
+            if direct {
+                let alpn = tls_stream.get_ref().negotiated_alpn().ok().flatten();
+                if alpn.as_deref() != Some(POSTGRESQL_ALPN.as_bytes()) {
+                    crate::web::metrics::SHOW_SERVER_TLS_HANDSHAKE_ERRORS
+                        .with_label_values(&[pool_name])
+                        .inc();
+                    return Err(Error::SocketError(format!(
+                        "direct tls: server did not select ALPN \"{POSTGRESQL_ALPN}\" \
+                         (PostgreSQL 17+ required), host={host} port={port}"
+                    )));
+                }
+            }
+            log::info!(
+                "tls connection established, host={host} port={port} server_tls_mode={} direct={} handshake_ms={:.1}",
+                server_tls.mode,
+                direct,
+                elapsed.as_secs_f64() * 1000.0
+            );
+            crate::web::metrics::SHOW_SERVER_TLS_HANDSHAKE_DURATION
+                .with_label_values(&[pool_name])
+                .observe(elapsed.as_secs_f64());
+            crate::web::metrics::observe_backend_create_phase(
+                "tls",
+                tls_started.elapsed().as_secs_f64(),
+            );
+            Ok(StreamInner::TCPTls { stream: tls_stream })
+        }
+        // We do NOT retry on a new plain TCP socket when TLS handshake
+        // fails after server responded 'S'. The TCP connection is already
+        // consumed by the partial handshake.
+        Err(err) => {
+            let elapsed = start.elapsed();
+            log::error!(
+                "tls handshake failed, host={host} port={port} server_tls_mode={} direct={} handshake_ms={:.1}: {err}",
+                server_tls.mode,
+                direct,
+                elapsed.as_secs_f64() * 1000.0
+            );
+            crate::web::metrics::SHOW_SERVER_TLS_HANDSHAKE_ERRORS
+                .with_label_values(&[pool_name])
+                .inc();
+            Err(Error::SocketError(format!(
+                "tls handshake failed, host={host} port={port}: {err}"
+            )))
+        }
+    }
+}
+
 fn connect_error_from_io(target: &str, err: io::Error) -> Error {
     let msg = format!("Could not connect to {target}: {err}");
     if is_fd_exhaustion_io(&err) {
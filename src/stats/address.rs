@@ -98,6 +98,11 @@ pub struct AddressStats {
     /// instead of locking the histogram mutex on every eviction call.
     pub p95_xact_time_us: AtomicU64,
 
+    /// Cumulative number of client checkouts. With `total.wait_time` it
+    /// gives the mean checkout wait over any interval, which adaptive pool
+    /// sizing reads without touching the histogram mutex.
+    pub checkout_count: AtomicU64,
+
     /// Cumulative error counter keyed by PostgreSQL SQLSTATE code (5-char).
     /// Updated alongside `total.errors`. Sharded; the hot path takes a single
     /// shard's read lock for the atomic increment, the slow path inserts a
@@ -139,6 +144,7 @@ impl Default for AddressStats {
             query_histogram: Mutex::new(new_histogram()),
             wait_histogram: Mutex::new(new_histogram()),
             p95_xact_time_us: AtomicU64::new(0),
+            checkout_count: AtomicU64::new(0),
             errors_by_sqlstate: DashMap::new(),
             generation: next_address_stats_generation(),
         }
@@ -351,6 +357,7 @@ impl AddressStats {
     pub fn wait_time_add(&self, time: u64) {
         self.total.wait_time.fetch_add(time, Ordering::Relaxed);
         self.current.wait_time.fetch_add(time, Ordering::Relaxed);
+        self.checkout_count.fetch_add(1, Ordering::Relaxed);
 
         // Record the wait time in the histogram if we can acquire the lock.
         // Matches the `try_lock` discipline of query/xact paths: the hot
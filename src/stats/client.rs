@@ -1,5 +1,7 @@
 use super::{get_reporter, Reporter};
+use bytes::Bytes;
 use iota::iota;
+use parking_lot::Mutex;
 use std::sync::atomic::*;
 use std::sync::Arc;
 
@@ -29,6 +31,88 @@ iota! {
         , CLIENT_WAIT_WRITE
 }
 
+// Protocol trace levels set per client by `TRACE CLIENT`:
+// - OFF: nothing is traced
+// - ON: message types, sizes and timings are logged at info level
+// - PAYLOAD: as ON, plus the leading bytes of every message in hex
+pub const CLIENT_TRACE_OFF: u8 = 0;
+pub const CLIENT_TRACE_ON: u8 = 1;
+pub const CLIENT_TRACE_PAYLOAD: u8 = 2;
+
+/// Bytes of statement text SHOW ACTIVE_QUERIES renders per client. The
+/// view shows `PREVIEW_QUERY_MAX_CHARS` after normalization; the extra
+/// room covers literals and whitespace that normalization removes.
+const CURRENT_QUERY_MAX_BYTES: usize = 1024;
+
+/// Text of the statement a client has sent, as a handle on memory the
+/// client already holds: recording it copies nothing, and it is decoded
+/// only when SHOW ACTIVE_QUERIES reads it. A handle keeps the message it
+/// points into alive until the client's next statement replaces it.
+#[derive(Default, Clone)]
+pub enum QueryText {
+    #[default]
+    None,
+    /// Query text of a cached Parse.
+    Shared(Arc<str>),
+    /// Query text sliced out of the client's message.
+    Message(Bytes),
+    /// Placeholder for messages that carry no text.
+    Label(&'static str),
+}
+
+impl QueryText {
+    fn as_bytes(&self) -> &[u8] {
+        match self {
+            QueryText::None => b"",
+            QueryText::Shared(text) => text.as_bytes(),
+            QueryText::Message(bytes) => bytes,
+            QueryText::Label(label) => label.as_bytes(),
+        }
+    }
+
+    /// Leading `CURRENT_QUERY_MAX_BYTES` of the text, verbatim.
+    fn render(&self) -> String {
+        let bytes = self.as_bytes();
+        String::from_utf8_lossy(&bytes[..bytes.len().min(CURRENT_QUERY_MAX_BYTES)]).into_owned()
+    }
+}
+
+impl From<Arc<str>> for QueryText {
+    fn from(text: Arc<str>) -> Self {
+        QueryText::Shared(text)
+    }
+}
+
+impl From<Bytes> for QueryText {
+    fn from(bytes: Bytes) -> Self {
+        QueryText::Message(bytes)
+    }
+}
+
+impl From<&'static str> for QueryText {
+    fn from(label: &'static str) -> Self {
+        QueryText::Label(label)
+    }
+}
+
+/// Statement most recently sent by a client.
+#[derive(Default)]
+struct CurrentQuery {
+    text: QueryText,
+    /// Nanoseconds since `connect_time` when the statement arrived.
+    started_nanos: u64,
+}
+
+/// A statement in flight, as reported by SHOW ACTIVE_QUERIES.
+pub struct ActiveQuery {
+    /// PID of the backend running the statement.
+    pub server_process_id: i32,
+    /// Milliseconds since the statement arrived from the client.
+    pub elapsed_ms: u64,
+    /// Statement text, verbatim and capped at `CURRENT_QUERY_MAX_BYTES`.
+    pub text: String,
+}
+
 /// Snapshot of per-client prepared cache state pushed from the
 /// client into ClientStats atomics.
 ///
@@ -93,6 +177,8 @@ pub struct ClientStats {
     connect_time: quanta::Instant,
     /// Whether the client is using TLS/SSL encryption
     use_tls: bool,
+    /// Tag the client set with `general.client_tag_parameter`, empty if none
+    tag: String,
 
     /// Reporter instance used to register/unregister this client with the stats system
     reporter: Reporter,
@@ -137,6 +223,22 @@ pub struct ClientStats {
     pub prepared_anonymous_evictions: AtomicU64,
     /// Whether this client is async (uses Flush instead of Sync)
     pub is_async_client: AtomicBool,
+
+    /// Current statement
+    /// ------------------------------------------------------------------------------------------
+    /// Statement most recently sent by the client
+    current_query: Mutex<CurrentQuery>,
+    /// PID of the backend last assigned to the client
+    server_process_id: AtomicI32,
+
+    /// Protocol trace level (`CLIENT_TRACE_*`), toggled at runtime by
+    /// `TRACE CLIENT`
+    trace: AtomicU8,
+
+    /// Set once the client was chosen for eviction above
+    /// `max_connections_soft`; `eviction` wakes it at its next idle point.
+    evicting: AtomicBool,
+    eviction: tokio::sync::Notify,
 }
 
 /// Default implementation for ClientStats.
@@ -171,8 +273,14 @@ impl Default for ClientStats {
             prepared_anonymous_count: AtomicU64::new(0),
             prepared_anonymous_evictions: AtomicU64::new(0),
             is_async_client: AtomicBool::new(false),
+            current_query: Mutex::new(CurrentQuery::default()),
+            server_process_id: AtomicI32::new(0),
+            trace: AtomicU8::new(CLIENT_TRACE_OFF),
+            evicting: AtomicBool::new(false),
+            eviction: tokio::sync::Notify::new(),
             reporter: get_reporter(),
             use_tls: false,
+            tag: String::new(),
         }
     }
 }
@@ -286,6 +394,12 @@ impl ClientStats {
         }
     }
 
+    /// Sets the client tag reported by SHOW CLIENTS.
+    pub fn with_tag(mut self, tag: &str) -> Self {
+        self.tag = tag.to_string();
+        self
+    }
+
     //
     // Client lifecycle management
     // ------------------------------------------------------------------------------------------
@@ -441,6 +555,12 @@ impl ClientStats {
         self.use_tls
     }
 
+    /// Returns the client tag, empty for untagged clients.
+    #[inline(always)]
+    pub fn tag(&self) -> &str {
+        &self.tag
+    }
+
     /// Returns the PostgreSQL username used for the connection.
     #[inline(always)]
     pub fn username(&self) -> &str {
@@ -533,6 +653,106 @@ impl ClientStats {
         self.is_async_client.load(Ordering::Relaxed)
     }
 
+    //
+    // Protocol trace for TRACE CLIENT
+    // ------------------------------------------------------------------------------------------
+
+    /// Sets the protocol trace level, one of `CLIENT_TRACE_*`.
+    #[inline(always)]
+    pub fn set_trace(&self, level: u8) {
+        self.trace.store(level, Ordering::Relaxed);
+    }
+
+    /// Returns the protocol trace level, one of `CLIENT_TRACE_*`.
+    #[inline(always)]
+    pub fn trace(&self) -> u8 {
+        self.trace.load(Ordering::Relaxed)
+    }
+
+    //
+    // Eviction above max_connections_soft
+    // ------------------------------------------------------------------------------------------
+
+    /// Asks the client to disconnect once it is idle outside a
+    /// transaction. Returns false when it was already asked.
+    pub fn evict(&self) -> bool {
+        if self.evicting.swap(true, Ordering::Relaxed) {
+            return false;
+        }
+        self.eviction.notify_one();
+        true
+    }
+
+    /// Whether the client has been asked to disconnect.
+    #[inline(always)]
+    pub fn evicting(&self) -> bool {
+        self.evicting.load(Ordering::Relaxed)
+    }
+
+    /// Completes once `evict` has been called.
+    pub async fn evicted(&self) {
+        self.eviction.notified().await
+    }
+
+    /// Returns the milliseconds this client has been waiting for its next
+    /// request with no server assigned, or `None` when it is doing
+    /// anything else.
+    #[inline]
+    pub fn idle_ms(&self) -> Option<u64> {
+        if self.state() != CLIENT_STATE_IDLE || self.wait() != CLIENT_WAIT_READ {
+            return None;
+        }
+        let since = self.state_since_nanos.load(Ordering::Relaxed);
+        Some(self.nanos_from_connect().saturating_sub(since) / 1_000_000)
+    }
+
+    //
+    // Current statement for SHOW ACTIVE_QUERIES
+    // ------------------------------------------------------------------------------------------
+
+    /// Records the backend assigned to this client at checkout.
+    #[inline(always)]
+    pub fn server_assigned(&self, process_id: i32) {
+        self.server_process_id.store(process_id, Ordering::Relaxed);
+    }
+
+    /// Records a statement the client has just sent. Only the handle is
+    /// swapped under the lock; the previous one is dropped after it is
+    /// released.
+    #[inline]
+    pub fn query_started(&self, text: impl Into<QueryText>) {
+        let now = self.nanos_from_connect().max(1);
+        let previous = {
+            let mut current = self.current_query.lock();
+            current.started_nanos = now;
+            std::mem::replace(&mut current.text, text.into())
+        };
+        drop(previous);
+    }
+
+    /// Returns the statement this client is running on a backend, or
+    /// `None` when it is idle, waiting for a server, or idle in a
+    /// transaction. A statement recorded before the client last became
+    /// active belongs to an earlier transaction and is not reported.
+    pub fn active_query(&self) -> Option<ActiveQuery> {
+        if self.state() != CLIENT_STATE_ACTIVE || self.wait() == CLIENT_WAIT_READ {
+            return None;
+        }
+        let since = self.state_since_nanos.load(Ordering::Relaxed);
+        let (text, started_nanos) = {
+            let current = self.current_query.lock();
+            (current.text.clone(), current.started_nanos)
+        };
+        if started_nanos == 0 || started_nanos < since {
+            return None;
+        }
+        Some(ActiveQuery {
+            server_process_id: self.server_process_id.load(Ordering::Relaxed),
+            elapsed_ms: self.nanos_from_connect().saturating_sub(started_nanos) / 1_000_000,
+            text: text.render(),
+        })
+    }
+
     /// Returns the milliseconds elapsed since this client entered the ACTIVE
     /// state. Returns `None` when the client is not currently active or the
     /// timestamp has never been set.
@@ -867,4 +1087,46 @@ mod tests {
         assert_eq!(stats.current_query_age_ms(), None);
         assert_eq!(stats.wait_ms(), None);
     }
+
+    #[test]
+    fn active_query_reported_only_while_running() {
+        let stats = ClientStats::default();
+        stats.server_assigned(4242);
+        stats.active_idle();
+        assert!(stats.active_query().is_none(), "no statement recorded yet");
+
+        stats.query_started("SELECT 1");
+        let active = stats.active_query().expect("statement in flight");
+        assert_eq!(active.server_process_id, 4242);
+        assert_eq!(active.text, "SELECT 1");
+
+        // Idle in transaction: waiting for the client's next message.
+        stats.active_read();
+        assert!(stats.active_query().is_none());
+
+        stats.idle_read();
+        assert!(stats.active_query().is_none());
+    }
+
+    #[test]
+    fn active_query_ignores_statement_from_previous_transaction() {
+        let stats = ClientStats::default();
+        stats.active_idle();
+        stats.query_started(Bytes::from_static(b"SELECT 1"));
+        stats.idle_read();
+        std::thread::sleep(std::time::Duration::from_millis(1));
+
+        // Next checkout, before the new statement is recorded.
+        stats.active_idle();
+        assert!(stats.active_query().is_none());
+    }
+
+    #[test]
+    fn active_query_caps_rendered_text() {
+        let stats = ClientStats::default();
+        stats.active_idle();
+        stats.query_started(Arc::<str>::from("x".repeat(CURRENT_QUERY_MAX_BYTES * 2)));
+        let active = stats.active_query().unwrap();
+        assert_eq!(active.text.len(), CURRENT_QUERY_MAX_BYTES);
+    }
 }
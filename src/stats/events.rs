@@ -0,0 +1,95 @@
+//! Structured connection events.
+//!
+//! Client connects and disconnects and server connects and closes are
+//! counted by reason in `pg_doorman_connection_events_total` and, with
+//! `general.log_connection_events`, logged as one `key=value` line each
+//! under the `pg_doorman::events` target. Reasons are stable codes, so an
+//! incident can be traced by filtering on them rather than on the wording
+//! of the regular log messages.
+
+use log::info;
+use std::fmt;
+
+use crate::config::get_config;
+use crate::errors::Error;
+
+pub const CLIENT_CONNECT: &str = "client_connect";
+pub const CLIENT_DISCONNECT: &str = "client_disconnect";
+pub const SERVER_CONNECT: &str = "server_connect";
+pub const SERVER_CLOSE: &str = "server_close";
+
+/// Count an event and log it when `log_connection_events` is on. `fields`
+/// are further `key=value` pairs identifying the connection.
+pub fn emit(event: &'static str, reason: &'static str, fields: fmt::Arguments<'_>) {
+    crate::web::metrics::record_connection_event(event, reason);
+    if get_config().general.log_connection_events {
+        info!(target: "pg_doorman::events", "event={event} reason={reason} {fields}");
+    }
+}
+
+/// Disconnect reason of an authenticated client whose session ended with
+/// `err`.
+pub fn client_error_reason(err: &Error) -> &'static str {
+    match err {
+        Error::QueryWaitTimeout => "query_wait_timeout",
+        Error::ClientWriteTimeout => "client_write_timeout",
+        Error::ClientProtocolViolation { .. } | Error::ProtocolSyncError(_) => "protocol_violation",
+        Error::MaxMessageSize => "max_message_size",
+        Error::CurrentMemoryUsage => "max_memory_usage",
+        Error::ShuttingDown => "shutdown",
+        Error::AllServersDown
+        | Error::ConnectError(_)
+        | Error::ConnectResourceExhausted(_)
+        | Error::CircuitBreakerOpen(_)
+        | Error::ServerStartupError(..)
+        | Error::ServerAuthError(..)
+        | Error::ServerUnavailableError(..)
+        | Error::ServerStartupParameterRejection { .. } => "server_unavailable",
+        Error::SocketError(_) => "socket_error",
+        Error::ClientError(_) => "client_error",
+        _ => "error",
+    }
+}
+
+/// Reason of a connection that failed to log in with `err`, or None when
+/// `err` can also end an authenticated session, which reports itself.
+pub fn login_failure_reason(err: &Error) -> Option<&'static str> {
+    match err {
+        Error::ClientBadStartup => Some("bad_startup"),
+        Error::ClientLoginTimeout => Some("login_timeout"),
+        Error::AuthError(_)
+        | Error::ScramClientError(_)
+        | Error::ScramServerError(_)
+        | Error::JWTValidate(_) => Some("auth_failure"),
+        Error::HbaForbiddenError(_) => Some("hba_reject"),
+        Error::ProxyProtocolError(_) => Some("proxy_protocol"),
+        Error::TlsError => Some("tls_error"),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn login_errors_are_not_session_errors() {
+        assert_eq!(
+            login_failure_reason(&Error::ClientLoginTimeout),
+            Some("login_timeout")
+        );
+        assert_eq!(
+            login_failure_reason(&Error::AuthError("bad password".into())),
+            Some("auth_failure")
+        );
+        assert_eq!(login_failure_reason(&Error::QueryWaitTimeout), None);
+        assert_eq!(
+            client_error_reason(&Error::QueryWaitTimeout),
+            "query_wait_timeout"
+        );
+        assert_eq!(
+            client_error_reason(&Error::AllServersDown),
+            "server_unavailable"
+        );
+    }
+}
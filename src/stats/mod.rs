@@ -29,6 +29,8 @@ pub mod auth_query;
 pub mod client;
 /// Connection counters (internal)
 mod connections;
+/// Structured connection events
+pub mod events;
 /// Statistics for connection pools
 pub mod pool;
 /// Utilities for printing statistics (internal)
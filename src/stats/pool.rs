@@ -14,7 +14,11 @@
 /// and SHOW STATS to provide insights into the pooler's operation and performance.
 use log::{debug, error};
 
-use crate::{config::PoolMode, messages::DataType, pool::PoolIdentifier};
+use crate::{
+    config::{LoadBalanceHosts, PoolMode},
+    messages::DataType,
+    pool::PoolIdentifier,
+};
 use std::borrow::Cow;
 use std::collections::HashMap;
 use std::sync::atomic::*;
@@ -203,6 +207,10 @@ pub struct PoolStats {
 
     /// Configured maximum pool size (from user config or default)
     pub pool_size: u32,
+
+    /// How new connections pick a host of `server_host`; `disable` for a
+    /// single-host pool.
+    pub load_balance_hosts: LoadBalanceHosts,
 }
 
 #[derive(Debug, Clone)]
@@ -298,6 +306,7 @@ impl PoolStats {
             fallback_active: false,
             source_generation: 0,
             pool_size: 0,
+            load_balance_hosts: LoadBalanceHosts::Disable,
         }
     }
 
@@ -351,22 +360,31 @@ impl PoolStats {
         Self::aggregate_pool_stats(virtual_map)
     }
 
+    /// SHOW POOLS columns: pgbouncer's, in pgbouncer's order, then the
+    /// pg_doorman extensions. Exporters written for pgbouncer read the
+    /// first part unchanged.
     pub fn generate_show_pools_header() -> Vec<(&'static str, DataType)> {
         vec![
             ("database", DataType::Text),
             ("user", DataType::Text),
-            ("pool_mode", DataType::Text),
-            ("cl_idle", DataType::Numeric),
             ("cl_active", DataType::Numeric),
             ("cl_waiting", DataType::Numeric),
-            ("cl_cancel_req", DataType::Numeric),
+            ("cl_active_cancel_req", DataType::Numeric),
+            ("cl_waiting_cancel_req", DataType::Numeric),
             ("sv_active", DataType::Numeric),
+            ("sv_active_cancel", DataType::Numeric),
+            ("sv_being_canceled", DataType::Numeric),
             ("sv_idle", DataType::Numeric),
             ("sv_used", DataType::Numeric),
+            ("sv_tested", DataType::Numeric),
             ("sv_login", DataType::Numeric),
-            ("pool_size", DataType::Numeric),
             ("maxwait", DataType::Numeric),
             ("maxwait_us", DataType::Numeric),
+            ("pool_mode", DataType::Text),
+            ("load_balance_hosts", DataType::Text),
+            // pg_doorman extensions.
+            ("cl_idle", DataType::Numeric),
+            ("pool_size", DataType::Numeric),
             ("avg_xact_time", DataType::Numeric),
             ("paused", DataType::Text),
             ("fallback_active", DataType::Text),
@@ -429,18 +447,26 @@ impl PoolStats {
         vec![
             Cow::Borrowed(&self.identifier.db),
             Cow::Borrowed(&self.identifier.user),
-            Cow::Owned(self.mode.to_string()),
-            Cow::Owned(self.cl_idle.to_string()),
             Cow::Owned(self.cl_active.to_string()),
             Cow::Owned(self.cl_waiting.to_string()),
             Cow::Owned(self.cl_cancel_req.to_string()),
+            // Cancel requests are forwarded at once, never queued.
+            Cow::Borrowed("0"),
             Cow::Owned(self.sv_active.to_string()),
+            // Servers are not tied up by cancel requests or tested
+            // before reuse the way pgbouncer's are.
+            Cow::Borrowed("0"),
+            Cow::Borrowed("0"),
             Cow::Owned(self.sv_idle.to_string()),
             Cow::Owned(self.sv_used.to_string()),
+            Cow::Borrowed("0"),
             Cow::Owned(self.sv_login.to_string()),
-            Cow::Owned(self.pool_size.to_string()),
             Cow::Owned((self.maxwait / 1_000_000).to_string()),
             Cow::Owned((self.maxwait % 1_000_000).to_string()),
+            Cow::Owned(self.mode.to_string()),
+            Cow::Owned(self.load_balance_hosts.to_string()),
+            Cow::Owned(self.cl_idle.to_string()),
+            Cow::Owned(self.pool_size.to_string()),
             Cow::Owned(self.avg_xact_time_microsecons.to_string()),
             Cow::Borrowed(if self.paused { "1" } else { "0" }),
             Cow::Borrowed(if self.fallback_active { "1" } else { "0" }),
@@ -566,8 +592,13 @@ impl PoolStats {
                 },
             );
 
-            // Pool size from config
-            current.pool_size = pool.settings.user.pool_size;
+            // Current pool size: `pool_size` from config, or what adaptive
+            // sizing settled on for users with `max_pool_size`.
+            current.pool_size = pool.database.status().max_size as u32;
+            current.load_balance_hosts = pool
+                .database
+                .host_list()
+                .map_or(LoadBalanceHosts::Disable, |hosts| hosts.policy());
 
             // Carry the underlying source identity so Prometheus
             // delta tracking can detect a `Pool::from_config` reload
@@ -853,6 +884,39 @@ mod tests {
         assert_eq!(header.len(), row.len(), "header/row width mismatch");
     }
 
+    /// pgbouncer exporters address SHOW POOLS columns by name and some by
+    /// position: the pgbouncer columns must stay first, in pgbouncer's
+    /// order.
+    #[test]
+    fn show_pools_starts_with_pgbouncer_columns() {
+        let names: Vec<&str> = PoolStats::generate_show_pools_header()
+            .into_iter()
+            .map(|(name, _)| name)
+            .collect();
+        assert_eq!(
+            names[..17],
+            [
+                "database",
+                "user",
+                "cl_active",
+                "cl_waiting",
+                "cl_active_cancel_req",
+                "cl_waiting_cancel_req",
+                "sv_active",
+                "sv_active_cancel",
+                "sv_being_canceled",
+                "sv_idle",
+                "sv_used",
+                "sv_tested",
+                "sv_login",
+                "maxwait",
+                "maxwait_us",
+                "pool_mode",
+                "load_balance_hosts",
+            ]
+        );
+    }
+
     /// Both entry points must agree on shape when fed the same global
     /// POOLS state and equivalent client/server maps. Validates that
     /// `construct_pool_lookup_from` is a structural extract of
@@ -1,11 +1,12 @@
 use super::AddressStats;
 use super::{get_reporter, Reporter};
 use crate::config::Address;
+use crate::pool::multi_host::HostLoad;
 use crate::utils::clock;
 use iota::iota;
 use parking_lot::Mutex;
 use std::sync::atomic::*;
-use std::sync::Arc;
+use std::sync::{Arc, OnceLock};
 
 // Server state constants used to track the current activity state of a server connection.
 //
@@ -91,6 +92,9 @@ pub struct ServerStats {
     /// Nanoseconds elapsed from `connect_time` at the moment this server
     /// last entered ACTIVE. `NEVER_ACTIVE` means not activated yet.
     active_since_nanos_from_connect: AtomicU64,
+
+    /// Load of the backend host, for pools balancing a `server_host` list.
+    host_load: OnceLock<Arc<HostLoad>>,
 }
 
 /// Sentinel for `active_since_nanos_from_connect` meaning "not activated yet".
@@ -129,6 +133,7 @@ impl Default for ServerStats {
             prepared_cache_size: AtomicU64::new(0),
             use_tls: AtomicBool::new(false),
             active_since_nanos_from_connect: AtomicU64::new(NEVER_ACTIVE),
+            host_load: OnceLock::new(),
         }
     }
 }
@@ -236,6 +241,18 @@ impl ServerStats {
     #[inline(always)]
     pub fn disconnect(&self) {
         self.reporter.server_disconnecting(self.server_id);
+        if let Some(load) = self.host_load.get() {
+            load.closed();
+        }
+    }
+
+    /// Count this connection and its query times towards the load of the
+    /// backend host it was opened on.
+    pub fn track_host_load(&self, load: Arc<HostLoad>) {
+        load.opened();
+        if let Err(load) = self.host_load.set(load) {
+            load.closed();
+        }
     }
 
     //
@@ -458,6 +475,9 @@ impl ServerStats {
         self.address.stats.query_count_add();
         self.address.stats.query_time_add_microseconds(microseconds);
         self.query_count.fetch_add(1, Ordering::Relaxed);
+        if let Some(load) = self.host_load.get() {
+            load.observe(microseconds);
+        }
         crate::web::metrics::observe_pool_query_microseconds(
             &self.address.username,
             &self.address.pool_name,
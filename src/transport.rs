@@ -4,6 +4,9 @@
 //! client startup, and log formatting.
 
 use std::net::SocketAddr;
+use std::sync::Arc;
+
+use crate::config::Listener;
 
 /// How a client reached the pooler.
 #[derive(Debug, Clone)]
@@ -15,6 +18,9 @@ pub enum ClientTransport {
         /// its startup packet. Drives hostssl rule matching and the
         /// `ClientStats::is_tls` counter.
         ssl: bool,
+        /// `[[listeners]]` entry the client came through; `None` for the
+        /// primary `general.host:port` listener.
+        listener: Option<Arc<Listener>>,
     },
     /// Unix domain socket. Peer address is not meaningful for these
     /// connections — the kernel does not expose a remote endpoint and
@@ -44,6 +50,26 @@ impl ClientTransport {
         }
     }
 
+    /// Listener the client came through, as a metric label: `tcp` (TLS
+    /// included) or `unix`.
+    pub fn listener(&self) -> &'static str {
+        match self {
+            ClientTransport::Tcp { .. } => "tcp",
+            ClientTransport::Unix => "unix",
+        }
+    }
+
+    /// Whether the listener the client came through serves `database`.
+    pub fn serves(&self, database: &str) -> bool {
+        match self {
+            ClientTransport::Tcp {
+                listener: Some(listener),
+                ..
+            } => listener.serves(database),
+            _ => true,
+        }
+    }
+
     /// IP that the HBA matcher should use when checking `host`/`hostssl`
     /// rules. Unix transport has no meaningful IP, so we return a sentinel
     /// loopback value — the matcher ignores the IP for Unix clients
@@ -64,9 +90,24 @@ mod tests {
     #[test]
     fn tcp_is_tls_reflects_ssl_flag() {
         let peer = SocketAddr::from((Ipv4Addr::new(10, 0, 0, 1), 5432));
-        assert!(!ClientTransport::Tcp { peer, ssl: false }.is_tls());
-        assert!(ClientTransport::Tcp { peer, ssl: true }.is_tls());
-        assert!(!ClientTransport::Tcp { peer, ssl: true }.is_unix());
+        assert!(!ClientTransport::Tcp {
+            peer,
+            ssl: false,
+            listener: None
+        }
+        .is_tls());
+        assert!(ClientTransport::Tcp {
+            peer,
+            ssl: true,
+            listener: None
+        }
+        .is_tls());
+        assert!(!ClientTransport::Tcp {
+            peer,
+            ssl: true,
+            listener: None
+        }
+        .is_unix());
     }
 
     #[test]
@@ -79,12 +120,59 @@ mod tests {
     fn peer_display_distinguishes_transports() {
         let peer = SocketAddr::from((Ipv4Addr::new(127, 0, 0, 1), 54321));
         assert_eq!(
-            ClientTransport::Tcp { peer, ssl: false }.peer_display(),
+            ClientTransport::Tcp {
+                peer,
+                ssl: false,
+                listener: None
+            }
+            .peer_display(),
             "127.0.0.1:54321"
         );
         assert_eq!(ClientTransport::Unix.peer_display(), "unix:");
     }
 
+    #[test]
+    fn listener_label_ignores_tls() {
+        let peer = SocketAddr::from((Ipv4Addr::new(127, 0, 0, 1), 54321));
+        assert_eq!(
+            ClientTransport::Tcp {
+                peer,
+                ssl: true,
+                listener: None
+            }
+            .listener(),
+            "tcp"
+        );
+        assert_eq!(ClientTransport::Unix.listener(), "unix");
+    }
+
+    #[test]
+    fn serves_follows_listener_databases() {
+        let peer = SocketAddr::from((Ipv4Addr::new(10, 0, 0, 1), 5432));
+        let listener = Listener {
+            name: None,
+            host: "127.0.0.1".to_string(),
+            port: 6433,
+            tls_mode: None,
+            databases: vec!["app".to_string()],
+            proxy_protocol: false,
+        };
+        let extra = ClientTransport::Tcp {
+            peer,
+            ssl: false,
+            listener: Some(Arc::new(listener)),
+        };
+        assert!(extra.serves("app"));
+        assert!(!extra.serves("other"));
+        let primary = ClientTransport::Tcp {
+            peer,
+            ssl: false,
+            listener: None,
+        };
+        assert!(primary.serves("other"));
+        assert!(ClientTransport::Unix.serves("other"));
+    }
+
     #[test]
     fn hba_ip_for_unix_is_loopback_sentinel() {
         // The HBA matcher drops the IP entirely for Unix clients, so the
@@ -63,6 +63,109 @@ pub fn preview_query(query: &str) -> String {
     truncate_chars(query, PREVIEW_QUERY_MAX_CHARS)
 }
 
+/// Render a query for `SHOW ACTIVE_QUERIES`: string, dollar-quoted and
+/// numeric literals become `?`, comments are dropped, whitespace runs
+/// collapse to one space, and the result is capped at
+/// `PREVIEW_QUERY_MAX_CHARS`. Literals often carry user data, so a
+/// literal cut off by an earlier byte cap is still masked to the end.
+/// `$1`-style parameters and quoted identifiers are kept.
+pub fn normalize_query(query: &str) -> String {
+    let bytes = query.as_bytes();
+    let mut out = String::with_capacity(query.len().min(PREVIEW_QUERY_MAX_CHARS * 2));
+    let mut i = 0;
+    while i < bytes.len() {
+        let c = bytes[i];
+        let prev_is_ident = out
+            .as_bytes()
+            .last()
+            .is_some_and(|b| b.is_ascii_alphanumeric() || *b == b'_' || *b == b'$');
+        match c {
+            b'\'' => {
+                // E'...' and friends: drop the prefix together with the literal.
+                if out.ends_with(['E', 'e', 'B', 'b', 'X', 'x']) {
+                    let before = out.as_bytes().get(out.len().wrapping_sub(2));
+                    if !before.is_some_and(|b| b.is_ascii_alphanumeric() || *b == b'_') {
+                        out.pop();
+                    }
+                }
+                i += 1;
+                while i < bytes.len() {
+                    if bytes[i] == b'\'' {
+                        if bytes.get(i + 1) == Some(&b'\'') {
+                            i += 2;
+                            continue;
+                        }
+                        i += 1;
+                        break;
+                    }
+                    i += 1;
+                }
+                out.push('?');
+            }
+            b'"' => {
+                let end = query[i + 1..]
+                    .find('"')
+                    .map_or(bytes.len(), |p| i + 1 + p + 1);
+                out.push_str(&query[i..end]);
+                i = end;
+            }
+            b'$' if !prev_is_ident => {
+                // $1 is a parameter; $tag$...$tag$ is a literal.
+                let tag_len = query[i + 1..]
+                    .find(|ch: char| !(ch.is_ascii_alphanumeric() || ch == '_'))
+                    .unwrap_or(bytes.len() - i - 1);
+                let tag_end = i + 1 + tag_len;
+                let is_param = tag_len > 0 && bytes[i + 1..tag_end].iter().all(u8::is_ascii_digit);
+                if !is_param && bytes.get(tag_end) == Some(&b'$') {
+                    let tag = &query[i..=tag_end];
+                    i = query[tag_end + 1..]
+                        .find(tag)
+                        .map_or(bytes.len(), |p| tag_end + 1 + p + tag.len());
+                    out.push('?');
+                } else {
+                    out.push_str(&query[i..tag_end]);
+                    i = tag_end;
+                }
+            }
+            b'0'..=b'9' if !prev_is_ident => {
+                while i < bytes.len() && (bytes[i].is_ascii_alphanumeric() || bytes[i] == b'.') {
+                    i += 1;
+                }
+                out.push('?');
+            }
+            b'-' if bytes.get(i + 1) == Some(&b'-') => {
+                i = query[i..].find('\n').map_or(bytes.len(), |p| i + p);
+                push_space(&mut out);
+            }
+            b'/' if bytes.get(i + 1) == Some(&b'*') => {
+                i = query[i + 2..]
+                    .find("*/")
+                    .map_or(bytes.len(), |p| i + 2 + p + 2);
+                push_space(&mut out);
+            }
+            _ if c.is_ascii_whitespace() => {
+                push_space(&mut out);
+                i += 1;
+            }
+            _ => {
+                let len = query[i..].chars().next().map_or(1, char::len_utf8);
+                out.push_str(&query[i..i + len]);
+                i += len;
+            }
+        }
+        if out.len() > PREVIEW_QUERY_MAX_CHARS * 4 {
+            break;
+        }
+    }
+    truncate_chars(out.trim(), PREVIEW_QUERY_MAX_CHARS)
+}
+
+fn push_space(out: &mut String) {
+    if !out.is_empty() && !out.ends_with(' ') {
+        out.push(' ');
+    }
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -176,4 +279,46 @@ mod tests {
         let out = preview_query(&q);
         assert_eq!(out.chars().count(), PREVIEW_QUERY_MAX_CHARS);
     }
+
+    #[test]
+    fn normalize_query_masks_literals() {
+        assert_eq!(
+            normalize_query("SELECT * FROM t WHERE a = 'x''y' AND b = 42 AND c = 1.5e3"),
+            "SELECT * FROM t WHERE a = ? AND b = ? AND c = ?"
+        );
+        assert_eq!(
+            normalize_query("select E'sec\\ret', $q$body$q$, $$x$$"),
+            "select ?, ?, ?"
+        );
+    }
+
+    #[test]
+    fn normalize_query_keeps_parameters_and_identifiers() {
+        assert_eq!(
+            normalize_query("SELECT \"col 1\", t2.x1 FROM t2 WHERE id = $1 AND v = $12"),
+            "SELECT \"col 1\", t2.x1 FROM t2 WHERE id = $1 AND v = $12"
+        );
+    }
+
+    #[test]
+    fn normalize_query_drops_comments_and_collapses_whitespace() {
+        assert_eq!(
+            normalize_query("  SELECT /* app=x */ 1\n  -- trailing\nFROM\t\tt  "),
+            "SELECT ? FROM t"
+        );
+    }
+
+    #[test]
+    fn normalize_query_masks_unterminated_literal() {
+        assert_eq!(
+            normalize_query("UPDATE u SET password = 'hunter"),
+            "UPDATE u SET password = ?"
+        );
+    }
+
+    #[test]
+    fn normalize_query_caps_at_preview_max() {
+        let q = format!("SELECT {}", "a, ".repeat(PREVIEW_QUERY_MAX_CHARS));
+        assert_eq!(normalize_query(&q).chars().count(), PREVIEW_QUERY_MAX_CHARS);
+    }
 }
@@ -0,0 +1,133 @@
+use serde_derive::{Deserialize, Serialize};
+
+use crate::config::Vault;
+use crate::utils::strings::truncate_bytes;
+
+/// Secret read from `GET /v1/<path>`. Dynamic database roles return a
+/// lease; static roles return no lease and the time left until Vault
+/// rotates the password in `data.ttl`.
+#[derive(Debug, Deserialize)]
+pub struct Secret {
+    #[serde(default)]
+    pub lease_id: String,
+    #[serde(default)]
+    pub lease_duration: u64,
+    #[serde(default)]
+    pub renewable: bool,
+    pub data: SecretData,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct SecretData {
+    pub username: String,
+    pub password: String,
+    #[serde(default)]
+    pub ttl: Option<u64>,
+}
+
+/// Response of `PUT /v1/sys/leases/renew`.
+#[derive(Debug, Deserialize)]
+pub struct RenewedLease {
+    pub lease_duration: u64,
+    #[serde(default)]
+    pub renewable: bool,
+}
+
+#[derive(Serialize)]
+struct RenewRequest<'a> {
+    lease_id: &'a str,
+    increment: u64,
+}
+
+/// HTTP client for the Vault API.
+pub struct VaultClient {
+    http: reqwest::Client,
+    addr: String,
+    token_file: Option<String>,
+}
+
+impl VaultClient {
+    pub fn new(config: &Vault) -> Result<Self, String> {
+        let mut builder = reqwest::Client::builder()
+            .timeout(config.request_timeout.as_std())
+            .connect_timeout(config.request_timeout.as_std());
+        if let Some(ca_file) = &config.ca_file {
+            let pem = std::fs::read(ca_file).map_err(|e| format!("reading {ca_file}: {e}"))?;
+            for cert in reqwest::Certificate::from_pem_bundle(&pem)
+                .map_err(|e| format!("parsing {ca_file}: {e}"))?
+            {
+                builder = builder.add_root_certificate(cert);
+            }
+        }
+        let http = builder.build().map_err(|e| format!("{e}"))?;
+        Ok(Self {
+            http,
+            addr: config.addr.trim_end_matches('/').to_string(),
+            token_file: config.token_file.clone(),
+        })
+    }
+
+    pub async fn read_secret(&self, path: &str) -> Result<Secret, String> {
+        let url = format!("{}/v1/{}", self.addr, path.trim_start_matches('/'));
+        let request = self.http.get(&url).header("X-Vault-Token", self.token()?);
+        send_json(request).await
+    }
+
+    pub async fn renew_lease(
+        &self,
+        lease_id: &str,
+        increment: u64,
+    ) -> Result<RenewedLease, String> {
+        let url = format!("{}/v1/sys/leases/renew", self.addr);
+        let request = self
+            .http
+            .put(&url)
+            .header("X-Vault-Token", self.token()?)
+            .json(&RenewRequest {
+                lease_id,
+                increment,
+            });
+        send_json(request).await
+    }
+
+    fn token(&self) -> Result<String, String> {
+        let token = match &self.token_file {
+            Some(file) => {
+                std::fs::read_to_string(file).map_err(|e| format!("reading {file}: {e}"))?
+            }
+            None => {
+                std::env::var("VAULT_TOKEN").map_err(|_| "VAULT_TOKEN is not set".to_string())?
+            }
+        };
+        let token = token.trim();
+        if token.is_empty() {
+            return Err("vault token is empty".into());
+        }
+        Ok(token.to_string())
+    }
+}
+
+async fn send_json<T: serde::de::DeserializeOwned>(
+    request: reqwest::RequestBuilder,
+) -> Result<T, String> {
+    let resp = request.send().await.map_err(|e| format!("{e}"))?;
+    let status = resp.status();
+    let body = resp
+        .text()
+        .await
+        .map_err(|e| format!("reading body: {e}"))?;
+    if !status.is_success() {
+        // Vault error bodies are `{"errors": [...]}` and never carry secrets.
+        return Err(format!("HTTP {status}: {}", truncate_bytes(&body, 512)));
+    }
+    // A successful body holds the password: report where parsing failed,
+    // never the serde message, which may quote the offending value.
+    serde_json::from_str(&body).map_err(|e| {
+        format!(
+            "unexpected response: {:?} error at line {} column {}",
+            e.classify(),
+            e.line(),
+            e.column()
+        )
+    })
+}
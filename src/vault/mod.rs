@@ -0,0 +1,299 @@
+//! Backend credentials from HashiCorp Vault.
+//!
+//! Users with `server_vault_path` log in to PostgreSQL with the username
+//! and password read from that Vault path instead of `server_username` /
+//! `server_password`. A background task keeps them current:
+//!
+//! - dynamic database roles (`<mount>/creds/<role>`) come with a lease that
+//!   is renewed at two thirds of its duration; once Vault stops extending
+//!   it (`max_ttl`), a fresh username/password pair is read instead;
+//! - static roles (`<mount>/static-creds/<role>`) are re-read right after
+//!   the `ttl` Vault reports, i.e. after it rotated the password.
+//!
+//! Whenever the credentials change, idle server connections of the pool are
+//! closed and busy ones are replaced on checkin (`ConnectionPool::reconnect`),
+//! so backends never outlive the credentials they logged in with by more
+//! than one transaction.
+
+pub mod client;
+
+use std::collections::HashMap;
+use std::time::Duration;
+
+use log::{error, info, warn};
+use once_cell::sync::Lazy;
+use parking_lot::RwLock;
+use tokio::time::Instant;
+
+use crate::config::{get_config, User};
+
+use self::client::{Secret, VaultClient};
+
+/// Delay before retrying a failed Vault request.
+const RETRY_INTERVAL: Duration = Duration::from_secs(5);
+/// Re-read interval for secrets that report neither a lease nor a ttl.
+const REREAD_INTERVAL: Duration = Duration::from_secs(300);
+/// How often the refresh task looks for due leases and new users.
+const TICK_INTERVAL: Duration = Duration::from_secs(1);
+
+/// Backend login read from Vault.
+#[derive(Clone, PartialEq, Eq)]
+pub struct Credentials {
+    pub username: String,
+    pub password: String,
+}
+
+/// Current credentials per `(pool, user)`, read on every backend login.
+static CREDENTIALS: Lazy<RwLock<HashMap<(String, String), Credentials>>> =
+    Lazy::new(|| RwLock::new(HashMap::new()));
+
+/// `user` with `server_username` / `server_password` taken from Vault, or
+/// `None` while no credentials have been read for it yet.
+pub fn backend_user(pool_name: &str, user: &User) -> Option<User> {
+    let credentials = CREDENTIALS
+        .read()
+        .get(&(pool_name.to_string(), user.username.clone()))
+        .cloned()?;
+    Some(User {
+        server_username: Some(credentials.username),
+        server_password: Some(credentials.password),
+        ..user.clone()
+    })
+}
+
+/// Refresh state of one `(pool, user)`.
+struct Entry {
+    path: String,
+    lease: Option<Lease>,
+    refresh_at: Instant,
+}
+
+struct Lease {
+    credentials: Credentials,
+    /// Empty for static roles.
+    lease_id: String,
+    renewable: bool,
+    /// Duration of the lease as first issued; the increment asked for on
+    /// renewal.
+    issued_duration: u64,
+}
+
+/// Read credentials for every configured user, then keep them fresh in the
+/// background. The first round runs before this returns, so pools created
+/// right after startup can already log in. No-op without `server_vault_path`
+/// users; users added by a reload are picked up on the next tick.
+pub async fn start() {
+    let mut entries: HashMap<(String, String), Entry> = HashMap::new();
+    let mut client = None;
+    refresh_due(&mut client, &mut entries).await;
+    tokio::spawn(async move {
+        loop {
+            tokio::time::sleep(TICK_INTERVAL).await;
+            refresh_due(&mut client, &mut entries).await;
+        }
+    });
+}
+
+async fn refresh_due(
+    client: &mut Option<(crate::config::Vault, VaultClient)>,
+    entries: &mut HashMap<(String, String), Entry>,
+) {
+    let config = get_config();
+
+    let mut wanted: HashMap<(String, String), String> = HashMap::new();
+    for (pool_name, pool) in &config.pools {
+        for user in &pool.users {
+            if let Some(path) = &user.server_vault_path {
+                wanted.insert((pool_name.clone(), user.username.clone()), path.clone());
+            }
+        }
+    }
+    entries.retain(|key, _| wanted.contains_key(key));
+    CREDENTIALS
+        .write()
+        .retain(|key, _| wanted.contains_key(key));
+    if wanted.is_empty() {
+        return;
+    }
+
+    // Rebuild the HTTP client when the vault section changes on reload.
+    if client.as_ref().map(|(vault, _)| vault) != Some(&config.vault) {
+        match VaultClient::new(&config.vault) {
+            Ok(new_client) => *client = Some((config.vault.clone(), new_client)),
+            Err(err) => {
+                error!("vault: can't create client: {err}");
+                *client = None;
+                return;
+            }
+        }
+    }
+    let Some((_, vault)) = client.as_ref() else {
+        return;
+    };
+
+    let now = Instant::now();
+    for (key, path) in wanted {
+        let entry = entries.entry(key.clone()).or_insert_with(|| Entry {
+            path: path.clone(),
+            lease: None,
+            refresh_at: now,
+        });
+        if entry.path != path {
+            entry.path = path;
+            entry.refresh_at = now;
+        }
+        if entry.refresh_at <= now {
+            refresh_entry(vault, &key, entry).await;
+        }
+    }
+}
+
+async fn refresh_entry(vault: &VaultClient, key: &(String, String), entry: &mut Entry) {
+    let (pool_name, username) = key;
+
+    if let Some(lease) = entry.lease.as_mut().filter(|l| l.renewable) {
+        match vault
+            .renew_lease(&lease.lease_id, lease.issued_duration)
+            .await
+        {
+            // Vault caps renewals at the role's max_ttl. Once fewer than a
+            // third of the original duration is granted, read new
+            // credentials now instead of renewing until the lease expires.
+            Ok(renewed) if renewed.lease_duration * 3 >= lease.issued_duration => {
+                crate::web::metrics::record_vault_request(pool_name, username, "renew", "ok");
+                lease.renewable = renewed.renewable;
+                entry.refresh_at = Instant::now() + two_thirds(renewed.lease_duration);
+                return;
+            }
+            Ok(_) => {
+                crate::web::metrics::record_vault_request(pool_name, username, "renew", "ok");
+                info!("[{username}@{pool_name}] vault: lease reaches max_ttl, reading new credentials");
+            }
+            Err(err) => {
+                crate::web::metrics::record_vault_request(pool_name, username, "renew", "error");
+                warn!("[{username}@{pool_name}] vault: renewing lease failed, reading new credentials: {err}");
+            }
+        }
+    }
+
+    let secret = match vault.read_secret(&entry.path).await {
+        Ok(secret) => secret,
+        Err(err) => {
+            crate::web::metrics::record_vault_request(pool_name, username, "read", "error");
+            error!(
+                "[{username}@{pool_name}] vault: reading {} failed: {err}",
+                entry.path
+            );
+            entry.refresh_at = Instant::now() + RETRY_INTERVAL;
+            return;
+        }
+    };
+    crate::web::metrics::record_vault_request(pool_name, username, "read", "ok");
+
+    entry.refresh_at = Instant::now() + refresh_delay(&secret);
+    let credentials = Credentials {
+        username: secret.data.username,
+        password: secret.data.password,
+    };
+    let previous = entry.lease.replace(Lease {
+        credentials: credentials.clone(),
+        lease_id: secret.lease_id,
+        renewable: secret.renewable,
+        issued_duration: secret.lease_duration,
+    });
+    CREDENTIALS.write().insert(key.clone(), credentials.clone());
+
+    match previous {
+        None => info!(
+            "[{username}@{pool_name}] vault: backend credentials loaded for {}",
+            credentials.username
+        ),
+        Some(previous) if previous.credentials != credentials => {
+            info!(
+                "[{username}@{pool_name}] vault: backend credentials rotated ({} -> {}), reconnecting",
+                previous.credentials.username, credentials.username
+            );
+            crate::admin::events::push_event(
+                "VAULT",
+                format!(
+                    "backend credentials of {username}@{pool_name} rotated, server connections replaced"
+                ),
+            );
+            if let Some(pool) = crate::pool::get_pool(pool_name, username) {
+                pool.database.reconnect();
+            }
+        }
+        Some(_) => {}
+    }
+}
+
+/// When to look at a freshly read secret again.
+fn refresh_delay(secret: &Secret) -> Duration {
+    if secret.lease_duration > 0 {
+        two_thirds(secret.lease_duration)
+    } else if let Some(ttl) = secret.data.ttl {
+        // Static role: Vault rotates the password when ttl reaches zero.
+        Duration::from_secs(ttl + 1)
+    } else {
+        REREAD_INTERVAL
+    }
+}
+
+fn two_thirds(secs: u64) -> Duration {
+    Duration::from_secs((secs * 2 / 3).max(1))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use client::SecretData;
+
+    fn secret(lease_duration: u64, ttl: Option<u64>) -> Secret {
+        Secret {
+            lease_id: String::new(),
+            lease_duration,
+            renewable: lease_duration > 0,
+            data: SecretData {
+                username: "v-app-1".into(),
+                password: "p".into(),
+                ttl,
+            },
+        }
+    }
+
+    #[test]
+    fn refresh_delay_follows_lease_or_ttl() {
+        assert_eq!(
+            refresh_delay(&secret(3600, None)),
+            Duration::from_secs(2400)
+        );
+        assert_eq!(refresh_delay(&secret(0, Some(59))), Duration::from_secs(60));
+        assert_eq!(refresh_delay(&secret(0, None)), REREAD_INTERVAL);
+        assert_eq!(refresh_delay(&secret(1, None)), Duration::from_secs(1));
+    }
+
+    #[test]
+    fn backend_user_overlays_credentials() {
+        let user = User {
+            username: "app".into(),
+            server_vault_path: Some("database/creds/app".into()),
+            ..Default::default()
+        };
+        assert!(backend_user("vault_test_pool", &user).is_none());
+
+        CREDENTIALS.write().insert(
+            ("vault_test_pool".into(), "app".into()),
+            Credentials {
+                username: "v-app-1".into(),
+                password: "secret".into(),
+            },
+        );
+        let resolved = backend_user("vault_test_pool", &user).unwrap();
+        assert_eq!(resolved.username, "app");
+        assert_eq!(resolved.server_username.as_deref(), Some("v-app-1"));
+        assert_eq!(resolved.server_password.as_deref(), Some("secret"));
+        CREDENTIALS
+            .write()
+            .remove(&("vault_test_pool".to_string(), "app".to_string()));
+    }
+}
@@ -0,0 +1,369 @@
+//! Grafana dashboard for the Prometheus exporter, printed by
+//! `pg_doorman dashboard --format grafana`.
+//!
+//! Panels name the metric statics, not metric name strings: metric and
+//! label names are read from the registered descriptors, so renaming a
+//! metric renames it in the dashboard, and dropping a label a panel
+//! groups by fails generation (and the unit test) instead of producing a
+//! dashboard with empty panels.
+
+use prometheus::core::{Collector, Desc};
+use serde_json::{json, Value};
+
+use super::{
+    AUTH_FAILURES_TOTAL, CLIENT_TLS_HANDSHAKES_TOTAL, COPY_ACTIVE, COPY_BYTES_TOTAL,
+    LISTENER_REJECTIONS_TOTAL, SHOW_CONNECTIONS_TOTAL, SHOW_POOLS_BYTES_TOTAL, SHOW_POOLS_CLIENT,
+    SHOW_POOLS_ERRORS_TOTAL, SHOW_POOLS_QUERIES_TOTAL, SHOW_POOLS_QUERY_DURATION_SECONDS,
+    SHOW_POOLS_SERVER, SHOW_POOLS_TRANSACTIONS_TOTAL, SHOW_POOLS_TRANSACTION_DURATION_SECONDS,
+    SHOW_POOLS_WAIT_DURATION_SECONDS, SHOW_POOL_SIZE, TOTAL_MEMORY,
+};
+
+/// Label every per-pool metric carries; panels on such metrics follow
+/// the dashboard's `$database` variable.
+const DATABASE_LABEL: &str = "database";
+
+/// How a panel turns its metric into a PromQL expression.
+enum Query {
+    /// Current value, summed.
+    Gauge,
+    /// Per-second rate of a counter, summed.
+    Rate,
+    /// Quantile over the buckets of a histogram.
+    Quantile(f64),
+}
+
+struct Panel {
+    title: &'static str,
+    unit: &'static str,
+    metric: &'static dyn Collector,
+    query: Query,
+    /// Labels kept by `sum by`, also used for the legend.
+    by: &'static [&'static str],
+    /// Fixed label matchers, e.g. `status="waiting"`.
+    filter: &'static [(&'static str, &'static str)],
+}
+
+fn panels() -> Vec<Panel> {
+    vec![
+        Panel {
+            title: "Client connections",
+            unit: "cps",
+            metric: &*SHOW_CONNECTIONS_TOTAL,
+            query: Query::Rate,
+            by: &["type"],
+            filter: &[],
+        },
+        Panel {
+            title: "Clients by status",
+            unit: "short",
+            metric: &*SHOW_POOLS_CLIENT,
+            query: Query::Gauge,
+            by: &["status"],
+            filter: &[],
+        },
+        Panel {
+            title: "Servers by status",
+            unit: "short",
+            metric: &*SHOW_POOLS_SERVER,
+            query: Query::Gauge,
+            by: &["status"],
+            filter: &[],
+        },
+        Panel {
+            title: "Waiting clients by pool",
+            unit: "short",
+            metric: &*SHOW_POOLS_CLIENT,
+            query: Query::Gauge,
+            by: &["user", "database"],
+            filter: &[("status", "waiting")],
+        },
+        Panel {
+            title: "Queries per second",
+            unit: "ops",
+            metric: &*SHOW_POOLS_QUERIES_TOTAL,
+            query: Query::Rate,
+            by: &["database"],
+            filter: &[],
+        },
+        Panel {
+            title: "Transactions per second",
+            unit: "ops",
+            metric: &*SHOW_POOLS_TRANSACTIONS_TOTAL,
+            query: Query::Rate,
+            by: &["database"],
+            filter: &[],
+        },
+        Panel {
+            title: "Query duration p99",
+            unit: "s",
+            metric: &*SHOW_POOLS_QUERY_DURATION_SECONDS,
+            query: Query::Quantile(0.99),
+            by: &["database"],
+            filter: &[],
+        },
+        Panel {
+            title: "Transaction duration p99",
+            unit: "s",
+            metric: &*SHOW_POOLS_TRANSACTION_DURATION_SECONDS,
+            query: Query::Quantile(0.99),
+            by: &["database"],
+            filter: &[],
+        },
+        Panel {
+            title: "Client wait for a server p99",
+            unit: "s",
+            metric: &*SHOW_POOLS_WAIT_DURATION_SECONDS,
+            query: Query::Quantile(0.99),
+            by: &["database"],
+            filter: &[],
+        },
+        Panel {
+            title: "Network throughput",
+            unit: "Bps",
+            metric: &*SHOW_POOLS_BYTES_TOTAL,
+            query: Query::Rate,
+            by: &["direction"],
+            filter: &[],
+        },
+        Panel {
+            title: "Errors by SQLSTATE",
+            unit: "ops",
+            metric: &*SHOW_POOLS_ERRORS_TOTAL,
+            query: Query::Rate,
+            by: &["sqlstate"],
+            filter: &[],
+        },
+        Panel {
+            title: "Authentication failures",
+            unit: "ops",
+            metric: &*AUTH_FAILURES_TOTAL,
+            query: Query::Rate,
+            by: &["reason"],
+            filter: &[],
+        },
+        Panel {
+            title: "Rejected connections",
+            unit: "ops",
+            metric: &*LISTENER_REJECTIONS_TOTAL,
+            query: Query::Rate,
+            by: &["reason"],
+            filter: &[],
+        },
+        Panel {
+            title: "Client TLS handshakes by version",
+            unit: "ops",
+            metric: &*CLIENT_TLS_HANDSHAKES_TOTAL,
+            query: Query::Rate,
+            by: &["version"],
+            filter: &[],
+        },
+        Panel {
+            title: "COPY throughput",
+            unit: "Bps",
+            metric: &*COPY_BYTES_TOTAL,
+            query: Query::Rate,
+            by: &["direction"],
+            filter: &[],
+        },
+        Panel {
+            title: "Active COPY operations",
+            unit: "short",
+            metric: &*COPY_ACTIVE,
+            query: Query::Gauge,
+            by: &["direction"],
+            filter: &[],
+        },
+        Panel {
+            title: "Memory",
+            unit: "bytes",
+            metric: &*TOTAL_MEMORY,
+            query: Query::Gauge,
+            by: &[],
+            filter: &[],
+        },
+    ]
+}
+
+/// The single descriptor of a metric family.
+fn desc(metric: &dyn Collector) -> &Desc {
+    metric.desc()[0]
+}
+
+fn has_label(desc: &Desc, label: &str) -> bool {
+    desc.variable_labels.iter().any(|l| l == label)
+}
+
+impl Panel {
+    /// PromQL expression of the panel. Fails when the panel uses a label
+    /// the metric does not have.
+    fn expr(&self) -> Result<String, String> {
+        let desc = desc(self.metric);
+        for label in self.by.iter().chain(self.filter.iter().map(|(l, _)| l)) {
+            if !has_label(desc, label) {
+                return Err(format!(
+                    "dashboard panel \"{}\": metric {} has no label \"{label}\"",
+                    self.title, desc.fq_name
+                ));
+            }
+        }
+
+        let mut matchers: Vec<String> = self
+            .filter
+            .iter()
+            .map(|(label, value)| format!("{label}=\"{value}\""))
+            .collect();
+        if has_label(desc, DATABASE_LABEL) {
+            matchers.push(format!("{DATABASE_LABEL}=~\"$database\""));
+        }
+        let matchers = matchers.join(",");
+        let by = self.by.join(", ");
+
+        Ok(match self.query {
+            Query::Gauge => format!("sum by ({by}) ({}{{{matchers}}})", desc.fq_name),
+            Query::Rate => format!(
+                "sum by ({by}) (rate({}{{{matchers}}}[$__rate_interval]))",
+                desc.fq_name
+            ),
+            Query::Quantile(q) => {
+                let by = if by.is_empty() {
+                    "le".to_string()
+                } else {
+                    format!("le, {by}")
+                };
+                format!(
+                    "histogram_quantile({q}, sum by ({by}) (rate({}_bucket{{{matchers}}}[$__rate_interval])))",
+                    desc.fq_name
+                )
+            }
+        })
+    }
+
+    fn legend(&self) -> String {
+        if self.by.is_empty() {
+            return self.title.to_string();
+        }
+        self.by
+            .iter()
+            .map(|label| format!("{{{{{label}}}}}"))
+            .collect::<Vec<_>>()
+            .join(" ")
+    }
+}
+
+/// Builds the dashboard JSON, ready for Grafana's "Import dashboard".
+pub fn grafana_dashboard() -> Result<Value, String> {
+    let datasource = json!({ "type": "prometheus", "uid": "${datasource}" });
+
+    let mut grafana_panels = Vec::new();
+    for (i, panel) in panels().iter().enumerate() {
+        grafana_panels.push(json!({
+            "id": i + 1,
+            "type": "timeseries",
+            "title": panel.title,
+            "datasource": datasource,
+            "gridPos": { "h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8 },
+            "fieldConfig": { "defaults": { "unit": panel.unit }, "overrides": [] },
+            "options": { "legend": { "displayMode": "list", "placement": "bottom" } },
+            "targets": [{
+                "refId": "A",
+                "datasource": datasource,
+                "expr": panel.expr()?,
+                "legendFormat": panel.legend(),
+            }],
+        }));
+    }
+
+    let pool_size = &desc(&*SHOW_POOL_SIZE).fq_name;
+    Ok(json!({
+        "title": "pg_doorman",
+        "uid": "pg-doorman",
+        "tags": ["pg_doorman", "postgresql"],
+        "editable": true,
+        "schemaVersion": 39,
+        "refresh": "30s",
+        "time": { "from": "now-1h", "to": "now" },
+        "templating": {
+            "list": [
+                {
+                    "name": "datasource",
+                    "label": "Data source",
+                    "type": "datasource",
+                    "query": "prometheus",
+                },
+                {
+                    "name": "database",
+                    "label": "Database",
+                    "type": "query",
+                    "datasource": datasource,
+                    "query": format!("label_values({pool_size}, {DATABASE_LABEL})"),
+                    "refresh": 2,
+                    "includeAll": true,
+                    "multi": true,
+                    "allValue": ".*",
+                    "current": { "text": "All", "value": "$__all" },
+                },
+            ],
+        },
+        "panels": grafana_panels,
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn every_panel_uses_existing_labels() {
+        for panel in panels() {
+            panel.expr().unwrap();
+        }
+        grafana_dashboard().unwrap();
+    }
+
+    #[test]
+    fn per_pool_panels_follow_the_database_variable() {
+        let panel = Panel {
+            title: "waiting",
+            unit: "short",
+            metric: &*SHOW_POOLS_CLIENT,
+            query: Query::Gauge,
+            by: &["user"],
+            filter: &[("status", "waiting")],
+        };
+        assert_eq!(
+            panel.expr().unwrap(),
+            "sum by (user) (pg_doorman_pools_clients{status=\"waiting\",database=~\"$database\"})"
+        );
+        assert_eq!(panel.legend(), "{{user}}");
+    }
+
+    #[test]
+    fn quantile_panels_read_histogram_buckets() {
+        let panel = Panel {
+            title: "p99",
+            unit: "s",
+            metric: &*SHOW_POOLS_QUERY_DURATION_SECONDS,
+            query: Query::Quantile(0.99),
+            by: &["database"],
+            filter: &[],
+        };
+        assert_eq!(
+            panel.expr().unwrap(),
+            "histogram_quantile(0.99, sum by (le, database) \
+             (rate(pg_doorman_pools_query_duration_seconds_bucket{database=~\"$database\"}[$__rate_interval])))"
+        );
+    }
+
+    #[test]
+    fn missing_label_fails_generation() {
+        let panel = Panel {
+            title: "broken",
+            unit: "short",
+            metric: &*SHOW_POOLS_CLIENT,
+            query: Query::Gauge,
+            by: &["no_such_label"],
+            filter: &[],
+        };
+        assert!(panel.expr().unwrap_err().contains("no_such_label"));
+    }
+}
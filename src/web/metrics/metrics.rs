@@ -15,15 +15,15 @@ use crate::stats::{
     TOTAL_CONNECTION_COUNTER,
 };
 
-use super::system::get_process_memory_usage;
+use super::system::{get_fd_limit, get_open_fds, get_process_memory_usage};
 #[cfg(target_os = "linux")]
 use super::SHOW_SOCKETS;
 use super::{
     AUTH_QUERY_AUTH, AUTH_QUERY_AUTH_TOTAL, AUTH_QUERY_CACHE, AUTH_QUERY_CACHE_TOTAL,
     AUTH_QUERY_DYNAMIC_POOLS, AUTH_QUERY_DYNAMIC_POOLS_TOTAL, AUTH_QUERY_EXECUTOR,
-    AUTH_QUERY_EXECUTOR_TOTAL, COORDINATOR, COORDINATOR_TOTALS, POOL_SCALING_GAUGE,
-    POOL_SCALING_TOTALS, SHOW_ASYNC_CLIENTS_COUNT, SHOW_CLIENT_CACHE_BYTES,
-    SHOW_CLIENT_CACHE_ENTRIES, SHOW_CLIENT_PREPARED_ANONYMOUS_ENTRIES,
+    AUTH_QUERY_EXECUTOR_TOTAL, COORDINATOR, COORDINATOR_TOTALS, LOGIN_QUEUE, POOL_SCALING_GAUGE,
+    POOL_SCALING_TOTALS, PROCESS_MAX_FDS, PROCESS_OPEN_FDS, SHOW_ASYNC_CLIENTS_COUNT,
+    SHOW_CLIENT_CACHE_BYTES, SHOW_CLIENT_CACHE_ENTRIES, SHOW_CLIENT_PREPARED_ANONYMOUS_ENTRIES,
     SHOW_CLIENT_PREPARED_ANONYMOUS_EVICTIONS_TOTAL, SHOW_CLIENT_PREPARED_NAMED_ENTRIES,
     SHOW_CONNECTIONS, SHOW_CONNECTIONS_TOTAL, SHOW_POOLS_BYTES, SHOW_POOLS_BYTES_TOTAL,
     SHOW_POOLS_CLIENT, SHOW_POOLS_ERRORS_TOTAL, SHOW_POOLS_MAXWAIT_MICROSECONDS,
@@ -33,7 +33,8 @@ use super::{
     SHOW_POOLS_TRANSACTIONS_TOTAL, SHOW_POOLS_TRANSACTIONS_TOTAL_TIME, SHOW_POOLS_WAIT_TIME_AVG,
     SHOW_POOL_CACHE_BYTES, SHOW_POOL_CACHE_ENTRIES, SHOW_POOL_SIZE, SHOW_SERVERS_PREPARED_HITS,
     SHOW_SERVERS_PREPARED_HITS_TOTAL, SHOW_SERVERS_PREPARED_MISSES,
-    SHOW_SERVERS_PREPARED_MISSES_TOTAL, SHOW_SERVER_TLS_CONNECTIONS, TOTAL_MEMORY,
+    SHOW_SERVERS_PREPARED_MISSES_TOTAL, SHOW_SERVER_TLS_CONNECTIONS, SHOW_USERS_BYTES_TOTAL,
+    TOTAL_MEMORY,
 };
 
 /// Updates all metrics before they are exposed via the Prometheus endpoint.
@@ -54,6 +55,12 @@ pub fn update_metrics() {
 
 fn update_memory_metrics() {
     TOTAL_MEMORY.set(get_process_memory_usage() as f64);
+    if let Some(open) = get_open_fds() {
+        PROCESS_OPEN_FDS.set(open as f64);
+    }
+    if let Some(limit) = get_fd_limit() {
+        PROCESS_MAX_FDS.set(limit.soft as f64);
+    }
 }
 
 fn update_connection_metrics() {
@@ -74,6 +81,14 @@ fn update_connection_metrics() {
             value as u64,
         );
     }
+
+    let (active, waiting) = crate::client::login_queue_depth();
+    LOGIN_QUEUE
+        .with_label_values(&["active"])
+        .set(active as i64);
+    LOGIN_QUEUE
+        .with_label_values(&["waiting"])
+        .set(waiting as i64);
 }
 
 /// Bumps a Prometheus counter from a process-lifetime monotonic source
@@ -123,7 +138,14 @@ where
     /// once; otherwise the regular `current >= last_value` delta
     /// applies. The unusual case of the same generation reporting a
     /// smaller `current` is treated defensively as a reset too.
-    fn observe(&self, counter: &prometheus::IntCounter, key: K, generation: u64, current: u64) {
+    /// Returns the emitted delta so callers can feed aggregate counters.
+    fn observe(
+        &self,
+        counter: &prometheus::IntCounter,
+        key: K,
+        generation: u64,
+        current: u64,
+    ) -> u64 {
         let mut prev = match self.prev.lock() {
             Ok(g) => g,
             Err(p) => p.into_inner(),
@@ -141,6 +163,7 @@ where
             counter.inc_by(delta);
         }
         *entry = (current, generation);
+        delta
     }
 
     /// Drops entries whose keys are not in `current_keys`, returning
@@ -272,6 +295,12 @@ fn update_pool_metrics() {
     }
     for stale in POOL_BYTES_PREV.drain_stale(&current_bytes_keys) {
         let _ = SHOW_POOLS_BYTES_TOTAL.remove_label_values(&[&stale.0, &stale.1, &stale.2]);
+        if !current_bytes_keys
+            .iter()
+            .any(|(_, user, _)| user.as_str() == stale.1.as_str())
+        {
+            let _ = SHOW_USERS_BYTES_TOTAL.remove_label_values(&[&stale.0, &stale.1]);
+        }
     }
 }
 
@@ -470,7 +499,14 @@ fn update_pool_avg_metrics(identifier: &PoolIdentifier, stats: &PoolStats) {
 }
 
 fn update_pool_server_metrics(identifier: &PoolIdentifier, stats: &PoolStats) {
-    let server_states = [("active", stats.sv_active), ("idle", stats.sv_idle)];
+    // The sv_* columns of SHOW POOLS that pg_doorman fills in. `sv_used`
+    // and `sv_tested` stay 0: connections are checked on checkout, so
+    // there is no separate "returned, not yet checked" state to export.
+    let server_states = [
+        ("active", stats.sv_active),
+        ("idle", stats.sv_idle),
+        ("login", stats.sv_login),
+    ];
 
     for (state, value) in server_states {
         let labels: [&str; 3] = [state, identifier.user.as_str(), identifier.db.as_str()];
@@ -533,7 +569,7 @@ fn update_byte_metrics(identifier: &PoolIdentifier, stats: &PoolStats) {
         .with_label_values(&["sent", user, database])
         .set(stats.bytes_sent as f64);
 
-    POOL_BYTES_PREV.observe(
+    let received = POOL_BYTES_PREV.observe(
         &SHOW_POOLS_BYTES_TOTAL.with_label_values(&["received", user, database]),
         (
             "received".to_string(),
@@ -543,12 +579,22 @@ fn update_byte_metrics(identifier: &PoolIdentifier, stats: &PoolStats) {
         stats.source_generation,
         stats.bytes_received,
     );
-    POOL_BYTES_PREV.observe(
+    let sent = POOL_BYTES_PREV.observe(
         &SHOW_POOLS_BYTES_TOTAL.with_label_values(&["sent", user, database]),
         ("sent".to_string(), user.to_string(), database.to_string()),
         stats.source_generation,
         stats.bytes_sent,
     );
+
+    // The per-user counter adds the same deltas as the per-pool one
+    // instead of summing pool totals, so it keeps growing when one of
+    // the user's pools is dropped on RELOAD.
+    SHOW_USERS_BYTES_TOTAL
+        .with_label_values(&["received", user])
+        .inc_by(received);
+    SHOW_USERS_BYTES_TOTAL
+        .with_label_values(&["sent", user])
+        .inc_by(sent);
 }
 
 fn update_percentile_metrics(identifier: &PoolIdentifier, stats: &PoolStats) {
@@ -994,8 +1040,8 @@ fn update_pool_errors_metrics() {
 }
 
 /// Called by the GC tokio task on every sweep tick. Updates the interner
-/// gauges (entries, bytes per kind), increments eviction counters, and
-/// observes the sweep duration in the histogram. The byte totals come
+/// gauges (entries, bytes per kind), increments eviction and lookup
+/// counters, and observes the sweep duration in the histogram. The byte totals come
 /// straight from `GcStats` so we don't traverse the DashMaps a second
 /// time after the sweep already walked them.
 pub fn record_interner_gc(
@@ -1009,6 +1055,22 @@ pub fn record_interner_gc(
     super::QUERY_INTERNER_EVICTIONS_TOTAL
         .with_label_values(&["anonymous", "ttl_expired"])
         .inc_by(anon.evicted);
+    super::QUERY_INTERNER_EVICTIONS_TOTAL
+        .with_label_values(&["anonymous", "size_limit"])
+        .inc_by(anon.limited);
+
+    let lookups = crate::server::take_interner_lookups();
+    for (kind, result, count) in [
+        ("named", "hit", lookups.named_hits),
+        ("named", "miss", lookups.named_misses),
+        ("anonymous", "hit", lookups.anon_hits),
+        ("anonymous", "miss", lookups.anon_misses),
+        ("anonymous", "collision", lookups.anon_collisions),
+    ] {
+        super::QUERY_INTERNER_LOOKUPS_TOTAL
+            .with_label_values(&[kind, result])
+            .inc_by(count);
+    }
 
     super::QUERY_INTERNER_ENTRIES
         .with_label_values(&["named"])
@@ -1054,6 +1116,150 @@ pub fn observe_streaming_bytes(user: &str, database: &str, kind: &str, bytes: u6
         .inc_by(bytes);
 }
 
+/// Adds COPY bytes and rows for one pool and direction. Zero values skip
+/// the label lookup, so intermediate byte flushes don't touch the rows
+/// series.
+pub fn observe_copy_transfer(user: &str, database: &str, direction: &str, bytes: u64, rows: u64) {
+    if bytes > 0 {
+        super::COPY_BYTES_TOTAL
+            .with_label_values(&[user, database, direction])
+            .inc_by(bytes);
+    }
+    if rows > 0 {
+        super::COPY_ROWS_TOTAL
+            .with_label_values(&[user, database, direction])
+            .inc_by(rows);
+    }
+}
+
+/// Moves the count of in-progress COPY operations by `delta` (+1 or -1).
+pub fn observe_copy_active(user: &str, database: &str, direction: &str, delta: i64) {
+    super::COPY_ACTIVE
+        .with_label_values(&[user, database, direction])
+        .add(delta);
+}
+
+/// Records one resize by adaptive pool sizing; `direction` is `grow` or
+/// `shrink`.
+pub fn record_adaptive_resize(user: &str, database: &str, direction: &'static str) {
+    super::POOL_ADAPTIVE_RESIZES_TOTAL
+        .with_label_values(&[user, database, direction])
+        .inc();
+}
+
+/// Records one server connection closed for exceeding `server_max_memory`.
+pub fn record_server_memory_recycle(user: &str, database: &str) {
+    super::SERVER_MEMORY_RECYCLES_TOTAL
+        .with_label_values(&[user, database])
+        .inc();
+}
+
+/// Records a backend circuit breaker opening.
+pub fn record_circuit_breaker_trip(user: &str, database: &str) {
+    super::CIRCUIT_BREAKER_TRIPS_TOTAL
+        .with_label_values(&[user, database])
+        .inc();
+}
+
+/// Records a failed server checkout being repeated.
+pub fn record_checkout_retry(user: &str, database: &str) {
+    super::SERVER_CHECKOUT_RETRIES_TOTAL
+        .with_label_values(&[user, database])
+        .inc();
+}
+
+/// Records a statement refused by `statement_deny`.
+pub fn record_statement_denied(user: &str, database: &str) {
+    super::STATEMENTS_DENIED_TOTAL
+        .with_label_values(&[user, database])
+        .inc();
+}
+
+/// Records a connection event (see `crate::stats::events`).
+pub fn record_connection_event(event: &str, reason: &str) {
+    super::CONNECTION_EVENTS_TOTAL
+        .with_label_values(&[event, reason])
+        .inc();
+}
+
+/// Records a client connection accepted above `max_connections_soft`
+/// (`soft`) or rejected at `max_connections` (`hard`).
+pub fn record_client_limit(limit: &'static str) {
+    super::CLIENT_LIMIT_TOTAL.with_label_values(&[limit]).inc();
+}
+
+/// Records an idle client evicted above `max_connections_soft`.
+pub fn record_client_eviction(user: &str) {
+    super::CLIENT_EVICTIONS_TOTAL
+        .with_label_values(&[user])
+        .inc();
+}
+
+/// Connections gauge and transactions counter of one client tag group,
+/// kept by the group so clients don't look up labels per transaction.
+pub fn client_tag_series(
+    database: &str,
+    tag: &str,
+) -> (prometheus::IntGauge, prometheus::IntCounter) {
+    (
+        super::CLIENT_TAG_CONNECTIONS.with_label_values(&[database, tag]),
+        super::CLIENT_TAG_TRANSACTIONS_TOTAL.with_label_values(&[database, tag]),
+    )
+}
+
+/// Records a checkout that found its `application_name_checkout_limits`
+/// or `tag_checkout_limits` entry full.
+pub fn record_checkout_quota(database: &str, by: &str, key: &str, result: &str) {
+    super::CHECKOUT_QUOTA_TOTAL
+        .with_label_values(&[database, by, key, result])
+        .inc();
+}
+
+/// Records a client refused at its tag's `client_tag_limits` entry.
+pub fn record_client_tag_rejected(database: &str, tag: &str) {
+    super::CLIENT_TAG_REJECTED_TOTAL
+        .with_label_values(&[database, tag])
+        .inc();
+}
+
+/// Records a query canceled (`action` = "cancel") or its backend
+/// terminated ("terminate") by `max_query_time`.
+pub fn record_max_query_time(user: &str, database: &str, action: &str) {
+    super::MAX_QUERY_TIME_TOTAL
+        .with_label_values(&[user, database, action])
+        .inc();
+}
+
+/// Records a pipeline failed by `max_pipeline_depth` (`reason` =
+/// "max_pipeline_depth"), by a refused Parse ("rejected") or by an unknown
+/// statement under `driver_compat = "jdbc"` ("unknown_statement").
+pub fn record_pipeline_abort(user: &str, database: &str, reason: &str) {
+    super::PIPELINE_ABORTS_TOTAL
+        .with_label_values(&[user, database, reason])
+        .inc();
+}
+
+/// Records a `SHOW` of a `show_local_parameters` entry: answered from the
+/// client's ParameterStatus snapshot ("parameter_status") or the pool's
+/// cache ("cache"), or sent to the backend to fill the cache ("backend").
+pub fn record_show_local(source: &str) {
+    super::SHOW_LOCAL_TOTAL.with_label_values(&[source]).inc();
+}
+
+/// Records a query changed by `rewrite_rules`.
+pub fn record_query_rewrite(user: &str, database: &str) {
+    super::QUERY_REWRITES_TOTAL
+        .with_label_values(&[user, database])
+        .inc();
+}
+
+/// Records idle server connections closed inside a recycle window.
+pub fn record_scheduled_recycle(user: &str, database: &str, closed: usize) {
+    super::SERVER_SCHEDULED_RECYCLES_TOTAL
+        .with_label_values(&[user, database])
+        .inc_by(closed as u64);
+}
+
 /// Records one client rejection at the listener / pre-auth stage.
 /// `reason` must be one of the labels documented on
 /// `LISTENER_REJECTIONS_TOTAL`; passing any other value still works but
@@ -1065,6 +1271,92 @@ pub fn record_listener_rejection(reason: &'static str) {
         .inc();
 }
 
+/// Records one completed client TLS handshake. `version` is what the TLS
+/// backend reports (`TLSv1.2`, `TLSv1.3`, ...), `None` becomes `unknown`.
+#[inline]
+pub fn record_client_tls_handshake(version: Option<&'static str>, seconds: f64) {
+    super::CLIENT_TLS_HANDSHAKES_TOTAL
+        .with_label_values(&[version.unwrap_or("unknown")])
+        .inc();
+    super::CLIENT_TLS_HANDSHAKE_DURATION.observe(seconds);
+}
+
+/// Records one failed client TLS handshake, labelled by
+/// `classify_tls_handshake_error` of the error text.
+#[inline]
+pub fn record_client_tls_handshake_error(error: &str) {
+    super::CLIENT_TLS_HANDSHAKE_ERRORS_TOTAL
+        .with_label_values(&[classify_tls_handshake_error(error)])
+        .inc();
+}
+
+/// Maps a TLS handshake error message onto the fixed reason labels of
+/// `pg_doorman_client_tls_handshake_errors_total`. The TLS backend only
+/// exposes its errors as text, so this matches OpenSSL's reason strings
+/// ("unsupported protocol", "sslv3 alert bad certificate", ...).
+fn classify_tls_handshake_error(error: &str) -> &'static str {
+    let error = error.to_ascii_lowercase();
+    if error.contains("certificate") || error.contains("unknown ca") {
+        "bad_certificate"
+    } else if error.contains("unsupported protocol")
+        || error.contains("wrong version number")
+        || error.contains("protocol version")
+        || error.contains("http request")
+    {
+        "protocol_version"
+    } else if error.contains("no shared cipher") || error.contains("no suitable") {
+        "no_shared_cipher"
+    } else if error.contains("unexpected eof")
+        || error.contains("connection reset")
+        || error.contains("broken pipe")
+    {
+        "eof"
+    } else {
+        "other"
+    }
+}
+
+/// Records one failed client authentication. `reason` must be one of the
+/// labels documented on `AUTH_FAILURES_TOTAL`. `user` is set only for
+/// users pg_doorman knows (see `AUTH_USER_FAILURES_TOTAL`).
+#[inline]
+pub fn record_auth_failure(reason: &'static str, user: Option<&str>) {
+    super::AUTH_FAILURES_TOTAL
+        .with_label_values(&[reason])
+        .inc();
+    if let Some(user) = user {
+        super::AUTH_USER_FAILURES_TOTAL
+            .with_label_values(&[user, reason])
+            .inc();
+    }
+}
+
+/// Records one successful authentication of a user with `next_password`.
+/// `secret` is `current` or `next`.
+#[inline]
+pub fn record_auth_secret_used(pool: &str, user: &str, secret: &'static str) {
+    super::AUTH_SECRET_USED_TOTAL
+        .with_label_values(&[pool, user, secret])
+        .inc();
+}
+
+/// Records one Vault request made for backend credentials.
+#[inline]
+pub fn record_vault_request(pool: &str, user: &str, action: &'static str, result: &'static str) {
+    super::VAULT_REQUESTS_TOTAL
+        .with_label_values(&[pool, user, action, result])
+        .inc();
+}
+
+/// Records one client protocol violation. `kind` must be one of the
+/// labels documented on `CLIENT_PROTOCOL_VIOLATIONS_TOTAL`.
+#[inline]
+pub fn record_client_protocol_violation(listener: &'static str, kind: &'static str) {
+    super::CLIENT_PROTOCOL_VIOLATIONS_TOTAL
+        .with_label_values(&[listener, kind])
+        .inc();
+}
+
 /// Observes wall-clock duration of one backend connection setup phase.
 /// `phase` must be one of `tcp_connect`, `tls`, `auth`, `startup` —
 /// passing any other value still works but breaks the cardinality
@@ -1113,6 +1405,15 @@ pub fn observe_pool_wait_microseconds(user: &str, database: &str, microseconds:
         .observe(microseconds as f64 / 1_000_000.0);
 }
 
+/// Observes one slow-path wait on the pool coordinator. `priority` is the
+/// user's queue priority, at most 256 values per database.
+#[inline]
+pub fn observe_coordinator_wait(database: &str, priority: u8, seconds: f64) {
+    super::COORDINATOR_WAIT_DURATION_SECONDS
+        .with_label_values(&[database, &priority.to_string()])
+        .observe(seconds);
+}
+
 /// Refreshes the trio of static info gauges: `build_info` (constant
 /// version label), `users_configured` (one series per (user, database,
 /// pool_mode) triple from the active config), and `log_level` (current
@@ -1196,6 +1497,110 @@ mod tests {
         assert_eq!(classify_sqlstate("25P01"), "other");
     }
 
+    #[test]
+    fn tls_handshake_errors_map_onto_fixed_reasons() {
+        let cases = [
+            (
+                "error:0A000102:SSL routines:tls_early_post_process_client_hello:unsupported protocol",
+                "protocol_version",
+            ),
+            ("error:0A00010B:SSL routines:ssl_get_record:wrong version number", "protocol_version"),
+            (
+                "error:0A000412:SSL routines:ssl3_read_bytes:sslv3 alert bad certificate",
+                "bad_certificate",
+            ),
+            (
+                "error:0A000418:SSL routines:ssl3_read_bytes:tlsv1 alert unknown ca",
+                "bad_certificate",
+            ),
+            (
+                "error:0A0000C1:SSL routines:tls_post_process_client_hello:no shared cipher",
+                "no_shared_cipher",
+            ),
+            ("error:0A000126:SSL routines:ssl3_read_n:unexpected eof while reading", "eof"),
+            ("something new", "other"),
+        ];
+        for (message, reason) in cases {
+            assert_eq!(
+                super::classify_tls_handshake_error(message),
+                reason,
+                "{message}"
+            );
+        }
+    }
+
+    /// Empty transaction-mode stats of pool `db`/`user`.
+    fn pool_stats(
+        db: &str,
+        user: &str,
+    ) -> (crate::pool::PoolIdentifier, crate::stats::pool::PoolStats) {
+        use crate::stats::pool::{Percentile, PoolStats};
+
+        let zero = || Percentile {
+            p99: 0,
+            p95: 0,
+            p90: 0,
+            p50: 0,
+        };
+        let id = crate::pool::PoolIdentifier::new(db, user);
+        let stats = PoolStats::new_with_percentiles(
+            id.clone(),
+            crate::config::PoolMode::Transaction,
+            zero(),
+            zero(),
+            zero(),
+        );
+        (id, stats)
+    }
+
+    #[test]
+    fn pool_server_gauge_counts_login_connections() {
+        let (id, mut stats) = pool_stats("show_states_db", "show_states_user");
+        stats.sv_active = 3;
+        stats.sv_idle = 2;
+        stats.sv_login = 1;
+        super::update_pool_server_metrics(&id, &stats);
+
+        let server = |state: &str| {
+            super::SHOW_POOLS_SERVER
+                .with_label_values(&[state, "show_states_user", "show_states_db"])
+                .get()
+        };
+        assert_eq!(server("active"), 3.0);
+        assert_eq!(server("idle"), 2.0);
+        assert_eq!(server("login"), 1.0);
+    }
+
+    #[test]
+    fn user_bytes_counter_sums_pools_and_survives_pool_reset() {
+        let pool = |db: &str, generation: u64, received: u64, sent: u64| {
+            let (id, mut stats) = pool_stats(db, "user_bytes_user");
+            stats.source_generation = generation;
+            stats.bytes_received = received;
+            stats.bytes_sent = sent;
+            (id, stats)
+        };
+        let user_bytes = |direction: &str| {
+            super::SHOW_USERS_BYTES_TOTAL
+                .with_label_values(&[direction, "user_bytes_user"])
+                .get()
+        };
+
+        let (a, stats_a) = pool("user_bytes_a", 1, 100, 10);
+        let (b, stats_b) = pool("user_bytes_b", 1, 50, 5);
+        super::update_byte_metrics(&a, &stats_a);
+        super::update_byte_metrics(&b, &stats_b);
+        assert_eq!(user_bytes("received"), 150);
+        assert_eq!(user_bytes("sent"), 15);
+
+        // Pool `a` is rebuilt by RELOAD and restarts from zero: the
+        // user counter only grows by what the new pool transferred.
+        let (a, stats_a) = pool("user_bytes_a", 2, 30, 3);
+        super::update_byte_metrics(&a, &stats_a);
+        assert_eq!(user_bytes("received"), 180);
+        assert_eq!(user_bytes("sent"), 18);
+    }
+
     #[test]
     fn pool_transaction_observe_drops_zero_microseconds() {
         // idle(0) and add_xact_time_and_idle(0) fire on backend
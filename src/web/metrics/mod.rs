@@ -10,6 +10,7 @@ use prometheus::{
 };
 
 // Sub-modules
+pub(crate) mod dashboard;
 mod handler;
 #[allow(clippy::module_inception)]
 mod metrics;
@@ -21,9 +22,17 @@ mod tests;
 // Re-exports
 pub(crate) use handler::write_metrics_response;
 pub use metrics::{
-    observe_anonymous_eviction, observe_backend_create_phase, observe_pool_query_microseconds,
-    observe_pool_transaction_microseconds, observe_pool_wait_microseconds, observe_streaming_bytes,
-    observe_streaming_event, record_interner_gc, record_listener_rejection, record_synthetic_miss,
+    client_tag_series, observe_anonymous_eviction, observe_backend_create_phase,
+    observe_coordinator_wait, observe_copy_active, observe_copy_transfer,
+    observe_pool_query_microseconds, observe_pool_transaction_microseconds,
+    observe_pool_wait_microseconds, observe_streaming_bytes, observe_streaming_event,
+    record_adaptive_resize, record_auth_failure, record_auth_secret_used, record_checkout_quota,
+    record_checkout_retry, record_circuit_breaker_trip, record_client_eviction,
+    record_client_limit, record_client_protocol_violation, record_client_tag_rejected,
+    record_client_tls_handshake, record_client_tls_handshake_error, record_connection_event,
+    record_interner_gc, record_listener_rejection, record_max_query_time, record_pipeline_abort,
+    record_query_rewrite, record_scheduled_recycle, record_server_memory_recycle,
+    record_show_local, record_statement_denied, record_synthetic_miss, record_vault_request,
     refresh_static_info_metrics,
 };
 
@@ -95,6 +104,58 @@ pub(crate) static TOTAL_MEMORY: Lazy<Gauge> = Lazy::new(|| {
     gauge
 });
 
+/// Open file descriptors of the process; compare with
+/// `pg_doorman_process_max_fds` to see how close accept() is to EMFILE.
+pub(crate) static PROCESS_OPEN_FDS: Lazy<Gauge> = Lazy::new(|| {
+    let gauge = Gauge::new(
+        "pg_doorman_process_open_fds",
+        "Number of file descriptors the pg_doorman process has open (Linux only).",
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
+pub(crate) static PROCESS_MAX_FDS: Lazy<Gauge> = Lazy::new(|| {
+    let gauge = Gauge::new(
+        "pg_doorman_process_max_fds",
+        "Soft RLIMIT_NOFILE of the pg_doorman process: the most file descriptors it may open.",
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
+/// Pool resizes made by adaptive pool sizing (`users[].max_pool_size`),
+/// by direction. The current size is in `pg_doorman_pool_size`.
+pub(crate) static POOL_ADAPTIVE_RESIZES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_pool_adaptive_resizes_total",
+            "Cumulative count of pool resizes made by adaptive pool sizing, by user, database and direction ('grow' when the mean checkout wait exceeded adaptive_pool_wait_target, 'shrink' when backends sat idle).",
+        ),
+        &["user", "database", "direction"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Clients in the login queue (`max_concurrent_logins`): `active` are
+/// authenticating, `waiting` are queued for a slot.
+pub(crate) static LOGIN_QUEUE: Lazy<IntGaugeVec> = Lazy::new(|| {
+    let gauge = IntGaugeVec::new(
+        Opts::new(
+            "pg_doorman_login_queue",
+            "Clients in the login queue by state: 'active' (authenticating) or 'waiting' (queued for an authentication slot by max_concurrent_logins).",
+        ),
+        &["state"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
 /// DEPRECATED: monotonic value exposed as a Gauge — `rate()` works in
 /// practice but Prometheus reset detection breaks on restart because the
 /// gauge does not declare itself as monotonic. Prefer
@@ -161,7 +222,7 @@ pub(crate) static SHOW_POOL_SIZE: Lazy<GaugeVec> = Lazy::new(|| {
     let gauge = GaugeVec::new(
         Opts::new(
             "pg_doorman_pool_size",
-            "Configured maximum pool size per user and database. Useful for calculating remaining pool capacity together with pg_doorman_pools_servers.",
+            "Current maximum pool size per user and database: the configured pool_size, or the size adaptive pool sizing settled on for users with max_pool_size. Useful for calculating remaining pool capacity together with pg_doorman_pools_servers.",
         ),
         &["user", "database"],
     )
@@ -174,7 +235,7 @@ pub(crate) static SHOW_POOLS_SERVER: Lazy<GaugeVec> = Lazy::new(|| {
     let gauge = GaugeVec::new(
         Opts::new(
             "pg_doorman_pools_servers",
-            "Number of servers in connection pools by status, user, and database. Status values include: 'active' (actively serving clients) and 'idle' (available for new connections). Helps monitor server availability and load distribution.",
+            "Number of servers in connection pools by status, user, and database. Status values include: 'active' (actively serving clients), 'idle' (available for new connections) and 'login' (still connecting or authenticating), matching sv_active, sv_idle and sv_login in SHOW POOLS. Helps monitor server availability and load distribution.",
         ),
         &["status", "user", "database"],
     )
@@ -281,6 +342,22 @@ pub(crate) static SHOW_POOLS_BYTES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
     counter
 });
 
+/// Per-user, per-direction byte counter: the sum of
+/// `pg_doorman_pools_bytes_total` over every pool of the user. Grows
+/// by the same deltas, so it stays monotonic when a pool is dropped.
+pub(crate) static SHOW_USERS_BYTES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_users_bytes_total",
+            "Cumulative bytes transferred per user and direction, summed over all pools of the user. Direction is 'received' (data from client) or 'sent' (data to client).",
+        ),
+        &["direction", "user"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
 pub(crate) static SHOW_POOL_CACHE_ENTRIES: Lazy<GaugeVec> = Lazy::new(|| {
     let gauge = GaugeVec::new(
         Opts::new(
@@ -390,7 +467,7 @@ pub(crate) static SHOW_CLIENT_PREPARED_ANONYMOUS_EVICTIONS_TOTAL: Lazy<IntCounte
 
 /// Wall-clock duration of each phase of backend connection setup, split
 /// by phase. Phases are disjoint and additive:
-/// - `tcp_connect` — raw socket connect (TcpStream::connect or
+/// - `tcp_connect` — raw socket connect (Happy Eyeballs TCP connect or
 ///   UnixStream::connect plus socket configuration).
 /// - `tls` — full TLS bring-up: SSL request roundtrip plus the TLS
 ///   handshake. Skipped for plain TCP and Unix sockets.
@@ -435,6 +512,9 @@ pub(crate) static BACKEND_CREATE_DURATION_SECONDS: Lazy<HistogramVec> = Lazy::ne
 /// - `protocol_error` — unexpected sequence of startup messages
 /// - `invalid_startup` — malformed startup packet or socket error before parameters
 /// - `too_many_clients` — listener at `max_clients` capacity
+/// - `login_queue_full` — login queue at `max_login_queue` capacity
+/// - `banned` — address banned after repeated authentication failures
+/// - `denied` — address in the runtime deny list (`DENY ADDRESS`)
 ///
 /// A sustained non-zero `hba` or `tls_handshake_fail` rate is the bruteforce
 /// signal pg_doorman previously only logged.
@@ -448,7 +528,37 @@ pub(crate) static LISTENER_REJECTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(||
              'tls_handshake_fail' (TLS negotiation failed), \
              'protocol_error' (unexpected startup message sequence), \
              'invalid_startup' (malformed startup or socket error), \
-             'too_many_clients' (listener at capacity).",
+             'too_many_clients' (listener at capacity), \
+             'too_many_handshakes' (max_client_handshakes reached), \
+             'login_queue_full' (max_login_queue reached), \
+             'login_timeout' (client_login_timeout elapsed), \
+             'proxy_protocol' (missing or malformed PROXY header), \
+             'listener_database' (database not in the listener's databases), \
+             'banned' (address banned by auth_ban_threshold), \
+             'denied' (address in the DENY ADDRESS list).",
+        ),
+        &["reason"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Failed client authentications by reason. The label set is fixed:
+/// - `bad_password` — wrong password, SCRAM proof, JWT or Talos token, or PAM refusal
+/// - `unknown_user` — no pool user and no `auth_query` row for the user
+/// - `hba_reject` — HBA rules or `plain_auth_require_tls` denied the client
+/// - `timeout` — `client_login_timeout` elapsed before the login finished
+/// - `other` — malformed authentication messages and unusable stored secrets
+pub(crate) static AUTH_FAILURES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_auth_failures_total",
+            "Cumulative count of failed client authentications, by reason: \
+             'bad_password' (wrong password or token), 'unknown_user' (no such \
+             user), 'hba_reject' (denied by HBA or plain_auth_require_tls), \
+             'timeout' (client_login_timeout elapsed) or 'other' (malformed \
+             messages, unusable stored secret).",
         ),
         &["reason"],
     )
@@ -457,6 +567,82 @@ pub(crate) static LISTENER_REJECTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(||
     counter
 });
 
+/// Failed authentications of users pg_doorman knows: pool users, users
+/// found by `auth_query`, `stats_users` and the admin user. Unknown
+/// usernames only reach `AUTH_FAILURES_TOTAL`, so a scan over random
+/// names can't grow the label set.
+pub(crate) static AUTH_USER_FAILURES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_auth_user_failures_total",
+            "Cumulative count of failed authentications of known users, by \
+             user and reason ('bad_password', 'hba_reject' or 'other').",
+        ),
+        &["user", "reason"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Password rotation progress: which of a user's two secrets clients
+/// authenticate with. Only users with `next_password` are counted, so the
+/// label set stays bounded by the static config.
+pub(crate) static AUTH_SECRET_USED_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_auth_secret_used_total",
+            "Cumulative count of successful password authentications of users \
+             with next_password, by pool, user and the secret that matched: \
+             'current' (password) or 'next' (next_password).",
+        ),
+        &["pool", "user", "secret"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Vault requests made for `server_vault_path` users, by pool, user,
+/// action (`read` or `renew`) and result (`ok` or `error`). Bounded by the
+/// static config, like `AUTH_SECRET_USED_TOTAL`.
+pub(crate) static VAULT_REQUESTS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_vault_requests_total",
+            "Cumulative count of Vault requests for backend credentials, by pool, \
+             user, action ('read' or 'renew') and result ('ok' or 'error').",
+        ),
+        &["pool", "user", "action", "result"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Client protocol violations by listener (`tcp`, `unix`) and kind:
+/// - `unexpected_message` — message type the pooler does not handle
+/// - `bad_length` — length prefix too small or above `max_client_message_size`
+/// - `auth_desync` — something other than a password message during authentication
+/// - `bad_startup` — unknown protocol code or bad length in the startup packet
+///
+/// Each violation is also logged with the client address and the first
+/// bytes it sent, to find the misbehaving client library.
+pub(crate) static CLIENT_PROTOCOL_VIOLATIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_protocol_violations_total",
+            "Cumulative count of client protocol violations, by listener \
+             ('tcp', 'unix') and kind: 'unexpected_message', 'bad_length', \
+             'auth_desync', 'bad_startup'.",
+        ),
+        &["listener", "kind"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
 /// Counts backend startup attempts pg_doorman aborted because PostgreSQL
 /// returned an `ErrorResponse` that names a key the pool actually sent in
 /// `StartupMessage`. Labels:
@@ -626,6 +812,52 @@ pub(crate) static STREAMING_BYTES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
     counter
 });
 
+/// COPY traffic by pool and direction: `in` for COPY FROM STDIN, `out`
+/// for COPY TO STDOUT. Bytes are whole CopyData messages and reach the
+/// counter in 1 MiB steps while a COPY runs; rows come from the
+/// `COPY n` tag when it completes.
+pub(crate) static COPY_BYTES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_copy_bytes_total",
+            "Bytes of CopyData forwarded in COPY operations, by user, database \
+             and direction ('in' for COPY FROM STDIN, 'out' for COPY TO STDOUT).",
+        ),
+        &["user", "database", "direction"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static COPY_ROWS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_copy_rows_total",
+            "Rows transferred by completed COPY operations, by user, database \
+             and direction ('in' or 'out'), from the COPY command tag.",
+        ),
+        &["user", "database", "direction"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static COPY_ACTIVE: Lazy<IntGaugeVec> = Lazy::new(|| {
+    let gauge = IntGaugeVec::new(
+        Opts::new(
+            "pg_doorman_copy_active",
+            "Backend connections currently in COPY mode, by user, database and \
+             direction ('in' or 'out').",
+        ),
+        &["user", "database", "direction"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
 /// Number of entries in the global query interner, split by kind (named or
 /// anonymous). Refreshed once per GC sweep.
 pub(crate) static QUERY_INTERNER_ENTRIES: Lazy<IntGaugeVec> = Lazy::new(|| {
@@ -662,13 +894,14 @@ pub(crate) static QUERY_INTERNER_BYTES: Lazy<IntGaugeVec> = Lazy::new(|| {
 /// Cumulative count of interner evictions, split by kind and reason.
 /// reason='gc_passive' for named entries removed because nothing outside
 /// the interner held the Arc<str>; reason='ttl_expired' for anonymous
-/// entries removed after exceeding the idle TTL.
+/// entries removed after exceeding the idle TTL; reason='size_limit' for
+/// anonymous entries removed over query_interner_anon_max_entries.
 pub(crate) static QUERY_INTERNER_EVICTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
     let counter = IntCounterVec::new(
         Opts::new(
             "pg_doorman_query_interner_evictions_total",
             "Cumulative interner evictions, by kind (named|anonymous) and \
-             reason (gc_passive|ttl_expired).",
+             reason (gc_passive|ttl_expired|size_limit).",
         ),
         &["kind", "reason"],
     )
@@ -677,6 +910,24 @@ pub(crate) static QUERY_INTERNER_EVICTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::ne
     counter
 });
 
+/// Cumulative interner lookups on Parse, split by kind and result:
+/// 'hit' reused interned text, 'miss' interned new text, 'collision'
+/// (anonymous only) found another text under the same hash. Advanced once
+/// per GC sweep.
+pub(crate) static QUERY_INTERNER_LOOKUPS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_query_interner_lookups_total",
+            "Cumulative interner lookups on Parse, by kind (named|anonymous) and \
+             result (hit|miss|collision). Advanced once per GC sweep.",
+        ),
+        &["kind", "result"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
 /// Counter for cases where pg_doorman returns SQLSTATE 26000 because an
 /// anonymous prepared statement state is no longer available when a
 /// later Bind/Describe refers to it. A persistently non-zero rate can
@@ -943,6 +1194,27 @@ pub(crate) static SHOW_POOLS_WAIT_DURATION_SECONDS: Lazy<HistogramVec> = Lazy::n
     histogram
 });
 
+/// Time spent waiting on the database-level pool coordinator for a
+/// connection slot, by database and user queue priority
+/// (`users[].priority`). Shows whether priorities actually shorten the
+/// wait of interactive users while batch users absorb the contention.
+pub(crate) static COORDINATOR_WAIT_DURATION_SECONDS: Lazy<HistogramVec> = Lazy::new(|| {
+    let histogram = HistogramVec::new(
+        prometheus::HistogramOpts::new(
+            "pg_doorman_pool_coordinator_wait_duration_seconds",
+            "Time a pool spent waiting for a max_db_connections slot on the pool \
+             coordinator before it got a permit or gave up, by database and user \
+             queue priority. Only the slow path is recorded: permits taken without \
+             waiting are not observed.",
+        )
+        .buckets(vec![0.0001, 0.001, 0.01, 0.1, 1.0]),
+        &["database", "priority"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(histogram.clone())).unwrap();
+    histogram
+});
+
 /// Aggregated prepared-statement hits across all backends of a pool.
 /// `backend_pid` is intentionally absent: each backend's PID survives only
 /// `server_lifetime` (20 minutes by default, often shorter under churn),
@@ -1228,6 +1500,60 @@ pub(crate) static SHOW_SERVER_TLS_HANDSHAKE_ERRORS: Lazy<IntCounterVec> = Lazy::
     counter
 });
 
+/// Completed client TLS handshakes by negotiated protocol version
+/// (`TLSv1`, `TLSv1.1`, `TLSv1.2`, `TLSv1.3`, or `unknown` where the TLS
+/// backend does not report it). Shows which client fleets still speak
+/// TLS 1.0/1.1 before `tls_min_version` is raised.
+pub(crate) static CLIENT_TLS_HANDSHAKES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_tls_handshakes_total",
+            "Total number of successful TLS handshakes with clients, by negotiated protocol version.",
+        ),
+        &["version"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+/// Failed client TLS handshakes by reason. The label set is fixed, see
+/// `classify_tls_handshake_error`:
+/// - `bad_certificate` — a certificate was rejected by either side
+/// - `protocol_version` — no TLS version both sides accept, or not TLS at all
+/// - `no_shared_cipher` — no cipher suite both sides accept
+/// - `eof` — the client closed the connection mid-handshake
+/// - `other` — anything else
+pub(crate) static CLIENT_TLS_HANDSHAKE_ERRORS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_tls_handshake_errors_total",
+            "Total number of failed TLS handshakes with clients, by reason: \
+             'bad_certificate', 'protocol_version', 'no_shared_cipher', 'eof' \
+             (client closed the connection) or 'other'.",
+        ),
+        &["reason"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CLIENT_TLS_HANDSHAKE_DURATION: Lazy<Histogram> = Lazy::new(|| {
+    let histogram = Histogram::with_opts(
+        prometheus::HistogramOpts::new(
+            "pg_doorman_client_tls_handshake_duration_seconds",
+            "Duration of successful TLS handshakes with clients.",
+        )
+        .buckets(vec![
+            0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5,
+        ]),
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(histogram.clone())).unwrap();
+    histogram
+});
+
 pub(crate) static PATRONI_API_REQUESTS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
     let counter = IntCounterVec::new(
         Opts::new(
@@ -1320,6 +1646,241 @@ pub(crate) static FALLBACK_CANDIDATE_FAILURES_TOTAL: Lazy<IntCounterVec> = Lazy:
     counter
 });
 
+pub(crate) static SERVER_IN_RECOVERY: Lazy<GaugeVec> = Lazy::new(|| {
+    let gauge = GaugeVec::new(
+        Opts::new(
+            "pg_doorman_server_in_recovery",
+            "Last observed role of a backend host: 1 = in recovery (standby), 0 = primary. \
+             Reported for pools with target_session_attrs set, by pool/host/port.",
+        ),
+        &["pool", "host", "port"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
+pub(crate) static SERVER_ROLE_CHANGES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_server_role_changes_total",
+            "Total number of observed backend role changes (primary <-> standby), by pool/host/port.",
+        ),
+        &["pool", "host", "port"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static SERVER_MEMORY_RECYCLES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_server_memory_recycles_total",
+            "Total number of server connections closed because the backend memory exceeded server_max_memory, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static SERVER_SCHEDULED_RECYCLES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_server_scheduled_recycles_total",
+            "Total number of idle server connections closed inside a server_recycle_windows maintenance window, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CIRCUIT_BREAKER_TRIPS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_circuit_breaker_trips_total",
+            "Total number of times the backend circuit breaker opened after circuit_breaker_threshold connect failures in a row, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static SERVER_CHECKOUT_RETRIES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_server_checkout_retries_total",
+            "Total number of failed server checkouts repeated transparently under server_checkout_retries, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static STATEMENTS_DENIED_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_statements_denied_total",
+            "Total number of statements refused by the pool's statement_deny rules, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static QUERY_REWRITES_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_query_rewrites_total",
+            "Total number of queries changed by the pool's rewrite_rules, by user and database.",
+        ),
+        &["user", "database"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CONNECTION_EVENTS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_connection_events_total",
+            "Total number of client connects and disconnects and server connects and closes, by event and reason.",
+        ),
+        &["event", "reason"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CLIENT_LIMIT_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_limit_total",
+            "Total number of client connections accepted above max_connections_soft (limit=soft) or rejected at max_connections (limit=hard).",
+        ),
+        &["limit"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CLIENT_EVICTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_evictions_total",
+            "Total number of idle clients evicted above max_connections_soft, by user.",
+        ),
+        &["user"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CLIENT_TAG_CONNECTIONS: Lazy<IntGaugeVec> = Lazy::new(|| {
+    let gauge = IntGaugeVec::new(
+        Opts::new(
+            "pg_doorman_client_tag_connections",
+            "Current number of clients per pool and client tag; tags a pool does not list in client_tag_limits are counted as tag=\"other\".",
+        ),
+        &["database", "tag"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(gauge.clone())).unwrap();
+    gauge
+});
+
+pub(crate) static CLIENT_TAG_TRANSACTIONS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_tag_transactions_total",
+            "Total number of transactions completed by clients, per pool and client tag.",
+        ),
+        &["database", "tag"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CLIENT_TAG_REJECTED_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_client_tag_rejected_total",
+            "Total number of clients refused at login because their tag reached its client_tag_limits entry, per pool and tag.",
+        ),
+        &["database", "tag"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static CHECKOUT_QUOTA_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_checkout_quota_total",
+            "Total number of checkouts that found their application_name or tag checkout limit full, by whether a slot came free in time (result=waited) or not (result=timeout).",
+        ),
+        &["database", "by", "key", "result"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static MAX_QUERY_TIME_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_max_query_time_total",
+            "Total number of queries stopped by max_query_time, by user, database and action ('cancel' or 'terminate').",
+        ),
+        &["user", "database", "action"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static PIPELINE_ABORTS_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_pipeline_aborts_total",
+            "Total number of client pipelines failed by pg_doorman, by user, database and reason ('max_pipeline_depth', 'rejected' or 'unknown_statement').",
+        ),
+        &["user", "database", "reason"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
+pub(crate) static SHOW_LOCAL_TOTAL: Lazy<IntCounterVec> = Lazy::new(|| {
+    let counter = IntCounterVec::new(
+        Opts::new(
+            "pg_doorman_show_local_total",
+            "Total number of SHOW queries for general.show_local_parameters, by where the value came from ('parameter_status', 'cache' or 'backend').",
+        ),
+        &["source"],
+    )
+    .unwrap();
+    REGISTRY.register(Box::new(counter.clone())).unwrap();
+    counter
+});
+
 pub(crate) static PATRONI_API_DURATION: Lazy<HistogramVec> = Lazy::new(|| {
     let histogram = HistogramVec::new(
         prometheus::HistogramOpts::new(
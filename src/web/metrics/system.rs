@@ -28,6 +28,81 @@ fn page_size_bytes() -> u64 {
     })
 }
 
+/// `RLIMIT_NOFILE` of the process. `RLIM_INFINITY` is reported as
+/// `u64::MAX`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FdLimit {
+    pub soft: u64,
+    pub hard: u64,
+}
+
+/// Number of open file descriptors, from `/proc/self/fd`. `None` outside
+/// Linux or when procfs is not mounted.
+pub fn get_open_fds() -> Option<u64> {
+    #[cfg(target_os = "linux")]
+    {
+        // The directory handle itself shows up in the listing.
+        std::fs::read_dir("/proc/self/fd")
+            .ok()
+            .map(|entries| (entries.count() as u64).saturating_sub(1))
+    }
+    #[cfg(not(target_os = "linux"))]
+    {
+        None
+    }
+}
+
+/// Current `RLIMIT_NOFILE`, or `None` when getrlimit fails.
+#[cfg(unix)]
+pub fn get_fd_limit() -> Option<FdLimit> {
+    // SAFETY: getrlimit writes only to the stack-local rlimit struct.
+    let rl = unsafe {
+        let mut rl: libc::rlimit = std::mem::zeroed();
+        if libc::getrlimit(libc::RLIMIT_NOFILE, &mut rl) != 0 {
+            return None;
+        }
+        rl
+    };
+    let value = |v: libc::rlim_t| {
+        if v == libc::RLIM_INFINITY {
+            u64::MAX
+        } else {
+            v as u64
+        }
+    };
+    Some(FdLimit {
+        soft: value(rl.rlim_cur),
+        hard: value(rl.rlim_max),
+    })
+}
+
+#[cfg(not(unix))]
+pub fn get_fd_limit() -> Option<FdLimit> {
+    None
+}
+
+/// Raises the soft `RLIMIT_NOFILE` to `soft`, which must not exceed the
+/// hard limit.
+#[cfg(unix)]
+pub fn set_fd_soft_limit(soft: u64, hard: u64) -> std::io::Result<()> {
+    let value = |v: u64| {
+        if v == u64::MAX {
+            libc::RLIM_INFINITY
+        } else {
+            v as libc::rlim_t
+        }
+    };
+    let rl = libc::rlimit {
+        rlim_cur: value(soft),
+        rlim_max: value(hard),
+    };
+    // SAFETY: setrlimit only reads the stack-local rlimit struct.
+    if unsafe { libc::setrlimit(libc::RLIMIT_NOFILE, &rl) } != 0 {
+        return Err(std::io::Error::last_os_error());
+    }
+    Ok(())
+}
+
 /// Gets the current resident memory (RSS) of the process in bytes.
 ///
 /// `/proc/self/statm` columns are documented in `man 5 proc`:
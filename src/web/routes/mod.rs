@@ -20,9 +20,11 @@ pub(crate) mod overview;
 pub(crate) mod pool_coordinator;
 pub(crate) mod pool_scaling;
 pub(crate) mod pools;
+pub(crate) mod pprof_proto;
 pub(crate) mod prepared;
 pub(crate) mod prepared_text;
 pub(crate) mod process;
+pub(crate) mod profile;
 pub(crate) mod query;
 pub(crate) mod servers;
 pub(crate) mod sockets;
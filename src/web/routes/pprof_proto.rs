@@ -0,0 +1,198 @@
+//! Encoder for the `profile.proto` format `go tool pprof` reads, enough
+//! for a CPU profile: sample types, samples, locations, functions and the
+//! string table. Written by hand so the `profiling` feature pulls in no
+//! protobuf crates.
+
+use std::collections::HashMap;
+
+/// One frame of a sampled stack.
+pub(crate) struct Frame<'a> {
+    pub(crate) name: &'a str,
+    pub(crate) file: &'a str,
+    pub(crate) line: u32,
+}
+
+/// A CPU profile being built, one sample per distinct stack.
+pub(crate) struct CpuProfile {
+    strings: Vec<String>,
+    string_ids: HashMap<String, u64>,
+    /// Function id per `(name, file)` string ids.
+    functions: HashMap<(u64, u64), u64>,
+    /// Location id per `(function id, line)`.
+    locations: HashMap<(u64, u32), u64>,
+    /// Encoded samples, locations and functions, in the order they came.
+    body: Vec<u8>,
+    period_ns: i64,
+}
+
+impl CpuProfile {
+    /// Profile sampled `frequency` times a second.
+    pub(crate) fn new(frequency: i32) -> CpuProfile {
+        let mut profile = CpuProfile {
+            strings: Vec::new(),
+            string_ids: HashMap::new(),
+            functions: HashMap::new(),
+            locations: HashMap::new(),
+            body: Vec::new(),
+            period_ns: 1_000_000_000 / i64::from(frequency.max(1)),
+        };
+        // The string table starts with "".
+        profile.string("");
+        profile
+    }
+
+    /// Add `count` samples of a stack, innermost frame first.
+    pub(crate) fn add_sample(&mut self, stack: &[Frame], count: i64) {
+        let mut location_ids = Vec::new();
+        for frame in stack {
+            let id = self.location(frame);
+            put_varint(&mut location_ids, id);
+        }
+        let mut values = Vec::new();
+        put_varint(&mut values, count as u64);
+        put_varint(&mut values, count.saturating_mul(self.period_ns) as u64);
+
+        let mut sample = Vec::new();
+        put_bytes(&mut sample, 1, &location_ids);
+        put_bytes(&mut sample, 2, &values);
+        put_bytes(&mut self.body, 2, &sample);
+    }
+
+    /// The encoded profile. `start_ns` is the Unix time the sampling
+    /// began at, `duration_ns` how long it ran.
+    pub(crate) fn finish(mut self, start_ns: i64, duration_ns: i64) -> Vec<u8> {
+        let samples = self.string("samples");
+        let count = self.string("count");
+        let cpu = self.string("cpu");
+        let nanoseconds = self.string("nanoseconds");
+
+        let mut out = Vec::with_capacity(self.body.len() + 256);
+        put_bytes(&mut out, 1, &value_type(samples, count));
+        put_bytes(&mut out, 1, &value_type(cpu, nanoseconds));
+        out.extend_from_slice(&self.body);
+        for string in &self.strings {
+            put_bytes(&mut out, 6, string.as_bytes());
+        }
+        put_uint(&mut out, 9, start_ns as u64);
+        put_uint(&mut out, 10, duration_ns as u64);
+        put_bytes(&mut out, 11, &value_type(cpu, nanoseconds));
+        put_uint(&mut out, 12, self.period_ns as u64);
+        out
+    }
+
+    fn string(&mut self, value: &str) -> u64 {
+        if let Some(id) = self.string_ids.get(value) {
+            return *id;
+        }
+        let id = self.strings.len() as u64;
+        self.strings.push(value.to_string());
+        self.string_ids.insert(value.to_string(), id);
+        id
+    }
+
+    fn function(&mut self, name: &str, file: &str) -> u64 {
+        let key = (self.string(name), self.string(file));
+        if let Some(id) = self.functions.get(&key) {
+            return *id;
+        }
+        let id = self.functions.len() as u64 + 1;
+        self.functions.insert(key, id);
+        let mut function = Vec::new();
+        put_uint(&mut function, 1, id);
+        put_uint(&mut function, 2, key.0);
+        put_uint(&mut function, 3, key.0);
+        put_uint(&mut function, 4, key.1);
+        put_bytes(&mut self.body, 5, &function);
+        id
+    }
+
+    fn location(&mut self, frame: &Frame) -> u64 {
+        let function = self.function(frame.name, frame.file);
+        if let Some(id) = self.locations.get(&(function, frame.line)) {
+            return *id;
+        }
+        let id = self.locations.len() as u64 + 1;
+        self.locations.insert((function, frame.line), id);
+        let mut line = Vec::new();
+        put_uint(&mut line, 1, function);
+        put_uint(&mut line, 2, u64::from(frame.line));
+        let mut location = Vec::new();
+        put_uint(&mut location, 1, id);
+        put_bytes(&mut location, 4, &line);
+        put_bytes(&mut self.body, 4, &location);
+        id
+    }
+}
+
+fn value_type(kind: u64, unit: u64) -> Vec<u8> {
+    let mut value_type = Vec::new();
+    put_uint(&mut value_type, 1, kind);
+    put_uint(&mut value_type, 2, unit);
+    value_type
+}
+
+fn put_varint(buf: &mut Vec<u8>, mut value: u64) {
+    while value >= 0x80 {
+        buf.push(value as u8 | 0x80);
+        value >>= 7;
+    }
+    buf.push(value as u8);
+}
+
+/// Varint field.
+fn put_uint(buf: &mut Vec<u8>, field: u64, value: u64) {
+    put_varint(buf, field << 3);
+    put_varint(buf, value);
+}
+
+/// Length-delimited field: a string, a message or a packed list.
+fn put_bytes(buf: &mut Vec<u8>, field: u64, bytes: &[u8]) {
+    put_varint(buf, (field << 3) | 2);
+    put_varint(buf, bytes.len() as u64);
+    buf.extend_from_slice(bytes);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn varint_encoding() {
+        let mut buf = Vec::new();
+        put_varint(&mut buf, 1);
+        put_varint(&mut buf, 300);
+        assert_eq!(buf, vec![0x01, 0xac, 0x02]);
+    }
+
+    #[test]
+    fn shared_frames_are_encoded_once() {
+        let mut profile = CpuProfile::new(100);
+        let main = Frame {
+            name: "main",
+            file: "src/main.rs",
+            line: 10,
+        };
+        let work = Frame {
+            name: "work",
+            file: "src/main.rs",
+            line: 20,
+        };
+        profile.add_sample(&[work, main], 3);
+        profile.add_sample(
+            &[Frame {
+                name: "main",
+                file: "src/main.rs",
+                line: 10,
+            }],
+            1,
+        );
+        assert_eq!(profile.functions.len(), 2);
+        assert_eq!(profile.locations.len(), 2);
+        assert_eq!(profile.strings, vec!["", "main", "src/main.rs", "work"]);
+        assert_eq!(profile.period_ns, 10_000_000);
+
+        let encoded = profile.finish(0, 1_000_000_000);
+        // The first field is the `samples`/`count` sample type.
+        assert_eq!(&encoded[..2], &[0x0a, 0x04]);
+    }
+}
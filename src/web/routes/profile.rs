@@ -0,0 +1,296 @@
+//! `GET /api/debug/pprof/profile?seconds=&frequency=&format=` and
+//! `GET /api/debug/pprof/heap` — CPU and heap profiles of the running
+//! process, Admin only.
+//!
+//! Bypass-routed in `web::server::http::handle_connection` like
+//! `/api/logs`: a CPU profile samples for `seconds` before answering, so
+//! the handler must `await` instead of blocking the sync router.
+//!
+//! Both profiles need a binary built with `--features profiling`, which
+//! links the sampling profiler and turns on jemalloc heap sampling at
+//! startup. Without it the endpoints answer 501.
+
+use std::collections::BTreeMap;
+use std::sync::atomic::{AtomicBool, Ordering};
+
+use crate::web::routes::query::{first, parse_u64};
+use crate::web::server::Response;
+
+/// Default CPU profile length, the same as Go's `net/http/pprof`.
+const DEFAULT_SECONDS: u64 = 30;
+
+/// Longest CPU profile. Sampling costs a few percent of CPU for the
+/// whole window and holds a blocking thread, so it stays bounded.
+const MAX_SECONDS: u64 = 300;
+
+/// Samples per second. 99 rather than 100 keeps the timer out of step
+/// with periodic work that fires on round intervals.
+const DEFAULT_FREQUENCY: u64 = 99;
+
+const MAX_FREQUENCY: u64 = 1000;
+
+/// One profile at a time: the CPU profiler is process-wide, and two
+/// overlapping heap dumps only double the work.
+static PROFILE_RUNNING: AtomicBool = AtomicBool::new(false);
+
+/// Clears `PROFILE_RUNNING` on every way out of a handler.
+struct RunningGuard;
+
+impl RunningGuard {
+    fn acquire() -> Option<Self> {
+        PROFILE_RUNNING
+            .compare_exchange(false, true, Ordering::AcqRel, Ordering::Acquire)
+            .ok()
+            .map(|_| RunningGuard)
+    }
+}
+
+impl Drop for RunningGuard {
+    fn drop(&mut self) {
+        PROFILE_RUNNING.store(false, Ordering::Release);
+    }
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq)]
+enum CpuFormat {
+    /// SVG flamegraph, opens in a browser.
+    Flamegraph,
+    /// Protobuf profile for `go tool pprof`.
+    Pprof,
+}
+
+fn parse_format(query: &BTreeMap<String, Vec<String>>) -> Option<CpuFormat> {
+    match first(query, "format").as_deref() {
+        None | Some("flamegraph") | Some("svg") => Some(CpuFormat::Flamegraph),
+        Some("pprof") | Some("proto") => Some(CpuFormat::Pprof),
+        Some(_) => None,
+    }
+}
+
+pub(crate) async fn handle_profile(path: &str, query: &BTreeMap<String, Vec<String>>) -> Response {
+    match path {
+        "/api/debug/pprof/profile" => handle_cpu_profile(query).await,
+        "/api/debug/pprof/heap" => handle_heap_profile().await,
+        _ => Response::status(404, "Not Found"),
+    }
+}
+
+async fn handle_cpu_profile(query: &BTreeMap<String, Vec<String>>) -> Response {
+    let seconds = parse_u64(query, "seconds", DEFAULT_SECONDS).clamp(1, MAX_SECONDS);
+    let frequency = parse_u64(query, "frequency", DEFAULT_FREQUENCY).clamp(1, MAX_FREQUENCY);
+    let Some(format) = parse_format(query) else {
+        return Response::json(
+            400,
+            "Bad Request",
+            r#"{"error":"bad_format","message":"format must be flamegraph or pprof"}"#,
+        );
+    };
+    let Some(guard) = RunningGuard::acquire() else {
+        return busy();
+    };
+    log::info!("CPU profile started: {seconds}s at {frequency} Hz, format {format:?}");
+
+    // The profiler guard is process-wide state driven by a signal
+    // timer; keep it and the symbolization that follows on one blocking
+    // thread instead of a runtime worker.
+    let result = tokio::task::spawn_blocking(move || {
+        let _guard = guard;
+        imp::cpu_profile(seconds, frequency as i32, format)
+    })
+    .await
+    .unwrap_or_else(|err| Err(format!("profiler task failed: {err}")));
+
+    match result {
+        Ok(body) => {
+            let content_type = match format {
+                CpuFormat::Flamegraph => "image/svg+xml",
+                CpuFormat::Pprof => "application/octet-stream",
+            };
+            binary(content_type, body)
+        }
+        Err(err) => failure(err),
+    }
+}
+
+async fn handle_heap_profile() -> Response {
+    let Some(guard) = RunningGuard::acquire() else {
+        return busy();
+    };
+    let result = tokio::task::spawn_blocking(move || {
+        let _guard = guard;
+        imp::heap_profile()
+    })
+    .await
+    .unwrap_or_else(|err| Err(format!("heap dump task failed: {err}")));
+
+    match result {
+        Ok(body) => binary("application/octet-stream", body),
+        Err(err) => failure(err),
+    }
+}
+
+fn binary(content_type: &'static str, body: Vec<u8>) -> Response {
+    Response {
+        status: 200,
+        reason: "OK",
+        extra_headers: vec![
+            ("Content-Type", content_type.into()),
+            ("Cache-Control", "no-store".into()),
+        ],
+        body,
+    }
+}
+
+fn busy() -> Response {
+    Response::json(
+        409,
+        "Conflict",
+        r#"{"error":"profile_running","message":"another profile is being captured"}"#,
+    )
+}
+
+fn failure(err: String) -> Response {
+    if !imp::ENABLED {
+        return Response::json(
+            501,
+            "Not Implemented",
+            r#"{"error":"profiling_disabled","message":"pg_doorman was built without the profiling feature"}"#,
+        );
+    }
+    log::warn!("Profile capture failed: {err}");
+    let body = serde_json::json!({ "error": "profile_failed", "message": err });
+    Response::json(500, "Internal Server Error", &body.to_string())
+}
+
+#[cfg(feature = "profiling")]
+mod imp {
+    use std::ffi::CString;
+    use std::os::unix::ffi::OsStrExt;
+    use std::time::{Duration, SystemTime};
+
+    use super::CpuFormat;
+    use crate::web::routes::pprof_proto::{CpuProfile, Frame};
+
+    pub(super) const ENABLED: bool = true;
+
+    pub(super) fn cpu_profile(
+        seconds: u64,
+        frequency: i32,
+        format: CpuFormat,
+    ) -> Result<Vec<u8>, String> {
+        let guard = pprof::ProfilerGuardBuilder::default()
+            .frequency(frequency)
+            .blocklist(&["libc", "libgcc", "pthread", "vdso"])
+            .build()
+            .map_err(|err| format!("failed to start CPU profiler: {err}"))?;
+        let started_at = SystemTime::now();
+        std::thread::sleep(Duration::from_secs(seconds));
+        let report = guard
+            .report()
+            .build()
+            .map_err(|err| format!("failed to build CPU profile: {err}"))?;
+        drop(guard);
+
+        let mut body = Vec::new();
+        match format {
+            CpuFormat::Flamegraph => report
+                .flamegraph(&mut body)
+                .map_err(|err| format!("failed to render flamegraph: {err}"))?,
+            CpuFormat::Pprof => {
+                let mut profile = CpuProfile::new(frequency);
+                for (frames, count) in &report.data {
+                    let symbols: Vec<(String, String, u32)> = frames
+                        .frames
+                        .iter()
+                        .flatten()
+                        .map(|symbol| {
+                            (
+                                symbol.name(),
+                                symbol.filename().into_owned(),
+                                symbol.lineno(),
+                            )
+                        })
+                        .collect();
+                    let stack: Vec<Frame> = symbols
+                        .iter()
+                        .map(|(name, file, line)| Frame {
+                            name,
+                            file,
+                            line: *line,
+                        })
+                        .collect();
+                    profile.add_sample(&stack, *count as i64);
+                }
+                let start_ns = started_at
+                    .duration_since(SystemTime::UNIX_EPOCH)
+                    .unwrap_or_default()
+                    .as_nanos() as i64;
+                let duration_ns = Duration::from_secs(seconds).as_nanos() as i64;
+                body = profile.finish(start_ns, duration_ns);
+            }
+        }
+        Ok(body)
+    }
+
+    /// Live heap sampled by jemalloc since startup, in the format `jeprof`
+    /// reads. jemalloc only dumps to a file, so the dump goes through the
+    /// temp directory.
+    pub(super) fn heap_profile() -> Result<Vec<u8>, String> {
+        // SAFETY: `opt.prof` is a read-only bool.
+        let enabled = unsafe { tikv_jemalloc_ctl::raw::read::<bool>(b"opt.prof\0") }
+            .map_err(|err| format!("jemalloc heap profiling is unavailable: {err}"))?;
+        if !enabled {
+            return Err("jemalloc heap profiling is off (opt.prof=false)".to_string());
+        }
+        let path = std::env::temp_dir().join(format!("pg_doorman.{}.heap", std::process::id()));
+        let c_path = CString::new(path.as_os_str().as_bytes())
+            .map_err(|err| format!("bad heap dump path {}: {err}", path.display()))?;
+        // SAFETY: `prof.dump` takes a NUL-terminated path, which `c_path`
+        // keeps alive for the duration of the call.
+        unsafe { tikv_jemalloc_ctl::raw::write(b"prof.dump\0", c_path.as_ptr()) }
+            .map_err(|err| format!("jemalloc prof.dump failed: {err}"))?;
+        let body = std::fs::read(&path)
+            .map_err(|err| format!("failed to read heap dump {}: {err}", path.display()));
+        let _ = std::fs::remove_file(&path);
+        body
+    }
+}
+
+#[cfg(not(feature = "profiling"))]
+mod imp {
+    use super::CpuFormat;
+
+    pub(super) const ENABLED: bool = false;
+
+    pub(super) fn cpu_profile(_: u64, _: i32, _: CpuFormat) -> Result<Vec<u8>, String> {
+        Err("built without the profiling feature".to_string())
+    }
+
+    pub(super) fn heap_profile() -> Result<Vec<u8>, String> {
+        Err("built without the profiling feature".to_string())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::web::routes::query::parse_query;
+
+    #[test]
+    fn format_defaults_to_flamegraph() {
+        assert_eq!(parse_format(&parse_query("")), Some(CpuFormat::Flamegraph));
+        assert_eq!(
+            parse_format(&parse_query("format=pprof")),
+            Some(CpuFormat::Pprof)
+        );
+        assert_eq!(parse_format(&parse_query("format=png")), None);
+    }
+
+    #[test]
+    fn only_one_profile_at_a_time() {
+        let first = RunningGuard::acquire().expect("first profile");
+        assert!(RunningGuard::acquire().is_none());
+        drop(first);
+        assert!(RunningGuard::acquire().is_some());
+    }
+}
@@ -138,6 +138,22 @@ pub(super) async fn handle_connection(stream: TcpStream, opts: Arc<WebServerOpti
                 let query = crate::web::routes::query::parse_query(parsed.query.unwrap_or(""));
                 crate::web::routes::logs::handle_logs(&query).await
             }
+        } else if opts.ui_active
+            && parsed.method == "GET"
+            && parsed.path.starts_with("/api/debug/pprof/")
+        {
+            // Profiles sample for up to minutes before answering and can
+            // reveal SQL text held in memory: Admin only.
+            if !matches!(auth, AuthOutcome::Admin(_)) {
+                if matches!(auth, AuthOutcome::Sso(_)) {
+                    Response::forbidden("admin role required")
+                } else {
+                    unauthorized_for(&parsed)
+                }
+            } else {
+                let query = crate::web::routes::query::parse_query(parsed.query.unwrap_or(""));
+                crate::web::routes::profile::handle_profile(parsed.path, &query).await
+            }
         } else if opts.ui_active
             && parsed.method == "POST"
             && parsed.path.starts_with("/api/admin/")
@@ -9,8 +9,9 @@ use crate::web::routes::query::parse_query;
 use super::state::WebServerOptions;
 use super::wire::{ParsedRequest, Response};
 
-/// Mutating endpoints. Only Admin (Basic) may call them.
-const MANAGEMENT_PREFIXES: &[&str] = &["/api/admin/"];
+/// Mutating endpoints and CPU/heap profiles. Only Admin (Basic) may call
+/// them.
+const MANAGEMENT_PREFIXES: &[&str] = &["/api/admin/", "/api/debug/"];
 
 /// Read-only endpoints that expose personal data — SQL text, logs, top
 /// queries. Sso role and Admin role may call them; Anonymous cannot
@@ -387,6 +387,7 @@ fn dispatch_returns_404_for_unknown_asset_when_index_missing() {
 fn required_role_admin_for_management() {
     assert_eq!(required_role("/api/admin/reload", true), Role::Admin);
     assert_eq!(required_role("/api/admin/pause", false), Role::Admin);
+    assert_eq!(required_role("/api/debug/pprof/profile", true), Role::Admin);
 }
 
 #[test]
@@ -912,6 +912,23 @@ pub async fn overwrite_config_file(world: &mut DoormanWorld, step: &Step) {
     std::fs::write(config_file.path(), content).expect("Failed to overwrite config file");
 }
 
+/// Overwrite the pg_doorman hba file with new rules
+#[when("we overwrite pg_doorman hba file with:")]
+pub async fn overwrite_hba_file(world: &mut DoormanWorld, step: &Step) {
+    let content = step
+        .docstring
+        .as_ref()
+        .expect("hba content not found in docstring")
+        .to_string();
+
+    let hba_file = world
+        .doorman_hba_file
+        .as_ref()
+        .expect("pg_doorman hba file not found");
+
+    std::fs::write(hba_file.path(), content).expect("Failed to overwrite hba file");
+}
+
 /// Overwrite the pg_doorman config file with new invalid content
 #[when("we overwrite pg_doorman config file with invalid content:")]
 pub async fn overwrite_config_with_invalid(world: &mut DoormanWorld, step: &Step) {
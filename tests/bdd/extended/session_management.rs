@@ -337,6 +337,52 @@ pub async fn create_named_session(
     world.named_sessions.insert(session_name, conn);
 }
 
+/// Log in expecting pg_doorman to refuse the client: the messages up to its
+/// ErrorResponse are kept for the `should receive error` steps.
+#[when(
+    regex = r#"^we create session "([^"]+)" to pg_doorman as "([^"]+)" and database "([^"]+)" expecting login error$"#
+)]
+pub async fn create_named_session_expecting_login_error(
+    world: &mut DoormanWorld,
+    session_name: String,
+    user: String,
+    database: String,
+) {
+    let doorman_port = world.doorman_port.expect("pg_doorman not started");
+    let doorman_addr = format!("127.0.0.1:{}", doorman_port);
+
+    let mut conn = PgConnection::connect(&doorman_addr)
+        .await
+        .expect("Failed to connect to pg_doorman");
+    conn.send_startup(&user, &database)
+        .await
+        .expect("Failed to send startup to pg_doorman");
+
+    let mut messages = Vec::new();
+    loop {
+        let (msg_type, data) = conn
+            .read_message()
+            .await
+            .expect("Connection closed before an ErrorResponse");
+        match msg_type {
+            'E' => {
+                messages.push((msg_type, data));
+                break;
+            }
+            'R' => {
+                let auth_type = i32::from_be_bytes([data[0], data[1], data[2], data[3]]);
+                panic!(
+                    "Session '{}' was asked to authenticate (type {}) instead of refused",
+                    session_name, auth_type
+                );
+            }
+            _ => messages.push((msg_type, data)),
+        }
+    }
+
+    world.session_messages.insert(session_name, messages);
+}
+
 /// Create a session with extra StartupMessage parameters.
 /// `extras` is a comma-separated list of `key=value` pairs.
 #[when(
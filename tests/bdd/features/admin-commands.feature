@@ -35,19 +35,22 @@ Feature: Admin console SHOW commands
     Then admin session "admin" row count should be greater than or equal to <min_rows>
 
     Examples:
-      | command        | min_rows |
-      | config         | 1        |
-      | databases      | 1        |
-      | lists          | 1        |
-      | pools          | 1        |
-      | pools_extended | 1        |
-      | clients        | 1        |
-      | servers        | 0        |
-      | connections    | 1        |
-      | stats          | 1        |
-      | version        | 1        |
-      | users          | 1        |
-      | log_level      | 1        |
+      | command               | min_rows |
+      | config                | 1        |
+      | databases             | 1        |
+      | lists                 | 1        |
+      | pools                 | 1        |
+      | pools_extended        | 1        |
+      | clients               | 1        |
+      | servers               | 0        |
+      | connections           | 1        |
+      | stats                 | 1        |
+      | version               | 1        |
+      | users                 | 1        |
+      | log_level             | 1        |
+      | features              | 2        |
+      | prepared_transactions | 0        |
+      | buffer_pool           | 4        |
 
   @admin-commands-sockets
   Scenario: SHOW SOCKETS does not crash (Linux only)
@@ -87,6 +90,25 @@ Feature: Admin console SHOW commands
     When we create admin session "admin" to pg_doorman as "admin" with password "admin"
     And we execute "set log_level = 'garbage'" on admin session "admin" expecting possible error
 
+  @admin-commands-set-feature
+  Scenario: SET FEATURE switches a feature flag until it is set back to default
+    When we create admin session "admin" to pg_doorman as "admin" with password "admin"
+    And we execute "show features" on admin session "admin" and store response
+    Then admin session "admin" response should contain "direct_tls|on|default"
+    When we execute "set feature direct_tls = off" on admin session "admin"
+    And we execute "show features" on admin session "admin" and store response
+    Then admin session "admin" response should contain "direct_tls|off|runtime"
+    And admin session "admin" response should contain "adaptive_pool_sizing|on|default"
+    When we execute "set feature direct_tls = default" on admin session "admin"
+    And we execute "show features" on admin session "admin" and store response
+    Then admin session "admin" response should contain "direct_tls|on|default"
+
+  @admin-commands-set-feature-unknown
+  Scenario: SET FEATURE rejects an unknown feature
+    When we create admin session "admin" to pg_doorman as "admin" with password "admin"
+    And we execute "set feature turbo = on" on admin session "admin" and store response
+    Then admin session "admin" response should contain "unknown feature turbo"
+
   @admin-commands-tab-completion
   Scenario: pg_settings queries return results for psql tab-completion
     When we create admin session "admin" to pg_doorman as "admin" with password "admin"
@@ -0,0 +1,76 @@
+@rust @rust-4 @admin-hold
+Feature: Admin HOLD command
+  HOLD queues new transactions of a pool, beyond query_wait_timeout, until
+  RESUME or hold_timeout, so a backend switchover produces no client errors.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+      query_wait_timeout = 500
+      hold_timeout = 3000
+      server_lifetime = 60000
+      server_idle_check_timeout = 0
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+      """
+
+  @hold-resume
+  Scenario: Queued transactions outlast query_wait_timeout and run on RESUME
+    When we create session "s1" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT 1" to session "s1" and store backend_pid
+    When we create admin session "admin1" to pg_doorman as "admin" with password "admin"
+    And we execute "HOLD example_db" on admin session "admin1" and store response
+    Then admin session "admin1" response should contain "HOLD"
+    When we execute "SHOW POOLS" on admin session "admin1" and store response
+    Then admin session "admin1" column "paused" should be between 1 and 1
+    # Queued for twice query_wait_timeout without an error
+    When we send SimpleQuery "SELECT 1" to session "s1" without waiting
+    And we sleep 1000ms
+    And we execute "RESUME example_db" on admin session "admin1" and store response
+    Then admin session "admin1" response should contain "RESUME"
+    Then we read SimpleQuery response from session "s1" within 1000ms
+    And session "s1" should receive DataRow with "1"
+
+  @hold-expires
+  Scenario: The hold ends by itself after hold_timeout
+    When we create session "s1" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT 1" to session "s1" and store backend_pid
+    When we create admin session "admin1" to pg_doorman as "admin" with password "admin"
+    And we execute "HOLD example_db" on admin session "admin1" and store response
+    Then admin session "admin1" response should contain "HOLD"
+    When we send SimpleQuery "SELECT 1" to session "s1" without waiting
+    Then we read SimpleQuery response from session "s1" within 5000ms
+    And session "s1" should receive DataRow with "1"
+    When we execute "SHOW POOLS" on admin session "admin1" and store response
+    Then admin session "admin1" column "paused" should be between 0 and 0
+
+  @hold-waits-for-in-flight
+  Scenario: HOLD fails when an in-flight transaction outlasts hold_timeout
+    When we create session "s1" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "BEGIN" to session "s1" and store response
+    When we create admin session "admin1" to pg_doorman as "admin" with password "admin"
+    And we execute "HOLD example_db" on admin session "admin1" and store response
+    Then admin session "admin1" response should contain "in-flight transactions did not finish"
+    # The open transaction was never interrupted
+    When we send SimpleQuery "COMMIT" to session "s1" and store response
+    And we execute "HOLD nonexistent_db" on admin session "admin1" and store response
+    Then admin session "admin1" response should contain "No pool for database"
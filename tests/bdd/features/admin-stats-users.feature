@@ -0,0 +1,56 @@
+@rust @rust-2 @admin-stats-users
+Feature: Read-only admin access for stats_users
+  A user listed in stats_users logs in to the admin console with its own
+  password and may run SHOW commands only.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      stats_users = ["stats_reader"]
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+
+      [[pools.example_db.users]]
+      username = "stats_reader"
+      password = "md5650bffd8ae2286776fa590f702c05e9d"
+      pool_size = 1
+      """
+
+  @admin-stats-users-show
+  Scenario: A stats user runs SHOW
+    When I run shell command:
+      """
+      PGPASSWORD=statspass psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U stats_reader -d pgdoorman -c "SHOW VERSION" 2>&1
+      """
+    Then the command output should contain "PgDoorman"
+    And the command output should not contain "ERROR"
+
+  @admin-stats-users-refused
+  Scenario: A stats user is refused PAUSE, RELOAD and SET with 42501
+    When I run shell command:
+      """
+      for command in "PAUSE" "RELOAD" "SET log_level = 'debug'"; do
+        echo "$command -> $(PGPASSWORD=statspass psql -v VERBOSITY=verbose -h 127.0.0.1 -p ${DOORMAN_PORT} -U stats_reader -d pgdoorman -c "$command" 2>&1)"
+      done
+      """
+    Then the command output should contain "PAUSE -> ERROR:  42501: permission denied: stats users may only run SHOW commands"
+    And the command output should contain "RELOAD -> ERROR:  42501: permission denied"
+    And the command output should contain "SET log_level = 'debug' -> ERROR:  42501: permission denied"
@@ -0,0 +1,64 @@
+@rust @rust-3 @auto-session-pinning
+Feature: Automatic session pinning in transaction mode
+  A statement that leaves backend-local state behind (temporary table,
+  session advisory lock, cursor WITH HOLD) pins the client to its backend
+  for the rest of the session. The backend is cleaned with DISCARD ALL when
+  the pinned client disconnects.
+
+  Background:
+    Given PostgreSQL started with options "-c log_statement=all -c logging_collector=off" and pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 2
+      """
+
+  @auto-session-pinning-temp-table
+  Scenario: temporary table keeps the client on its backend
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we create session "two" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "CREATE TEMP TABLE pinned_t (id int)" to session "one"
+    And we send SimpleQuery "SELECT pg_backend_pid()" to session "one" and store backend_pid as "pinned"
+    And we send SimpleQuery "SELECT pg_backend_pid()" to session "two" and store backend_pid
+    And we send SimpleQuery "INSERT INTO pinned_t VALUES (1)" to session "one"
+    And we send SimpleQuery "SELECT pg_backend_pid()" to session "one" and store backend_pid as "pinned_again"
+    And we send SimpleQuery "SELECT pg_backend_pid()" to session "one" and store backend_pid
+    Then named backend_pid "pinned_again" from session "one" is same as "pinned"
+    And backend_pid from session "two" should not equal backend_pid from session "one"
+    And pg_doorman log contains "until disconnect: temporary table"
+
+  @auto-session-pinning-discard-on-disconnect
+  Scenario: pinned backend is discarded when the client disconnects
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT pg_advisory_lock(4242)" to session "one"
+    And we sleep 100ms
+    When we truncate PostgreSQL log
+    And we close session "one"
+    And we sleep 300ms
+    Then PostgreSQL log should contain "DISCARD ALL"
+
+  @auto-session-pinning-on-commit-drop
+  Scenario: ON COMMIT DROP temporary table does not pin
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "BEGIN; CREATE TEMP TABLE tx_t (id int) ON COMMIT DROP; COMMIT" to session "one"
+    And we sleep 100ms
+    Then pg_doorman log does not contain "until disconnect"
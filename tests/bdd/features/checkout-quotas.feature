@@ -0,0 +1,62 @@
+@rust @rust-2 @checkout-quotas
+Feature: Checkout quotas
+  A pool caps the backends the clients of one application_name or one tag
+  hold at once; a client over its quota waits within query_wait_timeout.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+      client_tag_parameter = "doorman.tag"
+      query_wait_timeout = "500ms"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      application_name_checkout_limits = { "reporting" = 1 }
+      tag_checkout_limits = { "batch" = 1 }
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+      """
+
+  @checkout-quotas-application-name
+  Scenario: An application over its quota times out while others get a server
+    When I run shell command:
+      """
+      PGAPPNAME=reporting psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT pg_sleep(3)" >/dev/null 2>&1 &
+      sleep 1
+      PGAPPNAME=reporting psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'second report'" 2>&1
+      PGAPPNAME=api psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'api client'" 2>&1
+      wait
+      """
+    Then the command output should contain "already hold 1 server connections of pool example_db (checkout limit)"
+    And the command output should not contain "second report"
+    And the command output should contain "api client"
+
+  @checkout-quotas-tag
+  Scenario: A tag over its quota times out and its slot comes back with the server
+    When I run shell command:
+      """
+      PGOPTIONS='-c doorman.tag=batch' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT pg_sleep(2)" >/dev/null 2>&1 &
+      sleep 1
+      PGOPTIONS='-c doorman.tag=batch' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'second batch'" 2>&1
+      wait
+      PGOPTIONS='-c doorman.tag=batch' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'batch after release'" 2>&1
+      """
+    Then the command output should contain "already hold 1 server connections of pool example_db (checkout limit)"
+    And the command output should not contain "second batch"
+    And the command output should contain "batch after release"
@@ -205,3 +205,36 @@ Feature: Client session reset batch suppresses doorman-side cleanup
     # Neither the client nor pg_doorman issued DEALLOCATE ALL.
     And PostgreSQL log should contain exactly 0 occurrences of "DEALLOCATE ALL"
     And PostgreSQL log should not contain "RESET ROLE"
+
+  @client-session-reset-cleanup-rolled-back-savepoint
+  Scenario: SET inside a rolled back savepoint does not arm the checkin cleanup
+    When we create session "nine" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT 1" to session "nine"
+    And we sleep 100ms
+    When we truncate PostgreSQL log
+    # ROLLBACK TO undoes both GUC changes, so the session is clean on COMMIT.
+    And we send SimpleQuery "BEGIN; SAVEPOINT s1; SET LOCAL statement_timeout = 1000; SET work_mem = '8MB'; ROLLBACK TO SAVEPOINT s1; COMMIT" to session "nine"
+    And we sleep 300ms
+    Then PostgreSQL log should not contain "RESET ROLE"
+    And PostgreSQL log should contain exactly 0 occurrences of "RESET ALL"
+
+  @client-session-reset-cleanup-rolled-back-transaction
+  Scenario: SET inside a rolled back transaction does not arm the checkin cleanup
+    When we create session "ten" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT 1" to session "ten"
+    And we sleep 100ms
+    When we truncate PostgreSQL log
+    And we send SimpleQuery "BEGIN; SET work_mem = '8MB'; ROLLBACK" to session "ten"
+    And we sleep 300ms
+    Then PostgreSQL log should not contain "RESET ROLE"
+
+  @client-session-reset-cleanup-released-savepoint
+  Scenario: SET inside a released savepoint still arms the checkin cleanup
+    When we create session "eleven" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "SELECT 1" to session "eleven"
+    And we sleep 100ms
+    When we truncate PostgreSQL log
+    And we send SimpleQuery "BEGIN; SAVEPOINT s1; SET work_mem = '8MB'; RELEASE SAVEPOINT s1; COMMIT" to session "eleven"
+    And we sleep 300ms
+    Then PostgreSQL log should contain exactly 1 occurrences of "RESET ALL"
+    And PostgreSQL log should contain "RESET ROLE"
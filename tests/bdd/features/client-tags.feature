@@ -0,0 +1,56 @@
+@rust @rust-2 @client-tags
+Feature: Client tags
+  Clients tag their connection with client_tag_parameter; a pool caps the
+  clients of a tag with client_tag_limits.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+      client_tag_parameter = "doorman.tag"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      client_tag_limits = { "batch" = 1 }
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+      """
+
+  @client-tags-limit
+  Scenario: A tag over its limit is refused while other clients get in
+    When I run shell command:
+      """
+      PGOPTIONS='-c doorman.tag=batch' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT pg_sleep(3)" >/dev/null 2>&1 &
+      sleep 1
+      PGOPTIONS='-c doorman.tag=batch' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'second batch'" 2>&1
+      PGOPTIONS='-c doorman.tag=web' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'web client'" 2>&1
+      psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 'untagged client'" 2>&1
+      wait
+      """
+    Then the command output should contain "too many clients with tag"
+    And the command output should not contain "second batch"
+    And the command output should contain "web client"
+    And the command output should contain "untagged client"
+
+  @client-tags-invalid
+  Scenario: A malformed tag closes the connection
+    When I run shell command:
+      """
+      PGOPTIONS='-c doorman.tag=bad/tag' psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 1" 2>&1
+      """
+    Then the command output should contain "invalid doorman.tag"
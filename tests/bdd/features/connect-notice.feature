@@ -0,0 +1,82 @@
+@rust @rust-1 @connect-notice
+Feature: connect_notice banner
+  Clients get a NoticeResponse naming the pooler, pool and mode right
+  after login; a pool can replace or turn off the general notice.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+      connect_notice = "connected via pg_doorman, pool {database}, {pool_mode} mode, user {user} from {client_ip}"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      server_database = "example_db"
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+
+      [pools.quiet_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      server_database = "example_db"
+      pool_mode = "session"
+      connect_notice = ""
+
+      [[pools.quiet_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+
+      [pools.replica_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      server_database = "example_db"
+      pool_mode = "session"
+      connect_notice = "pool {database} ({pool_mode}) is a read-only replica"
+
+      [[pools.replica_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 5
+      """
+
+  @connect-notice-general
+  Scenario: The general notice is rendered for the client's connection
+    When I run shell command:
+      """
+      psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -c "SELECT 1" 2>&1
+      """
+    Then the command should succeed
+    And the command output should contain "NOTICE:  connected via pg_doorman, pool example_db, transaction mode, user example_user_1 from 127.0.0.1"
+
+  @connect-notice-pool
+  Scenario: A pool replaces or disables the general notice
+    When I run shell command:
+      """
+      psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d replica_db -c "SELECT 1" 2>&1
+      """
+    Then the command should succeed
+    And the command output should contain "NOTICE:  pool replica_db (session) is a read-only replica"
+    And the command output should not contain "connected via pg_doorman"
+    When I run shell command:
+      """
+      psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d quiet_db -c "SELECT 1" 2>&1
+      """
+    Then the command should succeed
+    And the command output should not contain "NOTICE"
@@ -105,3 +105,30 @@ Feature: DEALLOCATE clears client prepared statements cache
     And we send Execute "" to session "one"
     And we send Sync to session "one"
     Then session "one" should receive DataRow with "10"
+
+  Scenario: DISCARD ALL clears client cache without reaching the backend
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send Parse "discard_stmt" with query "select $1::int + 1" to session "one"
+    And we send Sync to session "one"
+    And we send Bind "" to "discard_stmt" with params "5" to session "one"
+    And we send Execute "" to session "one"
+    And we send Sync to session "one"
+    Then session "one" should receive DataRow with "6"
+    When we send SimpleQuery "DISCARD ALL" to session "one"
+    # Re-create with different query
+    And we send Parse "discard_stmt" with query "select $1::int * 3" to session "one"
+    And we send Sync to session "one"
+    And we send Bind "" to "discard_stmt" with params "5" to session "one"
+    And we send Execute "" to session "one"
+    And we send Sync to session "one"
+    Then session "one" should receive DataRow with "15"
+
+  Scenario: DISCARD PLANS keeps client prepared statements
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send Parse "plans_stmt" with query "select $1::int + 7" to session "one"
+    And we send Sync to session "one"
+    When we send SimpleQuery "discard plans" to session "one"
+    And we send Bind "" to "plans_stmt" with params "1" to session "one"
+    And we send Execute "" to session "one"
+    And we send Sync to session "one"
+    Then session "one" should receive DataRow with "8"
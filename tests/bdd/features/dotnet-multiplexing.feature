@@ -0,0 +1,45 @@
+@dotnet @dotnet-multiplexing
+Feature: .NET Npgsql multiplexing
+  Npgsql multiplexing interleaves the commands of many logical connections
+  on a few physical ones and recycles its auto-prepared _autoN statements
+  with Close and Parse of the same names. Every command must still get its
+  own result, and Close-only batches must not break the connection.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      connect_timeout = 5000
+      admin_username = "admin"
+      admin_password = "admin"
+      prepared_statements = true
+      prepared_statements_cache_size = 10000
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+      pool_size = 4
+      """
+
+  Scenario: Multiplexed commands with auto-prepare recycling
+    When I run shell command:
+      """
+      export DATABASE_URL="Host=127.0.0.1;Port=${DOORMAN_PORT};Database=example_db;Username=example_user_1;Password=test"
+      tests/dotnet/run_test.sh multiplexing multiplexing.cs
+      """
+    Then the command should succeed
+    And the command output should contain "multiplexing complete"
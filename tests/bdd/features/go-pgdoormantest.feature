@@ -0,0 +1,24 @@
+@go @go-pgdoormantest
+Feature: pgdoormantest helper module
+  The Go module tests/go/pgdoormantest starts its own pg_doorman in front
+  of PostgreSQL and talks to it with the raw-protocol helpers.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+
+  Scenario: pg_doorman started by the helper serves queries and cancels
+    When I run shell command:
+      """
+      export PG_DOORMAN_BINARY="${DOORMAN_BINARY}"
+      export PG_PORT="${PG_PORT}"
+      cd tests/go/pgdoormantest && go test -v -count=1 ./...
+      """
+    Then the command should succeed
+    And the command output should contain "PASS: TestStart"
+    And the command output should contain "PASS: TestLoginAndQuery"
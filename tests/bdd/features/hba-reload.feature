@@ -0,0 +1,60 @@
+@rust @rust-2 @hba @hba-reload
+Feature: RELOAD HBA
+  RELOAD HBA reads the pg_hba file again and swaps in only its rules.
+  A file that does not load is reported and the rules in use are kept.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman hba file contains:
+      """
+      host all example_user_nopassword 127.0.0.1/32 trust
+      """
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      pg_hba = {path = "${DOORMAN_HBA_FILE}"}
+      admin_username = "admin"
+      admin_password = "admin"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "session"
+
+      [[pools.example_db.users]]
+      username = "example_user_nopassword"
+      password = ""
+      pool_size = 10
+      """
+
+  Scenario: A file with a bad rule is rejected and the old rules stay
+    Then psql connection to pg_doorman as user "example_user_nopassword" to database "example_db" without password succeeds
+    When we overwrite pg_doorman hba file with:
+      """
+      host all example_user_nopassword 127.0.0.1/32 reject
+      hots all all 127.0.0.1/32 trust
+      """
+    And we create admin session "adm1" to pg_doorman as "admin" with password "admin"
+    And we execute "RELOAD HBA" on admin session "adm1" and store response
+    Then admin session "adm1" response should contain "unknown connection type"
+    And psql connection to pg_doorman as user "example_user_nopassword" to database "example_db" without password succeeds
+
+  Scenario: A valid file replaces the rules for new connections
+    When we overwrite pg_doorman hba file with:
+      """
+      # example_user_nopassword is no longer admitted
+      host all example_user_nopassword 127.0.0.1/32 reject
+      """
+    And we create admin session "adm1" to pg_doorman as "admin" with password "admin"
+    And we execute "RELOAD HBA" on admin session "adm1" and store response
+    Then admin session "adm1" response should not contain "ERROR"
+    And admin session "adm1" response should contain "RELOAD"
+    And psql connection to pg_doorman as user "example_user_nopassword" to database "example_db" without password fails
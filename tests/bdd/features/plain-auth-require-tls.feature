@@ -0,0 +1,54 @@
+@rust @rust-2 @plain-auth-require-tls
+Feature: Cleartext logins only over TLS
+  With general.plain_auth_require_tls on, a login that would send its
+  secret in clear text (PAM, JWT, Talos) is refused on plain TCP with
+  SQLSTATE 28000 before the client is asked for the secret. Over TLS the
+  login goes on as usual.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And self-signed SSL certificates are generated
+    When I run shell command:
+      """
+      openssl rsa -in ${DOORMAN_SSL_KEY} -pubout -out ${DOORMAN_SSL_KEY}.pub 2>&1
+      """
+    Then the command should succeed
+    Given pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      plain_auth_require_tls = true
+      tls_private_key = "${DOORMAN_SSL_KEY}"
+      tls_certificate = "${DOORMAN_SSL_CERT}"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "jwt-pkey-fpath:${DOORMAN_SSL_KEY}.pub"
+      pool_size = 1
+      """
+
+  @plain-auth-require-tls-refused
+  Scenario: A JWT login over plain TCP is refused with 28000
+    When we create session "plain" to pg_doorman as "example_user_1" and database "example_db" expecting login error
+    Then session "plain" should receive error containing "allowed only over TLS" with code "28000"
+
+  @plain-auth-require-tls-allowed
+  Scenario: A JWT login over TLS is asked for its token
+    When I run shell command:
+      """
+      PGPASSWORD=not-a-token psql "host=127.0.0.1 port=${DOORMAN_PORT} user=example_user_1 dbname=example_db sslmode=require" -c "SELECT 1" 2>&1
+      """
+    Then the command output should contain "JWT token validation failed"
+    And the command output should not contain "allowed only over TLS"
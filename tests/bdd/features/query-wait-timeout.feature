@@ -45,3 +45,5 @@ Feature: Query wait timeout when pool is exhausted
     When we create session "four" to pg_doorman as "example_user_1" with password "" and database "example_db"
     And we send SimpleQuery "select 1" to session "four" expecting error
     Then session "four" should receive error containing "timeout"
+    And session "four" should receive error containing "pool example_db user example_user_1" with code "53300"
+    And session "four" should receive error containing "pool size 3/3"
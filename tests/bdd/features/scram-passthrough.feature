@@ -0,0 +1,41 @@
+@static-passthrough @scram-passthrough
+Feature: SCRAM passthrough without a stored verifier
+
+  A user with password "scram-passthrough" has no hash in the config:
+  pg_doorman relays the client's SCRAM exchange to PostgreSQL and the
+  backend connection the client logged in on serves the pool.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             postgres        127.0.0.1/32            trust
+      host    all             all             127.0.0.1/32            scram-sha-256
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/static_passthrough_fixture.sql" applied
+    Given pg_doorman started with config:
+      """
+      general:
+        host: "127.0.0.1"
+        port: ${DOORMAN_PORT}
+        connect_timeout: 5000
+        admin_username: "admin"
+        admin_password: "admin"
+      pools:
+        postgres:
+          server_host: "127.0.0.1"
+          server_port: ${PG_PORT}
+          pool_mode: "transaction"
+          users:
+            - username: "pt_static_scram"
+              password: "scram-passthrough"
+              pool_size: 5
+      """
+
+  Scenario: PostgreSQL checks the password and the login serves queries
+    Then psql query "SELECT current_user" via pg_doorman as user "pt_static_scram" to database "postgres" with password "scrampass" returns "pt_static_scram"
+    Then psql query "SELECT current_user" via pg_doorman as user "pt_static_scram" to database "postgres" with password "scrampass" returns "pt_static_scram"
+
+  Scenario: A wrong password is refused by PostgreSQL
+    Then psql connection to pg_doorman as user "pt_static_scram" to database "postgres" with password "wrongpass" fails
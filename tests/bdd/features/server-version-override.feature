@@ -0,0 +1,54 @@
+@rust @rust-2 @server-version-override
+Feature: Per-pool server_version override
+  A pool with server_version set reports that value to clients in the
+  login ParameterStatus and in SHOW server_version answered locally.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman hba file contains:
+      """
+      host all example_user_1 127.0.0.1/32 md5
+      """
+
+  Scenario: clients see the configured server_version
+    Given pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      pg_hba = {path = "${DOORMAN_HBA_FILE}"}
+      admin_username = "admin"
+      admin_password = "admin"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+      server_version = "14.99"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+      pool_size = 2
+      """
+    When I run shell command:
+      """
+      export PGPASSWORD=test
+      PSQL="psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -tA"
+
+      REPORTED=$($PSQL -c '\echo :SERVER_VERSION_NAME')
+      test "$REPORTED" = "14.99" || { echo "ParameterStatus server_version: $REPORTED"; exit 1; }
+
+      SHOWN=$($PSQL -c "SHOW server_version")
+      test "$SHOWN" = "14.99" || { echo "SHOW server_version: $SHOWN"; exit 1; }
+
+      # Queries still reach the real server.
+      $PSQL -c "select current_setting('server_version_num')::int >= 100000" | grep -qx t
+      """
+    Then the command should succeed
@@ -0,0 +1,113 @@
+@rust @rust-2 @show-local-parameters
+Feature: SHOW of common parameters without a backend
+  A SimpleQuery SHOW of a parameter listed in general.show_local_parameters
+  is answered from the client's ParameterStatus snapshot. A parameter
+  PostgreSQL does not report is read from the backend once per pool and
+  served from the pool's cache afterwards, so health checks keep working
+  while every server connection is busy.
+
+  Background:
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman hba file contains:
+      """
+      host all admin 127.0.0.1/32 trust
+      host all example_user_1 127.0.0.1/32 md5
+      """
+    And self-signed SSL certificates are generated
+
+  Scenario: SHOW is answered while the only server connection is busy
+    Given pg_doorman started with config:
+      """
+      [prometheus]
+      enabled = true
+      host = "0.0.0.0"
+      port = 9127
+
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      pg_hba = {path = "${DOORMAN_HBA_FILE}"}
+      admin_username = "admin"
+      admin_password = "admin"
+      show_local_parameters = ["server_version", "transaction_isolation"]
+      tls_private_key = "${DOORMAN_SSL_KEY}"
+      tls_certificate = "${DOORMAN_SSL_CERT}"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+      pool_size = 1
+      """
+    When I run shell command:
+      """
+      export PGPASSWORD=test
+      PSQL="psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -tAc"
+
+      # Fills the pool's cache: PostgreSQL does not report transaction_isolation.
+      EXPECTED=$($PSQL "SHOW transaction_isolation")
+
+      $PSQL "select pg_sleep(4)" >/dev/null &
+      sleep 1
+
+      VERSION=$(timeout 2 $PSQL "SHOW server_version") || { echo "SHOW server_version waited for a server"; exit 1; }
+      ISOLATION=$(timeout 2 $PSQL "show transaction isolation level;") || { echo "SHOW TRANSACTION ISOLATION LEVEL waited for a server"; exit 1; }
+      wait
+
+      REAL=$(psql -h 127.0.0.1 -p ${PG_PORT} -U postgres -d example_db -tAc "SHOW server_version")
+      test "$VERSION" = "$REAL" || { echo "expected server_version $REAL, got $VERSION"; exit 1; }
+      test "$ISOLATION" = "$EXPECTED" || { echo "expected $EXPECTED, got $ISOLATION"; exit 1; }
+
+      METRICS=$(curl -s http://127.0.0.1:9127/metrics)
+      echo "$METRICS" | grep '^pg_doorman_show_local_total'
+      echo "$METRICS" | grep -q '^pg_doorman_show_local_total{source="backend"} 1$' || exit 1
+      echo "$METRICS" | grep -q '^pg_doorman_show_local_total{source="cache"} 1$' || exit 1
+      echo "$METRICS" | grep -q '^pg_doorman_show_local_total{source="parameter_status"} 1$' || exit 1
+      """
+    Then the command should succeed
+
+  Scenario: an empty list sends SHOW to PostgreSQL
+    Given pg_doorman started with config:
+      """
+      [prometheus]
+      enabled = true
+      host = "0.0.0.0"
+      port = 9127
+
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      pg_hba = {path = "${DOORMAN_HBA_FILE}"}
+      admin_username = "admin"
+      admin_password = "admin"
+      show_local_parameters = []
+      tls_private_key = "${DOORMAN_SSL_KEY}"
+      tls_certificate = "${DOORMAN_SSL_CERT}"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+      pool_size = 1
+      """
+    When I run shell command:
+      """
+      export PGPASSWORD=test
+      psql -h 127.0.0.1 -p ${DOORMAN_PORT} -U example_user_1 -d example_db -tAc "SHOW server_version" >/dev/null
+      ! curl -s http://127.0.0.1:9127/metrics | grep -q '^pg_doorman_show_local_total{'
+      """
+    Then the command should succeed
@@ -74,6 +74,43 @@ Feature: Per-pool startup_parameters
     Then psql query "SHOW statement_timeout" via pg_doorman as user "example_user_1" to database "example_db" with password "test" returns "23456ms"
     And psql query "SHOW lock_timeout" via pg_doorman as user "example_user_1" to database "example_db" with password "test" returns "5001ms"
 
+  Scenario: pool session timeouts are sent like pool.startup_parameters
+    Given PostgreSQL started with pg_hba.conf:
+      """
+      local   all             all                                     trust
+      host    all             all             127.0.0.1/32            trust
+      host    all             all             ::1/128                 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 md5"
+
+      [general.startup_parameters]
+      lock_timeout = "5001"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+      statement_timeout = "30s"
+      lock_timeout = "2s"
+      idle_in_transaction_session_timeout = "1m"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+      pool_size = 2
+      """
+    Then psql query "SHOW statement_timeout" via pg_doorman as user "example_user_1" to database "example_db" with password "test" returns "30s"
+    And psql query "SHOW lock_timeout" via pg_doorman as user "example_user_1" to database "example_db" with password "test" returns "2s"
+    And psql query "SHOW idle_in_transaction_session_timeout" via pg_doorman as user "example_user_1" to database "example_db" with password "test" returns "1min"
+
   Scenario: auth_query passthrough per-user JSON column overrides pool default
     Given PostgreSQL started with pg_hba.conf:
       """
@@ -0,0 +1,80 @@
+@rust @rust-3 @two-phase-commit
+Feature: PREPARE TRANSACTION policy in transaction mode
+  general.two_phase_commit decides whether PREPARE TRANSACTION is forwarded
+  with the client pinned to its backend and the transaction tracked in
+  SHOW PREPARED_TRANSACTIONS, or rejected with the transaction rolled back.
+
+  @two-phase-commit-pin
+  Scenario: pin tracks the prepared transaction until COMMIT PREPARED
+    Given PostgreSQL started with options "-c max_prepared_transactions=10" and pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 2
+      """
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "BEGIN; SELECT 1; PREPARE TRANSACTION 'bdd-2pc-pin'" to session "one"
+    And we create admin session "admin" to pg_doorman as "admin" with password "admin"
+    And we execute "show prepared_transactions" on admin session "admin" and store response
+    Then admin session "admin" response should contain "bdd-2pc-pin"
+    And pg_doorman log contains "until disconnect: PREPARE TRANSACTION"
+    When we send SimpleQuery "COMMIT PREPARED 'bdd-2pc-pin'" to session "one"
+    And we execute "show prepared_transactions" on admin session "admin" and store response
+    Then admin session "admin" response should not contain "bdd-2pc-pin"
+
+  @two-phase-commit-reject
+  Scenario: reject refuses PREPARE TRANSACTION and keeps the session usable
+    Given PostgreSQL started with options "-c max_prepared_transactions=10" and pg_hba.conf:
+      """
+      local all all trust
+      host all all 127.0.0.1/32 trust
+      """
+    And fixtures from "tests/fixture.sql" applied
+    And pg_doorman started with config:
+      """
+      [general]
+      host = "127.0.0.1"
+      port = ${DOORMAN_PORT}
+      admin_username = "admin"
+      admin_password = "admin"
+      pg_hba.content = "host all all 127.0.0.1/32 trust"
+      two_phase_commit = "reject"
+
+      [pools.example_db]
+      server_host = "127.0.0.1"
+      server_port = ${PG_PORT}
+      pool_mode = "transaction"
+
+      [[pools.example_db.users]]
+      username = "example_user_1"
+      password = ""
+      pool_size = 2
+      """
+    When we create session "one" to pg_doorman as "example_user_1" with password "" and database "example_db"
+    And we send SimpleQuery "BEGIN" to session "one"
+    And we send SimpleQuery "SELECT 1" to session "one"
+    And we send SimpleQuery "PREPARE TRANSACTION 'bdd-2pc-reject'" to session "one" expecting error after ready
+    Then session "one" should receive error containing "two_phase_commit = reject" with code "0A000"
+    When we send SimpleQuery "SELECT 1" to session "one"
+    And we create admin session "admin" to pg_doorman as "admin" with password "admin"
+    And we execute "show prepared_transactions" on admin session "admin" and store response
+    Then admin session "admin" response should not contain "bdd-2pc-reject"
@@ -17,8 +17,8 @@ fn is_pprof_enabled() -> bool {
 
 use pg_doorman::config::{Address, User};
 use pg_doorman::pool::{
-    ClientServerMap, Pool, PoolConfig, QueueMode, ScalingConfig, ScalingStatsSnapshot, ServerPool,
-    Timeouts,
+    ClientServerMap, Pool, PoolConfig, QueueMode, ReserveConfig, ScalingConfig,
+    ScalingStatsSnapshot, ServerPool, Timeouts,
 };
 use pg_doorman::stats::AddressStats;
 
@@ -89,6 +89,7 @@ async fn setup_internal_pool(world: &mut DoormanWorld, size: usize, _mode: Strin
         },
         queue_mode: QueueMode::Lifo,
         scaling: ScalingConfig::default(),
+        reserve: ReserveConfig::default(),
     };
 
     let pool = Pool::builder(server_pool).config(config).build();
@@ -442,6 +443,7 @@ async fn setup_internal_pool_with_lifetimes(
         },
         queue_mode: QueueMode::Lifo,
         scaling: ScalingConfig::default(),
+        reserve: ReserveConfig::default(),
     };
 
     let pool = Pool::builder(server_pool).config(config).build();
@@ -1,5 +1,5 @@
 use crate::world::{DoormanWorld, TestCommandResult};
-use cucumber::{gherkin::Step, then, when};
+use cucumber::{gherkin::Step, given, then, when};
 use std::io::{BufRead, BufReader};
 use std::process::{Command, Stdio};
 use std::sync::mpsc;
@@ -350,3 +350,13 @@ pub async fn command_output_should_not_contain(world: &mut DoormanWorld, text: S
         );
     }
 }
+
+/// Pick a free TCP port for a process the scenario starts itself, such as
+/// the Go mock backend, and expose it as `${<NAME>_PORT}`.
+#[given(regex = r"^a free TCP port is reserved as '(.+)'$")]
+pub async fn reserve_free_port(world: &mut DoormanWorld, name: String) {
+    let port = portpicker::pick_unused_port().expect("no free ports");
+    world
+        .vars
+        .insert(format!("{}_PORT", name.to_uppercase()), port.to_string());
+}
@@ -0,0 +1,92 @@
+using Npgsql;
+using NpgsqlTypes;
+using System;
+using System.Collections.Generic;
+using System.Linq;
+using System.Threading.Tasks;
+
+// Npgsql multiplexing through pg_doorman: the commands of many logical
+// connections are written back to back on a few physical ones. A small
+// Max Auto Prepare makes npgsql recycle its _autoN statements all the
+// time, so every physical connection sees a steady stream of Close and
+// Parse of the same names interleaved with other commands.
+
+string baseConnectionString = Environment.GetEnvironmentVariable("DATABASE_URL")
+    ?? "Host=127.0.0.1;Port=6433;Database=example_db;User Id=example_user_1;Password=test;";
+
+string multiplexed = baseConnectionString
+    + ";Multiplexing=true;Max Pool Size=4;Max Auto Prepare=4;Auto Prepare Min Usages=2";
+
+const int Workers = 32;
+const int Iterations = 200;
+const int Variants = 12;
+
+await using (var dataSource = NpgsqlDataSource.Create(multiplexed))
+{
+    // Test 1: concurrent commands cycling through more queries than auto-prepare slots
+    Console.WriteLine("Test 1: multiplexed commands with auto-prepare recycling");
+    await Task.WhenAll(Enumerable.Range(0, Workers).Select(worker => Task.Run(async () =>
+    {
+        for (int i = 0; i < Iterations; i++)
+        {
+            int variant = (worker + i) % Variants;
+            await using var cmd = dataSource.CreateCommand($"SELECT $1::int + {variant}");
+            cmd.Parameters.Add(new NpgsqlParameter { Value = i, NpgsqlDbType = NpgsqlDbType.Integer });
+            var got = (int)(await cmd.ExecuteScalarAsync())!;
+            if (got != i + variant)
+            {
+                throw new Exception($"worker {worker} iteration {i}: expected {i + variant}, got {got}");
+            }
+        }
+    })));
+    Console.WriteLine("Test 1 complete");
+
+    // Test 2: failing commands interleaved with succeeding ones
+    Console.WriteLine("Test 2: errors stay with their own command");
+    var failures = 0;
+    var failuresLock = new object();
+    await Task.WhenAll(Enumerable.Range(0, Workers).Select(worker => Task.Run(async () =>
+    {
+        for (int i = 0; i < Iterations / 4; i++)
+        {
+            bool fail = (worker + i) % 5 == 0;
+            await using var cmd = dataSource.CreateCommand(
+                fail ? "SELECT 1 / ($1::int - $1::int)" : "SELECT $1::int * 2");
+            cmd.Parameters.Add(new NpgsqlParameter { Value = i, NpgsqlDbType = NpgsqlDbType.Integer });
+            try
+            {
+                var got = (int)(await cmd.ExecuteScalarAsync())!;
+                if (fail) throw new Exception($"worker {worker} iteration {i}: division by zero succeeded");
+                if (got != i * 2) throw new Exception($"worker {worker} iteration {i}: got {got}");
+            }
+            catch (PostgresException e) when (fail && e.SqlState == "22012")
+            {
+                lock (failuresLock) failures++;
+            }
+        }
+    })));
+    if (failures == 0) throw new Exception("Expected division_by_zero errors");
+    Console.WriteLine($"  {failures} commands failed as expected");
+    Console.WriteLine("Test 2 complete");
+}
+
+// Test 3: explicit Prepare/Unprepare cycles send Close + Sync on their own
+Console.WriteLine("Test 3: rapid Prepare/Unprepare cycles");
+await using (var connection = new NpgsqlConnection(baseConnectionString))
+{
+    await connection.OpenAsync();
+    for (int i = 0; i < 100; i++)
+    {
+        await using var cmd = new NpgsqlCommand($"SELECT $1::int + {i % Variants}", connection);
+        cmd.Parameters.Add(new NpgsqlParameter { Value = i, NpgsqlDbType = NpgsqlDbType.Integer });
+        await cmd.PrepareAsync();
+        var got = (int)(await cmd.ExecuteScalarAsync())!;
+        if (got != i + i % Variants) throw new Exception($"iteration {i}: got {got}");
+        await cmd.UnprepareAsync();
+    }
+    await using var check = new NpgsqlCommand("SELECT 1", connection);
+    if ((int)(await check.ExecuteScalarAsync())! != 1) throw new Exception("Connection broken after Unprepare");
+}
+Console.WriteLine("Test 3 complete");
+
+Console.WriteLine("multiplexing complete");
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ozontech/pg_doorman/tests/go/pgdoormantest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,15 +33,15 @@ func TestCancelTLSQuery(t *testing.T) {
 	require.NoError(t, errConnQ)
 	defer connQ.Close()
 	t.Logf("connection query: address is %s", connQ.LocalAddr().String())
-	processID, secretID := login(t, connQ, "example_user_1", "example_db", "test")
+	processID, secretID := pgdoormantest.Login(t, connQ, "example_user_1", "example_db", "test")
 	{
 		configureFlush(t, connQ, 100*time.Millisecond)
 		t.Logf("connection query: send sleep\n")
-		sendParseQuery(t, connQ, "select pg_sleep(10);")
-		sendBindMessage(t, connQ)
-		sendDescribe(t, connQ, "P")
-		sendExecute(t, connQ)
-		sendSyncMessage(t, connQ)
+		pgdoormantest.SendParse(t, connQ, "select pg_sleep(10);")
+		pgdoormantest.SendBind(t, connQ)
+		pgdoormantest.SendDescribe(t, connQ, "P")
+		pgdoormantest.SendExecute(t, connQ)
+		pgdoormantest.SendSync(t, connQ)
 		time.Sleep(200 * time.Millisecond)
 	}
 
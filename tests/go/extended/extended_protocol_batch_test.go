@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ozontech/pg_doorman/tests/go/pgdoormantest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,28 +32,28 @@ func sendBatchSleepWithCancel(t *testing.T, _, first, second int) {
 		t.Fatal(errConn)
 	}
 	defer conn.Close()
-	processID, secretKey := login(t, conn, "example_user_1", "example_db", "test")
+	processID, secretKey := pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
 	t.Logf("processID: %d, secretKey: %d", processID, secretKey)
 	{
-		sendParseQuery(t, conn, fmt.Sprintf("select pg_sleep(%d)", first))
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
+		pgdoormantest.SendParse(t, conn, fmt.Sprintf("select pg_sleep(%d)", first))
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
 	}
 	{
-		sendParseQuery(t, conn, fmt.Sprintf("select pg_sleep(%d)", second))
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
+		pgdoormantest.SendParse(t, conn, fmt.Sprintf("select pg_sleep(%d)", second))
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
 	}
-	sendSyncMessage(t, conn)
+	pgdoormantest.SendSync(t, conn)
 	time.Sleep(1 * time.Second) // we need time login to pg.
 	now := time.Now()
-	sendCancel(t, poolerAddr, processID, secretKey)
-	messages := readServerMessages(t, conn)
+	pgdoormantest.SendCancel(t, poolerAddr, processID, secretKey)
+	messages := pgdoormantest.ReadMessages(t, conn)
 	assert.Equal(t, 5, len(messages))
 	assert.True(t, time.Since(now) < time.Second)
-	byeBye(t, conn)
+	pgdoormantest.SendTerminate(t, conn)
 }
 
 func sendBatchWithError(t *testing.T) {
@@ -61,46 +62,30 @@ func sendBatchWithError(t *testing.T) {
 		t.Fatal(errConn)
 	}
 	defer conn.Close()
-	processID, secretKey := login(t, conn, "example_user_1", "example_db", "test")
+	processID, secretKey := pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
 	t.Logf("processID: %d, secretKey: %d", processID, secretKey)
 	{
-		sendParseQuery(t, conn, fmt.Sprintf("select 1"))
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
+		pgdoormantest.SendParse(t, conn, fmt.Sprintf("select 1"))
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
 	}
 	{
-		sendParseQuery(t, conn, fmt.Sprintf("select sasasa"))
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
+		pgdoormantest.SendParse(t, conn, fmt.Sprintf("select sasasa"))
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
 	}
-	sendSyncMessage(t, conn)
-	messages := readServerMessages(t, conn)
+	pgdoormantest.SendSync(t, conn)
+	messages := pgdoormantest.ReadMessages(t, conn)
 	assert.Equal(t, 7, len(messages))
 	{
-		sendParseQuery(t, conn, fmt.Sprintf("SELECT * FROM generate_series(1,1000)"))
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
-		sendSyncMessage(t, conn)
-		assert.Equal(t, 1005, len(readServerMessages(t, conn)))
+		pgdoormantest.SendParse(t, conn, fmt.Sprintf("SELECT * FROM generate_series(1,1000)"))
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
+		pgdoormantest.SendSync(t, conn)
+		assert.Equal(t, 1005, len(pgdoormantest.ReadMessages(t, conn)))
 	}
-	byeBye(t, conn)
-}
-
-func sendCancel(t *testing.T, addr string, processID, secretKey int) {
-	connC, errConnC := net.Dial("tcp", addr)
-	require.NoError(t, errConnC)
-	defer connC.Close()
-	t.Logf("connection cancel: send cancel")
-	pack := make([]byte, 0)
-	pack = append(pack, i32ToBytes(16)...)
-	pack = append(pack, i32ToBytes(80877102)...) // cancel
-	pack = append(pack, i32ToBytes(int32(processID))...)
-	pack = append(pack, i32ToBytes(int32(secretKey))...)
-	count, errWrite := connC.Write(pack)
-	assert.NoError(t, errWrite)
-	assert.Equal(t, len(pack), count)
-	assert.Nil(t, connC.Close())
+	pgdoormantest.SendTerminate(t, conn)
 }
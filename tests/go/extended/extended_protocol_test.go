@@ -8,6 +8,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/ozontech/pg_doorman/tests/go/pgdoormantest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,14 +88,14 @@ func Test_RaceStop(t *testing.T) {
 	if errConn != nil {
 		t.Fatal(errConn)
 	}
-	_, _ = login(t, conn, "example_user_1", "example_db", "test")
-	sendParseQuery(t, conn, "SELECT * FROM generate_series(1,1000000);")
+	_, _ = pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
+	pgdoormantest.SendParse(t, conn, "SELECT * FROM generate_series(1,1000000);")
 	time.Sleep(100 * time.Millisecond)
-	sendBindMessage(t, conn)
-	sendDescribe(t, conn, "P")
-	sendExecute(t, conn)
-	sendParseQuery(t, conn, "select pg_sleep(1)")
-	byeBye(t, conn)
+	pgdoormantest.SendBind(t, conn)
+	pgdoormantest.SendDescribe(t, conn, "P")
+	pgdoormantest.SendExecute(t, conn)
+	pgdoormantest.SendParse(t, conn, "select pg_sleep(1)")
+	pgdoormantest.SendTerminate(t, conn)
 	if err := conn.Close(); err != nil {
 		t.Error(err)
 	}
@@ -108,16 +109,16 @@ func Test_RaceStop(t *testing.T) {
 				t.Error(errConn)
 				return
 			}
-			_, _ = login(t, conn, "example_user_1", "example_db", "test")
-			sendParseQuery(t, conn, "SELECT * FROM generate_series(1,1000000);")
+			_, _ = pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
+			pgdoormantest.SendParse(t, conn, "SELECT * FROM generate_series(1,1000000);")
 			time.Sleep(100 * time.Millisecond)
-			sendBindMessage(t, conn)
-			sendDescribe(t, conn, "P")
-			sendExecute(t, conn)
+			pgdoormantest.SendBind(t, conn)
+			pgdoormantest.SendDescribe(t, conn, "P")
+			pgdoormantest.SendExecute(t, conn)
 			if count%2 == 0 {
-				sendSyncMessage(t, conn)
+				pgdoormantest.SendSync(t, conn)
 			} else {
-				byeBye(t, conn)
+				pgdoormantest.SendTerminate(t, conn)
 			}
 			if err := conn.Close(); err != nil {
 				t.Error(err)
@@ -133,23 +134,23 @@ func Test_RaceStop(t *testing.T) {
 }
 
 func Test_ExtendedProtocol(t *testing.T) {
-	f := func(t *testing.T, conn net.Conn) []*message {
-		processID, secretKey := login(t, conn, "example_user_1", "example_db", "test")
+	f := func(t *testing.T, conn net.Conn) []*pgdoormantest.Message {
+		processID, secretKey := pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
 		t.Logf("processID: %d, secretKey: %d\n", processID, secretKey)
 		if processID == 0 {
-			_ = readServerMessages(t, conn)
+			_ = pgdoormantest.ReadMessages(t, conn)
 		}
-		sendParseQuery(t, conn, "select pg_sleep(0.1)")
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
-		sendParseQuery(t, conn, "select 1")
-		sendBindMessage(t, conn)
-		sendDescribe(t, conn, "P")
-		sendExecute(t, conn)
-		sendSyncMessage(t, conn)
-		messages := readServerMessages(t, conn)
-		byeBye(t, conn)
+		pgdoormantest.SendParse(t, conn, "select pg_sleep(0.1)")
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
+		pgdoormantest.SendParse(t, conn, "select 1")
+		pgdoormantest.SendBind(t, conn)
+		pgdoormantest.SendDescribe(t, conn, "P")
+		pgdoormantest.SendExecute(t, conn)
+		pgdoormantest.SendSync(t, conn)
+		messages := pgdoormantest.ReadMessages(t, conn)
+		pgdoormantest.SendTerminate(t, conn)
 		return messages
 	}
 	doorman := getMessages(t, poolerAddr, f)
@@ -159,11 +160,11 @@ func Test_ExtendedProtocol(t *testing.T) {
 	}
 	for i, msgDoorman := range doorman {
 		msgPg := pg[i]
-		mustEqualMessages(t, msgPg, msgDoorman)
+		pgdoormantest.MustEqualMessages(t, msgDoorman, msgPg)
 	}
 }
 
-func getMessages(t *testing.T, address string, f func(t *testing.T, conn net.Conn) []*message) []*message {
+func getMessages(t *testing.T, address string, f func(t *testing.T, conn net.Conn) []*pgdoormantest.Message) []*pgdoormantest.Message {
 	conn, errConn := net.Dial("tcp", address)
 	if errConn != nil {
 		t.Fatal(errConn)
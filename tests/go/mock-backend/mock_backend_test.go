@@ -0,0 +1,140 @@
+package doorman_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"doorman/mockpg"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend is the server of the pg_doorman pool under test, listening on
+// MOCK_PG_PORT.
+var backend *mockpg.Backend
+
+func TestMain(m *testing.M) {
+	backend = mockpg.New()
+	if err := backend.Start("127.0.0.1:" + os.Getenv("MOCK_PG_PORT")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	backend.Close()
+	os.Exit(code)
+}
+
+func connect(t *testing.T) *pgxpool.Pool {
+	db, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func rows(values ...string) mockpg.Result {
+	result := mockpg.Result{Columns: []string{"value"}}
+	for _, value := range values {
+		result.Rows = append(result.Rows, []string{value})
+	}
+	return result
+}
+
+// expectWorking checks that the pool still serves queries after a fault.
+func expectWorking(t *testing.T, db *pgxpool.Pool) {
+	backend.Handle("select mock_alive()", rows("alive"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var value string
+	require.NoError(t, db.QueryRow(ctx, "select mock_alive()").Scan(&value))
+	assert.Equal(t, "alive", value)
+}
+
+func Test_MockBackendError(t *testing.T) {
+	backend.Handle("select mock_error()", mockpg.Result{
+		Error: &pgproto3.ErrorResponse{Code: "22012", Message: "division by zero"},
+	})
+	db := connect(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := db.Exec(ctx, "select mock_error()")
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr), "expected a PostgreSQL error, got %v", err)
+		assert.Equal(t, "22012", pgErr.Code)
+	}
+	expectWorking(t, db)
+}
+
+func Test_MockBackendPartialWrites(t *testing.T) {
+	values := make([]string, 50)
+	for i := range values {
+		values[i] = fmt.Sprintf("row-%02d", i)
+	}
+	result := rows(values...)
+	result.Fault = mockpg.PartialWrites
+	backend.Handle("select mock_partial($1)", result)
+	db := connect(t)
+
+	got := make([]string, 0, len(values))
+	queryRows, err := db.Query(context.Background(), "select mock_partial($1)", "x")
+	require.NoError(t, err)
+	for queryRows.Next() {
+		var value string
+		require.NoError(t, queryRows.Scan(&value))
+		got = append(got, value)
+	}
+	require.NoError(t, queryRows.Err())
+	assert.Equal(t, values, got)
+}
+
+func Test_MockBackendDisconnectMidMessage(t *testing.T) {
+	result := rows("a", "b", "c")
+	result.Fault = mockpg.DisconnectMidMessage
+	backend.Handle("select mock_cut()", result)
+	db := connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := db.Exec(ctx, "select mock_cut()")
+	require.Error(t, err)
+	require.NoError(t, ctx.Err(), "pg_doorman did not report the lost backend")
+	expectWorking(t, db)
+}
+
+func Test_MockBackendMalformedMessage(t *testing.T) {
+	result := rows("a")
+	result.Fault = mockpg.Malformed
+	backend.Handle("select mock_malformed()", result)
+	db := connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := db.Exec(ctx, "select mock_malformed()")
+	require.Error(t, err)
+	require.NoError(t, ctx.Err(), "pg_doorman did not report the malformed message")
+	expectWorking(t, db)
+}
+
+func Test_MockBackendCancel(t *testing.T) {
+	backend.Handle("select mock_sleep()", mockpg.Result{Delay: 30 * time.Second})
+	db := connect(t)
+	cancels := backend.Cancels()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := db.Exec(ctx, "select mock_sleep()")
+	require.Error(t, err)
+	assert.Less(t, time.Since(started), 10*time.Second)
+	assert.Eventually(t, func() bool { return backend.Cancels() > cancels },
+		5*time.Second, 50*time.Millisecond, "cancel request did not reach the backend")
+	expectWorking(t, db)
+}
@@ -0,0 +1,649 @@
+// Package mockpg is an in-process PostgreSQL backend for protocol tests.
+//
+// It speaks enough of the wire protocol for pg_doorman to use it as a
+// server: startup with trust or MD5 authentication, cancel requests, simple
+// queries and the extended protocol (Parse, Bind, Describe, Execute, Close,
+// Sync, Flush), with the transaction status PostgreSQL reports in
+// ReadyForQuery. Replies are scripted per query text and can be delayed or
+// broken on purpose (single-byte writes, a disconnect in the middle of a
+// message, a malformed message), so protocol edge cases can be tested
+// deterministically without a real PostgreSQL.
+package mockpg
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// textOID is the type of every column and parameter: the text and binary
+// formats of text are the same bytes, so clients may ask for either.
+const textOID = 25
+
+// Fault is a way to break a reply on purpose.
+type Fault int
+
+const (
+	// NoFault sends the reply as it is.
+	NoFault Fault = iota
+	// Disconnect closes the connection instead of replying.
+	Disconnect
+	// DisconnectMidMessage sends the first half of the reply and closes
+	// the connection.
+	DisconnectMidMessage
+	// PartialWrites sends the reply one byte per write.
+	PartialWrites
+	// Malformed sends a DataRow whose length is below the minimum and
+	// closes the connection.
+	Malformed
+)
+
+// Result is the scripted reply to a query.
+type Result struct {
+	// Columns names the text columns of the result; none for a command.
+	Columns []string
+	Rows    [][]string
+	// Tag is the CommandComplete tag. Defaults to "SELECT <rows>" for a
+	// result with columns, else to the query's command word.
+	Tag string
+	// Error is sent in place of the result when set.
+	Error *pgproto3.ErrorResponse
+	// Delay is waited before the reply; a cancel request ends the wait
+	// with SQLSTATE 57014.
+	Delay time.Duration
+	Fault Fault
+}
+
+// Backend is a mock PostgreSQL server. Configure it, then Start it.
+type Backend struct {
+	// Parameters are reported with ParameterStatus after authentication.
+	Parameters map[string]string
+	// Password, when set, is required with MD5 authentication.
+	Password string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	results  map[string]Result
+	queries  []string
+	cancels  int
+	sessions map[uint32]*session
+	conns    map[net.Conn]struct{}
+	nextPID  uint32
+}
+
+// New returns a Backend reporting PostgreSQL 16 defaults.
+func New() *Backend {
+	return &Backend{
+		Parameters: map[string]string{
+			"server_version":              "16.0 (mockpg)",
+			"server_encoding":             "UTF8",
+			"client_encoding":             "UTF8",
+			"DateStyle":                   "ISO, MDY",
+			"IntervalStyle":               "postgres",
+			"TimeZone":                    "UTC",
+			"integer_datetimes":           "on",
+			"standard_conforming_strings": "on",
+			"application_name":            "",
+		},
+		results:  map[string]Result{},
+		sessions: map[uint32]*session{},
+		conns:    map[net.Conn]struct{}{},
+		nextPID:  1000,
+	}
+}
+
+// Start listens on addr ("127.0.0.1:0" for any free port) and serves
+// connections until Close.
+func (b *Backend) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	b.listener = listener
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns[conn] = struct{}{}
+			b.mu.Unlock()
+			b.wg.Add(1)
+			go b.serve(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr is the address the backend listens on.
+func (b *Backend) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Port is the port the backend listens on.
+func (b *Backend) Port() int {
+	return b.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops listening, closes every connection and waits for them.
+func (b *Backend) Close() error {
+	err := b.listener.Close()
+	b.mu.Lock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return err
+}
+
+// Handle scripts the reply to query, matched after trimming spaces and a
+// trailing semicolon.
+func (b *Backend) Handle(query string, result Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results[normalize(query)] = result
+}
+
+// Queries returns the simple queries and Parse texts received so far.
+func (b *Backend) Queries() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.queries...)
+}
+
+// Received reports how many times query was received.
+func (b *Backend) Received(query string) int {
+	query = normalize(query)
+	count := 0
+	for _, q := range b.Queries() {
+		if normalize(q) == query {
+			count++
+		}
+	}
+	return count
+}
+
+// Cancels returns the number of cancel requests that matched a session.
+func (b *Backend) Cancels() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cancels
+}
+
+func normalize(query string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+}
+
+func (b *Backend) record(query string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries = append(b.queries, query)
+}
+
+func (b *Backend) lookup(query string) Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.results[normalize(query)]
+}
+
+// errClosed ends a session after a fault closed its connection.
+var errClosed = errors.New("mockpg: connection closed by fault")
+
+type portal struct {
+	query   string
+	formats []int16
+}
+
+type session struct {
+	backend *Backend
+	conn    net.Conn
+	proto   *pgproto3.Backend
+	pid     uint32
+	secret  uint32
+	cancel  chan struct{}
+
+	statements map[string]string
+	portals    map[string]portal
+	// pending holds extended protocol replies until Sync or Flush.
+	pending []pgproto3.BackendMessage
+	fault   Fault
+	// failed skips extended protocol messages up to Sync after an error.
+	failed bool
+	status byte
+}
+
+func (b *Backend) serve(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+	}()
+	s := &session{
+		backend:    b,
+		conn:       conn,
+		proto:      pgproto3.NewBackend(conn, conn),
+		cancel:     make(chan struct{}, 1),
+		statements: map[string]string{},
+		portals:    map[string]portal{},
+		status:     'I',
+	}
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s.pid)
+		b.mu.Unlock()
+	}()
+	if !s.startup() {
+		return
+	}
+	for {
+		msg, err := s.proto.Receive()
+		if err != nil {
+			return
+		}
+		if err := s.handle(msg); err != nil {
+			return
+		}
+	}
+}
+
+// startup runs the startup phase; false when the connection is done.
+func (s *session) startup() bool {
+	for {
+		msg, err := s.proto.ReceiveStartupMessage()
+		if err != nil {
+			return false
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			if _, err := s.conn.Write([]byte{'N'}); err != nil {
+				return false
+			}
+		case *pgproto3.CancelRequest:
+			s.backend.cancelSession(msg.ProcessID, msg.SecretKey)
+			return false
+		case *pgproto3.StartupMessage:
+			if !s.authenticate(msg.Parameters["user"]) {
+				return false
+			}
+			b := s.backend
+			b.mu.Lock()
+			b.nextPID++
+			s.pid = b.nextPID
+			s.secret = s.pid * 7919
+			b.sessions[s.pid] = s
+			b.mu.Unlock()
+			for name, value := range b.Parameters {
+				s.proto.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+			}
+			s.proto.Send(&pgproto3.BackendKeyData{ProcessID: s.pid, SecretKey: s.secret})
+			s.proto.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			return s.proto.Flush() == nil
+		default:
+			return false
+		}
+	}
+}
+
+func (s *session) authenticate(user string) bool {
+	if s.backend.Password == "" {
+		s.proto.Send(&pgproto3.AuthenticationOk{})
+		return true
+	}
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return false
+	}
+	s.proto.Send(&pgproto3.AuthenticationMD5Password{Salt: salt})
+	if s.proto.Flush() != nil || s.proto.SetAuthType(pgproto3.AuthTypeMD5Password) != nil {
+		return false
+	}
+	msg, err := s.proto.Receive()
+	if err != nil {
+		return false
+	}
+	password, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok || password.Password != md5Password(user, s.backend.Password, salt) {
+		s.proto.Send(&pgproto3.ErrorResponse{
+			Severity: "FATAL",
+			Code:     "28P01",
+			Message:  fmt.Sprintf("password authentication failed for user %q", user),
+		})
+		s.proto.Flush()
+		return false
+	}
+	s.proto.Send(&pgproto3.AuthenticationOk{})
+	return true
+}
+
+func md5Password(user, password string, salt [4]byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt[:]...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+func (b *Backend) cancelSession(pid, secret uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.sessions[pid]
+	if !ok || s.secret != secret {
+		return
+	}
+	b.cancels++
+	select {
+	case s.cancel <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) handle(msg pgproto3.FrontendMessage) error {
+	switch msg := msg.(type) {
+	case *pgproto3.Query:
+		return s.simpleQuery(msg.String)
+	case *pgproto3.Parse:
+		if s.failed {
+			return nil
+		}
+		s.backend.record(msg.Query)
+		s.statements[msg.Name] = msg.Query
+		s.pending = append(s.pending, &pgproto3.ParseComplete{})
+	case *pgproto3.Bind:
+		if s.failed {
+			return nil
+		}
+		query, ok := s.statements[msg.PreparedStatement]
+		if !ok {
+			s.fail(errorResponse("26000",
+				fmt.Sprintf("prepared statement %q does not exist", msg.PreparedStatement)))
+			return nil
+		}
+		s.portals[msg.DestinationPortal] = portal{query: query, formats: msg.ResultFormatCodes}
+		s.pending = append(s.pending, &pgproto3.BindComplete{})
+	case *pgproto3.Describe:
+		if s.failed {
+			return nil
+		}
+		s.describe(msg)
+	case *pgproto3.Execute:
+		if s.failed {
+			return nil
+		}
+		p, ok := s.portals[msg.Portal]
+		if !ok {
+			s.fail(errorResponse("34000", fmt.Sprintf("portal %q does not exist", msg.Portal)))
+			return nil
+		}
+		result := s.backend.lookup(p.query)
+		if !s.wait(result.Delay) {
+			s.fail(errorResponse("57014", "canceling statement due to user request"))
+			return nil
+		}
+		if result.Error != nil {
+			s.fail(result.Error)
+			return nil
+		}
+		s.pending = append(s.pending, s.rows(p.query, result)...)
+		s.fault = result.Fault
+		s.track(p.query)
+	case *pgproto3.Close:
+		if s.failed {
+			return nil
+		}
+		if msg.ObjectType == 'S' {
+			delete(s.statements, msg.Name)
+		} else {
+			delete(s.portals, msg.Name)
+		}
+		s.pending = append(s.pending, &pgproto3.CloseComplete{})
+	case *pgproto3.Flush:
+		return s.flush()
+	case *pgproto3.Sync:
+		s.failed = false
+		delete(s.portals, "")
+		s.pending = append(s.pending, &pgproto3.ReadyForQuery{TxStatus: s.status})
+		return s.flush()
+	case *pgproto3.Terminate:
+		return errClosed
+	}
+	return nil
+}
+
+func (s *session) simpleQuery(query string) error {
+	s.backend.record(query)
+	result := s.backend.lookup(query)
+	var reply []pgproto3.BackendMessage
+	switch {
+	case !s.wait(result.Delay):
+		reply = append(reply, s.failure(errorResponse("57014", "canceling statement due to user request")))
+	case s.status == 'E' && !endsTransaction(query):
+		reply = append(reply, errorResponse("25P02",
+			"current transaction is aborted, commands ignored until end of transaction block"))
+	case result.Error != nil:
+		reply = append(reply, s.failure(result.Error))
+	default:
+		if strings.TrimSpace(query) == "" {
+			reply = append(reply, &pgproto3.EmptyQueryResponse{})
+		} else {
+			if description := rowDescription(result, nil); description != nil {
+				reply = append(reply, description)
+			}
+			reply = append(reply, s.rows(query, result)...)
+			s.track(query)
+		}
+	}
+	reply = append(reply, &pgproto3.ReadyForQuery{TxStatus: s.status})
+	return s.write(reply, result.Fault)
+}
+
+// wait sleeps for delay; false when a cancel request ended it.
+func (s *session) wait(delay time.Duration) bool {
+	// A cancel that arrived while the session was idle is stale.
+	select {
+	case <-s.cancel:
+	default:
+	}
+	if delay <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(delay):
+		return true
+	case <-s.cancel:
+		return false
+	}
+}
+
+func (s *session) fail(err *pgproto3.ErrorResponse) {
+	s.pending = append(s.pending, s.failure(err))
+	s.failed = true
+}
+
+// failure records the transaction failure err causes and returns it.
+func (s *session) failure(err *pgproto3.ErrorResponse) *pgproto3.ErrorResponse {
+	if s.status == 'T' {
+		s.status = 'E'
+	}
+	if err.Severity == "" {
+		err.Severity = "ERROR"
+	}
+	return err
+}
+
+func errorResponse(code, message string) *pgproto3.ErrorResponse {
+	return &pgproto3.ErrorResponse{Severity: "ERROR", Code: code, Message: message}
+}
+
+func command(query string) string {
+	fields := strings.Fields(normalize(query))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+func endsTransaction(query string) bool {
+	switch command(query) {
+	case "COMMIT", "END", "ROLLBACK", "ABORT":
+		return true
+	}
+	return false
+}
+
+// track updates the transaction status after query succeeded.
+func (s *session) track(query string) {
+	switch command(query) {
+	case "BEGIN", "START":
+		s.status = 'T'
+	case "COMMIT", "END", "ROLLBACK", "ABORT":
+		s.status = 'I'
+	}
+}
+
+func (s *session) describe(msg *pgproto3.Describe) {
+	if msg.ObjectType == 'S' {
+		query, ok := s.statements[msg.Name]
+		if !ok {
+			s.fail(errorResponse("26000", fmt.Sprintf("prepared statement %q does not exist", msg.Name)))
+			return
+		}
+		params := make([]uint32, parameterCount(query))
+		for i := range params {
+			params[i] = textOID
+		}
+		s.pending = append(s.pending, &pgproto3.ParameterDescription{ParameterOIDs: params})
+		s.pendRowDescription(s.backend.lookup(query), nil)
+		return
+	}
+	p, ok := s.portals[msg.Name]
+	if !ok {
+		s.fail(errorResponse("34000", fmt.Sprintf("portal %q does not exist", msg.Name)))
+		return
+	}
+	s.pendRowDescription(s.backend.lookup(p.query), p.formats)
+}
+
+// pendRowDescription queues the reply to Describe: RowDescription, or
+// NoData for a command.
+func (s *session) pendRowDescription(result Result, formats []int16) {
+	if description := rowDescription(result, formats); description != nil {
+		s.pending = append(s.pending, description)
+	} else {
+		s.pending = append(s.pending, &pgproto3.NoData{})
+	}
+}
+
+var parameterRef = regexp.MustCompile(`\$(\d+)`)
+
+func parameterCount(query string) int {
+	count := 0
+	for _, match := range parameterRef.FindAllStringSubmatch(query, -1) {
+		if n, err := strconv.Atoi(match[1]); err == nil && n > count {
+			count = n
+		}
+	}
+	return count
+}
+
+// rowDescription describes the columns of result in formats, as Bind
+// gives them; nil for a command.
+func rowDescription(result Result, formats []int16) *pgproto3.RowDescription {
+	if len(result.Columns) == 0 {
+		return nil
+	}
+	fields := make([]pgproto3.FieldDescription, len(result.Columns))
+	for i, name := range result.Columns {
+		var format int16
+		switch {
+		case len(formats) == 1:
+			format = formats[0]
+		case len(formats) == len(result.Columns):
+			format = formats[i]
+		}
+		fields[i] = pgproto3.FieldDescription{
+			Name:         []byte(name),
+			DataTypeOID:  textOID,
+			DataTypeSize: -1,
+			TypeModifier: -1,
+			Format:       format,
+		}
+	}
+	return &pgproto3.RowDescription{Fields: fields}
+}
+
+func (s *session) rows(query string, result Result) []pgproto3.BackendMessage {
+	var reply []pgproto3.BackendMessage
+	for _, row := range result.Rows {
+		values := make([][]byte, len(row))
+		for i, value := range row {
+			values[i] = []byte(value)
+		}
+		reply = append(reply, &pgproto3.DataRow{Values: values})
+	}
+	tag := result.Tag
+	switch {
+	case tag != "":
+	case len(result.Columns) > 0:
+		tag = fmt.Sprintf("SELECT %d", len(result.Rows))
+	default:
+		tag = command(query)
+	}
+	return append(reply, &pgproto3.CommandComplete{CommandTag: []byte(tag)})
+}
+
+func (s *session) flush() error {
+	reply, fault := s.pending, s.fault
+	s.pending, s.fault = nil, NoFault
+	return s.write(reply, fault)
+}
+
+// write sends reply, broken the way fault says.
+func (s *session) write(reply []pgproto3.BackendMessage, fault Fault) error {
+	var buf []byte
+	for _, msg := range reply {
+		var err error
+		if buf, err = msg.Encode(buf); err != nil {
+			return err
+		}
+	}
+	switch fault {
+	case Disconnect:
+		return errClosed
+	case DisconnectMidMessage:
+		s.conn.Write(buf[:len(buf)/2])
+		return errClosed
+	case PartialWrites:
+		for i := range buf {
+			if _, err := s.conn.Write(buf[i : i+1]); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	case Malformed:
+		var bad [5]byte
+		bad[0] = 'D'
+		binary.BigEndian.PutUint32(bad[1:], 2)
+		s.conn.Write(bad[:])
+		return errClosed
+	}
+	_, err := s.conn.Write(buf)
+	return err
+}
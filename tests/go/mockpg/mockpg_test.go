@@ -0,0 +1,133 @@
+package mockpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func start(t *testing.T, configure func(b *Backend)) *Backend {
+	b := New()
+	if configure != nil {
+		configure(b)
+	}
+	require.NoError(t, b.Start("127.0.0.1:0"))
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func connect(t *testing.T, b *Backend, password string) *pgx.Conn {
+	url := fmt.Sprintf("postgres://mock:%s@%s/mock?sslmode=disable", password, b.Addr())
+	conn, err := pgx.Connect(context.Background(), url)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	return conn
+}
+
+func pgError(t *testing.T, err error) *pgconn.PgError {
+	var pgErr *pgconn.PgError
+	require.True(t, errors.As(err, &pgErr), "expected a PostgreSQL error, got %v", err)
+	return pgErr
+}
+
+func TestSimpleAndExtendedQueries(t *testing.T) {
+	b := start(t, nil)
+	b.Handle("select name, value from settings where name = $1", Result{
+		Columns: []string{"name", "value"},
+		Rows:    [][]string{{"mode", "mock"}},
+	})
+	conn := connect(t, b, "")
+	ctx := context.Background()
+
+	assert.Equal(t, "16.0 (mockpg)", conn.PgConn().ParameterStatus("server_version"))
+
+	var name, value string
+	err := conn.QueryRow(ctx, "select name, value from settings where name = $1", "mode").
+		Scan(&name, &value)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mode", "mock"}, []string{name, value})
+
+	results, err := conn.PgConn().Exec(ctx, "select name, value from settings where name = $1").
+		ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1", results[0].CommandTag.String())
+	// Parse of the extended query, then the simple query.
+	assert.Equal(t, 2, b.Received("select name, value from settings where name = $1;"))
+}
+
+func TestErrorsAndTransactionStatus(t *testing.T) {
+	b := start(t, nil)
+	b.Handle("select 1/0", Result{Error: errorResponse("22012", "division by zero")})
+	conn := connect(t, b, "")
+	ctx := context.Background()
+
+	_, err := conn.Exec(ctx, "select 1/0")
+	assert.Equal(t, "22012", pgError(t, err).Code)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "select 1/0")
+	require.Error(t, err)
+	_, err = tx.Exec(ctx, "select 1")
+	assert.Equal(t, "25P02", pgError(t, err).Code)
+	require.NoError(t, tx.Rollback(ctx))
+	assert.Equal(t, byte('I'), conn.PgConn().TxStatus())
+}
+
+func TestMD5Authentication(t *testing.T) {
+	b := start(t, func(b *Backend) { b.Password = "secret" })
+	connect(t, b, "secret")
+
+	url := fmt.Sprintf("postgres://mock:wrong@%s/mock?sslmode=disable", b.Addr())
+	_, err := pgx.Connect(context.Background(), url)
+	assert.Equal(t, "28P01", pgError(t, err).Code)
+}
+
+func TestCancelEndsDelay(t *testing.T) {
+	b := start(t, nil)
+	b.Handle("select pg_sleep(10)", Result{Delay: 10 * time.Second})
+	conn := connect(t, b, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := conn.Exec(ctx, "select pg_sleep(10)")
+	require.Error(t, err)
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.Eventually(t, func() bool { return b.Cancels() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestFaults(t *testing.T) {
+	b := start(t, nil)
+	rows := Result{Columns: []string{"n"}, Rows: [][]string{{"1"}, {"2"}, {"3"}}}
+	for query, fault := range map[string]Fault{
+		"select partial":    PartialWrites,
+		"select disconnect": Disconnect,
+		"select mid":        DisconnectMidMessage,
+		"select malformed":  Malformed,
+	} {
+		result := rows
+		result.Fault = fault
+		b.Handle(query, result)
+	}
+	ctx := context.Background()
+
+	conn := connect(t, b, "")
+	results, err := conn.PgConn().Exec(ctx, "select partial").ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, results[0].Rows, 3)
+
+	for _, query := range []string{"select disconnect", "select mid", "select malformed"} {
+		conn := connect(t, b, "")
+		_, err := conn.PgConn().Exec(ctx, query).ReadAll()
+		assert.Error(t, err, query)
+		assert.True(t, conn.IsClosed(), query)
+	}
+}
@@ -0,0 +1,42 @@
+// Package pgdoormantest helps writing integration tests against pg_doorman.
+//
+// Start runs a pg_doorman binary with a temporary config on a free port and
+// waits until it accepts connections; the instance is stopped when the test
+// ends. The raw-protocol helpers (Login, SendParse, SendCancel,
+// ReadMessages, ...) speak the PostgreSQL wire protocol one message at a
+// time, for the cases a driver hides: batches without Sync, cancel
+// requests, comparing the exact messages of pg_doorman and PostgreSQL.
+//
+//	func TestMyDriver(t *testing.T) {
+//		doorman := pgdoormantest.Start(t, pgdoormantest.Options{Config: `
+//	[general]
+//	host = "127.0.0.1"
+//	port = ${DOORMAN_PORT}
+//	admin_username = "admin"
+//	admin_password = "admin"
+//
+//	[pools.example_db]
+//	server_host = "127.0.0.1"
+//	server_port = 5432
+//
+//	[[pools.example_db.users]]
+//	username = "example_user_1"
+//	password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+//	pool_size = 4
+//	`})
+//		conn, err := net.Dial("tcp", doorman.Addr())
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer conn.Close()
+//		pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
+//		pgdoormantest.SendQuery(t, conn, "select 1")
+//		messages := pgdoormantest.ReadMessages(t, conn)
+//		...
+//	}
+//
+// The package depends on the standard library only, so it can be added to
+// any test module with
+//
+//	go get github.com/ozontech/pg_doorman/tests/go/pgdoormantest
+package pgdoormantest
@@ -0,0 +1,197 @@
+package pgdoormantest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Options of a pg_doorman instance started by Start.
+type Options struct {
+	// Binary is the pg_doorman executable. Defaults to $PG_DOORMAN_BINARY,
+	// then to pg_doorman in PATH.
+	Binary string
+	// Config is the TOML or YAML config; YAML is recognized by a leading
+	// "general:". ${DOORMAN_PORT} is replaced with the listen port.
+	Config string
+	// Vars replaces other ${NAME} placeholders of Config.
+	Vars map[string]string
+	// LogLevel is passed with -l. Defaults to info.
+	LogLevel string
+	// StartTimeout bounds the wait for the listen port. Defaults to 5s.
+	StartTimeout time.Duration
+}
+
+// Instance is a running pg_doorman.
+type Instance struct {
+	// Port pg_doorman listens on, on 127.0.0.1.
+	Port int
+	// ConfigPath is the temporary config file.
+	ConfigPath string
+
+	cmd    *exec.Cmd
+	log    *logBuffer
+	exited chan struct{}
+	once   sync.Once
+}
+
+// logBuffer collects the output of pg_doorman; written by exec's copying
+// goroutine and read by the test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Start runs pg_doorman with opts.Config and waits until it accepts TCP
+// connections. The instance is stopped when the test ends; a failed start
+// fails the test with the output of pg_doorman.
+func Start(t testing.TB, opts Options) *Instance {
+	t.Helper()
+	binary := opts.Binary
+	if binary == "" {
+		binary = os.Getenv("PG_DOORMAN_BINARY")
+	}
+	if binary == "" {
+		binary = "pg_doorman"
+	}
+	binary, err := exec.LookPath(binary)
+	if err != nil {
+		t.Fatalf("pg_doorman binary: %v (set PG_DOORMAN_BINARY)", err)
+	}
+	port, err := FreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := strings.ReplaceAll(opts.Config, "${DOORMAN_PORT}", strconv.Itoa(port))
+	for name, value := range opts.Vars {
+		config = strings.ReplaceAll(config, "${"+name+"}", value)
+	}
+	name := "pg_doorman.toml"
+	if strings.HasPrefix(strings.TrimSpace(config), "general:") {
+		name = "pg_doorman.yaml"
+	}
+	configPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logLevel := opts.LogLevel
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	instance := &Instance{
+		Port:       port,
+		ConfigPath: configPath,
+		cmd:        exec.Command(binary, configPath, "-l", logLevel),
+		log:        &logBuffer{},
+		exited:     make(chan struct{}),
+	}
+	instance.cmd.Stdout = instance.log
+	instance.cmd.Stderr = instance.log
+	if err := instance.cmd.Start(); err != nil {
+		t.Fatalf("start pg_doorman: %v", err)
+	}
+	go func() {
+		_ = instance.cmd.Wait()
+		close(instance.exited)
+	}()
+	t.Cleanup(instance.Stop)
+
+	timeout := opts.StartTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	if err := instance.waitReady(timeout); err != nil {
+		instance.Stop()
+		t.Fatalf("%v\n=== pg_doorman output ===\n%s", err, instance.Log())
+	}
+	return instance
+}
+
+func (i *Instance) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-i.exited:
+			return fmt.Errorf("pg_doorman exited: %v", i.cmd.ProcessState)
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", i.Addr(), 250*time.Millisecond)
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pg_doorman did not listen on %s within %s", i.Addr(), timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Addr is the host:port pg_doorman listens on.
+func (i *Instance) Addr() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(i.Port))
+}
+
+// DSN is a postgresql:// URL of database on the instance, without TLS.
+func (i *Instance) DSN(user, password, database string) string {
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(user, password),
+		Host:     i.Addr(),
+		Path:     "/" + database,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// Log is the output of pg_doorman so far.
+func (i *Instance) Log() string {
+	return i.log.String()
+}
+
+// Stop terminates pg_doorman: SIGTERM, then SIGKILL when it is still
+// running after a second. Safe to call more than once.
+func (i *Instance) Stop() {
+	i.once.Do(func() {
+		_ = i.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-i.exited:
+		case <-time.After(time.Second):
+			_ = i.cmd.Process.Kill()
+			<-i.exited
+		}
+	})
+}
+
+// FreePort is a TCP port nothing listens on at the moment of the call.
+func FreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,77 @@
+package pgdoormantest_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ozontech/pg_doorman/tests/go/pgdoormantest"
+)
+
+const config = `
+[general]
+host = "127.0.0.1"
+port = ${DOORMAN_PORT}
+admin_username = "admin"
+admin_password = "admin"
+
+[pools.example_db]
+server_host = "127.0.0.1"
+server_port = ${PG_PORT}
+
+[[pools.example_db.users]]
+username = "example_user_1"
+password = "md58a67a0c805a5ee0384ea28e0dea557b6"
+pool_size = 2
+`
+
+// TestStart runs pg_doorman in front of the PostgreSQL on $PG_PORT; it is
+// skipped unless $PG_DOORMAN_BINARY is set.
+func TestStart(t *testing.T) {
+	if os.Getenv("PG_DOORMAN_BINARY") == "" {
+		t.Skip("PG_DOORMAN_BINARY is not set")
+	}
+	pgPort := os.Getenv("PG_PORT")
+	if pgPort == "" {
+		pgPort = "5432"
+	}
+	doorman := pgdoormantest.Start(t, pgdoormantest.Options{
+		Config: config,
+		Vars:   map[string]string{"PG_PORT": pgPort},
+	})
+
+	conn, err := net.Dial("tcp", doorman.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	processID, secretKey := pgdoormantest.Login(t, conn, "example_user_1", "example_db", "test")
+
+	pgdoormantest.SendQuery(t, conn, "select 1")
+	if messages := pgdoormantest.ReadMessages(t, conn); len(messages) != 4 {
+		t.Fatalf("select 1: got %d messages, want 4", len(messages))
+	}
+
+	pgdoormantest.SendParse(t, conn, "select pg_sleep(10)")
+	pgdoormantest.SendBind(t, conn)
+	pgdoormantest.SendExecute(t, conn)
+	pgdoormantest.SendSync(t, conn)
+	time.Sleep(500 * time.Millisecond)
+	started := time.Now()
+	pgdoormantest.SendCancel(t, doorman.Addr(), processID, secretKey)
+	messages := pgdoormantest.ReadMessages(t, conn)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("cancel took %s", elapsed)
+	}
+	var code string
+	for _, message := range messages {
+		if message.Code == 'E' {
+			code = pgdoormantest.ErrorFields(message)['C']
+		}
+	}
+	if code != "57014" {
+		t.Fatalf("got SQLSTATE %q after cancel, want 57014", code)
+	}
+	pgdoormantest.SendTerminate(t, conn)
+}
@@ -0,0 +1,3 @@
+module github.com/ozontech/pg_doorman/tests/go/pgdoormantest
+
+go 1.24.0
@@ -0,0 +1,211 @@
+package pgdoormantest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+)
+
+const (
+	protocolVersion = 196608
+	cancelRequest   = 80877102
+)
+
+// Message is one backend message.
+type Message struct {
+	Code rune
+	// Length as sent, including the length field itself.
+	Length uint32
+	Bytes  []byte
+}
+
+// Login sends a StartupMessage for username and database and answers
+// trust, cleartext and MD5 authentication with password. It returns the
+// BackendKeyData once ReadyForQuery arrives.
+func Login(t testing.TB, conn net.Conn, username, database, password string) (processID int, secretKey int) {
+	t.Helper()
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, protocolVersion)
+	for _, s := range []string{"user", username, "database", database, ""} {
+		body = append(body, s...)
+		body = append(body, 0)
+	}
+	write(t, conn, binary.BigEndian.AppendUint32(nil, uint32(len(body)+4)), body)
+
+	for {
+		message := ReadMessage(t, conn)
+		switch message.Code {
+		case 'R':
+			switch method := binary.BigEndian.Uint32(message.Bytes); method {
+			case 0: // AuthenticationOk
+			case 3: // cleartext
+				sendPassword(t, conn, password)
+			case 5: // md5
+				hash := md5.Sum([]byte(password + username))
+				hash = md5.Sum(append([]byte(hex.EncodeToString(hash[:])), message.Bytes[4:8]...))
+				sendPassword(t, conn, "md5"+hex.EncodeToString(hash[:]))
+			default:
+				t.Fatalf("login: unsupported authentication method %d", method)
+			}
+		case 'K':
+			processID = int(binary.BigEndian.Uint32(message.Bytes[0:4]))
+			secretKey = int(binary.BigEndian.Uint32(message.Bytes[4:8]))
+		case 'E':
+			fields := ErrorFields(message)
+			t.Fatalf("login: %s %s: %s", fields['S'], fields['C'], fields['M'])
+		case 'Z':
+			return processID, secretKey
+		}
+	}
+}
+
+func sendPassword(t testing.TB, conn net.Conn, password string) {
+	t.Helper()
+	SendMessage(t, conn, 'p', append([]byte(password), 0))
+}
+
+// SendMessage writes a frontend message with the given type and body.
+func SendMessage(t testing.TB, conn net.Conn, code byte, body []byte) {
+	t.Helper()
+	header := binary.BigEndian.AppendUint32([]byte{code}, uint32(len(body)+4))
+	write(t, conn, header, body)
+}
+
+func write(t testing.TB, conn net.Conn, parts ...[]byte) {
+	t.Helper()
+	if _, err := conn.Write(bytes.Join(parts, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// SendQuery sends a simple Query.
+func SendQuery(t testing.TB, conn net.Conn, query string) {
+	t.Helper()
+	SendMessage(t, conn, 'Q', append([]byte(query), 0))
+}
+
+// SendParse sends a Parse of query into the unnamed statement, without
+// parameter types.
+func SendParse(t testing.TB, conn net.Conn, query string) {
+	t.Helper()
+	body := append([]byte{0}, query...)
+	SendMessage(t, conn, 'P', append(body, 0, 0, 0))
+}
+
+// SendBind binds the unnamed statement without parameters to the unnamed
+// portal.
+func SendBind(t testing.TB, conn net.Conn) {
+	t.Helper()
+	SendMessage(t, conn, 'B', []byte{0, 0, 0, 0, 0, 0, 0, 0})
+}
+
+// SendDescribe describes the unnamed statement ("S") or portal ("P").
+func SendDescribe(t testing.TB, conn net.Conn, kind string) {
+	t.Helper()
+	SendMessage(t, conn, 'D', append([]byte(kind), 0))
+}
+
+// SendExecute executes the unnamed portal without a row limit.
+func SendExecute(t testing.TB, conn net.Conn) {
+	t.Helper()
+	SendMessage(t, conn, 'E', []byte{0, 0, 0, 0, 0})
+}
+
+// SendSync sends a Sync.
+func SendSync(t testing.TB, conn net.Conn) {
+	t.Helper()
+	SendMessage(t, conn, 'S', nil)
+}
+
+// SendTerminate sends a Terminate.
+func SendTerminate(t testing.TB, conn net.Conn) {
+	t.Helper()
+	SendMessage(t, conn, 'X', nil)
+}
+
+// SendCancel sends a CancelRequest for the BackendKeyData returned by Login
+// on a new connection to addr.
+func SendCancel(t testing.TB, addr string, processID, secretKey int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var pack []byte
+	pack = binary.BigEndian.AppendUint32(pack, 16)
+	pack = binary.BigEndian.AppendUint32(pack, cancelRequest)
+	pack = binary.BigEndian.AppendUint32(pack, uint32(processID))
+	pack = binary.BigEndian.AppendUint32(pack, uint32(secretKey))
+	write(t, conn, pack)
+}
+
+// ReadMessage reads one backend message.
+func ReadMessage(t testing.TB, conn net.Conn) *Message {
+	t.Helper()
+	header := make([]byte, 5)
+	ReadFull(t, conn, header)
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < 4 {
+		t.Fatalf("message %q: invalid length %d", header[0], length)
+	}
+	body := make([]byte, length-4)
+	ReadFull(t, conn, body)
+	return &Message{Code: rune(header[0]), Length: length, Bytes: body}
+}
+
+// ReadMessages reads backend messages up to and including ReadyForQuery.
+func ReadMessages(t testing.TB, conn net.Conn) []*Message {
+	t.Helper()
+	var messages []*Message
+	for {
+		message := ReadMessage(t, conn)
+		messages = append(messages, message)
+		if message.Code == 'Z' {
+			return messages
+		}
+	}
+}
+
+// ReadFull fills buf from conn.
+func ReadFull(t testing.TB, conn net.Conn, buf []byte) {
+	t.Helper()
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ErrorFields are the fields of an ErrorResponse or NoticeResponse, keyed
+// by field type ('S' severity, 'C' SQLSTATE, 'M' message, ...).
+func ErrorFields(message *Message) map[byte]string {
+	fields := make(map[byte]string)
+	for rest := message.Bytes; len(rest) > 1; {
+		end := bytes.IndexByte(rest[1:], 0)
+		if end < 0 {
+			break
+		}
+		fields[rest[0]] = string(rest[1 : 1+end])
+		rest = rest[end+2:]
+	}
+	return fields
+}
+
+// MustEqualMessages reports an error when got differs from want.
+func MustEqualMessages(t testing.TB, got, want *Message) {
+	t.Helper()
+	if got.Code != want.Code {
+		t.Errorf("message are not equal. got %s want %s", string(got.Code), string(want.Code))
+		return
+	}
+	if got.Length != want.Length {
+		t.Errorf("message length are not equal. got %d want %d", got.Length, want.Length)
+		return
+	}
+	if !bytes.Equal(got.Bytes, want.Bytes) {
+		t.Errorf("message are not equal. got %s want %s", string(got.Bytes), string(want.Bytes))
+	}
+}
@@ -0,0 +1,90 @@
+package pgdoormantest_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ozontech/pg_doorman/tests/go/pgdoormantest"
+)
+
+// fakeServer answers a login with MD5 authentication and a query with one
+// row, checking what the client sends.
+func fakeServer(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 4)
+	pgdoormantest.ReadFull(t, conn, header)
+	startup := make([]byte, binary.BigEndian.Uint32(header)-4)
+	pgdoormantest.ReadFull(t, conn, startup)
+	if !bytes.Contains(startup, []byte("user\x00example_user_1\x00database\x00example_db\x00")) {
+		t.Errorf("unexpected startup message %q", startup)
+	}
+
+	send := func(code byte, body ...byte) {
+		message := binary.BigEndian.AppendUint32([]byte{code}, uint32(len(body)+4))
+		if _, err := conn.Write(append(message, body...)); err != nil {
+			t.Error(err)
+		}
+	}
+	send('R', 0, 0, 0, 5, 's', 'a', 'l', 't')
+	password := pgdoormantest.ReadMessage(t, conn)
+	// md5(md5("test" + "example_user_1") + "salt")
+	if string(password.Bytes) != "md5a8b9b6ea7ad97d39ed1c9dfb1836dd4d\x00" {
+		send('E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00")...)
+		return
+	}
+	send('R', 0, 0, 0, 0)
+	send('S', []byte("server_version\x0017.0\x00")...)
+	send('K', 0, 0, 0, 7, 0, 0, 0, 42)
+	send('Z', 'I')
+
+	query := pgdoormantest.ReadMessage(t, conn)
+	if query.Code != 'Q' || string(query.Bytes) != "select 1\x00" {
+		t.Errorf("unexpected query %q %q", query.Code, query.Bytes)
+	}
+	send('T', 0, 1, '?', 'c', 'o', 'l', 'u', 'm', 'n', '?', 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0)
+	send('D', 0, 1, 0, 0, 0, 1, '1')
+	send('C', []byte("SELECT 1\x00")...)
+	send('Z', 'I')
+}
+
+func TestLoginAndQuery(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fakeServer(t, server)
+	}()
+
+	processID, secretKey := pgdoormantest.Login(t, client, "example_user_1", "example_db", "test")
+	if processID != 7 || secretKey != 42 {
+		t.Fatalf("BackendKeyData %d/%d, want 7/42", processID, secretKey)
+	}
+	pgdoormantest.SendQuery(t, client, "select 1")
+	messages := pgdoormantest.ReadMessages(t, client)
+	var codes string
+	for _, message := range messages {
+		codes += string(message.Code)
+	}
+	if codes != "TDCZ" {
+		t.Fatalf("messages %q, want TDCZ", codes)
+	}
+	pgdoormantest.MustEqualMessages(t, messages[1], &pgdoormantest.Message{
+		Code: 'D', Length: 11, Bytes: []byte{0, 1, 0, 0, 0, 1, '1'},
+	})
+	<-done
+}
+
+func TestErrorFields(t *testing.T) {
+	fields := pgdoormantest.ErrorFields(&pgdoormantest.Message{
+		Code:  'E',
+		Bytes: []byte("SERROR\x00C57014\x00Mcanceling statement due to user request\x00\x00"),
+	})
+	if fields['S'] != "ERROR" || fields['C'] != "57014" ||
+		fields['M'] != "canceling statement due to user request" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,165 @@
+import java.sql.Connection;
+import java.sql.DriverManager;
+import java.sql.ParameterMetaData;
+import java.sql.PreparedStatement;
+import java.sql.ResultSet;
+import java.sql.SQLException;
+import java.sql.Statement;
+
+/**
+ * pgjdbc compatibility test for pools with driver_compat = "jdbc".
+ * Covers server-side statement promotion (prepareThreshold), Describe
+ * before Bind, DEALLOCATE sent as a simple query and autosave.
+ */
+public class Main {
+    private static String databaseUrl;
+
+    public static void main(String[] args) {
+        databaseUrl = System.getenv("DATABASE_URL");
+        if (databaseUrl == null || databaseUrl.isEmpty()) {
+            databaseUrl = "jdbc:postgresql://127.0.0.1:6433/example_db?user=example_user_1&password=test";
+        }
+
+        try {
+            // Test 1: statements promoted to named server-side statements S_n
+            System.out.println("Test 1: prepareThreshold=1 named statements");
+            try (Connection connection = connect("prepareThreshold=1")) {
+                try (PreparedStatement first = connection.prepareStatement("SELECT ?::int + 1");
+                     PreparedStatement second = connection.prepareStatement("SELECT ?::text || 'x'")) {
+                    for (int i = 0; i < 20; i++) {
+                        expectInt(first, i, i + 1);
+                        second.setString(1, "v" + i);
+                        try (ResultSet rs = second.executeQuery()) {
+                            rs.next();
+                            if (!("v" + i + "x").equals(rs.getString(1))) {
+                                throw new RuntimeException("Unexpected value " + rs.getString(1));
+                            }
+                        }
+                    }
+                }
+            }
+            System.out.println("Test 1 complete");
+
+            // Test 2: getParameterMetaData sends Describe before the first Bind
+            System.out.println("Test 2: Describe before Bind");
+            try (Connection connection = connect("prepareThreshold=1")) {
+                try (PreparedStatement pstmt = connection.prepareStatement(
+                        "SELECT ?::int * ?::int")) {
+                    ParameterMetaData meta = pstmt.getParameterMetaData();
+                    if (meta.getParameterCount() != 2) {
+                        throw new RuntimeException("Expected 2 parameters, got " + meta.getParameterCount());
+                    }
+                    for (int i = 0; i < 5; i++) {
+                        pstmt.setInt(1, i);
+                        pstmt.setInt(2, 3);
+                        try (ResultSet rs = pstmt.executeQuery()) {
+                            rs.next();
+                            if (rs.getInt(1) != i * 3) throw new RuntimeException("Unexpected product");
+                        }
+                        // Describe again between executions of the named statement
+                        if (pstmt.getParameterMetaData().getParameterCount() != 2) {
+                            throw new RuntimeException("Parameter count changed");
+                        }
+                    }
+                }
+            }
+            System.out.println("Test 2 complete");
+
+            // Test 3: DEALLOCATE ALL as a simple query in the middle of a session
+            System.out.println("Test 3: DEALLOCATE ALL mid-session");
+            try (Connection connection = connect("prepareThreshold=1&preferQueryMode=extendedForPrepared")) {
+                try (PreparedStatement pstmt = connection.prepareStatement("SELECT ?::int + 10");
+                     Statement stmt = connection.createStatement()) {
+                    for (int round = 0; round < 3; round++) {
+                        for (int i = 0; i < 5; i++) {
+                            expectInt(pstmt, i, i + 10);
+                        }
+                        stmt.execute("DEALLOCATE ALL");
+                    }
+                    expectInt(pstmt, 1, 11);
+                }
+            }
+            System.out.println("Test 3 complete");
+
+            // Test 4: a statement pg_doorman no longer knows heals by re-Parse
+            System.out.println("Test 4: unknown statement keeps the connection");
+            try (Connection connection = connect("prepareThreshold=1&preferQueryMode=extendedForPrepared")) {
+                try (PreparedStatement pstmt = connection.prepareStatement("SELECT ?::int + 20");
+                     Statement stmt = connection.createStatement()) {
+                    expectInt(pstmt, 1, 21);
+                    expectInt(pstmt, 2, 22);
+                    // pgjdbc does not track the name: it keeps binding S_1.
+                    stmt.execute("DEALLOCATE S_1");
+                    int failures = 0;
+                    for (int i = 0; i < 3; i++) {
+                        try {
+                            expectInt(pstmt, i, i + 20);
+                        } catch (SQLException e) {
+                            if (!"26000".equals(e.getSQLState()) || ++failures > 1) throw e;
+                            System.out.println("  Got expected error: " + e.getMessage());
+                        }
+                    }
+                    if (!connection.isValid(2)) throw new RuntimeException("Connection was closed");
+                }
+            }
+            System.out.println("Test 4 complete");
+
+            // Test 5: autosave rolls back to its savepoint after an error
+            System.out.println("Test 5: autosave=conservative");
+            try (Connection connection = connect("prepareThreshold=1&autosave=conservative")) {
+                try (Statement stmt = connection.createStatement()) {
+                    stmt.execute("DROP TABLE IF EXISTS jdbc_compat_autosave; " +
+                        "CREATE TABLE jdbc_compat_autosave(id int primary key)");
+                }
+                connection.setAutoCommit(false);
+                try (PreparedStatement insert = connection.prepareStatement(
+                        "INSERT INTO jdbc_compat_autosave(id) VALUES(?)")) {
+                    for (int i = 1; i <= 3; i++) {
+                        insert.setInt(1, i);
+                        insert.executeUpdate();
+                    }
+                    try {
+                        insert.setInt(1, 2);
+                        insert.executeUpdate();
+                        throw new RuntimeException("Duplicate key was accepted");
+                    } catch (SQLException e) {
+                        if (!"23505".equals(e.getSQLState())) throw e;
+                        System.out.println("  Got expected error: " + e.getMessage());
+                    }
+                    // The transaction goes on after the failed statement
+                    insert.setInt(1, 4);
+                    insert.executeUpdate();
+                }
+                connection.commit();
+                connection.setAutoCommit(true);
+                try (Statement stmt = connection.createStatement();
+                     ResultSet rs = stmt.executeQuery("SELECT count(*) FROM jdbc_compat_autosave")) {
+                    rs.next();
+                    if (rs.getInt(1) != 4) throw new RuntimeException("Expected 4 rows, got " + rs.getInt(1));
+                    stmt.execute("DROP TABLE jdbc_compat_autosave");
+                }
+            }
+            System.out.println("Test 5 complete");
+
+            System.out.println("jdbc_compat complete");
+        } catch (Exception e) {
+            System.err.println("Error: " + e.getMessage());
+            e.printStackTrace();
+            System.exit(1);
+        }
+    }
+
+    private static Connection connect(String parameters) throws SQLException {
+        return DriverManager.getConnection(databaseUrl + "&" + parameters);
+    }
+
+    private static void expectInt(PreparedStatement pstmt, int value, int expected) throws SQLException {
+        pstmt.setInt(1, value);
+        try (ResultSet rs = pstmt.executeQuery()) {
+            rs.next();
+            if (rs.getInt(1) != expected) {
+                throw new RuntimeException("Expected " + expected + ", got " + rs.getInt(1));
+            }
+        }
+    }
+}